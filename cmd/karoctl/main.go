@@ -0,0 +1,483 @@
+// Command karoctl helps administrators prepare clusters for the operator.
+//
+//	karoctl rbac -f integrations.yaml --namespaces team-a,team-b
+//
+// prints the Roles and RoleBindings that an operator started with
+// --namespace-scoped needs for the given Integrations, and
+//
+//	karoctl check-permissions -f integrations.yaml
+//
+// prints the permissions for them that the operator's ServiceAccount lacks, and
+//
+//	karoctl lint -f integrations.yaml --sample agent.yaml --crd agent_crd.yaml
+//
+// checks their templates, failing on any finding, e.g. in pre-merge CI.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/lint"
+	"github.com/GoogleCloudPlatform/karo/pkg/rbac"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const usage = `Usage: karoctl <command> [flags]
+
+Commands:
+  rbac               Print the Roles that a namespace-scoped operator needs for Integrations.
+  check-permissions  Print the permissions for Integrations that the operator lacks.
+  lint               Check the templates of Integrations.
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "karoctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command given")
+	}
+	switch args[0] {
+	case "rbac":
+		return runRBAC(ctx, args[1:], out)
+	case "check-permissions":
+		return runCheckPermissions(ctx, args[1:], out)
+	case "lint":
+		return runLint(ctx, args[1:], out)
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// runRBAC prints the Roles and RoleBindings needed for the Integrations in
+// the given files.
+func runRBAC(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("rbac", flag.ContinueOnError)
+	var files, extraKinds []string
+	addInputFlags(flags, &files, &extraKinds)
+	namespaces := flags.String("namespaces", "", "The namespaces, separated by commas, that the operator watches with --watch-namespace.")
+	serviceAccount := flags.String("service-account", "default/skippy-controller-manager", "The namespace/name of the operator's ServiceAccount.")
+	name := flags.String("name", "karo-operator", "The name of the generated Roles and RoleBindings.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("no Integration files given with -f")
+	}
+	watched := splitList(*namespaces)
+	if len(watched) == 0 {
+		return errors.New("no namespaces given with --namespaces")
+	}
+	saNamespace, saName, err := parseServiceAccount(*serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	specs, dependents, err := readPermissionInputs(ctx, files, extraKinds)
+	if err != nil {
+		return err
+	}
+
+	mapper, err := clusterMapper()
+	if err != nil {
+		return err
+	}
+	rules := rbac.ForIntegrations(mapper, specs, dependents).Rules()
+	objs := rbac.NamespacedRoles(*name, types.NamespacedName{Namespace: saNamespace, Name: saName}, watched, rules)
+	return printObjects(out, objs)
+}
+
+// clusterMapper returns the RESTMapper of the cluster of the current
+// kubeconfig, or nil if there is none, in which case the resources of the
+// kinds are guessed.
+func clusterMapper() (meta.RESTMapper, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, nil
+	}
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return apiutil.NewDynamicRESTMapper(cfg, httpClient)
+}
+
+// runCheckPermissions checks which of the permissions that the Integrations
+// in the given files need the operator's ServiceAccount lacks, and prints
+// them. It fails if any are missing.
+func runCheckPermissions(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("check-permissions", flag.ContinueOnError)
+	var files, extraKinds []string
+	addInputFlags(flags, &files, &extraKinds)
+	namespaces := flags.String("namespaces", "", "The namespaces, separated by commas, that the operator watches with --watch-namespace. Cluster-wide permissions are checked if empty.")
+	serviceAccount := flags.String("service-account", "default/skippy-controller-manager", "The namespace/name of the operator's ServiceAccount, which is impersonated. The permissions of the current user are checked if empty.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("no Integration files given with -f")
+	}
+	checked := splitList(*namespaces)
+	if len(checked) == 0 {
+		checked = []string{metav1.NamespaceAll}
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	if *serviceAccount != "" {
+		saNamespace, saName, err := parseServiceAccount(*serviceAccount)
+		if err != nil {
+			return err
+		}
+		cfg.Impersonate.UserName = fmt.Sprintf("system:serviceaccount:%s:%s", saNamespace, saName)
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return err
+	}
+
+	specs, dependents, err := readPermissionInputs(ctx, files, extraKinds)
+	if err != nil {
+		return err
+	}
+	missing, err := rbac.Check(ctx, c, rbac.ForIntegrations(c.RESTMapper(), specs, dependents), checked)
+	if err != nil {
+		return err
+	}
+	return printMissingPermissions(out, missing)
+}
+
+// runLint lints the templates of the Integrations in the given files, and
+// prints the findings. It fails if there are any.
+func runLint(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	var files, sampleFiles, crdFiles []string
+	localDirs := map[string]string{}
+	flags.Func("f", "A file of Integrations. Can be repeated.", func(value string) error {
+		files = append(files, value)
+		return nil
+	})
+	flags.Func("sample", "A file of sample resources of the integrated kinds, which the templates are rendered for. Can be repeated.", func(value string) error {
+		sampleFiles = append(sampleFiles, value)
+		return nil
+	})
+	flags.Func("crd", "A file of the CRDs of the integrated kinds, whose schemas the fields that the templates read are checked against. Can be repeated.", func(value string) error {
+		crdFiles = append(crdFiles, value)
+		return nil
+	})
+	flags.Func("local", "A template path of the Integrations and a local directory to read its templates from instead, as path=dir, e.g. gcs:/bucket/agent=./templates/agent. Can be repeated.", func(value string) error {
+		path, dir, ok := strings.Cut(value, "=")
+		if !ok || path == "" || dir == "" {
+			return fmt.Errorf("invalid local template path %q, expected path=dir", value)
+		}
+		localDirs[path] = dir
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("no Integration files given with -f")
+	}
+	var specs []v1.IntegrationSpec
+	for _, file := range files {
+		integrations, err := readIntegrations(file)
+		if err != nil {
+			return err
+		}
+		for _, integration := range integrations {
+			specs = append(specs, integration.Spec...)
+		}
+	}
+	samples, err := readObjectFiles(sampleFiles)
+	if err != nil {
+		return err
+	}
+	crds, err := readObjectFiles(crdFiles)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for i := range specs {
+		spec := specs[i]
+		spec.Default()
+		gvk := schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}
+		opts := lint.Options{Sample: sampleFor(samples, gvk)}
+		if opts.Schema, err = schemaFor(crds, gvk); err != nil {
+			return err
+		}
+		var bundles []lint.Bundle
+		for _, template := range spec.Templates {
+			if dir, ok := localDirs[template.Path]; ok {
+				bundles = append(bundles, lint.Bundle{FS: filesys.MakeFsOnDisk(), Root: dir, Operation: template.Operation})
+				continue
+			}
+			fSys, root, err := transformer.TemplateFileSystem(ctx, template.Path)
+			if err != nil {
+				return fmt.Errorf("unable to get file system for path %q: %v", template.Path, err)
+			}
+			bundles = append(bundles, lint.Bundle{FS: fSys, Root: root, Operation: template.Operation})
+		}
+		findings, err := lint.Bundles(spec, bundles, opts)
+		if err != nil {
+			return fmt.Errorf("unable to lint the templates of %s: %w", gvk.Kind, err)
+		}
+		for _, finding := range findings {
+			fmt.Fprintf(out, "%s: %s\n", gvk.Kind, finding)
+		}
+		total += len(findings)
+	}
+	if total > 0 {
+		return fmt.Errorf("%d finding(s)", total)
+	}
+	fmt.Fprintln(out, "No findings.")
+	return nil
+}
+
+// sampleFor returns the first of samples of kind gvk.
+func sampleFor(samples []*unstructured.Unstructured, gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	for _, sample := range samples {
+		if sample.GroupVersionKind() == gvk {
+			return sample
+		}
+	}
+	return nil
+}
+
+// schemaFor returns the schema of version gvk.Version in the CRD of gvk among
+// objs, or nil if there is none.
+func schemaFor(objs []*unstructured.Unstructured, gvk schema.GroupVersionKind) (*apiextensionsv1.JSONSchemaProps, error) {
+	for _, obj := range objs {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, crd); err != nil {
+			return nil, fmt.Errorf("unable to read CRD %s: %w", obj.GetName(), err)
+		}
+		if crd.Spec.Group != gvk.Group || crd.Spec.Names.Kind != gvk.Kind {
+			continue
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Name == gvk.Version && version.Schema != nil {
+				return version.Schema.OpenAPIV3Schema, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// printMissingPermissions writes the missing permissions as a table, and
+// returns an error if there are any.
+func printMissingPermissions(out io.Writer, missing []v1.IntegrationPermission) error {
+	if len(missing) == 0 {
+		fmt.Fprintln(out, "No permissions are missing.")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tRESOURCE\tVERBS")
+	for _, permission := range missing {
+		namespace := permission.Namespace
+		if namespace == "" {
+			namespace = "*"
+		}
+		resource := schema.GroupResource{Group: permission.Group, Resource: permission.Resource}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", namespace, resource, strings.Join(permission.Verbs, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d permission(s) are missing", len(missing))
+}
+
+// addInputFlags adds the flags that select the Integrations and the kinds
+// that the operator manages.
+func addInputFlags(flags *flag.FlagSet, files, extraKinds *[]string) {
+	flags.Func("f", "A file of Integrations. Can be repeated.", func(value string) error {
+		*files = append(*files, value)
+		return nil
+	})
+	flags.Func("extra-kind", "A group/version/Kind (v1/Kind for the core group) that the operator manages besides the ones found in the templates, e.g. objects rendered by template functions or read by stateful logic. Can be repeated.", func(value string) error {
+		*extraKinds = append(*extraKinds, value)
+		return nil
+	})
+}
+
+// parseServiceAccount parses namespace/name.
+func parseServiceAccount(value string) (string, string, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid service account %q, expected namespace/name", value)
+	}
+	return namespace, name, nil
+}
+
+// readPermissionInputs reads the Integrations in files and the kinds that
+// their templates render, adding extraKinds.
+func readPermissionInputs(ctx context.Context, files, extraKinds []string) ([]v1.IntegrationSpec, []schema.GroupVersionKind, error) {
+	var specs []v1.IntegrationSpec
+	for _, file := range files {
+		integrations, err := readIntegrations(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, integration := range integrations {
+			specs = append(specs, integration.Spec...)
+		}
+	}
+
+	var dependents []schema.GroupVersionKind
+	for i := range specs {
+		specs[i].Default()
+		for _, template := range specs[i].Templates {
+			// Overlays patch the objects of the other bundles.
+			if template.Operation == "overlay" {
+				continue
+			}
+			kinds, err := transformer.TemplateKinds(ctx, template.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+			dependents = append(dependents, kinds...)
+		}
+	}
+	for _, value := range extraKinds {
+		gvk, err := parseKind(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		dependents = append(dependents, gvk)
+	}
+
+	return specs, dependents, nil
+}
+
+// readIntegrations reads the Integrations in a YAML or JSON file, skipping
+// the other objects.
+func readIntegrations(file string) ([]v1.Integration, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var integrations []v1.Integration
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var integration v1.Integration
+		if err := decoder.Decode(&integration); err != nil {
+			if errors.Is(err, io.EOF) {
+				return integrations, nil
+			}
+			return nil, fmt.Errorf("unable to read %s: %w", file, err)
+		}
+		if integration.Kind == "Integration" {
+			integrations = append(integrations, integration)
+		}
+	}
+}
+
+// readObjectFiles reads the objects in YAML or JSON files.
+func readObjectFiles(files []string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				f.Close()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("unable to read %s: %w", file, err)
+			}
+			if len(obj.Object) > 0 {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs, nil
+}
+
+// parseKind parses group/version/Kind, or version/Kind for the core group.
+func parseKind(value string) (schema.GroupVersionKind, error) {
+	i := strings.LastIndex(value, "/")
+	if i < 0 {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid kind %q, expected group/version/Kind", value)
+	}
+	gv, err := schema.ParseGroupVersion(value[:i])
+	if err != nil || value[i+1:] == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid kind %q, expected group/version/Kind", value)
+	}
+	return gv.WithKind(value[i+1:]), nil
+}
+
+// printObjects writes objs as a YAML stream.
+func printObjects(out io.Writer, objs []client.Object) error {
+	for i, obj := range objs {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+		data, err := yaml.Marshal(content)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(out, "---")
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var result []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
@@ -6,22 +6,38 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/GoogleCloudPlatform/karo/assets"
 	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/api/v1beta1"
 	"github.com/GoogleCloudPlatform/karo/pkg/controller"
+	"github.com/GoogleCloudPlatform/karo/pkg/sharding"
 	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	k8szap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	//+kubebuilder:scaffold:imports
@@ -33,15 +49,24 @@ var (
 	// setupLog represents the logger that we use during the setup phase of the
 	// manager.
 	setupLog = ctrl.Log.WithName("setup")
-	// The user agent string we will use in conjunction with REST requests.
-	userAgent = "ai-connector/0.1.0"
+	// The default user agent string we will use in conjunction with REST requests.
+	defaultUserAgent = "ai-connector/0.1.0"
 )
 
+// inClusterNamespacePath holds the namespace of the pod.
+const inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// shutdownTimeoutMargin is added to the shutdown grace period for the
+// manager's graceful shutdown timeout.
+const shutdownTimeoutMargin = 5 * time.Second
+
 func main() {
 
 	// Register schemas
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(v1.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	if err := run(ctrl.SetupSignalHandler()); err != nil {
 		os.Exit(1)
@@ -50,20 +75,154 @@ func main() {
 
 func run(ctx context.Context) error {
 	var metricsAddr string
+	var secureMetrics bool
+	var metricsCertDir string
+	var metricsRequireAuth bool
 	var probeAddr string
+	var statusAddr string
 	var enableLeaderElection bool
 	var leaderElectionNamespace string
 	var enableHTTP2 bool
 	var logEncoder string
 	var watchNamespace string
+	var userAgent string
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var eventPolicy string
+	var emitEvents string
+	var otlpEndpoint string
+	var podRuntimeClassName string
+	var podSeccompProfile string
+	var podRunAsNonRoot bool
+	var podDropCapabilities string
+	var podImagePullSecrets string
+	var podTopologySpreadKey string
+	var podTopologySpreadMaxSkew int64
+	var podTopologySpreadWhenUnsatisfiable string
+	var podAllowedImages string
+	var podImageSignatureKeys string
+	var gcsFuseProfile string
+	var clusterDefaultsConfigMap string
+	var clusterInfo transformer.ClusterInfo
+	var templateIntegrityRemote string
+	var templateIntegrityInterval time.Duration
+	var contextHTTPProxy string
+	var contextHTTPSProxy string
+	var contextNoProxy string
+	var contextCABundle string
+	var quotaGuardrails bool
+	var preflight string
+	var environment string
+	var dependentConcurrency int
+	var logRenderedManifests bool
+	var configChecksums bool
+	var renderArtifacts string
+	var reconcileExport string
+	var renderArtifactRetention int
+	var enableConversionWebhook bool
+	var conversionWebhookService string
+	var conversionWebhookCAFile string
+	var enableValidatingWebhook bool
+	var enableTargetValidatingWebhook bool
+	var namespaceScoped bool
+	var checkPermissions bool
+	var enableSharding bool
+	var shardGroup string
+	var shardNamespace string
+	var shardIdentity string
+	var enableInvalidationEndpoint bool
+	var reconcileHistory int
+	var maxStatusDependents int
+	var dependencyTimeout time.Duration
+	var dependencyRequeueInterval time.Duration
+	var shutdownGracePeriod time.Duration
+	var fairQueuing bool
+	var reconcilePriorities bool
+	var policyChecks bool
+	var policyConfigMap string
+	var typedApply bool
+	var dryRunAll bool
+	var adoption string
+	var priceSheetPath string
+	var pinImageDigests bool
+	var imageDigestTTL time.Duration
+	var quantityForms string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&secureMetrics, "metrics-secure", false, "If set, the metrics endpoint is served over HTTPS, with the certificate in --metrics-cert-dir or else a self-signed one.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "", "The directory with the tls.crt and tls.key of the metrics endpoint. They are reloaded when they change, e.g. when cert-manager renews them.")
+	flag.BoolVar(&metricsRequireAuth, "metrics-require-auth", false, "If set, the metrics endpoint requires a bearer token, authenticated with a TokenReview, of a user who may get its path, e.g. with the karo-metrics-reader ClusterRole. It requires --metrics-secure.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&statusAddr, "status-bind-address", "", "The address the read-only status server binds to, e.g. ':8082'. It serves the Integrations, managed resources, last errors and an inventory per Integration as JSON on every replica, not only the leader. Disabled if empty.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false, "If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	flag.StringVar(&logEncoder, "log-encoder", "console", "Encoder to use for logging. Valid values are 'json' and 'console'. Defaults to 'json'")
 	flag.StringVar(&watchNamespace, "watch-namespace", "", "Specify a list of namespaces to watch for custom resources, separated by commas. If left empty, all namespaces will be watched.")
+	flag.StringVar(&userAgent, "user-agent", defaultUserAgent, "The user agent to send with requests to the Kubernetes API server.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20, "The maximum queries per second from the operator to the Kubernetes API server.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30, "The maximum burst of queries from the operator to the Kubernetes API server.")
+	flag.StringVar(&emitEvents, "emit-events", string(controller.EventPolicyTransitions), "Which events to record on reconciled resources. Valid values are 'none', 'transitions' (only record changes and failures) and 'all' (record every event on every reconcile). The reasons of the events are listed in the v1 API.")
+	flag.StringVar(&eventPolicy, "event-policy", "", "Deprecated: use --emit-events, which takes precedence. 'verbose' is the same as --emit-events=all.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "The OTLP gRPC endpoint (host:port) to export traces to. Tracing is disabled if left empty.")
+	flag.StringVar(&podRuntimeClassName, "pod-runtime-class-name", "", "The RuntimeClass (e.g. 'gvisor') required for every generated pod. Not enforced if left empty.")
+	flag.StringVar(&podSeccompProfile, "pod-seccomp-profile", "", "The seccomp profile type (e.g. 'RuntimeDefault') required for every generated pod. Not enforced if left empty.")
+	flag.BoolVar(&podRunAsNonRoot, "pod-run-as-non-root", false, "If set, every generated pod must run as a non-root user.")
+	flag.StringVar(&podDropCapabilities, "pod-drop-capabilities", "", "Linux capabilities, separated by commas, dropped from every generated container (e.g. 'ALL').")
+	flag.StringVar(&podImagePullSecrets, "pod-image-pull-secrets", "", "Secrets, separated by commas, added to the imagePullSecrets of every generated pod.")
+	flag.StringVar(&podTopologySpreadKey, "pod-topology-spread-key", "", "The topology key (e.g. 'topology.kubernetes.io/zone') that generated pods without topologySpreadConstraints are spread over, selected by the labels of their template. Pods are not spread if empty.")
+	flag.Int64Var(&podTopologySpreadMaxSkew, "pod-topology-spread-max-skew", 1, "The maxSkew of the topology spread constraint added with --pod-topology-spread-key.")
+	flag.StringVar(&podTopologySpreadWhenUnsatisfiable, "pod-topology-spread-when-unsatisfiable", string(corev1.ScheduleAnyway), "The whenUnsatisfiable of the topology spread constraint added with --pod-topology-spread-key. Valid values are 'ScheduleAnyway' and 'DoNotSchedule'.")
+	flag.StringVar(&podAllowedImages, "pod-allowed-images", "", "Regular expressions, separated by commas, one of which every container image of the generated pods must match (e.g. '^us-docker\\.pkg\\.dev/team/'). Images are not restricted if left empty.")
+	flag.StringVar(&podImageSignatureKeys, "pod-image-signature-keys", "", "The path of a file with PEM encoded cosign public keys. If set, every container image of the generated pods must have a cosign signature by one of them.")
+	flag.StringVar(&gcsFuseProfile, "gcsfuse-profile", "", "The profile ("+strings.Join(transformer.GCSFuseProfiles(), ", ")+") that tunes the Cloud Storage FUSE CSI volumes of generated pods whose template does not name one with the "+transformer.GCSFuseProfileAnnotation+" annotation. Only pods that name a profile are tuned if empty.")
+	flag.StringVar(&clusterDefaultsConfigMap, "cluster-defaults-configmap", "", "A ConfigMap, as namespace/name, with the default nodeSelector, tolerations, priorityClassName and imagePullSecrets of generated pods, under the key \"default\" for every kind or under Kind.group for the pods of one kind. The defaults fill in what templates leave out, are available to templates as .clusterDefaults, and are read again every minute. Not applied if empty.")
+	flag.StringVar(&clusterInfo.Name, "cluster-name", "", "The name of the cluster that templates read as .cluster.name. Discovered from the metadata server if empty.")
+	flag.StringVar(&clusterInfo.Location, "cluster-location", "", "The region or zone of the cluster that templates read as .cluster.location. Discovered from the metadata server, or the region of a node, if empty.")
+	flag.StringVar(&clusterInfo.ProjectID, "cluster-project", "", "The Google Cloud project of the cluster that templates read as .cluster.projectID. Discovered from the metadata server, or the provider ID of a node, if empty.")
+	flag.StringVar(&templateIntegrityRemote, "template-integrity-remote", "", "A gs://bucket/prefix URI of a copy of the embedded template bundles, e.g. gs://skippy-kustomization-templates/integrations. If set, the embedded templates are compared with it at startup and then periodically, and divergent files are reported in the karo_template_bundle_divergent_files metric and the TemplatesInSync condition of the Integrations that use them.")
+	flag.DurationVar(&templateIntegrityInterval, "template-integrity-interval", controller.DefaultTemplateIntegrityInterval, "How often the embedded templates are compared with --template-integrity-remote.")
+	flag.StringVar(&contextHTTPSProxy, "context-https-proxy", "", "The proxy of the https context requests of the integrations. Defaults to HTTPS_PROXY.")
+	flag.StringVar(&contextHTTPProxy, "context-http-proxy", "", "The proxy of the http context requests of the integrations. Defaults to HTTP_PROXY.")
+	flag.StringVar(&contextNoProxy, "context-no-proxy", "", "The hosts, domains and CIDRs, separated by commas, that context requests reach without --context-https-proxy and --context-http-proxy. Defaults to NO_PROXY.")
+	flag.StringVar(&contextCABundle, "context-ca-bundle", "", "The path of a file with PEM encoded CA certificates that are trusted for the context requests of the integrations, in addition to the system roots, e.g. the CA of internal services.")
+	flag.BoolVar(&pinImageDigests, "pin-image-digests", false, "If set, the image tags of generated pods are resolved to digests with HEAD requests to their registries and pinned as tag@digest, and the digests are recorded in status.imageDigests of each custom resource. Container Registry and Artifact Registry are read with the operator's Google credentials, other registries anonymously.")
+	flag.DurationVar(&imageDigestTTL, "image-digest-ttl", transformer.DefaultImageDigestTTL, "How long a resolved image digest is reused before its registry is asked again, which bounds how late a retagged image is rolled out.")
+	flag.BoolVar(&quotaGuardrails, "quota-guardrails", false, "If set, rendered dependents are checked against the namespace ResourceQuotas before they are applied.")
+	flag.StringVar(&environment, "environment", "", "The environment (e.g. 'dev' or 'prod') whose template overlays are applied. The model.skippy.io/environment label of an Integration takes precedence.")
+	flag.IntVar(&dependentConcurrency, "dependent-concurrency", controller.DefaultDependentConcurrency, "The maximum number of dependents of a resource that are applied in parallel. Dependents in different apply waves are never applied in parallel.")
+	flag.BoolVar(&configChecksums, "config-checksums", false, "If set, the pod templates of generated Deployments are annotated with a checksum of the generated ConfigMaps and Secrets they use, so that a change of their content restarts the pods.")
+	flag.BoolVar(&logRenderedManifests, "log-rendered-manifests", false, "If set, rendered objects are logged in full at verbosity 1, with Secret data, sensitive annotations and URL signatures redacted. Otherwise only their kinds and names are logged.")
+	flag.StringVar(&renderArtifacts, "render-artifacts", "", "Where the dependents applied for each generation of a resource are stored, with Secret data redacted: \"configmap\" for ConfigMaps owned by the resource, or a gs://bucket/prefix URI. Not stored if empty.")
+	flag.StringVar(&reconcileExport, "reconcile-export", "", "Where summaries of reconciles (resource, outcome, duration and changed dependents) are exported to: logging:projects/<project>/logs/<log> for Cloud Logging or pubsub:projects/<project>/topics/<topic> for Pub/Sub. Not exported if empty.")
+	flag.IntVar(&renderArtifactRetention, "render-artifact-retention", controller.DefaultRenderArtifactRetention, "The number of generations of each resource whose render artifacts are kept.")
+	flag.BoolVar(&enableConversionWebhook, "enable-conversion-webhook", false, "If set, the webhook server serves the conversion webhook of the Integration versions. It needs a serving certificate in the webhook server's cert dir.")
+	flag.StringVar(&conversionWebhookService, "conversion-webhook-service", "", "The namespace/name of the Service of the conversion webhook. If set, the operator points the conversion of the Integration CRD at it and serves v1beta1, which the CRD is installed without.")
+	flag.StringVar(&conversionWebhookCAFile, "conversion-webhook-ca-file", "/tmp/k8s-webhook-server/serving-certs/ca.crt", "The PEM encoded CA of the serving certificate of the conversion webhook, set as the CA bundle of the conversion of the Integration CRD.")
+	flag.BoolVar(&enableValidatingWebhook, "enable-validating-webhook", false, "If set, the webhook server serves the validating webhook of Integrations. It needs a serving certificate in the webhook server's cert dir.")
+	flag.BoolVar(&enableTargetValidatingWebhook, "enable-target-validating-webhook", false, "If set, the webhook server validates the custom resources of the integrated kinds on "+controller.TargetValidationPath+" against the required fields, the accelerator matrix and the allowed images, and the rules of the "+controller.DefaultTargetWebhookName+" ValidatingWebhookConfiguration follow the Integrations. It needs a serving certificate in the webhook server's cert dir.")
+	flag.BoolVar(&namespaceScoped, "namespace-scoped", false, "If set, the operator only needs permissions in the namespaces of --watch-namespace, e.g. the Roles generated by 'karoctl rbac'. Integrations of cluster-scoped kinds are skipped, and rejected by the validating webhook.")
+	flag.BoolVar(&checkPermissions, "check-permissions", false, "If set, the permissions that the operator needs for the resources of each Integration, their references and the kinds that their templates render are checked with SelfSubjectAccessReviews, in the namespaces of --watch-namespace or cluster-wide, and the missing ones are reported in status.missingPermissions of the Integration.")
+	flag.BoolVar(&enableSharding, "sharding", false, "If set, every replica reconciles the custom resources whose namespace/name hash falls into its shard, instead of a single leader reconciling all of them. Replicas announce themselves with Leases, and shards are rebalanced when replicas come and go. Cannot be combined with --leader-elect.")
+	flag.StringVar(&shardGroup, "shard-group", "karo", "The name of the shard group, which prefixes the Leases of its replicas.")
+	flag.StringVar(&shardNamespace, "shard-namespace", "", "The namespace of the shard Leases. Defaults to --leader-election-namespace, or the pod namespace.")
+	flag.StringVar(&shardIdentity, "shard-identity", "", "The identity of the replica in its shard group. Defaults to the hostname, which is the pod name.")
+	flag.BoolVar(&enableInvalidationEndpoint, "enable-invalidation-endpoint", false, "If set, the webhook server accepts invalidation notices on "+controller.InvalidationPath+", which requeue the named custom resources when external data in their context changes. Callers authenticate with a bearer token and need the create verb on the path. It needs a serving certificate in the webhook server's cert dir.")
+	flag.IntVar(&maxStatusDependents, "max-status-dependents", controller.DefaultMaxStatusDependents, "The number of dependents kept in status.dependentResources of each custom resource, failed ones first. All of them are kept in a ConfigMap named in status.dependentInventory when there are more. 0 keeps all of them in the status.")
+	flag.IntVar(&reconcileHistory, "reconcile-history", controller.DefaultReconcileHistory, "The number of reconcile summaries (time, outcome, changed dependents and error) kept in status.reconcileHistory of each custom resource. A reconcile is only recorded when it changes dependents or ends differently from the last one. 0 keeps none.")
+	flag.DurationVar(&dependencyTimeout, "dependency-timeout", controller.DefaultDependencyTimeout, "How long the templates of a custom resource may wait for an object with waitFor before its render fails. Waiting renders are retried with backoff. 0 waits forever.")
+	flag.DurationVar(&dependencyRequeueInterval, "dependency-requeue-interval", controller.DefaultDependencyRequeueInterval, "How long to wait before the first retry of a render that waits for an object with waitFor. The delay doubles with every retry, up to 5 minutes.")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", controller.DefaultShutdownGracePeriod, "How long reconciles that are in flight when the manager stops may take to finish applying dependents and updating status. The pod's termination grace period must be longer.")
+	flag.BoolVar(&fairQueuing, "fair-queuing", false, "If set, the queued custom resources of each kind are reconciled one namespace at a time in turn, instead of in the order they were queued, so that a namespace with many resources does not delay the others.")
+	flag.BoolVar(&policyChecks, "policy-checks", false, "If set, the rendered dependents of custom resources are checked against the policies bundled with the operator before they are applied: no privileged containers, hostPath volumes or host namespaces.")
+	flag.StringVar(&policyConfigMap, "policy-configmap", "", "A ConfigMap, as namespace/name, with policy files under its keys, whose rules the rendered dependents of custom resources must satisfy before they are applied. It is read again every minute. Not checked if empty.")
+	flag.BoolVar(&typedApply, "typed-apply", false, "If set, Deployments, Services and ConfigMaps are applied with typed server-side apply instead of updates, so that rendered objects that do not match the schema of their kind fail with a clear error.")
+	flag.StringVar(&adoption, "adoption", string(controller.AdoptUnmanaged), "Which existing objects with the names of rendered dependents are adopted and updated from then on. Valid values are 'unmanaged' (objects without an owner or another tool's managed-by label, and objects annotated with "+controller.AdoptAnnotation+"=true) and 'annotated' (only annotated objects). Objects owned by other resources are never adopted.")
+	flag.BoolVar(&dryRunAll, "dry-run-all", false, "If set, custom resources are rendered, diffed and get their status and conditions as usual, but every create, update, patch and delete is only sent as a server-side dry-run and logged, so that karo can be introduced into a cluster whose resources already exist without changing them.")
+	flag.BoolVar(&reconcilePriorities, "reconcile-priorities", false, "If set, custom resources are reconciled in the order of their "+controller.PriorityAnnotation+" annotation (high, normal or low) across all kinds, and each kind runs "+strconv.Itoa(controller.PriorityWorkers)+" reconciles, of which low priority resources may take one and normal ones two.")
+	flag.StringVar(&quantityForms, "quantity-canonical-forms", "", "A comma-separated list of <resource>=<form> that adds to or replaces the canonical forms of resource quantities compared in dependents, e.g. 'example.com/fpga=decimal,example.com/vram-*=binary'. Forms are 'milli', 'binary' and 'decimal'; a trailing * matches a prefix. cpu, memory, storage, ephemeral-storage, hugepages-* and the common GPU and TPU resources are built in.")
+	flag.StringVar(&priceSheetPath, "price-sheet", "", "A YAML or JSON file with the hourly price of each accelerator type per region, used to estimate the cost of custom resources in status.estimatedCost and the karo_estimated_hourly_cost metric. Costs are not estimated if empty.")
+	flag.StringVar(&preflight, "preflight", string(controller.PreflightOff), "Whether to dry-run rendered dependents on the server and report the result in status.preflight. Valid values are 'off', 'report' (apply regardless), 'enforce' (apply only if all pass) and 'only' (never apply).")
 
 	logOptions := k8szap.Options{
 		Development: true,
@@ -82,6 +241,29 @@ func run(ctx context.Context) error {
 	logOptions.Encoder = stdoutEncoder
 	ctrl.SetLogger(k8szap.New(k8szap.UseFlagOptions(&logOptions)))
 
+	if otlpEndpoint != "" {
+		shutdownTracing, err := setupTracing(ctx, otlpEndpoint)
+		if err != nil {
+			setupLog.Error(err, "failed to set up tracing")
+			return fmt.Errorf("failed to set up tracing: %v", err)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				setupLog.Error(err, "failed to shut down tracing")
+			}
+		}()
+		setupLog.Info("Exporting traces", "endpoint", otlpEndpoint)
+	}
+
+	if eventPolicy != "" && !flagSet("emit-events") {
+		emitEvents = eventPolicy
+	}
+	parsedEventPolicy, err := controller.ParseEventPolicy(emitEvents)
+	if err != nil {
+		setupLog.Error(err, "invalid event policy")
+		return fmt.Errorf("invalid event policy: %v", err)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancelation and
@@ -100,25 +282,52 @@ func run(ctx context.Context) error {
 		TLSOpts: tlsOpts,
 	})
 
+	if metricsRequireAuth && !secureMetrics {
+		err := fmt.Errorf("--metrics-require-auth requires --metrics-secure, bearer tokens are not sent over plain HTTP")
+		setupLog.Error(err, "invalid metrics options")
+		return err
+	}
+	metricsOptions := metricsserver.Options{
+		BindAddress:   metricsAddr,
+		SecureServing: secureMetrics,
+		CertDir:       metricsCertDir,
+		TLSOpts:       tlsOpts,
+	}
+	if metricsRequireAuth {
+		metricsOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
+	if enableSharding && enableLeaderElection {
+		err := fmt.Errorf("--sharding cannot be combined with --leader-elect")
+		setupLog.Error(err, "invalid sharding mode")
+		return err
+	}
+
+	// Reconciles in flight are cancelled after the grace period, the margin
+	// lets them and the other runnables return.
+	gracefulShutdownTimeout := shutdownGracePeriod + shutdownTimeoutMargin
 	options := ctrl.Options{
 		Cache: cache.Options{
 			DefaultNamespaces: map[string]cache.Config{},
 		},
-		Scheme: scheme,
-		Metrics: metricsserver.Options{
-			BindAddress: metricsAddr,
-			TLSOpts:     tlsOpts,
-		},
+		Scheme:                  scheme,
+		Metrics:                 metricsOptions,
 		WebhookServer:           webhookServer,
 		HealthProbeBindAddress:  probeAddr,
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionID:        "ai-connector-for-gke",
 		LeaderElectionNamespace: leaderElectionNamespace,
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 	}
 
 	// Set up the manager cache.
 	watchNamespaces := strings.Split(watchNamespace, ",")
 	if len(watchNamespaces) == 1 && watchNamespaces[0] == "" {
+		if namespaceScoped {
+			err := fmt.Errorf("--namespace-scoped requires --watch-namespace")
+			setupLog.Error(err, "invalid namespace scope")
+			return err
+		}
 		setupLog.Info("Flag watch-namespace is not set. Watch custom resources in all namespaces.")
 	} else {
 		setupLog.Info("Only watch custom resources in specific namespaces.", "namespaces", watchNamespaces)
@@ -127,31 +336,363 @@ func run(ctx context.Context) error {
 		}
 	}
 
+	if !transformer.VersionSet() {
+		setupLog.Info("The manager was built without a version, the karoVersions of template bundles are not checked", "version", transformer.Version)
+	}
+
 	setupLog.Info("Setup manager")
 	restConfig := ctrl.GetConfigOrDie()
 	restConfig.UserAgent = userAgent
+	restConfig.QPS = float32(kubeAPIQPS)
+	restConfig.Burst = kubeAPIBurst
+	setupLog.Info("Configured Kubernetes API client", "userAgent", userAgent, "qps", kubeAPIQPS, "burst", kubeAPIBurst)
 	mgr, err := ctrl.NewManager(restConfig, options)
 	if err != nil {
 		setupLog.Error(err, "Unable to create manager")
 		return fmt.Errorf("unable to create manager: %v", err)
 	}
 
+	t := transformer.NewTransformer()
+	parsedQuantityForms, err := controller.ParseQuantityForms(quantityForms)
+	if err != nil {
+		setupLog.Error(err, "invalid quantity canonical forms")
+		return fmt.Errorf("invalid quantity canonical forms: %v", err)
+	}
+	controller.AddQuantityForms(parsedQuantityForms)
+
+	preflightMode, err := controller.ParsePreflightMode(preflight)
+	if err != nil {
+		setupLog.Error(err, "invalid preflight mode")
+		return fmt.Errorf("invalid preflight mode: %v", err)
+	}
+
+	adoptionPolicy, err := controller.ParseAdoptionPolicy(adoption)
+	if err != nil {
+		setupLog.Error(err, "invalid adoption policy")
+		return fmt.Errorf("invalid adoption policy: %v", err)
+	}
+
+	var signatureKeys []string
+	if podImageSignatureKeys != "" {
+		keys, err := os.ReadFile(podImageSignatureKeys)
+		if err != nil {
+			setupLog.Error(err, "unable to read image signature keys")
+			return fmt.Errorf("unable to read image signature keys: %v", err)
+		}
+		signatureKeys = []string{string(keys)}
+	}
+	// Integrations may add to the cluster-wide pod security policy, but not relax it.
+	securityPolicy := newSecurityPolicy(podRuntimeClassName, podSeccompProfile, podRunAsNonRoot, podDropCapabilities, podAllowedImages, signatureKeys)
+	if securityPolicy != nil {
+		t.SetSecurityPolicy(securityPolicy)
+		setupLog.Info("Enforcing pod security policy", "runtimeClassName", securityPolicy.RuntimeClassName, "seccompProfile", securityPolicy.SeccompProfileType, "runAsNonRoot", podRunAsNonRoot, "dropCapabilities", securityPolicy.DropCapabilities, "allowedImages", securityPolicy.AllowedImages, "verifyImageSignatures", len(signatureKeys) > 0)
+	}
+
+	t.SetLogRenderedManifests(logRenderedManifests)
+	t.SetConfigChecksums(configChecksums)
+	if namespaceScoped {
+		t.SetNamespaces(watchNamespaces)
+		setupLog.Info("Running namespace-scoped", "namespaces", watchNamespaces)
+	}
+	if removed, err := t.SweepRenderDirs(setupLog); err != nil {
+		setupLog.Error(err, "Failed to remove stale render output")
+	} else if removed > 0 {
+		setupLog.Info("Removed stale render output", "entries", removed)
+	}
+
+	if secrets := splitList(podImagePullSecrets); len(secrets) > 0 {
+		t.RegisterMutator("image-pull-secrets", transformer.ImagePullSecretsMutator(secrets...))
+		setupLog.Info("Adding imagePullSecrets to generated pods", "secrets", secrets)
+	}
+	if podTopologySpreadKey != "" {
+		switch corev1.UnsatisfiableConstraintAction(podTopologySpreadWhenUnsatisfiable) {
+		case corev1.ScheduleAnyway, corev1.DoNotSchedule:
+		default:
+			err := fmt.Errorf("%q (must be '%s' or '%s')", podTopologySpreadWhenUnsatisfiable, corev1.ScheduleAnyway, corev1.DoNotSchedule)
+			setupLog.Error(err, "invalid pod topology spread whenUnsatisfiable")
+			return fmt.Errorf("invalid pod topology spread whenUnsatisfiable: %v", err)
+		}
+		if podTopologySpreadMaxSkew < 1 {
+			err := fmt.Errorf("%d (must be at least 1)", podTopologySpreadMaxSkew)
+			setupLog.Error(err, "invalid pod topology spread maxSkew")
+			return fmt.Errorf("invalid pod topology spread maxSkew: %v", err)
+		}
+		t.RegisterMutator("topology-spread", transformer.TopologySpreadMutator(podTopologySpreadKey, podTopologySpreadMaxSkew, podTopologySpreadWhenUnsatisfiable))
+		setupLog.Info("Spreading generated pods", "topologyKey", podTopologySpreadKey, "maxSkew", podTopologySpreadMaxSkew, "whenUnsatisfiable", podTopologySpreadWhenUnsatisfiable)
+	}
+
+	gcsFuseMutator, err := transformer.GCSFuseMutator(gcsFuseProfile)
+	if err != nil {
+		setupLog.Error(err, "invalid gcsfuse profile")
+		return fmt.Errorf("invalid gcsfuse profile: %v", err)
+	}
+	t.RegisterMutator("gcsfuse", gcsFuseMutator)
+	if gcsFuseProfile != "" {
+		setupLog.Info("Tuning Cloud Storage FUSE volumes of generated pods", "defaultProfile", gcsFuseProfile)
+	}
+
+	if clusterDefaultsConfigMap != "" {
+		configMap, err := controller.ParseConfigMapName(clusterDefaultsConfigMap)
+		if err != nil {
+			setupLog.Error(err, "invalid cluster defaults ConfigMap")
+			return fmt.Errorf("invalid cluster defaults ConfigMap: %v", err)
+		}
+		loader := &controller.ClusterDefaultsLoader{Reader: mgr.GetAPIReader(), ConfigMap: configMap, Set: t.SetClusterDefaults}
+		// The first renders already see the defaults.
+		if err := loader.Sync(ctx); err != nil {
+			setupLog.Error(err, "unable to load cluster defaults")
+			return fmt.Errorf("unable to load cluster defaults: %v", err)
+		}
+		if err := mgr.Add(loader); err != nil {
+			setupLog.Error(err, "unable to add cluster defaults loader")
+			return fmt.Errorf("unable to add cluster defaults loader: %v", err)
+		}
+		setupLog.Info("Applying cluster defaults to generated pods", "configMap", clusterDefaultsConfigMap)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		return fmt.Errorf("unable to create discovery client: %v", err)
+	}
+	var reconcileExports *controller.ReconcileExportQueue
+	if reconcileExport != "" {
+		exporter, err := controller.NewReconcileExporter(ctx, reconcileExport)
+		if err != nil {
+			setupLog.Error(err, "invalid reconcile export")
+			return fmt.Errorf("invalid reconcile export: %v", err)
+		}
+		reconcileExports = &controller.ReconcileExportQueue{Exporter: exporter}
+		if err := mgr.Add(reconcileExports); err != nil {
+			setupLog.Error(err, "unable to add reconcile exporter")
+			return fmt.Errorf("unable to add reconcile exporter: %v", err)
+		}
+		setupLog.Info("Exporting reconcile summaries", "location", reconcileExport)
+	}
+	setClusterInfo := func(info *transformer.ClusterInfo) {
+		t.SetClusterInfo(info)
+		if reconcileExports != nil {
+			reconcileExports.SetCluster(info)
+		}
+	}
+	clusterInfoLoader := &controller.ClusterInfoLoader{Reader: mgr.GetAPIReader(), Discovery: discoveryClient, Override: clusterInfo, Set: setClusterInfo}
+	// The first renders already see the metadata, if it can be discovered.
+	if err := clusterInfoLoader.Sync(ctx); err != nil {
+		setupLog.Error(err, "unable to discover cluster metadata")
+	}
+	if err := mgr.Add(clusterInfoLoader); err != nil {
+		setupLog.Error(err, "unable to add cluster metadata loader")
+		return fmt.Errorf("unable to add cluster metadata loader: %v", err)
+	}
+
+	contextTransport := transformer.ContextTransportOptions{HTTPProxy: contextHTTPProxy, HTTPSProxy: contextHTTPSProxy, NoProxy: contextNoProxy}
+	if contextCABundle != "" {
+		contextTransport.CABundle, err = os.ReadFile(contextCABundle)
+		if err != nil {
+			setupLog.Error(err, "unable to read context CA bundle")
+			return fmt.Errorf("unable to read context CA bundle: %v", err)
+		}
+	}
+	// Otherwise the default client already honours the proxy environment variables.
+	if contextHTTPSProxy != "" || contextHTTPProxy != "" || contextNoProxy != "" || contextCABundle != "" {
+		if err := t.SetContextTransport(ctx, contextTransport); err != nil {
+			setupLog.Error(err, "invalid context transport options")
+			return fmt.Errorf("invalid context transport options: %v", err)
+		}
+		setupLog.Info("Configured context requests", "httpsProxy", contextHTTPSProxy, "httpProxy", contextHTTPProxy, "noProxy", contextNoProxy, "caBundle", contextCABundle)
+	}
+
+	// Signatures are verified for the digests that images are pinned to.
+	imageResolver := transformer.NewImageResolver(imageDigestTTL, transformer.GoogleRegistryCredentials)
+	t.SetImageSignatureVerifier(imageResolver)
+	if pinImageDigests {
+		t.SetImageResolver(imageResolver)
+		setupLog.Info("Pinning images of generated pods to digests", "ttl", imageDigestTTL)
+	}
+
+	var renderArtifactStore controller.RenderArtifactStore
+	if renderArtifacts != "" {
+		renderArtifactStore, err = controller.NewRenderArtifactStore(ctx, renderArtifacts, mgr.GetClient(), renderArtifactRetention)
+		if err != nil {
+			setupLog.Error(err, "invalid render artifact store")
+			return fmt.Errorf("invalid render artifact store: %v", err)
+		}
+		setupLog.Info("Storing render artifacts", "location", renderArtifacts, "retention", renderArtifactRetention)
+	}
+
+	var priceSheet *controller.PriceSheet
+	if priceSheetPath != "" {
+		priceSheet, err = controller.LoadPriceSheet(priceSheetPath)
+		if err != nil {
+			setupLog.Error(err, "invalid price sheet")
+			return fmt.Errorf("invalid price sheet: %v", err)
+		}
+		setupLog.Info("Estimating costs", "priceSheet", priceSheetPath, "regions", len(priceSheet.Regions))
+	}
+
+	var shards controller.ShardFilter
+	if enableSharding {
+		sharder, err := newSharder(mgr, shardGroup, shardNamespace, leaderElectionNamespace, shardIdentity)
+		if err != nil {
+			setupLog.Error(err, "invalid sharding options")
+			return fmt.Errorf("invalid sharding options: %v", err)
+		}
+		if err := mgr.Add(sharder); err != nil {
+			setupLog.Error(err, "unable to add sharder")
+			return fmt.Errorf("unable to add sharder: %v", err)
+		}
+		shards = sharder
+		setupLog.Info("Sharding reconciliation across replicas", "group", shardGroup)
+	}
+
+	shutdown := &controller.ShutdownBarrier{GracePeriod: shutdownGracePeriod}
+	if err := mgr.Add(shutdown); err != nil {
+		setupLog.Error(err, "unable to add shutdown barrier")
+		return fmt.Errorf("unable to add shutdown barrier: %v", err)
+	}
+
+	if templateIntegrityRemote != "" {
+		checker := &controller.TemplateIntegrityChecker{
+			Client:   mgr.GetClient(),
+			Embedded: assets.Embedded,
+			Remote:   templateIntegrityRemote,
+			Interval: templateIntegrityInterval,
+		}
+		if err := mgr.Add(checker); err != nil {
+			setupLog.Error(err, "unable to add template integrity checker")
+			return fmt.Errorf("unable to add template integrity checker: %v", err)
+		}
+		setupLog.Info("Comparing the embedded templates with remote bundles", "remote", templateIntegrityRemote, "interval", templateIntegrityInterval)
+	}
+
+	if statusAddr != "" {
+		if err := mgr.Add(&controller.StatusServer{Addr: statusAddr, Client: mgr.GetCache()}); err != nil {
+			setupLog.Error(err, "unable to add status server")
+			return fmt.Errorf("unable to add status server: %v", err)
+		}
+	}
+
+	var invalidator *controller.Invalidator
+	if enableInvalidationEndpoint {
+		invalidator = &controller.Invalidator{Client: mgr.GetClient()}
+		mgr.GetWebhookServer().Register(controller.InvalidationPath, invalidator)
+		setupLog.Info("Serving invalidation notices", "path", controller.InvalidationPath)
+	}
+
 	// Register the integration controller, it will register everything else.
 	reconciler := &controller.IntegrationReconciler{
-		Client:      mgr.GetClient(),
-		Manager:     mgr,
-		Transformer: transformer.NewTransformer(),
-		Scheme:      mgr.GetScheme(),
-		KindReconcilers: map[string]controller.KindReconciler{
-			"ModelData":      &controller.ModelDataReconciler{},
-			"AgenticSandbox": &controller.AgenticSandboxReconciler{},
-		},
+		Client:               mgr.GetClient(),
+		Manager:              mgr,
+		Transformer:          t,
+		Scheme:               mgr.GetScheme(),
+		RestConfig:           restConfig,
+		EventPolicy:          parsedEventPolicy,
+		QuotaGuardrails:      quotaGuardrails,
+		Preflight:            preflightMode,
+		Environment:          environment,
+		DependentConcurrency: dependentConcurrency,
+		RenderArtifacts:      renderArtifactStore,
+		// Downstream builds add their own with controller.RegisterKindReconciler.
+		KindReconcilers:           controller.DefaultKindReconcilers,
+		NamespaceScoped:           namespaceScoped,
+		CheckPermissions:          checkPermissions,
+		Namespaces:                splitList(watchNamespace),
+		Shards:                    shards,
+		Invalidator:               invalidator,
+		ReconcileHistory:          reconcileHistory,
+		MaxStatusDependents:       maxStatusDependents,
+		ReconcileExports:          reconcileExports,
+		PriceSheet:                priceSheet,
+		DependencyTimeout:         dependencyTimeout,
+		DependencyRequeueInterval: dependencyRequeueInterval,
+		Shutdown:                  shutdown,
+		FairQueuing:               fairQueuing,
+		TypedApply:                typedApply,
+		DryRunAll:                 dryRunAll,
+		Adoption:                  adoptionPolicy,
+	}
+	if dryRunAll {
+		setupLog.Info("Running in simulation mode, writes to the cluster other than status are only dry-run")
+	}
+	if policyChecks || policyConfigMap != "" {
+		reconciler.Policies = &controller.PolicyChecker{}
+		if policyChecks {
+			reconciler.Policies.Evaluators = append(reconciler.Policies.Evaluators, controller.BundledPolicies())
+		}
+		if policyConfigMap != "" {
+			configMap, err := controller.ParseConfigMapName(policyConfigMap)
+			if err != nil {
+				setupLog.Error(err, "invalid policy ConfigMap")
+				return fmt.Errorf("invalid policy ConfigMap: %v", err)
+			}
+			loader := &controller.PolicyLoader{Reader: mgr.GetAPIReader(), ConfigMap: configMap, Checker: reconciler.Policies}
+			// The first reconciles already check the policies.
+			if err := loader.Sync(ctx); err != nil {
+				setupLog.Error(err, "unable to load policies")
+				return fmt.Errorf("unable to load policies: %v", err)
+			}
+			if err := mgr.Add(loader); err != nil {
+				setupLog.Error(err, "unable to add policy loader")
+				return fmt.Errorf("unable to add policy loader: %v", err)
+			}
+		}
+		setupLog.Info("Checking dependents against policies", "bundled", policyChecks, "configMap", policyConfigMap)
+	}
+	if reconcilePriorities {
+		reconciler.Priorities = &controller.ReconcilePriorities{}
+		setupLog.Info("Reconciling resources by priority", "annotation", controller.PriorityAnnotation)
 	}
 	if err := reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Integration")
 		os.Exit(1)
 	}
 	setupLog.Info("Registered controller", "controller", "Integration")
+	for _, reg := range controller.DefaultKindReconcilers.Registrations() {
+		setupLog.Info("Registered kind reconciler", "name", reg.Name, "group", reg.Group, "kind", reg.Kind, "priority", reg.Priority)
+	}
+
+	if enableConversionWebhook {
+		if err := ctrl.NewWebhookManagedBy(mgr).For(&v1.Integration{}).Complete(); err != nil {
+			setupLog.Error(err, "unable to create conversion webhook", "webhook", "Integration")
+			return fmt.Errorf("unable to create conversion webhook: %v", err)
+		}
+		setupLog.Info("Registered conversion webhook", "webhook", "Integration")
+		if conversionWebhookService != "" {
+			namespace, name, ok := strings.Cut(conversionWebhookService, "/")
+			if !ok || namespace == "" || name == "" {
+				err := fmt.Errorf("invalid --conversion-webhook-service %q, expected <namespace>/<name>", conversionWebhookService)
+				setupLog.Error(err, "invalid conversion webhook options")
+				return err
+			}
+			sync := &controller.ConversionWebhookSync{
+				Reader:  mgr.GetAPIReader(),
+				Client:  mgr.GetClient(),
+				Service: types.NamespacedName{Namespace: namespace, Name: name},
+				CAFile:  conversionWebhookCAFile,
+			}
+			if err := mgr.Add(sync); err != nil {
+				setupLog.Error(err, "unable to add conversion webhook sync")
+				return fmt.Errorf("unable to add conversion webhook sync: %v", err)
+			}
+		}
+	}
+	if enableValidatingWebhook {
+		validator := &controller.IntegrationValidator{NamespaceScoped: namespaceScoped, Mapper: mgr.GetRESTMapper()}
+		if err := ctrl.NewWebhookManagedBy(mgr).For(&v1.Integration{}).WithValidator(validator).Complete(); err != nil {
+			setupLog.Error(err, "unable to create validating webhook", "webhook", "Integration")
+			return fmt.Errorf("unable to create validating webhook: %v", err)
+		}
+		setupLog.Info("Registered validating webhook", "webhook", "Integration")
+	}
+	if enableTargetValidatingWebhook {
+		validator := &controller.TargetValidator{Client: mgr.GetClient(), SecurityPolicy: securityPolicy}
+		mgr.GetWebhookServer().Register(controller.TargetValidationPath, &webhook.Admission{Handler: validator})
+		if err := mgr.Add(&controller.TargetWebhookSync{Client: mgr.GetClient(), Mapper: mgr.GetRESTMapper()}); err != nil {
+			setupLog.Error(err, "unable to add target validating webhook sync")
+			return fmt.Errorf("unable to add target validating webhook sync: %v", err)
+		}
+		setupLog.Info("Registered validating webhook", "webhook", "targets", "path", controller.TargetValidationPath)
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -171,6 +712,34 @@ func run(ctx context.Context) error {
 	return nil
 }
 
+// newSharder returns the Sharder of this replica. The namespace of its Lease
+// defaults to the leader election namespace and then to the namespace of the
+// pod, and its identity to the hostname.
+func newSharder(mgr ctrl.Manager, group, namespace, leaderElectionNamespace, identity string) (*sharding.Sharder, error) {
+	if namespace == "" {
+		namespace = leaderElectionNamespace
+	}
+	if namespace == "" {
+		data, err := os.ReadFile(inClusterNamespacePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the pod namespace, set --shard-namespace: %v", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the hostname, set --shard-identity: %v", err)
+		}
+		identity = hostname
+	}
+	return sharding.New(mgr.GetClient(), mgr.GetAPIReader(), sharding.Options{
+		Namespace: namespace,
+		Group:     group,
+		Identity:  identity,
+	})
+}
+
 // newLogEncoder returns a zapcore.Encoder based on the encoder type ('json' or 'console')
 func newLogEncoder(encoderType string) (zapcore.Encoder, error) {
 	pe := zap.NewProductionEncoderConfig()
@@ -183,3 +752,70 @@ func newLogEncoder(encoderType string) (zapcore.Encoder, error) {
 	}
 	return nil, fmt.Errorf("invalid encoder %q (must be 'json' or 'console')", encoderType)
 }
+
+// newSecurityPolicy builds the cluster-wide pod security policy from the command
+// line flags. It returns nil if no setting is enforced.
+func newSecurityPolicy(runtimeClassName, seccompProfile string, runAsNonRoot bool, dropCapabilities, allowedImages string, signatureKeys []string) *v1.IntegrationSecurityPolicySpec {
+	policy := &v1.IntegrationSecurityPolicySpec{
+		RuntimeClassName:   runtimeClassName,
+		SeccompProfileType: seccompProfile,
+		ImageSignatureKeys: signatureKeys,
+	}
+	if runAsNonRoot {
+		policy.RunAsNonRoot = &runAsNonRoot
+	}
+	policy.DropCapabilities = splitList(dropCapabilities)
+	policy.AllowedImages = splitList(allowedImages)
+	if policy.RuntimeClassName == "" && policy.SeccompProfileType == "" && policy.RunAsNonRoot == nil && len(policy.DropCapabilities) == 0 && len(policy.AllowedImages) == 0 && len(policy.ImageSignatureKeys) == 0 {
+		return nil
+	}
+	return policy
+}
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var result []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// flagSet returns true if the named flag was set on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// setupTracing installs a global tracer provider exporting spans over OTLP gRPC.
+// The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %v", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("karo-operator"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create tracing resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
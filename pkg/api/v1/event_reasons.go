@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventReason is the reason of an event that karo records on the resources it
+// reconciles. The reasons are part of the v1 API: tooling that reads the
+// events can rely on them, and a reason is only removed or renamed in a new
+// API version.
+type EventReason string
+
+const (
+	// Reconciliation.
+	EventReasonReconciliationSuccessful       EventReason = "ReconciliationSuccessful"
+	EventReasonTransformerRunFailed           EventReason = "TransformerRunFailed"
+	EventReasonSpecInvalid                    EventReason = "SpecInvalid"
+	EventReasonWaitingForRequirements         EventReason = "WaitingForRequirements"
+	EventReasonWaitingForDependency           EventReason = "WaitingForDependency"
+	EventReasonDependencyTimedOut             EventReason = "DependencyTimedOut"
+	EventReasonQuotaExceeded                  EventReason = "QuotaExceeded"
+	EventReasonNameCollision                  EventReason = "NameCollision"
+	EventReasonPreflightFailed                EventReason = "PreflightFailed"
+	EventReasonMissingClusterCapability       EventReason = "MissingClusterCapability"
+	EventReasonPolicyViolation                EventReason = "PolicyViolation"
+	EventReasonStatusUpdated                  EventReason = "StatusUpdated"
+	EventReasonStatusUpdateFailed             EventReason = "StatusUpdateFailed"
+	EventReasonOwnerDeletedDuringStatusUpdate EventReason = "OwnerDeletedDuringStatusUpdate"
+
+	// Dependents.
+	EventReasonDependentCreateStarted   EventReason = "DependentCreateStarted"
+	EventReasonDependentCreated         EventReason = "DependentCreated"
+	EventReasonDependentCreateFailed    EventReason = "DependentCreateFailed"
+	EventReasonDependentUpdateStarted   EventReason = "DependentUpdateStarted"
+	EventReasonDependentUpdated         EventReason = "DependentUpdated"
+	EventReasonDependentUpdateFailed    EventReason = "DependentUpdateFailed"
+	EventReasonDependentReplaced        EventReason = "DependentReplaced"
+	EventReasonDependentAdopted         EventReason = "DependentAdopted"
+	EventReasonDiffCheckFailed          EventReason = "DiffCheckFailed"
+	EventReasonSetOwnerRefFailed        EventReason = "SetOwnerRefFailed"
+	EventReasonUnsupportedDependentKind EventReason = "UnsupportedDependentKind"
+	EventReasonDependentUnhealthy       EventReason = "DependentUnhealthy"
+	EventReasonDependentRemediated      EventReason = "DependentRemediated"
+	EventReasonCloudResourcesFailed     EventReason = "CloudResourcesFailed"
+	EventReasonProtectedDrift           EventReason = "ProtectedDrift"
+
+	// Patches of existing objects.
+	EventReasonObjectPatched     EventReason = "ObjectPatched"
+	EventReasonPatchConflict     EventReason = "PatchConflict"
+	EventReasonPatchReverted     EventReason = "PatchReverted"
+	EventReasonPatchRevertFailed EventReason = "PatchRevertFailed"
+
+	// Rollouts.
+	EventReasonRolloutStarted  EventReason = "RolloutStarted"
+	EventReasonRolloutPromoted EventReason = "RolloutPromoted"
+	EventReasonRolloutAborted  EventReason = "RolloutAborted"
+	EventReasonRolloutStuck    EventReason = "RolloutStuck"
+
+	// Agentic sandboxes.
+	EventReasonSandboxCleanupStarted EventReason = "SandboxCleanupStarted"
+	EventReasonSandboxCleanupFailed  EventReason = "SandboxCleanupFailed"
+)
+
+// eventReasonTypes is the type of the events recorded with each reason.
+var eventReasonTypes = map[EventReason]string{
+	EventReasonReconciliationSuccessful:       corev1.EventTypeNormal,
+	EventReasonTransformerRunFailed:           corev1.EventTypeWarning,
+	EventReasonSpecInvalid:                    corev1.EventTypeWarning,
+	EventReasonWaitingForRequirements:         corev1.EventTypeNormal,
+	EventReasonWaitingForDependency:           corev1.EventTypeNormal,
+	EventReasonDependencyTimedOut:             corev1.EventTypeWarning,
+	EventReasonQuotaExceeded:                  corev1.EventTypeWarning,
+	EventReasonNameCollision:                  corev1.EventTypeWarning,
+	EventReasonPreflightFailed:                corev1.EventTypeWarning,
+	EventReasonMissingClusterCapability:       corev1.EventTypeWarning,
+	EventReasonPolicyViolation:                corev1.EventTypeWarning,
+	EventReasonStatusUpdated:                  corev1.EventTypeNormal,
+	EventReasonStatusUpdateFailed:             corev1.EventTypeWarning,
+	EventReasonOwnerDeletedDuringStatusUpdate: corev1.EventTypeWarning,
+	EventReasonDependentCreateStarted:         corev1.EventTypeNormal,
+	EventReasonDependentCreated:               corev1.EventTypeNormal,
+	EventReasonDependentCreateFailed:          corev1.EventTypeWarning,
+	EventReasonDependentUpdateStarted:         corev1.EventTypeNormal,
+	EventReasonDependentUpdated:               corev1.EventTypeNormal,
+	EventReasonDependentUpdateFailed:          corev1.EventTypeWarning,
+	EventReasonDependentReplaced:              corev1.EventTypeNormal,
+	EventReasonDependentAdopted:               corev1.EventTypeNormal,
+	EventReasonDiffCheckFailed:                corev1.EventTypeWarning,
+	EventReasonSetOwnerRefFailed:              corev1.EventTypeWarning,
+	EventReasonUnsupportedDependentKind:       corev1.EventTypeWarning,
+	EventReasonDependentUnhealthy:             corev1.EventTypeWarning,
+	EventReasonDependentRemediated:            corev1.EventTypeWarning,
+	EventReasonCloudResourcesFailed:           corev1.EventTypeWarning,
+	EventReasonProtectedDrift:                 corev1.EventTypeWarning,
+	EventReasonObjectPatched:                  corev1.EventTypeNormal,
+	EventReasonPatchConflict:                  corev1.EventTypeWarning,
+	EventReasonPatchReverted:                  corev1.EventTypeNormal,
+	EventReasonPatchRevertFailed:              corev1.EventTypeWarning,
+	EventReasonRolloutStarted:                 corev1.EventTypeNormal,
+	EventReasonRolloutPromoted:                corev1.EventTypeNormal,
+	EventReasonRolloutAborted:                 corev1.EventTypeWarning,
+	EventReasonRolloutStuck:                   corev1.EventTypeWarning,
+	EventReasonSandboxCleanupStarted:          corev1.EventTypeNormal,
+	EventReasonSandboxCleanupFailed:           corev1.EventTypeWarning,
+}
+
+// EventReasons returns the reasons of the v1 API, sorted.
+func EventReasons() []EventReason {
+	reasons := make([]EventReason, 0, len(eventReasonTypes))
+	for reason := range eventReasonTypes {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i] < reasons[j] })
+	return reasons
+}
+
+// ParseEventReason returns the reason of an event that karo recorded, e.g.
+// from the reason field of a corev1.Event. It returns an error for reasons
+// that are not part of the v1 API.
+func ParseEventReason(reason string) (EventReason, error) {
+	if _, ok := eventReasonTypes[EventReason(reason)]; !ok {
+		return "", fmt.Errorf("unknown event reason %q", reason)
+	}
+	return EventReason(reason), nil
+}
+
+// Type returns the type of the events recorded with the reason, Normal or
+// Warning, or "" for reasons that are not part of the v1 API.
+func (r EventReason) Type() string {
+	return eventReasonTypes[r]
+}
@@ -0,0 +1,34 @@
+package v1
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseEventReason(t *testing.T) {
+	reason, err := ParseEventReason("DependentCreated")
+	require.NoError(t, err)
+	assert.Equal(t, EventReasonDependentCreated, reason)
+	assert.Equal(t, corev1.EventTypeNormal, reason.Type())
+
+	reason, err = ParseEventReason("TransformerRunFailed")
+	require.NoError(t, err)
+	assert.Equal(t, corev1.EventTypeWarning, reason.Type())
+
+	_, err = ParseEventReason("SomethingHappened")
+	assert.ErrorContains(t, err, `unknown event reason "SomethingHappened"`)
+	assert.Empty(t, EventReason("SomethingHappened").Type())
+}
+
+func TestEventReasons(t *testing.T) {
+	reasons := EventReasons()
+	assert.Len(t, reasons, len(eventReasonTypes))
+	assert.True(t, sort.SliceIsSorted(reasons, func(i, j int) bool { return reasons[i] < reasons[j] }))
+	for _, reason := range reasons {
+		assert.Contains(t, []string{corev1.EventTypeNormal, corev1.EventTypeWarning}, reason.Type(), reason)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	defaultIntegrationVersion = "v1"
+	defaultTemplateOperation  = "template"
+)
+
+// Default sets the fields that the CRD defaults, for Integrations stored
+// before the CRD defaulted them, and normalizes the template paths, which the
+// CRD cannot.
+func (s *IntegrationSpec) Default() {
+	if s.Version == "" {
+		s.Version = defaultIntegrationVersion
+	}
+	for i := range s.References {
+		if s.References[i].Version == "" {
+			s.References[i].Version = defaultIntegrationVersion
+		}
+	}
+	for i := range s.Consumes {
+		if s.Consumes[i].Version == "" {
+			s.Consumes[i].Version = defaultIntegrationVersion
+		}
+		for j := range s.Consumes[i].Dependents {
+			if s.Consumes[i].Dependents[j].Version == "" {
+				s.Consumes[i].Dependents[j].Version = defaultIntegrationVersion
+			}
+		}
+	}
+	for i := range s.Templates {
+		if s.Templates[i].Operation == "" {
+			s.Templates[i].Operation = defaultTemplateOperation
+		}
+		s.Templates[i].Path = normalizeTemplatePath(s.Templates[i].Path)
+	}
+	for i := range s.Hashes {
+		s.Hashes[i].Path = normalizeTemplatePath(s.Hashes[i].Path)
+	}
+}
+
+// normalizeTemplatePath returns the canonical form of an embedded: or gcs:
+// path, e.g. "gcs:/bucket/dir" for " GCS://bucket//dir/ ". Other paths are
+// returned without surrounding whitespace.
+func normalizeTemplatePath(p string) string {
+	p = strings.TrimSpace(p)
+	u, err := url.Parse(p)
+	if err != nil || (u.Scheme != "embedded" && u.Scheme != "gcs") || u.RawQuery != "" || u.Fragment != "" {
+		return p
+	}
+	rest := u.Opaque
+	if rest == "" {
+		rest = u.Host + u.Path
+	}
+	cleaned := path.Clean("/" + rest)
+	// A bare bucket keeps its slash, which selects the whole bucket.
+	if u.Scheme == "gcs" && !strings.Contains(strings.TrimPrefix(cleaned, "/"), "/") {
+		cleaned += "/"
+	}
+	return u.Scheme + ":" + cleaned
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrationSpecDefault(t *testing.T) {
+	spec := IntegrationSpec{
+		Group:      "model.skippy.io",
+		Kind:       "ModelServer",
+		References: []IntegrationApiReferenceSpec{{Group: "model.skippy.io", Kind: "ModelData"}, {Version: "v2"}},
+		Consumes:   []IntegrationConsumeSpec{{Group: "model.skippy.io", Kind: "InferenceDeployment", Dependents: []IntegrationConsumedDependentSpec{{Kind: "Service"}}}},
+		Templates: []IntegrationApiTemplatesSpec{
+			{Path: "embedded:/v1/server/template/"},
+			{Operation: "overlay", Path: " gcs://bucket//overlays/prod ", Environment: "prod"},
+		},
+		Hashes: []IntegrationApiHashSpec{{Path: "gcs:/bucket/overlays/prod/", Hash: "abc"}},
+	}
+	spec.Default()
+
+	assert.Equal(t, "v1", spec.Version)
+	assert.Equal(t, "v1", spec.References[0].Version)
+	assert.Equal(t, "v2", spec.References[1].Version)
+	assert.Equal(t, "v1", spec.Consumes[0].Version)
+	assert.Equal(t, "v1", spec.Consumes[0].Dependents[0].Version)
+	assert.Equal(t, []IntegrationApiTemplatesSpec{
+		{Operation: "template", Path: "embedded:/v1/server/template"},
+		{Operation: "overlay", Path: "gcs:/bucket/overlays/prod", Environment: "prod"},
+	}, spec.Templates)
+	assert.Equal(t, "gcs:/bucket/overlays/prod", spec.Hashes[0].Path)
+}
+
+func TestNormalizeTemplatePath(t *testing.T) {
+	for path, want := range map[string]string{
+		"embedded:/v1/agent/template":         "embedded:/v1/agent/template",
+		"embedded:v1/agent/./template/":       "embedded:/v1/agent/template",
+		"EMBEDDED:/v1/agent/template":         "embedded:/v1/agent/template",
+		"gcs:/bucket/integrations//endpoint/": "gcs:/bucket/integrations/endpoint",
+		"gcs://bucket/integrations/endpoint":  "gcs:/bucket/integrations/endpoint",
+		"gcs:/bucket/":                        "gcs:/bucket/",
+		"gcs:/bucket":                         "gcs:/bucket/",
+		"  gcs:/bucket/base\n":                "gcs:/bucket/base",
+		"https://example.com/templates?x=1":   "https://example.com/templates?x=1",
+		"gcs:/bucket/base?generation=1":       "gcs:/bucket/base?generation=1",
+	} {
+		t.Run(path, func(t *testing.T) {
+			assert.Equal(t, want, normalizeTemplatePath(path))
+		})
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,26 +28,181 @@ type IntegrationApiReferencePathSpec struct {
 }
 
 type IntegrationApiReferenceSpec struct {
-	Group              string                          `json:"group"`
-	Version            string                          `json:"version"`
-	Kind               string                          `json:"kind"`
-	Paths              IntegrationApiReferencePathSpec `json:"paths"`
-	PropagateTemplates bool                            `json:"propagateTemplates,omitempty"`
+	Group string `json:"group"`
+	// +kubebuilder:default=v1
+	Version string                          `json:"version"`
+	Kind    string                          `json:"kind"`
+	Paths   IntegrationApiReferencePathSpec `json:"paths"`
+	// +kubebuilder:default=false
+	PropagateTemplates bool `json:"propagateTemplates,omitempty"`
+	// PropagateTemplatePaths limits the propagated templates of the
+	// referenced kind to those whose path matches one of these patterns, e.g.
+	// "gcs:/bucket/agent/monitoring" or "embedded:/v1/*/monitoring", with the
+	// syntax of path.Match. All of them are propagated if it is empty.
+	PropagateTemplatePaths []string `json:"propagateTemplatePaths,omitempty"`
+}
+
+// IntegrationRequirementSpec names a kind that must be ready before an
+// integration is started.
+type IntegrationRequirementSpec struct {
+	Group string `json:"group"`
+	// +kubebuilder:default=v1
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// IntegrationConsumeSpec makes a resource of Group/Kind that is not
+// referenced, and optionally some of its dependents, available to the
+// templates in .resources, e.g. the InferenceDeployment that an EvalRun
+// evaluates and the Service that it generated. Consumed resources are read
+// from the namespace of the consuming resource, and their templates are not
+// rendered.
+type IntegrationConsumeSpec struct {
+	Group string `json:"group"`
+	// +kubebuilder:default=v1
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// NamePath is the dot-separated path of the field of the consuming
+	// resource that names the consumed resource, e.g. "spec.target". If
+	// empty, the resource with the same name as the consuming resource is
+	// consumed. Nothing is consumed while the field is empty.
+	NamePath string `json:"namePath,omitempty"`
+	// Dependents lists the kinds of the dependents of the consumed resource,
+	// as recorded in its status.dependentResources, that are consumed too.
+	Dependents []IntegrationConsumedDependentSpec `json:"dependents,omitempty"`
+}
+
+// IntegrationConsumedDependentSpec names a kind of dependents of a consumed
+// resource.
+type IntegrationConsumedDependentSpec struct {
+	Group string `json:"group,omitempty"`
+	// +kubebuilder:default=v1
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// IntegrationDeletePropagationSpec sets how dependents of Group/Kind are
+// deleted, e.g. Foreground for Jobs so that their pods do not linger, or
+// Orphan for PersistentVolumeClaims that must outlive the resource.
+type IntegrationDeletePropagationSpec struct {
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind"`
+	// +kubebuilder:validation:Enum=Foreground;Background;Orphan
+	Policy metav1.DeletionPropagation `json:"policy"`
+}
+
+// IntegrationReferenceGrantSpec allows resources of an integration's kind in
+// FromNamespace to reference resources of Group/Kind in ToNamespace, e.g. a
+// shared ModelData in a "models" namespace. References resolve to the
+// namespace at the reference's namespace path, and without a grant they must
+// stay in the referencing resource's namespace. "*" matches any namespace.
+type IntegrationReferenceGrantSpec struct {
+	FromNamespace string `json:"fromNamespace"`
+	ToNamespace   string `json:"toNamespace"`
+	Group         string `json:"group,omitempty"`
+	Kind          string `json:"kind"`
 }
 
 type IntegrationApiContextRequestSpec struct {
+	// +kubebuilder:validation:Enum=GET
 	Method string `json:"method"`
 	Path   string `json:"path"`
 }
 
+// IntegrationContextFieldSpec picks a part of a context response.
+type IntegrationContextFieldSpec struct {
+	// Name is the key of the part in the context value.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// JSONPath selects the part, e.g. "{.recommendations[*].acceleratorType}".
+	// A single match is kept as it is and several become a list.
+	// +kubebuilder:validation:MinLength=1
+	JSONPath string `json:"jsonPath"`
+}
+
 type IntegrationApiContextSpec struct {
+	// +kubebuilder:validation:MinLength=1
 	Name    string                           `json:"name"`
 	Request IntegrationApiContextRequestSpec `json:"request"`
+	// MaxBytes fails the request when the response is larger, so that huge
+	// payloads are neither held in memory nor rendered.
+	// +kubebuilder:validation:Minimum=1
+	MaxBytes *int64 `json:"maxBytes,omitempty"`
+	// Redact lists the fields of the response, as dot-separated paths such
+	// as "auth.token", whose values are replaced with "[REDACTED]" before
+	// templates see them. Paths go through lists, so "items.secret" redacts
+	// the secret of every item.
+	Redact []string `json:"redact,omitempty"`
+	// Fields, if set, makes the context value an object with only the parts
+	// of the redacted response that they pick. Parts that are not found are
+	// left out.
+	Fields []IntegrationContextFieldSpec `json:"fields,omitempty"`
+	// Schema is an OpenAPI v3 schema that the context value must satisfy.
+	// Templates are not rendered while it does not.
+	Schema *apiextensionsv1.JSONSchemaProps `json:"schema,omitempty"`
+	// Sticky keeps the value of the request in status.stickyContext of the
+	// resource and reuses it until the generation of the resource changes,
+	// so that the rendered objects do not change with every answer of the
+	// API.
+	Sticky bool `json:"sticky,omitempty"`
+	// TLS overrides how the server certificate of the API is verified.
+	TLS *IntegrationContextTLSSpec `json:"tls,omitempty"`
 }
 
+// IntegrationContextTLSSpec configures the TLS connections of a context
+// request, e.g. to an internal service with a private CA.
+type IntegrationContextTLSSpec struct {
+	// CABundle holds PEM encoded CA certificates that are trusted for the
+	// request, in addition to the system roots and --context-ca-bundle.
+	CABundle string `json:"caBundle,omitempty"`
+	// ServerName overrides the name that the server certificate is verified
+	// against, e.g. when the API is reached through an IP address.
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables the verification of the server
+	// certificate. Only use it for tests, as it allows anyone on the path to
+	// the API to read and change the context.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// IntegrationApiTemplatesSpec is a bundle of files that is copied ("copy"),
+// rendered ("template") or, for the "overlay" operation, rendered and applied
+// as kustomize patches on top of the other bundles when the operator runs in
+// Environment, e.g. to size resources differently in dev and prod. The
+// objects rendered by a "patch" bundle are applied as patches to existing
+// objects that the operator does not own, and reverted when the resource is
+// deleted. A "kustomize" bundle is copied with its own kustomize layout, and
+// the kustomization at Root is built as part of the render.
+// +kubebuilder:validation:XValidation:rule="self.operation == 'overlay' ? has(self.environment) && size(self.environment) > 0 : !has(self.environment)",message="environment must be set for overlay templates, and only for them"
+// +kubebuilder:validation:XValidation:rule="self.operation == 'patch' || (!has(self.patchType) && !has(self.conflictPolicy))",message="patchType and conflictPolicy are only allowed for patch templates"
+// +kubebuilder:validation:XValidation:rule="self.operation == 'kustomize' || (!has(self.root) && !has(self.vars))",message="root and vars are only allowed for kustomize templates"
 type IntegrationApiTemplatesSpec struct {
+	// +kubebuilder:default=template
+	// +kubebuilder:validation:Enum=copy;template;overlay;patch;kustomize
 	Operation string `json:"operation"`
-	Path      string `json:"path"`
+	// Path is an embedded:/ or gcs:/bucket/ path of the bundle.
+	// +kubebuilder:validation:Pattern=`^(embedded|gcs):`
+	Path        string `json:"path"`
+	Environment string `json:"environment,omitempty"`
+	// PatchType is how the objects of a patch bundle are applied:
+	// StrategicMerge (the default, for built-in kinds), Merge (a JSON merge
+	// patch, for custom resources) or JSON, where the rendered object names
+	// the patched object and lists the JSON patch operations in "patch".
+	// +kubebuilder:validation:Enum=StrategicMerge;Merge;JSON
+	PatchType string `json:"patchType,omitempty"`
+	// ConflictPolicy decides what happens when an object is already patched
+	// by another resource: Fail (the default) fails the reconcile, Force
+	// takes the object over.
+	// +kubebuilder:validation:Enum=Fail;Force
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+	// Root is the directory of a kustomize bundle, relative to Path, whose
+	// kustomization is built, e.g. "overlays/prod". It defaults to Path.
+	Root string `json:"root,omitempty"`
+	// Vars are rendered like templates and written, next to the name and
+	// namespace of the resource, to the data of the karo-values ConfigMap in
+	// karo-values.yaml at Path of a kustomize bundle. Kustomizations of the
+	// bundle list it as a resource and copy its values into their objects with
+	// replacements. The ConfigMap is local config, and is not applied.
+	Vars map[string]string `json:"vars,omitempty"`
 }
 
 type IntegrationApiHashSpec struct {
@@ -53,29 +210,330 @@ type IntegrationApiHashSpec struct {
 	Hash string `json:"hash"`
 }
 
+// IntegrationSecurityPolicySpec defines pod security settings that are enforced
+// on every pod spec generated for an integration. Templates may repeat these
+// settings but must not contradict them.
+type IntegrationSecurityPolicySpec struct {
+	// RuntimeClassName is the RuntimeClass every generated pod must run with (e.g. "gvisor").
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+	// SeccompProfileType is the pod seccomp profile type (e.g. "RuntimeDefault").
+	SeccompProfileType string `json:"seccompProfileType,omitempty"`
+	// RunAsNonRoot requires all containers to run as a non-root user.
+	RunAsNonRoot *bool `json:"runAsNonRoot,omitempty"`
+	// DropCapabilities are Linux capabilities dropped from every container (e.g. "ALL").
+	DropCapabilities []string `json:"dropCapabilities,omitempty"`
+	// AllowedImages are regular expressions, e.g. `^us-docker\.pkg\.dev/team/sandboxes/`,
+	// one of which every container image must match. Images are not restricted if empty.
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// ImageSignatureKeys are PEM encoded cosign public keys. If set, every
+	// container image must have a cosign signature by one of them.
+	ImageSignatureKeys []string `json:"imageSignatureKeys,omitempty"`
+}
+
 type IntegrationSpec struct {
-	Group      string                        `json:"group"`
-	Version    string                        `json:"version"`
-	Kind       string                        `json:"kind"`
-	References []IntegrationApiReferenceSpec `json:"references,omitempty"`
-	Context    []IntegrationApiContextSpec   `json:"context,omitempty"`
-	Templates  []IntegrationApiTemplatesSpec `json:"templates"`
-	Hashes     []IntegrationApiHashSpec      `json:"hashes"`
+	Group string `json:"group"`
+	// +kubebuilder:default=v1
+	// +kubebuilder:validation:Pattern=`^v[0-9]+((alpha|beta)[0-9]+)?$`
+	Version string `json:"version"`
+	// +kubebuilder:validation:Pattern=`^[A-Z][A-Za-z0-9]*$`
+	Kind           string                         `json:"kind"`
+	References     []IntegrationApiReferenceSpec  `json:"references,omitempty"`
+	Context        []IntegrationApiContextSpec    `json:"context,omitempty"`
+	Templates      []IntegrationApiTemplatesSpec  `json:"templates"`
+	Hashes         []IntegrationApiHashSpec       `json:"hashes"`
+	SecurityPolicy *IntegrationSecurityPolicySpec `json:"securityPolicy,omitempty"`
+	// Budget caps the total resource requests (e.g. cpu, memory, nvidia.com/gpu, pods)
+	// that the dependents of a single resource of this kind may add up to.
+	Budget  corev1.ResourceList     `json:"budget,omitempty"`
+	Rollout *IntegrationRolloutSpec `json:"rollout,omitempty"`
+	// CommonLabels are added to every generated object and pod template, e.g.
+	// team or cost-center. Labels set by the templates take precedence, and
+	// selectors are not changed.
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// CommonAnnotations are added to every generated object and pod template.
+	// Annotations set by the templates take precedence.
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+	// Naming adds a prefix or suffix to the names of generated objects.
+	Naming *IntegrationNamingSpec `json:"naming,omitempty"`
+	// Consumes lists the resources, other than references, whose content
+	// and dependents are added to .resources of the templates, so that one
+	// integration can read the output of another.
+	Consumes []IntegrationConsumeSpec `json:"consumes,omitempty"`
+	// ReferenceGrants allow references to resources in other namespaces.
+	ReferenceGrants []IntegrationReferenceGrantSpec `json:"referenceGrants,omitempty"`
+	Health          *IntegrationHealthSpec          `json:"health,omitempty"`
+	// StatusMappings copy values from dependents into the status of the
+	// resource, e.g. the cluster IP of a generated Service.
+	StatusMappings []IntegrationStatusMappingSpec `json:"statusMappings,omitempty"`
+	// Values are passed to the templates as .values, so that optional blocks
+	// (e.g. monitoring or a mesh sidecar) can be toggled per environment
+	// without forking the template bundle.
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+	// ValuesSchema is an OpenAPI v3 schema that Values must satisfy. Templates
+	// are not rendered while Values are invalid.
+	ValuesSchema *apiextensionsv1.JSONSchemaProps `json:"valuesSchema,omitempty"`
+	// RequiredFields are dot-separated paths, e.g. "spec.autoscaling.minReplicas",
+	// that the templates expect on every resource of the kind. A resource that
+	// lacks one of them is not rendered, and its SpecInvalid condition lists
+	// the missing paths.
+	RequiredFields []string `json:"requiredFields,omitempty"`
+	// Requires lists the kinds that must be ready before the integration is
+	// started, e.g. the sandbox runtime that AgenticSandbox depends on. A
+	// required kind is ready when the API server serves it and, if an
+	// Integration declares it, its integration is started. Resources of the
+	// kind are not rendered while a required kind is not served, and their
+	// Waiting condition lists it.
+	Requires []IntegrationRequirementSpec `json:"requires,omitempty"`
+	// DeletePropagation sets the propagation policy per kind when the
+	// operator deletes dependents. Kinds that are not listed are deleted
+	// with the default policy of their API, except where the operator needs
+	// a specific one, e.g. Background when it recreates a Job.
+	DeletePropagation []IntegrationDeletePropagationSpec `json:"deletePropagation,omitempty"`
+	// Storage sets how the gcs: template paths of the integration are read.
+	Storage *IntegrationStorageSpec `json:"storage,omitempty"`
+	// Package sets how the packaged gcs: template bundles of the integration
+	// are verified.
+	Package *IntegrationPackageSpec `json:"package,omitempty"`
+	// Autoscaler selects the kind of object that the autoscalerFor template
+	// function renders from an autoscaling block: "HorizontalPodAutoscaler"
+	// (the default) or "KEDA", which renders a KEDA ScaledObject that can
+	// scale to zero.
+	// +kubebuilder:validation:Enum=HorizontalPodAutoscaler;KEDA
+	Autoscaler string `json:"autoscaler,omitempty"`
+	// Monitoring selects the flavor of monitoring objects that the templates
+	// render, passed to them as .monitoring: "GoogleManagedPrometheus"
+	// (PodMonitoring), "PrometheusOperator" (PodMonitor and ServiceMonitor) or
+	// "None". "Auto", the default, picks the first flavor whose CRDs the
+	// cluster serves.
+	// +kubebuilder:validation:Enum=Auto;GoogleManagedPrometheus;PrometheusOperator;None
+	Monitoring string `json:"monitoring,omitempty"`
+	// Kustomize enables kustomize features that template bundles declare in
+	// their own kustomization.yaml. Without it, bundle kustomizations are
+	// ignored.
+	Kustomize *IntegrationKustomizeSpec `json:"kustomize,omitempty"`
+}
+
+// IntegrationKustomizeSpec selects the kustomize features that are taken from
+// the kustomization.yaml at the root of a template bundle. The kustomization
+// is rendered like the other templates, and the paths in it are relative to
+// the bundle. A bundle that declares a feature that is not enabled is not
+// rendered.
+type IntegrationKustomizeSpec struct {
+	// Components allows the bundle to list kustomize components, i.e.
+	// directories of the bundle with a kustomization of kind Component. Their
+	// files are not rendered as resources of their own.
+	Components bool `json:"components,omitempty"`
+	// Generators allows configMapGenerator and secretGenerator. The names of
+	// generated objects get a hash of their content as a suffix, unless
+	// generatorOptions disables it, and the references to them in the
+	// rendered objects are updated. Files read by generators are copied as
+	// they are, and are not rendered as resources.
+	Generators bool `json:"generators,omitempty"`
+	// Replacements allows replacements, which copy fields between the
+	// rendered objects.
+	Replacements bool `json:"replacements,omitempty"`
+}
+
+// IntegrationStorageSpec sets the credentials and endpoints used to read gcs:
+// template paths. By default the ambient credentials of the operator are used.
+type IntegrationStorageSpec struct {
+	Credentials *IntegrationStorageCredentialsSpec `json:"credentials,omitempty"`
+	// Endpoints override the GCS endpoint of individual buckets, e.g. to read
+	// templates from an emulator in tests.
+	Endpoints []IntegrationStorageEndpointSpec `json:"endpoints,omitempty"`
+}
+
+// IntegrationStorageCredentialsSpec selects the credentials used for GCS.
+// +kubebuilder:validation:XValidation:rule="self.source == 'Secret' ? has(self.secret) : !has(self.secret)",message="secret must be set for the Secret source, and only for it"
+// +kubebuilder:validation:XValidation:rule="self.source == 'WorkloadIdentity' ? has(self.serviceAccount) : !has(self.serviceAccount)",message="serviceAccount must be set for the WorkloadIdentity source, and only for it"
+type IntegrationStorageCredentialsSpec struct {
+	// Source is one of Default (the credentials of the operator),
+	// WorkloadIdentity, Secret or Anonymous (for public buckets).
+	Source string `json:"source"`
+	// ServiceAccount is the Kubernetes ServiceAccount whose
+	// iam.gke.io/gcp-service-account annotation names the Google service
+	// account to impersonate with the WorkloadIdentity source. The operator
+	// needs roles/iam.serviceAccountTokenCreator on that service account.
+	ServiceAccount *IntegrationObjectReference `json:"serviceAccount,omitempty"`
+	// Secret holds the Google service account key used with the Secret source.
+	Secret *IntegrationSecretKeyReference `json:"secret,omitempty"`
+}
+
+// IntegrationPackageSpec sets how packaged template bundles are verified. A
+// bundle is packaged if it has a metadata.yaml at its root, which names and
+// versions it, and holds the checksums of its files. Packaged gcs: bundles are
+// always verified against their metadata.yaml. Embedded bundles are part of
+// the operator and are not checked.
+type IntegrationPackageSpec struct {
+	// Required rejects gcs: bundles without a metadata.yaml.
+	Required bool `json:"required,omitempty"`
+	// SignatureKeys are PEM encoded cosign public keys. If set, the
+	// metadata.yaml of every gcs: bundle must have a cosign signature by one
+	// of them in metadata.yaml.sig, as written by "cosign sign-blob".
+	SignatureKeys []string `json:"signatureKeys,omitempty"`
+}
+
+// IntegrationObjectReference names an object. The namespace defaults to the
+// namespace of the Integration.
+type IntegrationObjectReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// IntegrationSecretKeyReference selects a key of a Secret. The namespace
+// defaults to the namespace of the Integration, the key to "key.json".
+type IntegrationSecretKeyReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// IntegrationStorageEndpointSpec overrides the GCS endpoint of a bucket.
+type IntegrationStorageEndpointSpec struct {
+	Bucket string `json:"bucket"`
+	// Endpoint is the URL of the GCS JSON API, e.g.
+	// "http://fake-gcs:4443/storage/v1/".
+	Endpoint string `json:"endpoint"`
+}
+
+// IntegrationStatusMappingSpec copies a value from a dependent into the status
+// of the resource. The field is removed again when the value disappears from
+// the dependent.
+type IntegrationStatusMappingSpec struct {
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind"`
+	// Name selects a dependent by name. If empty, the first dependent of the
+	// kind is used.
+	Name string `json:"name,omitempty"`
+	// JSONPath selects the value in the dependent, e.g.
+	// "{.status.loadBalancer.ingress[0].ip}". Braces are optional.
+	JSONPath string `json:"jsonPath"`
+	// Field is the dot-separated path under status to write the value to,
+	// e.g. "endpoint.address". The CRD of the resource must allow the field.
+	Field string `json:"field"`
+}
+
+// IntegrationHealthSpec sets how long generated Jobs and Deployments may take
+// to become healthy. Dependents that exceed their timeout set the Degraded
+// condition of the resource, along with the failure reasons of their pods.
+type IntegrationHealthSpec struct {
+	// JobTimeout is how long a Job may run without completing.
+	JobTimeout *metav1.Duration `json:"jobTimeout,omitempty"`
+	// DeploymentTimeout is how long a Deployment may stay unavailable.
+	DeploymentTimeout *metav1.Duration `json:"deploymentTimeout,omitempty"`
+	// Remediation is the action taken once per timeout on an unhealthy
+	// dependent: "None", "Restart", which deletes the failing pods of a
+	// Deployment or recreates a Job, or "Rollback", which aborts an
+	// in-progress rollout of a Deployment. Defaults to "None".
+	// +kubebuilder:validation:Enum=None;Restart;Rollback
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// IntegrationNamingSpec configures the names of generated objects. The prefix
+// and suffix are templates rendered with the same context as the integration's
+// templates, e.g. "{{ .resource.metadata.namespace }}-". They are applied with
+// kustomize, so references between generated objects are renamed too.
+type IntegrationNamingSpec struct {
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+// IntegrationRolloutSpec configures progressive rollouts of generated
+// Deployments. When the pod template of a Deployment changes, the new
+// revision runs next to the old one until it is promoted.
+// +kubebuilder:validation:XValidation:rule="self.strategy == 'Canary' || !has(self.canaryPercent)",message="canaryPercent is only used by the Canary strategy"
+type IntegrationRolloutSpec struct {
+	// Strategy is "Canary", which runs a fraction of the replicas with the
+	// new revision, or "BlueGreen", which runs a full copy of the Deployment.
+	// +kubebuilder:validation:Enum=Canary;BlueGreen
+	Strategy string `json:"strategy"`
+	// CanaryPercent is the size of the canary relative to the stable
+	// replicas, and so roughly its share of the Service traffic. Only used
+	// by the Canary strategy. Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	CanaryPercent int32 `json:"canaryPercent,omitempty"`
+	// BakeTime is how long the new revision must stay available before it
+	// is promoted. Defaults to 5m.
+	BakeTime *metav1.Duration `json:"bakeTime,omitempty"`
+	// MaxRestarts is the number of container restarts of the new revision
+	// that is tolerated before the rollout is aborted.
+	// +kubebuilder:validation:Minimum=0
+	MaxRestarts int32 `json:"maxRestarts,omitempty"`
+}
+
+// IntegrationPermission is a set of verbs on a resource, such as
+// "deployments" or "deployments/status", in a namespace.
+type IntegrationPermission struct {
+	// Group is the API group of the resource, empty for the core group.
+	// +optional
+	Group string `json:"group,omitempty"`
+	// Resource is the resource, with its subresource if any.
+	Resource string `json:"resource"`
+	// Namespace is the namespace of the permission, empty for cluster-wide.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Verbs are the verbs on the resource, e.g. "create".
+	Verbs []string `json:"verbs"`
+}
+
+// IntegrationBundleStatus identifies the packaged template bundle that an
+// integration renders from a path.
+type IntegrationBundleStatus struct {
+	// Group, Version and Kind identify the integration.
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Path is the template path of the bundle.
+	Path string `json:"path"`
+	// Name and BundleVersion are the name and version of the bundle, from
+	// its metadata.yaml.
+	Name          string `json:"name"`
+	BundleVersion string `json:"bundleVersion"`
+	// Digest is the sha256 digest of the metadata.yaml of the bundle.
+	Digest string `json:"digest"`
+	// Signed is true if the metadata.yaml has a signature by one of the
+	// signature keys of the integration.
+	// +optional
+	Signed bool `json:"signed,omitempty"`
 }
 
 // IntegrationStatus defines the observed state of Integration
 type IntegrationStatus struct {
 	Ready bool `json:"ready"`
+
+	// Bundles lists the packaged template bundles that were verified when
+	// the integrations were last loaded.
+	// +optional
+	Bundles []IntegrationBundleStatus `json:"bundles,omitempty"`
+
+	// MissingPermissions lists the permissions that the operator needs to
+	// reconcile the resources of the integrations, and their dependents, but
+	// lacks. Reconciles that need them fail with Forbidden errors. Only set
+	// when the operator runs with --check-permissions.
+	// +optional
+	MissingPermissions []IntegrationPermission `json:"missingPermissions,omitempty"`
+
+	// Conditions hold the PermissionsGranted and BundlesVerified conditions.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 
 // Integration is the Schema for the integrations API
 type Integration struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
+	// +listType=map
+	// +listMapKey=group
+	// +listMapKey=version
+	// +listMapKey=kind
 	Spec   []IntegrationSpec `json:"spec,omitempty"`
 	Status IntegrationStatus `json:"status,omitempty"`
 }
@@ -7,8 +7,11 @@ import (
 
 	// Kubernetes types
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 
@@ -22,6 +25,11 @@ type ResourceClientInterface interface {
 	Get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error)
 	Create(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
 	Update(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	// Delete deletes an object with the given propagation policy, or the
+	// default policy of its API if propagation is nil.
+	Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *metav1.DeletionPropagation) error
+	// Patch patches an existing object with data of the given patch type.
+	Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error)
 }
 
 // RegistryInterface defines the methods required from the IntegrationRegistry
@@ -38,13 +46,24 @@ type RegistryInterface interface {
 
 	ListIntegrations() []schema.GroupVersionKind
 
+	// SetEnvironment selects the environment whose overlays are applied. (Used by IntegrationReconciler)
+	SetEnvironment(environment string)
+
 	// Add other IntegrationRegistry methods here IF they are directly
 	// called by GenericReconciler or IntegrationReconciler via the transformer.Registry() method.
-	ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any) error
+	ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any, reference bool) error
 	GetCopyPaths(k schema.GroupVersionKind) []string
 	GetTemplatePaths(k schema.GroupVersionKind) []string
+	GetOverlayPaths(k schema.GroupVersionKind) []string
+	GetPatchTemplates(k schema.GroupVersionKind) []IntegrationApiTemplatesSpec
+	GetKustomizeRoots(k schema.GroupVersionKind) []IntegrationApiTemplatesSpec
 	GetReferencePaths(k schema.GroupVersionKind) (map[schema.GroupVersionKind]string, map[schema.GroupVersionKind]string)
 	GetReferenceRules(gvk schema.GroupVersionKind) []IntegrationApiReferenceSpec
+
+	// GetIntegrationSpec returns a copy of the integration for the given GVK,
+	// and whether there is one. The settings of an integration that have no
+	// getter of their own, such as its budget or health, are read from it.
+	GetIntegrationSpec(gvk schema.GroupVersionKind) (IntegrationSpec, bool)
 }
 
 // TransformerInterface defines the methods required from the Transformer
@@ -54,8 +73,46 @@ type TransformerInterface interface {
 	// It accepts discovery.DiscoveryInterface for better mockability in tests.
 	Run(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, rClient client.Client, req ctrl.Request, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error)
 
+	// InputHash returns a hash of the inputs of the render of obj, which
+	// changes when Run may render different objects, other than through the
+	// responses of context requests. It executes no templates.
+	InputHash(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, obj *unstructured.Unstructured) (string, error)
+
 	// Registry returns the registry component satisfying the RegistryInterface.
 	Registry() RegistryInterface
+
+	// IntegrationKinds returns the kinds of the objects that the templates of
+	// an integration render. (Used by IntegrationReconciler)
+	IntegrationKinds(ctx context.Context, c client.Client, spec IntegrationSpec) ([]schema.GroupVersionKind, error)
+
+	// VerifyBundles verifies the packaged template bundles of an integration
+	// and returns their status. (Used by IntegrationReconciler)
+	VerifyBundles(ctx context.Context, c client.Client, spec IntegrationSpec) ([]IntegrationBundleStatus, error)
+
+	// TemplateHashes returns the content hash of the bundle at each template
+	// path of an integration. (Used by IntegrationReconciler)
+	TemplateHashes(ctx context.Context, c client.Client, spec IntegrationSpec) (map[string]string, error)
+}
+
+// KindReconcilerHost is the part of the generic reconciler that stateful kind
+// reconcilers use to reach the cluster.
+type KindReconcilerHost interface {
+	GetClient() client.Client
+	GetScheme() *runtime.Scheme
+	// Eventf records an event on obj, unless events are disabled.
+	Eventf(obj runtime.Object, eventType string, reason EventReason, messageFmt string, args ...interface{})
+	// DryRun reports whether the writes of the client are only dry-run, so
+	// that their results must not be recorded in status.
+	DryRun() bool
+}
+
+// KindReconcilerInterface is the stateful logic of a kind, such as the phase
+// machine of a ModelData. The generic reconciler runs it after applying the
+// dependents of a target, and stores the status it sets on obj.
+type KindReconcilerInterface interface {
+	// ReconcileStateful updates the status of obj in memory. A non-zero
+	// result or an error ends the reconciliation of the target early.
+	ReconcileStateful(ctx context.Context, host KindReconcilerHost, obj *unstructured.Unstructured) (ctrl.Result, error)
 }
 
 // --- Compile-time checks to ensure real types satisfy the interfaces ---
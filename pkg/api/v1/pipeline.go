@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RenderPipelineInterface is the render pipeline of the transformer, split
+// into stages that other controllers can run on their own, e.g. to render a
+// resource without applying it, or to post-process the kustomization before
+// it is built. Each stage takes the output of the previous ones:
+//
+//	inputs, err := p.DiscoverInputs(ctx, obj, v1.DiscoverOptions{...})
+//	renderContext, err := p.ResolveContext(ctx, inputs, v1.ResolveOptions{...})
+//	files, err := p.Render(ctx, inputs, renderContext, v1.RenderOptions{...})
+//	defer files.Cleanup()
+//	built, err := p.Kustomize(ctx, files)
+//	objs, err := p.Parse(ctx, inputs, built)
+//
+// TransformerInterface.Run chains the stages, and reuses the output of
+// Kustomize while the rendered files do not change.
+type RenderPipelineInterface interface {
+	// DiscoverInputs finds the resources that obj references and that
+	// reference it, and sorts them in the order their templates are
+	// rendered. It also reads the resources that obj consumes.
+	DiscoverInputs(ctx context.Context, obj *unstructured.Unstructured, opts DiscoverOptions) (*RenderInputs, error)
+	// ResolveContext builds the template context that the resources of
+	// inputs share. Render adds the fields of each resource.
+	ResolveContext(ctx context.Context, inputs *RenderInputs, opts ResolveOptions) (RenderContext, error)
+	// Render renders the templates of the resources of inputs into a
+	// kustomization on disk.
+	Render(ctx context.Context, inputs *RenderInputs, renderContext RenderContext, opts RenderOptions) (*RenderedFiles, error)
+	// Kustomize builds the kustomization of files. It returns no objects if
+	// Render rendered no resources.
+	Kustomize(ctx context.Context, files *RenderedFiles) ([]*unstructured.Unstructured, error)
+	// Parse turns the objects built by Kustomize into the dependents of the
+	// primary resource of inputs: it validates them, applies the common
+	// metadata, mutators and security policies of the integration, and pins
+	// their images to digests.
+	Parse(ctx context.Context, inputs *RenderInputs, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error)
+}
+
+// DiscoverOptions hold the clients that DiscoverInputs finds the connected
+// resources with.
+// +kubebuilder:object:generate=false
+type DiscoverOptions struct {
+	DiscoveryClient discovery.DiscoveryInterface
+	DynamicClient   dynamic.Interface
+}
+
+// RenderInputs are the resources that a render reads.
+// +kubebuilder:object:generate=false
+type RenderInputs struct {
+	// Primary is the resource that is rendered.
+	Primary *unstructured.Unstructured
+	// Resources are Primary and its connected resources, in the order their
+	// templates are rendered.
+	Resources []*unstructured.Unstructured
+	// Consumed are the resources that the integration of Primary consumes,
+	// and their consumed dependents. They are added to .resources, but their
+	// templates are not rendered.
+	Consumed []*unstructured.Unstructured
+}
+
+// ResolveOptions hold the clients that ResolveContext passes to the
+// templates, and resolves the monitoring flavor with.
+// +kubebuilder:object:generate=false
+type ResolveOptions struct {
+	DynamicClient dynamic.Interface
+	Mapper        meta.RESTMapper
+	Client        client.Client
+}
+
+// RenderContext is the context that templates are rendered with, e.g.
+// .values or .resources, and the context requests of the integration. Render
+// adds the fields of each resource, e.g. .resource and .chain.
+// +kubebuilder:object:generate=false
+type RenderContext map[string]any
+
+// RenderOptions configure Render.
+// +kubebuilder:object:generate=false
+type RenderOptions struct {
+	// Client reads the credentials of the gcs: template paths of the
+	// integration.
+	Client client.Client
+}
+
+// RenderedFiles is the kustomization that Render writes.
+// +kubebuilder:object:generate=false
+type RenderedFiles struct {
+	// Root is the directory of the kustomization.yaml, or empty if no
+	// resource was rendered.
+	Root string
+	// Resources are the rendered resource files and kustomize bundles,
+	// relative to Root.
+	Resources []string
+	// Files are all the files under Root that kustomize reads, including the
+	// kustomization.yaml, the resources and the overlays.
+	Files []string
+	// Patches are the rendered patches of existing objects, which are
+	// applied without kustomize.
+	Patches []*unstructured.Unstructured
+	// Cleanup removes Root. It must be called once the files are no longer
+	// needed.
+	Cleanup func()
+}
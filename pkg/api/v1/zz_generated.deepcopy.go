@@ -9,6 +9,9 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -24,7 +27,7 @@ func (in *Integration) DeepCopyInto(out *Integration) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Integration.
@@ -64,6 +67,31 @@ func (in *IntegrationApiContextRequestSpec) DeepCopy() *IntegrationApiContextReq
 func (in *IntegrationApiContextSpec) DeepCopyInto(out *IntegrationApiContextSpec) {
 	*out = *in
 	out.Request = in.Request
+	if in.MaxBytes != nil {
+		in, out := &in.MaxBytes, &out.MaxBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Redact != nil {
+		in, out := &in.Redact, &out.Redact
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]IntegrationContextFieldSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = new(apiextensionsv1.JSONSchemaProps)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(IntegrationContextTLSSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationApiContextSpec.
@@ -110,6 +138,11 @@ func (in *IntegrationApiReferencePathSpec) DeepCopy() *IntegrationApiReferencePa
 func (in *IntegrationApiReferenceSpec) DeepCopyInto(out *IntegrationApiReferenceSpec) {
 	*out = *in
 	out.Paths = in.Paths
+	if in.PropagateTemplatePaths != nil {
+		in, out := &in.PropagateTemplatePaths, &out.PropagateTemplatePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationApiReferenceSpec.
@@ -125,6 +158,13 @@ func (in *IntegrationApiReferenceSpec) DeepCopy() *IntegrationApiReferenceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntegrationApiTemplatesSpec) DeepCopyInto(out *IntegrationApiTemplatesSpec) {
 	*out = *in
+	if in.Vars != nil {
+		in, out := &in.Vars, &out.Vars
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationApiTemplatesSpec.
@@ -169,29 +209,518 @@ func (in *IntegrationList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationConsumeSpec) DeepCopyInto(out *IntegrationConsumeSpec) {
+	*out = *in
+	if in.Dependents != nil {
+		in, out := &in.Dependents, &out.Dependents
+		*out = make([]IntegrationConsumedDependentSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationConsumeSpec.
+func (in *IntegrationConsumeSpec) DeepCopy() *IntegrationConsumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationConsumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationConsumedDependentSpec) DeepCopyInto(out *IntegrationConsumedDependentSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationConsumedDependentSpec.
+func (in *IntegrationConsumedDependentSpec) DeepCopy() *IntegrationConsumedDependentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationConsumedDependentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationContextFieldSpec) DeepCopyInto(out *IntegrationContextFieldSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationContextFieldSpec.
+func (in *IntegrationContextFieldSpec) DeepCopy() *IntegrationContextFieldSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationContextFieldSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationContextTLSSpec) DeepCopyInto(out *IntegrationContextTLSSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationContextTLSSpec.
+func (in *IntegrationContextTLSSpec) DeepCopy() *IntegrationContextTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationContextTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationDeletePropagationSpec) DeepCopyInto(out *IntegrationDeletePropagationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationDeletePropagationSpec.
+func (in *IntegrationDeletePropagationSpec) DeepCopy() *IntegrationDeletePropagationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationDeletePropagationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationHealthSpec) DeepCopyInto(out *IntegrationHealthSpec) {
+	*out = *in
+	if in.JobTimeout != nil {
+		in, out := &in.JobTimeout, &out.JobTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.DeploymentTimeout != nil {
+		in, out := &in.DeploymentTimeout, &out.DeploymentTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationHealthSpec.
+func (in *IntegrationHealthSpec) DeepCopy() *IntegrationHealthSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationHealthSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationKustomizeSpec) DeepCopyInto(out *IntegrationKustomizeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationKustomizeSpec.
+func (in *IntegrationKustomizeSpec) DeepCopy() *IntegrationKustomizeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationKustomizeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationNamingSpec) DeepCopyInto(out *IntegrationNamingSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationNamingSpec.
+func (in *IntegrationNamingSpec) DeepCopy() *IntegrationNamingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationNamingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationPermission) DeepCopyInto(out *IntegrationPermission) {
+	*out = *in
+	if in.Verbs != nil {
+		in, out := &in.Verbs, &out.Verbs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationPermission.
+func (in *IntegrationPermission) DeepCopy() *IntegrationPermission {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationPermission)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationReferenceGrantSpec) DeepCopyInto(out *IntegrationReferenceGrantSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationReferenceGrantSpec.
+func (in *IntegrationReferenceGrantSpec) DeepCopy() *IntegrationReferenceGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationReferenceGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationRequirementSpec) DeepCopyInto(out *IntegrationRequirementSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationRequirementSpec.
+func (in *IntegrationRequirementSpec) DeepCopy() *IntegrationRequirementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationRequirementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationStatusMappingSpec) DeepCopyInto(out *IntegrationStatusMappingSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationStatusMappingSpec.
+func (in *IntegrationStatusMappingSpec) DeepCopy() *IntegrationStatusMappingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationStatusMappingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationPackageSpec) DeepCopyInto(out *IntegrationPackageSpec) {
+	*out = *in
+	if in.SignatureKeys != nil {
+		in, out := &in.SignatureKeys, &out.SignatureKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationPackageSpec.
+func (in *IntegrationPackageSpec) DeepCopy() *IntegrationPackageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationPackageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationBundleStatus) DeepCopyInto(out *IntegrationBundleStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationBundleStatus.
+func (in *IntegrationBundleStatus) DeepCopy() *IntegrationBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationStorageSpec) DeepCopyInto(out *IntegrationStorageSpec) {
+	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(IntegrationStorageCredentialsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]IntegrationStorageEndpointSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationStorageSpec.
+func (in *IntegrationStorageSpec) DeepCopy() *IntegrationStorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationStorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationStorageCredentialsSpec) DeepCopyInto(out *IntegrationStorageCredentialsSpec) {
+	*out = *in
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(IntegrationObjectReference)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(IntegrationSecretKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationStorageCredentialsSpec.
+func (in *IntegrationStorageCredentialsSpec) DeepCopy() *IntegrationStorageCredentialsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationStorageCredentialsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationObjectReference) DeepCopyInto(out *IntegrationObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationObjectReference.
+func (in *IntegrationObjectReference) DeepCopy() *IntegrationObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationSecretKeyReference) DeepCopyInto(out *IntegrationSecretKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationSecretKeyReference.
+func (in *IntegrationSecretKeyReference) DeepCopy() *IntegrationSecretKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationSecretKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationStorageEndpointSpec) DeepCopyInto(out *IntegrationStorageEndpointSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationStorageEndpointSpec.
+func (in *IntegrationStorageEndpointSpec) DeepCopy() *IntegrationStorageEndpointSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationStorageEndpointSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationRolloutSpec) DeepCopyInto(out *IntegrationRolloutSpec) {
+	*out = *in
+	if in.BakeTime != nil {
+		in, out := &in.BakeTime, &out.BakeTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationRolloutSpec.
+func (in *IntegrationRolloutSpec) DeepCopy() *IntegrationRolloutSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationRolloutSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IntegrationSecurityPolicySpec) DeepCopyInto(out *IntegrationSecurityPolicySpec) {
+	*out = *in
+	if in.RunAsNonRoot != nil {
+		in, out := &in.RunAsNonRoot, &out.RunAsNonRoot
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DropCapabilities != nil {
+		in, out := &in.DropCapabilities, &out.DropCapabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedImages != nil {
+		in, out := &in.AllowedImages, &out.AllowedImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImageSignatureKeys != nil {
+		in, out := &in.ImageSignatureKeys, &out.ImageSignatureKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationSecurityPolicySpec.
+func (in *IntegrationSecurityPolicySpec) DeepCopy() *IntegrationSecurityPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IntegrationSecurityPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntegrationSpec) DeepCopyInto(out *IntegrationSpec) {
 	*out = *in
 	if in.References != nil {
 		in, out := &in.References, &out.References
 		*out = make([]IntegrationApiReferenceSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Context != nil {
 		in, out := &in.Context, &out.Context
 		*out = make([]IntegrationApiContextSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Templates != nil {
 		in, out := &in.Templates, &out.Templates
 		*out = make([]IntegrationApiTemplatesSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Hashes != nil {
 		in, out := &in.Hashes, &out.Hashes
 		*out = make([]IntegrationApiHashSpec, len(*in))
 		copy(*out, *in)
 	}
+	if in.SecurityPolicy != nil {
+		in, out := &in.SecurityPolicy, &out.SecurityPolicy
+		*out = new(IntegrationSecurityPolicySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Budget != nil {
+		in, out := &in.Budget, &out.Budget
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(IntegrationRolloutSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CommonLabels != nil {
+		in, out := &in.CommonLabels, &out.CommonLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.CommonAnnotations != nil {
+		in, out := &in.CommonAnnotations, &out.CommonAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Naming != nil {
+		in, out := &in.Naming, &out.Naming
+		*out = new(IntegrationNamingSpec)
+		**out = **in
+	}
+	if in.Consumes != nil {
+		in, out := &in.Consumes, &out.Consumes
+		*out = make([]IntegrationConsumeSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ReferenceGrants != nil {
+		in, out := &in.ReferenceGrants, &out.ReferenceGrants
+		*out = make([]IntegrationReferenceGrantSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(IntegrationHealthSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StatusMappings != nil {
+		in, out := &in.StatusMappings, &out.StatusMappings
+		*out = make([]IntegrationStatusMappingSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ValuesSchema != nil {
+		in, out := &in.ValuesSchema, &out.ValuesSchema
+		*out = new(apiextensionsv1.JSONSchemaProps)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequiredFields != nil {
+		in, out := &in.RequiredFields, &out.RequiredFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Requires != nil {
+		in, out := &in.Requires, &out.Requires
+		*out = make([]IntegrationRequirementSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeletePropagation != nil {
+		in, out := &in.DeletePropagation, &out.DeletePropagation
+		*out = make([]IntegrationDeletePropagationSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(IntegrationStorageSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Package != nil {
+		in, out := &in.Package, &out.Package
+		*out = new(IntegrationPackageSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Kustomize != nil {
+		in, out := &in.Kustomize, &out.Kustomize
+		*out = new(IntegrationKustomizeSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationSpec.
@@ -207,6 +736,25 @@ func (in *IntegrationSpec) DeepCopy() *IntegrationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IntegrationStatus) DeepCopyInto(out *IntegrationStatus) {
 	*out = *in
+	if in.Bundles != nil {
+		in, out := &in.Bundles, &out.Bundles
+		*out = make([]IntegrationBundleStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.MissingPermissions != nil {
+		in, out := &in.MissingPermissions, &out.MissingPermissions
+		*out = make([]IntegrationPermission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IntegrationStatus.
@@ -0,0 +1,46 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1beta1 contains API Schema definitions for the model v1beta1 API
+// group.
+//
+// v1 is the storage version and the conversion hub: every other version
+// converts to and from v1 only, so a new version needs conversions for itself
+// and no changes to the existing ones. v1beta1 holds the Integration spec
+// fields that predate v1. Fields that v1 added since are kept in the
+// ConversionDataAnnotation of objects read as v1beta1, so that writing them
+// back as v1beta1 does not drop them. This requires the conversion webhook;
+// without it the API server relabels objects instead of converting them and
+// v1beta1 writes drop the v1 fields.
+// +kubebuilder:object:generate=true
+// +groupName=model.skippy.io
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is group version used to register these objects
+	GroupVersion = schema.GroupVersion{Group: "model.skippy.io", Version: "v1beta1"}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
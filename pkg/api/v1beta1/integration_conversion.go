@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// ConversionDataAnnotation holds the v1 spec of an Integration read as
+// v1beta1 if the spec uses fields that v1beta1 lacks.
+const ConversionDataAnnotation = "model.skippy.io/conversion-data"
+
+var _ conversion.Convertible = (*Integration)(nil)
+
+// ConvertTo converts this Integration to the hub version, restoring the v1
+// fields of the specs from the ConversionDataAnnotation.
+func (src *Integration) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Integration)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	var saved []v1.IntegrationSpec
+	if data, ok := dst.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &saved); err != nil {
+			return fmt.Errorf("invalid %s annotation of Integration %s/%s: %w", ConversionDataAnnotation, src.Namespace, src.Name, err)
+		}
+		delete(dst.Annotations, ConversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	dst.Spec = nil
+	for _, spec := range src.Spec {
+		converted := v1.IntegrationSpec{}
+		for i := range saved {
+			if saved[i].Group == spec.Group && saved[i].Version == spec.Version && saved[i].Kind == spec.Kind {
+				converted = saved[i]
+				break
+			}
+		}
+		convertSpecToHub(&spec, &converted)
+		dst.Spec = append(dst.Spec, converted)
+	}
+	dst.Status.Ready = src.Status.Ready
+	return nil
+}
+
+// ConvertFrom converts the hub version to this Integration, saving the spec
+// in the ConversionDataAnnotation if v1beta1 cannot represent it.
+func (dst *Integration) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.Integration)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	dst.Spec = nil
+	lossy := false
+	for i := range src.Spec {
+		converted := convertSpecFromHub(&src.Spec[i])
+		roundTrip := v1.IntegrationSpec{}
+		convertSpecToHub(&converted, &roundTrip)
+		if !equality.Semantic.DeepEqual(roundTrip, src.Spec[i]) {
+			lossy = true
+		}
+		dst.Spec = append(dst.Spec, converted)
+	}
+	if lossy {
+		data, err := json.Marshal(src.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to encode the spec of Integration %s/%s: %w", src.Namespace, src.Name, err)
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[ConversionDataAnnotation] = string(data)
+	}
+	dst.Status.Ready = src.Status.Ready
+	return nil
+}
+
+// convertSpecToHub sets the fields of dst that v1beta1 has from src, keeping
+// the others.
+func convertSpecToHub(src *IntegrationSpec, dst *v1.IntegrationSpec) {
+	dst.Group = src.Group
+	dst.Version = src.Version
+	dst.Kind = src.Kind
+	saved := dst.References
+	dst.References = nil
+	for i, r := range src.References {
+		reference := v1.IntegrationApiReferenceSpec{
+			Group:              r.Group,
+			Version:            r.Version,
+			Kind:               r.Kind,
+			Paths:              v1.IntegrationApiReferencePathSpec{Name: r.Paths.Name, Namespace: r.Paths.Namespace},
+			PropagateTemplates: r.PropagateTemplates,
+		}
+		// v1beta1 has no template selector.
+		if i < len(saved) && saved[i].Group == r.Group && saved[i].Kind == r.Kind {
+			reference.PropagateTemplatePaths = saved[i].PropagateTemplatePaths
+		}
+		dst.References = append(dst.References, reference)
+	}
+	dst.Context = nil
+	for _, c := range src.Context {
+		dst.Context = append(dst.Context, v1.IntegrationApiContextSpec{
+			Name:    c.Name,
+			Request: v1.IntegrationApiContextRequestSpec{Method: c.Request.Method, Path: c.Request.Path},
+		})
+	}
+	dst.Templates = nil
+	if src.Templates != nil {
+		dst.Templates = make([]v1.IntegrationApiTemplatesSpec, 0, len(src.Templates))
+	}
+	for _, t := range src.Templates {
+		dst.Templates = append(dst.Templates, v1.IntegrationApiTemplatesSpec{Operation: t.Operation, Path: t.Path, Environment: t.Environment})
+	}
+	dst.Hashes = nil
+	if src.Hashes != nil {
+		dst.Hashes = make([]v1.IntegrationApiHashSpec, 0, len(src.Hashes))
+	}
+	for _, h := range src.Hashes {
+		dst.Hashes = append(dst.Hashes, v1.IntegrationApiHashSpec{Path: h.Path, Hash: h.Hash})
+	}
+}
+
+// convertSpecFromHub returns the fields of src that v1beta1 has.
+func convertSpecFromHub(src *v1.IntegrationSpec) IntegrationSpec {
+	dst := IntegrationSpec{
+		Group:   src.Group,
+		Version: src.Version,
+		Kind:    src.Kind,
+	}
+	for _, r := range src.References {
+		dst.References = append(dst.References, IntegrationApiReferenceSpec{
+			Group:              r.Group,
+			Version:            r.Version,
+			Kind:               r.Kind,
+			Paths:              IntegrationApiReferencePathSpec{Name: r.Paths.Name, Namespace: r.Paths.Namespace},
+			PropagateTemplates: r.PropagateTemplates,
+		})
+	}
+	for _, c := range src.Context {
+		dst.Context = append(dst.Context, IntegrationApiContextSpec{
+			Name:    c.Name,
+			Request: IntegrationApiContextRequestSpec{Method: c.Request.Method, Path: c.Request.Path},
+		})
+	}
+	if src.Templates != nil {
+		dst.Templates = make([]IntegrationApiTemplatesSpec, 0, len(src.Templates))
+	}
+	for _, t := range src.Templates {
+		dst.Templates = append(dst.Templates, IntegrationApiTemplatesSpec{Operation: t.Operation, Path: t.Path, Environment: t.Environment})
+	}
+	if src.Hashes != nil {
+		dst.Hashes = make([]IntegrationApiHashSpec, 0, len(src.Hashes))
+	}
+	for _, h := range src.Hashes {
+		dst.Hashes = append(dst.Hashes, IntegrationApiHashSpec{Path: h.Path, Hash: h.Hash})
+	}
+	return dst
+}
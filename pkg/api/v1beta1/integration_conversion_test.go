@@ -0,0 +1,125 @@
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// hubIntegration returns a v1 Integration with a spec that v1beta1 can
+// represent and one that uses v1 fields.
+func hubIntegration() *v1.Integration {
+	return &v1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "integrations", Namespace: "default", Labels: map[string]string{"team": "ml"}},
+		Spec: []v1.IntegrationSpec{
+			{
+				Group:   "model.skippy.io",
+				Version: "v1",
+				Kind:    "Agent",
+				References: []v1.IntegrationApiReferenceSpec{{
+					Group: "model.skippy.io", Version: "v1", Kind: "ModelData",
+					Paths:              v1.IntegrationApiReferencePathSpec{Name: "spec.model", Namespace: "metadata.namespace"},
+					PropagateTemplates: true,
+				}},
+				Context:   []v1.IntegrationApiContextSpec{{Name: "model", Request: v1.IntegrationApiContextRequestSpec{Method: "GET", Path: "https://example.com"}}},
+				Templates: []v1.IntegrationApiTemplatesSpec{{Operation: "template", Path: "embedded:/v1/agent/template"}},
+				Hashes:    []v1.IntegrationApiHashSpec{},
+			},
+			{
+				Group:      "model.skippy.io",
+				Version:    "v1",
+				Kind:       "ModelServer",
+				Templates:  []v1.IntegrationApiTemplatesSpec{{Operation: "overlay", Path: "gcs:/bucket/prod", Environment: "prod"}},
+				Hashes:     []v1.IntegrationApiHashSpec{{Path: "gcs:/bucket/prod", Hash: "abc"}},
+				Budget:     corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("8")},
+				Autoscaler: "KEDA",
+				Rollout:    &v1.IntegrationRolloutSpec{Strategy: "Canary", CanaryPercent: 20},
+				Values:     &apiextensionsv1.JSON{Raw: []byte(`{"monitoring":true}`)},
+			},
+		},
+		Status: v1.IntegrationStatus{Ready: true},
+	}
+}
+
+func TestIntegrationConversion(t *testing.T) {
+	t.Run("round trips through v1beta1", func(t *testing.T) {
+		hub := hubIntegration()
+		spoke := &Integration{}
+		require.NoError(t, spoke.ConvertFrom(hub))
+		assert.Contains(t, spoke.Annotations, ConversionDataAnnotation)
+		assert.Equal(t, "ml", spoke.Labels["team"])
+		require.Len(t, spoke.Spec, 2)
+		assert.Equal(t, "prod", spoke.Spec[1].Templates[0].Environment)
+		assert.True(t, spoke.Status.Ready)
+
+		converted := &v1.Integration{}
+		require.NoError(t, spoke.ConvertTo(converted))
+		assert.NotContains(t, converted.Annotations, ConversionDataAnnotation)
+		assert.Equal(t, hub, converted)
+	})
+
+	t.Run("specs that v1beta1 represents are not annotated", func(t *testing.T) {
+		hub := hubIntegration()
+		hub.Spec = hub.Spec[:1]
+		spoke := &Integration{}
+		require.NoError(t, spoke.ConvertFrom(hub))
+		assert.NotContains(t, spoke.Annotations, ConversionDataAnnotation)
+
+		converted := &v1.Integration{}
+		require.NoError(t, spoke.ConvertTo(converted))
+		assert.Equal(t, hub, converted)
+	})
+
+	t.Run("v1beta1 changes keep the v1 fields", func(t *testing.T) {
+		spoke := &Integration{}
+		require.NoError(t, spoke.ConvertFrom(hubIntegration()))
+		spoke.Spec = spoke.Spec[1:]
+		spoke.Spec[0].Hashes = nil
+		spoke.Spec = append(spoke.Spec, IntegrationSpec{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint", Templates: []IntegrationApiTemplatesSpec{}})
+
+		converted := &v1.Integration{}
+		require.NoError(t, spoke.ConvertTo(converted))
+		require.Len(t, converted.Spec, 2)
+		assert.Equal(t, "ModelServer", converted.Spec[0].Kind)
+		assert.Empty(t, converted.Spec[0].Hashes)
+		assert.Equal(t, "KEDA", converted.Spec[0].Autoscaler)
+		assert.Equal(t, "Canary", converted.Spec[0].Rollout.Strategy)
+		assert.Equal(t, v1.IntegrationSpec{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint", Templates: []v1.IntegrationApiTemplatesSpec{}}, converted.Spec[1])
+	})
+
+	t.Run("template selectors of references round trip", func(t *testing.T) {
+		hub := hubIntegration()
+		hub.Spec = hub.Spec[:1]
+		hub.Spec[0].References[0].PropagateTemplatePaths = []string{"embedded:/v1/modeldata/monitoring"}
+		spoke := &Integration{}
+		require.NoError(t, spoke.ConvertFrom(hub))
+		assert.Contains(t, spoke.Annotations, ConversionDataAnnotation)
+
+		converted := &v1.Integration{}
+		require.NoError(t, spoke.ConvertTo(converted))
+		assert.Equal(t, hub, converted)
+	})
+
+	t.Run("invalid conversion data", func(t *testing.T) {
+		spoke := &Integration{ObjectMeta: metav1.ObjectMeta{Name: "integrations", Annotations: map[string]string{ConversionDataAnnotation: "{"}}}
+		assert.ErrorContains(t, spoke.ConvertTo(&v1.Integration{}), ConversionDataAnnotation)
+	})
+}
+
+func TestIntegrationIsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1.AddToScheme(scheme))
+	require.NoError(t, AddToScheme(scheme))
+	convertible, err := conversion.IsConvertible(scheme, &v1.Integration{})
+	require.NoError(t, err)
+	assert.True(t, convertible)
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// recordAcceleratorSelection copies the accelerator chosen by the
+// selectAccelerator template function into status.accelerator of the target.
+// Templates report the choice through annotations on the workload using it.
+func recordAcceleratorSelection(target *unstructured.Unstructured, objs []*unstructured.Unstructured) {
+	for _, obj := range objs {
+		annotations := obj.GetAnnotations()
+		accelerator := annotations[transformer.AcceleratorAnnotation]
+		if accelerator == "" {
+			continue
+		}
+		status := map[string]interface{}{"type": accelerator}
+		if rationale := annotations[transformer.AcceleratorRationaleAnnotation]; rationale != "" {
+			status["rationale"] = rationale
+		}
+		_ = unstructured.SetNestedField(target.Object, status, "status", "accelerator")
+		return
+	}
+	unstructured.RemoveNestedField(target.Object, "status", "accelerator")
+}
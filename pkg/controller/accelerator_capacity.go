@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	InsufficientAcceleratorReason = "InsufficientAccelerator"
+	AcceleratorSufficientReason   = "AcceleratorSufficient"
+
+	// acceleratorMemoryHeadroom is the share of accelerator memory that the
+	// weights of a model may take; servers need the rest for activations and
+	// at least a minimal KV cache.
+	acceleratorMemoryHeadroom = 0.9
+)
+
+// acceleratorCapability describes one accelerator type: the memory of each
+// device, how many GPUs a node has at most, and the slice topologies of TPUs.
+type acceleratorCapability struct {
+	memoryGiB  float64
+	maxPerNode int64
+	topologies []string
+}
+
+var (
+	tpuTopologies2D = []string{"1x1", "2x2", "2x4", "4x4", "4x8", "8x8", "8x16", "16x16"}
+	tpuTopologies3D = []string{"2x2x1", "2x2x2", "2x2x4", "2x4x4", "4x4x4", "4x4x8", "4x8x8", "8x8x8", "8x8x16", "8x16x16"}
+)
+
+// acceleratorCapabilities is the built-in capability matrix of the GKE
+// accelerator types, keyed by the value of their node label.
+var acceleratorCapabilities = map[string]acceleratorCapability{
+	"nvidia-tesla-p4":       {memoryGiB: 8, maxPerNode: 4},
+	"nvidia-tesla-t4":       {memoryGiB: 16, maxPerNode: 4},
+	"nvidia-tesla-p100":     {memoryGiB: 16, maxPerNode: 4},
+	"nvidia-tesla-v100":     {memoryGiB: 16, maxPerNode: 8},
+	"nvidia-l4":             {memoryGiB: 24, maxPerNode: 8},
+	"nvidia-tesla-a100":     {memoryGiB: 40, maxPerNode: 16},
+	"nvidia-a100-80gb":      {memoryGiB: 80, maxPerNode: 8},
+	"nvidia-h100-80gb":      {memoryGiB: 80, maxPerNode: 8},
+	"nvidia-h100-mega-80gb": {memoryGiB: 80, maxPerNode: 8},
+	"nvidia-h200-141gb":     {memoryGiB: 141, maxPerNode: 8},
+	"nvidia-b200":           {memoryGiB: 180, maxPerNode: 8},
+	"tpu-v4-podslice":       {memoryGiB: 32, topologies: tpuTopologies3D},
+	"tpu-v5-lite-podslice":  {memoryGiB: 16, topologies: tpuTopologies2D},
+	"tpu-v5p-slice":         {memoryGiB: 95, topologies: tpuTopologies3D},
+	"tpu-v6e-slice":         {memoryGiB: 32, topologies: tpuTopologies2D},
+}
+
+// quantizationBytes is the size of a parameter in each quantization; models
+// are assumed to be served in 16 bits otherwise.
+var quantizationBytes = map[string]float64{
+	"fp8":  1,
+	"int8": 1,
+	"int4": 0.5,
+	"awq":  0.5,
+	"gptq": 0.5,
+}
+
+// modelSizePattern matches the parameter count in model names, e.g. 70B in
+// Llama-3.1-70B-Instruct or 8x7B in Mixtral-8x7B.
+var modelSizePattern = regexp.MustCompile(`(?i)(?:^|[-_.])(?:(\d+)x)?(\d+(?:\.\d+)?)([bm])(?:$|[-_.])`)
+
+// AcceleratorCapacityError is returned when the accelerators that a resource
+// requests cannot serve its model, so that its pods would run out of memory
+// or never schedule.
+type AcceleratorCapacityError struct {
+	Message string
+}
+
+func (e *AcceleratorCapacityError) Error() string {
+	return e.Message
+}
+
+// parseModelParameters returns the number of parameters of a size like 70B,
+// 8x7B or 500M, or false if s has none.
+func parseModelParameters(s string) (float64, bool) {
+	match := modelSizePattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, false
+	}
+	parameters, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return 0, false
+	}
+	if match[1] != "" {
+		experts, _ := strconv.ParseFloat(match[1], 64)
+		parameters *= experts
+	}
+	if strings.EqualFold(match[3], "b") {
+		return parameters * 1e9, true
+	}
+	return parameters * 1e6, true
+}
+
+// modelWeightsGiB estimates the accelerator memory that the weights of the
+// model of target take, from spec.model.parameters or else the size in
+// spec.model.modelName, and spec.model.quantization or else a quantization
+// named in the model name. It returns the model name and false if the size is
+// unknown.
+func modelWeightsGiB(target *unstructured.Unstructured) (string, float64, bool) {
+	modelName, _, _ := unstructured.NestedString(target.Object, "spec", "model", "modelName")
+	name := path.Base(modelName)
+	size, _, _ := unstructured.NestedString(target.Object, "spec", "model", "parameters")
+	if size == "" {
+		size = name
+	}
+	parameters, ok := parseModelParameters(size)
+	if !ok {
+		return name, 0, false
+	}
+
+	bytes := 2.0
+	quantization, _, _ := unstructured.NestedString(target.Object, "spec", "model", "quantization")
+	if quantization != "" {
+		if b, ok := quantizationBytes[strings.ToLower(quantization)]; ok {
+			bytes = b
+		}
+	} else {
+		for _, token := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			if b, ok := quantizationBytes[token]; ok {
+				bytes = b
+				break
+			}
+		}
+	}
+	return name, parameters * bytes / (1 << 30), true
+}
+
+// acceleratorInt reads a positive integer that may also be a string, like
+// spec.inferenceServer.resources.gpuCount.
+func acceleratorInt(target *unstructured.Unstructured, fields ...string) (int64, bool, error) {
+	value, found, _ := unstructured.NestedFieldNoCopy(target.Object, fields...)
+	if !found || value == nil {
+		return 0, false, nil
+	}
+	var parsed int64
+	switch value := value.(type) {
+	case int64:
+		parsed = value
+	case float64:
+		if value == math.Trunc(value) {
+			parsed = int64(value)
+		}
+	case string:
+		parsed, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if parsed <= 0 {
+		return 0, false, &AcceleratorCapacityError{Message: fmt.Sprintf("%s must be a positive integer, not %v", strings.Join(fields, "."), value)}
+	}
+	return parsed, true, nil
+}
+
+// tensorParallelSize returns spec.inferenceServer.tensorParallelSize, or else
+// the --tensor-parallel-size of its args, or 0 if neither is set.
+func tensorParallelSize(target *unstructured.Unstructured) (int64, error) {
+	size, found, err := acceleratorInt(target, "spec", "inferenceServer", "tensorParallelSize")
+	if err != nil || found {
+		return size, err
+	}
+	args, _, _ := unstructured.NestedSlice(target.Object, "spec", "inferenceServer", "args")
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(fmt.Sprint(arg), "--tensor-parallel-size="); ok {
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > 0 {
+				return size, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// checkAcceleratorCapacity validates spec.accelerator of target against the
+// capability matrix: the GPUs of spec.inferenceServer.resources.gpuCount must
+// fit on one node and cover the tensor parallelism, TPU slices must have a
+// topology of the type, and the weights of the model must fit in their
+// memory. Accelerators that are not in the matrix are not checked.
+func checkAcceleratorCapacity(target *unstructured.Unstructured) error {
+	accelerator, _, _ := unstructured.NestedString(target.Object, "spec", "accelerator")
+	if accelerator == "" {
+		accelerator, _, _ = unstructured.NestedString(target.Object, "spec", "inferenceServer", "resources", "gpuType")
+	}
+	capability, ok := acceleratorCapabilities[accelerator]
+	if !ok {
+		return nil
+	}
+
+	var count int64 = 1
+	if capability.topologies != nil {
+		topology, _, _ := unstructured.NestedString(target.Object, "spec", "inferenceServer", "resources", "tpuTopology")
+		if topology != "" {
+			if !slices.Contains(capability.topologies, topology) {
+				return &AcceleratorCapacityError{Message: fmt.Sprintf("%s has no topology %s, supported topologies are %s", accelerator, topology, strings.Join(capability.topologies, ", "))}
+			}
+			for _, dimension := range strings.Split(topology, "x") {
+				chips, _ := strconv.ParseInt(dimension, 10, 64)
+				count *= chips
+			}
+		}
+	} else {
+		gpuCount, found, err := acceleratorInt(target, "spec", "inferenceServer", "resources", "gpuCount")
+		if err != nil {
+			return err
+		}
+		if found {
+			count = gpuCount
+		}
+		if count > capability.maxPerNode {
+			return &AcceleratorCapacityError{Message: fmt.Sprintf("%dx %s do not fit on one node, which has at most %d", count, accelerator, capability.maxPerNode)}
+		}
+		tpSize, err := tensorParallelSize(target)
+		if err != nil {
+			return err
+		}
+		if tpSize > count {
+			return &AcceleratorCapacityError{Message: fmt.Sprintf("a tensor parallel size of %d needs %d accelerators, but %dx %s are requested", tpSize, tpSize, count, accelerator)}
+		}
+	}
+
+	model, weightsGiB, ok := modelWeightsGiB(target)
+	if !ok {
+		return nil
+	}
+	memoryGiB := capability.memoryGiB * float64(count)
+	if weightsGiB > memoryGiB*acceleratorMemoryHeadroom {
+		return &AcceleratorCapacityError{Message: fmt.Sprintf("%s does not fit on %dx %s: its weights need about %.0f GiB, and at most %.0f GiB of the %.0f GiB of accelerator memory can hold weights", model, count, accelerator, math.Ceil(weightsGiB), math.Floor(memoryGiB*acceleratorMemoryHeadroom), memoryGiB)}
+	}
+	return nil
+}
+
+// validateAcceleratorCapacity sets the SpecInvalid condition of the target
+// when its accelerators cannot serve its model, before the templates are
+// rendered, so that the mistake surfaces as a descriptive condition instead
+// of pods that run out of memory or never schedule. The condition is cleared
+// once the accelerators fit.
+func (r *GenericReconciler) validateAcceleratorCapacity(target *unstructured.Unstructured) error {
+	err := checkAcceleratorCapacity(target)
+	existing := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	if err == nil {
+		if existing == nil || existing.Reason != InsufficientAcceleratorReason {
+			return nil
+		}
+		return setTargetCondition(target, metav1.Condition{
+			Type:               SpecInvalidConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             AcceleratorSufficientReason,
+			Message:            "The accelerators can serve the model.",
+			ObservedGeneration: target.GetGeneration(),
+		})
+	}
+
+	message := fmt.Sprintf("Not rendering %s %s: %v", target.GetKind(), target.GetName(), err)
+	if existing == nil || existing.Status != metav1.ConditionTrue || existing.Message != message {
+		r.eventf(target, corev1.EventTypeWarning, SpecInvalidEvent, "%s", message)
+	}
+	if conditionErr := setTargetCondition(target, metav1.Condition{
+		Type:               SpecInvalidConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             InsufficientAcceleratorReason,
+		Message:            message,
+		ObservedGeneration: target.GetGeneration(),
+	}); conditionErr != nil {
+		return conditionErr
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestCapacityTarget(accelerator, modelName string, resources map[string]interface{}) *unstructured.Unstructured {
+	target := newTestResource("llama", "default", eventTestGVK)
+	target.Object["spec"] = map[string]interface{}{
+		"accelerator":     accelerator,
+		"inferenceServer": map[string]interface{}{"type": "vLLM", "resources": resources},
+		"model":           map[string]interface{}{"modelName": modelName},
+	}
+	return target
+}
+
+func TestParseModelParameters(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		parameters float64
+	}{
+		{"Llama-3.1-70B-Instruct", 70e9},
+		{"gemma-2-9b-it", 9e9},
+		{"Mixtral-8x7B-v0.1", 56e9},
+		{"Qwen2.5-0.5B", 0.5e9},
+		{"bert-350m", 350e6},
+		{"405B", 405e9},
+	} {
+		parameters, ok := parseModelParameters(test.name)
+		require.True(t, ok, test.name)
+		assert.InDelta(t, test.parameters, parameters, 1, test.name)
+	}
+	_, ok := parseModelParameters("Llama-3.1")
+	assert.False(t, ok)
+}
+
+func TestCheckAcceleratorCapacity(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		target *unstructured.Unstructured
+		err    string
+	}{
+		{
+			name:   "fits",
+			target: newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-8B-Instruct", map[string]interface{}{"gpuCount": "1"}),
+		},
+		{
+			name:   "too large",
+			target: newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-70B-Instruct", map[string]interface{}{"gpuCount": "1"}),
+			err:    "Llama-3.1-70B-Instruct does not fit on 1x nvidia-l4: its weights need about 131 GiB, and at most 21 GiB of the 24 GiB of accelerator memory can hold weights",
+		},
+		{
+			name:   "sharded",
+			target: newTestCapacityTarget("nvidia-h100-80gb", "meta-llama/Llama-3.1-70B-Instruct", map[string]interface{}{"gpuCount": int64(2)}),
+		},
+		{
+			name:   "quantized",
+			target: newTestCapacityTarget("nvidia-l4", "RedHatAI/Meta-Llama-3.1-70B-Instruct-FP8", map[string]interface{}{"gpuCount": "4"}),
+		},
+		{
+			name:   "too many GPUs",
+			target: newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-8B-Instruct", map[string]interface{}{"gpuCount": "16"}),
+			err:    "16x nvidia-l4 do not fit on one node, which has at most 8",
+		},
+		{
+			name:   "invalid GPU count",
+			target: newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-8B-Instruct", map[string]interface{}{"gpuCount": "two"}),
+			err:    "spec.inferenceServer.resources.gpuCount must be a positive integer, not two",
+		},
+		{
+			name:   "TPU topology",
+			target: newTestCapacityTarget("tpu-v6e-slice", "meta-llama/Llama-3.1-8B-Instruct", map[string]interface{}{"tpuTopology": "3x3"}),
+			err:    "tpu-v6e-slice has no topology 3x3",
+		},
+		{
+			name:   "TPU slice",
+			target: newTestCapacityTarget("tpu-v6e-slice", "meta-llama/Llama-3.1-70B-Instruct", map[string]interface{}{"tpuTopology": "2x4"}),
+		},
+		{
+			name:   "unknown accelerator",
+			target: newTestCapacityTarget("nvidia-future", "meta-llama/Llama-3.1-405B", map[string]interface{}{"gpuCount": "1"}),
+		},
+		{
+			name:   "unknown model size",
+			target: newTestCapacityTarget("nvidia-l4", "my-org/assistant", map[string]interface{}{"gpuCount": "1"}),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAcceleratorCapacity(test.target)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var capacityErr *AcceleratorCapacityError
+			require.True(t, stderrors.As(err, &capacityErr), "%v", err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	t.Run("tensor parallelism", func(t *testing.T) {
+		target := newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-8B-Instruct", map[string]interface{}{"gpuCount": "2"})
+		unstructured.SetNestedSlice(target.Object, []interface{}{"--tensor-parallel-size=4"}, "spec", "inferenceServer", "args")
+		assert.EqualError(t, checkAcceleratorCapacity(target), "a tensor parallel size of 4 needs 4 accelerators, but 2x nvidia-l4 are requested")
+
+		unstructured.SetNestedField(target.Object, int64(2), "spec", "inferenceServer", "tensorParallelSize")
+		assert.NoError(t, checkAcceleratorCapacity(target))
+	})
+
+	t.Run("explicit size", func(t *testing.T) {
+		target := newTestCapacityTarget("nvidia-l4", "my-org/assistant", map[string]interface{}{"gpuCount": "1"})
+		unstructured.SetNestedField(target.Object, "70B", "spec", "model", "parameters")
+		assert.ErrorContains(t, checkAcceleratorCapacity(target), "assistant does not fit on 1x nvidia-l4")
+
+		unstructured.SetNestedField(target.Object, "int4", "spec", "model", "quantization")
+		unstructured.SetNestedField(target.Object, "4", "spec", "inferenceServer", "resources", "gpuCount")
+		assert.NoError(t, checkAcceleratorCapacity(target))
+	})
+}
+
+func TestValidateAcceleratorCapacity(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	target := newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-70B-Instruct", map[string]interface{}{"gpuCount": "1"})
+
+	err := r.validateAcceleratorCapacity(target)
+	var capacityErr *AcceleratorCapacityError
+	require.True(t, stderrors.As(err, &capacityErr))
+	assert.Equal(t, ValidationError, classifyError(err))
+	condition := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "True", string(condition.Status))
+	assert.Equal(t, InsufficientAcceleratorReason, condition.Reason)
+	assert.Contains(t, condition.Message, "Llama-3.1-70B-Instruct does not fit on 1x nvidia-l4")
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning SpecInvalid")
+
+	// The event is only recorded when the condition changes.
+	require.Error(t, r.validateAcceleratorCapacity(target))
+	assert.Empty(t, recorder.Events)
+
+	conditions, err := (&GenericReconciler{}).buildConditions(context.Background(), newTestResource("llama", "default", eventTestGVK), true, capacityErr)
+	require.NoError(t, err)
+	require.Len(t, conditions, 1)
+	assert.Equal(t, SpecInvalidReason, conditions[0].(map[string]interface{})["reason"])
+
+	unstructured.SetNestedField(target.Object, "nvidia-h100-80gb", "spec", "accelerator")
+	unstructured.SetNestedField(target.Object, "2", "spec", "inferenceServer", "resources", "gpuCount")
+	require.NoError(t, r.validateAcceleratorCapacity(target))
+	condition = meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "False", string(condition.Status))
+	assert.Equal(t, AcceleratorSufficientReason, condition.Reason)
+
+	// Targets that never had the condition do not get one.
+	other := newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-8B-Instruct", nil)
+	require.NoError(t, r.validateAcceleratorCapacity(other))
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), SpecInvalidConditionType))
+}
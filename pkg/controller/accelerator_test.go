@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestRecordAcceleratorSelection(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", gvk)
+
+	service := newTestResource("svc", "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+	deployment := newTestResource("vllm", "default", schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	deployment.SetAnnotations(map[string]string{
+		transformer.AcceleratorAnnotation:          "nvidia-l4",
+		transformer.AcceleratorRationaleAnnotation: "nvidia-l4 is the lowest-performance match",
+	})
+
+	recordAcceleratorSelection(target, []*unstructured.Unstructured{service, deployment})
+	accelerator, found, err := unstructured.NestedStringMap(target.Object, "status", "accelerator")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{"type": "nvidia-l4", "rationale": "nvidia-l4 is the lowest-performance match"}, accelerator)
+
+	// A stale selection is removed once no workload reports one.
+	recordAcceleratorSelection(target, []*unstructured.Unstructured{service})
+	_, found, _ = unstructured.NestedFieldNoCopy(target.Object, "status", "accelerator")
+	assert.False(t, found)
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// AdoptionPolicy controls which pre-existing objects with the name of a
+// rendered dependent are adopted, i.e. get the owner reference and labels of
+// the target and are updated to the rendered state from then on.
+type AdoptionPolicy string
+
+const (
+	// AdoptUnmanaged adopts objects that are neither controlled by another
+	// resource nor labeled as managed by another tool, and objects of other
+	// tools that are annotated with AdoptAnnotation.
+	AdoptUnmanaged AdoptionPolicy = "unmanaged"
+	// AdoptAnnotated only adopts objects that are annotated with
+	// AdoptAnnotation.
+	AdoptAnnotated AdoptionPolicy = "annotated"
+
+	// AdoptAnnotation set to "true" on a pre-existing object, e.g. a
+	// Deployment that Helm created, lets karo adopt it. Objects controlled by
+	// another resource are never adopted.
+	AdoptAnnotation = "karo.gke.io/adopt"
+
+	DependentAdoptedEvent = modelv1.EventReasonDependentAdopted
+)
+
+// ParseAdoptionPolicy validates an adoption flag value.
+func ParseAdoptionPolicy(value string) (AdoptionPolicy, error) {
+	switch AdoptionPolicy(value) {
+	case "", AdoptUnmanaged:
+		return AdoptUnmanaged, nil
+	case AdoptAnnotated:
+		return AdoptAnnotated, nil
+	}
+	return "", fmt.Errorf("invalid adoption policy %q (must be '%s' or '%s')", value, AdoptUnmanaged, AdoptAnnotated)
+}
+
+// isPreExisting reports whether existing, a live object with the name of a
+// dependent of target, was not created by karo: it has no controller and is
+// neither labeled as managed by karo nor as rendered for target.
+func isPreExisting(existing, target *unstructured.Unstructured) bool {
+	if metav1.GetControllerOf(existing) != nil {
+		return false
+	}
+	labels := existing.GetLabels()
+	return labels[ManagedByLabel] != ManagedByValue && labels[OwnerUIDLabel] != string(target.GetUID())
+}
+
+// adoptionRefused returns why the pre-existing object existing cannot be
+// adopted for target, or an empty string if it can be, or was created by
+// karo.
+func (r *GenericReconciler) adoptionRefused(existing, target *unstructured.Unstructured) string {
+	if !isPreExisting(existing, target) || existing.GetAnnotations()[AdoptAnnotation] == "true" {
+		return ""
+	}
+	if manager, ok := existing.GetLabels()[ManagedByLabel]; ok {
+		return "is managed by " + manager
+	}
+	if r.Adoption == AdoptAnnotated {
+		return fmt.Sprintf("already exists and is not annotated with %s=true", AdoptAnnotation)
+	}
+	return ""
+}
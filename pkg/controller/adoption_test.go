@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseAdoptionPolicy(t *testing.T) {
+	for value, want := range map[string]AdoptionPolicy{"": AdoptUnmanaged, "unmanaged": AdoptUnmanaged, "annotated": AdoptAnnotated} {
+		policy, err := ParseAdoptionPolicy(value)
+		require.NoError(t, err)
+		assert.Equal(t, want, policy)
+	}
+	_, err := ParseAdoptionPolicy("always")
+	assert.EqualError(t, err, `invalid adoption policy "always" (must be 'unmanaged' or 'annotated')`)
+}
+
+func TestIsPreExisting(t *testing.T) {
+	target := newTestResource("llama", "default", eventTestGVK)
+	target.SetUID("target-uid")
+	isController := true
+	service := func(labels map[string]string) *unstructured.Unstructured {
+		obj := newTestResource("llama", "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	assert.True(t, isPreExisting(service(nil), target))
+	assert.True(t, isPreExisting(service(map[string]string{ManagedByLabel: "Helm"}), target))
+	assert.False(t, isPreExisting(service(map[string]string{ManagedByLabel: ManagedByValue}), target))
+	assert.False(t, isPreExisting(service(map[string]string{OwnerUIDLabel: "target-uid"}), target), "retained dependents have no owner")
+	owned := service(nil)
+	owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "TestResource", Name: "other", UID: "other-uid", Controller: &isController}})
+	assert.False(t, isPreExisting(owned, target))
+}
+
+func TestCheckNameCollisionsAdoption(t *testing.T) {
+	target := newTestResource("mine", "default", eventTestGVK)
+	target.SetUID("target-uid")
+	service := func(name string, labels, annotations map[string]string) *unstructured.Unstructured {
+		obj := newTestResource(name, "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+		obj.SetLabels(labels)
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	adopt := map[string]string{AdoptAnnotation: "true"}
+	helm := map[string]string{ManagedByLabel: "Helm"}
+	live := map[string]*unstructured.Unstructured{
+		"unowned":      service("unowned", nil, nil),
+		"annotated":    service("annotated", nil, adopt),
+		"helm":         service("helm", helm, nil),
+		"helm-adopted": service("helm-adopted", helm, adopt),
+		"karo":         service("karo", map[string]string{ManagedByLabel: ManagedByValue}, nil),
+	}
+	rc := &MockResourceClient{
+		GetFunc: func(_ context.Context, _ schema.GroupVersionKind, _, name string) (*unstructured.Unstructured, error) {
+			if obj, ok := live[name]; ok {
+				return obj.DeepCopy(), nil
+			}
+			return nil, errors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+		},
+	}
+	rendered := func(names ...string) []*unstructured.Unstructured {
+		var objs []*unstructured.Unstructured
+		for _, name := range names {
+			objs = append(objs, service(name, nil, nil))
+		}
+		return objs
+	}
+	collisions := func(err error) []string {
+		var collisionErr *NameCollisionError
+		if !stderrors.As(err, &collisionErr) {
+			return nil
+		}
+		return collisionErr.Collisions
+	}
+
+	t.Run("unmanaged objects and annotated objects of other tools are adopted", func(t *testing.T) {
+		r := &GenericReconciler{}
+		err := r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("unowned", "annotated", "helm", "helm-adopted", "karo", "new"), rc)
+		assert.Equal(t, []string{"Service default/helm is managed by Helm"}, collisions(err))
+	})
+
+	t.Run("only annotated objects are adopted", func(t *testing.T) {
+		r := &GenericReconciler{Adoption: AdoptAnnotated}
+		err := r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("unowned", "annotated", "helm", "helm-adopted", "karo", "new"), rc)
+		assert.Equal(t, []string{
+			"Service default/unowned already exists and is not annotated with karo.gke.io/adopt=true",
+			"Service default/helm is managed by Helm",
+		}, collisions(err))
+	})
+}
+
+func TestReconcileGenericAdoption(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	token := "my-secret-token-123"
+	target := newTestResource("llama", "default", eventTestGVK)
+	target.SetUID("target-uid")
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	var updated []*unstructured.Unstructured
+	rc := &MockResourceClient{
+		UpdateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			updated = append(updated, obj)
+			return obj, nil
+		},
+	}
+	desired := func() *unstructured.Unstructured {
+		obj := newUnstructuredSecret(t, "test-secret", &token)
+		setLabels(obj, map[string]string{ManagedByLabel: ManagedByValue, OwnerUIDLabel: "target-uid"})
+		return obj
+	}
+
+	// The labels of the target are set on the pre-existing object, which
+	// loses the adopt annotation.
+	existing := newUnstructuredSecret(t, "test-secret", &token)
+	existing.SetAnnotations(map[string]string{AdoptAnnotation: "true"})
+	_, err := r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", existing, desired(), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	assert.Equal(t, "target-uid", updated[0].GetLabels()[OwnerUIDLabel])
+	assert.Empty(t, updated[0].GetAnnotations())
+	require.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "Normal DependentUpdated")
+	assert.Equal(t, "Normal DependentAdopted Adopted existing Secret default/test-secret for TestResource llama", <-recorder.Events)
+
+	// Once adopted, they are no longer pre-existing.
+	_, err = r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", updated[0], desired(), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Len(t, updated, 1)
+	assert.Empty(t, recorder.Events)
+
+	// A pre-existing object that matches the render is adopted too.
+	updated = nil
+	unlabeled := newUnstructuredSecret(t, "test-secret", &token)
+	_, err = r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", unlabeled, newUnstructuredSecret(t, "test-secret", &token), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	require.Len(t, recorder.Events, 2)
+	<-recorder.Events
+	assert.Contains(t, <-recorder.Events, "Normal DependentAdopted")
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	SandboxCleanupStartedEvent = modelv1.EventReasonSandboxCleanupStarted
+	SandboxCleanupFailedEvent  = modelv1.EventReasonSandboxCleanupFailed
+
+	// scratchCleanupFinalizer holds the deletion of a sandbox that syncs
+	// artifacts to GCS until its cleanup Job has run.
+	scratchCleanupFinalizer    = "model.skippy.io/scratch-cleanup"
+	defaultScratchCleanupImage = "google/cloud-sdk:slim"
+	// scratchCleanupDeadline bounds how long a cleanup Job may hold the
+	// deletion of a sandbox.
+	scratchCleanupDeadline = int64(600)
+	scratchCleanupBackoff  = int32(3)
+)
+
+// scratchCleanupScript deletes every object under ARTIFACTS_URI. The URI is
+// passed through the environment so that it is never interpreted by the shell,
+// and a prefix without objects is not an error.
+const scratchCleanupScript = `if gcloud storage ls "${ARTIFACTS_URI}/**" > /dev/null 2>&1; then exec gcloud storage rm "${ARTIFACTS_URI}/**"; fi`
+
+// reconcileScratchCleanup keeps the cleanup finalizer on sandboxes whose
+// scratch artifacts are synced to GCS. Once such a sandbox is deleted, it runs
+// a Job that wipes the artifacts and releases the finalizer when the Job is
+// done. It returns done when the rest of the stateful logic must be skipped.
+func (asr *AgenticSandboxReconciler) reconcileScratchCleanup(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured) (result ctrl.Result, done bool, err error) {
+	logger := log.FromContext(ctx).WithValues("AgenticSandbox.Name", sandbox.GetName())
+
+	artifactsURI, _, _ := unstructured.NestedString(sandbox.Object, "spec", "scratch", "artifactsURI")
+	artifactsURI = strings.TrimSuffix(artifactsURI, "/")
+	hasFinalizer := controllerutil.ContainsFinalizer(sandbox, scratchCleanupFinalizer)
+
+	if sandbox.GetDeletionTimestamp().IsZero() {
+		switch {
+		case artifactsURI != "" && !hasFinalizer:
+			err = patchFinalizers(ctx, r.GetClient(), sandbox, func(obj client.Object) { controllerutil.AddFinalizer(obj, scratchCleanupFinalizer) })
+		case artifactsURI == "" && hasFinalizer:
+			err = patchFinalizers(ctx, r.GetClient(), sandbox, func(obj client.Object) { controllerutil.RemoveFinalizer(obj, scratchCleanupFinalizer) })
+		}
+		if err != nil {
+			logger.Error(err, "Failed to update the scratch cleanup finalizer.")
+		}
+		return ctrl.Result{}, false, err
+	}
+	if !hasFinalizer {
+		return ctrl.Result{}, false, nil
+	}
+
+	release := func() (ctrl.Result, bool, error) {
+		if err := patchFinalizers(ctx, r.GetClient(), sandbox, func(obj client.Object) { controllerutil.RemoveFinalizer(obj, scratchCleanupFinalizer) }); err != nil {
+			logger.Error(err, "Failed to remove the scratch cleanup finalizer.")
+			return ctrl.Result{}, true, err
+		}
+		return ctrl.Result{}, true, nil
+	}
+	if artifactsURI == "" {
+		return release()
+	}
+
+	jobName := sandbox.GetName() + "-scratch-cleanup"
+	job := &batchv1.Job{}
+	err = r.GetClient().Get(ctx, types.NamespacedName{Name: jobName, Namespace: sandbox.GetNamespace()}, job)
+	if errors.IsNotFound(err) {
+		job = newScratchCleanupJob(sandbox, jobName, artifactsURI)
+		if err := r.GetClient().Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			logger.Error(err, "Failed to create the scratch cleanup Job.")
+			return ctrl.Result{}, true, err
+		}
+		logger.Info("Started the scratch cleanup Job.", "Job.Name", jobName)
+		r.Eventf(sandbox, corev1.EventTypeNormal, SandboxCleanupStartedEvent, "Deleting the artifacts under %s with Job %s", artifactsURI, jobName)
+	} else if err != nil {
+		logger.Error(err, "Failed to get the scratch cleanup Job.")
+		return ctrl.Result{}, true, err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			logger.Info("The scratch cleanup Job completed.", "Job.Name", jobName)
+			return release()
+		case batchv1.JobFailed:
+			// Blocking the deletion forever would leave the sandbox stuck, so
+			// the failure is reported and the sandbox is released anyway.
+			logger.Info("The scratch cleanup Job failed.", "Job.Name", jobName, "reason", cond.Reason)
+			r.Eventf(sandbox, corev1.EventTypeWarning, SandboxCleanupFailedEvent, "Job %s failed to delete the artifacts under %s: %s", jobName, artifactsURI, cond.Message)
+			return release()
+		}
+	}
+
+	asr.updateStatusFields(sandbox, "Terminating", nil, nil)
+	unstructured.SetNestedField(sandbox.Object, jobName, "status", "cleanupJob")
+	return ctrl.Result{RequeueAfter: 5 * time.Second}, true, nil
+}
+
+// newScratchCleanupJob builds the Job that deletes the artifacts of a sandbox.
+// It is owned by the sandbox, so it is garbage collected with it.
+func newScratchCleanupJob(sandbox *unstructured.Unstructured, name, artifactsURI string) *batchv1.Job {
+	image, _, _ := unstructured.NestedString(sandbox.Object, "spec", "scratch", "cleanupImage")
+	if image == "" {
+		image = defaultScratchCleanupImage
+	}
+	serviceAccountName, _, _ := unstructured.NestedString(sandbox.Object, "spec", "scratch", "cleanupServiceAccountName")
+	labels := map[string]string{
+		"app.kubernetes.io/name":      "agentic-sandbox-cleanup",
+		"app.kubernetes.io/instance":  sandbox.GetName(),
+		"app.kubernetes.io/component": "scratch-cleanup",
+	}
+	backoffLimit := scratchCleanupBackoff
+	activeDeadlineSeconds := scratchCleanupDeadline
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       sandbox.GetNamespace(),
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(sandbox, sandbox.GroupVersionKind())},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &activeDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: serviceAccountName,
+					Containers: []corev1.Container{{
+						Name:    "cleanup",
+						Image:   image,
+						Command: []string{"/bin/sh", "-c", scratchCleanupScript},
+						Env:     []corev1.EnvVar{{Name: "ARTIFACTS_URI", Value: artifactsURI}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// patchFinalizers applies mutate to the finalizers of obj and patches them
+// with an optimistic lock. The patch is sent from a copy, so that the status
+// computed in memory is kept; only the new resource version is copied back.
+func patchFinalizers(ctx context.Context, c client.Client, obj *unstructured.Unstructured, mutate func(client.Object)) error {
+	original := obj.DeepCopy()
+	patched := obj.DeepCopy()
+	mutate(patched)
+	if err := c.Patch(ctx, patched, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("failed to patch the finalizers of %s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	obj.SetFinalizers(patched.GetFinalizers())
+	obj.SetResourceVersion(patched.GetResourceVersion())
+	return nil
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newScratchSandbox(artifactsURI string, finalizers ...string) *unstructured.Unstructured {
+	sandbox := makeTestSandbox("test-sandbox", "default", "Running", nil, nil)
+	sandbox.SetUID("sandbox-uid")
+	sandbox.SetFinalizers(finalizers)
+	scratch := map[string]interface{}{"sizeLimit": "10Gi"}
+	if artifactsURI != "" {
+		scratch["artifactsURI"] = artifactsURI
+	}
+	unstructured.SetNestedMap(sandbox.Object, scratch, "spec", "scratch")
+	return sandbox
+}
+
+func newScratchClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	require.NoError(t, batchv1.AddToScheme(s))
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func getScratchSandbox(t *testing.T, c client.Client) *unstructured.Unstructured {
+	t.Helper()
+	sandbox := &unstructured.Unstructured{}
+	sandbox.SetAPIVersion("model.skippy.io/v1")
+	sandbox.SetKind("AgenticSandbox")
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "test-sandbox", Namespace: "default"}, sandbox))
+	return sandbox
+}
+
+func TestReconcileScratchCleanup_AddsAndRemovesFinalizer(t *testing.T) {
+	sandbox := newScratchSandbox("gs://bucket/session/")
+	c := newScratchClient(t, sandbox.DeepCopy())
+	sandbox = getScratchSandbox(t, c)
+	asr := &AgenticSandboxReconciler{}
+	r := &GenericReconciler{Client: c}
+
+	_, done, err := asr.reconcileScratchCleanup(context.Background(), r, sandbox)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, []string{scratchCleanupFinalizer}, sandbox.GetFinalizers())
+	assert.Equal(t, []string{scratchCleanupFinalizer}, getScratchSandbox(t, c).GetFinalizers())
+	assert.Equal(t, "Running", sandbox.Object["status"].(map[string]interface{})["phase"], "the in-memory status must be kept")
+
+	// Dropping the artifacts URI drops the finalizer as well.
+	unstructured.RemoveNestedField(sandbox.Object, "spec", "scratch", "artifactsURI")
+	_, done, err = asr.reconcileScratchCleanup(context.Background(), r, sandbox)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Empty(t, getScratchSandbox(t, c).GetFinalizers())
+}
+
+func TestReconcileScratchCleanup_WithoutArtifacts(t *testing.T) {
+	sandbox := newScratchSandbox("")
+	c := newScratchClient(t, sandbox.DeepCopy())
+	sandbox = getScratchSandbox(t, c)
+
+	_, done, err := (&AgenticSandboxReconciler{}).reconcileScratchCleanup(context.Background(), &GenericReconciler{Client: c}, sandbox)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Empty(t, getScratchSandbox(t, c).GetFinalizers())
+}
+
+func TestReconcileScratchCleanup_Deletion(t *testing.T) {
+	testCases := []struct {
+		name            string
+		jobCondition    batchv1.JobConditionType
+		expectReleased  bool
+		expectedEvent   modelv1.EventReason
+		expectedResult  ctrl.Result
+		expectTerminate bool
+	}{
+		{
+			name:            "job still running",
+			expectedEvent:   SandboxCleanupStartedEvent,
+			expectedResult:  ctrl.Result{RequeueAfter: 5 * time.Second},
+			expectTerminate: true,
+		},
+		{
+			name:           "job completed",
+			jobCondition:   batchv1.JobComplete,
+			expectReleased: true,
+		},
+		{
+			name:           "job failed",
+			jobCondition:   batchv1.JobFailed,
+			expectReleased: true,
+			expectedEvent:  SandboxCleanupFailedEvent,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sandbox := newScratchSandbox("gs://bucket/session", scratchCleanupFinalizer, "example.com/other")
+			now := metav1.Now()
+			sandbox.SetDeletionTimestamp(&now)
+			objs := []client.Object{sandbox.DeepCopy()}
+			if tc.jobCondition != "" {
+				job := newScratchCleanupJob(sandbox, "test-sandbox-scratch-cleanup", "gs://bucket/session")
+				job.Status.Conditions = []batchv1.JobCondition{{Type: tc.jobCondition, Status: corev1.ConditionTrue, Message: "boom"}}
+				objs = append(objs, job)
+			}
+			c := newScratchClient(t, objs...)
+			recorder := record.NewFakeRecorder(10)
+			r := &GenericReconciler{Client: c, Recorder: recorder}
+			sandbox = getScratchSandbox(t, c)
+
+			result, done, err := (&AgenticSandboxReconciler{}).reconcileScratchCleanup(context.Background(), r, sandbox)
+			require.NoError(t, err)
+			assert.True(t, done)
+			assert.Equal(t, tc.expectedResult, result)
+
+			if tc.expectReleased {
+				assert.Equal(t, []string{"example.com/other"}, getScratchSandbox(t, c).GetFinalizers())
+			} else {
+				assert.Contains(t, getScratchSandbox(t, c).GetFinalizers(), scratchCleanupFinalizer)
+			}
+			if tc.expectTerminate {
+				phase, _, _ := unstructured.NestedString(sandbox.Object, "status", "phase")
+				assert.Equal(t, "Terminating", phase)
+				cleanupJob, _, _ := unstructured.NestedString(sandbox.Object, "status", "cleanupJob")
+				assert.Equal(t, "test-sandbox-scratch-cleanup", cleanupJob)
+			}
+			if tc.expectedEvent != "" {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, string(tc.expectedEvent))
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+
+			job := &batchv1.Job{}
+			require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "test-sandbox-scratch-cleanup", Namespace: "default"}, job))
+			require.Len(t, job.OwnerReferences, 1)
+			assert.Equal(t, types.UID("sandbox-uid"), job.OwnerReferences[0].UID)
+		})
+	}
+}
+
+func TestNewScratchCleanupJob(t *testing.T) {
+	sandbox := newScratchSandbox("gs://bucket/session")
+	unstructured.SetNestedField(sandbox.Object, "cleanup-sa", "spec", "scratch", "cleanupServiceAccountName")
+
+	job := newScratchCleanupJob(sandbox, "test-sandbox-scratch-cleanup", "gs://bucket/session")
+	podSpec := job.Spec.Template.Spec
+	require.Len(t, podSpec.Containers, 1)
+	assert.Equal(t, defaultScratchCleanupImage, podSpec.Containers[0].Image)
+	assert.Equal(t, "cleanup-sa", podSpec.ServiceAccountName)
+	assert.Equal(t, corev1.RestartPolicyNever, podSpec.RestartPolicy)
+	// The URI is passed through the environment, never through the script.
+	assert.NotContains(t, podSpec.Containers[0].Command[2], "gs://")
+	assert.Equal(t, []corev1.EnvVar{{Name: "ARTIFACTS_URI", Value: "gs://bucket/session"}}, podSpec.Containers[0].Env)
+	assert.Equal(t, scratchCleanupDeadline, *job.Spec.ActiveDeadlineSeconds)
+}
@@ -11,15 +11,22 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 )
 
 // AgenticSandboxReconciler implements the stateful logic for AgenticSandbox CRs.
 type AgenticSandboxReconciler struct{}
 
 // ReconcileStateful contains the state machine logic for an AgenticSandbox.
-func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *GenericReconciler, sandbox *unstructured.Unstructured) (ctrl.Result, error) {
+func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("AgenticSandbox.Name", sandbox.GetName())
 
+	// 0. Sandboxes that sync artifacts to GCS wipe them before they go away.
+	if result, done, err := asr.reconcileScratchCleanup(ctx, r, sandbox); done || err != nil {
+		return result, err
+	}
+
 	// 1. Get the current status from the sandbox object.
 	status, statusFound, _ := unstructured.NestedMap(sandbox.Object, "status")
 	if !statusFound {
@@ -32,16 +39,28 @@ func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *G
 
 	// 2. Check if the sandbox is already in a terminal "Running" state.
 	phase, _, _ := unstructured.NestedString(status, "phase")
-	if phase == "Running" {
+	podName, _, _ := unstructured.NestedString(status, "podName")
+	if phase == "Running" && podName == "" {
 		// The sandbox is up and running with its IP and port set.
 		// Our work here is done, no need to requeue unless the object changes.
+		// Sandboxes running on a claimed pool pod fall through so a lost pod is replaced.
 		return ctrl.Result{}, nil
 	}
 
-	// 3. Fetch the child Deployment to check its readiness.
+	// 3. Sandboxes whose class keeps a warm pool are served by claiming a pre-warmed pod.
+	className, err := asr.warmPoolClass(ctx, r, sandbox)
+	if err != nil {
+		logger.Error(err, "Failed to look up the sandbox class warm pool.")
+		return ctrl.Result{}, err
+	}
+	if className != "" {
+		return asr.reconcileFromPool(ctx, r, sandbox, className)
+	}
+
+	// 4. Fetch the child Deployment to check its readiness.
 	// The child Deployment has the same name and namespace as the sandbox CR.
 	deployment := &appsv1.Deployment{}
-	err := r.Client.Get(ctx, types.NamespacedName{Name: sandbox.GetName(), Namespace: sandbox.GetNamespace()}, deployment)
+	err = r.GetClient().Get(ctx, types.NamespacedName{Name: sandbox.GetName(), Namespace: sandbox.GetNamespace()}, deployment)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// The Deployment hasn't been created yet by the generic reconciler.
@@ -52,7 +71,7 @@ func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *G
 		return ctrl.Result{}, err
 	}
 
-	// 4. Determine the phase based on the Deployment's availability.
+	// 5. Determine the phase based on the Deployment's availability.
 	deploymentIsAvailable := false
 	for _, cond := range deployment.Status.Conditions {
 		if cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionTrue {
@@ -68,9 +87,9 @@ func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *G
 		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 	}
 
-	// 5. Fetch the child Service to get its ClusterIP and Port.
+	// 6. Fetch the child Service to get its ClusterIP and Port.
 	service := &corev1.Service{}
-	err = r.Client.Get(ctx, types.NamespacedName{Name: sandbox.GetName(), Namespace: sandbox.GetNamespace()}, service)
+	err = r.GetClient().Get(ctx, types.NamespacedName{Name: sandbox.GetName(), Namespace: sandbox.GetNamespace()}, service)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("Waiting for child Service to be created.")
@@ -80,7 +99,7 @@ func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *G
 		return ctrl.Result{}, err
 	}
 
-	// 6. The Deployment is ready and the Service exists. Update status to "Running".
+	// 7. The Deployment is ready and the Service exists. Update status to "Running".
 	logger.Info("Child Deployment is available. Updating status to Running.")
 	asr.updateStatusFields(sandbox, "Running", service, deployment)
 
@@ -88,6 +107,56 @@ func (asr *AgenticSandboxReconciler) ReconcileStateful(ctx context.Context, r *G
 	return ctrl.Result{}, nil
 }
 
+// reconcileFromPool claims a warm pool pod for the sandbox and reports it as
+// Running once the sandbox Service exists. Claiming relabels the pod so that the
+// Service selects it and the pool's ReplicaSet replaces it.
+func (asr *AgenticSandboxReconciler) reconcileFromPool(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured, className string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("AgenticSandbox.Name", sandbox.GetName(), "AgenticSandboxClass", className)
+
+	pod, err := asr.findClaimedPod(ctx, r, sandbox, className)
+	if err != nil {
+		logger.Error(err, "Failed to look up claimed warm pool pod.")
+		return ctrl.Result{}, err
+	}
+	if pod == nil && r.DryRun() {
+		// A dry-run claim leaves the pod in the pool, so no pod is recorded.
+		logger.Info("Dry run, not claiming a warm pool pod.")
+		asr.updateStatusFields(sandbox, "Pending", nil, nil)
+		unstructured.RemoveNestedField(sandbox.Object, "status", "podName")
+		return ctrl.Result{}, nil
+	}
+	if pod == nil {
+		pod, err = asr.claimPoolPod(ctx, r, sandbox, className)
+		if err != nil {
+			logger.Error(err, "Failed to claim warm pool pod.")
+			return ctrl.Result{}, err
+		}
+		if pod == nil {
+			logger.Info("No ready warm pool pod available, requeueing.")
+			asr.updateStatusFields(sandbox, "Pending", nil, nil)
+			unstructured.RemoveNestedField(sandbox.Object, "status", "podName")
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+		logger.Info("Claimed warm pool pod.", "Pod.Name", pod.Name)
+	}
+	unstructured.SetNestedField(sandbox.Object, pod.Name, "status", "podName")
+
+	service := &corev1.Service{}
+	err = r.GetClient().Get(ctx, types.NamespacedName{Name: sandbox.GetName(), Namespace: sandbox.GetNamespace()}, service)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("Waiting for child Service to be created.")
+			asr.updateStatusFields(sandbox, "Pending", nil, nil)
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+		logger.Error(err, "Failed to get child Service.")
+		return ctrl.Result{}, err
+	}
+
+	asr.updateStatusFields(sandbox, "Running", service, nil)
+	return ctrl.Result{}, nil
+}
+
 // updateStatusFields modifies the AgenticSandbox object in memory with the correct phase and connection details.
 func (asr *AgenticSandboxReconciler) updateStatusFields(sandbox *unstructured.Unstructured, phase string, service *corev1.Service, deployment *appsv1.Deployment) error {
 	status, _, _ := unstructured.NestedMap(sandbox.Object, "status")
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// sandboxPoolLabel marks idle warm pool pods with the name of their AgenticSandboxClass.
+	// It is part of the pool Deployment's selector, so removing it releases the pod from
+	// the ReplicaSet, which then backfills the pool.
+	sandboxPoolLabel = "sandbox.model.skippy.io/pool"
+	// sandboxClaimedFromLabel records which pool a claimed pod came from.
+	sandboxClaimedFromLabel = "sandbox.model.skippy.io/claimed-from"
+	// sandboxInstanceLabel is selected by the sandbox Service and NetworkPolicy.
+	sandboxInstanceLabel = "app.kubernetes.io/instance"
+
+	defaultWarmPoolNamespace = "default"
+)
+
+var agenticSandboxClassGVK = schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandboxClass"}
+
+// warmPoolClass returns the name of the sandbox's class if that class keeps a warm
+// pool in the sandbox's namespace, or an empty string if the sandbox has to be
+// started from its own Deployment.
+func (asr *AgenticSandboxReconciler) warmPoolClass(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured) (string, error) {
+	className, _, _ := unstructured.NestedString(sandbox.Object, "spec", "className")
+	if className == "" {
+		return "", nil
+	}
+
+	class := &unstructured.Unstructured{}
+	class.SetGroupVersionKind(agenticSandboxClassGVK)
+	if err := r.GetClient().Get(ctx, types.NamespacedName{Name: className}, class); err != nil {
+		if errors.IsNotFound(err) {
+			// The transformer reports the missing class; nothing to claim from.
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get AgenticSandboxClass %s: %w", className, err)
+	}
+
+	size, _, _ := unstructured.NestedInt64(class.Object, "spec", "warmPool", "size")
+	namespace, _, _ := unstructured.NestedString(class.Object, "spec", "warmPool", "namespace")
+	if namespace == "" {
+		namespace = defaultWarmPoolNamespace
+	}
+	if size <= 0 || namespace != sandbox.GetNamespace() {
+		return "", nil
+	}
+	return className, nil
+}
+
+// findClaimedPod returns the pool pod already claimed by the sandbox, if any.
+// Looking it up by label keeps claiming idempotent even if the status update
+// recording the claim was lost.
+func (asr *AgenticSandboxReconciler) findClaimedPod(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured, className string) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.GetClient().List(ctx, pods, client.InNamespace(sandbox.GetNamespace()), client.MatchingLabels{
+		sandboxClaimedFromLabel: className,
+		sandboxInstanceLabel:    sandbox.GetName(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list claimed pods: %w", err)
+	}
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// claimPoolPod assigns a ready pod from the class's warm pool to the sandbox.
+// It returns nil if no pod is currently available.
+func (asr *AgenticSandboxReconciler) claimPoolPod(ctx context.Context, r modelv1.KindReconcilerHost, sandbox *unstructured.Unstructured, className string) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.GetClient().List(ctx, pods, client.InNamespace(sandbox.GetNamespace()), client.MatchingLabels{sandboxPoolLabel: className}); err != nil {
+		return nil, fmt.Errorf("failed to list warm pool pods: %w", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !isPodReady(pod) {
+			continue
+		}
+
+		delete(pod.Labels, sandboxPoolLabel)
+		pod.Labels[sandboxClaimedFromLabel] = className
+		pod.Labels[sandboxInstanceLabel] = sandbox.GetName()
+		// The ReplicaSet still controls the pod until it notices the label change,
+		// so the sandbox can only be added as a non-controller owner.
+		pod.OwnerReferences = append(pod.OwnerReferences, metav1.OwnerReference{
+			APIVersion: sandbox.GetAPIVersion(),
+			Kind:       sandbox.GetKind(),
+			Name:       sandbox.GetName(),
+			UID:        sandbox.GetUID(),
+		})
+
+		if err := r.GetClient().Update(ctx, pod); err != nil {
+			if errors.IsConflict(err) || errors.IsNotFound(err) {
+				// Another sandbox claimed this pod first, or it went away. Try the next one.
+				continue
+			}
+			return nil, fmt.Errorf("failed to claim warm pool pod %s: %w", pod.Name, err)
+		}
+		return pod, nil
+	}
+	return nil, nil
+}
+
+// isPodReady returns true if the pod is running and passing its readiness probe.
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAgenticSandboxWarmPool(t *testing.T) {
+	const namespace = "default"
+	const sandboxName = "test-sandbox"
+	const className = "python"
+
+	newClient := func(objs ...client.Object) client.Client {
+		s := runtime.NewScheme()
+		_ = corev1.AddToScheme(s)
+		return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+	}
+	newSandbox := func() *unstructured.Unstructured {
+		sandbox := makeTestSandbox(sandboxName, namespace, "Pending", nil, nil)
+		sandbox.SetUID("sandbox-uid")
+		unstructured.SetNestedField(sandbox.Object, className, "spec", "className")
+		return sandbox
+	}
+
+	t.Run("claims a ready pool pod", func(t *testing.T) {
+		c := newClient(
+			makeTestSandboxClass(className, 2, namespace),
+			makeTestPoolPod("pool-a", namespace, className, false),
+			makeTestPoolPod("pool-b", namespace, className, true),
+			makeTestService(sandboxName, namespace, "10.0.0.1", 8888),
+		)
+		sandbox := newSandbox()
+
+		result, err := (&AgenticSandboxReconciler{}).ReconcileStateful(context.Background(), &GenericReconciler{Client: c}, sandbox)
+		require.NoError(t, err)
+		assert.Equal(t, ctrl.Result{}, result)
+
+		status, _, _ := unstructured.NestedMap(sandbox.Object, "status")
+		assert.Equal(t, "Running", status["phase"])
+		assert.Equal(t, "pool-b", status["podName"])
+		assert.Equal(t, "10.0.0.1", status["sandboxIP"])
+
+		claimed := &corev1.Pod{}
+		require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "pool-b", Namespace: namespace}, claimed))
+		assert.NotContains(t, claimed.Labels, sandboxPoolLabel)
+		assert.Equal(t, sandboxName, claimed.Labels[sandboxInstanceLabel])
+		assert.Equal(t, className, claimed.Labels[sandboxClaimedFromLabel])
+		require.Len(t, claimed.OwnerReferences, 1)
+		assert.Equal(t, types.UID("sandbox-uid"), claimed.OwnerReferences[0].UID)
+
+		unclaimed := &corev1.Pod{}
+		require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "pool-a", Namespace: namespace}, unclaimed))
+		assert.Equal(t, className, unclaimed.Labels[sandboxPoolLabel])
+
+		// Reconciling again reuses the claimed pod instead of taking another one.
+		_, err = (&AgenticSandboxReconciler{}).ReconcileStateful(context.Background(), &GenericReconciler{Client: c}, sandbox)
+		require.NoError(t, err)
+		status, _, _ = unstructured.NestedMap(sandbox.Object, "status")
+		assert.Equal(t, "pool-b", status["podName"])
+	})
+
+	t.Run("waits when the pool is empty", func(t *testing.T) {
+		c := newClient(
+			makeTestSandboxClass(className, 2, namespace),
+			makeTestPoolPod("pool-a", namespace, className, false),
+		)
+		sandbox := newSandbox()
+
+		result, err := (&AgenticSandboxReconciler{}).ReconcileStateful(context.Background(), &GenericReconciler{Client: c}, sandbox)
+		require.NoError(t, err)
+		assert.Equal(t, ctrl.Result{RequeueAfter: 5 * time.Second}, result)
+		status, _, _ := unstructured.NestedMap(sandbox.Object, "status")
+		assert.Equal(t, "Pending", status["phase"])
+		assert.Nil(t, status["podName"])
+	})
+
+	t.Run("reclaims when the claimed pod is gone", func(t *testing.T) {
+		c := newClient(
+			makeTestSandboxClass(className, 2, namespace),
+			makeTestPoolPod("pool-c", namespace, className, true),
+			makeTestService(sandboxName, namespace, "10.0.0.1", 8888),
+		)
+		sandbox := newSandbox()
+		unstructured.SetNestedField(sandbox.Object, "Running", "status", "phase")
+		unstructured.SetNestedField(sandbox.Object, "pool-gone", "status", "podName")
+
+		_, err := (&AgenticSandboxReconciler{}).ReconcileStateful(context.Background(), &GenericReconciler{Client: c}, sandbox)
+		require.NoError(t, err)
+		status, _, _ := unstructured.NestedMap(sandbox.Object, "status")
+		assert.Equal(t, "Running", status["phase"])
+		assert.Equal(t, "pool-c", status["podName"])
+	})
+
+	t.Run("dry run does not claim", func(t *testing.T) {
+		c := newClient(
+			makeTestSandboxClass(className, 2, namespace),
+			makeTestPoolPod("pool-b", namespace, className, true),
+			makeTestService(sandboxName, namespace, "10.0.0.1", 8888),
+		)
+		sandbox := newSandbox()
+
+		result, err := (&AgenticSandboxReconciler{}).ReconcileStateful(context.Background(), &GenericReconciler{Client: newDryRunClient(c), DryRunAll: true}, sandbox)
+		require.NoError(t, err)
+		assert.Equal(t, ctrl.Result{}, result)
+		status, _, _ := unstructured.NestedMap(sandbox.Object, "status")
+		assert.Equal(t, "Pending", status["phase"])
+		assert.Nil(t, status["podName"])
+
+		pod := &corev1.Pod{}
+		require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: "pool-b", Namespace: namespace}, pod))
+		assert.Equal(t, className, pod.Labels[sandboxPoolLabel])
+	})
+
+	t.Run("pool in another namespace is not used", func(t *testing.T) {
+		c := newClient(makeTestSandboxClass(className, 2, "sandboxes"))
+		className, err := (&AgenticSandboxReconciler{}).warmPoolClass(context.Background(), &GenericReconciler{Client: c}, newSandbox())
+		require.NoError(t, err)
+		assert.Empty(t, className)
+	})
+}
+
+func makeTestSandboxClass(name string, poolSize int64, poolNamespace string) *unstructured.Unstructured {
+	class := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	class.SetGroupVersionKind(agenticSandboxClassGVK)
+	class.SetName(name)
+	unstructured.SetNestedMap(class.Object, map[string]interface{}{
+		"size":      poolSize,
+		"namespace": poolNamespace,
+	}, "spec", "warmPool")
+	return class
+}
+
+func makeTestPoolPod(name, namespace, className string, ready bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "agentic-sandbox",
+				sandboxPoolLabel:         className,
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	if ready {
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	}
+	return pod
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// ApplyWaveAnnotation sets the apply wave of a rendered dependent, overriding
+// the wave of its kind. Waves are applied in ascending order, the dependents
+// of a wave in parallel.
+const ApplyWaveAnnotation = "model.skippy.io/apply-wave"
+
+// DefaultDependentConcurrency is the default number of dependents of a target
+// that are applied in parallel.
+const DefaultDependentConcurrency = 4
+
+// kindApplyWaves are the waves of kinds other dependents rely on. Dependents
+// of any other kind are in wave 0.
+var kindApplyWaves = map[string]int{
+	"Namespace":                      -3,
+	"CustomResourceDefinition":       -3,
+	"ResourceQuota":                  -2,
+	"LimitRange":                     -2,
+	"PriorityClass":                  -2,
+	"StorageClass":                   -2,
+	"ComputeClass":                   -2,
+	"ServiceAccount":                 -1,
+	"Role":                           -1,
+	"ClusterRole":                    -1,
+	"RoleBinding":                    -1,
+	"ClusterRoleBinding":             -1,
+	"ConfigMap":                      -1,
+	"Secret":                         -1,
+	"PersistentVolumeClaim":          -1,
+	"MutatingWebhookConfiguration":   1,
+	"ValidatingWebhookConfiguration": 1,
+}
+
+// applyWave returns the apply wave of a rendered dependent.
+func applyWave(obj *unstructured.Unstructured) int {
+	if value, ok := obj.GetAnnotations()[ApplyWaveAnnotation]; ok {
+		if wave, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return wave
+		}
+	}
+	return kindApplyWaves[obj.GetKind()]
+}
+
+// applyWaves groups the indexes of objs by apply wave, in ascending wave
+// order. Within a wave the rendered order is kept.
+func applyWaves(objs []*unstructured.Unstructured) [][]int {
+	byWave := map[int][]int{}
+	var waves []int
+	for i, obj := range objs {
+		wave := applyWave(obj)
+		if _, ok := byWave[wave]; !ok {
+			waves = append(waves, wave)
+		}
+		byWave[wave] = append(byWave[wave], i)
+	}
+	sort.Ints(waves)
+	grouped := make([][]int, 0, len(waves))
+	for _, wave := range waves {
+		grouped = append(grouped, byWave[wave])
+	}
+	return grouped
+}
+
+// dependentErrors are the errors of the dependents that failed to apply.
+type dependentErrors []error
+
+func (e dependentErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e dependentErrors) Unwrap() []error {
+	return e
+}
+
+// dependentConcurrency returns the number of dependents applied in parallel.
+func (r *GenericReconciler) dependentConcurrency() int {
+	if r.DependentConcurrency < 1 {
+		return 1
+	}
+	return r.DependentConcurrency
+}
+
+// processDependentResources applies the rendered dependents wave by wave, see
+// applyWave. The dependents of a wave are applied in parallel, by at most
+// DependentConcurrency workers, and a wave only starts once the previous one
+// is done. A failed dependent does not stop the others; the errors of all
+// failed dependents are returned together. The returned infos keep the
+// rendered order.
+func (r *GenericReconciler) processDependentResources(
+	ctx context.Context,
+	log logr.Logger,
+	target *unstructured.Unstructured,
+	objs []*unstructured.Unstructured,
+	resourceClient modelv1.ResourceClientInterface,
+) ([]map[string]interface{}, error) {
+	ctx, drift := withProtectedDrift(ctx)
+	defer func() {
+		if err := r.setProtectedDriftCondition(target, drift.list()); err != nil {
+			log.Error(err, "Failed to set the ProtectedDrift condition")
+		}
+	}()
+	if len(objs) == 0 {
+		return nil, nil
+	}
+	infos := make([]map[string]interface{}, len(objs))
+	errs := make([]error, len(objs))
+	workers := r.dependentConcurrency()
+
+	for _, wave := range applyWaves(objs) {
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers && w < len(wave); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					infos[i], errs[i] = r.processSingleDependentResource(ctx, log, target, objs[i], resourceClient)
+				}
+			}()
+		}
+		for _, i := range wave {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	}
+
+	var failed dependentErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return infos, failed
+	}
+	return infos, nil
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// recordingResourceClient creates every object it is asked for, slowly, and
+// records the order of the creates and how many ran at once.
+type recordingResourceClient struct {
+	m           sync.Mutex
+	created     []string
+	inFlight    int
+	maxInFlight int
+	failing     map[string]bool
+}
+
+func (c *recordingResourceClient) Get(_ context.Context, gvk schema.GroupVersionKind, _, name string) (*unstructured.Unstructured, error) {
+	return nil, errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, name)
+}
+
+func (c *recordingResourceClient) Create(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	c.m.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.m.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.inFlight--
+	if c.failing[obj.GetName()] {
+		return nil, fmt.Errorf("%s is broken", obj.GetName())
+	}
+	c.created = append(c.created, obj.GetName())
+	return obj.DeepCopy(), nil
+}
+
+func (c *recordingResourceClient) Update(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return c.Create(ctx, gvk, namespace, obj)
+}
+
+func (c *recordingResourceClient) Delete(context.Context, schema.GroupVersionKind, string, string, *metav1.DeletionPropagation) error {
+	return nil
+}
+
+func (c *recordingResourceClient) Patch(_ context.Context, gvk schema.GroupVersionKind, _, name string, _ types.PatchType, _ []byte) (*unstructured.Unstructured, error) {
+	return nil, errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, name)
+}
+
+func TestApplyWaves(t *testing.T) {
+	newObj := func(kind, name, wave string) *unstructured.Unstructured {
+		obj := newTestResource(name, "default", schema.GroupVersionKind{Version: "v1", Kind: kind})
+		if wave != "" {
+			obj.SetAnnotations(map[string]string{ApplyWaveAnnotation: wave})
+		}
+		return obj
+	}
+	objs := []*unstructured.Unstructured{
+		newObj("Service", "svc", ""),
+		newObj("Deployment", "server", ""),
+		newObj("ConfigMap", "config", ""),
+		newObj("Job", "migrate", "-5"),
+		newObj("ValidatingWebhookConfiguration", "webhook", ""),
+		newObj("Namespace", "ns", ""),
+		newObj("Secret", "creds", "not-a-number"),
+	}
+
+	assert.Equal(t, [][]int{{3}, {5}, {2, 6}, {0, 1}, {4}}, applyWaves(objs))
+	assert.Empty(t, applyWaves(nil))
+}
+
+func TestProcessDependentResources(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	newReconciler := func(concurrency int) *GenericReconciler {
+		return &GenericReconciler{
+			Gvk:                  targetGVK,
+			Scheme:               runtime.NewScheme(),
+			Recorder:             record.NewFakeRecorder(100),
+			DependentConcurrency: concurrency,
+		}
+	}
+	newObjs := func() []*unstructured.Unstructured {
+		objs := []*unstructured.Unstructured{
+			newTestResource("config", "default", schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}),
+		}
+		for i := 0; i < 6; i++ {
+			objs = append(objs, newTestResource(fmt.Sprintf("svc-%d", i), "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"}))
+		}
+		return objs
+	}
+
+	t.Run("applies waves in order with bounded concurrency", func(t *testing.T) {
+		rc := &recordingResourceClient{}
+		target := newTestResource("test-resource", "default", targetGVK)
+
+		infos, err := newReconciler(3).processDependentResources(context.Background(), logr.Discard(), target, newObjs(), rc)
+		require.NoError(t, err)
+		require.Len(t, infos, 7)
+		for i, info := range infos {
+			assert.Equal(t, "Processed", info["status"], "dependent %d", i)
+		}
+		assert.Equal(t, "config", infos[0]["name"], "infos keep the rendered order")
+		assert.Equal(t, "svc-5", infos[6]["name"])
+
+		require.Len(t, rc.created, 7)
+		assert.Equal(t, "config", rc.created[0], "the ConfigMap wave is applied first")
+		assert.Equal(t, 3, rc.maxInFlight)
+	})
+
+	t.Run("applies one at a time by default", func(t *testing.T) {
+		rc := &recordingResourceClient{}
+		target := newTestResource("test-resource", "default", targetGVK)
+
+		_, err := newReconciler(0).processDependentResources(context.Background(), logr.Discard(), target, newObjs(), rc)
+		require.NoError(t, err)
+		assert.Equal(t, 1, rc.maxInFlight)
+		assert.Equal(t, []string{"config", "svc-0", "svc-1", "svc-2", "svc-3", "svc-4", "svc-5"}, rc.created)
+	})
+
+	t.Run("aggregates the errors of failed dependents", func(t *testing.T) {
+		rc := &recordingResourceClient{failing: map[string]bool{"config": true, "svc-4": true}}
+		target := newTestResource("test-resource", "default", targetGVK)
+
+		infos, err := newReconciler(4).processDependentResources(context.Background(), logr.Discard(), target, newObjs(), rc)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "config is broken")
+		assert.Contains(t, err.Error(), "svc-4 is broken")
+		var failed dependentErrors
+		require.ErrorAs(t, err, &failed)
+		assert.Len(t, failed, 2)
+
+		assert.Contains(t, infos[0]["status"], "Error")
+		assert.Equal(t, "Processed", infos[1]["status"], "a failed wave does not stop the next one")
+		assert.Contains(t, infos[5]["status"], "Error")
+		assert.Len(t, rc.created, 5)
+	})
+}
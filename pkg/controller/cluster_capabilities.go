@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	MissingClusterCapabilityConditionType = "MissingClusterCapability"
+	ClusterCapabilityMissingReason        = "ClusterCapabilityMissing"
+	ClusterCapabilitiesPresentReason      = "ClusterCapabilitiesPresent"
+	MissingClusterCapabilityEvent         = modelv1.EventReasonMissingClusterCapability
+
+	// ClusterCapabilityRecheckInterval is how long to wait before the
+	// capabilities that a resource misses are checked again. Installing a
+	// CSI driver or a StorageClass does not trigger a reconcile.
+	ClusterCapabilityRecheckInterval = time.Minute
+)
+
+var (
+	csiDriverGVK    = schema.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "CSIDriver"}
+	storageClassGVK = schema.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "StorageClass"}
+)
+
+// MissingClusterCapabilityError is returned when rendered dependents use CSI
+// drivers or StorageClasses that the cluster does not have, so that they are
+// not applied: their pods would sit in ContainerCreating with volume errors.
+type MissingClusterCapabilityError struct {
+	Missing []string
+}
+
+func (e *MissingClusterCapabilityError) Error() string {
+	return fmt.Sprintf("missing cluster capabilities: %s", strings.Join(e.Missing, "; "))
+}
+
+// clusterCapabilities returns the CSI drivers and StorageClasses that objs
+// use, without the ones that objs create themselves.
+func clusterCapabilities(objs []*unstructured.Unstructured) (csiDrivers, storageClasses []string) {
+	drivers := map[string]bool{}
+	classes := map[string]bool{}
+	nested := func(obj map[string]interface{}, fields ...string) interface{} {
+		value, _, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+		return value
+	}
+	addDriver := func(value interface{}) {
+		if driver, ok := value.(string); ok && driver != "" {
+			drivers[driver] = true
+		}
+	}
+	addClass := func(value interface{}) {
+		if class, ok := value.(string); ok && class != "" {
+			classes[class] = true
+		}
+	}
+	for _, obj := range objs {
+		switch obj.GetKind() {
+		case "PersistentVolumeClaim":
+			addClass(nested(obj.Object, "spec", "storageClassName"))
+		case "PersistentVolume":
+			addDriver(nested(obj.Object, "spec", "csi", "driver"))
+			addClass(nested(obj.Object, "spec", "storageClassName"))
+		case "StatefulSet":
+			templates, _ := nested(obj.Object, "spec", "volumeClaimTemplates").([]interface{})
+			for _, template := range templates {
+				if template, ok := template.(map[string]interface{}); ok {
+					addClass(nested(template, "spec", "storageClassName"))
+				}
+			}
+		}
+		for _, path := range transformer.PodSpecPaths(obj.GetKind()) {
+			volumes, _ := nested(obj.Object, append(append([]string{}, path...), "volumes")...).([]interface{})
+			for _, volume := range volumes {
+				if volume, ok := volume.(map[string]interface{}); ok {
+					addDriver(nested(volume, "csi", "driver"))
+					addClass(nested(volume, "ephemeral", "volumeClaimTemplate", "spec", "storageClassName"))
+				}
+			}
+		}
+	}
+	for _, obj := range objs {
+		switch obj.GroupVersionKind().GroupKind() {
+		case csiDriverGVK.GroupKind():
+			delete(drivers, obj.GetName())
+		case storageClassGVK.GroupKind():
+			delete(classes, obj.GetName())
+		}
+	}
+	return sortedSet(drivers), sortedSet(classes)
+}
+
+// checkClusterCapabilities checks that the CSI drivers and StorageClasses
+// that the rendered dependents use are installed before they are applied, and
+// reports the missing ones in the MissingClusterCapability condition of the
+// target. Targets whose dependents use neither get no condition. Capabilities
+// that the operator may not read, e.g. when it is namespace-scoped, are not
+// checked.
+func (r *GenericReconciler) checkClusterCapabilities(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	csiDrivers, storageClasses := clusterCapabilities(objs)
+	existing := meta.FindStatusCondition(targetConditions(target), MissingClusterCapabilityConditionType)
+	if len(csiDrivers) == 0 && len(storageClasses) == 0 && existing == nil {
+		return nil
+	}
+
+	var missing []string
+	check := func(gvk schema.GroupVersionKind, name, description string) error {
+		_, err := rc.Get(ctx, gvk, "", name)
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, description)
+		case errors.IsForbidden(err) || meta.IsNoMatchError(err):
+			log.V(1).Info("Not checking cluster capability", "kind", gvk.Kind, "name", name, "error", err.Error())
+		case err != nil:
+			return fmt.Errorf("error getting %s %s: %w", gvk.Kind, name, err)
+		}
+		return nil
+	}
+	for _, driver := range csiDrivers {
+		if err := check(csiDriverGVK, driver, fmt.Sprintf("CSI driver %s is not installed", driver)); err != nil {
+			return err
+		}
+	}
+	for _, class := range storageClasses {
+		if err := check(storageClassGVK, class, fmt.Sprintf("StorageClass %s does not exist", class)); err != nil {
+			return err
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               MissingClusterCapabilityConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             ClusterCapabilitiesPresentReason,
+		Message:            "All CSI drivers and StorageClasses of the dependents are installed.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ClusterCapabilityMissingReason
+		condition.Message = fmt.Sprintf("Not applying dependents: %s", strings.Join(missing, "; "))
+		if existing == nil || existing.Status != metav1.ConditionTrue || existing.Message != condition.Message {
+			r.eventf(target, corev1.EventTypeWarning, MissingClusterCapabilityEvent, "Not applying dependents of %s %s: %s", target.GetKind(), target.GetName(), strings.Join(missing, "; "))
+		}
+	}
+	if err := setTargetCondition(target, condition); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &MissingClusterCapabilityError{Missing: missing}
+	}
+	return nil
+}
+
+func sortedSet(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func newTestCapabilityObjects() []*unstructured.Unstructured {
+	return []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"volumes": []interface{}{
+					map[string]interface{}{"name": "model-weights", "csi": map[string]interface{}{"driver": "gcsfuse.csi.storage.gke.io"}},
+					map[string]interface{}{"name": "scratch", "ephemeral": map[string]interface{}{"volumeClaimTemplate": map[string]interface{}{
+						"spec": map[string]interface{}{"storageClassName": "hyperdisk-ml"},
+					}}},
+				},
+			}}},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "StatefulSet",
+			"metadata":   map[string]interface{}{"name": "cache", "namespace": "default"},
+			"spec": map[string]interface{}{"volumeClaimTemplates": []interface{}{
+				map[string]interface{}{"spec": map[string]interface{}{"storageClassName": "premium-rwo"}},
+			}},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "checkpoints", "namespace": "default"},
+			"spec":       map[string]interface{}{"storageClassName": "checkpoints"},
+		}},
+		// Created together with the claim that uses it.
+		{Object: map[string]interface{}{
+			"apiVersion": "storage.k8s.io/v1",
+			"kind":       "StorageClass",
+			"metadata":   map[string]interface{}{"name": "checkpoints"},
+		}},
+	}
+}
+
+func TestClusterCapabilities(t *testing.T) {
+	drivers, classes := clusterCapabilities(newTestCapabilityObjects())
+	assert.Equal(t, []string{"gcsfuse.csi.storage.gke.io"}, drivers)
+	assert.Equal(t, []string{"hyperdisk-ml", "premium-rwo"}, classes)
+}
+
+func TestCheckClusterCapabilities(t *testing.T) {
+	installed := map[string]bool{"premium-rwo": true}
+	forbidden := map[string]bool{}
+	rc := &MockResourceClient{
+		GetFunc: func(_ context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+			assert.Empty(t, namespace)
+			resource := schema.GroupResource{Group: gvk.Group, Resource: "storageclasses"}
+			if forbidden[name] {
+				return nil, errors.NewForbidden(resource, name, stderrors.New("denied"))
+			}
+			if !installed[name] {
+				return nil, errors.NewNotFound(resource, name)
+			}
+			return &unstructured.Unstructured{}, nil
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	target := newTestResource("llama", "default", eventTestGVK)
+
+	err := r.checkClusterCapabilities(context.Background(), logr.Discard(), target, newTestCapabilityObjects(), rc)
+	var capabilityErr *MissingClusterCapabilityError
+	require.True(t, stderrors.As(err, &capabilityErr))
+	assert.Equal(t, []string{"CSI driver gcsfuse.csi.storage.gke.io is not installed", "StorageClass hyperdisk-ml does not exist"}, capabilityErr.Missing)
+	assert.Equal(t, ExternalDependencyNotReady, classifyError(err))
+	result, resultErr := (&GenericReconciler{Gvk: eventTestGVK}).failedResult(err)
+	require.NoError(t, resultErr)
+	assert.Equal(t, ctrl.Result{RequeueAfter: ClusterCapabilityRecheckInterval}, result)
+
+	condition := meta.FindStatusCondition(targetConditions(target), MissingClusterCapabilityConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "True", string(condition.Status))
+	assert.Equal(t, ClusterCapabilityMissingReason, condition.Reason)
+	assert.Equal(t, "Not applying dependents: CSI driver gcsfuse.csi.storage.gke.io is not installed; StorageClass hyperdisk-ml does not exist", condition.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning MissingClusterCapability")
+
+	// The event is only recorded when the missing capabilities change.
+	require.Error(t, r.checkClusterCapabilities(context.Background(), logr.Discard(), target, newTestCapabilityObjects(), rc))
+	assert.Empty(t, recorder.Events)
+
+	conditions, err := (&GenericReconciler{}).buildConditions(context.Background(), newTestResource("llama", "default", eventTestGVK), true, capabilityErr)
+	require.NoError(t, err)
+	require.Len(t, conditions, 1)
+	assert.Equal(t, ClusterCapabilityMissingReason, conditions[0].(map[string]interface{})["reason"])
+
+	// Capabilities that cannot be read are not checked.
+	installed["gcsfuse.csi.storage.gke.io"] = true
+	forbidden["hyperdisk-ml"] = true
+	require.NoError(t, r.checkClusterCapabilities(context.Background(), logr.Discard(), target, newTestCapabilityObjects(), rc))
+	condition = meta.FindStatusCondition(targetConditions(target), MissingClusterCapabilityConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "False", string(condition.Status))
+	assert.Equal(t, ClusterCapabilitiesPresentReason, condition.Reason)
+
+	// Targets whose dependents use no capabilities get no condition.
+	other := newTestResource("agent", "default", eventTestGVK)
+	require.NoError(t, r.checkClusterCapabilities(context.Background(), logr.Discard(), other, nil, rc))
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), MissingClusterCapabilityConditionType))
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// ClusterDefaultsRefreshInterval is how often the cluster defaults ConfigMap
+// is read again. Resources pick up a change at their next reconcile.
+const ClusterDefaultsRefreshInterval = time.Minute
+
+// ClusterDefaultsLoader keeps the cluster defaults of generated pods in sync
+// with a ConfigMap that cluster admins manage, see
+// transformer.ParseClusterDefaults for its format.
+type ClusterDefaultsLoader struct {
+	// Reader reads the ConfigMap. It should not be the cached client, so that
+	// the operator does not watch every ConfigMap of the cluster.
+	Reader    client.Reader
+	ConfigMap types.NamespacedName
+	// Set receives the parsed defaults, or nil while the ConfigMap does not
+	// exist.
+	Set func(map[string]transformer.ClusterDefaults)
+	// Interval overrides ClusterDefaultsRefreshInterval, e.g. in tests.
+	Interval time.Duration
+
+	loaded map[string]transformer.ClusterDefaults
+}
+
+// ParseConfigMapName parses a "namespace/name" reference to a ConfigMap.
+func ParseConfigMapName(value string) (types.NamespacedName, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, fmt.Errorf("invalid ConfigMap %q, expected namespace/name", value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica renders resources.
+func (l *ClusterDefaultsLoader) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reads the ConfigMap until ctx is done.
+func (l *ClusterDefaultsLoader) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("configMap", l.ConfigMap.String())
+	interval := l.Interval
+	if interval <= 0 {
+		interval = ClusterDefaultsRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Sync(ctx); err != nil {
+			// The previous defaults stay in effect.
+			logger.Error(err, "Failed to load cluster defaults")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reads the ConfigMap and passes its defaults to Set if they changed.
+func (l *ClusterDefaultsLoader) Sync(ctx context.Context) error {
+	configMap := &corev1.ConfigMap{}
+	var defaults map[string]transformer.ClusterDefaults
+	err := l.Reader.Get(ctx, l.ConfigMap, configMap)
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("failed to get ConfigMap %s: %w", l.ConfigMap, err)
+	default:
+		if defaults, err = transformer.ParseClusterDefaults(configMap.Data); err != nil {
+			return fmt.Errorf("ConfigMap %s: %w", l.ConfigMap, err)
+		}
+	}
+	if reflect.DeepEqual(defaults, l.loaded) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Cluster defaults changed", "configMap", l.ConfigMap.String(), "kinds", len(defaults))
+	l.loaded = defaults
+	l.Set(defaults)
+	return nil
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestParseConfigMapName(t *testing.T) {
+	name, err := ParseConfigMapName("karo-system/cluster-defaults")
+	require.NoError(t, err)
+	assert.Equal(t, types.NamespacedName{Namespace: "karo-system", Name: "cluster-defaults"}, name)
+
+	for _, value := range []string{"cluster-defaults", "/cluster-defaults", "karo-system/", "a/b/c"} {
+		_, err := ParseConfigMapName(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestClusterDefaultsLoader(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "karo-system", Name: "cluster-defaults"},
+		Data:       map[string]string{"default": "priorityClassName: batch"},
+	}
+	c := fake.NewClientBuilder().WithObjects(configMap).Build()
+	var sets []map[string]transformer.ClusterDefaults
+	loader := &ClusterDefaultsLoader{
+		Reader:    c,
+		ConfigMap: types.NamespacedName{Namespace: "karo-system", Name: "cluster-defaults"},
+		Set:       func(defaults map[string]transformer.ClusterDefaults) { sets = append(sets, defaults) },
+	}
+
+	require.NoError(t, loader.Sync(ctx))
+	require.Len(t, sets, 1)
+	assert.Equal(t, "batch", sets[0]["default"].PriorityClassName)
+
+	// Unchanged defaults are not set again.
+	require.NoError(t, loader.Sync(ctx))
+	assert.Len(t, sets, 1)
+
+	// Invalid defaults keep the previous ones.
+	configMap.Data = map[string]string{"default": "priorityClass: batch"}
+	require.NoError(t, c.Update(ctx, configMap))
+	assert.ErrorContains(t, loader.Sync(ctx), "ConfigMap karo-system/cluster-defaults")
+	assert.Len(t, sets, 1)
+
+	// Deleting the ConfigMap removes the defaults.
+	require.NoError(t, c.Delete(ctx, configMap))
+	require.NoError(t, loader.Sync(ctx))
+	require.Len(t, sets, 2)
+	assert.Nil(t, sets[1])
+}
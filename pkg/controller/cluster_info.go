@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// ClusterInfoRefreshInterval is how often the cluster metadata is
+	// discovered again, e.g. to pick up the version after an upgrade.
+	ClusterInfoRefreshInterval = 10 * time.Minute
+
+	// DefaultMetadataURL is the metadata server of GKE nodes.
+	DefaultMetadataURL = "http://metadata.google.internal/computeMetadata/v1"
+
+	// autopilotGroup is an API group that only Autopilot clusters serve.
+	autopilotGroup = "auto.gke.io"
+	// gceProviderIDPrefix prefixes the provider IDs of GKE nodes,
+	// gce://project/zone/instance.
+	gceProviderIDPrefix = "gce://"
+	metadataTimeout     = 2 * time.Second
+)
+
+// ClusterInfoLoader keeps the cluster metadata that templates read as .cluster
+// up to date. The project, name and location of the cluster are read from the
+// metadata server, and otherwise the project and region from a node. The
+// version and whether the cluster is Autopilot are discovered from the API
+// server.
+type ClusterInfoLoader struct {
+	// Reader lists a node. It should not be the cached client, so that the
+	// operator does not watch every node of the cluster.
+	Reader    client.Reader
+	Discovery discovery.DiscoveryInterface
+	// MetadataURL overrides DefaultMetadataURL, e.g. in tests.
+	MetadataURL string
+	// Override holds the fields that are not discovered, e.g. because the
+	// cluster has no metadata server.
+	Override transformer.ClusterInfo
+	// Set receives the metadata whenever it changed.
+	Set func(*transformer.ClusterInfo)
+	// Interval overrides ClusterInfoRefreshInterval, e.g. in tests.
+	Interval time.Duration
+
+	loaded *transformer.ClusterInfo
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica renders resources.
+func (l *ClusterInfoLoader) NeedLeaderElection() bool {
+	return false
+}
+
+// Start discovers the cluster metadata until ctx is done.
+func (l *ClusterInfoLoader) Start(ctx context.Context) error {
+	interval := l.Interval
+	if interval <= 0 {
+		interval = ClusterInfoRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Sync(ctx); err != nil {
+			// The previous metadata stays in effect.
+			log.FromContext(ctx).Error(err, "Failed to discover cluster metadata")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync discovers the cluster metadata and passes it to Set if it changed.
+func (l *ClusterInfoLoader) Sync(ctx context.Context) error {
+	info := l.Override
+	if info.ProjectID == "" {
+		info.ProjectID = l.metadata(ctx, "project/project-id")
+	}
+	if info.Name == "" {
+		info.Name = l.metadata(ctx, "instance/attributes/cluster-name")
+	}
+	if info.Location == "" {
+		info.Location = l.metadata(ctx, "instance/attributes/cluster-location")
+	}
+	if info.ProjectID == "" || info.Location == "" {
+		nodes := &corev1.NodeList{}
+		if err := l.Reader.List(ctx, nodes, client.Limit(1)); err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		if len(nodes.Items) > 0 {
+			node := nodes.Items[0]
+			if info.ProjectID == "" && strings.HasPrefix(node.Spec.ProviderID, gceProviderIDPrefix) {
+				info.ProjectID, _, _ = strings.Cut(strings.TrimPrefix(node.Spec.ProviderID, gceProviderIDPrefix), "/")
+			}
+			if info.Location == "" {
+				info.Location = node.Labels[regionLabel]
+			}
+		}
+	}
+	version, err := l.Discovery.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the server version: %w", err)
+	}
+	info.Version = version.GitVersion
+	groups, err := l.Discovery.ServerGroups()
+	if err != nil {
+		return fmt.Errorf("failed to list the API groups: %w", err)
+	}
+	for _, group := range groups.Groups {
+		if group.Name == autopilotGroup {
+			info.Autopilot = true
+		}
+	}
+
+	if reflect.DeepEqual(&info, l.loaded) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Cluster metadata changed", "project", info.ProjectID, "name", info.Name, "location", info.Location, "autopilot", info.Autopilot, "version", info.Version)
+	l.loaded = &info
+	l.Set(&info)
+	return nil
+}
+
+// metadata reads a value from the metadata server, or returns "" if it
+// cannot, e.g. because the operator does not run on GKE.
+func (l *ClusterInfoLoader) metadata(ctx context.Context, path string) string {
+	url := l.MetadataURL
+	if url == "" {
+		url = DefaultMetadataURL
+	}
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/"+path, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Metadata server is not reachable", "path", path, "error", err.Error())
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	value, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(value))
+}
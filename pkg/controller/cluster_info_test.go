@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestClusterInfoLoader(t *testing.T) {
+	metadata := map[string]string{
+		"/project/project-id":               "my-project",
+		"/instance/attributes/cluster-name": "serving",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		value, ok := metadata[req.URL.Path]
+		if !ok || req.Header.Get("Metadata-Flavor") != "Google" {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprintln(w, value)
+	}))
+	defer server.Close()
+
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "gke-serving-pool-1", Labels: map[string]string{"topology.kubernetes.io/region": "us-central1"}},
+		Spec:       corev1.NodeSpec{ProviderID: "gce://node-project/us-central1-a/gke-serving-pool-1"},
+	}
+	discovery := &fakediscovery.FakeDiscovery{
+		Fake:               &clienttesting.Fake{Resources: []*metav1.APIResourceList{{GroupVersion: "auto.gke.io/v1"}}},
+		FakedServerVersion: &version.Info{GitVersion: "v1.30.5-gke.1014001"},
+	}
+	var set []*transformer.ClusterInfo
+	loader := &ClusterInfoLoader{
+		Reader:      fake.NewClientBuilder().WithScheme(s).WithObjects(node).Build(),
+		Discovery:   discovery,
+		MetadataURL: server.URL,
+		Set:         func(info *transformer.ClusterInfo) { set = append(set, info) },
+	}
+
+	// The location that the metadata server lacks is the region of a node.
+	require.NoError(t, loader.Sync(context.Background()))
+	require.Len(t, set, 1)
+	assert.Equal(t, &transformer.ClusterInfo{ProjectID: "my-project", Name: "serving", Location: "us-central1", Autopilot: true, Version: "v1.30.5-gke.1014001"}, set[0])
+
+	// Set is only called when the metadata changed.
+	require.NoError(t, loader.Sync(context.Background()))
+	assert.Len(t, set, 1)
+	metadata["/instance/attributes/cluster-location"] = "us-central1-a"
+	require.NoError(t, loader.Sync(context.Background()))
+	require.Len(t, set, 2)
+	assert.Equal(t, "us-central1-a", set[1].Location)
+
+	// Without a metadata server, the project is read from the provider ID of
+	// a node, and the overrides fill in the rest.
+	loader.MetadataURL = "http://127.0.0.1:1"
+	loader.Override = transformer.ClusterInfo{Name: "kind"}
+	discovery.Resources = nil
+	require.NoError(t, loader.Sync(context.Background()))
+	require.Len(t, set, 3)
+	assert.Equal(t, &transformer.ClusterInfo{ProjectID: "node-project", Name: "kind", Location: "us-central1", Version: "v1.30.5-gke.1014001"}, set[2])
+}
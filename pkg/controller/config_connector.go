@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// configConnectorGroupSuffix is the suffix of the API groups of Config
+	// Connector resources, e.g. pubsub.cnrm.cloud.google.com.
+	configConnectorGroupSuffix = ".cnrm.cloud.google.com"
+
+	// CloudResourcesReadyConditionType is set on targets with Config Connector
+	// dependents. Config Connector provisions the GCP resources long after
+	// the dependents are applied, so their readiness is kept apart from the
+	// Ready condition.
+	CloudResourcesReadyConditionType = "CloudResourcesReady"
+	CloudResourcesReadyReason        = "CloudResourcesReady"
+	CloudResourcesProvisioningReason = "CloudResourcesProvisioning"
+	CloudResourcesFailedReason       = "CloudResourcesFailed"
+	CloudResourcesFailedEvent        = modelv1.EventReasonCloudResourcesFailed
+)
+
+// configConnectorFailedReasons are the reasons of the Ready condition of a
+// Config Connector resource that need a change to recover, as opposed to
+// the ones it reports while it is provisioning or waiting for references.
+var configConnectorFailedReasons = map[string]bool{
+	"UpdateFailed":       true,
+	"DeleteFailed":       true,
+	"DependencyInvalid":  true,
+	"ManagementConflict": true,
+}
+
+// isConfigConnectorKind reports whether gvk is a Config Connector resource.
+func isConfigConnectorKind(gvk schema.GroupVersionKind) bool {
+	return strings.HasSuffix(gvk.Group, configConnectorGroupSuffix)
+}
+
+// configConnectorDiff compares the spec, labels and annotations of two Config
+// Connector resources. Config Connector adds defaults and the state of the
+// GCP resource to these, so only the fields the template sets are compared.
+func (r *GenericReconciler) configConnectorDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	desiredSpec, _ := obj.Object["spec"].(map[string]interface{})
+	existingSpec, _ := existingObj.Object["spec"].(map[string]interface{})
+	for key, desired := range desiredSpec {
+		if !containsFields(existingSpec[key], desired) {
+			log.Info("Found a difference in the Config Connector spec", "kind", obj.GetKind(), "field", key, "difference", cmp.Diff(normalizeNumbersToInt64(existingSpec[key]), normalizeNumbersToInt64(desired)))
+			return true, nil
+		}
+	}
+	for field, desired := range map[string]map[string]string{"labels": obj.GetLabels(), "annotations": obj.GetAnnotations()} {
+		existing := existingObj.GetLabels()
+		if field == "annotations" {
+			existing = existingObj.GetAnnotations()
+		}
+		for key, value := range desired {
+			if current, ok := existing[key]; !ok || current != value {
+				log.Info("Found a difference in the Config Connector metadata", "kind", obj.GetKind(), "field", field, "key", key)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// containsFields reports whether existing has every field of desired. Lists
+// must have the same length, and their items are compared in order.
+func containsFields(existing, desired interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		existingMap, ok := existing.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range desired {
+			if !containsFields(existingMap[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		existingList, ok := existing.([]interface{})
+		if !ok || len(existingList) != len(desired) {
+			return false
+		}
+		for i := range desired {
+			if !containsFields(existingList[i], desired[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(normalizeNumbersToInt64(existing), normalizeNumbersToInt64(desired))
+}
+
+// keepServerSpecFields copies the top-level spec fields that Config Connector
+// set on existingObj, e.g. resourceID, into obj before it replaces
+// existingObj, as some of them cannot be unset.
+func keepServerSpecFields(existingObj, obj *unstructured.Unstructured) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		desiredSpec = map[string]interface{}{}
+		obj.Object["spec"] = desiredSpec
+	}
+	for key, value := range existingSpec {
+		if _, set := desiredSpec[key]; !set {
+			desiredSpec[key] = runtime.DeepCopyJSONValue(value)
+		}
+	}
+}
+
+// configConnectorReadiness returns the status of the Ready condition of a
+// Config Connector resource, "Unknown" until Config Connector observed its
+// generation, and a description of why it is not ready.
+func configConnectorReadiness(obj *unstructured.Unstructured) (status string, failed bool, message string) {
+	observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if found && observed < obj.GetGeneration() {
+		return string(metav1.ConditionUnknown), false, "waiting for Config Connector to observe the latest generation"
+	}
+	status, reason, message := dependentCondition(obj, "Ready")
+	switch status {
+	case "":
+		return string(metav1.ConditionUnknown), false, "waiting for Config Connector to reconcile it"
+	case string(metav1.ConditionTrue):
+		return status, false, ""
+	}
+	if message == "" {
+		message = reason
+	}
+	return status, configConnectorFailedReasons[reason], fmt.Sprintf("%s: %s", reason, message)
+}
+
+// checkConfigConnectorDependents reads the readiness of the Config Connector
+// dependents of target into their entries in infos, and sets the
+// CloudResourcesReady condition of target from it. The entries are copied,
+// as they may be the ones of the last applied status.
+func (r *GenericReconciler) checkConfigConnectorDependents(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, infos []map[string]interface{}, rc modelv1.ResourceClientInterface) ([]map[string]interface{}, error) {
+	readiness := map[string]string{}
+	var pending, failed []string
+	for _, obj := range objs {
+		if !isConfigConnectorKind(obj.GroupVersionKind()) {
+			continue
+		}
+		key := obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+		live, err := rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		if errors.IsNotFound(err) {
+			readiness[key] = string(metav1.ConditionUnknown)
+			pending = append(pending, fmt.Sprintf("%s %s does not exist", obj.GetKind(), obj.GetName()))
+			continue
+		} else if err != nil {
+			return infos, fmt.Errorf("error getting resource %s %s/%s: %w", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		status, isFailed, message := configConnectorReadiness(live)
+		readiness[key] = status
+		switch {
+		case isFailed:
+			failed = append(failed, fmt.Sprintf("%s %s %s", obj.GetKind(), obj.GetName(), message))
+		case status != string(metav1.ConditionTrue):
+			pending = append(pending, fmt.Sprintf("%s %s %s", obj.GetKind(), obj.GetName(), message))
+		}
+	}
+	if len(readiness) == 0 {
+		conditions := targetConditions(target)
+		if meta.RemoveStatusCondition(&conditions, CloudResourcesReadyConditionType) {
+			return infos, unstructured.SetNestedSlice(target.Object, conditionsToUnstructured(conditions), "status", "conditions")
+		}
+		return infos, nil
+	}
+
+	updated := make([]map[string]interface{}, len(infos))
+	for i, info := range infos {
+		updated[i] = info
+		key := getStringValue(info, "kind") + "/" + getStringValue(info, "namespace") + "/" + getStringValue(info, "name")
+		if status, ok := readiness[key]; ok {
+			updated[i] = runtime.DeepCopyJSON(info)
+			updated[i]["ready"] = status
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               CloudResourcesReadyConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             CloudResourcesReadyReason,
+		Message:            "All Config Connector dependents are ready.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	sort.Strings(failed)
+	sort.Strings(pending)
+	switch {
+	case len(failed) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = CloudResourcesFailedReason
+		condition.Message = strings.Join(append(failed, pending...), "\n")
+		if existing := meta.FindStatusCondition(targetConditions(target), CloudResourcesReadyConditionType); existing == nil || existing.Reason != CloudResourcesFailedReason {
+			r.eventf(target, corev1.EventTypeWarning, CloudResourcesFailedEvent, "Config Connector dependents of %s %s failed: %s", target.GetKind(), target.GetName(), strings.Join(failed, "; "))
+		}
+	case len(pending) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = CloudResourcesProvisioningReason
+		condition.Message = strings.Join(pending, "\n")
+	}
+	log.Info("Checked Config Connector dependents", "reason", condition.Reason, "pending", len(pending), "failed", len(failed))
+	return updated, setTargetCondition(target, condition)
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestPubSubTopic(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "pubsub.cnrm.cloud.google.com/v1beta1",
+		"kind":       "PubSubTopic",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default", "generation": int64(1)},
+		"spec": map[string]interface{}{
+			"messageRetentionDuration": "86400s",
+			"labels":                   map[string]interface{}{"app": "inference"},
+		},
+	}}
+}
+
+func TestIsConfigConnectorKind(t *testing.T) {
+	assert.True(t, isConfigConnectorKind(schema.GroupVersionKind{Group: "pubsub.cnrm.cloud.google.com", Version: "v1beta1", Kind: "PubSubTopic"}))
+	assert.True(t, isConfigConnectorKind(schema.GroupVersionKind{Group: "storage.cnrm.cloud.google.com", Version: "v1beta1", Kind: "StorageBucket"}))
+	assert.False(t, isConfigConnectorKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+	assert.False(t, isConfigConnectorKind(schema.GroupVersionKind{Group: "cloud.google.com", Version: "v1", Kind: "BackendConfig"}))
+}
+
+func TestConfigConnectorDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	desired := newTestPubSubTopic("results")
+
+	// Config Connector adds defaults and the resource ID to the spec.
+	existing := desired.DeepCopy()
+	_ = unstructured.SetNestedField(existing.Object, "results", "spec", "resourceID")
+	_ = unstructured.SetNestedField(existing.Object, "inference", "spec", "labels", "managed-by-cnrm")
+	existing.SetAnnotations(map[string]string{"cnrm.cloud.google.com/project-id": "my-project"})
+	changed, err := r.configConnectorDiff(existing, desired, testLogger())
+	require.NoError(t, err)
+	assert.False(t, changed, "fields set by Config Connector are not a difference")
+
+	changedSpec := desired.DeepCopy()
+	_ = unstructured.SetNestedField(changedSpec.Object, "3600s", "spec", "messageRetentionDuration")
+	changed, err = r.configConnectorDiff(existing, changedSpec, testLogger())
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	changedAnnotations := desired.DeepCopy()
+	changedAnnotations.SetAnnotations(map[string]string{"cnrm.cloud.google.com/project-id": "other-project"})
+	changed, err = r.configConnectorDiff(existing, changedAnnotations, testLogger())
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestContainsFields(t *testing.T) {
+	assert.True(t, containsFields(map[string]interface{}{"a": int64(1), "b": "x"}, map[string]interface{}{"a": 1}))
+	assert.False(t, containsFields(map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": 2}))
+	assert.False(t, containsFields("x", map[string]interface{}{"a": 1}))
+	assert.True(t, containsFields([]interface{}{map[string]interface{}{"role": "viewer", "etag": "abc"}}, []interface{}{map[string]interface{}{"role": "viewer"}}))
+	assert.False(t, containsFields([]interface{}{"a", "b"}, []interface{}{"a"}), "lists must have the same length")
+}
+
+func TestKeepServerSpecFields(t *testing.T) {
+	existing := newTestPubSubTopic("results")
+	_ = unstructured.SetNestedField(existing.Object, "results", "spec", "resourceID")
+	_ = unstructured.SetNestedField(existing.Object, "3600s", "spec", "messageRetentionDuration")
+	desired := newTestPubSubTopic("results")
+
+	keepServerSpecFields(existing, desired)
+
+	resourceID, _, _ := unstructured.NestedString(desired.Object, "spec", "resourceID")
+	assert.Equal(t, "results", resourceID)
+	retention, _, _ := unstructured.NestedString(desired.Object, "spec", "messageRetentionDuration")
+	assert.Equal(t, "86400s", retention, "fields of the template win")
+}
+
+func TestConfigConnectorReadiness(t *testing.T) {
+	ready := map[string]interface{}{"type": "Ready", "status": "True", "reason": "UpToDate"}
+	testCases := []struct {
+		name       string
+		generation int64
+		observed   int64
+		conditions []interface{}
+		status     string
+		failed     bool
+	}{
+		{name: "not reconciled yet", generation: 1, status: "Unknown"},
+		{name: "ready", generation: 1, observed: 1, conditions: []interface{}{ready}, status: "True"},
+		{name: "stale generation", generation: 2, observed: 1, conditions: []interface{}{ready}, status: "Unknown"},
+		{name: "provisioning", generation: 1, observed: 1, conditions: []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "reason": "Updating"}}, status: "False"},
+		{name: "failed", generation: 1, observed: 1, conditions: []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "reason": "UpdateFailed", "message": "permission denied"}}, status: "False", failed: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := newTestPubSubTopic("results")
+			obj.SetGeneration(tc.generation)
+			if tc.observed > 0 {
+				_ = unstructured.SetNestedField(obj.Object, tc.observed, "status", "observedGeneration")
+			}
+			if tc.conditions != nil {
+				_ = unstructured.SetNestedSlice(obj.Object, tc.conditions, "status", "conditions")
+			}
+			status, failed, _ := configConnectorReadiness(obj)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.failed, failed)
+		})
+	}
+}
+
+func TestCheckConfigConnectorDependents(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	newReconciler := func() (*GenericReconciler, *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		return &GenericReconciler{Gvk: targetGVK, Recorder: recorder}, recorder
+	}
+	cloudResourcesReady := func(target *unstructured.Unstructured) *metav1.Condition {
+		return meta.FindStatusCondition(targetConditions(target), CloudResourcesReadyConditionType)
+	}
+	infos := []map[string]interface{}{
+		{"kind": "PubSubTopic", "name": "results", "namespace": "default", "status": "Created"},
+		{"kind": "Deployment", "name": "vllm", "namespace": "default", "status": "Created"},
+	}
+	objs := []*unstructured.Unstructured{newTestPubSubTopic("results"), newRolloutDeployment("vllm", "vllm:v1", 1)}
+
+	t.Run("without Config Connector dependents nothing is set", func(t *testing.T) {
+		r, _ := newReconciler()
+		target := newTestResource("test-resource", "default", targetGVK)
+		got, err := r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs[1:], infos, &mapResourceClient{objs: map[string]*unstructured.Unstructured{}})
+		require.NoError(t, err)
+		assert.Equal(t, infos, got)
+		assert.Nil(t, cloudResourcesReady(target))
+	})
+
+	t.Run("provisioning resources are pending", func(t *testing.T) {
+		r, _ := newReconciler()
+		target := newTestResource("test-resource", "default", targetGVK)
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{"results": newTestPubSubTopic("results")}}
+		got, err := r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs, infos, store)
+		require.NoError(t, err)
+
+		cond := cloudResourcesReady(target)
+		require.NotNil(t, cond)
+		assert.Equal(t, metav1.ConditionFalse, cond.Status)
+		assert.Equal(t, CloudResourcesProvisioningReason, cond.Reason)
+		assert.Equal(t, "Unknown", got[0]["ready"])
+		assert.NotContains(t, got[1], "ready")
+		assert.NotContains(t, infos[0], "ready", "the entries passed in are not modified")
+	})
+
+	t.Run("failed resources are reported once", func(t *testing.T) {
+		r, recorder := newReconciler()
+		target := newTestResource("test-resource", "default", targetGVK)
+		failed := newTestPubSubTopic("results")
+		_ = unstructured.SetNestedField(failed.Object, int64(1), "status", "observedGeneration")
+		_ = unstructured.SetNestedSlice(failed.Object, []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "reason": "UpdateFailed", "message": "permission denied"}}, "status", "conditions")
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{"results": failed}}
+
+		_, err := r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs, infos, store)
+		require.NoError(t, err)
+		cond := cloudResourcesReady(target)
+		require.NotNil(t, cond)
+		assert.Equal(t, CloudResourcesFailedReason, cond.Reason)
+		assert.Equal(t, "PubSubTopic results UpdateFailed: permission denied", cond.Message)
+		assert.Contains(t, <-recorder.Events, CloudResourcesFailedEvent)
+
+		_, err = r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs, infos, store)
+		require.NoError(t, err)
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("ready resources", func(t *testing.T) {
+		r, _ := newReconciler()
+		target := newTestResource("test-resource", "default", targetGVK)
+		ready := newTestPubSubTopic("results")
+		_ = unstructured.SetNestedField(ready.Object, int64(1), "status", "observedGeneration")
+		_ = unstructured.SetNestedSlice(ready.Object, []interface{}{map[string]interface{}{"type": "Ready", "status": "True", "reason": "UpToDate"}}, "status", "conditions")
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{"results": ready}}
+
+		got, err := r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs, infos, store)
+		require.NoError(t, err)
+		assert.Equal(t, metav1.ConditionTrue, cloudResourcesReady(target).Status)
+		assert.Equal(t, "True", got[0]["ready"])
+
+		// The condition is removed once the template stops rendering them.
+		_, err = r.checkConfigConnectorDependents(context.Background(), testLogger(), target, objs[1:], infos, store)
+		require.NoError(t, err)
+		assert.Nil(t, cloudResourcesReady(target))
+	})
+}
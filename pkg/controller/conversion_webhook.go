@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// IntegrationCRDName is the CustomResourceDefinition of Integrations.
+	IntegrationCRDName = "integrations.model.skippy.io"
+	// ConversionPath is where the webhook server converts Integrations
+	// between their versions.
+	ConversionPath = "/convert"
+	// DefaultConversionWebhookSyncInterval is how often the conversion is
+	// synced, so that a renewed CA is picked up.
+	DefaultConversionWebhookSyncInterval = time.Minute
+)
+
+// ConversionWebhookSync points the conversion of the Integration CRD at the
+// conversion webhook and serves all of its versions. The CRD is installed
+// with v1beta1 not served, as the API server cannot convert v1beta1
+// Integrations without the webhook.
+type ConversionWebhookSync struct {
+	// Reader reads the CRD, without caching every CRD of the cluster.
+	Reader client.Reader
+	Client client.Client
+	// Service serves the conversion webhook on port 443.
+	Service types.NamespacedName
+	// CAFile holds the PEM encoded CA of the serving certificate of the
+	// webhook, e.g. the ca.crt of a cert-manager Certificate. It is read on
+	// every sync.
+	CAFile string
+	// Interval overrides DefaultConversionWebhookSyncInterval.
+	Interval time.Duration
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that one
+// replica writes the CRD.
+func (s *ConversionWebhookSync) NeedLeaderElection() bool {
+	return true
+}
+
+// Start syncs the conversion until ctx is done.
+func (s *ConversionWebhookSync) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("conversion-webhook")
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultConversionWebhookSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil {
+			logger.Error(err, "Failed to sync the conversion of the Integration CRD")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync sets the conversion of the Integration CRD to the webhook and serves
+// every version, if they changed. The conversion is set in the same update
+// that serves v1beta1, so v1beta1 is never served without it.
+func (s *ConversionWebhookSync) Sync(ctx context.Context) error {
+	caBundle, err := os.ReadFile(s.CAFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the CA of the conversion webhook: %w", err)
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := s.Reader.Get(ctx, client.ObjectKey{Name: IntegrationCRDName}, crd); err != nil {
+		return fmt.Errorf("unable to get CustomResourceDefinition %s: %w", IntegrationCRDName, err)
+	}
+
+	path := ConversionPath
+	port := int32(443)
+	conversion := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: s.Service.Namespace,
+					Name:      s.Service.Name,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+	changed := !equality.Semantic.DeepEqual(crd.Spec.Conversion, conversion)
+	crd.Spec.Conversion = conversion
+	for i := range crd.Spec.Versions {
+		if !crd.Spec.Versions[i].Served {
+			crd.Spec.Versions[i].Served = true
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := s.Client.Update(ctx, crd); err != nil {
+		return fmt.Errorf("unable to update CustomResourceDefinition %s: %w", IntegrationCRDName, err)
+	}
+	log.FromContext(ctx).Info("Pointed the conversion of the Integration CRD at the conversion webhook", "service", s.Service.String())
+	return nil
+}
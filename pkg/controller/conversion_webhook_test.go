@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConversionWebhookSync(t *testing.T) {
+	ctx := context.Background()
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: IntegrationCRDName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+				{Name: "v1beta1", Served: false},
+			},
+		},
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(s))
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(crd).Build()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("ca"), 0o600))
+	sync := &ConversionWebhookSync{
+		Reader:  c,
+		Client:  c,
+		Service: types.NamespacedName{Namespace: "default", Name: "karo-webhook-service"},
+		CAFile:  caFile,
+	}
+
+	require.NoError(t, sync.Sync(ctx))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(crd), crd))
+	require.NotNil(t, crd.Spec.Conversion)
+	assert.Equal(t, apiextensionsv1.WebhookConverter, crd.Spec.Conversion.Strategy)
+	clientConfig := crd.Spec.Conversion.Webhook.ClientConfig
+	assert.Equal(t, "karo-webhook-service", clientConfig.Service.Name)
+	assert.Equal(t, ConversionPath, *clientConfig.Service.Path)
+	assert.Equal(t, []byte("ca"), clientConfig.CABundle)
+	assert.True(t, crd.Spec.Versions[1].Served)
+
+	// An unchanged conversion is not written again.
+	version := crd.ResourceVersion
+	require.NoError(t, sync.Sync(ctx))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(crd), crd))
+	assert.Equal(t, version, crd.ResourceVersion)
+
+	// v1beta1 is not served without the CA.
+	sync.CAFile = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, sync.Sync(ctx))
+}
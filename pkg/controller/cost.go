@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// anyRegion holds the prices of a price sheet that apply to the regions
+	// it does not list.
+	anyRegion = "*"
+
+	regionLabel = "topology.kubernetes.io/region"
+)
+
+// acceleratorNodeLabels are the node labels that name the accelerator type of
+// GKE nodes, and acceleratorResources the resources that count accelerators.
+var (
+	acceleratorNodeLabels = []string{"cloud.google.com/gke-accelerator", "cloud.google.com/gke-tpu-accelerator"}
+	acceleratorResources  = []corev1.ResourceName{"nvidia.com/gpu", "google.com/tpu"}
+)
+
+var estimatedHourlyCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "karo_estimated_hourly_cost",
+	Help: "Approximate hourly cost of the accelerators of a custom resource, in the currency of the price sheet.",
+}, []string{"kind", "namespace", "name", "accelerator", "region"})
+
+func init() {
+	metrics.Registry.MustRegister(estimatedHourlyCost)
+}
+
+// PriceSheet holds the hourly prices of one accelerator of each type, per
+// region, e.g. regions["us-central1"]["nvidia-l4"]. The prices of the "*"
+// region apply to the regions that are not listed.
+type PriceSheet struct {
+	// Currency is reported next to the estimates, "USD" if not set.
+	Currency string `json:"currency,omitempty"`
+	// DefaultRegion is used when no node with the accelerator is labelled
+	// with its region, e.g. before the first node is provisioned.
+	DefaultRegion string                        `json:"defaultRegion,omitempty"`
+	Regions       map[string]map[string]float64 `json:"regions"`
+}
+
+// LoadPriceSheet reads a price sheet from a YAML or JSON file.
+func LoadPriceSheet(path string) (*PriceSheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open price sheet: %w", err)
+	}
+	defer f.Close()
+	sheet := &PriceSheet{}
+	if err := utilyaml.NewYAMLOrJSONDecoder(f, 4096).Decode(sheet); err != nil {
+		return nil, fmt.Errorf("failed to parse price sheet %s: %w", path, err)
+	}
+	if len(sheet.Regions) == 0 {
+		return nil, fmt.Errorf("price sheet %s has no regions", path)
+	}
+	for region, prices := range sheet.Regions {
+		for accelerator, price := range prices {
+			if price < 0 {
+				return nil, fmt.Errorf("price sheet %s has a negative price for %s in %s", path, accelerator, region)
+			}
+		}
+	}
+	if sheet.Currency == "" {
+		sheet.Currency = "USD"
+	}
+	return sheet, nil
+}
+
+// price returns the hourly price of one accelerator in region.
+func (s *PriceSheet) price(region, accelerator string) (float64, bool) {
+	if price, ok := s.Regions[region][accelerator]; ok {
+		return price, true
+	}
+	price, ok := s.Regions[anyRegion][accelerator]
+	return price, ok
+}
+
+// recordCostEstimate writes the approximate hourly cost of the accelerators
+// of target into status.estimatedCost and the karo_estimated_hourly_cost
+// metric. The cost is that of the workload reporting the accelerator chosen by
+// selectAccelerator (see recordAcceleratorSelection): its replicas times the
+// accelerators each of them requests, at the price of the region of the nodes
+// with that accelerator. Nothing is estimated without a price sheet.
+func (r *GenericReconciler) recordCostEstimate(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured) {
+	if r.PriceSheet == nil {
+		return
+	}
+	estimatedHourlyCost.DeletePartialMatch(prometheus.Labels{"kind": target.GetKind(), "namespace": target.GetNamespace(), "name": target.GetName()})
+
+	var workload *unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetAnnotations()[transformer.AcceleratorAnnotation] != "" {
+			workload = obj
+			break
+		}
+	}
+	if workload == nil {
+		unstructured.RemoveNestedField(target.Object, "status", "estimatedCost")
+		return
+	}
+	accelerator := workload.GetAnnotations()[transformer.AcceleratorAnnotation]
+	region := r.acceleratorRegion(ctx, log, accelerator)
+	price, ok := r.PriceSheet.price(region, accelerator)
+	if !ok {
+		log.Info("The price sheet has no price for the accelerator, not estimating cost", "accelerator", accelerator, "region", region)
+		unstructured.RemoveNestedField(target.Object, "status", "estimatedCost")
+		return
+	}
+
+	replicas := workloadReplicas(workload)
+	accelerators := replicas * acceleratorsPerReplica(workload)
+	hourly := price * float64(accelerators)
+	estimate := map[string]interface{}{
+		"hourly":       strconv.FormatFloat(hourly, 'f', 2, 64),
+		"currency":     r.PriceSheet.Currency,
+		"accelerator":  accelerator,
+		"accelerators": accelerators,
+		"replicas":     replicas,
+	}
+	if region != "" {
+		estimate["region"] = region
+	}
+	if err := unstructured.SetNestedField(target.Object, estimate, "status", "estimatedCost"); err != nil {
+		log.Error(err, "Failed to set cost estimate in status")
+		return
+	}
+	estimatedHourlyCost.WithLabelValues(target.GetKind(), target.GetNamespace(), target.GetName(), accelerator, region).Set(hourly)
+}
+
+// forgetCostEstimate removes the metric of a target that no longer exists.
+func forgetCostEstimate(kind, namespace, name string) {
+	estimatedHourlyCost.DeletePartialMatch(prometheus.Labels{"kind": kind, "namespace": namespace, "name": name})
+}
+
+// acceleratorRegion returns the region of the nodes with accelerator, or the
+// default region of the price sheet if none is labelled with one.
+func (r *GenericReconciler) acceleratorRegion(ctx context.Context, log logr.Logger, accelerator string) string {
+	if r.Client == nil {
+		return r.PriceSheet.DefaultRegion
+	}
+	for _, label := range acceleratorNodeLabels {
+		nodes := &corev1.NodeList{}
+		if err := r.Client.List(ctx, nodes, client.MatchingLabels{label: accelerator}); err != nil {
+			log.Error(err, "Failed to list nodes for the cost estimate, using the default region", "accelerator", accelerator)
+			return r.PriceSheet.DefaultRegion
+		}
+		for _, node := range nodes.Items {
+			if region := node.Labels[regionLabel]; region != "" {
+				return region
+			}
+		}
+	}
+	return r.PriceSheet.DefaultRegion
+}
+
+// workloadReplicas returns the number of pods that a workload runs at once.
+func workloadReplicas(obj *unstructured.Unstructured) int64 {
+	field := "replicas"
+	if obj.GetKind() == "Job" {
+		field = "parallelism"
+	}
+	if replicas, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", field); found {
+		if n, ok := countValue(replicas); ok {
+			return n
+		}
+	}
+	return 1
+}
+
+// acceleratorsPerReplica returns the accelerators that the containers of the
+// pod template of a workload request, at least one, as the workload was
+// reported to use an accelerator.
+func acceleratorsPerReplica(obj *unstructured.Unstructured) int64 {
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	var total int64
+	for _, rawContainer := range containers {
+		container, _ := rawContainer.(map[string]interface{})
+		for _, name := range acceleratorResources {
+			quantity, found, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", string(name))
+			if !found {
+				quantity, found, _ = unstructured.NestedFieldNoCopy(container, "resources", "requests", string(name))
+			}
+			if !found {
+				continue
+			}
+			if n, ok := countValue(quantity); ok {
+				total += n
+			}
+		}
+	}
+	if total < 1 {
+		return 1
+	}
+	return total
+}
+
+// countValue reads a count from a number or a quantity string.
+func countValue(value interface{}) (int64, bool) {
+	quantity, err := resource.ParseQuantity(fmt.Sprint(value))
+	if err != nil {
+		return 0, false
+	}
+	return quantity.Value(), true
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestLoadPriceSheet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	sheet, err := LoadPriceSheet(write("prices.yaml", `
+defaultRegion: us-central1
+regions:
+  us-central1:
+    nvidia-l4: 0.7
+  "*":
+    nvidia-l4: 0.8
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "USD", sheet.Currency)
+	price, ok := sheet.price("us-central1", "nvidia-l4")
+	assert.True(t, ok)
+	assert.Equal(t, 0.7, price)
+	price, ok = sheet.price("europe-west4", "nvidia-l4")
+	assert.True(t, ok, "unlisted regions use the prices of *")
+	assert.Equal(t, 0.8, price)
+	_, ok = sheet.price("us-central1", "nvidia-h100-80gb")
+	assert.False(t, ok)
+
+	_, err = LoadPriceSheet(write("empty.yaml", "currency: EUR\n"))
+	assert.ErrorContains(t, err, "has no regions")
+	_, err = LoadPriceSheet(write("negative.json", `{"regions": {"us-central1": {"nvidia-l4": -1}}}`))
+	assert.ErrorContains(t, err, "negative price")
+	_, err = LoadPriceSheet(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestRecordCostEstimate(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	s := runtime.NewScheme()
+	_ = corev1.AddToScheme(s)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-node", Labels: map[string]string{
+		"cloud.google.com/gke-accelerator": "nvidia-l4",
+		regionLabel:                        "europe-west4",
+	}}}
+	r := &GenericReconciler{
+		Client: fake.NewClientBuilder().WithScheme(s).WithObjects(node).Build(),
+		PriceSheet: &PriceSheet{Currency: "USD", DefaultRegion: "us-central1", Regions: map[string]map[string]float64{
+			"us-central1":  {"nvidia-l4": 0.7, "nvidia-h100-80gb": 11},
+			"europe-west4": {"nvidia-l4": 0.75},
+		}},
+	}
+
+	newWorkload := func(accelerator string, replicas int64, gpus string) *unstructured.Unstructured {
+		deployment := newTestResource("vllm", "default", schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+		deployment.SetAnnotations(map[string]string{transformer.AcceleratorAnnotation: accelerator})
+		_ = unstructured.SetNestedField(deployment.Object, replicas, "spec", "replicas")
+		_ = unstructured.SetNestedSlice(deployment.Object, []interface{}{map[string]interface{}{
+			"name":      "server",
+			"resources": map[string]interface{}{"limits": map[string]interface{}{"nvidia.com/gpu": gpus}},
+		}}, "spec", "template", "spec", "containers")
+		return deployment
+	}
+
+	target := newTestResource("test-resource", "default", gvk)
+	r.recordCostEstimate(context.Background(), testLogger(), target, []*unstructured.Unstructured{newWorkload("nvidia-l4", 3, "2")})
+	estimate, found, err := unstructured.NestedMap(target.Object, "status", "estimatedCost")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, map[string]interface{}{
+		"hourly":       "4.50",
+		"currency":     "USD",
+		"accelerator":  "nvidia-l4",
+		"accelerators": int64(6),
+		"replicas":     int64(3),
+		"region":       "europe-west4",
+	}, estimate, "the region is read from the nodes with the accelerator")
+	assert.Equal(t, 4.5, testutil.ToFloat64(estimatedHourlyCost.WithLabelValues("TestResource", "default", "test-resource", "nvidia-l4", "europe-west4")))
+
+	// Without nodes with the accelerator, the default region is used.
+	r.recordCostEstimate(context.Background(), testLogger(), target, []*unstructured.Unstructured{newWorkload("nvidia-h100-80gb", 1, "8")})
+	hourly, _, _ := unstructured.NestedString(target.Object, "status", "estimatedCost", "hourly")
+	assert.Equal(t, "88.00", hourly)
+	assert.Equal(t, 1, testutil.CollectAndCount(estimatedHourlyCost), "the series of the previous accelerator is removed")
+
+	// Accelerators without a price are not estimated.
+	r.recordCostEstimate(context.Background(), testLogger(), target, []*unstructured.Unstructured{newWorkload("tpu-v5-lite-podslice", 1, "4")})
+	_, found, _ = unstructured.NestedFieldNoCopy(target.Object, "status", "estimatedCost")
+	assert.False(t, found)
+	assert.Equal(t, 0, testutil.CollectAndCount(estimatedHourlyCost))
+
+	r.recordCostEstimate(context.Background(), testLogger(), target, []*unstructured.Unstructured{newWorkload("nvidia-l4", 1, "1")})
+	forgetCostEstimate("TestResource", "default", "test-resource")
+	assert.Equal(t, 0, testutil.CollectAndCount(estimatedHourlyCost))
+}
+
+func TestAcceleratorsPerReplica(t *testing.T) {
+	job := newTestJob("finetune")
+	_ = unstructured.SetNestedField(job.Object, int64(4), "spec", "parallelism")
+	assert.Equal(t, int64(4), workloadReplicas(job))
+	assert.Equal(t, int64(1), acceleratorsPerReplica(job), "a workload reported to use an accelerator uses at least one")
+
+	_ = unstructured.SetNestedSlice(job.Object, []interface{}{
+		map[string]interface{}{"name": "trainer", "resources": map[string]interface{}{"requests": map[string]interface{}{"google.com/tpu": int64(4)}}},
+		map[string]interface{}{"name": "sidecar"},
+	}, "spec", "template", "spec", "containers")
+	assert.Equal(t, int64(4), acceleratorsPerReplica(job))
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// deletePropagation returns the propagation policy for deleting dependents of
+// the given kind: the one set in the integration, or fallback. A nil policy
+// leaves the choice to the API of the kind.
+func (r *GenericReconciler) deletePropagation(gk schema.GroupKind, fallback *metav1.DeletionPropagation) *metav1.DeletionPropagation {
+	if r.Transformer == nil {
+		return fallback
+	}
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(r.Gvk)
+	for _, spec := range integrationSpec.DeletePropagation {
+		if spec.Group == gk.Group && spec.Kind == gk.Kind {
+			policy := spec.Policy
+			return &policy
+		}
+	}
+	return fallback
+}
+
+// deleteOptions returns the options for deleting a dependent of the given
+// kind with the client, see deletePropagation.
+func (r *GenericReconciler) deleteOptions(gk schema.GroupKind, fallback *metav1.DeletionPropagation) []client.DeleteOption {
+	if policy := r.deletePropagation(gk, fallback); policy != nil {
+		return []client.DeleteOption{client.PropagationPolicy(*policy)}
+	}
+	return nil
+}
+
+// deleteDependent deletes a dependent through rc, with the propagation policy
+// of its kind. A dependent that is already gone is not an error.
+func (r *GenericReconciler) deleteDependent(ctx context.Context, rc modelv1.ResourceClientInterface, obj *unstructured.Unstructured, fallback *metav1.DeletionPropagation) error {
+	gvk := obj.GroupVersionKind()
+	policy := r.deletePropagation(gvk.GroupKind(), fallback)
+	if err := rc.Delete(ctx, gvk, obj.GetNamespace(), obj.GetName(), policy); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newPropagationReconciler(specs ...modelv1.IntegrationDeletePropagationSpec) *GenericReconciler {
+	return &GenericReconciler{
+		Gvk: eventTestGVK,
+		Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+			return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+				return modelv1.IntegrationSpec{DeletePropagation: specs}, true
+			}}
+		}},
+	}
+}
+
+func TestDeletePropagation(t *testing.T) {
+	r := newPropagationReconciler(
+		modelv1.IntegrationDeletePropagationSpec{Group: "batch", Kind: "Job", Policy: metav1.DeletePropagationForeground},
+		modelv1.IntegrationDeletePropagationSpec{Kind: "PersistentVolumeClaim", Policy: metav1.DeletePropagationOrphan},
+	)
+	background := metav1.DeletePropagationBackground
+
+	assert.Equal(t, metav1.DeletePropagationForeground, *r.deletePropagation(schema.GroupKind{Group: "batch", Kind: "Job"}, &background))
+	assert.Equal(t, metav1.DeletePropagationOrphan, *r.deletePropagation(schema.GroupKind{Kind: "PersistentVolumeClaim"}, nil))
+	assert.Equal(t, &background, r.deletePropagation(schema.GroupKind{Group: "apps", Kind: "Deployment"}, &background))
+	assert.Nil(t, r.deletePropagation(schema.GroupKind{Group: "apps", Kind: "Deployment"}, nil))
+	assert.Empty(t, r.deleteOptions(schema.GroupKind{Group: "apps", Kind: "Deployment"}, nil))
+	assert.Len(t, r.deleteOptions(schema.GroupKind{Group: "batch", Kind: "Job"}, nil), 1)
+
+	// Without an integration, the fallback is used.
+	assert.Equal(t, &background, (&GenericReconciler{}).deletePropagation(schema.GroupKind{Group: "batch", Kind: "Job"}, &background))
+}
+
+func TestDeleteDependent(t *testing.T) {
+	r := newPropagationReconciler(modelv1.IntegrationDeletePropagationSpec{Group: "batch", Kind: "Job", Policy: metav1.DeletePropagationForeground})
+	job := newTestJob("download")
+
+	var got *metav1.DeletionPropagation
+	rc := &MockResourceClient{DeleteFunc: func(_ context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *metav1.DeletionPropagation) error {
+		assert.Equal(t, "Job", gvk.Kind)
+		assert.Equal(t, job.GetNamespace(), namespace)
+		assert.Equal(t, "download", name)
+		got = propagation
+		return errors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "jobs"}, name)
+	}}
+	background := metav1.DeletePropagationBackground
+	require.NoError(t, r.deleteDependent(context.Background(), rc, job, &background), "a dependent that is already gone is not an error")
+	require.NotNil(t, got)
+	assert.Equal(t, metav1.DeletePropagationForeground, *got)
+}
+
+func TestResourceClientDelete(t *testing.T) {
+	job := newTestJob("download")
+	rc := &ResourceClient{dynClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), job)}
+
+	orphan := metav1.DeletePropagationOrphan
+	require.NoError(t, rc.Delete(context.Background(), job.GroupVersionKind(), job.GetNamespace(), job.GetName(), &orphan))
+	_, err := rc.Get(context.Background(), job.GroupVersionKind(), job.GetNamespace(), job.GetName())
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	DependencyNotReadyReason   = "DependencyNotReady"
+	DependencyTimedOutReason   = "DependencyTimedOut"
+	DependenciesReadyReason    = "DependenciesReady"
+	WaitingForDependencyReason = "WaitingForDependency"
+	WaitingForDependencyEvent  = modelv1.EventReasonWaitingForDependency
+	DependencyTimedOutEvent    = modelv1.EventReasonDependencyTimedOut
+
+	// DefaultDependencyTimeout is the default of how long the templates of a
+	// resource may wait for an object with waitFor.
+	DefaultDependencyTimeout = 30 * time.Minute
+	// DefaultDependencyRequeueInterval is the default delay before the first
+	// retry of a render that waits for an object. The delay doubles with
+	// every retry, up to PermanentErrorRequeueAfter.
+	DefaultDependencyRequeueInterval = 5 * time.Second
+)
+
+// setDependencyCondition sets the Waiting condition of a target whose render
+// waits for an object, and returns renderErr with the delay before the
+// render is retried: the time the target has waited so far, but at least
+// DependencyRequeueInterval, so that the delay doubles with each retry. Once the target has waited longer than
+// DependencyTimeout, the render fails as a template error instead. The
+// condition is cleared by the next render that does not wait.
+func (r *GenericReconciler) setDependencyCondition(target *unstructured.Unstructured, renderErr error) (classified error, conditionErr error) {
+	existing := meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+	waiting := existing != nil && existing.Status == metav1.ConditionTrue &&
+		(existing.Reason == DependencyNotReadyReason || existing.Reason == DependencyTimedOutReason)
+
+	var dependencyErr *transformer.DependencyNotReadyError
+	if !stderrors.As(renderErr, &dependencyErr) {
+		if renderErr != nil || !waiting {
+			return renderErr, nil
+		}
+		return nil, setTargetCondition(target, metav1.Condition{
+			Type:               WaitingConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             DependenciesReadyReason,
+			Message:            "All objects that the templates wait for are ready.",
+			ObservedGeneration: target.GetGeneration(),
+		})
+	}
+
+	waited := time.Duration(0)
+	if waiting {
+		waited = time.Since(existing.LastTransitionTime.Time)
+	}
+	condition := metav1.Condition{
+		Type:               WaitingConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             DependencyNotReadyReason,
+		Message:            fmt.Sprintf("Not rendering %s %s: %v", target.GetKind(), target.GetName(), dependencyErr),
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if r.DependencyTimeout > 0 && waited >= r.DependencyTimeout {
+		err := fmt.Errorf("gave up waiting after %s: %w", r.DependencyTimeout, dependencyErr)
+		condition.Reason = DependencyTimedOutReason
+		condition.Message = fmt.Sprintf("Not rendering %s %s: %v", target.GetKind(), target.GetName(), err)
+		if existing.Reason != DependencyTimedOutReason {
+			r.eventf(target, corev1.EventTypeWarning, DependencyTimedOutEvent, "%s", condition.Message)
+		}
+		return &ClassifiedError{Class: TemplateError, Err: err}, setTargetCondition(target, condition)
+	}
+	if !waiting {
+		r.eventf(target, corev1.EventTypeNormal, WaitingForDependencyEvent, "%s", condition.Message)
+	}
+	interval := r.DependencyRequeueInterval
+	if interval <= 0 {
+		interval = DefaultDependencyRequeueInterval
+	}
+	backoff := min(max(waited, interval), PermanentErrorRequeueAfter)
+	return &ClassifiedError{Class: ExternalDependencyNotReady, RetryAfter: backoff, Err: renderErr}, setTargetCondition(target, condition)
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// backdateWaiting moves the start of the wait of target back by d.
+func backdateWaiting(t *testing.T, target *unstructured.Unstructured, d time.Duration) {
+	conditions := targetConditions(target)
+	condition := meta.FindStatusCondition(conditions, WaitingConditionType)
+	require.NotNil(t, condition)
+	condition.LastTransitionTime = metav1.NewTime(condition.LastTransitionTime.Add(-d))
+	require.NoError(t, unstructured.SetNestedSlice(target.Object, conditionsToUnstructured(conditions), "status", "conditions"))
+}
+
+// readyReason returns the reason of the Ready condition of target after a
+// reconcile that failed with err.
+func readyReason(t *testing.T, r *GenericReconciler, target *unstructured.Unstructured, err error) string {
+	conditions, buildErr := r.buildConditions(context.Background(), target, true, err)
+	require.NoError(t, buildErr)
+	for _, condition := range conditions {
+		if condition.(map[string]interface{})["type"] == ReadyConditionType {
+			return condition.(map[string]interface{})["reason"].(string)
+		}
+	}
+	return ""
+}
+
+func TestSetDependencyCondition(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder, DependencyTimeout: time.Hour}
+	target := newTestResource("llama", "default", eventTestGVK)
+	notReady := fmt.Errorf("template failed: %w", &transformer.DependencyNotReadyError{
+		Kind: "ModelData.model.skippy.io", Namespace: "default", Name: "weights",
+		JSONPath: "{.status.phase}", Expected: "Succeeded", Actual: "Syncing",
+	})
+
+	err, conditionErr := r.setDependencyCondition(target, notReady)
+	require.NoError(t, conditionErr)
+	assert.Equal(t, ExternalDependencyNotReady, classifyError(err))
+	assert.Equal(t, DefaultDependencyRequeueInterval, retryAfter(err))
+	condition := meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, DependencyNotReadyReason, condition.Reason)
+	assert.Contains(t, condition.Message, `waiting for {.status.phase} of ModelData.model.skippy.io default/weights to be "Succeeded"`)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal WaitingForDependency")
+
+	// The backoff grows with the time waited, and the event is not repeated.
+	backdateWaiting(t, target, 40*time.Second)
+	err, _ = r.setDependencyCondition(target, notReady)
+	assert.InDelta(t, float64(40*time.Second), float64(retryAfter(err)), float64(time.Second))
+	backdateWaiting(t, target, 20*time.Minute)
+	err, _ = r.setDependencyCondition(target, notReady)
+	assert.Equal(t, PermanentErrorRequeueAfter, retryAfter(err))
+	assert.Empty(t, recorder.Events)
+
+	assert.Equal(t, WaitingForDependencyReason, readyReason(t, r, target, err))
+
+	// Past the timeout, the render fails.
+	backdateWaiting(t, target, time.Hour)
+	err, conditionErr = r.setDependencyCondition(target, notReady)
+	require.NoError(t, conditionErr)
+	assert.Equal(t, TemplateError, classifyError(err))
+	assert.ErrorContains(t, err, "gave up waiting after 1h0m0s")
+	var dependencyErr *transformer.DependencyNotReadyError
+	assert.True(t, stderrors.As(err, &dependencyErr))
+	condition = meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+	assert.Equal(t, DependencyTimedOutReason, condition.Reason)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning DependencyTimedOut")
+	_, _ = r.setDependencyCondition(target, notReady)
+	assert.Empty(t, recorder.Events)
+
+	assert.Equal(t, DependencyTimedOutReason, readyReason(t, r, target, err))
+
+	// Other render errors leave the condition alone.
+	otherErr := stderrors.New("template: bad")
+	err, _ = r.setDependencyCondition(target, otherErr)
+	assert.Equal(t, otherErr, err)
+	assert.Equal(t, DependencyTimedOutReason, meta.FindStatusCondition(targetConditions(target), WaitingConditionType).Reason)
+
+	// A render that does not wait clears the condition.
+	err, conditionErr = r.setDependencyCondition(target, nil)
+	require.NoError(t, err)
+	require.NoError(t, conditionErr)
+	condition = meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, DependenciesReadyReason, condition.Reason)
+
+	// Targets that never waited do not get the condition.
+	other := newTestResource("other", "default", eventTestGVK)
+	_, _ = r.setDependencyCondition(other, nil)
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), WaitingConditionType))
+}
+
+func TestSetDependencyConditionWithoutTimeout(t *testing.T) {
+	r := &GenericReconciler{Recorder: record.NewFakeRecorder(10), DependencyRequeueInterval: 30 * time.Second}
+	target := newTestResource("llama", "default", eventTestGVK)
+	notReady := &transformer.DependencyNotReadyError{Kind: "Service", Namespace: "default", Name: "llama", Missing: true}
+
+	err, _ := r.setDependencyCondition(target, notReady)
+	assert.Equal(t, 30*time.Second, retryAfter(err))
+	backdateWaiting(t, target, 24*time.Hour)
+	err, _ = r.setDependencyCondition(target, notReady)
+	assert.Equal(t, ExternalDependencyNotReady, classifyError(err))
+	assert.Equal(t, PermanentErrorRequeueAfter, retryAfter(err))
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// DefaultMaxStatusDependents is the default number of dependents kept in
+// status.dependentResources.
+const DefaultMaxStatusDependents = 100
+
+// dependentInventoryName returns the name of the ConfigMap that holds all the
+// dependents of target, if status.dependentResources holds only some of them.
+func dependentInventoryName(target *unstructured.Unstructured) string {
+	return target.GetName() + "-dependents"
+}
+
+// limitDependents returns at most limit of dependents, those that were not
+// processed first, both in their order. Zero keeps all of them.
+func limitDependents(dependents []map[string]interface{}, limit int) []map[string]interface{} {
+	if limit <= 0 || len(dependents) <= limit {
+		return dependents
+	}
+	limited := make([]map[string]interface{}, 0, limit)
+	for _, failed := range []bool{true, false} {
+		for _, dependent := range dependents {
+			if len(limited) == limit {
+				return limited
+			}
+			status, _ := dependent["status"].(string)
+			if (status != "Processed" && status != DryRunStatus) == failed {
+				limited = append(limited, dependent)
+			}
+		}
+	}
+	return limited
+}
+
+// recordDependents sets status.dependentResources of target to dependents.
+// If they are more than MaxStatusDependents, the status holds only that many,
+// and all of them are stored in a ConfigMap controlled by target, whose name
+// is recorded in status.dependentInventory. Cluster-scoped targets, which
+// have no namespace for the ConfigMap, keep all of them in their status, and
+// so do targets under DryRunAll, whose ConfigMap would not be stored.
+func (r *GenericReconciler) recordDependents(ctx context.Context, target *unstructured.Unstructured, dependents []map[string]interface{}) error {
+	limited := dependents
+	if target.GetNamespace() != "" && !r.DryRunAll {
+		limited = limitDependents(dependents, r.MaxStatusDependents)
+	}
+	if len(limited) < len(dependents) {
+		if err := r.storeDependentInventory(ctx, target, dependents); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(target.Object, dependentInventoryName(target), "status", "dependentInventory"); err != nil {
+			return err
+		}
+	} else if _, found, _ := unstructured.NestedString(target.Object, "status", "dependentInventory"); found {
+		if err := r.deleteDependentInventory(ctx, target); err != nil {
+			return err
+		}
+		unstructured.RemoveNestedField(target.Object, "status", "dependentInventory")
+	}
+
+	recorded := make([]interface{}, len(limited))
+	for i, dependent := range limited {
+		recorded[i] = dependent
+	}
+	return unstructured.SetNestedField(target.Object, recorded, "status", "dependentResources")
+}
+
+// storeDependentInventory creates or replaces the dependent inventory
+// ConfigMap of target. It returns a *NameCollisionError if a ConfigMap of
+// that name exists that target does not own.
+func (r *GenericReconciler) storeDependentInventory(ctx context.Context, target *unstructured.Unstructured, dependents []map[string]interface{}) error {
+	data, err := json.Marshal(dependents)
+	if err != nil {
+		return fmt.Errorf("failed to encode the dependent inventory: %w", err)
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: target.GetNamespace(),
+		Name:      dependentInventoryName(target),
+	}}
+	if err := controllerutil.SetControllerReference(target, configMap, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set the owner of the dependent inventory: %w", err)
+	}
+	configMap.Data = map[string]string{transformer.DependentInventoryKey: string(data)}
+
+	err = r.Client.Create(ctx, configMap)
+	if apierrors.IsAlreadyExists(err) {
+		existing := &corev1.ConfigMap{}
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(configMap), existing); err != nil {
+			return fmt.Errorf("failed to get the dependent inventory: %w", err)
+		}
+		if collision := dependentInventoryCollision(existing, target); collision != "" {
+			return &NameCollisionError{Collisions: []string{collision}}
+		}
+		existing.OwnerReferences = configMap.OwnerReferences
+		existing.Data = configMap.Data
+		err = r.Client.Update(ctx, existing)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store the dependent inventory: %w", err)
+	}
+	return nil
+}
+
+// dependentInventoryCollision describes why the existing ConfigMap cannot be
+// the dependent inventory of target, or returns "" if target owns it.
+// Inventories stored before they were controlled by their target only have
+// an owner reference to it.
+func dependentInventoryCollision(existing *corev1.ConfigMap, target *unstructured.Unstructured) string {
+	for _, ref := range existing.OwnerReferences {
+		if ref.UID == target.GetUID() {
+			return ""
+		}
+	}
+	if owner := metav1.GetControllerOf(existing); owner != nil {
+		return fmt.Sprintf("ConfigMap %s/%s of the dependent inventory is owned by %s %s", existing.Namespace, existing.Name, owner.Kind, owner.Name)
+	}
+	return fmt.Sprintf("ConfigMap %s/%s of the dependent inventory is not owned by %s %s", existing.Namespace, existing.Name, target.GetKind(), target.GetName())
+}
+
+// dependentInventoryTaken describes the collision if target needs a
+// dependent inventory for its dependents and a ConfigMap that it does not
+// own has its name, so that the collision is found before anything is
+// applied.
+func (r *GenericReconciler) dependentInventoryTaken(ctx context.Context, target *unstructured.Unstructured, dependents int) (string, error) {
+	if target.GetNamespace() == "" || r.DryRunAll || r.MaxStatusDependents <= 0 || dependents <= r.MaxStatusDependents {
+		return "", nil
+	}
+	existing := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: target.GetNamespace(), Name: dependentInventoryName(target)}, existing)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get the dependent inventory: %w", err)
+	}
+	return dependentInventoryCollision(existing, target), nil
+}
+
+// deleteDependentInventory deletes the dependent inventory ConfigMap of
+// target, once its status holds all of the dependents again.
+func (r *GenericReconciler) deleteDependentInventory(ctx context.Context, target *unstructured.Unstructured) error {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: target.GetNamespace(),
+		Name:      dependentInventoryName(target),
+	}}
+	if err := r.Client.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the dependent inventory: %w", err)
+	}
+	return nil
+}
+
+// recordedDependents returns all the dependents recorded for target: those in
+// its dependent inventory ConfigMap if status.dependentInventory is set, or
+// else those in status.dependentResources.
+func recordedDependents(ctx context.Context, c client.Reader, target *unstructured.Unstructured) ([]map[string]interface{}, error) {
+	name, found, _ := unstructured.NestedString(target.Object, "status", "dependentInventory")
+	if !found {
+		recorded, _, _ := unstructured.NestedSlice(target.Object, "status", "dependentResources")
+		return dependentMaps(recorded), nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: target.GetNamespace(), Name: name}, configMap); err != nil {
+		return nil, fmt.Errorf("failed to get the dependent inventory of %s %s: %w", target.GetKind(), target.GetName(), err)
+	}
+	// The JSON decoder of apimachinery keeps integers, e.g. the
+	// sourceGeneration of dependents, as int64 like the status does.
+	var recorded []interface{}
+	if err := utiljson.Unmarshal([]byte(configMap.Data[transformer.DependentInventoryKey]), &recorded); err != nil {
+		return nil, fmt.Errorf("invalid dependent inventory of %s %s: %w", target.GetKind(), target.GetName(), err)
+	}
+	return dependentMaps(recorded), nil
+}
+
+// dependentMaps returns the entries of recorded dependents that are maps.
+func dependentMaps(recorded []interface{}) []map[string]interface{} {
+	dependents := make([]map[string]interface{}, 0, len(recorded))
+	for _, dependent := range recorded {
+		if info, ok := dependent.(map[string]interface{}); ok {
+			dependents = append(dependents, info)
+		}
+	}
+	return dependents
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLimitDependents(t *testing.T) {
+	dependents := []map[string]interface{}{
+		{"name": "a", "status": "Processed"},
+		{"name": "b", "status": "Error: forbidden"},
+		{"name": "c", "status": "Processed"},
+		{"name": "d", "status": "Error: conflict"},
+	}
+	assert.Equal(t, dependents, limitDependents(dependents, 0))
+	assert.Equal(t, dependents, limitDependents(dependents, 4))
+	assert.Equal(t, []map[string]interface{}{dependents[1], dependents[3], dependents[0]}, limitDependents(dependents, 3))
+	assert.Equal(t, []map[string]interface{}{dependents[1]}, limitDependents(dependents, 1))
+}
+
+func TestRecordDependents(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	_ = corev1.AddToScheme(s)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).Build()
+	r := &GenericReconciler{Client: fakeClient, Scheme: s, MaxStatusDependents: 2}
+
+	target := &unstructured.Unstructured{}
+	target.SetAPIVersion("model.skippy.io/v1")
+	target.SetKind("InferenceDeployment")
+	target.SetNamespace("default")
+	target.SetName("llama")
+	target.SetUID("uid-1")
+	var dependents []map[string]interface{}
+	for i := 0; i < 3; i++ {
+		dependents = append(dependents, map[string]interface{}{"kind": "ConfigMap", "name": fmt.Sprintf("shard-%d", i), "status": "Processed", "sourceGeneration": int64(1)})
+	}
+
+	require.NoError(t, r.recordDependents(ctx, target, dependents))
+	recorded, _, _ := unstructured.NestedSlice(target.Object, "status", "dependentResources")
+	assert.Len(t, recorded, 2)
+	inventory, _, _ := unstructured.NestedString(target.Object, "status", "dependentInventory")
+	assert.Equal(t, "llama-dependents", inventory)
+	configMap := &corev1.ConfigMap{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "llama-dependents"}, configMap))
+	assert.Equal(t, "InferenceDeployment", configMap.OwnerReferences[0].Kind)
+
+	all, err := recordedDependents(ctx, fakeClient, target)
+	require.NoError(t, err)
+	assert.Equal(t, dependents, all, "the inventory keeps the types of the status")
+
+	// Once the dependents fit again, the inventory is deleted.
+	require.NoError(t, r.recordDependents(ctx, target, dependents[:2]))
+	_, found, _ := unstructured.NestedString(target.Object, "status", "dependentInventory")
+	assert.False(t, found)
+	err = fakeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "llama-dependents"}, configMap)
+	assert.True(t, apierrors.IsNotFound(err))
+	all, err = recordedDependents(ctx, fakeClient, target)
+	require.NoError(t, err)
+	assert.Equal(t, dependents[:2], all)
+
+	// Cluster-scoped targets keep all of them.
+	target.SetNamespace("")
+	require.NoError(t, r.recordDependents(ctx, target, dependents))
+	recorded, _, _ = unstructured.NestedSlice(target.Object, "status", "dependentResources")
+	assert.Len(t, recorded, 3)
+}
+
+func TestRecordDependentsInventoryCollision(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	_ = corev1.AddToScheme(s)
+	foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "llama-dependents"}}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(foreign).Build()
+	r := &GenericReconciler{Client: fakeClient, Scheme: s, MaxStatusDependents: 2}
+
+	target := &unstructured.Unstructured{}
+	target.SetAPIVersion("model.skippy.io/v1")
+	target.SetKind("InferenceDeployment")
+	target.SetNamespace("default")
+	target.SetName("llama")
+	target.SetUID("uid-1")
+	dependents := []map[string]interface{}{{"name": "a"}, {"name": "b"}, {"name": "c"}}
+
+	collision, err := r.dependentInventoryTaken(ctx, target, len(dependents))
+	require.NoError(t, err)
+	assert.Equal(t, "ConfigMap default/llama-dependents of the dependent inventory is not owned by InferenceDeployment llama", collision)
+	collision, err = r.dependentInventoryTaken(ctx, target, 2)
+	require.NoError(t, err)
+	assert.Empty(t, collision, "no inventory is needed")
+
+	var collisionErr *NameCollisionError
+	assert.ErrorAs(t, r.recordDependents(ctx, target, dependents), &collisionErr)
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(foreign), foreign))
+	assert.Empty(t, foreign.Data, "the ConfigMap is not overwritten")
+
+	// Dry runs keep all dependents in the status, as the inventory would
+	// not be stored.
+	r.DryRunAll = true
+	require.NoError(t, r.recordDependents(ctx, target, dependents))
+	recorded, _, _ := unstructured.NestedSlice(target.Object, "status", "dependentResources")
+	assert.Len(t, recorded, 3)
+	_, found, _ := unstructured.NestedString(target.Object, "status", "dependentInventory")
+	assert.False(t, found)
+}
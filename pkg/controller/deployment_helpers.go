@@ -12,6 +12,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
 )
 
 func (r *GenericReconciler) deploymentDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
@@ -43,6 +45,14 @@ func (r *GenericReconciler) deploymentDiff(existingObj, obj *unstructured.Unstru
 		return true, nil
 	}
 
+	// A changed checksum of the configuration rolls out the pods.
+	existingChecksum, _, _ := unstructured.NestedString(existingObj.Object, "spec", "template", "metadata", "annotations", transformer.ConfigChecksumAnnotation)
+	newChecksum, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "metadata", "annotations", transformer.ConfigChecksumAnnotation)
+	if existingChecksum != newChecksum {
+		log.Info("Found a difference in the configuration checksum for Deployment", "existing", existingChecksum, "new", newChecksum)
+		return true, nil
+	}
+
 	return false, nil
 }
 
@@ -286,19 +296,15 @@ func getResourceList(resourcesMap map[string]interface{}, key string, log logr.L
 }
 
 // Helper to canonicalize resource.Quantity for reliable DeepEqual comparison
-// This ensures that "1Gi" and "1073741824" (bytes) compare as equal
+// This ensures that "1Gi" and "1073741824" (bytes) compare as equal. The form
+// of each resource comes from the quantity forms, see AddQuantityForms.
 func canonicalizeResourceQuantity(resourceName corev1.ResourceName, q resource.Quantity) resource.Quantity {
-	switch resourceName {
-	case corev1.ResourceCPU:
-		// Always canonicalize CPU to millicores (DecimalSI)
-		return *resource.NewMilliQuantity(q.MilliValue(), resource.DecimalSI)
-	case corev1.ResourceMemory, "nvidia.com/gpu": // Assuming GPU quantities are also treated like memory or other binary units for simplicity if not millicores
-		// Always canonicalize memory/binary units to bytes (BinarySI)
-		return *resource.NewQuantity(q.Value(), resource.BinarySI)
-	default:
-		// For unknown resources, keep the original format or choose a default
-		return q // Or consider canonicalizing to Value() and a default format like BinarySI
+	form, ok := quantityFormOf(resourceName)
+	if !ok {
+		// For unknown resources, keep the original format
+		return q
 	}
+	return form.canonical(q)
 }
 
 func getEnvVarSource(valueFromMap map[string]interface{}) *corev1.EnvVarSource {
@@ -8,6 +8,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
 )
 
 func TestDeploymentDiff(t *testing.T) {
@@ -224,6 +226,18 @@ func TestDeploymentDiff(t *testing.T) {
 			// This is the key assertion. We expect NO diff.
 			expectDiff: false,
 		},
+		{
+			name:        "changed configuration checksum",
+			existingDep: withConfigChecksum(newUnstructuredDeployment(t, "test-dep", 1, defaultContainersList, baseSA, nil, nil), "abc"),
+			desiredDep:  withConfigChecksum(newUnstructuredDeployment(t, "test-dep", 1, defaultContainersList, baseSA, nil, nil), "def"),
+			expectDiff:  true,
+		},
+		{
+			name:        "same configuration checksum",
+			existingDep: withConfigChecksum(newUnstructuredDeployment(t, "test-dep", 1, defaultContainersList, baseSA, nil, nil), "abc"),
+			desiredDep:  withConfigChecksum(newUnstructuredDeployment(t, "test-dep", 1, defaultContainersList, baseSA, nil, nil), "abc"),
+			expectDiff:  false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -283,6 +297,48 @@ func TestCanonicalizeResourceQuantity(t *testing.T) {
 			input:        resource.MustParse("1"),
 			expected:     *resource.NewQuantity(1, resource.BinarySI),
 		},
+		{
+			name:         "TPU - google.com/tpu",
+			resourceName: "google.com/tpu",
+			input:        resource.MustParse("4"),
+			expected:     *resource.NewQuantity(4, resource.BinarySI),
+		},
+		{
+			name:         "GPU - amd.com/gpu",
+			resourceName: "amd.com/gpu",
+			input:        resource.MustParse("2"),
+			expected:     *resource.NewQuantity(2, resource.BinarySI),
+		},
+		{
+			name:         "GPU - nvidia.com/mig partition",
+			resourceName: "nvidia.com/mig-1g.10gb",
+			input:        resource.MustParse("1"),
+			expected:     *resource.NewQuantity(1, resource.BinarySI),
+		},
+		{
+			name:         "Ephemeral storage - decimal suffix",
+			resourceName: corev1.ResourceEphemeralStorage,
+			input:        resource.MustParse("10G"),
+			expected:     *resource.NewQuantity(10*1000*1000*1000, resource.BinarySI),
+		},
+		{
+			name:         "Storage - Gi",
+			resourceName: corev1.ResourceStorage,
+			input:        resource.MustParse("100Gi"),
+			expected:     *resource.NewQuantity(100*1024*1024*1024, resource.BinarySI),
+		},
+		{
+			name:         "Hugepages - 2Mi",
+			resourceName: "hugepages-2Mi",
+			input:        resource.MustParse("512Mi"),
+			expected:     *resource.NewQuantity(512*1024*1024, resource.BinarySI),
+		},
+		{
+			name:         "Hugepages - 1Gi in bytes",
+			resourceName: "hugepages-1Gi",
+			input:        resource.MustParse("2147483648"),
+			expected:     *resource.NewQuantity(2*1024*1024*1024, resource.BinarySI),
+		},
 		{
 			name:         "Unknown resource",
 			resourceName: "example.com/foo",
@@ -301,6 +357,61 @@ func TestCanonicalizeResourceQuantity(t *testing.T) {
 	}
 }
 
+func TestCanonicalizeResourceQuantitySpellings(t *testing.T) {
+	// Each pair is written differently in a template and on the live object.
+	for resourceName, spellings := range map[corev1.ResourceName][2]resource.Quantity{
+		corev1.ResourceEphemeralStorage: {resource.MustParse("1Gi"), resource.MustParse("1073741824")},
+		"hugepages-2Mi":                 {resource.MustParse("1Gi"), resource.MustParse("1024Mi")},
+		"google.com/tpu":                {resource.MustParse("4"), *resource.NewQuantity(4, resource.DecimalSI)},
+	} {
+		first := canonicalizeResourceQuantity(resourceName, spellings[0])
+		second := canonicalizeResourceQuantity(resourceName, spellings[1])
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("%s: canonicalizeResourceQuantity() = %v and %v, want equal", resourceName, first, second)
+		}
+	}
+}
+
+func TestAddQuantityForms(t *testing.T) {
+	forms, err := ParseQuantityForms("example.com/fpga=decimal, example.com/vram-*=binary,example.com/vram-hbm-*=milli,")
+	if err != nil {
+		t.Fatalf("ParseQuantityForms() error = %v", err)
+	}
+	want := QuantityForms{"example.com/fpga": QuantityFormDecimal, "example.com/vram-*": QuantityFormBinary, "example.com/vram-hbm-*": QuantityFormMilli}
+	if !reflect.DeepEqual(forms, want) {
+		t.Fatalf("ParseQuantityForms() = %v, want %v", forms, want)
+	}
+	for _, value := range []string{"example.com/fpga", "=binary", "example.com/fpga=bytes"} {
+		if _, err := ParseQuantityForms(value); err == nil {
+			t.Errorf("ParseQuantityForms(%q) succeeded, want an error", value)
+		}
+	}
+
+	AddQuantityForms(forms)
+	t.Cleanup(func() {
+		quantityFormsMu.Lock()
+		defer quantityFormsMu.Unlock()
+		for name := range forms {
+			delete(quantityForms, name)
+		}
+	})
+	tests := []struct {
+		resourceName corev1.ResourceName
+		input        resource.Quantity
+		expected     resource.Quantity
+	}{
+		{"example.com/fpga", resource.MustParse("1k"), *resource.NewQuantity(1000, resource.DecimalSI)},
+		{"example.com/vram-gddr", resource.MustParse("16Gi"), *resource.NewQuantity(16*1024*1024*1024, resource.BinarySI)},
+		// The longest prefix wins.
+		{"example.com/vram-hbm-3", resource.MustParse("1"), *resource.NewMilliQuantity(1000, resource.DecimalSI)},
+	}
+	for _, tt := range tests {
+		if actual := canonicalizeResourceQuantity(tt.resourceName, tt.input); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("canonicalizeResourceQuantity(%s) = %v, want %v", tt.resourceName, actual, tt.expected)
+		}
+	}
+}
+
 func simpleContainerMap(name, image string, args []string, env []corev1.EnvVar, resources *corev1.ResourceRequirements) map[string]interface{} {
 	container := map[string]interface{}{
 		"name":  name,
@@ -565,3 +676,8 @@ func csiVolumeSourceMap(driver string, readOnly *bool, attributes map[string]str
 func boolPtr(b bool) *bool {
 	return &b
 }
+
+func withConfigChecksum(deployment *unstructured.Unstructured, checksum string) *unstructured.Unstructured {
+	unstructured.SetNestedField(deployment.Object, checksum, "spec", "template", "metadata", "annotations", transformer.ConfigChecksumAnnotation)
+	return deployment
+}
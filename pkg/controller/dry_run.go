@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DryRunStatus is the status of the dependentResources entries of
+	// targets whose dependents were only dry-run, see
+	// IntegrationReconciler.DryRunAll.
+	DryRunStatus = "DryRun"
+	// DryRunReason is the reason of the Unknown Ready condition of targets
+	// whose dependents passed the dry-run.
+	DryRunReason = "DryRun"
+)
+
+// dryRunOption returns the DryRun option of writes of a client that only
+// dry-runs them.
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// dryRunClient sends every write of the generic reconcilers and their kind
+// reconcilers with dry-run=server, and logs the change it would have made.
+// Status writes are not dry-run, so that the status and conditions of the
+// targets still tell what a reconcile would do.
+type dryRunClient struct {
+	client.Client
+}
+
+// newDryRunClient wraps c so that its writes, other than those of status, are
+// only dry-run.
+func newDryRunClient(c client.Client) client.Client {
+	return &dryRunClient{Client: c}
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.logWrite(ctx, "create", obj)
+	return c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.logWrite(ctx, "update", obj)
+	return c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.logWrite(ctx, "patch", obj)
+	return c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.logWrite(ctx, "delete", obj)
+	return c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.logWrite(ctx, "delete all of", obj)
+	return c.Client.DeleteAllOf(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+// logWrite logs a write that is only dry-run. Typed objects have no kind, so
+// it is looked up in the scheme.
+func (c *dryRunClient) logWrite(ctx context.Context, operation string, obj client.Object) {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	logDryRun(ctx, operation, kind, obj.GetNamespace(), obj.GetName())
+}
+
+func logDryRun(ctx context.Context, operation, kind, namespace, name string) {
+	log.FromContext(ctx).Info("Dry run, not persisting "+operation, "kind", kind, "namespace", namespace, "name", name)
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRunClient(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}, Data: map[string]string{"MODEL": "llama"}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "llama", Namespace: "default"}}
+	c := newDryRunClient(fake.NewClientBuilder().WithScheme(s).WithObjects(existing, pod).WithStatusSubresource(pod).Build())
+
+	created := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "default"}}
+	require.NoError(t, c.Create(ctx, created))
+	assert.True(t, errors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(created), &corev1.ConfigMap{})))
+
+	updated := existing.DeepCopy()
+	updated.Data["MODEL"] = "gemma"
+	require.NoError(t, c.Update(ctx, updated))
+	require.NoError(t, c.Patch(ctx, updated, client.RawPatch(types.MergePatchType, []byte(`{"data":{"MODEL":"gemma"}}`))))
+	require.NoError(t, c.Delete(ctx, existing.DeepCopy()))
+	live := &corev1.ConfigMap{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(existing), live))
+	assert.Equal(t, map[string]string{"MODEL": "llama"}, live.Data)
+
+	// Status is still written.
+	livePod := &corev1.Pod{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pod), livePod))
+	livePod.Status.Phase = corev1.PodRunning
+	require.NoError(t, c.Status().Update(ctx, livePod))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pod), livePod))
+	assert.Equal(t, corev1.PodRunning, livePod.Status.Phase)
+}
+
+func TestResourceClientDryRun(t *testing.T) {
+	ctx := context.Background()
+	job := newTestJob("download")
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		dryRun := req.URL.Query().Get("dryRun")
+		if req.Method == http.MethodDelete {
+			// Delete options are sent in the body.
+			options := metav1.DeleteOptions{}
+			_ = json.NewDecoder(req.Body).Decode(&options)
+			dryRun = strings.Join(options.DryRun, ",")
+		}
+		requests = append(requests, req.Method+" dryRun="+dryRun)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(job.Object)
+	}))
+	defer server.Close()
+	dynClient, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	rc := &ResourceClient{dynClient: dynClient, fieldManager: "karo/model", dryRun: true}
+	gvk := job.GroupVersionKind()
+
+	_, err = rc.Create(ctx, gvk, "default", newTestJob("convert"))
+	require.NoError(t, err)
+	_, err = rc.Update(ctx, gvk, "default", job.DeepCopy())
+	require.NoError(t, err)
+	_, err = rc.Patch(ctx, gvk, "default", job.GetName(), types.MergePatchType, []byte(`{"metadata":{"labels":{"app":"download"}}}`))
+	require.NoError(t, err)
+	require.NoError(t, rc.Delete(ctx, gvk, "default", job.GetName(), nil))
+	assert.Equal(t, []string{"POST dryRun=All", "PUT dryRun=All", "PATCH dryRun=All", "DELETE dryRun=All"}, requests)
+
+	// Reads are not affected, and writes are only dry-run when asked to.
+	requests = nil
+	_, err = rc.Get(ctx, gvk, "default", job.GetName())
+	require.NoError(t, err)
+	rc.dryRun = false
+	_, err = rc.Update(ctx, gvk, "default", job.DeepCopy())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET dryRun=", "PUT dryRun="}, requests)
+}
+
+func TestBuildConditionsDryRun(t *testing.T) {
+	target := newTestResource("llama", "default", eventTestGVK)
+	conditions, err := (&GenericReconciler{DryRunAll: true}).buildConditions(context.Background(), target, false, nil)
+	require.NoError(t, err)
+	target.Object["status"] = map[string]interface{}{"conditions": conditions}
+	ready := meta.FindStatusCondition(targetConditions(target), ReadyConditionType)
+	require.NotNil(t, ready)
+	assert.Equal(t, metav1.ConditionUnknown, ready.Status)
+	assert.Equal(t, DryRunReason, ready.Reason)
+
+	// Failures are reported as usual.
+	conditions, err = (&GenericReconciler{DryRunAll: true}).buildConditions(context.Background(), target, true, &PolicyViolationError{})
+	require.NoError(t, err)
+	target.Object["status"] = map[string]interface{}{"conditions": conditions}
+	assert.Equal(t, metav1.ConditionFalse, meta.FindStatusCondition(targetConditions(target), ReadyConditionType).Status)
+}
+
+func TestDryRunEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder, DryRunAll: true}
+	target := newTestResource("llama", "default", eventTestGVK)
+	r.eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Successfully created %s %s", "Service", "llama")
+	assert.Equal(t, "Normal DependentCreated Dry run: Successfully created Service llama", <-recorder.Events)
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// These specs run the operator against a real API server: the Integration and
+// Agent CRDs are installed, the embedded agent templates are rendered through
+// kustomize and the dependents are applied with the dynamic client. They catch
+// what the mocked transformer and resource client cannot, such as wrong
+// resource plurals or scopes. They are skipped unless KUBEBUILDER_ASSETS points
+// at the envtest binaries, as set by "make test".
+var _ = Describe("Integration end to end", Ordered, Label("envtest"), func() {
+	const (
+		timeout  = 30 * time.Second
+		interval = 250 * time.Millisecond
+	)
+
+	var (
+		testEnv *envtest.Environment
+		k8s     client.Client
+		ctx     context.Context
+		cancel  context.CancelFunc
+	)
+
+	agentGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}
+
+	BeforeAll(func() {
+		if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+			Skip("KUBEBUILDER_ASSETS is not set")
+		}
+
+		testEnv = &envtest.Environment{
+			// The files are listed because config/crd/bases also holds an empty
+			// placeholder CRD that the API server rejects.
+			CRDInstallOptions: envtest.CRDInstallOptions{
+				Paths: []string{
+					filepath.Join("..", "..", "config", "crd", "bases", "model.skippy.io_integrations.yaml"),
+					filepath.Join("..", "..", "install", "helm", "crds", "agent_crd.yaml"),
+				},
+			},
+			ErrorIfCRDPathMissing: true,
+		}
+		cfg, err := testEnv.Start()
+		Expect(err).NotTo(HaveOccurred())
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(modelv1.AddToScheme(scheme)).To(Succeed())
+
+		// The suite may build further managers for the same kinds.
+		skipNameValidation := true
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:     scheme,
+			Metrics:    metricsserver.Options{BindAddress: "0"},
+			Controller: config.Controller{SkipNameValidation: &skipNameValidation},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciler := &IntegrationReconciler{
+			Client:          mgr.GetClient(),
+			Manager:         mgr,
+			Transformer:     transformer.NewTransformer(),
+			Scheme:          mgr.GetScheme(),
+			RestConfig:      cfg,
+			KindReconcilers: DefaultKindReconcilers,
+		}
+		Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
+
+		k8s = mgr.GetClient()
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+	})
+
+	AfterAll(func() {
+		if cancel != nil {
+			cancel()
+		}
+		if testEnv != nil {
+			Expect(testEnv.Stop()).To(Succeed())
+		}
+	})
+
+	It("renders the dependents of an Agent and reports them in its status", func() {
+		integration := &modelv1.Integration{
+			ObjectMeta: metav1.ObjectMeta{Name: "skippy-integrations", Namespace: "default"},
+			Spec: []modelv1.IntegrationSpec{{
+				Group:   agentGVK.Group,
+				Version: agentGVK.Version,
+				Kind:    agentGVK.Kind,
+				Templates: []modelv1.IntegrationApiTemplatesSpec{
+					{Operation: "template", Path: "embedded:/v1/agent/template"},
+				},
+				Hashes: []modelv1.IntegrationApiHashSpec{},
+			}},
+		}
+		Expect(k8s.Create(ctx, integration)).To(Succeed())
+
+		agent := &unstructured.Unstructured{}
+		agent.SetGroupVersionKind(agentGVK)
+		agent.SetName("weather")
+		agent.SetNamespace("default")
+		Expect(unstructured.SetNestedMap(agent.Object, map[string]interface{}{
+			"image":      "us-docker.pkg.dev/example/agents/weather:1.0.0",
+			"adkVersion": "1.0.0",
+			"port":       int64(8080),
+		}, "spec")).To(Succeed())
+
+		// The Agent controller is only registered once the Integration has
+		// been reconciled, so the Agent may be created before it watches.
+		Expect(k8s.Create(ctx, agent)).To(Succeed())
+		key := client.ObjectKeyFromObject(agent)
+
+		By("creating the Deployment and Service owned by the Agent")
+		deployment := &appsv1.Deployment{}
+		Eventually(func() error {
+			return k8s.Get(ctx, key, deployment)
+		}, timeout, interval).Should(Succeed())
+		service := &corev1.Service{}
+		Eventually(func() error {
+			return k8s.Get(ctx, key, service)
+		}, timeout, interval).Should(Succeed())
+
+		Expect(k8s.Get(ctx, key, agent)).To(Succeed())
+		for _, owned := range []client.Object{deployment, service} {
+			owner := metav1.GetControllerOf(owned)
+			Expect(owner).NotTo(BeNil(), "%T has no controller reference", owned)
+			Expect(owner.Kind).To(Equal(agentGVK.Kind))
+			Expect(owner.UID).To(Equal(agent.GetUID()))
+		}
+		Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(1))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("us-docker.pkg.dev/example/agents/weather:1.0.0"))
+		Expect(service.Spec.Ports).To(HaveLen(1))
+		Expect(service.Spec.Ports[0].TargetPort.IntValue()).To(Equal(8080))
+
+		By("reporting the dependents in the status of the Agent")
+		Eventually(func(g Gomega) {
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(agentGVK)
+			g.Expect(k8s.Get(ctx, key, current)).To(Succeed())
+
+			observed, _, _ := unstructured.NestedInt64(current.Object, "status", "observedGeneration")
+			g.Expect(observed).To(Equal(current.GetGeneration()))
+			count, _, _ := unstructured.NestedInt64(current.Object, "status", "createdResourceCount")
+			g.Expect(count).To(Equal(int64(2)))
+
+			dependents, _, _ := unstructured.NestedSlice(current.Object, "status", "dependentResources")
+			kinds := []string{}
+			for _, dependent := range dependents {
+				entry := dependent.(map[string]interface{})
+				g.Expect(entry).To(HaveKeyWithValue("status", "Processed"))
+				kinds = append(kinds, entry["kind"].(string))
+			}
+			g.Expect(kinds).To(ConsistOf("Deployment", "Service"))
+
+			conditions := targetConditions(current)
+			g.Expect(conditions).To(ContainElement(And(
+				HaveField("Type", ReadyConditionType),
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", ReconciliationSucceededReason),
+			)))
+		}, timeout, interval).Should(Succeed())
+	})
+})
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// ErrorClass says why a reconcile failed, and so how it is retried.
+type ErrorClass string
+
+const (
+	// TransientAPIError is a failure that may go away on its own, e.g. a
+	// timeout, a conflict or an unavailable API server. It is retried with
+	// backoff.
+	TransientAPIError ErrorClass = "TransientAPIError"
+	// TemplateError is a template that cannot be rendered. It is retried
+	// after PermanentErrorRequeueAfter, as the templates may be changed in
+	// their bucket without an event.
+	TemplateError ErrorClass = "TemplateError"
+	// ValidationError is a resource or rendered dependents that are rejected,
+	// e.g. for missing required fields or exceeding a quota. It is retried
+	// after PermanentErrorRequeueAfter.
+	ValidationError ErrorClass = "ValidationError"
+	// ExternalDependencyNotReady is a required kind, a context API or an
+	// object that a template waits for that is not ready yet. It is retried after the delay the dependency asks for,
+	// or RequirementsRecheckInterval.
+	ExternalDependencyNotReady ErrorClass = "ExternalDependencyNotReady"
+
+	// ErrorClassAnnotation is set on the warning events of failed reconciles.
+	ErrorClassAnnotation = "model.skippy.io/error-class"
+
+	TransientAPIErrorReason          = "TransientAPIError"
+	TemplateErrorReason              = "TemplateError"
+	ValidationFailedReason           = "ValidationFailed"
+	ExternalDependencyNotReadyReason = "ExternalDependencyNotReady"
+)
+
+// PermanentErrorRequeueAfter is how long to wait before a target that failed
+// with a template or validation error is reconciled again. Such errors are
+// fixed by a change to the target, which is reconciled right away, or to
+// something the operator does not watch, so they are neither retried with
+// backoff nor given up.
+const PermanentErrorRequeueAfter = 5 * time.Minute
+
+var reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "karo_reconcile_errors_total",
+	Help: "Failed reconciles of custom resources by kind and error class.",
+}, []string{"kind", "class"})
+
+func init() {
+	metrics.Registry.MustRegister(reconcileErrors)
+}
+
+// ClassifiedError attaches an ErrorClass to an error, for failures that
+// cannot be classified by their type.
+type ClassifiedError struct {
+	Class ErrorClass
+	// RetryAfter is the delay an external dependency asked for, or zero.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError returns the class of a reconcile error, or "" for nil. Errors
+// that are not known to be permanent or waiting are transient, so that they
+// keep being retried with backoff as before.
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+	var classified *ClassifiedError
+	var waitErr *RequirementsNotReadyError
+	var capabilityErr *MissingClusterCapabilityError
+	var contextErr *transformer.ContextRequestError
+	var dependencyErr *transformer.DependencyNotReadyError
+	var renderErr *transformer.RenderError
+	var specErr *SpecInvalidError
+	var imagePolicyErr *transformer.ImagePolicyError
+	var capacityErr *AcceleratorCapacityError
+	var quotaErr *QuotaExceededError
+	var collisionErr *NameCollisionError
+	var preflightErr *PreflightError
+	var patchConflictErr *PatchConflictError
+	var policyErr *PolicyViolationError
+	var typedApplyErr *TypedApplyError
+	switch {
+	case stderrors.As(err, &classified):
+		return classified.Class
+	case stderrors.As(err, &waitErr), stderrors.As(err, &capabilityErr), stderrors.As(err, &contextErr), stderrors.As(err, &dependencyErr):
+		return ExternalDependencyNotReady
+	case stderrors.As(err, &renderErr):
+		return TemplateError
+	case stderrors.As(err, &specErr), stderrors.As(err, &imagePolicyErr), stderrors.As(err, &capacityErr), stderrors.As(err, &quotaErr), stderrors.As(err, &collisionErr), stderrors.As(err, &preflightErr), stderrors.As(err, &patchConflictErr), stderrors.As(err, &policyErr), stderrors.As(err, &typedApplyErr):
+		return ValidationError
+	case errors.IsInvalid(err), errors.IsBadRequest(err):
+		// The API server rejected a rendered dependent.
+		return ValidationError
+	}
+	return TransientAPIError
+}
+
+// errorReason returns the reason of the Ready condition for a reconcile that
+// failed with err and has no more specific reason.
+func errorReason(err error) string {
+	switch classifyError(err) {
+	case TransientAPIError:
+		return TransientAPIErrorReason
+	case TemplateError:
+		return TemplateErrorReason
+	case ValidationError:
+		return ValidationFailedReason
+	case ExternalDependencyNotReady:
+		return ExternalDependencyNotReadyReason
+	}
+	return ReconciliationFailedReason
+}
+
+// retryAfter returns the delay that an external dependency asked for, or
+// zero.
+func retryAfter(err error) time.Duration {
+	var classified *ClassifiedError
+	if stderrors.As(err, &classified) && classified.RetryAfter > 0 {
+		return classified.RetryAfter
+	}
+	var contextErr *transformer.ContextRequestError
+	if stderrors.As(err, &contextErr) {
+		return contextErr.RetryAfter
+	}
+	var capabilityErr *MissingClusterCapabilityError
+	if stderrors.As(err, &capabilityErr) {
+		return ClusterCapabilityRecheckInterval
+	}
+	return 0
+}
+
+// failedResult counts a failed reconcile of the kind and returns how it is
+// retried, depending on the class of err.
+func (r *GenericReconciler) failedResult(err error) (ctrl.Result, error) {
+	class := classifyError(err)
+	reconcileErrors.WithLabelValues(r.Gvk.Kind, string(class)).Inc()
+	switch class {
+	case ExternalDependencyNotReady:
+		if after := retryAfter(err); after > 0 {
+			return ctrl.Result{RequeueAfter: after}, nil
+		}
+		return ctrl.Result{RequeueAfter: RequirementsRecheckInterval}, nil
+	case TemplateError, ValidationError:
+		return ctrl.Result{RequeueAfter: PermanentErrorRequeueAfter}, nil
+	}
+	return ctrl.Result{}, err
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestClassifyError(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name       string
+		err        error
+		wantClass  ErrorClass
+		wantReason string
+	}{
+		{name: "nil", err: nil, wantClass: "", wantReason: ReconciliationFailedReason},
+		{name: "unknown", err: stderrors.New("connection refused"), wantClass: TransientAPIError, wantReason: TransientAPIErrorReason},
+		{name: "conflict", err: errors.NewConflict(deployments, "server", stderrors.New("modified")), wantClass: TransientAPIError, wantReason: TransientAPIErrorReason},
+		{name: "render", err: fmt.Errorf("error walking path: %w", &transformer.RenderError{Path: "deployment.yaml", Err: stderrors.New("bad")}), wantClass: TemplateError, wantReason: TemplateErrorReason},
+		{name: "context request", err: fmt.Errorf("unable to resolve context: %w", &transformer.ContextRequestError{Name: "model", StatusCode: 503}), wantClass: ExternalDependencyNotReady, wantReason: ExternalDependencyNotReadyReason},
+		{name: "requirements", err: &RequirementsNotReadyError{Unready: []string{"example.com/v1/Missing is not served"}}, wantClass: ExternalDependencyNotReady, wantReason: ExternalDependencyNotReadyReason},
+		{name: "spec invalid", err: &SpecInvalidError{Missing: []string{"spec.model"}}, wantClass: ValidationError, wantReason: ValidationFailedReason},
+		{name: "image policy", err: &transformer.ImagePolicyError{Kind: "Deployment", Name: "sandbox", Image: "miner", Reason: "matches none of the allowed images"}, wantClass: ValidationError, wantReason: ValidationFailedReason},
+		{name: "quota", err: &QuotaExceededError{Limit: "budget"}, wantClass: ValidationError, wantReason: ValidationFailedReason},
+		{name: "invalid dependent", err: dependentErrors{stderrors.New("timeout"), fmt.Errorf("error creating resource: %w", errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "server", nil))}, wantClass: ValidationError, wantReason: ValidationFailedReason},
+		{name: "explicit", err: fmt.Errorf("wrapped: %w", &ClassifiedError{Class: TemplateError, Err: stderrors.New("bad")}), wantClass: TemplateError, wantReason: TemplateErrorReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantClass, classifyError(tt.err))
+			assert.Equal(t, tt.wantReason, errorReason(tt.err))
+		})
+	}
+}
+
+func TestFailedResult(t *testing.T) {
+	r := &GenericReconciler{Gvk: eventTestGVK}
+	failures := func(class ErrorClass) float64 {
+		return testutil.ToFloat64(reconcileErrors.WithLabelValues(eventTestGVK.Kind, string(class)))
+	}
+
+	transientErr := stderrors.New("connection refused")
+	before := failures(TransientAPIError)
+	result, err := r.failedResult(transientErr)
+	assert.Equal(t, transientErr, err, "transient errors are retried with backoff")
+	assert.True(t, result.IsZero())
+	assert.Equal(t, before+1, failures(TransientAPIError))
+
+	result, err = r.failedResult(&SpecInvalidError{Missing: []string{"spec.model"}})
+	require.NoError(t, err)
+	assert.Equal(t, PermanentErrorRequeueAfter, result.RequeueAfter)
+
+	result, err = r.failedResult(&RequirementsNotReadyError{Unready: []string{"example.com/v1/Missing is not served"}})
+	require.NoError(t, err)
+	assert.Equal(t, RequirementsRecheckInterval, result.RequeueAfter)
+
+	result, err = r.failedResult(fmt.Errorf("unable to resolve context: %w", &transformer.ContextRequestError{Name: "model", StatusCode: 429, RetryAfter: 30 * time.Second}))
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, result.RequeueAfter, "the delay asked for by the context API is used")
+}
+
+func TestErrorEventf(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	recorder.IncludeObject = true
+	r := &GenericReconciler{Recorder: recorder}
+	target := newTestResource("llama", "team-a", eventTestGVK)
+
+	r.errorEventf(target, &QuotaExceededError{Limit: "budget"}, QuotaExceededEvent, "Not applying dependents of %s", target.GetName())
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning QuotaExceeded Not applying dependents of llama"), event)
+	assert.Contains(t, event, ErrorClassAnnotation+":"+string(ValidationError))
+}
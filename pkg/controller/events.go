@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// EventPolicy controls how chatty the reconcilers are when recording events.
+type EventPolicy string
+
+const (
+	// EventPolicyNone records no events, e.g. when events are collected from
+	// status and logs instead.
+	EventPolicyNone EventPolicy = "none"
+	// EventPolicyTransitions only records events for real changes: created or
+	// updated dependents, failures, and the Ready condition becoming true.
+	EventPolicyTransitions EventPolicy = "transitions"
+	// EventPolicyAll records every event on every reconcile. Useful for
+	// debugging, but floods `kubectl describe` on the periodic requeue loop.
+	EventPolicyAll EventPolicy = "all"
+
+	// EventPolicyVerbose is the former name of EventPolicyAll.
+	//
+	// Deprecated: use EventPolicyAll.
+	EventPolicyVerbose = EventPolicyAll
+)
+
+// ParseEventPolicy validates an event policy flag value. "verbose" is accepted
+// for EventPolicyAll.
+func ParseEventPolicy(value string) (EventPolicy, error) {
+	switch EventPolicy(value) {
+	case "", EventPolicyTransitions:
+		return EventPolicyTransitions, nil
+	case EventPolicyNone:
+		return EventPolicyNone, nil
+	case EventPolicyAll, "verbose":
+		return EventPolicyAll, nil
+	}
+	return "", fmt.Errorf("invalid event policy %q (must be '%s', '%s' or '%s')", value, EventPolicyNone, EventPolicyTransitions, EventPolicyAll)
+}
+
+// eventf records an event unless events are disabled.
+func (r *GenericReconciler) eventf(object runtime.Object, eventType string, reason modelv1.EventReason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil || r.EventPolicy == EventPolicyNone {
+		return
+	}
+	r.Recorder.Eventf(object, eventType, string(reason), r.eventMessage(messageFmt), args...)
+}
+
+// errorEventf records a warning event for a reconcile that failed with err,
+// annotated with the ErrorClassAnnotation of err, unless events are disabled.
+func (r *GenericReconciler) errorEventf(object runtime.Object, err error, reason modelv1.EventReason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil || r.EventPolicy == EventPolicyNone {
+		return
+	}
+	annotations := map[string]string{ErrorClassAnnotation: string(classifyError(err))}
+	r.Recorder.AnnotatedEventf(object, annotations, corev1.EventTypeWarning, string(reason), r.eventMessage(messageFmt), args...)
+}
+
+// eventMessage marks the events of reconcilers that only dry-run their
+// writes, so that they are not mistaken for changes that were made.
+func (r *GenericReconciler) eventMessage(messageFmt string) string {
+	if r.DryRunAll {
+		return "Dry run: " + messageFmt
+	}
+	return messageFmt
+}
+
+// verboseEventf records an event only when every event is recorded.
+func (r *GenericReconciler) verboseEventf(object runtime.Object, eventType string, reason modelv1.EventReason, messageFmt string, args ...interface{}) {
+	if r.EventPolicy != EventPolicyAll {
+		return
+	}
+	r.eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// isReadyForGeneration returns true if the object already reports a true Ready
+// condition for its current generation.
+func isReadyForGeneration(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, rawCond := range conditions {
+		cond, ok := rawCond.(map[string]interface{})
+		if !ok || getStringValue(cond, "type") != ReadyConditionType {
+			continue
+		}
+		observedGeneration, _, _ := unstructured.NestedInt64(cond, "observedGeneration")
+		return getStringValue(cond, "status") == "True" && observedGeneration == obj.GetGeneration()
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+var eventTestGVK = schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+
+func TestParseEventPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    EventPolicy
+		wantErr bool
+	}{
+		{"", EventPolicyTransitions, false},
+		{"transitions", EventPolicyTransitions, false},
+		{"none", EventPolicyNone, false},
+		{"all", EventPolicyAll, false},
+		{"verbose", EventPolicyAll, false},
+		{"loud", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEventPolicy(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEventPolicy(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseEventPolicy(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestVerboseEventf(t *testing.T) {
+	target := newTestResource("test-resource", "default", eventTestGVK)
+
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder, EventPolicy: EventPolicyTransitions}
+	r.verboseEventf(target, corev1.EventTypeNormal, StatusUpdatedEvent, "Status updated")
+	r.eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Created")
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected only the non-verbose event to be recorded, got %d events", len(recorder.Events))
+	}
+
+	r.EventPolicy = EventPolicyAll
+	r.verboseEventf(target, corev1.EventTypeNormal, StatusUpdatedEvent, "Status updated")
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected verbose event to be recorded, got %d events", len(recorder.Events))
+	}
+
+	r.EventPolicy = EventPolicyNone
+	r.eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Created")
+	r.errorEventf(target, fmt.Errorf("failed"), TransformerRunFailedEvent, "Failed")
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected no events to be recorded, got %d events", len(recorder.Events))
+	}
+
+	// A nil recorder must not panic.
+	(&GenericReconciler{}).eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Created")
+}
+
+func TestIsReadyForGeneration(t *testing.T) {
+	obj := newTestResource("test-resource", "default", eventTestGVK)
+	obj.SetGeneration(2)
+	if isReadyForGeneration(obj) {
+		t.Error("object without conditions should not be ready")
+	}
+
+	setReady := func(status string, observedGeneration int64) {
+		unstructured.SetNestedSlice(obj.Object, []interface{}{
+			map[string]interface{}{
+				"type":               ReadyConditionType,
+				"status":             status,
+				"observedGeneration": observedGeneration,
+			},
+		}, "status", "conditions")
+	}
+
+	setReady("True", 1)
+	if isReadyForGeneration(obj) {
+		t.Error("ready condition for an older generation should not count")
+	}
+	setReady("False", 2)
+	if isReadyForGeneration(obj) {
+		t.Error("false ready condition should not count")
+	}
+	setReady("True", 2)
+	if !isReadyForGeneration(obj) {
+		t.Error("true ready condition for the current generation should count")
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"slices"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NewFairQueue returns a work queue that takes the requests of the
+// namespaces in turn, instead of first in, first out, so that a tenant that
+// creates hundreds of resources at once does not delay the resources of the
+// other namespaces until all of its own are reconciled. Within a namespace,
+// requests are taken in the order they were added. It can be used as the
+// NewQueue option of a controller.
+func NewFairQueue(controllerName string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	return newQueue(controllerName, rateLimiter, &namespaceFairQueue{})
+}
+
+// newQueue returns a work queue that keeps the requests that are ready in
+// storage.
+func newQueue(controllerName string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request], storage workqueue.Queue[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	queue := workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[reconcile.Request]{
+		Name:  controllerName,
+		Queue: storage,
+	})
+	return workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{
+		Name: controllerName,
+		DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[reconcile.Request]{
+			Name:  controllerName,
+			Queue: queue,
+		}),
+	})
+}
+
+// namespaceFairQueue holds the requests that are ready to be reconciled, a
+// FIFO per namespace, and pops the namespaces round-robin. It implements
+// workqueue.Queue, whose callers deduplicate the requests and hold the lock.
+type namespaceFairQueue struct {
+	// fifo puts the requests of all namespaces into one line.
+	fifo bool
+	// namespaces are the namespaces with requests, in the order they are
+	// taken in; the first is next.
+	namespaces []string
+	requests   map[string][]reconcile.Request
+	len        int
+}
+
+var _ workqueue.Queue[reconcile.Request] = &namespaceFairQueue{}
+
+// Touch implements workqueue.Queue. A request that is added again keeps its
+// place.
+func (q *namespaceFairQueue) Touch(reconcile.Request) {}
+
+// Push implements workqueue.Queue.
+func (q *namespaceFairQueue) Push(request reconcile.Request) {
+	if q.requests == nil {
+		q.requests = map[string][]reconcile.Request{}
+	}
+	namespace := q.line(request)
+	if len(q.requests[namespace]) == 0 {
+		q.namespaces = append(q.namespaces, namespace)
+	}
+	q.requests[namespace] = append(q.requests[namespace], request)
+	q.len++
+}
+
+// Len implements workqueue.Queue.
+func (q *namespaceFairQueue) Len() int {
+	return q.len
+}
+
+// Pop implements workqueue.Queue. It takes the oldest request of the next
+// namespace, which then goes to the back of the line if it has more.
+func (q *namespaceFairQueue) Pop() reconcile.Request {
+	namespace := q.namespaces[0]
+	q.namespaces = q.namespaces[1:]
+	requests := q.requests[namespace]
+	request := requests[0]
+	// Clear the slot so that the backing array does not keep the request.
+	requests[0] = reconcile.Request{}
+	if requests = requests[1:]; len(requests) > 0 {
+		q.requests[namespace] = requests
+		q.namespaces = append(q.namespaces, namespace)
+	} else {
+		delete(q.requests, namespace)
+	}
+	q.len--
+	return request
+}
+
+// remove removes a queued request.
+func (q *namespaceFairQueue) remove(request reconcile.Request) {
+	namespace := q.line(request)
+	requests := q.requests[namespace]
+	i := slices.Index(requests, request)
+	if i < 0 {
+		return
+	}
+	if requests = slices.Delete(requests, i, i+1); len(requests) > 0 {
+		q.requests[namespace] = requests
+	} else {
+		delete(q.requests, namespace)
+		q.namespaces = slices.DeleteFunc(q.namespaces, func(n string) bool { return n == namespace })
+	}
+	q.len--
+}
+
+// line returns the line of request.
+func (q *namespaceFairQueue) line(request reconcile.Request) string {
+	if q.fifo {
+		return ""
+	}
+	return request.Namespace
+}
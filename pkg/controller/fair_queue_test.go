@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestFairQueue(t *testing.T) {
+	request := func(namespace, name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+	}
+	queue := NewFairQueue("", workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+
+	// A tenant creates many resources before two others create one each.
+	for _, name := range []string{"a1", "a2", "a3", "a4"} {
+		queue.Add(request("tenant-a", name))
+	}
+	queue.Add(request("tenant-b", "b1"))
+	queue.Add(request("tenant-a", "a1"))
+	queue.Add(request("tenant-c", "c1"))
+	queue.Add(request("tenant-b", "b2"))
+	assert.Equal(t, 7, queue.Len(), "requests that are queued already are not added again")
+
+	var order []string
+	for queue.Len() > 0 {
+		item, _ := queue.Get()
+		order = append(order, item.Name)
+		queue.Done(item)
+	}
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2", "b2", "a3", "a4"}, order)
+
+	// Requests that are added while they are processed are queued when done.
+	queue.Add(request("tenant-a", "a1"))
+	item, _ := queue.Get()
+	queue.Add(request("tenant-a", "a1"))
+	queue.Add(request("tenant-b", "b1"))
+	assert.Equal(t, 1, queue.Len())
+	queue.Done(item)
+	assert.Equal(t, 2, queue.Len())
+	item, _ = queue.Get()
+	assert.Equal(t, "b1", item.Name)
+}
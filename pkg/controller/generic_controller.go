@@ -3,6 +3,7 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -12,56 +13,139 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer is used to instrument the reconcile pipeline.
+var tracer = otel.Tracer("github.com/GoogleCloudPlatform/karo/pkg/controller")
+
 const (
 	ReadyConditionType                  = "Ready"
 	ReconciliationFailedReason          = "ReconciliationFailed"
 	ReconciliationSucceededReason       = "ReconciliationSucceeded"
-	SetOwnerRefFailedEvent              = "SetOwnerRefFailed"
-	OwnerDeletedDuringStatusUpdateEvent = "OwnerDeletedDuringStatusUpdate"
-	StatusUpdateFailedEvent             = "StatusUpdateFailed"
-	StatusUpdatedEvent                  = "StatusUpdated"
-	TransformerRunFailedEvent           = "TransformerRunFailed"
-	UnsupportedDependentKindEvent       = "UnsupportedDependentKind"
-	DependentUpdateFailedEvent          = "DependentUpdateFailed"
-	DependentCreateFailedEvent          = "DependentCreateFailed"
-	DependentUpdatedEvent               = "DependentUpdated"
-	DependentCreatedEvent               = "DependentCreated"
-	ReconciliationSuccessfulEvent       = "ReconciliationSuccessful"
-	DependentUpdateStartedEvent         = "DependentUpdateStarted"
-	DependentCreateStartedEvent         = "DependentCreateStarted"
+	SetOwnerRefFailedEvent              = modelv1.EventReasonSetOwnerRefFailed
+	OwnerDeletedDuringStatusUpdateEvent = modelv1.EventReasonOwnerDeletedDuringStatusUpdate
+	StatusUpdateFailedEvent             = modelv1.EventReasonStatusUpdateFailed
+	StatusUpdatedEvent                  = modelv1.EventReasonStatusUpdated
+	TransformerRunFailedEvent           = modelv1.EventReasonTransformerRunFailed
+	UnsupportedDependentKindEvent       = modelv1.EventReasonUnsupportedDependentKind
+	DependentUpdateFailedEvent          = modelv1.EventReasonDependentUpdateFailed
+	DependentCreateFailedEvent          = modelv1.EventReasonDependentCreateFailed
+	DependentUpdatedEvent               = modelv1.EventReasonDependentUpdated
+	DependentReplacedEvent              = modelv1.EventReasonDependentReplaced
+	DependentCreatedEvent               = modelv1.EventReasonDependentCreated
+	ReconciliationSuccessfulEvent       = modelv1.EventReasonReconciliationSuccessful
+	DependentUpdateStartedEvent         = modelv1.EventReasonDependentUpdateStarted
+	DependentCreateStartedEvent         = modelv1.EventReasonDependentCreateStarted
+	DiffCheckFailedEvent                = modelv1.EventReasonDiffCheckFailed
 )
 
 type GenericReconciler struct {
-	Mutex                  *sync.Mutex
-	Client                 client.Client
-	Scheme                 *runtime.Scheme
-	Transformer            modelv1.TransformerInterface // Use the interface
-	Gvk                    schema.GroupVersionKind
-	Recorder               record.EventRecorder
+	Mutex           *sync.Mutex
+	Client          client.Client
+	Scheme          *runtime.Scheme
+	Transformer     modelv1.TransformerInterface // Use the interface
+	Gvk             schema.GroupVersionKind
+	Recorder        record.EventRecorder
+	RestConfig      *rest.Config
+	EventPolicy     EventPolicy
+	QuotaGuardrails bool
+	Preflight       PreflightMode
+	// DependentConcurrency is the number of dependents applied in parallel,
+	// see processDependentResources. Dependents are applied one at a time if
+	// it is not set.
+	DependentConcurrency int
+	// RenderArtifacts stores the dependents applied for each generation of
+	// a target, if set.
+	RenderArtifacts        RenderArtifactStore
 	resourceClientFactory  func(dynamic.Interface) modelv1.ResourceClientInterface
 	discoveryClientFactory func() (discovery.DiscoveryInterface, error)
 	getResourceReconciler  func(kind string) (*ResourceReconciler, error)
-	KindReconcilers        map[string]KindReconciler
+	// KindReconcilers holds the stateful logic run for targets after their
+	// dependents are applied.
+	KindReconcilers *KindReconcilerRegistry
+	// Shards selects the targets that this replica reconciles, if the
+	// operator runs sharded.
+	Shards ShardFilter
+	// Invalidator queues targets when external systems report changes to
+	// their context, if the invalidation endpoint is enabled.
+	Invalidator *Invalidator
+	// ReconcileHistory is the number of reconcile summaries kept in
+	// status.reconcileHistory of each target. Zero keeps none.
+	ReconcileHistory int
+	// PriceSheet prices the accelerators of targets for the cost estimate in
+	// their status. Costs are not estimated if it is nil.
+	PriceSheet *PriceSheet
+	// DependencyTimeout is how long the templates of a target may wait for
+	// an object with waitFor before its render fails. Zero waits forever.
+	DependencyTimeout time.Duration
+	// DependencyRequeueInterval is the delay before the first retry of a
+	// render that waits for an object. DefaultDependencyRequeueInterval is
+	// used if it is zero.
+	DependencyRequeueInterval time.Duration
+	// Shutdown lets reconciles in flight finish when the manager stops. nil
+	// cancels them with the manager.
+	Shutdown *ShutdownBarrier
+	// FairQueuing takes the queued targets of the namespaces in turn, see
+	// NewFairQueue.
+	FairQueuing bool
+	// Priorities orders the reconciles of the targets by their
+	// PriorityAnnotation, if set. It is shared by the reconcilers of all
+	// integrations.
+	Priorities *ReconcilePriorities
+	// Policies evaluates the rendered dependents against policies before
+	// they are applied, if set.
+	Policies *PolicyChecker
+	// Adoption decides which pre-existing objects with the names of
+	// rendered dependents are adopted. AdoptUnmanaged if empty.
+	Adoption AdoptionPolicy
+	// MaxStatusDependents is the number of dependents kept in
+	// status.dependentResources of each target, see recordDependents. Zero
+	// keeps all of them.
+	MaxStatusDependents int
+	// ReconcileExports exports the summaries of reconciles, if set, see
+	// recordReconcileHistory.
+	ReconcileExports *ReconcileExportQueue
+	// DryRunAll sends the writes of every reconcile with dry-run=server,
+	// other than the status of targets, see newDryRunClient.
+	DryRunAll bool
 }
 
 type ResourceClient struct {
 	dynClient dynamic.Interface
+	// fieldManager identifies the writes of the client, see FieldManager.
+	fieldManager string
+	// typedClient applies the typedApplyKinds with typed server-side apply,
+	// if set.
+	typedClient kubernetes.Interface
+	// dryRun sends every write with dry-run=server.
+	dryRun bool
 }
 
 // SimplifiedContainerSpec holds only the fields we care about for comparison
@@ -80,21 +164,58 @@ type ResourceReconciler struct {
 }
 
 func (rc *ResourceClient) Get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
-	resourceName := strings.ToLower(gvk.Kind) + "s"
+	resourceName := resourceNameForKind(gvk.Kind)
 	resource := rc.dynClient.Resource(gvk.GroupVersion().WithResource(resourceName))
 	return resource.Namespace(namespace).Get(ctx, name, v1.GetOptions{})
 }
 
 func (rc *ResourceClient) Create(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	resourceName := strings.ToLower(gvk.Kind) + "s"
+	resourceName := resourceNameForKind(gvk.Kind)
 	resource := rc.dynClient.Resource(gvk.GroupVersion().WithResource(resourceName))
-	return resource.Namespace(namespace).Create(ctx, obj, v1.CreateOptions{})
+	if rc.dryRun {
+		logDryRun(ctx, "create", gvk.Kind, namespace, obj.GetName())
+	}
+	return resource.Namespace(namespace).Create(ctx, obj, v1.CreateOptions{FieldManager: rc.fieldManager, DryRun: dryRunOption(rc.dryRun)})
 }
 
 func (rc *ResourceClient) Update(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	resourceName := strings.ToLower(gvk.Kind) + "s"
+	resourceName := resourceNameForKind(gvk.Kind)
+	resource := rc.dynClient.Resource(gvk.GroupVersion().WithResource(resourceName))
+	if rc.dryRun {
+		logDryRun(ctx, "update", gvk.Kind, namespace, obj.GetName())
+	}
+	return resource.Namespace(namespace).Update(ctx, obj, v1.UpdateOptions{FieldManager: rc.fieldManager, DryRun: dryRunOption(rc.dryRun)})
+}
+
+func (rc *ResourceClient) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *v1.DeletionPropagation) error {
+	resourceName := resourceNameForKind(gvk.Kind)
+	resource := rc.dynClient.Resource(gvk.GroupVersion().WithResource(resourceName))
+	if rc.dryRun {
+		logDryRun(ctx, "delete", gvk.Kind, namespace, name)
+	}
+	return resource.Namespace(namespace).Delete(ctx, name, v1.DeleteOptions{PropagationPolicy: propagation, DryRun: dryRunOption(rc.dryRun)})
+}
+
+func (rc *ResourceClient) Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	resourceName := resourceNameForKind(gvk.Kind)
 	resource := rc.dynClient.Resource(gvk.GroupVersion().WithResource(resourceName))
-	return resource.Namespace(namespace).Update(ctx, obj, v1.UpdateOptions{})
+	if rc.dryRun {
+		logDryRun(ctx, "patch", gvk.Kind, namespace, name)
+	}
+	return resource.Namespace(namespace).Patch(ctx, name, patchType, data, v1.PatchOptions{FieldManager: rc.fieldManager, DryRun: dryRunOption(rc.dryRun)})
+}
+
+// resourceNameForKind returns the plural resource name for a kind, following
+// the same simple English pluralization rules used by kubebuilder.
+func resourceNameForKind(kind string) string {
+	lower := strings.ToLower(kind)
+	switch {
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return strings.TrimSuffix(lower, "y") + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return lower + "es"
+	}
+	return lower + "s"
 }
 
 func (r *GenericReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -106,11 +227,29 @@ func (r *GenericReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	err := ctrl.NewControllerManagedBy(mgr).
-		For(objectToWatch). // Watch for the GVK defined in this GenericReconciler
-		Complete(r)         // This GenericReconciler's Reconcile method will be called
+	var forOptions []ctrlbuilder.ForOption
+	options := ctrlcontroller.Options{}
+	if r.FairQueuing {
+		options.NewQueue = NewFairQueue
+	}
+	if r.Priorities != nil {
+		forOptions = append(forOptions, ctrlbuilder.WithPredicates(r.Priorities.tracker(r.Gvk)))
+		options.MaxConcurrentReconciles = PriorityWorkers
+		options.NewQueue = func(controllerName string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+			return newQueue(controllerName, rateLimiter, r.Priorities.queue(r.Gvk, r.FairQueuing))
+		}
+	}
 
-	return err
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(objectToWatch, forOptions...). // Watch for the GVK defined in this GenericReconciler
+		WithOptions(options)
+	if r.Shards != nil {
+		builder = builder.WatchesRawSource(r.shardSource())
+	}
+	if r.Invalidator != nil {
+		builder = builder.WatchesRawSource(r.Invalidator.source(r.Gvk))
+	}
+	return builder.Complete(r) // This GenericReconciler's Reconcile method will be called
 }
 
 func (r *GenericReconciler) createEmptyObject() *unstructured.Unstructured {
@@ -139,7 +278,7 @@ func (r *GenericReconciler) setupClients(ctx context.Context) (discovery.Discove
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to create discovery client: %w", err)
 	}
-	cfg, err := ctrl.GetConfig()
+	cfg, err := r.restConfig()
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to get config: %w", err)
 	}
@@ -150,58 +289,115 @@ func (r *GenericReconciler) setupClients(ctx context.Context) (discovery.Discove
 	return discoveryClient, dynamicClient, nil
 }
 
-func (r *GenericReconciler) processDependentResources(
+// restConfig returns a copy of the configured client configuration so that the
+// user agent and QPS/Burst settings apply to every client we build.
+func (r *GenericReconciler) restConfig() (*rest.Config, error) {
+	if r.RestConfig != nil {
+		return rest.CopyConfig(r.RestConfig), nil
+	}
+	return ctrl.GetConfig()
+}
+
+func (r *GenericReconciler) processSingleDependentResource(
 	ctx context.Context,
 	log logr.Logger,
 	target *unstructured.Unstructured,
-	objs []*unstructured.Unstructured,
+	obj *unstructured.Unstructured,
 	resourceClient modelv1.ResourceClientInterface,
-) ([]map[string]interface{}, error) {
-	var processedResources []map[string]interface{}
-	var firstError error
+) (map[string]interface{}, error) {
+	ctx, span := tracer.Start(ctx, "GenericReconciler.ProcessDependent", trace.WithAttributes(
+		attribute.String("k8s.namespace", obj.GetNamespace()),
+		attribute.String("k8s.name", obj.GetName()),
+		attribute.String("k8s.gvk", obj.GroupVersionKind().String()),
+	))
+	defer span.End()
 
-	for _, obj := range objs {
-		info, err := r.processSingleDependentResource(ctx, log, target, obj, resourceClient)
-		if err != nil && firstError == nil {
-			firstError = err
-		}
-		processedResources = append(processedResources, info)
+	info, err := r.reconcileDependent(ctx, log, target, obj, resourceClient)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
-	return processedResources, firstError
+	return info, err
 }
 
-func (r *GenericReconciler) processSingleDependentResource(
+func (r *GenericReconciler) reconcileDependent(
 	ctx context.Context,
 	log logr.Logger,
 	target *unstructured.Unstructured,
 	obj *unstructured.Unstructured,
 	resourceClient modelv1.ResourceClientInterface,
 ) (map[string]interface{}, error) {
+	clusterScoped := r.isClusterScoped(obj.GroupVersionKind())
+	if clusterScoped && obj.GetNamespace() != "" {
+		// Templates may set the namespace of every object they render.
+		obj.SetNamespace("")
+	}
+	setLabels(obj, r.managedByLabels(target))
+	setSourceGeneration(obj, target.GetGeneration())
 	dependentResourceInfo := map[string]interface{}{
-		"kind":      obj.GetKind(),
-		"name":      obj.GetName(),
-		"namespace": obj.GetNamespace(),
-		"status":    "Attempted",
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"name":       obj.GetName(),
+		"namespace":  obj.GetNamespace(),
+		"status":     "Attempted",
 	}
 
-	// This is the function we suspect is failing.
-	err := controllerutil.SetControllerReference(target, obj, r.Scheme)
+	// Cluster-scoped dependents such as ComputeClasses cannot be owned by a
+	// namespaced target, so they are left in place when the target is deleted.
+	var err error
+	if isRetainedOnDelete(obj) {
+		// Retained dependents are recorded in an inventory instead, so that
+		// they can be found and cleaned up once they are no longer needed.
+		log.Info("Not setting ControllerReference on dependent retained on delete", "kind", obj.GetKind(), "name", obj.GetName())
+		if err := r.recordRetainedObject(ctx, target, obj); err != nil {
+			log.Error(err, "Failed to record retained dependent")
+			dependentResourceInfo["status"] = fmt.Sprintf("Error: %v", err)
+			return dependentResourceInfo, fmt.Errorf("failed to record retained dependent: %w", err)
+		}
+		dependentResourceInfo["retained"] = true
+	} else if target.GetNamespace() != "" && clusterScoped {
+		log.Info("Not setting ControllerReference on cluster-scoped dependent", "kind", obj.GetKind(), "name", obj.GetName())
+	} else {
+		err = controllerutil.SetControllerReference(target, obj, r.Scheme)
+	}
 	if err != nil {
 		log.Error(err, "Failed to set ControllerReference")
-		r.Recorder.Eventf(target, corev1.EventTypeWarning, SetOwnerRefFailedEvent, "Failed to set owner ref on %s %s for %s %s: %v", obj.GetKind(), obj.GetName(), target.GetKind(), target.GetName(), err)
+		r.eventf(target, corev1.EventTypeWarning, SetOwnerRefFailedEvent, "Failed to set owner ref on %s %s for %s %s: %v", obj.GetKind(), obj.GetName(), target.GetKind(), target.GetName(), err)
 		dependentResourceInfo["status"] = fmt.Sprintf("Error: SetOwnerRefFailed - %v", err)
 		return dependentResourceInfo, fmt.Errorf("failed to set controller reference: %w", err)
 	}
 
+	if rollout := r.rolloutSpec(); rollout != nil && obj.GetKind() == "Deployment" {
+		stableObj, state, err := r.progressRollout(ctx, log, target, obj, resourceClient, rollout)
+		if err != nil {
+			dependentResourceInfo["status"] = fmt.Sprintf("Error: %v", err)
+			return dependentResourceInfo, fmt.Errorf("failed to roll out resource: %w", err)
+		}
+		if state != nil {
+			dependentResourceInfo["rollout"] = state
+		}
+		obj = stableObj
+	}
+
 	finalProcessedObj, err := r.reconcileResource(ctx, log, resourceClient, target, obj)
 	if err != nil {
 		dependentResourceInfo["status"] = fmt.Sprintf("Error: %v", err)
 		return dependentResourceInfo, fmt.Errorf("failed to reconcile resource: %w", err)
 	}
+	if r.DryRunAll {
+		// The objects returned by dry-runs were not persisted.
+		dependentResourceInfo["status"] = DryRunStatus
+		return dependentResourceInfo, nil
+	}
 	dependentResourceInfo["status"] = "Processed"
 	if finalProcessedObj != nil && finalProcessedObj.GetUID() != "" {
 		dependentResourceInfo["uid"] = string(finalProcessedObj.GetUID())
 	}
+	if finalProcessedObj != nil {
+		if generation, ok := sourceGeneration(finalProcessedObj); ok {
+			dependentResourceInfo["sourceGeneration"] = generation
+		}
+	}
 	return dependentResourceInfo, nil
 }
 
@@ -220,11 +416,7 @@ func (r *GenericReconciler) updateStatus(ctx context.Context, log logr.Logger, o
 		return fmt.Errorf("failed to set conditions in status: %w", err)
 	}
 
-	dependentResourcesAsInterfaceSlice := make([]interface{}, len(processedDependentResources))
-	for i, v := range processedDependentResources {
-		dependentResourcesAsInterfaceSlice[i] = v
-	}
-	if err := unstructured.SetNestedField(statusTarget.Object, dependentResourcesAsInterfaceSlice, "status", "dependentResources"); err != nil {
+	if err := r.recordDependents(ctx, statusTarget, processedDependentResources); err != nil {
 		log.Error(err, "Failed to set dependentResources in status")
 		return fmt.Errorf("failed to set dependentResources in status: %w", err)
 	}
@@ -233,28 +425,34 @@ func (r *GenericReconciler) updateStatus(ctx context.Context, log logr.Logger, o
 		log.Error(err, "Failed to set createdResourceCount in status")
 		return fmt.Errorf("failed to set createdResourceCount in status: %w", err)
 	}
+	if err := unstructured.SetNestedField(statusTarget.Object, outdatedDependentCount(processedDependentResources, target.GetGeneration()), "status", "outdatedDependentCount"); err != nil {
+		log.Error(err, "Failed to set outdatedDependentCount in status")
+		return fmt.Errorf("failed to set outdatedDependentCount in status: %w", err)
+	}
+	if err := r.recordReconcileHistory(ctx, statusTarget, overallReconciliationFailed, reconciliationErr); err != nil {
+		log.Error(err, "Failed to set reconcileHistory in status")
+		return err
+	}
 	originalTargetStatus, statusFound, _ := unstructured.NestedMap(originalTarget.Object, "status")
 
 	newStatusMap, _, _ := unstructured.NestedMap(statusTarget.Object, "status")
 	if !statusFound || !reflect.DeepEqual(originalTargetStatus, newStatusMap) {
-		if err := r.Client.Status().Update(ctx, statusTarget); err != nil {
+		if err := r.patchStatus(ctx, originalTarget, statusTarget); err != nil {
 			if errors.IsNotFound(err) {
 				log.Info("Owner resource not found during status update attempt, likely deleted. Not re-queuing.")
 				if r.Recorder != nil {
-					r.Recorder.Eventf(target, corev1.EventTypeWarning, OwnerDeletedDuringStatusUpdateEvent, "Owner %s %s was deleted before status could be updated.", target.GetKind(), target.GetName())
+					r.eventf(target, corev1.EventTypeWarning, OwnerDeletedDuringStatusUpdateEvent, "Owner %s %s was deleted before status could be updated.", target.GetKind(), target.GetName())
 				}
 				return nil // Return nil, because the owner is gone, no need to requeue
 			}
-			log.Error(err, "Failed to update target status subresource")
+			log.Error(err, "Failed to patch target status subresource")
 			if r.Recorder != nil {
-				r.Recorder.Eventf(target, corev1.EventTypeWarning, StatusUpdateFailedEvent, "Failed to update status for %s %s: %v", target.GetKind(), target.GetName(), err)
+				r.eventf(target, corev1.EventTypeWarning, StatusUpdateFailedEvent, "Failed to update status for %s %s: %v", target.GetKind(), target.GetName(), err)
 			}
-			return fmt.Errorf("failed to update target status subresource: %w", err) // Requeue for other errors
+			return fmt.Errorf("failed to patch target status subresource: %w", err) // Requeue for other errors
 		}
 		log.Info("Successfully updated target status", "generation", target.GetGeneration(), "observedGeneration", target.GetGeneration())
-		if r.Recorder != nil {
-			r.Recorder.Eventf(target, corev1.EventTypeNormal, StatusUpdatedEvent, "Status updated for %s %s", target.GetKind(), target.GetName())
-		}
+		r.verboseEventf(target, corev1.EventTypeNormal, StatusUpdatedEvent, "Status updated for %s %s", target.GetKind(), target.GetName())
 	} else {
 		log.Info("Target status is already up-to-date.")
 	}
@@ -262,43 +460,7 @@ func (r *GenericReconciler) updateStatus(ctx context.Context, log logr.Logger, o
 }
 
 func (r *GenericReconciler) buildConditions(ctx context.Context, target *unstructured.Unstructured, overallReconciliationFailed bool, reconciliationErr error) ([]interface{}, error) {
-	var newConditions []interface{}
-	existingConditionsRaw, _, _ := unstructured.NestedSlice(target.Object, "status", "conditions")
-	existingConditions := []v1.Condition{}
-	for _, rawCond := range existingConditionsRaw {
-		condMap, ok := rawCond.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Safely parse lastTransitionTime
-		var lastTransitionTime v1.Time
-		if tStr, ok := condMap["lastTransitionTime"].(string); ok {
-			if t, err := time.Parse(time.RFC3339Nano, tStr); err == nil {
-				lastTransitionTime = v1.NewTime(t)
-			} else {
-				// Handle parse error or default
-				lastTransitionTime = v1.Now()
-			}
-		}
-
-		// Safely get observedGeneration
-		var observedGen int64
-		if obsGenVal, ok := condMap["observedGeneration"]; ok {
-			if val, isInt64 := obsGenVal.(int64); isInt64 {
-				observedGen = val
-			}
-		}
-
-		existingConditions = append(existingConditions, v1.Condition{
-			Type:               getStringValue(condMap, "type"), // Using a helper is safer
-			Status:             v1.ConditionStatus(getStringValue(condMap, "status")),
-			Reason:             getStringValue(condMap, "reason"),
-			Message:            getStringValue(condMap, "message"),
-			LastTransitionTime: lastTransitionTime,
-			ObservedGeneration: observedGen, // Use the safely extracted value
-		})
-	}
+	existingConditions := targetConditions(target)
 
 	desiredReadyCondition := v1.Condition{
 		Type:               ReadyConditionType,
@@ -309,6 +471,44 @@ func (r *GenericReconciler) buildConditions(ctx context.Context, target *unstruc
 		desiredReadyCondition.Status = v1.ConditionFalse
 		desiredReadyCondition.Reason = ReconciliationFailedReason
 		if reconciliationErr != nil {
+			desiredReadyCondition.Reason = errorReason(reconciliationErr)
+		}
+		var quotaErr *QuotaExceededError
+		var preflightErr *PreflightError
+		var collisionErr *NameCollisionError
+		var specErr *SpecInvalidError
+		var imagePolicyErr *transformer.ImagePolicyError
+		var capacityErr *AcceleratorCapacityError
+		var capabilityErr *MissingClusterCapabilityError
+		var waitErr *RequirementsNotReadyError
+		var dependencyErr *transformer.DependencyNotReadyError
+		var patchConflictErr *PatchConflictError
+		var policyErr *PolicyViolationError
+		if stderrors.As(reconciliationErr, &quotaErr) {
+			desiredReadyCondition.Reason = QuotaExceededReason
+		} else if stderrors.As(reconciliationErr, &preflightErr) {
+			desiredReadyCondition.Reason = PreflightFailedReason
+		} else if stderrors.As(reconciliationErr, &collisionErr) {
+			desiredReadyCondition.Reason = NameCollisionReason
+		} else if stderrors.As(reconciliationErr, &specErr) || stderrors.As(reconciliationErr, &imagePolicyErr) || stderrors.As(reconciliationErr, &capacityErr) {
+			desiredReadyCondition.Reason = SpecInvalidReason
+		} else if stderrors.As(reconciliationErr, &waitErr) {
+			desiredReadyCondition.Reason = WaitingForRequirementsReason
+		} else if stderrors.As(reconciliationErr, &dependencyErr) {
+			desiredReadyCondition.Reason = WaitingForDependencyReason
+			if classifyError(reconciliationErr) == TemplateError {
+				desiredReadyCondition.Reason = DependencyTimedOutReason
+			}
+		} else if stderrors.As(reconciliationErr, &capabilityErr) {
+			desiredReadyCondition.Reason = ClusterCapabilityMissingReason
+		} else if stderrors.As(reconciliationErr, &patchConflictErr) {
+			desiredReadyCondition.Reason = PatchConflictReason
+		} else if stderrors.As(reconciliationErr, &policyErr) {
+			desiredReadyCondition.Reason = PolicyViolatedReason
+		}
+		if classifyError(reconciliationErr) == ExternalDependencyNotReady {
+			desiredReadyCondition.Message = fmt.Sprintf("Not reconciled: %v", reconciliationErr)
+		} else if reconciliationErr != nil {
 			desiredReadyCondition.Message = fmt.Sprintf("Failed to reconcile: %v", reconciliationErr)
 		} else {
 			desiredReadyCondition.Message = "One or more dependent resources failed to reconcile."
@@ -317,6 +517,16 @@ func (r *GenericReconciler) buildConditions(ctx context.Context, target *unstruc
 		desiredReadyCondition.Status = v1.ConditionTrue
 		desiredReadyCondition.Reason = ReconciliationSucceededReason
 		desiredReadyCondition.Message = "All dependent resources successfully processed."
+		if r.DryRunAll {
+			// Nothing was applied, so the dependents may not exist.
+			desiredReadyCondition.Status = v1.ConditionUnknown
+			desiredReadyCondition.Reason = DryRunReason
+			desiredReadyCondition.Message = "All dependent resources passed a server-side dry-run, they were not applied."
+		} else if r.Preflight == PreflightOnly {
+			desiredReadyCondition.Status = v1.ConditionUnknown
+			desiredReadyCondition.Reason = PreflightOnlyReason
+			desiredReadyCondition.Message = "All dependent resources passed the preflight, they were not applied."
+		}
 	}
 
 	foundReadyCondition := false
@@ -344,8 +554,55 @@ func (r *GenericReconciler) buildConditions(ctx context.Context, target *unstruc
 		desiredReadyCondition.LastTransitionTime = v1.Now()
 		existingConditions = append(existingConditions, desiredReadyCondition)
 	}
-	newConditions = make([]interface{}, len(existingConditions))
-	for i, cond := range existingConditions {
+	return conditionsToUnstructured(existingConditions), nil
+}
+
+// targetConditions parses status.conditions of the target.
+func targetConditions(target *unstructured.Unstructured) []v1.Condition {
+	existingConditionsRaw, _, _ := unstructured.NestedSlice(target.Object, "status", "conditions")
+	existingConditions := []v1.Condition{}
+	for _, rawCond := range existingConditionsRaw {
+		condMap, ok := rawCond.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Safely parse lastTransitionTime
+		var lastTransitionTime v1.Time
+		if tStr, ok := condMap["lastTransitionTime"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, tStr); err == nil {
+				lastTransitionTime = v1.NewTime(t)
+			} else {
+				// Handle parse error or default
+				lastTransitionTime = v1.Now()
+			}
+		}
+
+		// Safely get observedGeneration
+		var observedGen int64
+		if obsGenVal, ok := condMap["observedGeneration"]; ok {
+			if val, isInt64 := obsGenVal.(int64); isInt64 {
+				observedGen = val
+			}
+		}
+
+		existingConditions = append(existingConditions, v1.Condition{
+			Type:               getStringValue(condMap, "type"), // Using a helper is safer
+			Status:             v1.ConditionStatus(getStringValue(condMap, "status")),
+			Reason:             getStringValue(condMap, "reason"),
+			Message:            getStringValue(condMap, "message"),
+			LastTransitionTime: lastTransitionTime,
+			ObservedGeneration: observedGen, // Use the safely extracted value
+		})
+	}
+	return existingConditions
+}
+
+// conditionsToUnstructured converts conditions to the form stored in
+// status.conditions.
+func conditionsToUnstructured(conditions []v1.Condition) []interface{} {
+	newConditions := make([]interface{}, len(conditions))
+	for i, cond := range conditions {
 		newConditions[i] = map[string]interface{}{
 			"type":               cond.Type,
 			"status":             string(cond.Status),
@@ -355,25 +612,73 @@ func (r *GenericReconciler) buildConditions(ctx context.Context, target *unstruc
 			"observedGeneration": cond.ObservedGeneration,
 		}
 	}
-	return newConditions, nil
+	return newConditions
 }
 
 func (r *GenericReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, "GenericReconciler.Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace", req.Namespace),
+		attribute.String("k8s.name", req.Name),
+		attribute.String("k8s.gvk", r.Gvk.String()),
+	))
+	defer span.End()
+
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	hasIntegration := r.Transformer.Registry().HasIntegration(r.Gvk)
 	if !hasIntegration {
 		return ctrl.Result{Requeue: false}, nil
 	}
+	// Another replica reconciles the target.
+	if !ownsShard(r.Shards, req.NamespacedName) {
+		return ctrl.Result{}, nil
+	}
+
+	if r.Priorities != nil {
+		priority := r.Priorities.Priority(r.Gvk, req.NamespacedName)
+		if !r.Priorities.admit(r.Gvk, priority) {
+			// Leave the workers of the kind to resources of higher priority.
+			return ctrl.Result{RequeueAfter: priorityBudgetRequeueDelay}, nil
+		}
+		defer r.Priorities.release(r.Gvk)
+		if err := r.Priorities.lock(ctx, priority); err != nil {
+			log.FromContext(ctx).Info("Stopped waiting for the turn of the resource", "namespace", req.Namespace, "name", req.Name, "priority", priority.String())
+			return ctrl.Result{}, nil
+		}
+		defer r.Priorities.unlock()
+	}
 
 	r.Mutex.Lock()
 	defer r.Mutex.Unlock()
 
+	if r.Shutdown != nil {
+		drainCtx, done, ok := r.Shutdown.Enter(ctx)
+		if !ok {
+			// The resource is reconciled again when the manager restarts.
+			log.FromContext(ctx).Info("Manager is shutting down, not reconciling resource", "namespace", req.Namespace, "name", req.Name)
+			return ctrl.Result{}, nil
+		}
+		defer done()
+		ctx = drainCtx
+	}
+
+	ctx, _ = withDependentChanges(ctx)
 	log := log.FromContext(ctx).WithValues("namespace", req.Namespace, "name", req.Name, "controller", r.Gvk.Kind)
 	log.Info("reconciling resource")
 
 	target, err := r.fetchTarget(ctx, req)
 	if err != nil {
-		if strings.Contains(err.Error(), "resource not found") {
+		if errors.IsNotFound(err) {
 			log.Info("resource not found")
+			forgetCostEstimate(r.Gvk.Kind, req.Namespace, req.Name)
+			r.Invalidator.takeInvalidated(r.Gvk, req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "failed to fetch target resource")
@@ -382,6 +687,26 @@ func (r *GenericReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	originalTarget := target.DeepCopy()
 
+	// Resources that are being deleted are not gated, so that their cleanup
+	// does not wait for the required kinds.
+	if target.GetDeletionTimestamp().IsZero() {
+		if err := r.checkRequirements(target); err != nil {
+			var waitErr *RequirementsNotReadyError
+			if !stderrors.As(err, &waitErr) {
+				return ctrl.Result{}, err
+			}
+			log.Info("required kinds are not ready, skipping render", "requirements", waitErr.Unready)
+			dependents, readErr := recordedDependents(ctx, r.Client, target)
+			if readErr != nil {
+				return ctrl.Result{}, readErr
+			}
+			if err := r.updateStatus(ctx, log, originalTarget, target, dependents, true, err); err != nil {
+				return ctrl.Result{}, err
+			}
+			return r.failedResult(err)
+		}
+	}
+
 	discoveryClient, dynamicClient, err := r.setupClients(ctx)
 	if err != nil {
 		log.Error(err, "failed to setup clients")
@@ -397,33 +722,172 @@ func (r *GenericReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	resourceClient := r.resourceClientFactory(dynamicClient)
 
+	if !target.GetDeletionTimestamp().IsZero() && controllerutil.ContainsFinalizer(target, patchRevertFinalizer) {
+		if err := r.revertPatches(ctx, log, target, resourceClient); err != nil {
+			log.Error(err, "failed to revert the patches of existing objects")
+			return r.failedResult(err)
+		}
+	}
+
 	mapper := r.Client.RESTMapper()
 
 	var reconciliationErr error
 	var overallReconciliationFailed bool
 
-	objs, err := r.Transformer.Run(ctx, discoveryClient, dynClient, mapper, r.Client, req, target)
-	if err != nil {
-		if r.Recorder != nil {
-			r.Recorder.Eventf(target, corev1.EventTypeWarning, TransformerRunFailedEvent, "Failed to generate desired state for %s %s: %v", target.GetKind(), target.GetName(), err)
-		}
+	var objs, patches []*unstructured.Unstructured
+	var processedDependentResources []map[string]interface{}
+	// unchanged is set when the render inputs did not change since the
+	// dependents were applied, and objs then only identify the dependents.
+	var unchanged bool
+	var inputHash string
+	if err := r.validateRequiredFields(target); err != nil {
+		log.Info("target is missing required fields, skipping render", "error", err.Error())
 		reconciliationErr = err
 		overallReconciliationFailed = true
+	} else if err := r.validateAcceleratorCapacity(target); err != nil {
+		log.Info("accelerators of target cannot serve its model, skipping render", "error", err.Error())
+		reconciliationErr = err
+		overallReconciliationFailed = true
+	} else {
+		inputHash = r.renderInputHash(ctx, log, discoveryClient, dynClient, target)
+		invalidated := r.Invalidator.takeInvalidated(r.Gvk, req.NamespacedName)
+		if dependents, recorded, ok := r.unchangedDependents(ctx, originalTarget, inputHash); ok && !invalidated {
+			log.Info("render inputs are unchanged since the dependents were last applied, skipping render")
+			objs, processedDependentResources, unchanged = recorded, dependents, true
+		} else {
+			objs, err = r.Transformer.Run(ctx, discoveryClient, dynClient, mapper, r.Client, req, target)
+			rejected, conditionErr := r.setImagePolicyCondition(target, err)
+			if conditionErr != nil {
+				log.Error(conditionErr, "Failed to set the SpecInvalid condition")
+			}
+			err, conditionErr = r.setDependencyCondition(target, err)
+			if conditionErr != nil {
+				log.Error(conditionErr, "Failed to set the Waiting condition")
+			}
+			var dependencyErr *transformer.DependencyNotReadyError
+			if stderrors.As(err, &dependencyErr) {
+				// The Waiting condition records the wait and its events.
+				log.Info("templates wait for an object, skipping render", "error", err.Error())
+				reconciliationErr = err
+				overallReconciliationFailed = true
+			} else if err != nil {
+				if !rejected {
+					r.errorEventf(target, err, TransformerRunFailedEvent, "Failed to generate desired state for %s %s: %v", target.GetKind(), target.GetName(), err)
+				}
+				reconciliationErr = err
+				overallReconciliationFailed = true
+			} else {
+				objs, patches = splitPatches(objs)
+			}
+		}
+	}
+	if objs != nil && !unchanged {
+		if err := r.checkPolicies(ctx, log, target, objs); err != nil {
+			log.Info("rendered dependents violate policies, skipping apply", "error", err.Error())
+			reconciliationErr = err
+			overallReconciliationFailed = true
+			objs = nil
+		}
+	}
+	if objs != nil && !unchanged {
+		if err := r.checkResourceGuardrails(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "rendered dependents exceed resource limits")
+			r.errorEventf(target, err, QuotaExceededEvent, "Not applying dependents of %s %s: %v", target.GetKind(), target.GetName(), err)
+			reconciliationErr = err
+			overallReconciliationFailed = true
+			objs = nil
+		}
+	}
+	if objs != nil && !unchanged {
+		if err := r.checkNameCollisions(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "rendered dependents collide with other objects")
+			r.errorEventf(target, err, NameCollisionEvent, "Not applying dependents of %s %s: %v", target.GetKind(), target.GetName(), err)
+			reconciliationErr = err
+			overallReconciliationFailed = true
+			objs = nil
+		}
+	}
+	if objs != nil && !unchanged {
+		if err := r.checkClusterCapabilities(ctx, log, target, objs, resourceClient); err != nil {
+			log.Info("rendered dependents need missing cluster capabilities, skipping apply", "error", err.Error())
+			reconciliationErr = err
+			overallReconciliationFailed = true
+			objs = nil
+		}
+	}
+	if objs != nil && !unchanged && r.Preflight != "" && r.Preflight != PreflightOff {
+		report, err := r.preflight(ctx, log, target, objs)
+		if setErr := unstructured.SetNestedField(target.Object, report, "status", "preflight"); setErr != nil {
+			log.Error(setErr, "Failed to set preflight report in status")
+		}
+		if err != nil {
+			r.errorEventf(target, err, PreflightFailedEvent, "Preflight of %s %s failed: %v", target.GetKind(), target.GetName(), err)
+			if r.Preflight != PreflightReport {
+				reconciliationErr = err
+				overallReconciliationFailed = true
+			}
+		}
+		if r.Preflight == PreflightOnly || (err != nil && r.Preflight == PreflightEnforce) {
+			objs = nil
+			// Nothing was applied, so the dependents recorded before stay.
+			dependents, readErr := recordedDependents(ctx, r.Client, originalTarget)
+			if readErr != nil {
+				return ctrl.Result{}, readErr
+			}
+			processedDependentResources = dependents
+		}
 	}
-	var processedDependentResources []map[string]interface{}
 	if objs != nil {
-		processedDependentResources, reconciliationErr = r.processDependentResources(ctx, log, target, objs, resourceClient)
+		// The live dependents are checked even when the render is skipped.
+		if !unchanged {
+			recordAcceleratorSelection(target, objs)
+			recordImageDigests(target, objs)
+			r.recordCostEstimate(ctx, log, target, objs)
+			processedDependentResources, reconciliationErr = r.processDependentResources(ctx, log, target, objs, resourceClient)
+			// Dry-run dependents were not applied, so they are neither
+			// recorded nor skipped by later reconciles.
+			if reconciliationErr == nil && !r.DryRunAll {
+				r.saveRenderArtifacts(ctx, log, originalTarget, target, inputHash, objs)
+				r.recordApplied(target, inputHash)
+			}
+		}
 		if reconciliationErr != nil {
 			overallReconciliationFailed = true
+		} else if err := r.checkDependentHealth(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "failed to check the health of dependents")
+			reconciliationErr = err
+			overallReconciliationFailed = true
+		} else if err := r.checkDeploymentRollouts(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "failed to check the rollouts of Deployments")
+			reconciliationErr = err
+			overallReconciliationFailed = true
+		} else if processedDependentResources, err = r.checkConfigConnectorDependents(ctx, log, target, objs, processedDependentResources, resourceClient); err != nil {
+			log.Error(err, "failed to check the readiness of Config Connector dependents")
+			reconciliationErr = err
+			overallReconciliationFailed = true
+		} else if err := r.recordInferencePool(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "failed to record the address of the InferencePool")
+			reconciliationErr = err
+			overallReconciliationFailed = true
+		} else if err := r.applyStatusMappings(ctx, log, target, objs, resourceClient); err != nil {
+			log.Error(err, "failed to copy dependent values into status")
+			reconciliationErr = err
+			overallReconciliationFailed = true
+		} else if target.GetDeletionTimestamp().IsZero() && !unchanged {
+			if err := r.applyPatches(ctx, log, target, patches, resourceClient); err != nil {
+				log.Error(err, "failed to patch existing objects")
+				reconciliationErr = err
+				overallReconciliationFailed = true
+			}
 		}
 	}
 
-	if kindReconciler, ok := r.KindReconcilers[target.GetKind()]; ok {
-		result, err := kindReconciler.ReconcileStateful(ctx, r, target)
+	if registration, ok := r.KindReconcilers.Lookup(target.GroupVersionKind()); ok {
+		result, err := registration.Reconciler.ReconcileStateful(ctx, r, target)
 		if err != nil {
 			// A real error occurred in the stateful logic
 			r.updateStatus(ctx, log, originalTarget, target, processedDependentResources, true, err)
-			return ctrl.Result{}, err
+			return r.failedResult(err)
 		}
 		if !result.IsZero() {
 			// The stateful logic is waiting (requeuing). Update status and return.
@@ -437,7 +901,7 @@ func (r *GenericReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			"targetKind", target.GetKind(), "targetName", target.GetName())
 
 		if reconciliationErr != nil {
-			return ctrl.Result{}, reconciliationErr
+			return r.failedResult(reconciliationErr)
 		}
 		return ctrl.Result{}, nil
 	}
@@ -451,10 +915,12 @@ func (r *GenericReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{Requeue: true}, reconciliationErr
 	}
 	if reconciliationErr != nil {
-		return ctrl.Result{}, reconciliationErr
+		return r.failedResult(reconciliationErr)
+	}
+	if r.EventPolicy == EventPolicyAll || !isReadyForGeneration(originalTarget) {
+		r.eventf(target, corev1.EventTypeNormal, ReconciliationSuccessfulEvent, "All dependent resources processed successfully for %s %s", target.GetKind(), target.GetName())
 	}
-	r.Recorder.Eventf(target, corev1.EventTypeNormal, ReconciliationSuccessfulEvent, "All dependent resources processed successfully for %s %s", target.GetKind(), target.GetName())
-	return ctrl.Result{Requeue: false, RequeueAfter: 5 * time.Second}, nil
+	return ctrl.Result{Requeue: false, RequeueAfter: requeueAfter(log, target, objs)}, nil
 }
 
 func (r *GenericReconciler) reconcileResource(ctx context.Context, log logr.Logger, rc modelv1.ResourceClientInterface, target *unstructured.Unstructured, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
@@ -474,19 +940,31 @@ func (r *GenericReconciler) reconcileResource(ctx context.Context, log logr.Logg
 	if r.getResourceReconciler != nil {
 		// Use the override from the field if it exists (for tests).
 		resourceReconciler, err = r.getResourceReconciler(gvk.Kind)
+	} else if isConfigConnectorKind(gvk) {
+		// Config Connector kinds share one diff, as there are hundreds of them.
+		resourceReconciler = &ResourceReconciler{diffFunc: r.configConnectorDiff}
 	} else {
 		// Otherwise, use the default production logic.
 		resourceReconciler, err = r.defaultGetResourceReconciler(gvk.Kind)
 	}
 	if err != nil {
 		log.Info("Unsupported resource type for specific reconcile logic", "resourceGVK", gvk.String())
-		r.Recorder.Eventf(target, corev1.EventTypeWarning, UnsupportedDependentKindEvent, "Skipping unsupported dependent kind %s %s/%s for %s %s", gvk.Kind, namespace, name, target.GetKind(), target.GetName())
+		r.eventf(target, corev1.EventTypeWarning, UnsupportedDependentKindEvent, "Skipping unsupported dependent kind %s %s/%s for %s %s", gvk.Kind, namespace, name, target.GetKind(), target.GetName())
 		return obj, nil
 	}
 
 	return r.reconcileGeneric(ctx, log, rc, target, namespace, existingObj, obj, obj.GetName(), gvk, resourceReconciler.diffFunc)
 }
 
+// isClusterScoped reports whether objects of the kind live outside namespaces.
+func (r *GenericReconciler) isClusterScoped(gvk schema.GroupVersionKind) bool {
+	if r.Client == nil {
+		return false
+	}
+	mapping, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil && mapping.Scope.Name() == meta.RESTScopeNameRoot
+}
+
 func (r *GenericReconciler) defaultGetResourceReconciler(kind string) (*ResourceReconciler, error) {
 	switch kind {
 	case "Deployment":
@@ -501,41 +979,77 @@ func (r *GenericReconciler) defaultGetResourceReconciler(kind string) (*Resource
 		return &ResourceReconciler{diffFunc: r.jobDiff}, nil
 	case "HorizontalPodAutoscaler":
 		return &ResourceReconciler{diffFunc: r.hpaDiff}, nil
+	case "ScaledObject":
+		return &ResourceReconciler{diffFunc: r.scaledObjectDiff}, nil
+	case "PodDisruptionBudget":
+		return &ResourceReconciler{diffFunc: r.podDisruptionBudgetDiff}, nil
 	case "PodMonitoring":
 		return &ResourceReconciler{diffFunc: r.podMonitoringDiff}, nil
+	case "PodMonitor", "ServiceMonitor":
+		return &ResourceReconciler{diffFunc: r.prometheusMonitorDiff}, nil
+	case "NetworkPolicy", "CiliumNetworkPolicy":
+		return &ResourceReconciler{diffFunc: r.networkPolicyDiff}, nil
+	case "ComputeClass":
+		return &ResourceReconciler{diffFunc: r.computeClassDiff}, nil
+	case "ProvisioningRequest":
+		return &ResourceReconciler{diffFunc: r.provisioningRequestDiff}, nil
+	case "InferencePool":
+		return &ResourceReconciler{diffFunc: r.inferencePoolDiff}, nil
+	case "InferenceModel":
+		return &ResourceReconciler{diffFunc: r.inferenceModelDiff}, nil
 	default:
 		return nil, fmt.Errorf("unsupported resource kind: %s", kind)
 	}
 }
 
 func (r *GenericReconciler) createOrUpdateResource(ctx context.Context, log logr.Logger, rc modelv1.ResourceClientInterface, target *unstructured.Unstructured, obj *unstructured.Unstructured, gvk schema.GroupVersionKind, namespace string, resourceName string, existingObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if applier, ok := rc.(typedApplier); ok && applier.appliesTyped(gvk) {
+		return r.applyTypedResource(ctx, log, applier, target, obj, gvk, namespace, resourceName, existingObj)
+	}
 	if existingObj != nil {
-		r.Recorder.Eventf(target, corev1.EventTypeNormal, DependentUpdateStartedEvent, "Starting update of %s %s/%s for %s %s", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName())
+		r.verboseEventf(target, corev1.EventTypeNormal, DependentUpdateStartedEvent, "Starting update of %s %s/%s for %s %s", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName())
 		obj.SetResourceVersion(existingObj.GetResourceVersion())
+		if isConfigConnectorKind(gvk) {
+			keepServerSpecFields(existingObj, obj)
+		}
 		updatedObj, err := rc.Update(ctx, gvk, namespace, obj)
 		if err != nil {
 			log.Error(err, "Error during Update call", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
-			r.Recorder.Eventf(target, corev1.EventTypeWarning, DependentUpdateFailedEvent, "Failed to update %s %s/%s for %s %s: %v", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err)
+			r.errorEventf(target, err, DependentUpdateFailedEvent, "Failed to update %s %s/%s for %s %s: %v", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err)
 			return nil, fmt.Errorf("error updating resource %s %s/%s: %w", gvk.String(), namespace, resourceName, err)
 		}
 		log.Info("Resource updated", "GVK", gvk, "name", updatedObj.GetName(), "namespace", namespace)
-		r.Recorder.Eventf(target, corev1.EventTypeNormal, DependentUpdatedEvent, "Successfully updated %s %s/%s for %s %s", updatedObj.GetKind(), namespace, updatedObj.GetName(), target.GetKind(), target.GetName())
+		recordDependentChange(ctx, "Updated", updatedObj)
+		r.eventf(target, corev1.EventTypeNormal, DependentUpdatedEvent, "Successfully updated %s %s/%s for %s %s", updatedObj.GetKind(), namespace, updatedObj.GetName(), target.GetKind(), target.GetName())
 		return updatedObj, nil
 	} else {
 		createdObj, err := rc.Create(ctx, gvk, namespace, obj)
 		if err != nil {
 			log.Error(err, "Error during Create call", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
-			r.Recorder.Eventf(target, corev1.EventTypeWarning, DependentCreateFailedEvent, "Failed to create %s %s/%s for %s %s: %v (%s)", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err, err.Error())
+			r.errorEventf(target, err, DependentCreateFailedEvent, "Failed to create %s %s/%s for %s %s: %v (%s)", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err, err.Error())
 			return nil, fmt.Errorf("error creating resource %s %s/%s: %w", gvk.String(), namespace, resourceName, err)
 		}
 		log.Info("Resource created", "GVK", gvk, "name", createdObj.GetName(), "namespace", namespace)
-		r.Recorder.Eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Successfully created %s %s/%s (UID: %s) for %s %s", createdObj.GetKind(), createdObj.GetNamespace(), createdObj.GetName(), createdObj.GetUID(), target.GetKind(), target.GetName())
+		recordDependentChange(ctx, "Created", createdObj)
+		r.eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Successfully created %s %s/%s (UID: %s) for %s %s", createdObj.GetKind(), createdObj.GetNamespace(), createdObj.GetName(), createdObj.GetUID(), target.GetKind(), target.GetName())
 		return createdObj, nil
 	}
 	// Added this return nil,nil to satisfy compiler since the update path was omitted for brevity
 	//return nil, nil
 }
 
+// replaceResource deletes existingObj and creates obj in its place. The
+// content of immutable Secrets and ConfigMaps cannot be updated.
+func (r *GenericReconciler) replaceResource(ctx context.Context, log logr.Logger, rc modelv1.ResourceClientInterface, target *unstructured.Unstructured, existingObj *unstructured.Unstructured, obj *unstructured.Unstructured, gvk schema.GroupVersionKind, namespace string, resourceName string) (*unstructured.Unstructured, error) {
+	log.Info("Replacing immutable resource", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
+	if err := r.deleteDependent(ctx, rc, existingObj, nil); err != nil {
+		r.errorEventf(target, err, DependentUpdateFailedEvent, "Failed to delete immutable %s %s/%s for %s %s: %v", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err)
+		return nil, fmt.Errorf("error deleting immutable resource %s %s/%s: %w", gvk.String(), namespace, resourceName, err)
+	}
+	r.eventf(target, corev1.EventTypeNormal, DependentReplacedEvent, "Replacing immutable %s %s/%s for %s %s", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName())
+	return r.createOrUpdateResource(ctx, log, rc, target, obj, gvk, namespace, resourceName, nil)
+}
+
 func (r *GenericReconciler) reconcileGeneric(
 	ctx context.Context,
 	log logr.Logger,
@@ -548,14 +1062,11 @@ func (r *GenericReconciler) reconcileGeneric(
 	gvk schema.GroupVersionKind,
 	diffFunc DiffFunc,
 ) (*unstructured.Unstructured, error) {
-	canRecordEvent := r.Recorder != nil
 	if existingObj != nil {
 		hasSpecOrDataDiff, err := diffFunc(existingObj, obj, log)
 		if err != nil {
 			log.Error(err, "Error during diff check", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
-			if canRecordEvent {
-				r.Recorder.Eventf(target, corev1.EventTypeWarning, "DiffCheckFailed", "Failed to compare desired state for dependent %s %s/%s: %v", obj.GetKind(), namespace, resourceName, err)
-			}
+			r.eventf(target, corev1.EventTypeWarning, DiffCheckFailedEvent, "Failed to compare desired state for dependent %s %s/%s: %v", obj.GetKind(), namespace, resourceName, err)
 			return nil, fmt.Errorf("error during diff for %s %s/%s: %w", gvk.String(), namespace, resourceName, err)
 		}
 
@@ -573,14 +1084,54 @@ func (r *GenericReconciler) reconcileGeneric(
 					"desiredOwnerUID", desiredControllerRef.UID,
 					"existingController", fmt.Sprintf("%v", currentControllerRefOnExisting))
 			}
+		} else if isRetainedOnDelete(obj) && v1.IsControlledBy(existingObj, target) {
+			// The dependent was rendered before it was retained, and would
+			// still be deleted with the target.
+			needsUpdateForOwnerRef = true
+			log.Info("Resource needs update to remove owner reference of retained dependent",
+				"GVK", gvk, "Namespace", namespace, "Name", resourceName)
 		}
 
-		if hasSpecOrDataDiff || needsUpdateForOwnerRef {
+		needsUpdateForLabels := managedByLabelsChanged(existingObj, obj)
+
+		if isProtected(existingObj) {
+			// The owner reference is not drift: it is removed on purpose.
+			if hasSpecOrDataDiff || needsUpdateForLabels {
+				log.Info("Resource is protected, not updating it",
+					"GVK", gvk, "Namespace", namespace, "Name", resourceName,
+					"hasSpecOrDataDiff", hasSpecOrDataDiff,
+					"needsUpdateForLabels", needsUpdateForLabels)
+				recordProtectedDrift(ctx, existingObj)
+			}
+			return releaseProtected(ctx, log, rc, target, existingObj)
+		}
+		// Protected dependents keep the generation they were last applied
+		// from, so it is only compared once they can be updated.
+		needsUpdateForGeneration := sourceGenerationChanged(existingObj, obj)
+		// A pre-existing object is adopted even if it matches the render, so
+		// that it gets the owner reference and labels of the target.
+		needsUpdateForAdoption := isPreExisting(existingObj, target)
+		if hasSpecOrDataDiff || needsUpdateForOwnerRef || needsUpdateForLabels || needsUpdateForGeneration || needsUpdateForAdoption {
 			log.Info("Resource requires update",
 				"GVK", gvk, "Namespace", namespace, "Name", resourceName,
 				"hasSpecOrDataDiff", hasSpecOrDataDiff,
-				"needsUpdateForOwnerRef", needsUpdateForOwnerRef)
-			return r.createOrUpdateResource(ctx, log, rc, target, obj, gvk, namespace, resourceName, existingObj)
+				"needsUpdateForOwnerRef", needsUpdateForOwnerRef,
+				"needsUpdateForLabels", needsUpdateForLabels,
+				"needsUpdateForGeneration", needsUpdateForGeneration,
+				"needsUpdateForAdoption", needsUpdateForAdoption)
+			if hasSpecOrDataDiff && isImmutable(existingObj) && gvk.Group == "" && (gvk.Kind == "Secret" || gvk.Kind == "ConfigMap") {
+				return r.replaceResource(ctx, log, rc, target, existingObj, obj, gvk, namespace, resourceName)
+			}
+			if !needsUpdateForAdoption {
+				return r.createOrUpdateResource(ctx, log, rc, target, obj, gvk, namespace, resourceName, existingObj)
+			}
+			log.Info("Adopting pre-existing resource", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
+			adoptedObj, err := r.createOrUpdateResource(ctx, log, rc, target, obj, gvk, namespace, resourceName, existingObj)
+			if err != nil {
+				return nil, err
+			}
+			r.eventf(target, corev1.EventTypeNormal, DependentAdoptedEvent, "Adopted existing %s %s/%s for %s %s", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName())
+			return adoptedObj, nil
 		} else {
 			log.Info("Resource is the same, no update needed", "GVK", gvk, "name", resourceName, "namespace", namespace)
 			return existingObj, nil
@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -27,6 +28,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
 )
 
 // Helper to create a logger for tests
@@ -211,11 +213,46 @@ func TestBuildConditions(t *testing.T) {
 	}
 }
 
+func TestRestConfigPropagation(t *testing.T) {
+	r := &GenericReconciler{
+		RestConfig: &rest.Config{Host: "https://localhost:6443", UserAgent: "karo-test/1.0", QPS: 100, Burst: 200},
+	}
+	cfg, err := r.restConfig()
+	if err != nil {
+		t.Fatalf("restConfig() error = %v", err)
+	}
+	if cfg.UserAgent != "karo-test/1.0" || cfg.QPS != 100 || cfg.Burst != 200 {
+		t.Errorf("restConfig() = %+v, want user agent and QPS/Burst to be propagated", cfg)
+	}
+	if cfg == r.RestConfig {
+		t.Error("restConfig() should return a copy of the configured rest.Config")
+	}
+}
+
+func TestResourceNameForKind(t *testing.T) {
+	tests := map[string]string{
+		"Deployment":          "deployments",
+		"ConfigMap":           "configmaps",
+		"NetworkPolicy":       "networkpolicies",
+		"CiliumNetworkPolicy": "ciliumnetworkpolicies",
+		"Gateway":             "gateways",
+		"Ingress":             "ingresses",
+		"PodMonitoring":       "podmonitorings",
+	}
+	for kind, want := range tests {
+		if got := resourceNameForKind(kind); got != want {
+			t.Errorf("resourceNameForKind(%q) = %q, want %q", kind, got, want)
+		}
+	}
+}
+
 // MockResourceClient allows us to control the behavior of the dynamic resource client.
 type MockResourceClient struct {
 	GetFunc    func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error)
 	CreateFunc func(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
 	UpdateFunc func(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	DeleteFunc func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *metav1.DeletionPropagation) error
+	PatchFunc  func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error)
 }
 
 func (m *MockResourceClient) Get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
@@ -236,6 +273,18 @@ func (m *MockResourceClient) Update(ctx context.Context, gvk schema.GroupVersion
 	}
 	return obj, nil
 }
+func (m *MockResourceClient) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *metav1.DeletionPropagation) error {
+	if m.DeleteFunc != nil {
+		return m.DeleteFunc(ctx, gvk, namespace, name, propagation)
+	}
+	return nil
+}
+func (m *MockResourceClient) Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	if m.PatchFunc != nil {
+		return m.PatchFunc(ctx, gvk, namespace, name, patchType, data)
+	}
+	return nil, errors.NewNotFound(gvk.GroupVersion().WithResource(gvk.Kind).GroupResource(), name)
+}
 
 var _ = Describe("GenericReconciler", func() {
 	var (
@@ -289,6 +338,7 @@ var _ = Describe("GenericReconciler", func() {
 			Transformer: mockTransformer,
 			Gvk:         targetGVK,
 			Recorder:    recorder,
+			RestConfig:  &rest.Config{Host: "https://localhost:6443"},
 			resourceClientFactory: func(dynamic.Interface) modelv1.ResourceClientInterface {
 				return mockResClient
 			},
@@ -433,13 +483,39 @@ var _ = Describe("GenericReconciler", func() {
 			readyCondition := conditions[0].(map[string]interface{})
 			Expect(readyCondition["type"]).To(Equal(ReadyConditionType))
 			Expect(readyCondition["status"]).To(Equal(string(metav1.ConditionFalse)))
-			Expect(readyCondition["reason"]).To(Equal(ReconciliationFailedReason))
+			Expect(readyCondition["reason"]).To(Equal(TransientAPIErrorReason))
+		})
+
+		It("should requeue without backoff if a template fails to render", func() {
+			// ARRANGE
+			target := newTestResource("test-resource", "default", targetGVK)
+			Expect(fakeK8sClient.Create(ctx, target)).To(Succeed())
+
+			mockTransformer.RunFunc = func(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, req ctrl.Request, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+				return nil, fmt.Errorf("failed to execute template deployment.yaml: %w", &transformer.RenderError{Path: "deployment.yaml", Err: fmt.Errorf("map has no entry for key \"replicas\"")})
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-resource", Namespace: "default"}}
+
+			// ACT
+			result, err := reconciler.Reconcile(ctx, req)
+
+			// ASSERT
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(PermanentErrorRequeueAfter))
+
+			updatedTarget := &unstructured.Unstructured{}
+			updatedTarget.SetGroupVersionKind(targetGVK)
+			Expect(fakeK8sClient.Get(ctx, req.NamespacedName, updatedTarget)).To(Succeed())
+			conditions, _, _ := unstructured.NestedSlice(updatedTarget.Object, "status", "conditions")
+			Expect(conditions).To(HaveLen(1))
+			Expect(conditions[0].(map[string]interface{})["reason"]).To(Equal(TemplateErrorReason))
 		})
 	})
 
 	Context("defaultGetResourceReconciler method", func() {
 		It("should return a valid reconciler for supported kinds", func() {
-			supportedKinds := []string{"Deployment", "Service", "Secret", "ConfigMap", "Job", "HorizontalPodAutoscaler", "PodMonitoring"}
+			supportedKinds := []string{"Deployment", "Service", "Secret", "ConfigMap", "Job", "HorizontalPodAutoscaler", "PodMonitoring", "NetworkPolicy", "CiliumNetworkPolicy", "ScaledObject", "PodDisruptionBudget", "PodMonitor", "ServiceMonitor"}
 			for _, kind := range supportedKinds {
 				// Use the 'reconciler' instance from BeforeEach
 				rr, err := reconciler.defaultGetResourceReconciler(kind)
@@ -0,0 +1,412 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	DegradedConditionType     = "Degraded"
+	DependentUnhealthyReason  = "DependentUnhealthy"
+	DependentsHealthyReason   = "DependentsHealthy"
+	DependentUnhealthyEvent   = modelv1.EventReasonDependentUnhealthy
+	DependentRemediatedEvent  = modelv1.EventReasonDependentRemediated
+	HealthRemediationNone     = "None"
+	HealthRemediationRestart  = "Restart"
+	HealthRemediationRollback = "Rollback"
+
+	// remediatedAtAnnotation records when a dependent was last remediated, so
+	// that it gets a full timeout to recover before the next remediation.
+	remediatedAtAnnotation = "model.skippy.io/remediated-at"
+	// jobRestartsAnnotation records on the target how often each of its Jobs
+	// was recreated by the Restart remediation, and when. A recreated Job
+	// does not keep annotations of its own.
+	jobRestartsAnnotation = "model.skippy.io/job-restarts"
+	// maxJobRestarts is how often a Job is recreated per generation of the
+	// target before it is left failed.
+	maxJobRestarts = 3
+	// maxPodFailureReasons caps the pod failure reasons reported per dependent.
+	maxPodFailureReasons = 5
+)
+
+// jobRestart is how often a Job was recreated for a generation of the target,
+// and when it was last recreated.
+type jobRestart struct {
+	Generation  int64       `json:"generation"`
+	Count       int         `json:"count"`
+	RestartedAt metav1.Time `json:"restartedAt"`
+}
+
+// unhealthyDependent describes a dependent that exceeded its health timeout.
+type unhealthyDependent struct {
+	obj     *unstructured.Unstructured
+	message string
+}
+
+// checkDependentHealth sets the Degraded condition of the target from the
+// health of its Jobs and Deployments, and remediates the dependents that
+// exceeded their timeout. It does nothing unless the integration sets health
+// timeouts.
+func (r *GenericReconciler) checkDependentHealth(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(r.Gvk)
+	spec := integrationSpec.Health
+	if spec == nil {
+		return nil
+	}
+
+	var unhealthy []unhealthyDependent
+	for _, obj := range objs {
+		var timeout *metav1.Duration
+		switch obj.GetKind() {
+		case "Job":
+			timeout = spec.JobTimeout
+		case "Deployment":
+			timeout = spec.DeploymentTimeout
+		}
+		if timeout == nil {
+			continue
+		}
+		names := []string{obj.GetName()}
+		if obj.GetKind() == "Deployment" {
+			// The canary of a rollout runs the new revision.
+			names = append(names, obj.GetName()+rolloutCanaryNameSuffix)
+		}
+		for _, name := range names {
+			live, err := rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), name)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("error getting resource %s %s/%s: %w", obj.GroupVersionKind().String(), obj.GetNamespace(), name, err)
+			}
+			if live.GetAnnotations()[rolloutAbortedAnnotation] != "" {
+				continue
+			}
+			problem := dependentProblem(live, timeout.Duration, time.Now())
+			if problem == "" {
+				continue
+			}
+			reasons, err := r.podFailureReasons(ctx, live)
+			if err != nil {
+				return err
+			}
+			if len(reasons) > 0 {
+				problem += ": " + strings.Join(reasons, "; ")
+			}
+			if live.GetKind() == "Job" && spec.Remediation == HealthRemediationRestart {
+				if restart := jobRestarts(target)[live.GetName()]; restart.Generation == target.GetGeneration() && restart.Count >= maxJobRestarts {
+					problem += fmt.Sprintf(" (not recreated after %d restarts)", restart.Count)
+				}
+			}
+			log.Info("Dependent is unhealthy", "kind", live.GetKind(), "name", live.GetName(), "problem", problem)
+			unhealthy = append(unhealthy, unhealthyDependent{obj: live, message: fmt.Sprintf("%s %s %s", live.GetKind(), live.GetName(), problem)})
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               DegradedConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             DependentsHealthyReason,
+		Message:            "All dependents became healthy within their timeouts.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(unhealthy) > 0 {
+		messages := make([]string, len(unhealthy))
+		for i, dependent := range unhealthy {
+			messages[i] = dependent.message
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = DependentUnhealthyReason
+		condition.Message = strings.Join(messages, "\n")
+		if !meta.IsStatusConditionTrue(targetConditions(target), DegradedConditionType) {
+			r.eventf(target, corev1.EventTypeWarning, DependentUnhealthyEvent, "Dependents of %s %s are unhealthy: %s", target.GetKind(), target.GetName(), strings.Join(messages, "; "))
+		}
+	}
+	if err := setTargetCondition(target, condition); err != nil {
+		return err
+	}
+
+	for _, dependent := range unhealthy {
+		if err := r.remediate(ctx, log, target, dependent.obj, spec, rc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependentProblem returns why a Job or Deployment is unhealthy, or "" if it
+// is healthy or still within its timeout.
+func dependentProblem(obj *unstructured.Unstructured, timeout time.Duration, now time.Time) string {
+	since := obj.GetCreationTimestamp().Time
+	switch obj.GetKind() {
+	case "Job":
+		if status, _, _ := dependentCondition(obj, "Complete"); status == "True" {
+			return ""
+		}
+		if status, reason, message := dependentCondition(obj, "Failed"); status == "True" {
+			return fmt.Sprintf("failed (%s): %s", reason, message)
+		}
+	case "Deployment":
+		status, _, _ := dependentCondition(obj, "Available")
+		if status == "True" {
+			return ""
+		}
+		if changed := dependentConditionTime(obj, "Available"); changed.After(since) {
+			since = changed
+		}
+	}
+	if remediatedAt, err := time.Parse(time.RFC3339, obj.GetAnnotations()[remediatedAtAnnotation]); err == nil && remediatedAt.After(since) {
+		since = remediatedAt
+	}
+	if since.IsZero() || now.Sub(since) < timeout {
+		return ""
+	}
+	if obj.GetKind() == "Job" {
+		return fmt.Sprintf("has not completed within %s", timeout)
+	}
+	return fmt.Sprintf("has not become available within %s", timeout)
+}
+
+// dependentCondition returns the status, reason and message of a condition in
+// the status of a dependent.
+func dependentCondition(obj *unstructured.Unstructured, conditionType string) (string, string, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, raw := range conditions {
+		cond, ok := raw.(map[string]interface{})
+		if !ok || getStringValue(cond, "type") != conditionType {
+			continue
+		}
+		return getStringValue(cond, "status"), getStringValue(cond, "reason"), getStringValue(cond, "message")
+	}
+	return "", "", ""
+}
+
+func dependentConditionTime(obj *unstructured.Unstructured, conditionType string) time.Time {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, raw := range conditions {
+		cond, ok := raw.(map[string]interface{})
+		if !ok || getStringValue(cond, "type") != conditionType {
+			continue
+		}
+		changed, _ := time.Parse(time.RFC3339, getStringValue(cond, "lastTransitionTime"))
+		return changed
+	}
+	return time.Time{}
+}
+
+// podFailureReasons gathers why the pods selected by a Job or Deployment are
+// not running, e.g. ImagePullBackOff or OOMKilled.
+func (r *GenericReconciler) podFailureReasons(ctx context.Context, obj *unstructured.Unstructured) ([]string, error) {
+	pods, err := r.selectedPods(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var reasons []string
+	for _, pod := range pods {
+		for _, reason := range podFailures(&pod) {
+			if !seen[reason] {
+				seen[reason] = true
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	sort.Strings(reasons)
+	if len(reasons) > maxPodFailureReasons {
+		reasons = append(reasons[:maxPodFailureReasons], "...")
+	}
+	return reasons, nil
+}
+
+// selectedPods lists the pods matched by the selector of a Job or Deployment.
+func (r *GenericReconciler) selectedPods(ctx context.Context, obj *unstructured.Unstructured) ([]corev1.Pod, error) {
+	matchLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+	if len(matchLabels) == 0 {
+		return nil, nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(obj.GetNamespace()), client.MatchingLabels(matchLabels)); err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s: %w", obj.GetName(), err)
+	}
+	return pods.Items, nil
+}
+
+// podFailures returns the reasons why the containers of a pod are waiting or
+// were terminated with an error.
+func podFailures(pod *corev1.Pod) []string {
+	var failures []string
+	if pod.Status.Phase == corev1.PodPending {
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason != "" {
+				failures = append(failures, fmt.Sprintf("%s: %s", cond.Reason, cond.Message))
+			}
+		}
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" && waiting.Reason != "ContainerCreating" && waiting.Reason != "PodInitializing" {
+			failures = append(failures, fmt.Sprintf("container %s %s", status.Name, waiting.Reason))
+		}
+		for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.ExitCode != 0 {
+				failures = append(failures, fmt.Sprintf("container %s %s (exit code %d)", status.Name, terminated.Reason, terminated.ExitCode))
+			}
+		}
+	}
+	return failures
+}
+
+// remediate takes the configured action on an unhealthy dependent. Remediated
+// Deployments are annotated, so that the action is repeated at most once per
+// timeout. Jobs are recreated with an exponential backoff, at most
+// maxJobRestarts times per generation of the target. Protected dependents are
+// not remediated.
+func (r *GenericReconciler) remediate(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, obj *unstructured.Unstructured, spec *modelv1.IntegrationHealthSpec, rc modelv1.ResourceClientInterface) error {
+	if isProtected(obj) {
+		log.Info("Dependent is protected, not remediating it", "kind", obj.GetKind(), "name", obj.GetName())
+		return nil
+	}
+	switch {
+	case spec.Remediation == HealthRemediationRestart && obj.GetKind() == "Job":
+		restarts := jobRestarts(target)
+		restart := restarts[obj.GetName()]
+		if restart.Generation != target.GetGeneration() {
+			restart = jobRestart{Generation: target.GetGeneration()}
+		}
+		if restart.Count >= maxJobRestarts {
+			log.Info("Job reached its restart limit, not recreating it", "name", obj.GetName(), "restarts", restart.Count)
+			return nil
+		}
+		if backoff := jobRestartBackoff(spec.JobTimeout, restart.Count); time.Since(restart.RestartedAt.Time) < backoff {
+			log.Info("Backing off before recreating Job", "name", obj.GetName(), "restarts", restart.Count, "backoff", backoff)
+			return nil
+		}
+		// The restart is recorded first, so that a Job is never recreated
+		// without being counted.
+		restart.Count++
+		restart.RestartedAt = metav1.NewTime(time.Now().UTC())
+		restarts[obj.GetName()] = restart
+		if err := setJobRestarts(ctx, rc, target, restarts); err != nil {
+			return err
+		}
+		// The Job is recreated by the next reconcile.
+		// Foreground deletion would keep the Job around until its pods are gone.
+		background := metav1.DeletePropagationBackground
+		if err := r.deleteDependent(ctx, rc, obj, &background); err != nil {
+			return fmt.Errorf("failed to delete %s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		r.eventf(target, corev1.EventTypeWarning, DependentRemediatedEvent, "Recreating Job %s/%s after it exceeded its health timeout (restart %d of %d)", obj.GetNamespace(), obj.GetName(), restart.Count, maxJobRestarts)
+	case spec.Remediation == HealthRemediationRestart && obj.GetKind() == "Deployment":
+		pods, err := r.selectedPods(ctx, obj)
+		if err != nil {
+			return err
+		}
+		for i := range pods {
+			if len(podFailures(&pods[i])) == 0 {
+				continue
+			}
+			if err := r.Client.Delete(ctx, &pods[i]); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete pod %s/%s: %w", pods[i].Namespace, pods[i].Name, err)
+			}
+		}
+		updated := obj.DeepCopy()
+		setAnnotation(updated, remediatedAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+		if _, err := rc.Update(ctx, updated.GroupVersionKind(), updated.GetNamespace(), updated); err != nil {
+			return fmt.Errorf("failed to update %s %s/%s: %w", updated.GetKind(), updated.GetNamespace(), updated.GetName(), err)
+		}
+		r.eventf(target, corev1.EventTypeWarning, DependentRemediatedEvent, "Restarted the failing pods of Deployment %s/%s after it exceeded its health timeout", obj.GetNamespace(), obj.GetName())
+	case spec.Remediation == HealthRemediationRollback && obj.GetKind() == "Deployment":
+		canary := obj
+		if !isCanary(obj) {
+			var err error
+			canary, err = rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()+rolloutCanaryNameSuffix)
+			if errors.IsNotFound(err) {
+				log.Info("No rollout in progress to roll back", "name", obj.GetName())
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		reason := "rollout aborted: the new revision exceeded its health timeout"
+		if err := r.updateCanary(ctx, rc, canary, func(obj *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas")
+			setAnnotation(obj, rolloutAbortedAnnotation, reason)
+		}); err != nil {
+			return err
+		}
+		r.eventf(target, corev1.EventTypeWarning, RolloutAbortedEvent, "Aborted rollout of %s/%s: %s", canary.GetNamespace(), strings.TrimSuffix(canary.GetName(), rolloutCanaryNameSuffix), reason)
+	}
+	return nil
+}
+
+// jobRestarts returns the Job restarts recorded on the target by name. An
+// unreadable record is treated as empty.
+func jobRestarts(target *unstructured.Unstructured) map[string]jobRestart {
+	restarts := map[string]jobRestart{}
+	if value := target.GetAnnotations()[jobRestartsAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &restarts); err != nil {
+			return map[string]jobRestart{}
+		}
+	}
+	return restarts
+}
+
+// setJobRestarts records the Job restarts on the target with a merge patch,
+// and updates the annotations and resource version of target to match.
+func setJobRestarts(ctx context.Context, rc modelv1.ResourceClientInterface, target *unstructured.Unstructured, restarts map[string]jobRestart) error {
+	value, err := json.Marshal(restarts)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{jobRestartsAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	patched, err := rc.Patch(ctx, target.GroupVersionKind(), target.GetNamespace(), target.GetName(), types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("failed to record the Job restarts on %s %s/%s: %w", target.GetKind(), target.GetNamespace(), target.GetName(), err)
+	}
+	setAnnotation(target, jobRestartsAnnotation, string(value))
+	target.SetResourceVersion(patched.GetResourceVersion())
+	return nil
+}
+
+// jobRestartBackoff is how long after its last restart a Job that was
+// restarted count times is recreated again: no wait for the first restart,
+// then the Job timeout, doubled with every further restart.
+func jobRestartBackoff(timeout *metav1.Duration, count int) time.Duration {
+	if count == 0 || timeout == nil {
+		return 0
+	}
+	return timeout.Duration << (count - 1)
+}
+
+// isCanary reports whether a Deployment is the canary of a rollout.
+func isCanary(deployment *unstructured.Unstructured) bool {
+	track, _, _ := unstructured.NestedString(deployment.Object, "spec", "selector", "matchLabels", rolloutTrackLabel)
+	return track == "canary"
+}
+
+// setTargetCondition adds or updates a condition in the status of the target.
+func setTargetCondition(target *unstructured.Unstructured, condition metav1.Condition) error {
+	conditions := targetConditions(target)
+	meta.SetStatusCondition(&conditions, condition)
+	return unstructured.SetNestedSlice(target.Object, conditionsToUnstructured(conditions), "status", "conditions")
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// withDependentStatus returns a copy of a dependent that was created at the
+// given time and reports the given conditions.
+func withDependentStatus(obj *unstructured.Unstructured, created time.Time, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	normalizeNumbersToInt64(obj.Object)
+	obj = obj.DeepCopy()
+	obj.SetCreationTimestamp(metav1.NewTime(created))
+	raw := make([]interface{}, len(conditions))
+	for i, cond := range conditions {
+		raw[i] = cond
+	}
+	_ = unstructured.SetNestedSlice(obj.Object, raw, "status", "conditions")
+	return obj
+}
+
+func newTestJob(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"job-name": name}},
+		},
+	}}
+}
+
+func TestDependentProblem(t *testing.T) {
+	now := time.Now()
+	timeout := 10 * time.Minute
+	old := now.Add(-time.Hour)
+
+	testCases := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want string
+	}{
+		{
+			name: "completed job",
+			obj:  withDependentStatus(newTestJob("download"), old, map[string]interface{}{"type": "Complete", "status": "True"}),
+		},
+		{
+			name: "failed job",
+			obj:  withDependentStatus(newTestJob("download"), now, map[string]interface{}{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"}),
+			want: "failed (BackoffLimitExceeded): Job has reached the specified backoff limit",
+		},
+		{
+			name: "job within its timeout",
+			obj:  withDependentStatus(newTestJob("download"), now.Add(-time.Minute)),
+		},
+		{
+			name: "job past its timeout",
+			obj:  withDependentStatus(newTestJob("download"), old),
+			want: "has not completed within 10m0s",
+		},
+		{
+			name: "available deployment",
+			obj:  withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 1), old, map[string]interface{}{"type": "Available", "status": "True"}),
+		},
+		{
+			name: "deployment unavailable for longer than its timeout",
+			obj: withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 1), old.Add(-time.Hour),
+				map[string]interface{}{"type": "Available", "status": "False", "lastTransitionTime": old.UTC().Format(time.RFC3339)}),
+			want: "has not become available within 10m0s",
+		},
+		{
+			name: "deployment that became unavailable recently",
+			obj: withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 1), old,
+				map[string]interface{}{"type": "Available", "status": "False", "lastTransitionTime": now.Add(-time.Minute).UTC().Format(time.RFC3339)}),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, dependentProblem(tc.obj, timeout, now))
+		})
+	}
+
+	t.Run("remediated deployment gets another timeout", func(t *testing.T) {
+		obj := withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 1), old)
+		setAnnotation(obj, remediatedAtAnnotation, now.Add(-time.Minute).UTC().Format(time.RFC3339))
+		assert.Empty(t, dependentProblem(obj, timeout, now))
+	})
+}
+
+func TestPodFailures(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "server", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			{Name: "sidecar", LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+			{Name: "healthy", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			{Name: "starting", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+		},
+	}}
+	assert.Equal(t, []string{"container server ImagePullBackOff", "container sidecar OOMKilled (exit code 137)"}, podFailures(pod))
+
+	unschedulable := &corev1.Pod{Status: corev1.PodStatus{
+		Phase:      corev1.PodPending,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/3 nodes are available"}},
+	}}
+	assert.Equal(t, []string{"Unschedulable: 0/3 nodes are available"}, podFailures(unschedulable))
+}
+
+func TestCheckDependentHealth(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	old := time.Now().Add(-time.Hour)
+	unavailable := map[string]interface{}{"type": "Available", "status": "False", "lastTransitionTime": old.UTC().Format(time.RFC3339)}
+	failingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "vllm-abc", Namespace: "default", Labels: map[string]string{"app": "vllm"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "server", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+		}},
+	}
+
+	newReconciler := func(health *modelv1.IntegrationHealthSpec, objs ...client.Object) (*GenericReconciler, *record.FakeRecorder) {
+		s := runtime.NewScheme()
+		_ = corev1.AddToScheme(s)
+		recorder := record.NewFakeRecorder(10)
+		return &GenericReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+			Scheme:   s,
+			Gvk:      targetGVK,
+			Recorder: recorder,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{Health: health}, true
+				}}
+			}},
+		}, recorder
+	}
+	degraded := func(target *unstructured.Unstructured) *metav1.Condition {
+		return meta.FindStatusCondition(targetConditions(target), DegradedConditionType)
+	}
+
+	t.Run("without health timeouts nothing is checked", func(t *testing.T) {
+		r, _ := newReconciler(nil)
+		target := newTestResource("test-resource", "default", targetGVK)
+		require.NoError(t, r.checkDependentHealth(context.Background(), testLogger(), target, []*unstructured.Unstructured{newRolloutDeployment("vllm", "vllm:v1", 1)}, &mapResourceClient{objs: map[string]*unstructured.Unstructured{}}))
+		assert.Nil(t, degraded(target))
+	})
+
+	t.Run("unavailable deployment is restarted", func(t *testing.T) {
+		health := &modelv1.IntegrationHealthSpec{DeploymentTimeout: &metav1.Duration{Duration: 10 * time.Minute}, Remediation: HealthRemediationRestart}
+		r, recorder := newReconciler(health, failingPod.DeepCopy())
+		target := newTestResource("test-resource", "default", targetGVK)
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{
+			"vllm": withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 1), old, unavailable),
+		}}
+
+		require.NoError(t, r.checkDependentHealth(context.Background(), testLogger(), target, []*unstructured.Unstructured{newRolloutDeployment("vllm", "vllm:v1", 1)}, store))
+
+		cond := degraded(target)
+		require.NotNil(t, cond)
+		assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		assert.Equal(t, DependentUnhealthyReason, cond.Reason)
+		assert.Equal(t, "Deployment vllm has not become available within 10m0s: container server CrashLoopBackOff", cond.Message)
+		assert.Contains(t, <-recorder.Events, DependentUnhealthyEvent)
+		assert.Contains(t, <-recorder.Events, DependentRemediatedEvent)
+
+		err := r.Client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "vllm-abc"}, &corev1.Pod{})
+		assert.True(t, errors.IsNotFound(err), "the failing pod must be deleted")
+		assert.NotEmpty(t, store.objs["vllm"].GetAnnotations()[remediatedAtAnnotation])
+
+		// The remediated Deployment gets another timeout to recover.
+		require.NoError(t, r.checkDependentHealth(context.Background(), testLogger(), target, []*unstructured.Unstructured{newRolloutDeployment("vllm", "vllm:v1", 1)}, store))
+		assert.Equal(t, metav1.ConditionFalse, degraded(target).Status)
+		assert.Equal(t, DependentsHealthyReason, degraded(target).Reason)
+	})
+
+	t.Run("failed job is recreated with a backoff and a limit", func(t *testing.T) {
+		health := &modelv1.IntegrationHealthSpec{JobTimeout: &metav1.Duration{Duration: 10 * time.Minute}, Remediation: HealthRemediationRestart}
+		r, recorder := newReconciler(health)
+		target := newTestResource("test-resource", "default", targetGVK)
+		target.SetGeneration(1)
+		failed := withDependentStatus(newTestJob("download"), time.Now(), map[string]interface{}{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"})
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{
+			"test-resource": target.DeepCopy(),
+			"download":      failed.DeepCopy(),
+		}}
+		check := func() {
+			require.NoError(t, r.checkDependentHealth(context.Background(), testLogger(), target, []*unstructured.Unstructured{newTestJob("download")}, store))
+		}
+
+		check()
+		assert.Contains(t, <-recorder.Events, DependentUnhealthyEvent)
+		assert.Contains(t, <-recorder.Events, "restart 1 of 3")
+		assert.NotContains(t, store.objs, "download", "the failed Job must be deleted")
+		assert.Equal(t, 1, jobRestarts(store.objs["test-resource"])["download"].Count)
+		assert.Equal(t, jobRestarts(store.objs["test-resource"]), jobRestarts(target))
+
+		// The recreated Job fails again, but is not recreated within the backoff.
+		store.objs["download"] = failed.DeepCopy()
+		check()
+		assert.Contains(t, store.objs, "download")
+		assert.Equal(t, 1, jobRestarts(target)["download"].Count)
+
+		// After the limit, the Job is left failed.
+		restarts := jobRestarts(target)
+		restarts["download"] = jobRestart{Generation: 1, Count: maxJobRestarts, RestartedAt: metav1.NewTime(old)}
+		require.NoError(t, setJobRestarts(context.Background(), store, target, restarts))
+		check()
+		assert.Contains(t, store.objs, "download")
+		assert.Contains(t, degraded(target).Message, "(not recreated after 3 restarts)")
+
+		// A new generation of the target gets new restarts.
+		target.SetGeneration(2)
+		check()
+		assert.NotContains(t, store.objs, "download")
+		assert.Equal(t, int64(2), jobRestarts(target)["download"].Generation)
+		assert.Equal(t, 1, jobRestarts(target)["download"].Count)
+	})
+
+	t.Run("unavailable canary is rolled back", func(t *testing.T) {
+		health := &modelv1.IntegrationHealthSpec{DeploymentTimeout: &metav1.Duration{Duration: 10 * time.Minute}, Remediation: HealthRemediationRollback}
+		r, recorder := newReconciler(health)
+		target := newTestResource("test-resource", "default", targetGVK)
+		desired := newRolloutDeployment("vllm", "vllm:v2", 4)
+		normalizeNumbersToInt64(desired.Object)
+		canary, err := newCanaryDeployment(desired, "vllm-canary", &modelv1.IntegrationRolloutSpec{Strategy: RolloutStrategyCanary})
+		require.NoError(t, err)
+		store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{
+			"vllm":        withDependentStatus(newRolloutDeployment("vllm", "vllm:v1", 4), old, map[string]interface{}{"type": "Available", "status": "True"}),
+			"vllm-canary": withDependentStatus(canary, old, unavailable),
+		}}
+
+		require.NoError(t, r.checkDependentHealth(context.Background(), testLogger(), target, []*unstructured.Unstructured{newRolloutDeployment("vllm", "vllm:v2", 4)}, store))
+
+		assert.Equal(t, metav1.ConditionTrue, degraded(target).Status)
+		assert.Contains(t, degraded(target).Message, "Deployment vllm-canary has not become available")
+		assert.Contains(t, <-recorder.Events, DependentUnhealthyEvent)
+		assert.Contains(t, <-recorder.Events, RolloutAbortedEvent)
+		assert.Equal(t, int64(0), store.objs["vllm-canary"].Object["spec"].(map[string]interface{})["replicas"])
+		assert.NotEmpty(t, store.objs["vllm-canary"].GetAnnotations()[rolloutAbortedAnnotation])
+	})
+}
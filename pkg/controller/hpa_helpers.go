@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -154,8 +156,31 @@ func getMetricsFromHPA(spec map[string]interface{}, log logr.Logger) []map[strin
 				}
 				normalizedMetricMap["resource"] = resourceMetricsMap
 
-			// Add cases for "Object" and "External" if you plan to support them
-			// These would require similar explicit manual copying and type normalization for their specific fields.
+			case "External":
+				externalMetricsMap := make(map[string]interface{})
+				if externalData, okExternal := metricMap["external"].(map[string]interface{}); okExternal {
+					externalMetricsMap["metric"] = normalizeMetricIdentifier(externalData["metric"])
+					externalMetricsMap["target"] = normalizeMetricTarget(externalData["target"], log)
+				}
+				normalizedMetricMap["external"] = externalMetricsMap
+
+			case "Object":
+				objectMetricsMap := make(map[string]interface{})
+				if objectData, okObject := metricMap["object"].(map[string]interface{}); okObject {
+					describedObject := make(map[string]interface{})
+					if describedData, okDescribed := objectData["describedObject"].(map[string]interface{}); okDescribed {
+						for _, field := range []string{"apiVersion", "kind", "name"} {
+							if value, okValue := describedData[field].(string); okValue {
+								describedObject[field] = value
+							}
+						}
+					}
+					objectMetricsMap["describedObject"] = describedObject
+					objectMetricsMap["metric"] = normalizeMetricIdentifier(objectData["metric"])
+					objectMetricsMap["target"] = normalizeMetricTarget(objectData["target"], log)
+				}
+				normalizedMetricMap["object"] = objectMetricsMap
+
 			default:
 				log.Info("Unsupported HPA metric type encountered, skipping normalization for specific fields", "type", typeVal)
 				// If you want to include unrecognized types in diffing, you'd copy more fields here manually.
@@ -178,34 +203,129 @@ func getMetricsFromHPA(spec map[string]interface{}, log logr.Logger) []map[strin
 			return typeI < typeJ // Sort by metric type (e.g., "Pods" before "Resource")
 		}
 
-		// Then, sort by specific metric name based on its type
-		var nameI, nameJ string
-		if typeI == "Pods" {
-			// Safely extract name for sorting
-			if podsMap, ok := extractedMetrics[i]["pods"].(map[string]interface{}); ok {
-				if metricMap, ok := podsMap["metric"].(map[string]interface{}); ok {
-					nameI, _ = metricMap["name"].(string)
-				}
-			}
-			if podsMap, ok := extractedMetrics[j]["pods"].(map[string]interface{}); ok {
-				if metricMap, ok := podsMap["metric"].(map[string]interface{}); ok {
-					nameJ, _ = metricMap["name"].(string)
-				}
+		// Then, sort by the metric of the specific type.
+		nameI, nameJ := metricSortKey(extractedMetrics[i]), metricSortKey(extractedMetrics[j])
+		return nameI < nameJ
+	})
+
+	return extractedMetrics
+}
+
+// metricSortKey returns the key that orders normalized metrics of the same type:
+// the resource name, or the metric name and selector, and for Object metrics the
+// described object.
+func metricSortKey(metric map[string]interface{}) string {
+	typeVal, _ := metric["type"].(string)
+	switch typeVal {
+	case "Resource":
+		resourceMap, _ := metric["resource"].(map[string]interface{})
+		name, _ := resourceMap["name"].(string)
+		return name
+	case "Pods", "External", "Object":
+		// fmt prints maps with sorted keys, so equal selectors print equally.
+		typeMap, _ := metric[strings.ToLower(typeVal)].(map[string]interface{})
+		metricMap, _ := typeMap["metric"].(map[string]interface{})
+		key := fmt.Sprintf("%v|%v", metricMap["name"], metricMap["selector"])
+		if describedObject, ok := typeMap["describedObject"].(map[string]interface{}); ok {
+			key = fmt.Sprintf("%v/%v/%v|%s", describedObject["apiVersion"], describedObject["kind"], describedObject["name"], key)
+		}
+		return key
+	}
+	return ""
+}
+
+// normalizeMetricIdentifier normalizes the metric of an External or Object
+// metric: its name and, if it selects anything, its label selector.
+func normalizeMetricIdentifier(metricInterface interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{})
+	metricData, ok := metricInterface.(map[string]interface{})
+	if !ok {
+		return normalized
+	}
+	if nameVal, okName := metricData["name"].(string); okName {
+		normalized["name"] = nameVal
+	}
+	if selector := normalizeLabelSelector(metricData["selector"]); len(selector) > 0 {
+		normalized["selector"] = selector
+	}
+	return normalized
+}
+
+// normalizeLabelSelector copies matchLabels and matchExpressions, with the
+// expressions and their values sorted. Empty selectors are returned empty, as
+// the API server drops them.
+func normalizeLabelSelector(selectorInterface interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{})
+	selectorData, ok := selectorInterface.(map[string]interface{})
+	if !ok {
+		return normalized
+	}
+	if matchLabels, okLabels := selectorData["matchLabels"].(map[string]interface{}); okLabels && len(matchLabels) > 0 {
+		labels := make(map[string]interface{}, len(matchLabels))
+		for key, value := range matchLabels {
+			labels[key] = fmt.Sprintf("%v", value)
+		}
+		normalized["matchLabels"] = labels
+	}
+	if matchExpressions, okExpressions := selectorData["matchExpressions"].([]interface{}); okExpressions && len(matchExpressions) > 0 {
+		expressions := make([]interface{}, 0, len(matchExpressions))
+		for _, expressionInterface := range matchExpressions {
+			expressionData, okExpression := expressionInterface.(map[string]interface{})
+			if !okExpression {
+				continue
 			}
-		} else if typeI == "Resource" {
-			// Safely extract name for sorting
-			if resourceMap, ok := extractedMetrics[i]["resource"].(map[string]interface{}); ok {
-				nameI, _ = resourceMap["name"].(string)
+			expression := map[string]interface{}{
+				"key":      fmt.Sprintf("%v", expressionData["key"]),
+				"operator": fmt.Sprintf("%v", expressionData["operator"]),
 			}
-			if resourceMap, ok := extractedMetrics[j]["resource"].(map[string]interface{}); ok {
-				nameJ, _ = resourceMap["name"].(string)
+			if valuesInterface, okValues := expressionData["values"].([]interface{}); okValues && len(valuesInterface) > 0 {
+				values := make([]string, 0, len(valuesInterface))
+				for _, value := range valuesInterface {
+					values = append(values, fmt.Sprintf("%v", value))
+				}
+				sort.Strings(values)
+				expression["values"] = values
 			}
+			expressions = append(expressions, expression)
 		}
-		// Add sorting for other types if necessary (e.g., Object, External)
-		// using their specific nested paths.
+		sort.Slice(expressions, func(i, j int) bool {
+			return fmt.Sprintf("%v", expressions[i]) < fmt.Sprintf("%v", expressions[j])
+		})
+		normalized["matchExpressions"] = expressions
+	}
+	return normalized
+}
 
-		return nameI < nameJ
-	})
+// normalizeMetricTarget normalizes a metric target. Value and averageValue are
+// quantities, which the API server stores in canonical form (e.g. "1k" for
+// "1000"), so they are compared in that form.
+func normalizeMetricTarget(targetInterface interface{}, log logr.Logger) map[string]interface{} {
+	normalized := make(map[string]interface{})
+	targetData, ok := targetInterface.(map[string]interface{})
+	if !ok {
+		return normalized
+	}
+	if typeVal, okType := targetData["type"].(string); okType {
+		normalized["type"] = typeVal
+	}
+	for _, field := range []string{"value", "averageValue"} {
+		if value, okValue := targetData[field]; okValue {
+			normalized[field] = canonicalQuantity(value)
+		}
+	}
+	if avgUtilization, okAvgUtilization := targetData["averageUtilization"]; okAvgUtilization {
+		normalized["averageUtilization"] = getInt32ValueFromInterface(avgUtilization, log)
+	}
+	return normalized
+}
 
-	return extractedMetrics
+// canonicalQuantity returns the canonical form of a quantity, or the value as
+// a string if it is not a quantity.
+func canonicalQuantity(value interface{}) string {
+	raw := fmt.Sprintf("%v", value)
+	quantity, err := resource.ParseQuantity(raw)
+	if err != nil {
+		return raw
+	}
+	return quantity.String()
 }
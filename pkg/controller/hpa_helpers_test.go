@@ -82,6 +82,48 @@ func TestGetMetricsFromHPA(t *testing.T) {
 				{"type": "Resource", "resource": map[string]interface{}{"name": "cpu", "target": map[string]interface{}{"type": "Utilization", "averageUtilization": int32(80)}}},
 			},
 		},
+		{
+			name: "external metric",
+			inputMetrics: []interface{}{map[string]interface{}{
+				"type": "External", "external": map[string]interface{}{
+					"metric": map[string]interface{}{"name": "vllm:num_requests_waiting", "selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{"model": "llama"},
+						"matchExpressions": []interface{}{
+							map[string]interface{}{"key": "zone", "operator": "In", "values": []interface{}{"b", "a"}},
+						},
+					}},
+					"target": map[string]interface{}{"type": "AverageValue", "averageValue": "1000"},
+				},
+			}},
+			expectedMetrics: []map[string]interface{}{
+				{"type": "External", "external": map[string]interface{}{
+					"metric": map[string]interface{}{"name": "vllm:num_requests_waiting", "selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{"model": "llama"},
+						"matchExpressions": []interface{}{
+							map[string]interface{}{"key": "zone", "operator": "In", "values": []string{"a", "b"}},
+						},
+					}},
+					"target": map[string]interface{}{"type": "AverageValue", "averageValue": "1k"},
+				}},
+			},
+		},
+		{
+			name: "object metric with an empty selector",
+			inputMetrics: []interface{}{map[string]interface{}{
+				"type": "Object", "object": map[string]interface{}{
+					"describedObject": map[string]interface{}{"apiVersion": "v1", "kind": "Service", "name": "vllm"},
+					"metric":          map[string]interface{}{"name": "requests-per-second", "selector": map[string]interface{}{}},
+					"target":          map[string]interface{}{"type": "Value", "value": "0.5"},
+				},
+			}},
+			expectedMetrics: []map[string]interface{}{
+				{"type": "Object", "object": map[string]interface{}{
+					"describedObject": map[string]interface{}{"apiVersion": "v1", "kind": "Service", "name": "vllm"},
+					"metric":          map[string]interface{}{"name": "requests-per-second"},
+					"target":          map[string]interface{}{"type": "Value", "value": "500m"},
+				}},
+			},
+		},
 		{
 			name:         "multiple metrics get sorted by type then name",
 			inputMetrics: []interface{}{resourceMemoryMetric, podsMetric, resourceCPUMetric},
@@ -133,6 +175,21 @@ func TestHPADiff(t *testing.T) {
 		"type": "Pods", "pods": map[string]interface{}{"metric": map[string]interface{}{"name": "rps"}, "target": map[string]interface{}{"type": "AverageValue", "averageValue": "100"}},
 	}}
 
+	externalMetric := func(name, averageValue string, zones ...interface{}) map[string]interface{} {
+		metric := map[string]interface{}{"name": name}
+		if len(zones) > 0 {
+			metric["selector"] = map[string]interface{}{"matchExpressions": []interface{}{
+				map[string]interface{}{"key": "zone", "operator": "In", "values": zones},
+			}}
+		}
+		return map[string]interface{}{
+			"type": "External", "external": map[string]interface{}{
+				"metric": metric,
+				"target": map[string]interface{}{"type": "AverageValue", "averageValue": averageValue},
+			},
+		}
+	}
+
 	testCases := []struct {
 		name        string
 		existingHPA *unstructured.Unstructured
@@ -194,6 +251,36 @@ func TestHPADiff(t *testing.T) {
 			}),
 			expectDiff: false, // This verifies that the sorting in getMetricsFromHPA works
 		},
+		{
+			name:        "external metric quantities in canonical form (should NOT be a diff)",
+			existingHPA: newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("vllm:num_requests_waiting", "1k")}),
+			desiredHPA:  newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("vllm:num_requests_waiting", "1000")}),
+			expectDiff:  false,
+		},
+		{
+			name:        "different external metric target",
+			existingHPA: newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("vllm:num_requests_waiting", "10")}),
+			desiredHPA:  newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("vllm:num_requests_waiting", "20")}),
+			expectDiff:  true,
+		},
+		{
+			name: "external metrics that differ only by selector, in another order (should NOT be a diff)",
+			existingHPA: newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{
+				externalMetric("queue", "10", "b", "a"),
+				externalMetric("queue", "20", "c"),
+			}),
+			desiredHPA: newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{
+				externalMetric("queue", "20", "c"),
+				externalMetric("queue", "10", "a", "b"),
+			}),
+			expectDiff: false,
+		},
+		{
+			name:        "different external metric selector",
+			existingHPA: newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("queue", "10", "a")}),
+			desiredHPA:  newUnstructuredHPA(t, "test-hpa", 1, 10, []interface{}{externalMetric("queue", "10", "b")}),
+			expectDiff:  true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// recordImageDigests copies the digests that the images of the rendered
+// workloads are pinned to into status.imageDigests of the target, keyed by
+// the image as the templates name it. The transformer falls back to these
+// digests when a registry cannot be reached.
+func recordImageDigests(target *unstructured.Unstructured, objs []*unstructured.Unstructured) {
+	digests := map[string]interface{}{}
+	for _, obj := range objs {
+		for image, digest := range transformer.ImageDigests(obj) {
+			digests[image] = digest
+		}
+	}
+	if len(digests) == 0 {
+		unstructured.RemoveNestedField(target.Object, "status", "imageDigests")
+		return
+	}
+	_ = unstructured.SetNestedField(target.Object, digests, "status", "imageDigests")
+}
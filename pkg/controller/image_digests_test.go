@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRecordImageDigests(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", gvk)
+
+	service := newTestResource("svc", "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+	deployment := newTestResource("vllm", "default", schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	assert.NoError(t, unstructured.SetNestedSlice(deployment.Object, []interface{}{
+		map[string]interface{}{"name": "server", "image": "vllm/vllm-openai:v0.8.0@sha256:aaaa"},
+		map[string]interface{}{"name": "sidecar", "image": "busybox"},
+	}, "spec", "template", "spec", "containers"))
+
+	recordImageDigests(target, []*unstructured.Unstructured{service, deployment})
+	digests, found, err := unstructured.NestedStringMap(target.Object, "status", "imageDigests")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{"vllm/vllm-openai:v0.8.0": "sha256:aaaa"}, digests)
+
+	// Stale digests are removed once no workload is pinned.
+	recordImageDigests(target, []*unstructured.Unstructured{service})
+	_, found, _ = unstructured.NestedFieldNoCopy(target.Object, "status", "imageDigests")
+	assert.False(t, found)
+}
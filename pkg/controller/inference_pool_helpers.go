@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// inferenceExtensionGroup is the API group of the InferencePool and
+// InferenceModel kinds of the Gateway API Inference Extension.
+const inferenceExtensionGroup = "inference.networking.x-k8s.io"
+
+var gatewayGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+
+// inferencePoolDefaults and inferenceModelDefaults are the values the
+// Inference Extension uses for unset fields of the references in the spec, so
+// that a template that spells out a default does not differ from one that
+// leaves it out.
+var (
+	inferencePoolDefaults = map[string]map[string]interface{}{
+		"extensionRef": {"group": "", "kind": "Service", "portNumber": int64(9002), "failureMode": "FailClose"},
+	}
+	inferenceModelDefaults = map[string]map[string]interface{}{
+		"poolRef": {"group": inferenceExtensionGroup, "kind": "InferencePool"},
+	}
+)
+
+// inferencePoolDiff compares the specs of two InferencePools, with unset
+// fields of the endpoint picker reference as their defaults.
+func (r *GenericReconciler) inferencePoolDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	return inferenceExtensionDiff(existingObj, obj, inferencePoolDefaults, log)
+}
+
+// inferenceModelDiff compares the specs of two InferenceModels, with unset
+// fields of the pool reference as their defaults.
+func (r *GenericReconciler) inferenceModelDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	return inferenceExtensionDiff(existingObj, obj, inferenceModelDefaults, log)
+}
+
+func inferenceExtensionDiff(existingObj, obj *unstructured.Unstructured, defaults map[string]map[string]interface{}, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	normalizedExisting := normalizeInferenceExtensionSpec(existingSpec, defaults)
+	normalizedDesired := normalizeInferenceExtensionSpec(desiredSpec, defaults)
+	if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+		log.Info("Found a difference in the "+obj.GetKind()+" spec", "difference", cmp.Diff(normalizedExisting, normalizedDesired))
+		return true, nil
+	}
+	return false, nil
+}
+
+// normalizeInferenceExtensionSpec returns a copy of an InferencePool or
+// InferenceModel spec with numbers as int64 and defaults filled in.
+func normalizeInferenceExtensionSpec(spec map[string]interface{}, defaults map[string]map[string]interface{}) map[string]interface{} {
+	normalized, _ := normalizeNumbersToInt64(copyJSONValue(spec)).(map[string]interface{})
+	for reference, fields := range defaults {
+		nested, ok := normalized[reference].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for field, value := range fields {
+			if _, set := nested[field]; !set {
+				nested[field] = value
+			}
+		}
+	}
+	return normalized
+}
+
+// recordInferencePool copies the address of the Gateway that routes to the
+// first InferencePool among the dependents into status.inferencePool of the
+// target, so that clients find the model-aware endpoint without following
+// the pool and its routes. The Gateway is the first parent that accepted the
+// pool, and the address is left out until the Gateway reports one.
+func (r *GenericReconciler) recordInferencePool(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	var pool *unstructured.Unstructured
+	for _, obj := range objs {
+		if gvk := obj.GroupVersionKind(); gvk.Group == inferenceExtensionGroup && gvk.Kind == "InferencePool" {
+			pool = obj
+			break
+		}
+	}
+	if pool == nil {
+		unstructured.RemoveNestedField(target.Object, "status", "inferencePool")
+		return nil
+	}
+	status, err := inferencePoolStatus(ctx, log, pool, rc)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(target.Object, status, "status", "inferencePool")
+}
+
+// inferencePoolStatus returns the name of pool, and the Gateway that accepted
+// it and its address once they are known.
+func inferencePoolStatus(ctx context.Context, log logr.Logger, pool *unstructured.Unstructured, rc modelv1.ResourceClientInterface) (map[string]interface{}, error) {
+	status := map[string]interface{}{"name": pool.GetName()}
+	live, err := rc.Get(ctx, pool.GroupVersionKind(), pool.GetNamespace(), pool.GetName())
+	if errors.IsNotFound(err) {
+		return status, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting resource %s %s/%s: %w", pool.GroupVersionKind().String(), pool.GetNamespace(), pool.GetName(), err)
+	}
+	gatewayNamespace, gatewayName := acceptingGateway(live)
+	if gatewayName == "" {
+		log.V(1).Info("InferencePool is not accepted by a Gateway yet", "name", pool.GetName())
+		return status, nil
+	}
+	status["gateway"] = gatewayNamespace + "/" + gatewayName
+
+	gateway, err := rc.Get(ctx, gatewayGVK, gatewayNamespace, gatewayName)
+	if errors.IsNotFound(err) {
+		return status, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting resource %s %s/%s: %w", gatewayGVK.String(), gatewayNamespace, gatewayName, err)
+	}
+	addresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+	for _, rawAddress := range addresses {
+		address, _ := rawAddress.(map[string]interface{})
+		if value := getStringValue(address, "value"); value != "" {
+			status["address"] = value
+			break
+		}
+	}
+	return status, nil
+}
+
+// acceptingGateway returns the first Gateway that reports an Accepted
+// condition in the status of an InferencePool. v1alpha2 lists the parents in
+// status.parent, later versions in status.parents.
+func acceptingGateway(pool *unstructured.Unstructured) (namespace, name string) {
+	parents, found, _ := unstructured.NestedSlice(pool.Object, "status", "parents")
+	if !found {
+		parents, _, _ = unstructured.NestedSlice(pool.Object, "status", "parent")
+	}
+	for _, rawParent := range parents {
+		parent, _ := rawParent.(map[string]interface{})
+		ref, _ := parent["parentRef"].(map[string]interface{})
+		if kind := getStringValue(ref, "kind"); kind != "" && kind != "Gateway" {
+			continue
+		}
+		conditions, _ := parent["conditions"].([]interface{})
+		for _, rawCondition := range conditions {
+			condition, _ := rawCondition.(map[string]interface{})
+			if getStringValue(condition, "type") == "Accepted" && getStringValue(condition, "status") == "True" {
+				namespace = getStringValue(ref, "namespace")
+				if namespace == "" {
+					namespace = pool.GetNamespace()
+				}
+				return namespace, getStringValue(ref, "name")
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newTestInferencePool(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "inference.networking.x-k8s.io/v1alpha2",
+		"kind":       "InferencePool",
+		"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+		"spec":       spec,
+	}}
+}
+
+func TestInferencePoolDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	desired := newTestInferencePool(map[string]interface{}{
+		"selector":         map[string]interface{}{"app": "llama"},
+		"targetPortNumber": int64(8000),
+		"extensionRef":     map[string]interface{}{"name": "llama-epp"},
+	})
+
+	// The API server fills in the defaults of the extension reference.
+	existing := newTestInferencePool(map[string]interface{}{
+		"selector":         map[string]interface{}{"app": "llama"},
+		"targetPortNumber": int64(8000),
+		"extensionRef":     map[string]interface{}{"name": "llama-epp", "kind": "Service", "group": "", "portNumber": int64(9002), "failureMode": "FailClose"},
+	})
+	changed, err := r.inferencePoolDiff(existing, desired, testLogger())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	failOpen := desired.DeepCopy()
+	_ = unstructured.SetNestedField(failOpen.Object, "FailOpen", "spec", "extensionRef", "failureMode")
+	changed, err = r.inferencePoolDiff(existing, failOpen, testLogger())
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	otherPort := desired.DeepCopy()
+	_ = unstructured.SetNestedField(otherPort.Object, int64(8080), "spec", "targetPortNumber")
+	changed, err = r.inferencePoolDiff(existing, otherPort, testLogger())
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestInferenceModelDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	newModel := func(poolRef map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "inference.networking.x-k8s.io/v1alpha2",
+			"kind":       "InferenceModel",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec":       map[string]interface{}{"modelName": "llama", "poolRef": poolRef},
+		}}
+	}
+
+	changed, err := r.inferenceModelDiff(
+		newModel(map[string]interface{}{"name": "llama", "group": "inference.networking.x-k8s.io", "kind": "InferencePool"}),
+		newModel(map[string]interface{}{"name": "llama"}),
+		testLogger())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = r.inferenceModelDiff(newModel(map[string]interface{}{"name": "llama"}), newModel(map[string]interface{}{"name": "mistral"}), testLogger())
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestRecordInferencePool(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	r := &GenericReconciler{}
+	pool := newTestInferencePool(map[string]interface{}{"selector": map[string]interface{}{"app": "llama"}})
+	store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{}}
+	inferencePool := func(target *unstructured.Unstructured) map[string]interface{} {
+		status, _, _ := unstructured.NestedMap(target.Object, "status", "inferencePool")
+		return status
+	}
+
+	target := newTestResource("test-resource", "default", gvk)
+	require.NoError(t, r.recordInferencePool(context.Background(), testLogger(), target, []*unstructured.Unstructured{pool}, store))
+	assert.Equal(t, map[string]interface{}{"name": "llama"}, inferencePool(target), "the pool does not exist yet")
+
+	live := pool.DeepCopy()
+	_ = unstructured.SetNestedSlice(live.Object, []interface{}{
+		map[string]interface{}{
+			"parentRef":  map[string]interface{}{"kind": "Gateway", "name": "inference-gateway", "namespace": "gateways"},
+			"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": "True"}},
+		},
+	}, "status", "parent")
+	store.objs["llama"] = live
+	require.NoError(t, r.recordInferencePool(context.Background(), testLogger(), target, []*unstructured.Unstructured{pool}, store))
+	assert.Equal(t, map[string]interface{}{"name": "llama", "gateway": "gateways/inference-gateway"}, inferencePool(target), "the Gateway has no address yet")
+
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{"status": map[string]interface{}{
+		"addresses": []interface{}{map[string]interface{}{"type": "IPAddress", "value": "10.0.0.7"}},
+	}}}
+	gateway.SetGroupVersionKind(gatewayGVK)
+	gateway.SetName("inference-gateway")
+	store.objs["inference-gateway"] = gateway
+	require.NoError(t, r.recordInferencePool(context.Background(), testLogger(), target, []*unstructured.Unstructured{pool}, store))
+	assert.Equal(t, map[string]interface{}{"name": "llama", "gateway": "gateways/inference-gateway", "address": "10.0.0.7"}, inferencePool(target))
+
+	// The status is removed once the template stops rendering a pool.
+	require.NoError(t, r.recordInferencePool(context.Background(), testLogger(), target, nil, store))
+	assert.Nil(t, inferencePool(target))
+}
+
+func TestAcceptingGateway(t *testing.T) {
+	pool := newTestInferencePool(map[string]interface{}{})
+	_ = unstructured.SetNestedSlice(pool.Object, []interface{}{
+		map[string]interface{}{
+			"parentRef":  map[string]interface{}{"name": "rejected"},
+			"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": "False"}},
+		},
+		map[string]interface{}{
+			"parentRef":  map[string]interface{}{"name": "accepted"},
+			"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": "True"}},
+		},
+	}, "status", "parents")
+
+	namespace, name := acceptingGateway(pool)
+	assert.Equal(t, "default", namespace, "the namespace of the pool is the default")
+	assert.Equal(t, "accepted", name)
+}
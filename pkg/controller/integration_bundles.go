@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	BundlesVerifiedConditionType   = "BundlesVerified"
+	AllBundlesVerifiedReason       = "AllBundlesVerified"
+	BundleVerificationFailedReason = "BundleVerificationFailed"
+)
+
+// verifyBundles verifies the packaged template bundles of the integrations
+// before they are loaded, and returns the specs whose bundles passed. The
+// verified bundles are listed in status.bundles, and failures in the
+// BundlesVerified condition, when writeStatus is set. Integrations without
+// packaged bundles or package settings get no condition.
+func (r *IntegrationReconciler) verifyBundles(ctx context.Context, integration *modelv1.Integration, writeStatus bool, log logr.Logger) ([]modelv1.IntegrationSpec, error) {
+	var verified []modelv1.IntegrationSpec
+	var bundles []modelv1.IntegrationBundleStatus
+	var failures []string
+	packaged := false
+	for _, spec := range integration.Spec {
+		if spec.Package != nil {
+			packaged = true
+		}
+		specBundles, err := r.Transformer.VerifyBundles(ctx, r.Client, spec)
+		if err != nil {
+			log.Error(err, "Not loading integration", "gvk", fmt.Sprintf("%s/%s/%s", spec.Group, spec.Version, spec.Kind))
+			failures = append(failures, fmt.Sprintf("%s/%s/%s: %v", spec.Group, spec.Version, spec.Kind, err))
+			packaged = true
+			continue
+		}
+		verified = append(verified, spec)
+		bundles = append(bundles, specBundles...)
+	}
+	if len(bundles) > 0 {
+		packaged = true
+	}
+	existing := meta.FindStatusCondition(integration.Status.Conditions, BundlesVerifiedConditionType)
+	if !writeStatus || (!packaged && existing == nil) {
+		return verified, nil
+	}
+
+	status := integration.Status.DeepCopy()
+	status.Bundles = bundles
+	condition := metav1.Condition{
+		Type:               BundlesVerifiedConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             AllBundlesVerifiedReason,
+		Message:            fmt.Sprintf("%d packaged template bundle(s) match their metadata. See status.bundles.", len(bundles)),
+		ObservedGeneration: integration.Generation,
+	}
+	if len(failures) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = BundleVerificationFailedReason
+		condition.Message = fmt.Sprintf("Integrations whose template bundles failed verification are not loaded: %s", strings.Join(failures, "; "))
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	if equality.Semantic.DeepEqual(status, &integration.Status) {
+		return verified, nil
+	}
+	integration.Status = *status
+	return verified, r.Status().Update(ctx, integration)
+}
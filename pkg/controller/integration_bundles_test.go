@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestVerifyBundles(t *testing.T) {
+	integration := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "integrations", Namespace: "team-a", Generation: 3},
+		Spec: []modelv1.IntegrationSpec{
+			{Group: "model.skippy.io", Version: "v1", Kind: "InferenceService", Templates: []modelv1.IntegrationApiTemplatesSpec{{Path: "gcs://models/vllm"}}},
+			{Group: "model.skippy.io", Version: "v1", Kind: "Agent", Templates: []modelv1.IntegrationApiTemplatesSpec{{Path: "gcs://models/agent"}}},
+		},
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, modelv1.AddToScheme(s))
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(integration).WithStatusSubresource(integration).Build()
+	tampered := true
+	bundle := modelv1.IntegrationBundleStatus{Group: "model.skippy.io", Version: "v1", Kind: "InferenceService", Path: "gcs://models/vllm", Name: "vllm-serving", BundleVersion: "1.4.0", Digest: "sha256:1234"}
+	r := &IntegrationReconciler{
+		Client: c,
+		Transformer: &MockTransformer{
+			VerifyBundlesFunc: func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]modelv1.IntegrationBundleStatus, error) {
+				if spec.Kind == "Agent" {
+					if tampered {
+						return nil, errors.New("template bundle gcs://models/agent failed verification: the checksum of pod.yaml does not match metadata.yaml")
+					}
+					return nil, nil
+				}
+				return []modelv1.IntegrationBundleStatus{bundle}, nil
+			},
+		},
+	}
+
+	verified, err := r.verifyBundles(context.Background(), integration, true, logr.Discard())
+	require.NoError(t, err)
+	require.Len(t, verified, 1)
+	assert.Equal(t, "InferenceService", verified[0].Kind, "integrations that fail verification are not loaded")
+
+	stored := &modelv1.Integration{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(integration), stored))
+	assert.Equal(t, []modelv1.IntegrationBundleStatus{bundle}, stored.Status.Bundles)
+	condition := meta.FindStatusCondition(stored.Status.Conditions, BundlesVerifiedConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, BundleVerificationFailedReason, condition.Reason)
+	assert.Equal(t, "Integrations whose template bundles failed verification are not loaded: model.skippy.io/v1/Agent: template bundle gcs://models/agent failed verification: the checksum of pod.yaml does not match metadata.yaml", condition.Message)
+	assert.Equal(t, int64(3), condition.ObservedGeneration)
+
+	tampered = false
+	verified, err = r.verifyBundles(context.Background(), stored, true, logr.Discard())
+	require.NoError(t, err)
+	assert.Len(t, verified, 2)
+	condition = meta.FindStatusCondition(stored.Status.Conditions, BundlesVerifiedConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, AllBundlesVerifiedReason, condition.Reason)
+
+	// Integrations without packaged bundles get no condition, and replicas
+	// that do not own the Integration do not write its status.
+	r.Transformer = &MockTransformer{}
+	plain := integration.DeepCopy()
+	plain.Status = modelv1.IntegrationStatus{}
+	verified, err = r.verifyBundles(context.Background(), plain, true, logr.Discard())
+	require.NoError(t, err)
+	assert.Len(t, verified, 2)
+	assert.Empty(t, plain.Status.Conditions)
+
+	r.Transformer = &MockTransformer{VerifyBundlesFunc: func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]modelv1.IntegrationBundleStatus, error) {
+		return nil, errors.New("failed verification")
+	}}
+	verified, err = r.verifyBundles(context.Background(), plain, false, logr.Discard())
+	require.NoError(t, err)
+	assert.Empty(t, verified)
+	assert.Empty(t, plain.Status.Conditions)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -18,14 +19,40 @@ import (
 	"github.com/go-logr/logr"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
+// EnvironmentLabel on an Integration selects the environment whose overlays
+// are applied, instead of the operator's --environment flag.
+const EnvironmentLabel = "model.skippy.io/environment"
+
 // IntegrationReconciler reconciles a Integration object
 type IntegrationReconciler struct {
 	client.Client
 	Manager     ctrl.Manager
 	Transformer modelv1.TransformerInterface
 	Scheme      *runtime.Scheme
+	// RestConfig is the client configuration (user agent, QPS, burst) used for
+	// the discovery and dynamic clients built by the generic reconcilers.
+	RestConfig *rest.Config
+	// EventPolicy controls which events the generic reconcilers record.
+	EventPolicy EventPolicy
+	// QuotaGuardrails makes the generic reconcilers check rendered dependents
+	// against the namespace ResourceQuotas before applying them.
+	QuotaGuardrails bool
+	// Preflight makes the generic reconcilers dry-run rendered dependents
+	// before applying them.
+	Preflight PreflightMode
+	// Environment selects the template overlays that are applied, e.g. "prod".
+	// The EnvironmentLabel of an Integration takes precedence.
+	Environment string
+	// DependentConcurrency is the number of dependents of a target that the
+	// generic reconcilers apply in parallel.
+	DependentConcurrency int
+	// RenderArtifacts stores the dependents that the generic reconcilers
+	// apply for each generation of a target, if set.
+	RenderArtifacts RenderArtifactStore
 
 	m            sync.Mutex
 	genericMutex sync.Mutex
@@ -33,7 +60,60 @@ type IntegrationReconciler struct {
 
 	setupGenericReconcilerFunc func(r *GenericReconciler) error
 
-	KindReconcilers map[string]KindReconciler
+	// KindReconcilers holds the stateful logic that the generic reconcilers
+	// run, usually DefaultKindReconcilers.
+	KindReconcilers *KindReconcilerRegistry
+
+	// NamespaceScoped skips integrations of cluster-scoped kinds, which the
+	// operator cannot watch when its caches and permissions are limited to
+	// the watched namespaces.
+	NamespaceScoped bool
+
+	// CheckPermissions reports the permissions that the operator lacks for
+	// the integrations in the status of each Integration.
+	CheckPermissions bool
+	// Namespaces are the namespaces that the operator watches, where the
+	// permissions are checked. Empty checks cluster-wide permissions.
+	Namespaces []string
+	// Shards selects the resources that this replica reconciles, if the
+	// operator runs sharded. Every replica starts the integrations, but only
+	// the owner of an Integration writes its status.
+	Shards ShardFilter
+	// Invalidator is passed to the reconcilers of the integrations.
+	Invalidator *Invalidator
+	// ReconcileHistory is the number of reconcile summaries kept in the
+	// status of each resource.
+	ReconcileHistory int
+	// MaxStatusDependents is the number of dependents kept in the status of
+	// each resource. Zero keeps all of them.
+	MaxStatusDependents int
+	// ReconcileExports is passed to the reconcilers of the integrations.
+	ReconcileExports *ReconcileExportQueue
+	// PriceSheet is passed to the reconcilers of the integrations.
+	PriceSheet *PriceSheet
+	// DependencyTimeout is passed to the reconcilers of the integrations.
+	DependencyTimeout time.Duration
+	// DependencyRequeueInterval is passed to the reconcilers of the
+	// integrations.
+	DependencyRequeueInterval time.Duration
+	// Shutdown is passed to the reconcilers of the integrations.
+	Shutdown *ShutdownBarrier
+	// FairQueuing is passed to the reconcilers of the integrations.
+	FairQueuing bool
+	// Priorities is passed to the reconcilers of the integrations.
+	Priorities *ReconcilePriorities
+	// Policies is passed to the reconcilers of the integrations.
+	Policies *PolicyChecker
+	// TypedApply applies the Deployments, Services and ConfigMaps of the
+	// integrations with typed server-side apply, see typedApplyKinds.
+	TypedApply bool
+	// Adoption is passed to the reconcilers of the integrations.
+	Adoption AdoptionPolicy
+	// DryRunAll makes the reconcilers of the integrations render, diff and
+	// report the status of their resources, but only dry-run the writes to
+	// the cluster, e.g. to introduce karo into a cluster whose resources
+	// already exist.
+	DryRunAll bool
 }
 
 //+kubebuilder:rbac:groups=model.skippy.io,resources=integrations,verbs=get;list;watch
@@ -58,6 +138,7 @@ func (r *IntegrationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if err := r.Get(ctx, req.NamespacedName, integration); err != nil {
 		if errors.IsNotFound(err) {
 			log.Info("Integration resource not found. Ignoring since object must be deleted.")
+			forgetTemplateBundles(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "Failed to get Integration resource.")
@@ -66,7 +147,53 @@ func (r *IntegrationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	log.Info("Successfully fetched Integration resource", "integrationName", integration.Name)
 
-	return r.processIntegrations(ctx, integration.Spec, log)
+	environment := r.Environment
+	if value := integration.Labels[EnvironmentLabel]; value != "" {
+		environment = value
+	}
+	r.Transformer.Registry().SetEnvironment(environment)
+	for i := range integration.Spec {
+		integration.Spec[i].Default()
+	}
+	defaultStorageNamespaces(integration)
+
+	var statusErr error
+	if r.CheckPermissions && ownsShard(r.Shards, req.NamespacedName) {
+		if statusErr = r.checkPermissions(ctx, integration, log); statusErr != nil {
+			log.Error(statusErr, "Failed to update the Integration status")
+		}
+	}
+
+	verified, err := r.verifyBundles(ctx, integration, ownsShard(r.Shards, req.NamespacedName), log)
+	if err != nil {
+		log.Error(err, "Failed to update the Integration status")
+		statusErr = err
+	}
+
+	r.recordTemplateBundles(ctx, integration, verified, log)
+
+	result, err := r.processIntegrations(ctx, verified, log)
+	if err != nil {
+		return result, err
+	}
+	return result, statusErr
+}
+
+// defaultStorageNamespaces sets the namespace of the GCS credential references
+// that do not name one to the namespace of the Integration.
+func defaultStorageNamespaces(integration *modelv1.Integration) {
+	for i := range integration.Spec {
+		storage := integration.Spec[i].Storage
+		if storage == nil || storage.Credentials == nil {
+			continue
+		}
+		if ref := storage.Credentials.Secret; ref != nil && ref.Namespace == "" {
+			ref.Namespace = integration.Namespace
+		}
+		if ref := storage.Credentials.ServiceAccount; ref != nil && ref.Namespace == "" {
+			ref.Namespace = integration.Namespace
+		}
+	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -88,30 +215,64 @@ func (r *IntegrationReconciler) processIntegrations(ctx context.Context, newInte
 		r.Transformer.Registry().SetIntegrations(activeIntegrationsThisCycle)
 	}()
 
-	// Add/Update loop
+	// Add/Update loop. Integrations whose required kinds are not ready are
+	// started in a later pass, once the integrations they require are, or on
+	// a later reconcile.
+	declared := map[schema.GroupVersionKind]bool{}
 	for _, newIntegrationSpec := range newIntegrations {
-		gvkString := fmt.Sprintf("%s/%s/%s", newIntegrationSpec.Group, newIntegrationSpec.Version, newIntegrationSpec.Kind)
+		declared[schema.GroupVersionKind{Group: newIntegrationSpec.Group, Version: newIntegrationSpec.Version, Kind: newIntegrationSpec.Kind}] = true
+	}
+	started := map[schema.GroupVersionKind]bool{}
+	pending := newIntegrations
+	var waiting map[string][]string
+	for len(pending) > 0 {
+		var deferred []modelv1.IntegrationSpec
+		waiting = map[string][]string{}
+		for _, newIntegrationSpec := range pending {
+			gvk := schema.GroupVersionKind{Group: newIntegrationSpec.Group, Version: newIntegrationSpec.Version, Kind: newIntegrationSpec.Kind}
+			gvkString := fmt.Sprintf("%s/%s/%s", newIntegrationSpec.Group, newIntegrationSpec.Version, newIntegrationSpec.Kind)
 
-		var foundReconciler *GenericReconciler
-		for key, existingRec := range r.reconcilers {
-			if existingRec.Gvk.Group == newIntegrationSpec.Group && existingRec.Gvk.Version == newIntegrationSpec.Version && existingRec.Gvk.Kind == newIntegrationSpec.Kind {
-				log.Info("Found existing reconciler for", "gvk", gvkString, "key", key)
-				foundReconciler = existingRec
-				break
+			if r.NamespaceScoped {
+				if err := checkNamespaceScope(r.Manager.GetRESTMapper(), newIntegrationSpec); err != nil {
+					log.Error(err, "Skipping integration", "gvk", gvkString)
+					continue
+				}
 			}
-		}
 
-		if foundReconciler != nil {
-			if err := r.processIntegrationsUpdate(ctx, foundReconciler, newIntegrationSpec, log); err != nil {
-				return ctrl.Result{}, err
+			var foundReconciler *GenericReconciler
+			for key, existingRec := range r.reconcilers {
+				if existingRec.Gvk.Group == newIntegrationSpec.Group && existingRec.Gvk.Version == newIntegrationSpec.Version && existingRec.Gvk.Kind == newIntegrationSpec.Kind {
+					log.Info("Found existing reconciler for", "gvk", gvkString, "key", key)
+					foundReconciler = existingRec
+					break
+				}
 			}
-			activeIntegrationsThisCycle = append(activeIntegrationsThisCycle, newIntegrationSpec)
-		} else {
-			if err := r.processIntegrationsAdd(ctx, newIntegrationSpec, log); err != nil {
-				return ctrl.Result{}, err
+
+			if foundReconciler != nil {
+				// A started integration keeps running, its resources wait
+				// for the required kinds instead, see checkRequirements.
+				if err := r.processIntegrationsUpdate(ctx, foundReconciler, newIntegrationSpec, log); err != nil {
+					return ctrl.Result{}, err
+				}
+			} else {
+				if len(newIntegrationSpec.Requires) > 0 {
+					if unready := unreadyRequirements(r.Manager.GetRESTMapper(), newIntegrationSpec.Requires, declared, started); len(unready) > 0 {
+						waiting[gvkString] = unready
+						deferred = append(deferred, newIntegrationSpec)
+						continue
+					}
+				}
+				if err := r.processIntegrationsAdd(ctx, newIntegrationSpec, log); err != nil {
+					return ctrl.Result{}, err
+				}
 			}
 			activeIntegrationsThisCycle = append(activeIntegrationsThisCycle, newIntegrationSpec)
+			started[gvk] = true
 		}
+		if len(deferred) == len(pending) {
+			break
+		}
+		pending = deferred
 	}
 
 	// Remove loop - Needs care
@@ -142,6 +303,12 @@ func (r *IntegrationReconciler) processIntegrations(ctx context.Context, newInte
 		delete(r.reconcilers, key)
 	}
 
+	if len(waiting) > 0 {
+		for gvkString, unready := range waiting {
+			log.Info("Waiting for required kinds before starting integration", "gvk", gvkString, "requirements", unready)
+		}
+		return ctrl.Result{RequeueAfter: RequirementsRecheckInterval}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
@@ -162,29 +329,65 @@ func (r *IntegrationReconciler) processIntegrationsAdd(ctx context.Context, inte
 
 	//Use the NewDiscoveryClient function from the transformer package
 	discoveryClientFactory := func() (discovery.DiscoveryInterface, error) {
-		cfg, err := ctrl.GetConfig()
+		cfg, err := r.restConfig()
 		if err != nil {
 			return nil, err
 		}
 		return transformer.NewDiscoveryClient(cfg)
 	}
 
+	var typedClient kubernetes.Interface
+	if r.TypedApply {
+		cfg, err := r.restConfig()
+		if err != nil {
+			return err
+		}
+		if typedClient, err = kubernetes.NewForConfig(cfg); err != nil {
+			return fmt.Errorf("unable to create typed client: %w", err)
+		}
+	}
+
+	gvk := schema.GroupVersionKind{
+		Group:   integration.Group,
+		Version: integration.Version,
+		Kind:    integration.Kind,
+	}
+	reconcilerClient := r.Manager.GetClient()
+	if r.DryRunAll {
+		reconcilerClient = newDryRunClient(reconcilerClient)
+	}
 	reconciler := &GenericReconciler{
-		Mutex:  &r.genericMutex,
-		Client: r.Manager.GetClient(),
-		Scheme: r.Manager.GetScheme(),
-		Gvk: schema.GroupVersionKind{
-			Group:   integration.Group,
-			Version: integration.Version,
-			Kind:    integration.Kind,
-		},
-		Transformer: r.Transformer,
-		Recorder:    r.Manager.GetEventRecorderFor(recorderName), // Assign the recorder
+		Mutex:                &r.genericMutex,
+		Client:               reconcilerClient,
+		Scheme:               r.Manager.GetScheme(),
+		Gvk:                  gvk,
+		Transformer:          r.Transformer,
+		RestConfig:           r.RestConfig,
+		EventPolicy:          r.EventPolicy,
+		QuotaGuardrails:      r.QuotaGuardrails,
+		Preflight:            r.Preflight,
+		DependentConcurrency: r.DependentConcurrency,
+		RenderArtifacts:      r.RenderArtifacts,
+		Recorder:             r.Manager.GetEventRecorderFor(recorderName), // Assign the recorder
 		resourceClientFactory: func(dynClient dynamic.Interface) modelv1.ResourceClientInterface {
-			return &ResourceClient{dynClient: dynClient}
+			return &ResourceClient{dynClient: dynClient, fieldManager: FieldManager(gvk), typedClient: typedClient, dryRun: r.DryRunAll}
 		},
-		discoveryClientFactory: discoveryClientFactory,
-		KindReconcilers:        r.KindReconcilers,
+		discoveryClientFactory:    discoveryClientFactory,
+		KindReconcilers:           r.KindReconcilers,
+		Shards:                    r.Shards,
+		Invalidator:               r.Invalidator,
+		ReconcileHistory:          r.ReconcileHistory,
+		MaxStatusDependents:       r.MaxStatusDependents,
+		ReconcileExports:          r.ReconcileExports,
+		PriceSheet:                r.PriceSheet,
+		DependencyTimeout:         r.DependencyTimeout,
+		DependencyRequeueInterval: r.DependencyRequeueInterval,
+		Shutdown:                  r.Shutdown,
+		FairQueuing:               r.FairQueuing,
+		Priorities:                r.Priorities,
+		Policies:                  r.Policies,
+		DryRunAll:                 r.DryRunAll,
+		Adoption:                  r.Adoption,
 	}
 
 	setupFunc := r.setupGenericReconcilerFunc
@@ -219,3 +422,12 @@ func (r *IntegrationReconciler) processIntegrationsRemove(ctx context.Context, r
 	log.Info("Removed controller", "controller", controller)
 	return nil
 }
+
+// restConfig returns the configured client configuration, falling back to the
+// default one when none was provided.
+func (r *IntegrationReconciler) restConfig() (*rest.Config, error) {
+	if r.RestConfig != nil {
+		return rest.CopyConfig(r.RestConfig), nil
+	}
+	return ctrl.GetConfig()
+}
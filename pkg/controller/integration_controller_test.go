@@ -36,6 +36,7 @@ import (
 type MockManager struct {
 	client client.Client
 	scheme *runtime.Scheme
+	mapper meta.RESTMapper
 }
 
 func (m *MockManager) GetClient() client.Client   { return m.client }
@@ -55,7 +56,7 @@ func (m *MockManager) Start(ctx context.Context) error
 func (m *MockManager) SetFields(interface{}) error                              { return nil }
 func (m *MockManager) GetLogger() logr.Logger                                   { return logr.Discard() }
 func (m *MockManager) Elected() <-chan struct{}                                 { return nil }
-func (m *MockManager) GetRESTMapper() meta.RESTMapper                           { return nil }
+func (m *MockManager) GetRESTMapper() meta.RESTMapper                           { return m.mapper }
 func (m *MockManager) AddHealthzCheck(name string, check healthz.Checker) error { return nil }
 func (m *MockManager) AddReadyzCheck(name string, check healthz.Checker) error  { return nil }
 
@@ -161,6 +162,72 @@ var _ = Describe("IntegrationReconciler", func() {
 			Expect(capturedSpecs).To(ConsistOf(integrationSpecs))
 		})
 
+		It("should skip integrations of cluster-scoped kinds when namespace-scoped", func() {
+			sandboxClassGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandboxClass"}
+			mockManager.mapper = newScopeMapper()
+			reconciler.NamespaceScoped = true
+			integrationCR := &modelv1.Integration{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-integration", Namespace: "default"},
+				Spec: []modelv1.IntegrationSpec{
+					{Group: modelDataGVK.Group, Version: modelDataGVK.Version, Kind: modelDataGVK.Kind},
+					{Group: sandboxClassGVK.Group, Version: sandboxClassGVK.Version, Kind: sandboxClassGVK.Kind},
+				},
+			}
+			Expect(fakeK8sClient.Create(ctx, integrationCR)).To(Succeed())
+			var capturedSpecs []modelv1.IntegrationSpec
+			mockRegistry.SetIntegrationsFunc = func(integrations []modelv1.IntegrationSpec) {
+				capturedSpecs = integrations
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-integration", Namespace: "default"}}
+			_, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setupCalls).To(HaveLen(1))
+			Expect(setupCalls).To(HaveKey(gvkToString(modelDataGVK)))
+			Expect(capturedSpecs).To(HaveLen(1))
+			Expect(capturedSpecs[0].Kind).To(Equal("ModelData"))
+		})
+
+		It("should start integrations after the integrations they require, and wait for kinds that are not served", func() {
+			agentGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}
+			mockManager.mapper = newScopeMapper()
+			var order []string
+			reconciler.setupGenericReconcilerFunc = func(gr *GenericReconciler) error {
+				order = append(order, gr.Gvk.Kind)
+				setupCalls[gvkToString(gr.Gvk)]++
+				return nil
+			}
+			integrationCR := &modelv1.Integration{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-integration", Namespace: "default"},
+				Spec: []modelv1.IntegrationSpec{
+					{
+						Group: agentGVK.Group, Version: agentGVK.Version, Kind: agentGVK.Kind,
+						Requires: []modelv1.IntegrationRequirementSpec{{Group: modelDataGVK.Group, Version: modelDataGVK.Version, Kind: modelDataGVK.Kind}},
+					},
+					{Group: modelDataGVK.Group, Version: modelDataGVK.Version, Kind: modelDataGVK.Kind},
+					{
+						Group: endpointGVK.Group, Version: endpointGVK.Version, Kind: endpointGVK.Kind,
+						Requires: []modelv1.IntegrationRequirementSpec{{Group: "example.com", Version: "v1", Kind: "NotInstalled"}},
+					},
+				},
+			}
+			Expect(fakeK8sClient.Create(ctx, integrationCR)).To(Succeed())
+			var capturedSpecs []modelv1.IntegrationSpec
+			mockRegistry.SetIntegrationsFunc = func(integrations []modelv1.IntegrationSpec) {
+				capturedSpecs = integrations
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-integration", Namespace: "default"}}
+			result, err := reconciler.Reconcile(ctx, req)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(RequirementsRecheckInterval))
+			Expect(order).To(Equal([]string{"ModelData", "Agent"}))
+			Expect(setupCalls).NotTo(HaveKey(gvkToString(endpointGVK)))
+			Expect(capturedSpecs).To(HaveLen(2))
+		})
+
 		It("should remove an obsolete reconciler when an Integration CR is updated", func() {
 			// ARRANGE
 			// Pre-populate the reconciler state to simulate that ModelData was previously managed
@@ -192,6 +259,61 @@ var _ = Describe("IntegrationReconciler", func() {
 			Expect(reconciler.reconcilers).To(HaveKey(gvkToString(deploymentGVK)))   // Should be added
 		})
 
+		It("should select the environment from the Integration label over the flag", func() {
+			reconciler.Environment = "dev"
+			var environments []string
+			mockRegistry.SetEnvironmentFunc = func(environment string) {
+				environments = append(environments, environment)
+			}
+
+			integrationCR := &modelv1.Integration{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-integration", Namespace: "default"},
+			}
+			Expect(fakeK8sClient.Create(ctx, integrationCR)).To(Succeed())
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-integration", Namespace: "default"}}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			integrationCR.Labels = map[string]string{EnvironmentLabel: "prod"}
+			Expect(fakeK8sClient.Update(ctx, integrationCR)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environments).To(Equal([]string{"dev", "prod"}))
+		})
+
+		It("should default the namespace of GCS credential references to the Integration namespace", func() {
+			var registered []modelv1.IntegrationSpec
+			mockRegistry.SetIntegrationsFunc = func(integrations []modelv1.IntegrationSpec) {
+				registered = integrations
+			}
+
+			integrationCR := &modelv1.Integration{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-integration", Namespace: "ml"},
+				Spec: []modelv1.IntegrationSpec{{
+					Group: modelDataGVK.Group, Version: modelDataGVK.Version, Kind: modelDataGVK.Kind,
+					Storage: &modelv1.IntegrationStorageSpec{Credentials: &modelv1.IntegrationStorageCredentialsSpec{
+						Source: "Secret",
+						Secret: &modelv1.IntegrationSecretKeyReference{Name: "gcs-key"},
+					}},
+				}, {
+					Group: endpointGVK.Group, Version: endpointGVK.Version, Kind: endpointGVK.Kind,
+					Storage: &modelv1.IntegrationStorageSpec{Credentials: &modelv1.IntegrationStorageCredentialsSpec{
+						Source:         "WorkloadIdentity",
+						ServiceAccount: &modelv1.IntegrationObjectReference{Name: "reader", Namespace: "shared"},
+					}},
+				}},
+			}
+			Expect(fakeK8sClient.Create(ctx, integrationCR)).To(Succeed())
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-integration", Namespace: "ml"}}
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(registered).To(HaveLen(2))
+			Expect(registered[0].Storage.Credentials.Secret.Namespace).To(Equal("ml"))
+			Expect(registered[1].Storage.Credentials.ServiceAccount.Namespace).To(Equal("shared"))
+		})
+
 		It("should remove all reconcilers when the Integration CR spec is empty", func() {
 			// ARRANGE
 			// Pre-populate the reconciler state
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/rbac"
+)
+
+const (
+	PermissionsGrantedConditionType = "PermissionsGranted"
+	AllPermissionsGrantedReason     = "AllPermissionsGranted"
+	MissingPermissionsReason        = "MissingPermissions"
+	PermissionCheckFailedReason     = "PermissionCheckFailed"
+
+	// maxDescribedPermissions is the number of missing permissions named in
+	// the message of the PermissionsGranted condition. All of them are listed
+	// in status.missingPermissions.
+	maxDescribedPermissions = 5
+)
+
+// missingPermissions returns the permissions that the integrations need, for
+// their resources, their references and the kinds that their templates
+// render, but that the operator lacks in the watched namespaces.
+func (r *IntegrationReconciler) missingPermissions(ctx context.Context, specs []modelv1.IntegrationSpec) ([]modelv1.IntegrationPermission, error) {
+	var dependents []schema.GroupVersionKind
+	for _, spec := range specs {
+		kinds, err := r.Transformer.IntegrationKinds(ctx, r.Client, spec)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the kinds rendered by integration %s/%s/%s: %w", spec.Group, spec.Version, spec.Kind, err)
+		}
+		dependents = append(dependents, kinds...)
+	}
+	namespaces := r.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	return rbac.Check(ctx, r.Client, rbac.ForIntegrations(r.Client.RESTMapper(), specs, dependents), namespaces)
+}
+
+// checkPermissions reports the permissions that the operator lacks for the
+// integrations in the status of the Integration, before the generic
+// reconcilers are set up, so that they show up in one place instead of as
+// Forbidden errors of each reconcile. The status is only written when it
+// changes.
+func (r *IntegrationReconciler) checkPermissions(ctx context.Context, integration *modelv1.Integration, log logr.Logger) error {
+	status := integration.Status.DeepCopy()
+	condition := metav1.Condition{
+		Type:               PermissionsGrantedConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             AllPermissionsGrantedReason,
+		Message:            "The operator has all the permissions that the integrations need.",
+		ObservedGeneration: integration.Generation,
+	}
+	missing, err := r.missingPermissions(ctx, integration.Spec)
+	switch {
+	case err != nil:
+		// Keep the permissions found missing by the last successful check.
+		log.Error(err, "Failed to check the permissions of the integrations")
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = PermissionCheckFailedReason
+		condition.Message = err.Error()
+	case len(missing) > 0:
+		log.Info("The operator lacks permissions that the integrations need", "missing", len(missing))
+		status.MissingPermissions = missing
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = MissingPermissionsReason
+		condition.Message = describeMissingPermissions(missing)
+	default:
+		status.MissingPermissions = nil
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	if equality.Semantic.DeepEqual(status, &integration.Status) {
+		return nil
+	}
+	integration.Status = *status
+	return r.Status().Update(ctx, integration)
+}
+
+// describeMissingPermissions returns the message of a PermissionsGranted
+// condition that is False.
+func describeMissingPermissions(missing []modelv1.IntegrationPermission) string {
+	described := make([]string, 0, maxDescribedPermissions)
+	for i, permission := range missing {
+		if i == maxDescribedPermissions {
+			described = append(described, fmt.Sprintf("and %d more", len(missing)-i))
+			break
+		}
+		described = append(described, rbac.Describe(permission))
+	}
+	return fmt.Sprintf("The operator lacks %d permission(s) that the integrations need, reconciles that need them fail with Forbidden errors: %s. See status.missingPermissions.", len(missing), strings.Join(described, "; "))
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// newPermissionsReconciler returns a reconciler whose integrations render
+// Deployments, and whose client denies the verbs in denied on every resource.
+func newPermissionsReconciler(t *testing.T, integration *modelv1.Integration, denied ...string) (*IntegrationReconciler, *int) {
+	s := runtime.NewScheme()
+	require.NoError(t, modelv1.AddToScheme(s))
+	reviews := 0
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(integration).WithStatusSubresource(integration).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+			if !ok {
+				return c.Create(ctx, obj, opts...)
+			}
+			reviews++
+			review.Status.Allowed = true
+			for _, verb := range denied {
+				if review.Spec.ResourceAttributes.Verb == verb {
+					review.Status.Allowed = false
+				}
+			}
+			return nil
+		},
+	}).Build()
+	return &IntegrationReconciler{
+		Client: c,
+		Transformer: &MockTransformer{
+			IntegrationKindsFunc: func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]schema.GroupVersionKind, error) {
+				return []schema.GroupVersionKind{{Group: "apps", Version: "v1", Kind: "Deployment"}}, nil
+			},
+		},
+		CheckPermissions: true,
+		Namespaces:       []string{"team-a"},
+	}, &reviews
+}
+
+func newPermissionsIntegration() *modelv1.Integration {
+	return &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "integrations", Namespace: "team-a", Generation: 2},
+		Spec:       []modelv1.IntegrationSpec{{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}},
+	}
+}
+
+func TestCheckPermissionsReportsMissing(t *testing.T) {
+	integration := newPermissionsIntegration()
+	r, _ := newPermissionsReconciler(t, integration, "delete")
+
+	require.NoError(t, r.checkPermissions(context.Background(), integration, logr.Discard()))
+
+	stored := &modelv1.Integration{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(integration), stored))
+	assert.Equal(t, []modelv1.IntegrationPermission{
+		{Group: "apps", Resource: "deployments", Namespace: "team-a", Verbs: []string{"delete"}},
+	}, stored.Status.MissingPermissions)
+	condition := meta.FindStatusCondition(stored.Status.Conditions, PermissionsGrantedConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, MissingPermissionsReason, condition.Reason)
+	assert.Equal(t, int64(2), condition.ObservedGeneration)
+	assert.Contains(t, condition.Message, "delete deployments.apps in team-a")
+}
+
+func TestCheckPermissionsClearsMissing(t *testing.T) {
+	integration := newPermissionsIntegration()
+	integration.Status.MissingPermissions = []modelv1.IntegrationPermission{{Group: "apps", Resource: "deployments", Namespace: "team-a", Verbs: []string{"delete"}}}
+	r, _ := newPermissionsReconciler(t, integration)
+
+	require.NoError(t, r.checkPermissions(context.Background(), integration, logr.Discard()))
+
+	stored := &modelv1.Integration{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(integration), stored))
+	assert.Empty(t, stored.Status.MissingPermissions)
+	assert.True(t, meta.IsStatusConditionTrue(stored.Status.Conditions, PermissionsGrantedConditionType))
+}
+
+func TestCheckPermissionsKeepsMissingWhenCheckFails(t *testing.T) {
+	integration := newPermissionsIntegration()
+	missing := []modelv1.IntegrationPermission{{Group: "apps", Resource: "deployments", Namespace: "team-a", Verbs: []string{"delete"}}}
+	integration.Status.MissingPermissions = missing
+	r, reviews := newPermissionsReconciler(t, integration)
+	r.Transformer = &MockTransformer{
+		IntegrationKindsFunc: func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]schema.GroupVersionKind, error) {
+			return nil, errors.New("bucket not found")
+		},
+	}
+
+	require.NoError(t, r.checkPermissions(context.Background(), integration, logr.Discard()))
+
+	stored := &modelv1.Integration{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(integration), stored))
+	assert.Equal(t, missing, stored.Status.MissingPermissions)
+	condition := meta.FindStatusCondition(stored.Status.Conditions, PermissionsGrantedConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionUnknown, condition.Status)
+	assert.Equal(t, PermissionCheckFailedReason, condition.Reason)
+	assert.Contains(t, condition.Message, "bucket not found")
+	assert.Zero(t, *reviews)
+}
+
+func TestCheckPermissionsSkipsUnchangedStatus(t *testing.T) {
+	integration := newPermissionsIntegration()
+	r, _ := newPermissionsReconciler(t, integration)
+	require.NoError(t, r.checkPermissions(context.Background(), integration, logr.Discard()))
+	version := integration.ResourceVersion
+
+	require.NoError(t, r.checkPermissions(context.Background(), integration, logr.Discard()))
+	assert.Equal(t, version, integration.ResourceVersion)
+}
+
+func TestDescribeMissingPermissions(t *testing.T) {
+	var missing []modelv1.IntegrationPermission
+	for i := 0; i < maxDescribedPermissions+2; i++ {
+		missing = append(missing, modelv1.IntegrationPermission{Resource: fmt.Sprintf("resource%d", i), Namespace: "team-a", Verbs: []string{"get"}})
+	}
+	message := describeMissingPermissions(missing)
+	assert.Contains(t, message, "lacks 7 permission(s)")
+	assert.Contains(t, message, "get resource4 in team-a; and 2 more")
+	assert.NotContains(t, message, "resource5")
+}
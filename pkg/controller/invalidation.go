@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// InvalidationPath is where the webhook server accepts invalidation notices.
+// Callers need the create verb on it, e.g. a ClusterRole with the rule
+// {nonResourceURLs: ["/invalidate"], verbs: ["create"]}.
+const InvalidationPath = "/invalidate"
+
+// maxInvalidationNoticeBytes bounds the body of an invalidation notice.
+const maxInvalidationNoticeBytes = 64 << 10
+
+// InvalidationNotice reports that external data in the context of custom
+// resources changed, e.g. a recommendation or a model registry entry. An
+// empty name invalidates every resource of the kind in the namespace, and
+// an empty namespace every resource of the kind.
+type InvalidationNotice struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// InvalidationResponse is the reply to an accepted invalidation notice.
+type InvalidationResponse struct {
+	// Requeued is the number of resources queued for reconciliation.
+	Requeued int `json:"requeued"`
+}
+
+// UnknownKindError is returned for invalidation notices of a kind that has no
+// running integration.
+type UnknownKindError struct {
+	Gvk schema.GroupVersionKind
+}
+
+func (e *UnknownKindError) Error() string {
+	return fmt.Sprintf("no integration is running for %s", e.Gvk.String())
+}
+
+// Invalidator queues custom resources for reconciliation when external
+// systems report that their context changed, instead of leaving them to the
+// periodic requeue. It serves InvalidationPath, and authenticates callers
+// with TokenReviews and authorizes them with SubjectAccessReviews.
+type Invalidator struct {
+	Client client.Client
+
+	mu     sync.RWMutex
+	queues map[schema.GroupVersionKind]workqueue.TypedRateLimitingInterface[reconcile.Request]
+	// invalidated holds the resources that were queued by a notice, which
+	// are rendered by their next reconcile even if their render inputs are
+	// unchanged, see takeInvalidated.
+	invalidated map[schema.GroupVersionKind]map[types.NamespacedName]bool
+}
+
+// source registers the queue of the controller of gvk for invalidations.
+func (i *Invalidator) source(gvk schema.GroupVersionKind) source.Source {
+	return source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		i.mu.Lock()
+		if i.queues == nil {
+			i.queues = map[schema.GroupVersionKind]workqueue.TypedRateLimitingInterface[reconcile.Request]{}
+		}
+		i.queues[gvk] = queue
+		i.mu.Unlock()
+		go func() {
+			<-ctx.Done()
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			if i.queues[gvk] == queue {
+				delete(i.queues, gvk)
+			}
+		}()
+		return nil
+	})
+}
+
+// Invalidate queues the resources named by notice for reconciliation, and
+// returns how many were queued.
+func (i *Invalidator) Invalidate(ctx context.Context, notice InvalidationNotice) (int, error) {
+	gvk := schema.GroupVersionKind{Group: notice.Group, Version: notice.Version, Kind: notice.Kind}
+	i.mu.RLock()
+	queue, ok := i.queues[gvk]
+	i.mu.RUnlock()
+	if !ok {
+		return 0, &UnknownKindError{Gvk: gvk}
+	}
+
+	if notice.Name != "" {
+		key := types.NamespacedName{Namespace: notice.Namespace, Name: notice.Name}
+		i.markInvalidated(gvk, key)
+		queue.Add(reconcile.Request{NamespacedName: key})
+		return 1, nil
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	var opts []client.ListOption
+	if notice.Namespace != "" {
+		opts = append(opts, client.InNamespace(notice.Namespace))
+	}
+	if err := i.Client.List(ctx, list, opts...); err != nil {
+		return 0, fmt.Errorf("unable to list %s: %w", gvk.String(), err)
+	}
+	for _, item := range list.Items {
+		key := client.ObjectKeyFromObject(&item)
+		i.markInvalidated(gvk, key)
+		queue.Add(reconcile.Request{NamespacedName: key})
+	}
+	return len(list.Items), nil
+}
+
+func (i *Invalidator) markInvalidated(gvk schema.GroupVersionKind, key types.NamespacedName) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.invalidated == nil {
+		i.invalidated = map[schema.GroupVersionKind]map[types.NamespacedName]bool{}
+	}
+	if i.invalidated[gvk] == nil {
+		i.invalidated[gvk] = map[types.NamespacedName]bool{}
+	}
+	i.invalidated[gvk][key] = true
+}
+
+// takeInvalidated reports whether a notice invalidated the resource since it
+// was last asked, and forgets the notice. The input hash of a resource does
+// not cover its external context, so an invalidated resource is rendered
+// again. A nil Invalidator never invalidates.
+func (i *Invalidator) takeInvalidated(gvk schema.GroupVersionKind, key types.NamespacedName) bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.invalidated[gvk][key] {
+		return false
+	}
+	delete(i.invalidated[gvk], key)
+	return true
+}
+
+// ServeHTTP accepts an InvalidationNotice posted as JSON.
+func (i *Invalidator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := log.FromContext(req.Context()).WithName("invalidation")
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := i.authorize(req)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			logger.Error(err, "Failed to authorize invalidation notice")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	notice := InvalidationNotice{}
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxInvalidationNoticeBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&notice); err != nil {
+		http.Error(w, fmt.Sprintf("invalid invalidation notice: %v", err), http.StatusBadRequest)
+		return
+	}
+	if notice.Version == "" || notice.Kind == "" {
+		http.Error(w, "invalid invalidation notice: version and kind are required", http.StatusBadRequest)
+		return
+	}
+
+	requeued, err := i.Invalidate(req.Context(), notice)
+	var unknownErr *UnknownKindError
+	if stderrors.As(err, &unknownErr) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error(err, "Failed to invalidate resources", "notice", notice)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.V(1).Info("Invalidated resources", "notice", notice, "requeued", requeued)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(InvalidationResponse{Requeued: requeued})
+}
+
+// authorize checks that the bearer token of req belongs to a user who may
+// create InvalidationPath, and returns the HTTP status to reply with if not.
+func (i *Invalidator) authorize(req *http.Request) (int, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return http.StatusUnauthorized, fmt.Errorf("a bearer token is required")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := i.Client.Create(req.Context(), review); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+	}
+
+	user := review.Status.User
+	access := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: InvalidationPath,
+				Verb: "create",
+			},
+		},
+	}
+	if len(user.Extra) > 0 {
+		access.Spec.Extra = map[string]authorizationv1.ExtraValue{}
+		for key, value := range user.Extra {
+			access.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+		}
+	}
+	if err := i.Client.Create(req.Context(), access); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to review access: %w", err)
+	}
+	if !access.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("%s may not create %s", user.Username, InvalidationPath)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTestInvalidator returns an Invalidator registered for eventTestGVK,
+// whose client authenticates the token "valid" as "recommender", and allows
+// the users in allowed.
+func newTestInvalidator(t *testing.T, allowed ...string) (*Invalidator, workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(eventTestGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(eventTestGVK.GroupVersion().WithKind(eventTestGVK.Kind+"List"), &unstructured.UnstructuredList{})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTestResource("llama", "team-a", eventTestGVK),
+		newTestResource("gemma", "team-a", eventTestGVK),
+		newTestResource("mistral", "team-b", eventTestGVK),
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			switch review := obj.(type) {
+			case *authenticationv1.TokenReview:
+				if review.Spec.Token == "valid" {
+					review.Status.Authenticated = true
+					review.Status.User = authenticationv1.UserInfo{Username: "recommender"}
+				}
+				return nil
+			case *authorizationv1.SubjectAccessReview:
+				for _, user := range allowed {
+					attributes := review.Spec.NonResourceAttributes
+					if review.Spec.User == user && attributes.Path == InvalidationPath && attributes.Verb == "create" {
+						review.Status.Allowed = true
+					}
+				}
+				return nil
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+
+	i := &Invalidator{Client: c}
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		queue.ShutDown()
+	})
+	require.NoError(t, i.source(eventTestGVK).Start(ctx, queue))
+	return i, queue
+}
+
+func queuedNames(queue workqueue.TypedRateLimitingInterface[reconcile.Request]) []types.NamespacedName {
+	var names []types.NamespacedName
+	for queue.Len() > 0 {
+		item, _ := queue.Get()
+		names = append(names, item.NamespacedName)
+		queue.Done(item)
+	}
+	return names
+}
+
+func TestInvalidate(t *testing.T) {
+	notice := InvalidationNotice{Group: eventTestGVK.Group, Version: eventTestGVK.Version, Kind: eventTestGVK.Kind}
+
+	t.Run("by name", func(t *testing.T) {
+		i, queue := newTestInvalidator(t)
+		named := notice
+		named.Namespace, named.Name = "team-a", "llama"
+		requeued, err := i.Invalidate(context.Background(), named)
+		require.NoError(t, err)
+		assert.Equal(t, 1, requeued)
+		assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "llama"}}, queuedNames(queue))
+
+		// The next reconcile renders the resource even if its inputs are unchanged.
+		key := types.NamespacedName{Namespace: "team-a", Name: "llama"}
+		assert.True(t, i.takeInvalidated(eventTestGVK, key))
+		assert.False(t, i.takeInvalidated(eventTestGVK, key), "the notice is taken once")
+		assert.False(t, (*Invalidator)(nil).takeInvalidated(eventTestGVK, key))
+	})
+
+	t.Run("by namespace", func(t *testing.T) {
+		i, queue := newTestInvalidator(t)
+		namespaced := notice
+		namespaced.Namespace = "team-a"
+		requeued, err := i.Invalidate(context.Background(), namespaced)
+		require.NoError(t, err)
+		assert.Equal(t, 2, requeued)
+		assert.ElementsMatch(t, []types.NamespacedName{{Namespace: "team-a", Name: "llama"}, {Namespace: "team-a", Name: "gemma"}}, queuedNames(queue))
+		assert.True(t, i.takeInvalidated(eventTestGVK, types.NamespacedName{Namespace: "team-a", Name: "gemma"}))
+	})
+
+	t.Run("every resource of the kind", func(t *testing.T) {
+		i, queue := newTestInvalidator(t)
+		requeued, err := i.Invalidate(context.Background(), notice)
+		require.NoError(t, err)
+		assert.Equal(t, 3, requeued)
+		assert.Len(t, queuedNames(queue), 3)
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		i, _ := newTestInvalidator(t)
+		_, err := i.Invalidate(context.Background(), InvalidationNotice{Version: "v1", Kind: "ConfigMap", Name: "config"})
+		var unknownErr *UnknownKindError
+		require.True(t, stderrors.As(err, &unknownErr))
+		assert.Equal(t, "ConfigMap", unknownErr.Gvk.Kind)
+	})
+}
+
+func TestInvalidatorServeHTTP(t *testing.T) {
+	validNotice := `{"group":"testing.karo.pkg.com","version":"v1","kind":"TestResource","namespace":"team-a","name":"llama"}`
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		allowed    []string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "wrong method", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no token", method: http.MethodPost, body: validNotice, wantStatus: http.StatusUnauthorized, wantBody: "a bearer token is required"},
+		{name: "invalid token", method: http.MethodPost, token: "stolen", body: validNotice, wantStatus: http.StatusUnauthorized, wantBody: "invalid bearer token"},
+		{name: "not allowed", method: http.MethodPost, token: "valid", body: validNotice, wantStatus: http.StatusForbidden, wantBody: "recommender may not create /invalidate"},
+		{name: "invalid body", method: http.MethodPost, token: "valid", allowed: []string{"recommender"}, body: `{"kind":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, token: "valid", allowed: []string{"recommender"}, body: `{"version":"v1","kind":"TestResource","resource":"x"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing kind", method: http.MethodPost, token: "valid", allowed: []string{"recommender"}, body: `{"version":"v1"}`, wantStatus: http.StatusBadRequest, wantBody: "version and kind are required"},
+		{name: "unknown kind", method: http.MethodPost, token: "valid", allowed: []string{"recommender"}, body: `{"version":"v1","kind":"ConfigMap"}`, wantStatus: http.StatusNotFound, wantBody: "no integration is running for /v1, Kind=ConfigMap"},
+		{name: "accepted", method: http.MethodPost, token: "valid", allowed: []string{"recommender"}, body: validNotice, wantStatus: http.StatusAccepted, wantBody: `{"requeued":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, queue := newTestInvalidator(t, tt.allowed...)
+			req := httptest.NewRequest(tt.method, InvalidationPath, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			i.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantStatus == http.StatusAccepted {
+				response := InvalidationResponse{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "llama"}}, queuedNames(queue))
+			} else {
+				assert.Zero(t, queue.Len())
+			}
+		})
+	}
+}
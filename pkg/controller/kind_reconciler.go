@@ -1,15 +1,178 @@
 package controller
 
 import (
-	"context"
+	"fmt"
+	"sort"
+	"sync"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 )
 
 // KindReconciler defines the interface for kind-specific reconciliation logic.
-type KindReconciler interface {
-	// ReconcileStateful is responsible for managing the lifecycle and status
-	// of a resource that has a state machine (like a Job).
-	ReconcileStateful(ctx context.Context, r *GenericReconciler, obj *unstructured.Unstructured) (ctrl.Result, error)
+type KindReconciler = modelv1.KindReconcilerInterface
+
+var _ modelv1.KindReconcilerHost = (*GenericReconciler)(nil)
+
+// GetClient returns the client of the reconciler.
+func (r *GenericReconciler) GetClient() client.Client {
+	return r.Client
+}
+
+// GetScheme returns the scheme of the reconciler.
+func (r *GenericReconciler) GetScheme() *runtime.Scheme {
+	return r.Scheme
+}
+
+// Eventf records an event if the reconciler has a recorder and events are
+// enabled.
+func (r *GenericReconciler) Eventf(obj runtime.Object, eventType string, reason modelv1.EventReason, messageFmt string, args ...interface{}) {
+	r.eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// DryRun reports whether the reconciler only dry-runs its writes, see
+// DryRunAll.
+func (r *GenericReconciler) DryRun() bool {
+	return r.DryRunAll
+}
+
+// KindReconcilerRegistration registers the stateful logic of a kind.
+type KindReconcilerRegistration struct {
+	// Name identifies the registration in logs and errors. Defaults to Kind.
+	Name string
+	// Group restricts the registration to the kind in one API group. If
+	// empty, the kind matches in every group.
+	Group string
+	Kind  string
+	// Priority decides between the registrations that match a target: only
+	// the one with the highest priority runs, and at equal priority one with
+	// a Group wins over one without. Built-in registrations have priority 0,
+	// so a downstream build replaces one by registering the same kind with a
+	// higher priority.
+	Priority   int
+	Reconciler KindReconciler
+}
+
+// matches reports whether the registration applies to targets of gvk.
+func (reg KindReconcilerRegistration) matches(gvk schema.GroupVersionKind) bool {
+	return reg.Kind == gvk.Kind && (reg.Group == "" || reg.Group == gvk.Group)
+}
+
+// KindReconcilerRegistry holds the stateful logic run by the generic
+// reconcilers. A nil registry has no registrations.
+type KindReconcilerRegistry struct {
+	mu            sync.RWMutex
+	registrations []KindReconcilerRegistration
+}
+
+// NewKindReconcilerRegistry returns a registry holding registrations.
+func NewKindReconcilerRegistry(registrations ...KindReconcilerRegistration) (*KindReconcilerRegistry, error) {
+	registry := &KindReconcilerRegistry{}
+	for _, reg := range registrations {
+		if err := registry.Register(reg); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register adds reg. Registering a kind twice in the same group with the
+// same priority is an error, since neither registration would win.
+func (r *KindReconcilerRegistry) Register(reg KindReconcilerRegistration) error {
+	if reg.Name == "" {
+		reg.Name = reg.Kind
+	}
+	if reg.Kind == "" {
+		return fmt.Errorf("kind reconciler %q has no kind", reg.Name)
+	}
+	if reg.Reconciler == nil {
+		return fmt.Errorf("kind reconciler %q has no reconciler", reg.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.registrations {
+		if existing.Kind == reg.Kind && existing.Group == reg.Group && existing.Priority == reg.Priority {
+			return fmt.Errorf("kind reconcilers %q and %q are both registered for kind %q in group %q with priority %d", existing.Name, reg.Name, reg.Kind, reg.Group, reg.Priority)
+		}
+	}
+	r.registrations = append(r.registrations, reg)
+	return nil
+}
+
+// Lookup returns the registration that runs for targets of gvk.
+func (r *KindReconcilerRegistry) Lookup(gvk schema.GroupVersionKind) (KindReconcilerRegistration, bool) {
+	if r == nil {
+		return KindReconcilerRegistration{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found KindReconcilerRegistration
+	ok := false
+	for _, reg := range r.registrations {
+		if !reg.matches(gvk) {
+			continue
+		}
+		if !ok || reg.Priority > found.Priority || (reg.Priority == found.Priority && found.Group == "") {
+			found, ok = reg, true
+		}
+	}
+	return found, ok
+}
+
+// Registrations returns the registrations, ordered by kind, group and
+// descending priority.
+func (r *KindReconcilerRegistry) Registrations() []KindReconcilerRegistration {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	registrations := append([]KindReconcilerRegistration(nil), r.registrations...)
+	r.mu.RUnlock()
+	sort.SliceStable(registrations, func(i, j int) bool {
+		a, b := registrations[i], registrations[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Priority > b.Priority
+	})
+	return registrations
+}
+
+// DefaultKindReconcilers holds the built-in stateful logic and the logic that
+// downstream builds register with RegisterKindReconciler.
+var DefaultKindReconcilers = mustKindReconcilerRegistry(
+	KindReconcilerRegistration{Group: "model.skippy.io", Kind: "ModelData", Reconciler: &ModelDataReconciler{}},
+	KindReconcilerRegistration{Group: "model.skippy.io", Kind: "AgenticSandbox", Reconciler: &AgenticSandboxReconciler{}},
+)
+
+// RegisterKindReconciler adds reg to DefaultKindReconcilers. Downstream builds
+// call it from an init function to compile in the stateful logic of their own
+// kinds, e.g.
+//
+//	func init() {
+//		if err := controller.RegisterKindReconciler(controller.KindReconcilerRegistration{
+//			Group:      "tuning.example.com",
+//			Kind:       "FineTuneJob",
+//			Reconciler: &FineTuneJobReconciler{},
+//		}); err != nil {
+//			panic(err)
+//		}
+//	}
+func RegisterKindReconciler(reg KindReconcilerRegistration) error {
+	return DefaultKindReconcilers.Register(reg)
+}
+
+func mustKindReconcilerRegistry(registrations ...KindReconcilerRegistration) *KindReconcilerRegistry {
+	registry, err := NewKindReconcilerRegistry(registrations...)
+	if err != nil {
+		panic(err)
+	}
+	return registry
 }
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// namedKindReconciler is a KindReconciler that does nothing.
+type namedKindReconciler struct {
+	name string
+}
+
+func (n *namedKindReconciler) ReconcileStateful(ctx context.Context, host modelv1.KindReconcilerHost, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
+
+func TestKindReconcilerRegistryLookup(t *testing.T) {
+	anyGroup := &namedKindReconciler{name: "any-group"}
+	skippy := &namedKindReconciler{name: "skippy"}
+	override := &namedKindReconciler{name: "override"}
+	registry, err := NewKindReconcilerRegistry(
+		KindReconcilerRegistration{Kind: "FineTuneJob", Reconciler: anyGroup},
+		KindReconcilerRegistration{Group: "model.skippy.io", Kind: "FineTuneJob", Reconciler: skippy},
+	)
+	require.NoError(t, err)
+
+	lookup := func(group string) KindReconciler {
+		reg, ok := registry.Lookup(schema.GroupVersionKind{Group: group, Version: "v1", Kind: "FineTuneJob"})
+		require.True(t, ok)
+		return reg.Reconciler
+	}
+	assert.Same(t, skippy, lookup("model.skippy.io"), "a registration for the group wins at equal priority")
+	assert.Same(t, anyGroup, lookup("tuning.example.com"))
+
+	require.NoError(t, registry.Register(KindReconcilerRegistration{Name: "override", Kind: "FineTuneJob", Priority: 10, Reconciler: override}))
+	assert.Same(t, override, lookup("model.skippy.io"), "a higher priority wins")
+	assert.Same(t, override, lookup("tuning.example.com"))
+
+	_, ok := registry.Lookup(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "EvalRun"})
+	assert.False(t, ok)
+
+	var names []string
+	for _, reg := range registry.Registrations() {
+		names = append(names, reg.Name)
+	}
+	assert.Equal(t, []string{"override", "FineTuneJob", "FineTuneJob"}, names)
+}
+
+func TestKindReconcilerRegistryRegister(t *testing.T) {
+	registry, err := NewKindReconcilerRegistry(KindReconcilerRegistration{Name: "first", Kind: "EvalRun", Reconciler: &namedKindReconciler{}})
+	require.NoError(t, err)
+
+	err = registry.Register(KindReconcilerRegistration{Name: "second", Kind: "EvalRun", Reconciler: &namedKindReconciler{}})
+	assert.ErrorContains(t, err, `"first" and "second" are both registered`)
+	assert.NoError(t, registry.Register(KindReconcilerRegistration{Name: "second", Kind: "EvalRun", Priority: 1, Reconciler: &namedKindReconciler{}}))
+
+	assert.ErrorContains(t, registry.Register(KindReconcilerRegistration{Reconciler: &namedKindReconciler{}}), "has no kind")
+	assert.ErrorContains(t, registry.Register(KindReconcilerRegistration{Kind: "EvalRun", Priority: 2}), "has no reconciler")
+
+	var nilRegistry *KindReconcilerRegistry
+	_, ok := nilRegistry.Lookup(schema.GroupVersionKind{Kind: "EvalRun"})
+	assert.False(t, ok)
+}
+
+func TestDefaultKindReconcilers(t *testing.T) {
+	reg, ok := DefaultKindReconcilers.Lookup(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"})
+	require.True(t, ok)
+	assert.IsType(t, &ModelDataReconciler{}, reg.Reconciler)
+
+	reg, ok = DefaultKindReconcilers.Lookup(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandbox"})
+	require.True(t, ok)
+	assert.IsType(t, &AgenticSandboxReconciler{}, reg.Reconciler)
+}
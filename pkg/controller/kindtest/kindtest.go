@@ -0,0 +1,433 @@
+// Package kindtest drives a controller.KindReconciler through interleaved
+// cluster events, the way the generic reconciler does, and checks that its
+// phase machine is idempotent and never regresses.
+//
+// The target is kept in a fake cluster together with its dependents. Tests
+// interleave reconciliations with events such as deleting a dependent,
+// updating the spec of the target, failing client calls or losing a status
+// update:
+//
+//	h := kindtest.New(t, &controller.ModelDataReconciler{}, modelData, kindtest.Phases{
+//		Order:    []string{"Pending", "Syncing"},
+//		Terminal: []string{"Succeeded", "Failed"},
+//	}, job)
+//	h.SetDependents(job)
+//	h.Reconcile()
+//	h.Delete(job)
+//	h.Reconcile()
+//	h.ExpectPhase("Syncing")
+package kindtest
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/controller"
+)
+
+// Phases describes the phase machine of a kind.
+type Phases struct {
+	// Order lists the phases in the order they are reached. Moving to an
+	// earlier phase of the list is a regression. Phases that are not listed
+	// are not ordered.
+	Order []string
+	// Terminal phases are never left once they are stored.
+	Terminal []string
+	// Volatile lists the status fields, such as timestamps, that may differ
+	// between two runs on the same status.
+	Volatile []string
+}
+
+// Harness runs a KindReconciler against a fake cluster.
+type Harness struct {
+	t          testing.TB
+	reconciler controller.KindReconciler
+	phases     Phases
+	key        client.ObjectKey
+	gvk        schema.GroupVersionKind
+
+	// Client is the fake cluster holding the target and its dependents. Its
+	// calls are never failed by FailNext.
+	Client client.Client
+	// Recorder receives the events recorded by the stateful logic.
+	Recorder *record.FakeRecorder
+
+	reconcilerClient client.Client
+
+	mu       sync.Mutex
+	failures map[string][]error
+	failed   bool
+	conflict bool
+}
+
+// New returns a harness for target, which is stored in the fake cluster
+// together with objs. Built-in kinds and unstructured objects of any kind can
+// be stored.
+func New(t testing.TB, reconciler controller.KindReconciler, target *unstructured.Unstructured, phases Phases, objs ...client.Object) *Harness {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	h := &Harness{
+		t:          t,
+		reconciler: reconciler,
+		phases:     phases,
+		key:        client.ObjectKeyFromObject(target),
+		gvk:        target.GroupVersionKind(),
+		Recorder:   record.NewFakeRecorder(100),
+		failures:   map[string][]error{},
+	}
+	stored := target.DeepCopy()
+	if stored.GetGeneration() == 0 {
+		stored.SetGeneration(1)
+	}
+	cluster := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(append([]client.Object{stored}, objs...)...).
+		Build()
+	h.Client = cluster
+	h.reconcilerClient = interceptor.NewClient(cluster, h.interceptors())
+	return h
+}
+
+// FailNext makes the next call of verb ("get", "list", "create", "update",
+// "patch" or "delete") by the stateful logic fail with err. Calls are failed
+// in the order the errors were added.
+func (h *Harness) FailNext(verb string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures[verb] = append(h.failures[verb], err)
+}
+
+// ConflictNextStatusUpdate makes the status update of the next Reconcile
+// fail with a conflict, so that it is lost as if another writer had won.
+func (h *Harness) ConflictNextStatusUpdate() {
+	h.conflict = true
+}
+
+// Reconcile runs the stateful logic on the stored target and stores the
+// resulting status. Unless a client call was failed, the status of the run is
+// first dropped and the logic is run again on the stored target with the
+// previous status, as after a conflict. The test fails if the two runs
+// disagree or if the stored phase regresses.
+func (h *Harness) Reconcile() (ctrl.Result, error) {
+	h.t.Helper()
+	ctx := context.Background()
+	snapshot := h.Target()
+	before := Phase(snapshot)
+
+	target, result, failed, err := h.run(ctx, snapshot)
+	if retry, found := h.lookup(ctx); found && !failed {
+		h.setStatus(retry, snapshot)
+		retried, retryResult, retryFailed, retryErr := h.run(ctx, retry)
+		if !retryFailed {
+			if (err == nil) != (retryErr == nil) || result != retryResult {
+				h.t.Errorf("reconciling %s again with the same status is not idempotent: got (%v, %v), then (%v, %v)", h.gvk.Kind, result, err, retryResult, retryErr)
+			}
+			if a, b := h.comparableStatus(target), h.comparableStatus(retried); !reflect.DeepEqual(a, b) {
+				h.t.Errorf("reconciling %s again with the same status is not idempotent: status %v, then %v", h.gvk.Kind, a, b)
+			}
+			target, result, err = retried, retryResult, retryErr
+		}
+	}
+
+	if h.conflict {
+		h.conflict = false
+		return result, err
+	}
+	if h.storeStatus(ctx, target) {
+		h.checkTransition(before, Phase(target))
+	}
+	return result, err
+}
+
+// ReconcileUntilSettled reconciles until the stateful logic neither requeues
+// nor fails, or fails the test after limit reconciliations.
+func (h *Harness) ReconcileUntilSettled(limit int) {
+	h.t.Helper()
+	for i := 0; i < limit; i++ {
+		result, err := h.Reconcile()
+		if err == nil && result.IsZero() {
+			return
+		}
+	}
+	h.t.Fatalf("%s did not settle after %d reconciliations, phase %q", h.gvk.Kind, limit, h.Phase())
+}
+
+// Target returns the stored target.
+func (h *Harness) Target() *unstructured.Unstructured {
+	h.t.Helper()
+	target, found := h.lookup(context.Background())
+	if !found {
+		h.t.Fatalf("%s %s does not exist", h.gvk.Kind, h.key)
+	}
+	return target
+}
+
+// Exists reports whether the target is stored, which it no longer is once a
+// deleted target has released its last finalizer.
+func (h *Harness) Exists() bool {
+	h.t.Helper()
+	_, found := h.lookup(context.Background())
+	return found
+}
+
+// lookup returns the stored target, if any.
+func (h *Harness) lookup(ctx context.Context) (*unstructured.Unstructured, bool) {
+	h.t.Helper()
+	target := &unstructured.Unstructured{}
+	target.SetGroupVersionKind(h.gvk)
+	if err := h.Client.Get(ctx, h.key, target); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false
+		}
+		h.t.Fatalf("failed to get %s %s: %v", h.gvk.Kind, h.key, err)
+	}
+	return target, true
+}
+
+// Phase returns the stored phase of the target.
+func (h *Harness) Phase() string {
+	h.t.Helper()
+	return Phase(h.Target())
+}
+
+// ExpectPhase fails the test unless the stored phase is phase.
+func (h *Harness) ExpectPhase(phase string) {
+	h.t.Helper()
+	if got := h.Phase(); got != phase {
+		h.t.Errorf("expected %s phase %q, got %q", h.gvk.Kind, phase, got)
+	}
+}
+
+// UpdateSpec changes the spec of the stored target and bumps its generation,
+// as the API server does for a user update.
+func (h *Harness) UpdateSpec(mutate func(spec map[string]interface{})) {
+	h.t.Helper()
+	target := h.Target()
+	spec, _, _ := unstructured.NestedMap(target.Object, "spec")
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	mutate(spec)
+	if err := unstructured.SetNestedMap(target.Object, spec, "spec"); err != nil {
+		h.t.Fatalf("failed to set spec: %v", err)
+	}
+	target.SetGeneration(target.GetGeneration() + 1)
+	if err := h.Client.Update(context.Background(), target); err != nil {
+		h.t.Fatalf("failed to update %s %s: %v", h.gvk.Kind, h.key, err)
+	}
+}
+
+// SetDependents records objs in status.dependentResources of the target, as
+// the generic reconciler does once it has applied them. Without objs, the
+// dependents are cleared, as after a failed render.
+func (h *Harness) SetDependents(objs ...client.Object) {
+	h.t.Helper()
+	dependents := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		gvk, err := h.Client.GroupVersionKindFor(obj)
+		if err != nil {
+			h.t.Fatalf("failed to get the kind of %T: %v", obj, err)
+		}
+		dependents = append(dependents, map[string]interface{}{
+			"kind":      gvk.Kind,
+			"name":      obj.GetName(),
+			"namespace": obj.GetNamespace(),
+			"status":    "Processed",
+		})
+	}
+	target := h.Target()
+	if err := unstructured.SetNestedSlice(target.Object, dependents, "status", "dependentResources"); err != nil {
+		h.t.Fatalf("failed to set dependents: %v", err)
+	}
+	if err := h.Client.Update(context.Background(), target); err != nil {
+		h.t.Fatalf("failed to update %s %s: %v", h.gvk.Kind, h.key, err)
+	}
+}
+
+// Apply creates obj, or replaces it if it exists, including its status.
+func (h *Harness) Apply(obj client.Object) {
+	h.t.Helper()
+	ctx := context.Background()
+	desired := obj.DeepCopyObject().(client.Object)
+	existing := obj.DeepCopyObject().(client.Object)
+	err := h.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		obj.SetResourceVersion("")
+		err = h.Client.Create(ctx, obj)
+	case err == nil:
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		err = h.Client.Update(ctx, obj)
+	}
+	if err == nil {
+		// Kinds with a status subresource ignore the status on writes.
+		desired.SetResourceVersion(obj.GetResourceVersion())
+		if err = h.Client.Status().Update(ctx, desired); apierrors.IsNotFound(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		h.t.Fatalf("failed to apply %T %s: %v", obj, client.ObjectKeyFromObject(obj), err)
+	}
+}
+
+// Delete deletes obj. Deleting the target marks it for deletion while it has
+// finalizers.
+func (h *Harness) Delete(obj client.Object) {
+	h.t.Helper()
+	if err := h.Client.Delete(context.Background(), obj); err != nil && !apierrors.IsNotFound(err) {
+		h.t.Fatalf("failed to delete %T %s: %v", obj, client.ObjectKeyFromObject(obj), err)
+	}
+}
+
+// Phase returns status.phase of obj.
+func Phase(obj *unstructured.Unstructured) string {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	return phase
+}
+
+// run runs the stateful logic on a copy of target. It reports whether one of
+// the failures queued with FailNext was returned to the logic.
+func (h *Harness) run(ctx context.Context, target *unstructured.Unstructured) (*unstructured.Unstructured, ctrl.Result, bool, error) {
+	target = target.DeepCopy()
+	h.mu.Lock()
+	h.failed = false
+	h.mu.Unlock()
+	r := &controller.GenericReconciler{
+		Client:   h.reconcilerClient,
+		Scheme:   h.Client.Scheme(),
+		Gvk:      h.gvk,
+		Recorder: h.Recorder,
+	}
+	result, err := h.reconciler.ReconcileStateful(ctx, r, target)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return target, result, h.failed, err
+}
+
+// setStatus replaces the status of target with the one of from.
+func (h *Harness) setStatus(target, from *unstructured.Unstructured) {
+	h.t.Helper()
+	status, found, _ := unstructured.NestedMap(from.Object, "status")
+	if !found {
+		unstructured.RemoveNestedField(target.Object, "status")
+	} else if err := unstructured.SetNestedMap(target.Object, status, "status"); err != nil {
+		h.t.Fatalf("failed to set status: %v", err)
+	}
+}
+
+// storeStatus stores the status of target, keeping the metadata changes made
+// by the stateful logic in the meantime, such as finalizers. It reports
+// whether the target still exists.
+func (h *Harness) storeStatus(ctx context.Context, target *unstructured.Unstructured) bool {
+	h.t.Helper()
+	stored, found := h.lookup(ctx)
+	if !found {
+		// The target was released by its last finalizer.
+		return false
+	}
+	h.setStatus(stored, target)
+	if err := h.Client.Update(ctx, stored); err != nil {
+		h.t.Fatalf("failed to update the status of %s %s: %v", h.gvk.Kind, h.key, err)
+	}
+	return true
+}
+
+// checkTransition fails the test if moving from phase before to after
+// regresses the phase machine.
+func (h *Harness) checkTransition(before, after string) {
+	h.t.Helper()
+	if before == after || before == "" {
+		return
+	}
+	if slices.Contains(h.phases.Terminal, before) {
+		h.t.Errorf("%s left the terminal phase %q for %q", h.gvk.Kind, before, after)
+		return
+	}
+	from, to := slices.Index(h.phases.Order, before), slices.Index(h.phases.Order, after)
+	if from >= 0 && to >= 0 && to < from {
+		h.t.Errorf("%s regressed from phase %q to %q", h.gvk.Kind, before, after)
+	}
+}
+
+// comparableStatus returns the status of target without its volatile fields.
+func (h *Harness) comparableStatus(target *unstructured.Unstructured) map[string]interface{} {
+	status, _, _ := unstructured.NestedMap(target.Object, "status")
+	for _, field := range h.phases.Volatile {
+		delete(status, field)
+	}
+	return status
+}
+
+// interceptors fails the client calls of the stateful logic queued with
+// FailNext.
+func (h *Harness) interceptors() interceptor.Funcs {
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := h.nextFailure("get"); err != nil {
+				return err
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := h.nextFailure("list"); err != nil {
+				return err
+			}
+			return c.List(ctx, list, opts...)
+		},
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if err := h.nextFailure("create"); err != nil {
+				return err
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if err := h.nextFailure("update"); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if err := h.nextFailure("patch"); err != nil {
+				return err
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if err := h.nextFailure("delete"); err != nil {
+				return err
+			}
+			return c.Delete(ctx, obj, opts...)
+		},
+	}
+}
+
+// nextFailure pops the next error queued for verb.
+func (h *Harness) nextFailure(verb string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	queued := h.failures[verb]
+	if len(queued) == 0 {
+		return nil
+	}
+	h.failures[verb] = queued[1:]
+	h.failed = true
+	return queued[0]
+}
@@ -0,0 +1,115 @@
+package kindtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// recordingT records the failures reported by the harness.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// kindReconcilerFunc adapts a function to a KindReconciler.
+type kindReconcilerFunc func(obj *unstructured.Unstructured) (ctrl.Result, error)
+
+func (f kindReconcilerFunc) ReconcileStateful(ctx context.Context, host modelv1.KindReconcilerHost, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	return f(obj)
+}
+
+func testTarget() *unstructured.Unstructured {
+	target := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	target.SetAPIVersion("model.skippy.io/v1")
+	target.SetKind("Widget")
+	target.SetName("widget")
+	target.SetNamespace("default")
+	return target
+}
+
+var testPhases = Phases{Order: []string{"Pending", "Running"}, Terminal: []string{"Done"}}
+
+func TestReconcileDetectsRegressions(t *testing.T) {
+	phases := []string{"Running", "Pending"}
+	calls := 0
+	rec := &recordingT{TB: t}
+	h := New(rec, kindReconcilerFunc(func(obj *unstructured.Unstructured) (ctrl.Result, error) {
+		// Both runs of a Reconcile see the same status and agree.
+		phase := phases[calls/2]
+		calls++
+		return ctrl.Result{}, unstructured.SetNestedField(obj.Object, phase, "status", "phase")
+	}), testTarget(), testPhases)
+
+	h.Reconcile()
+	assert.Empty(t, rec.failures)
+	h.Reconcile()
+	require.Len(t, rec.failures, 1)
+	assert.Contains(t, rec.failures[0], `regressed from phase "Running" to "Pending"`)
+}
+
+func TestReconcileDetectsTerminalPhaseChanges(t *testing.T) {
+	rec := &recordingT{TB: t}
+	target := testTarget()
+	unstructured.SetNestedField(target.Object, "Done", "status", "phase")
+	h := New(rec, kindReconcilerFunc(func(obj *unstructured.Unstructured) (ctrl.Result, error) {
+		return ctrl.Result{}, unstructured.SetNestedField(obj.Object, "Running", "status", "phase")
+	}), target, testPhases)
+
+	h.Reconcile()
+	require.Len(t, rec.failures, 1)
+	assert.Contains(t, rec.failures[0], `left the terminal phase "Done"`)
+}
+
+func TestReconcileDetectsNonIdempotentRuns(t *testing.T) {
+	rec := &recordingT{TB: t}
+	calls := int64(0)
+	h := New(rec, kindReconcilerFunc(func(obj *unstructured.Unstructured) (ctrl.Result, error) {
+		calls++
+		return ctrl.Result{}, unstructured.SetNestedField(obj.Object, calls, "status", "attempt")
+	}), testTarget(), testPhases)
+
+	h.Reconcile()
+	require.Len(t, rec.failures, 1)
+	assert.Contains(t, rec.failures[0], "not idempotent")
+}
+
+func TestConflictNextStatusUpdate(t *testing.T) {
+	h := New(t, kindReconcilerFunc(func(obj *unstructured.Unstructured) (ctrl.Result, error) {
+		return ctrl.Result{}, unstructured.SetNestedField(obj.Object, "Running", "status", "phase")
+	}), testTarget(), testPhases)
+
+	h.ConflictNextStatusUpdate()
+	h.Reconcile()
+	h.ExpectPhase("")
+	h.Reconcile()
+	h.ExpectPhase("Running")
+}
+
+func TestFailNext(t *testing.T) {
+	h := New(t, kindReconcilerFunc(func(obj *unstructured.Unstructured) (ctrl.Result, error) {
+		return ctrl.Result{}, nil
+	}), testTarget(), testPhases)
+	timeout := apierrors.NewTimeoutError("request timed out", 1)
+	h.FailNext("get", timeout)
+
+	// The harness's own client is never failed.
+	h.Target()
+	err := h.reconcilerClient.Get(context.Background(), h.key, h.Target())
+	assert.Equal(t, timeout, err)
+	assert.NoError(t, h.reconcilerClient.Get(context.Background(), h.key, h.Target()))
+}
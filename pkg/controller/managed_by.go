@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ManagedByLabel is set to ManagedByValue on every dependent that karo
+	// creates, so that they can be listed, e.g. with
+	// kubectl get deployments -l app.kubernetes.io/managed-by=karo.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "karo"
+	// IntegrationLabel is set to the IntegrationName of the integration that
+	// rendered a dependent.
+	IntegrationLabel = "model.skippy.io/integration"
+	// OwnerUIDLabel is set to the UID of the resource that a dependent was
+	// rendered for. Unlike owner references, it is also set on cluster-scoped
+	// and retained dependents.
+	OwnerUIDLabel = "model.skippy.io/owner-uid"
+
+	// FieldManagerPrefix prefixes the IntegrationName in the field manager of
+	// the writes of each integration.
+	FieldManagerPrefix = "karo/"
+
+	// maxLabelValueLength is the maximum length of label values.
+	maxLabelValueLength = 63
+)
+
+// IntegrationName returns the name of the integration of gvk in labels and
+// field managers: its lowercase kind and group, e.g.
+// inferencedeployment.model.skippy.io. Names that do not fit in a label value
+// are shortened with a hash.
+func IntegrationName(gvk schema.GroupVersionKind) string {
+	name := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		name += "." + gvk.Group
+	}
+	if len(name) <= maxLabelValueLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(name[:maxLabelValueLength-len(hash)-1], ".-") + "-" + hash
+}
+
+// FieldManager returns the field manager of the writes of the integration of
+// gvk, so that managedFields tell the integrations that own a field apart.
+func FieldManager(gvk schema.GroupVersionKind) string {
+	return FieldManagerPrefix + IntegrationName(gvk)
+}
+
+// managedByLabels returns the labels that identify the dependents of target.
+func (r *GenericReconciler) managedByLabels(target *unstructured.Unstructured) map[string]string {
+	return map[string]string{
+		ManagedByLabel:   ManagedByValue,
+		IntegrationLabel: IntegrationName(r.Gvk),
+		OwnerUIDLabel:    string(target.GetUID()),
+	}
+}
+
+// setLabels sets labels on obj, over the ones the templates set.
+func setLabels(obj *unstructured.Unstructured, labels map[string]string) {
+	existing := obj.GetLabels()
+	if existing == nil {
+		existing = make(map[string]string, len(labels))
+	}
+	for key, value := range labels {
+		existing[key] = value
+	}
+	obj.SetLabels(existing)
+}
+
+// managedByLabelsChanged reports whether existingObj lacks the managed-by
+// labels of obj, e.g. because it was created before they were set.
+func managedByLabelsChanged(existingObj, obj *unstructured.Unstructured) bool {
+	existing, desired := existingObj.GetLabels(), obj.GetLabels()
+	for _, key := range []string{ManagedByLabel, IntegrationLabel, OwnerUIDLabel} {
+		if value, ok := desired[key]; ok && existing[key] != value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIntegrationName(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceDeployment"}
+	assert.Equal(t, "inferencedeployment.model.skippy.io", IntegrationName(gvk))
+	assert.Equal(t, "karo/inferencedeployment.model.skippy.io", FieldManager(gvk))
+	assert.Equal(t, "configmap", IntegrationName(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}))
+
+	long := schema.GroupVersionKind{Group: strings.Repeat("very-long-group.", 5) + "example.com", Version: "v1", Kind: "InferenceDeployment"}
+	name := IntegrationName(long)
+	assert.LessOrEqual(t, len(name), maxLabelValueLength)
+	assert.Equal(t, name, IntegrationName(long), "names are deterministic")
+	assert.NotEqual(t, name, IntegrationName(schema.GroupVersionKind{Group: long.Group, Version: "v1", Kind: "Agent"}))
+}
+
+func TestManagedByLabels(t *testing.T) {
+	r := &GenericReconciler{Gvk: schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}}
+	target := newTestResource("agent", "default", r.Gvk)
+	target.SetUID("target-uid")
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetLabels(map[string]string{"app": "agent", ManagedByLabel: "Helm"})
+	setLabels(obj, r.managedByLabels(target))
+	assert.Equal(t, map[string]string{
+		"app":            "agent",
+		ManagedByLabel:   ManagedByValue,
+		IntegrationLabel: "agent.model.skippy.io",
+		OwnerUIDLabel:    "target-uid",
+	}, obj.GetLabels())
+
+	existing := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	existing.SetLabels(map[string]string{"app": "agent"})
+	assert.True(t, managedByLabelsChanged(existing, obj), "objects created before the labels are updated")
+	existing.SetLabels(obj.GetLabels())
+	assert.False(t, managedByLabelsChanged(existing, obj))
+	assert.False(t, managedByLabelsChanged(existing, &unstructured.Unstructured{Object: map[string]interface{}{}}))
+}
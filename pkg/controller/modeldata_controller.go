@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"path"
 	"strings"
@@ -16,13 +17,23 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 )
 
+// errJobResultUnavailable is returned when the result of a completed sync Job
+// can no longer be read, which fails the ModelData.
+var errJobResultUnavailable = stderrors.New("sync result unavailable")
+
 // ModelDataReconciler implements the stateful logic for ModelData CRs.
-type ModelDataReconciler struct{}
+type ModelDataReconciler struct {
+	// PodLogs reads the logs of the failed pods of sync Jobs. Defaults to
+	// the logs API of the cluster of the host.
+	PodLogs PodLogsFunc
+}
 
 // ReconcileStateful contains the state machine logic with added debugging.
-func (m *ModelDataReconciler) ReconcileStateful(ctx context.Context, r *GenericReconciler, modelData *unstructured.Unstructured) (ctrl.Result, error) {
+func (m *ModelDataReconciler) ReconcileStateful(ctx context.Context, r modelv1.KindReconcilerHost, modelData *unstructured.Unstructured) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("ModelData.Name", modelData.GetName())
 
 	// 1. Get the entire status map safely.
@@ -44,7 +55,11 @@ func (m *ModelDataReconciler) ReconcileStateful(ctx context.Context, r *GenericR
 	// 1. Get the Job's name from the ModelData's status.
 	dependents, found, _ := unstructured.NestedSlice(modelData.Object, "status", "dependentResources")
 	if !found || len(dependents) == 0 {
-		m.updateStatusFields(modelData, "Pending", "Waiting for download job to be created.", "", "")
+		// The dependents are also missing after a failed render, which must
+		// not report a running sync as pending again.
+		if phase != "Syncing" {
+			m.updateStatusFields(modelData, "Pending", "Waiting for download job to be created.", "", "")
+		}
 		return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
 	}
 	jobInfo, _ := dependents[0].(map[string]interface{})
@@ -52,7 +67,7 @@ func (m *ModelDataReconciler) ReconcileStateful(ctx context.Context, r *GenericR
 
 	// 2. Get the Job from the cluster.
 	foundJob := &batchv1.Job{}
-	err := r.Client.Get(ctx, types.NamespacedName{Name: jobName, Namespace: modelData.GetNamespace()}, foundJob)
+	err := r.GetClient().Get(ctx, types.NamespacedName{Name: jobName, Namespace: modelData.GetNamespace()}, foundJob)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
@@ -78,13 +93,25 @@ func (m *ModelDataReconciler) ReconcileStateful(ctx context.Context, r *GenericR
 	}
 
 	if isFailed {
-		m.updateStatusFields(modelData, "Failed", "The model synchronization Job failed.", "", "")
+		message := "The model synchronization Job failed."
+		tail, err := m.captureFailureLogs(ctx, r, modelData, foundJob)
+		if err != nil {
+			// The failure is reported without its logs rather than retried.
+			logger.Error(err, "Failed to capture the logs of the failed sync Job")
+		} else if tail != "" {
+			message += " Last log lines of " + tail
+		}
+		m.updateStatusFields(modelData, "Failed", message, "", "")
 		return ctrl.Result{}, nil // Stop reconciling
 	}
 
 	if isComplete {
-		gitHash, err := m.getHashFromTerminatedPod(ctx, r.Client, foundJob)
+		gitHash, err := m.getHashFromTerminatedPod(ctx, r.GetClient(), foundJob)
 		if err != nil {
+			if !stderrors.Is(err, errJobResultUnavailable) {
+				// A failed lookup is retried in the current phase.
+				return ctrl.Result{}, err
+			}
 			m.updateStatusFields(modelData, "Failed", "Job succeeded but could not read result: "+err.Error(), "", "")
 			return ctrl.Result{}, err
 		}
@@ -124,7 +151,7 @@ func (m *ModelDataReconciler) getHashFromTerminatedPod(ctx context.Context, c cl
 		return "", fmt.Errorf("failed to list pods for job %q: %w", job.GetName(), err)
 	}
 	if len(podList.Items) == 0 {
-		return "", fmt.Errorf("no pods found for completed job %q", job.GetName())
+		return "", fmt.Errorf("%w: no pods found for completed job %q", errJobResultUnavailable, job.GetName())
 	}
 	pod := podList.Items[0]
 	for _, containerStatus := range pod.Status.ContainerStatuses {
@@ -132,7 +159,7 @@ func (m *ModelDataReconciler) getHashFromTerminatedPod(ctx context.Context, c cl
 			return strings.TrimSpace(containerStatus.State.Terminated.Message), nil
 		}
 	}
-	return "", fmt.Errorf("job %q finished but could not find termination message", job.GetName())
+	return "", fmt.Errorf("%w: job %q finished but could not find termination message", errJobResultUnavailable, job.GetName())
 }
 
 // buildFinalGCSPath robustly constructs the final GCS path string.
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// modelDataLogTailLines and modelDataLogTailBytes bound the logs of each
+	// failed container that are kept in the failure logs ConfigMap.
+	modelDataLogTailLines = 200
+	modelDataLogTailBytes = 32 * 1024
+
+	// modelDataMessageLogLines and modelDataMessageLogBytes bound the log
+	// lines appended to status.message, so that the status stays readable.
+	modelDataMessageLogLines = 10
+	modelDataMessageLogBytes = 1024
+)
+
+// PodLogsFunc returns the last tailLines lines of the logs of a container,
+// and at most limitBytes of them.
+type PodLogsFunc func(ctx context.Context, namespace, pod, container string, tailLines, limitBytes int64) (string, error)
+
+// podLogReader is implemented by the hosts that can read the logs of pods.
+type podLogReader interface {
+	PodLogs(ctx context.Context, namespace, pod, container string, tailLines, limitBytes int64) (string, error)
+}
+
+var _ podLogReader = (*GenericReconciler)(nil)
+
+// PodLogs reads the logs of a container with the logs API, which the client
+// of the reconciler does not serve.
+func (r *GenericReconciler) PodLogs(ctx context.Context, namespace, pod, container string, tailLines, limitBytes int64) (string, error) {
+	cfg, err := r.restConfig()
+	if err != nil {
+		return "", fmt.Errorf("unable to get config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", fmt.Errorf("unable to create clientset: %w", err)
+	}
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container:  container,
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	logs, err := io.ReadAll(io.LimitReader(stream, limitBytes))
+	return string(logs), err
+}
+
+// modelDataFailureLogsName returns the name of the ConfigMap that holds the
+// logs of the failed sync Job of a ModelData.
+func modelDataFailureLogsName(modelData *unstructured.Unstructured) string {
+	return modelData.GetName() + "-sync-logs"
+}
+
+// podLogs returns the function that reads the logs of the failed pods, or nil
+// if neither the reconciler nor the host can read logs.
+func (m *ModelDataReconciler) podLogs(r modelv1.KindReconcilerHost) PodLogsFunc {
+	if m.PodLogs != nil {
+		return m.PodLogs
+	}
+	if reader, ok := r.(podLogReader); ok {
+		return reader.PodLogs
+	}
+	return nil
+}
+
+// captureFailureLogs stores the last lines of the logs of the failed
+// containers of the latest failed pod of job in a ConfigMap owned by the
+// ModelData, and records its name in status.failureLogs. It returns the last
+// lines of the container that failed last, for status.message, or "" if no
+// failed pod is left.
+func (m *ModelDataReconciler) captureFailureLogs(ctx context.Context, r modelv1.KindReconcilerHost, modelData *unstructured.Unstructured, job *batchv1.Job) (string, error) {
+	podLogs := m.podLogs(r)
+	if podLogs == nil || job.Spec.Selector == nil {
+		return "", nil
+	}
+	pod, err := latestFailedPod(ctx, r.GetClient(), job)
+	if err != nil || pod == nil {
+		return "", err
+	}
+
+	data := map[string]string{}
+	tail := ""
+	for _, status := range failedContainers(pod) {
+		logs, err := podLogs(ctx, pod.Namespace, pod.Name, status.Name, modelDataLogTailLines, modelDataLogTailBytes)
+		if err != nil {
+			// Logs are gone once the node is; the termination message of
+			// the container is the last resort.
+			if status.State.Terminated.Message == "" {
+				return "", fmt.Errorf("failed to read the logs of container %q of pod %q: %w", status.Name, pod.Name, err)
+			}
+			logs = status.State.Terminated.Message
+		}
+		data[status.Name+".log"] = logs
+		tail = fmt.Sprintf("%s/%s: %s", pod.Name, status.Name, tailLogLines(logs, modelDataMessageLogLines, modelDataMessageLogBytes))
+	}
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	if err := m.storeFailureLogs(ctx, r, modelData, data); err != nil {
+		return "", err
+	}
+	return tail, unstructured.SetNestedField(modelData.Object, modelDataFailureLogsName(modelData), "status", "failureLogs")
+}
+
+// storeFailureLogs creates or replaces the failure logs ConfigMap of
+// modelData.
+func (m *ModelDataReconciler) storeFailureLogs(ctx context.Context, r modelv1.KindReconcilerHost, modelData *unstructured.Unstructured, data map[string]string) error {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: modelData.GetNamespace(),
+		Name:      modelDataFailureLogsName(modelData),
+	}}
+	if err := controllerutil.SetOwnerReference(modelData, configMap, r.GetScheme()); err != nil {
+		return fmt.Errorf("failed to set the owner of the failure logs: %w", err)
+	}
+	configMap.Data = data
+
+	c := r.GetClient()
+	err := c.Create(ctx, configMap)
+	if apierrors.IsAlreadyExists(err) {
+		// Logs of an earlier failure, e.g. before the spec was changed.
+		existing := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(configMap), existing); err != nil {
+			return fmt.Errorf("failed to get the failure logs: %w", err)
+		}
+		existing.OwnerReferences = configMap.OwnerReferences
+		existing.Data = data
+		err = c.Update(ctx, existing)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store the failure logs: %w", err)
+	}
+	return nil
+}
+
+// latestFailedPod returns the failed pod of job that was created last, or nil
+// if the failed pods were already deleted.
+func latestFailedPod(ctx context.Context, c client.Client, job *batchv1.Job) (*corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, client.InNamespace(job.GetNamespace()), client.MatchingLabels(job.Spec.Selector.MatchLabels)); err != nil {
+		return nil, fmt.Errorf("failed to list pods for job %q: %w", job.GetName(), err)
+	}
+	var latest *corev1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Status.Phase != corev1.PodFailed {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest, nil
+}
+
+// failedContainers returns the init and regular containers of pod that exited
+// with an error, ordered by when they finished.
+func failedContainers(pod *corev1.Pod) []corev1.ContainerStatus {
+	var failed []corev1.ContainerStatus
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+			failed = append(failed, status)
+		}
+	}
+	sort.SliceStable(failed, func(i, j int) bool {
+		return failed[i].State.Terminated.FinishedAt.Before(&failed[j].State.Terminated.FinishedAt)
+	})
+	return failed
+}
+
+// tailLogLines returns the last lines of logs, and at most maxBytes of them,
+// cut at a line boundary unless the last line alone is longer.
+func tailLogLines(logs string, maxLines, maxBytes int) string {
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	tail := strings.Join(lines, "\n")
+	for len(tail) > maxBytes {
+		_, rest, found := strings.Cut(tail, "\n")
+		if !found {
+			return "..." + strings.ToValidUTF8(tail[len(tail)-maxBytes:], "")
+		}
+		tail = rest
+	}
+	return tail
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func makeFailedTestPod(name, jobName string, created time.Time, message string) *corev1.Pod {
+	finished := metav1.NewTime(created.Add(time.Minute))
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{"job-name": jobName},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "setup",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+			}},
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "hf-download",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode:   1,
+					Message:    message,
+					FinishedAt: finished,
+				}},
+			}},
+		},
+	}
+}
+
+func TestModelDataFailureLogs(t *testing.T) {
+	s := runtime.NewScheme()
+	_ = batchv1.AddToScheme(s)
+	_ = corev1.AddToScheme(s)
+	now := time.Now()
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		makeTestJob("test-model-data", "default", "Failed"),
+		makeFailedTestPod("job-pod-old", "test-model-data", now.Add(-time.Hour), ""),
+		makeFailedTestPod("job-pod-new", "test-model-data", now, ""),
+	).Build()
+
+	var lines []string
+	for i := 1; i <= 300; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines = append(lines, "403 Forbidden: https://huggingface.co/meta-llama/Llama-3.1-8B")
+	var requested []string
+	reconciler := &ModelDataReconciler{PodLogs: func(_ context.Context, namespace, pod, container string, tailLines, limitBytes int64) (string, error) {
+		requested = append(requested, pod+"/"+container)
+		assert.EqualValues(t, modelDataLogTailLines, tailLines)
+		assert.EqualValues(t, modelDataLogTailBytes, limitBytes)
+		return strings.Join(lines[len(lines)-int(tailLines):], "\n") + "\n", nil
+	}}
+
+	modelData := makeTestModelData("test-model-data", "default", "Syncing", []interface{}{
+		map[string]interface{}{"kind": "Job", "name": "test-model-data", "namespace": "default"},
+	})
+	modelData.SetUID("model-data-uid")
+	_, err := reconciler.ReconcileStateful(context.Background(), &GenericReconciler{Client: fakeClient, Scheme: s}, modelData)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job-pod-new/hf-download"}, requested, "only the failed containers of the latest pod are read")
+
+	phase, _, _ := unstructured.NestedString(modelData.Object, "status", "phase")
+	assert.Equal(t, "Failed", phase)
+	message, _, _ := unstructured.NestedString(modelData.Object, "status", "message")
+	assert.True(t, strings.HasPrefix(message, "The model synchronization Job failed. Last log lines of job-pod-new/hf-download: line 292\n"), message)
+	assert.True(t, strings.HasSuffix(message, "403 Forbidden: https://huggingface.co/meta-llama/Llama-3.1-8B"), message)
+	failureLogs, _, _ := unstructured.NestedString(modelData.Object, "status", "failureLogs")
+	assert.Equal(t, "test-model-data-sync-logs", failureLogs)
+
+	configMap := &corev1.ConfigMap{}
+	require.NoError(t, fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: failureLogs}, configMap))
+	assert.Equal(t, []string{"hf-download.log"}, keys(configMap.Data))
+	assert.Len(t, strings.Split(strings.TrimSpace(configMap.Data["hf-download.log"]), "\n"), modelDataLogTailLines)
+	require.Len(t, configMap.OwnerReferences, 1)
+	assert.Equal(t, "model-data-uid", string(configMap.OwnerReferences[0].UID))
+}
+
+func TestModelDataFailureLogsFallBackToTerminationMessage(t *testing.T) {
+	s := runtime.NewScheme()
+	_ = batchv1.AddToScheme(s)
+	_ = corev1.AddToScheme(s)
+	// Logs of an earlier failure are replaced.
+	stale := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-model-data-sync-logs"},
+		Data:       map[string]string{"gcloud-upload.log": "stale"},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		makeTestJob("test-model-data", "default", "Failed"),
+		makeFailedTestPod("job-pod", "test-model-data", time.Now(), "checksum mismatch for model.safetensors"),
+		stale,
+	).Build()
+	reconciler := &ModelDataReconciler{PodLogs: func(context.Context, string, string, string, int64, int64) (string, error) {
+		return "", errors.New("node is gone")
+	}}
+
+	modelData := makeTestModelData("test-model-data", "default", "Syncing", []interface{}{
+		map[string]interface{}{"kind": "Job", "name": "test-model-data", "namespace": "default"},
+	})
+	_, err := reconciler.ReconcileStateful(context.Background(), &GenericReconciler{Client: fakeClient, Scheme: s}, modelData)
+	require.NoError(t, err)
+	message, _, _ := unstructured.NestedString(modelData.Object, "status", "message")
+	assert.Equal(t, "The model synchronization Job failed. Last log lines of job-pod/hf-download: checksum mismatch for model.safetensors", message)
+
+	configMap := &corev1.ConfigMap{}
+	require.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(stale), configMap))
+	assert.Equal(t, map[string]string{"hf-download.log": "checksum mismatch for model.safetensors"}, configMap.Data)
+}
+
+func TestTailLogLines(t *testing.T) {
+	assert.Equal(t, "c\nd", tailLogLines("a\nb\nc\nd\n", 2, 100))
+	assert.Equal(t, "dddd", tailLogLines("a\nbbbb\ncc\ndddd", 10, 6))
+	assert.Equal(t, "...5678", tailLogLines("12345678", 10, 4))
+	assert.Equal(t, "", tailLogLines("", 10, 100))
+}
+
+func keys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
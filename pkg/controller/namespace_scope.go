@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// clusterScopedKinds returns the kinds of an integration, its own and the
+// referenced ones, that are cluster-scoped. An operator that runs
+// namespace-scoped can neither watch nor read them. Kinds that the cluster
+// does not serve yet are not reported.
+func clusterScopedKinds(mapper meta.RESTMapper, spec modelv1.IntegrationSpec) ([]string, error) {
+	gvks := []schema.GroupVersionKind{{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}}
+	for _, ref := range spec.References {
+		gvks = append(gvks, schema.GroupVersionKind{Group: ref.Group, Version: ref.Version, Kind: ref.Kind})
+	}
+
+	var kinds []string
+	for _, gvk := range gvks {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the scope of %s: %w", gvk, err)
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			kinds = append(kinds, gvk.GroupKind().String())
+		}
+	}
+	return kinds, nil
+}
+
+// checkNamespaceScope returns an error if the operator runs namespace-scoped
+// and the integration uses cluster-scoped kinds.
+func checkNamespaceScope(mapper meta.RESTMapper, spec modelv1.IntegrationSpec) error {
+	kinds, err := clusterScopedKinds(mapper, spec)
+	if err != nil {
+		return err
+	}
+	if len(kinds) > 0 {
+		return fmt.Errorf("the operator runs namespace-scoped, but integration %s/%s/%s uses cluster-scoped kinds: %s", spec.Group, spec.Version, spec.Kind, strings.Join(kinds, ", "))
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-model-skippy-io-v1-integration,mutating=false,failurePolicy=fail,sideEffects=None,groups=model.skippy.io,resources=integrations,verbs=create;update,versions=v1,name=vintegration.model.skippy.io,admissionReviewVersions=v1
+
+// IntegrationValidator validates Integrations at admission, so that an
+// Integration that the operator cannot reconcile is rejected instead of
+// being ignored.
+type IntegrationValidator struct {
+	// NamespaceScoped rejects integrations of cluster-scoped kinds.
+	NamespaceScoped bool
+	Mapper          meta.RESTMapper
+}
+
+var _ admission.CustomValidator = &IntegrationValidator{}
+
+// ValidateCreate validates a new Integration.
+func (v *IntegrationValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validate(obj)
+}
+
+// ValidateUpdate validates a changed Integration.
+func (v *IntegrationValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return v.validate(newObj)
+}
+
+// ValidateDelete allows every deletion.
+func (v *IntegrationValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *IntegrationValidator) validate(obj runtime.Object) (admission.Warnings, error) {
+	integration, ok := obj.(*modelv1.Integration)
+	if !ok {
+		return nil, fmt.Errorf("expected an Integration, got %T", obj)
+	}
+	for _, spec := range integration.Spec {
+		for _, reference := range spec.References {
+			if _, err := transformer.TemplateSelector(reference.PropagateTemplatePaths); err != nil {
+				return nil, fmt.Errorf("reference to %s of %s: %w", reference.Kind, spec.Kind, err)
+			}
+		}
+	}
+	if !v.NamespaceScoped {
+		return nil, nil
+	}
+	for _, spec := range integration.Spec {
+		if err := checkNamespaceScope(v.Mapper, spec); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
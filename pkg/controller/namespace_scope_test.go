@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newScopeMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandboxClass"}, meta.RESTScopeRoot)
+	return mapper
+}
+
+func TestClusterScopedKinds(t *testing.T) {
+	mapper := newScopeMapper()
+
+	kinds, err := clusterScopedKinds(mapper, modelv1.IntegrationSpec{
+		Group: "model.skippy.io", Version: "v1", Kind: "Agent",
+		References: []modelv1.IntegrationApiReferenceSpec{
+			{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"},
+			{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandboxClass"},
+			{Group: "example.com", Version: "v1", Kind: "NotInstalled"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AgenticSandboxClass.model.skippy.io"}, kinds)
+}
+
+func TestIntegrationValidator(t *testing.T) {
+	integration := &modelv1.Integration{Spec: []modelv1.IntegrationSpec{
+		{Group: "model.skippy.io", Version: "v1", Kind: "Agent"},
+		{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandboxClass"},
+	}}
+
+	validator := &IntegrationValidator{Mapper: newScopeMapper()}
+	_, err := validator.ValidateCreate(context.Background(), integration)
+	assert.NoError(t, err, "cluster-scoped kinds are allowed by a cluster-scoped operator")
+
+	validator.NamespaceScoped = true
+	_, err = validator.ValidateCreate(context.Background(), integration)
+	assert.ErrorContains(t, err, "integration model.skippy.io/v1/AgenticSandboxClass uses cluster-scoped kinds: AgenticSandboxClass.model.skippy.io")
+	_, err = validator.ValidateUpdate(context.Background(), integration, &modelv1.Integration{Spec: integration.Spec[:1]})
+	assert.NoError(t, err)
+	_, err = validator.ValidateDelete(context.Background(), integration)
+	assert.NoError(t, err)
+
+	// Malformed template selectors are rejected by every operator.
+	invalid := &modelv1.Integration{Spec: []modelv1.IntegrationSpec{{
+		Group: "model.skippy.io", Version: "v1", Kind: "Agent",
+		References: []modelv1.IntegrationApiReferenceSpec{{Group: "model.skippy.io", Version: "v1", Kind: "ModelData", PropagateTemplates: true, PropagateTemplatePaths: []string{"embedded:/v1/[monitoring"}}},
+	}}}
+	_, err = (&IntegrationValidator{Mapper: newScopeMapper()}).ValidateCreate(context.Background(), invalid)
+	assert.ErrorContains(t, err, `reference to ModelData of Agent: invalid propagateTemplatePaths pattern "embedded:/v1/[monitoring"`)
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	NameCollisionReason = "NameCollision"
+	NameCollisionEvent  = modelv1.EventReasonNameCollision
+)
+
+// NameCollisionError is returned when rendered dependents have the names of
+// objects that are controlled by another resource or managed by another tool.
+type NameCollisionError struct {
+	Collisions []string
+}
+
+func (e *NameCollisionError) Error() string {
+	return fmt.Sprintf("%d dependent(s) collide with objects owned by other resources or managed by other tools: %s", len(e.Collisions), strings.Join(e.Collisions, "; "))
+}
+
+// checkNameCollisions verifies that no rendered dependent would take over an
+// object controlled by another resource, e.g. when two CRs or two integrations
+// render the same name. It runs before anything is applied, so that two
+// targets do not keep overwriting each other's dependents.
+func (r *GenericReconciler) checkNameCollisions(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	var collisions []string
+	for _, obj := range objs {
+		existing, err := rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error getting resource %s %s/%s: %w", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		owner := metav1.GetControllerOf(existing)
+		if owner == nil {
+			// Objects that another tool manages, e.g. Helm releases, are
+			// only adopted if they are annotated, see AdoptionPolicy.
+			if refused := r.adoptionRefused(existing, target); refused != "" {
+				log.Info("Dependent name is taken", "kind", obj.GetKind(), "name", obj.GetName(), "reason", refused)
+				collisions = append(collisions, fmt.Sprintf("%s %s %s", obj.GetKind(), namespacedName(obj), refused))
+			}
+			continue
+		}
+		if owner.UID == target.GetUID() {
+			continue
+		}
+		log.Info("Dependent name is taken", "kind", obj.GetKind(), "name", obj.GetName(), "ownerKind", owner.Kind, "ownerName", owner.Name)
+		collisions = append(collisions, fmt.Sprintf("%s %s is owned by %s %s", obj.GetKind(), namespacedName(obj), owner.Kind, owner.Name))
+	}
+	collision, err := r.dependentInventoryTaken(ctx, target, len(objs))
+	if err != nil {
+		return err
+	}
+	if collision != "" {
+		log.Info("Dependent inventory name is taken", "name", dependentInventoryName(target))
+		collisions = append(collisions, collision)
+	}
+	if len(collisions) > 0 {
+		return &NameCollisionError{Collisions: collisions}
+	}
+	return nil
+}
+
+func namespacedName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCheckNameCollisions(t *testing.T) {
+	target := newTestResource("mine", "default", eventTestGVK)
+	target.SetUID("target-uid")
+	isController := true
+
+	owned := func(name string, uid types.UID, ownerName string) *unstructured.Unstructured {
+		obj := newTestResource(name, "default", schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+		if uid != "" {
+			obj.SetOwnerReferences([]metav1.OwnerReference{{
+				APIVersion: "model.skippy.io/v1", Kind: eventTestGVK.Kind, Name: ownerName, UID: uid, Controller: &isController,
+			}})
+		}
+		return obj
+	}
+	helm := owned("helm", "", "")
+	helm.SetLabels(map[string]string{ManagedByLabel: "Helm"})
+	karo := owned("karo", "", "")
+	karo.SetLabels(map[string]string{ManagedByLabel: ManagedByValue})
+	live := map[string]*unstructured.Unstructured{
+		"ours":      owned("ours", "target-uid", "mine"),
+		"unowned":   owned("unowned", "", ""),
+		"theirs":    owned("theirs", "other-uid", "other"),
+		"helm":      helm,
+		"karo":      karo,
+		"forbidden": nil,
+	}
+	rc := &MockResourceClient{
+		GetFunc: func(_ context.Context, gvk schema.GroupVersionKind, _, name string) (*unstructured.Unstructured, error) {
+			obj, found := live[name]
+			if !found {
+				return nil, errors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+			}
+			if obj == nil {
+				return nil, errors.NewForbidden(schema.GroupResource{Resource: "services"}, name, stderrors.New("denied"))
+			}
+			return obj.DeepCopy(), nil
+		},
+	}
+	r := &GenericReconciler{}
+	rendered := func(names ...string) []*unstructured.Unstructured {
+		var objs []*unstructured.Unstructured
+		for _, name := range names {
+			objs = append(objs, owned(name, "", ""))
+		}
+		return objs
+	}
+
+	t.Run("own, unowned and new objects do not collide", func(t *testing.T) {
+		assert.NoError(t, r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("ours", "unowned", "karo", "new"), rc))
+	})
+
+	t.Run("objects controlled by another resource collide", func(t *testing.T) {
+		err := r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("ours", "theirs"), rc)
+		var collisionErr *NameCollisionError
+		require.True(t, stderrors.As(err, &collisionErr))
+		assert.Equal(t, []string{"Service default/theirs is owned by " + eventTestGVK.Kind + " other"}, collisionErr.Collisions)
+	})
+
+	t.Run("objects managed by another tool collide", func(t *testing.T) {
+		err := r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("helm"), rc)
+		var collisionErr *NameCollisionError
+		require.True(t, stderrors.As(err, &collisionErr))
+		assert.Equal(t, []string{"Service default/helm is managed by Helm"}, collisionErr.Collisions)
+	})
+
+	t.Run("lookup errors are returned", func(t *testing.T) {
+		err := r.checkNameCollisions(context.Background(), logr.Discard(), target, rendered("forbidden"), rc)
+		require.Error(t, err)
+		var collisionErr *NameCollisionError
+		assert.False(t, stderrors.As(err, &collisionErr))
+	})
+}
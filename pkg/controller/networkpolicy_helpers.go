@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// networkPolicyDiff compares the specs of two NetworkPolicy (or CNI specific
+// network policy) objects. The templates set policyTypes and port protocols
+// explicitly, so the API server defaults do not cause spurious diffs.
+func (r *GenericReconciler) networkPolicyDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	// Rendered manifests may carry plain ints while the API server returns int64.
+	normalizedExistingSpec := normalizeNumbersToInt64(existingSpec)
+	normalizedDesiredSpec := normalizeNumbersToInt64(desiredSpec)
+
+	if !reflect.DeepEqual(normalizedExistingSpec, normalizedDesiredSpec) {
+		diff := cmp.Diff(normalizedExistingSpec, normalizedDesiredSpec)
+		log.Info("Found a difference in the network policy spec", "kind", obj.GetKind(), "difference", diff)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestNetworkPolicy(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "NetworkPolicy",
+			"metadata": map[string]interface{}{
+				"name":      "test-sandbox-egress",
+				"namespace": "default",
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func TestNetworkPolicyDiff(t *testing.T) {
+	reconciler := &GenericReconciler{}
+	logger := testLogger()
+
+	baseSpec := func(port interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"podSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"app.kubernetes.io/instance": "test-sandbox"},
+			},
+			"policyTypes": []interface{}{"Egress"},
+			"egress": []interface{}{
+				map[string]interface{}{
+					"to": []interface{}{
+						map[string]interface{}{"ipBlock": map[string]interface{}{"cidr": "10.0.0.0/8"}},
+					},
+					"ports": []interface{}{
+						map[string]interface{}{"protocol": "TCP", "port": port},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		existing   *unstructured.Unstructured
+		desired    *unstructured.Unstructured
+		expectDiff bool
+	}{
+		{
+			name:       "identical specs with different integer types",
+			existing:   newTestNetworkPolicy(baseSpec(int64(443))),
+			desired:    newTestNetworkPolicy(baseSpec(443)),
+			expectDiff: false,
+		},
+		{
+			name:       "different port",
+			existing:   newTestNetworkPolicy(baseSpec(int64(443))),
+			desired:    newTestNetworkPolicy(baseSpec(8443)),
+			expectDiff: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := reconciler.networkPolicyDiff(tt.existing, tt.desired, logger)
+			if err != nil {
+				t.Fatalf("networkPolicyDiff() error = %v", err)
+			}
+			if diff != tt.expectDiff {
+				t.Errorf("networkPolicyDiff() = %v, want %v", diff, tt.expectDiff)
+			}
+		})
+	}
+
+	withoutSpec := newTestNetworkPolicy(nil)
+	delete(withoutSpec.Object, "spec")
+	if _, err := reconciler.networkPolicyDiff(withoutSpec, newTestNetworkPolicy(baseSpec(443)), logger); err == nil {
+		t.Error("networkPolicyDiff() should fail when the existing spec is missing")
+	}
+}
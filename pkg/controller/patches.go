@@ -0,0 +1,536 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// PatchedByAnnotation is set on objects changed by a patch template to
+	// the resource that patched them, see patchOwner.
+	PatchedByAnnotation = "model.skippy.io/patched-by"
+	// PatchRevertAnnotation holds the merge patch that reverts the patches
+	// applied to an object.
+	PatchRevertAnnotation = "model.skippy.io/patch-revert"
+	// PatchHashAnnotation holds the hash of the JSON patch last applied to
+	// an object.
+	PatchHashAnnotation = "model.skippy.io/patch-hash"
+
+	// patchRevertFinalizer holds the deletion of a resource until the
+	// patches it applied to existing objects are reverted.
+	patchRevertFinalizer = "model.skippy.io/revert-patches"
+
+	PatchConflictReason    = "PatchConflict"
+	PatchConflictEvent     = modelv1.EventReasonPatchConflict
+	ObjectPatchedEvent     = modelv1.EventReasonObjectPatched
+	PatchRevertedEvent     = modelv1.EventReasonPatchReverted
+	PatchRevertFailedEvent = modelv1.EventReasonPatchRevertFailed
+)
+
+// PatchConflictError is returned when patch templates name objects that are
+// already patched by another resource, and their conflict policy is Fail.
+type PatchConflictError struct {
+	Conflicts []string
+}
+
+func (e *PatchConflictError) Error() string {
+	return fmt.Sprintf("%d patch(es) target objects patched by other resources: %s", len(e.Conflicts), strings.Join(e.Conflicts, "; "))
+}
+
+// patchOwner identifies target in the PatchedByAnnotation of the objects it
+// patches, e.g. "Agent.model.skippy.io/team-a/llama".
+func patchOwner(target *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", target.GroupVersionKind().GroupKind().String(), target.GetNamespace(), target.GetName())
+}
+
+// splitPatches separates the rendered patches of existing objects from the
+// dependents.
+func splitPatches(objs []*unstructured.Unstructured) (dependents, patches []*unstructured.Unstructured) {
+	dependents = make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if transformer.IsPatch(obj) {
+			patches = append(patches, obj)
+		} else {
+			dependents = append(dependents, obj)
+		}
+	}
+	return dependents, patches
+}
+
+// patchKey identifies a patched object in status.patches.
+func patchKey(apiVersion, kind, namespace, name string) string {
+	return strings.Join([]string{apiVersion, kind, namespace, name}, "/")
+}
+
+func recordKey(record map[string]interface{}) string {
+	return patchKey(getStringValue(record, "apiVersion"), getStringValue(record, "kind"), getStringValue(record, "namespace"), getStringValue(record, "name"))
+}
+
+// recordedPatches returns status.patches of target.
+func recordedPatches(target *unstructured.Unstructured) []map[string]interface{} {
+	raw, _, _ := unstructured.NestedSlice(target.Object, "status", "patches")
+	records := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if record, ok := item.(map[string]interface{}); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func setRecordedPatches(target *unstructured.Unstructured, records []map[string]interface{}) error {
+	if len(records) == 0 {
+		unstructured.RemoveNestedField(target.Object, "status", "patches")
+		return nil
+	}
+	items := make([]interface{}, len(records))
+	for i, record := range records {
+		items[i] = record
+	}
+	return unstructured.SetNestedSlice(target.Object, items, "status", "patches")
+}
+
+// patchBody returns the patch that patch applies to the object it names.
+// Merge and strategic merge patches are the rendered object without the
+// fields that name it.
+func patchBody(patch *unstructured.Unstructured) (types.PatchType, map[string]interface{}, []interface{}) {
+	patchType := patch.GetAnnotations()[transformer.PatchTypeAnnotation]
+	if patchType == transformer.PatchTypeJSON {
+		operations, _ := patch.Object["patch"].([]interface{})
+		return types.JSONPatchType, nil, operations
+	}
+
+	body := runtime.DeepCopyJSON(patch.Object)
+	delete(body, "apiVersion")
+	delete(body, "kind")
+	if metadata, ok := body["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "name")
+		delete(metadata, "namespace")
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, transformer.PatchTypeAnnotation)
+			delete(annotations, transformer.PatchConflictPolicyAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+		if len(metadata) == 0 {
+			delete(body, "metadata")
+		}
+	}
+	if patchType == transformer.PatchTypeMerge {
+		return types.MergePatchType, body, nil
+	}
+	return types.StrategicMergePatchType, body, nil
+}
+
+// revertForMerge returns the merge patch that restores the fields of live
+// that body changes. Lists are restored as a whole.
+func revertForMerge(body, live map[string]interface{}) map[string]interface{} {
+	revert := map[string]interface{}{}
+	for key, value := range body {
+		// Directives of strategic merge patches, e.g. $patch.
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		liveValue, found := live[key]
+		if !found {
+			revert[key] = nil
+			continue
+		}
+		bodyMap, bodyIsMap := value.(map[string]interface{})
+		liveMap, liveIsMap := liveValue.(map[string]interface{})
+		if bodyIsMap && liveIsMap {
+			revert[key] = revertForMerge(bodyMap, liveMap)
+			continue
+		}
+		revert[key] = runtime.DeepCopyJSONValue(liveValue)
+	}
+	return revert
+}
+
+// revertForJSON returns the merge patch that restores the fields of live
+// that the JSON patch operations change. A change inside a list restores the
+// whole list.
+func revertForJSON(operations []interface{}, live map[string]interface{}) map[string]interface{} {
+	revert := map[string]interface{}{}
+	for _, item := range operations {
+		operation, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"path", "from"} {
+			pointer, ok := operation[field].(string)
+			if !ok || pointer == "" || (field == "from" && operation["op"] != "move") {
+				continue
+			}
+			segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+			for i, segment := range segments {
+				segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+			}
+			revertPointer(revert, live, segments)
+		}
+	}
+	return revert
+}
+
+func revertPointer(revert, live map[string]interface{}, segments []string) {
+	key := segments[0]
+	if existing, set := revert[key]; set {
+		if _, isMap := existing.(map[string]interface{}); !isMap {
+			// The whole value is restored already.
+			return
+		}
+	}
+	liveValue, found := live[key]
+	if !found {
+		revert[key] = nil
+		return
+	}
+	liveMap, isMap := liveValue.(map[string]interface{})
+	if len(segments) == 1 || !isMap {
+		revert[key] = runtime.DeepCopyJSONValue(liveValue)
+		return
+	}
+	sub, ok := revert[key].(map[string]interface{})
+	if !ok {
+		sub = map[string]interface{}{}
+		revert[key] = sub
+	}
+	revertPointer(sub, liveMap, segments[1:])
+}
+
+// mergeRevert combines the revert computed before a patch with the one
+// stored when the object was first patched. The recorded values win, as
+// they hold the fields from before any patch.
+func mergeRevert(current, recorded map[string]interface{}) map[string]interface{} {
+	merged := runtime.DeepCopyJSON(current)
+	for key, value := range recorded {
+		recordedMap, recordedIsMap := value.(map[string]interface{})
+		currentMap, currentIsMap := merged[key].(map[string]interface{})
+		if recordedIsMap && currentIsMap {
+			merged[key] = mergeRevert(currentMap, recordedMap)
+			continue
+		}
+		merged[key] = runtime.DeepCopyJSONValue(value)
+	}
+	return merged
+}
+
+// mergeApplied reports whether live already has every value of a merge
+// patch body, so that the periodic reconcile does not send it again.
+func mergeApplied(body, live map[string]interface{}) bool {
+	for key, value := range body {
+		liveValue, found := live[key]
+		if value == nil {
+			if found {
+				return false
+			}
+			continue
+		}
+		if bodyMap, ok := value.(map[string]interface{}); ok {
+			liveMap, ok := liveValue.(map[string]interface{})
+			if !ok || !mergeApplied(bodyMap, liveMap) {
+				return false
+			}
+			continue
+		}
+		// Compare the encoded values, as rendered numbers are decoded as
+		// floats and live ones as integers.
+		want, _ := json.Marshal(value)
+		got, _ := json.Marshal(liveValue)
+		if !found || !reflect.DeepEqual(want, got) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPatches applies the rendered patches to the existing objects they
+// name, and lists them in status.patches. Objects whose patches are no longer
+// rendered are reverted. While objects are listed, the patchRevertFinalizer
+// holds the deletion of the target, so that they can be reverted.
+func (r *GenericReconciler) applyPatches(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, patches []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	recorded := map[string]map[string]interface{}{}
+	for _, record := range recordedPatches(target) {
+		recorded[recordKey(record)] = record
+	}
+	if len(patches) == 0 && len(recorded) == 0 {
+		return r.setPatchFinalizer(ctx, target, false)
+	}
+	// The finalizer is added before any object is patched.
+	if err := r.setPatchFinalizer(ctx, target, true); err != nil {
+		return err
+	}
+	owner := patchOwner(target)
+
+	var records []map[string]interface{}
+	var conflicts []string
+	var patchErr error
+	seen := map[string]bool{}
+	for _, patch := range patches {
+		gvk := patch.GroupVersionKind()
+		namespace := patch.GetNamespace()
+		if namespace == "" && !r.isClusterScoped(gvk) {
+			namespace = target.GetNamespace()
+		}
+		record := map[string]interface{}{"apiVersion": patch.GetAPIVersion(), "kind": patch.GetKind(), "name": patch.GetName()}
+		if namespace != "" {
+			record["namespace"] = namespace
+		}
+		key := recordKey(record)
+		seen[key] = true
+
+		claimed, err := r.applyPatch(ctx, log, target, owner, patch, namespace, rc)
+		var conflictErr *PatchConflictError
+		switch {
+		case stderrors.As(err, &conflictErr):
+			conflicts = append(conflicts, conflictErr.Conflicts...)
+		case err != nil && patchErr == nil:
+			patchErr = err
+		}
+		if claimed || recorded[key] != nil {
+			records = append(records, record)
+		}
+	}
+
+	// Revert the objects whose patches are no longer rendered.
+	for key, record := range recorded {
+		if seen[key] {
+			continue
+		}
+		if err := r.revertPatch(ctx, log, target, owner, record, rc); err != nil {
+			records = append(records, record)
+			if patchErr == nil {
+				patchErr = err
+			}
+		}
+	}
+
+	sortRecords(records)
+	if err := setRecordedPatches(target, records); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		if err := r.setPatchFinalizer(ctx, target, false); err != nil {
+			return err
+		}
+	}
+	if patchErr != nil {
+		return patchErr
+	}
+	if len(conflicts) > 0 {
+		err := &PatchConflictError{Conflicts: conflicts}
+		r.errorEventf(target, err, PatchConflictEvent, "Not patching objects for %s %s: %v", target.GetKind(), target.GetName(), err)
+		return err
+	}
+	return nil
+}
+
+// applyPatch applies one patch, and reports whether the object is claimed
+// by target. Before the object is changed, the merge patch that reverts it
+// is stored in its PatchRevertAnnotation, together with the claim, so that
+// it cannot get lost. The revert keeps the values from before the first
+// patch, also when an object is taken over from another resource.
+func (r *GenericReconciler) applyPatch(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, owner string, patch *unstructured.Unstructured, namespace string, rc modelv1.ResourceClientInterface) (bool, error) {
+	gvk := patch.GroupVersionKind()
+	name := patch.GetName()
+	live, err := rc.Get(ctx, gvk, namespace, name)
+	if errors.IsNotFound(err) {
+		return false, &ClassifiedError{Class: ExternalDependencyNotReady, Err: fmt.Errorf("%s %s/%s to patch does not exist", gvk.Kind, namespace, name)}
+	} else if err != nil {
+		return false, fmt.Errorf("error getting resource %s %s/%s: %w", gvk.String(), namespace, name, err)
+	}
+
+	patchedBy := live.GetAnnotations()[PatchedByAnnotation]
+	if patchedBy != "" && patchedBy != owner {
+		if patch.GetAnnotations()[transformer.PatchConflictPolicyAnnotation] != transformer.PatchConflictForce {
+			log.Info("Object to patch is patched by another resource", "kind", gvk.Kind, "name", name, "patchedBy", patchedBy)
+			return false, &PatchConflictError{Conflicts: []string{fmt.Sprintf("%s %s/%s is patched by %s", gvk.Kind, namespace, name, patchedBy)}}
+		}
+		log.Info("Taking over object patched by another resource", "kind", gvk.Kind, "name", name, "patchedBy", patchedBy)
+	}
+
+	patchType, body, operations := patchBody(patch)
+	var revert map[string]interface{}
+	if patchType == types.JSONPatchType {
+		revert = revertForJSON(operations, live.Object)
+	} else {
+		revert = revertForMerge(body, live.Object)
+	}
+	if previous, ok := live.GetAnnotations()[PatchRevertAnnotation]; ok {
+		var recorded map[string]interface{}
+		if err := json.Unmarshal([]byte(previous), &recorded); err == nil {
+			revert = mergeRevert(revert, recorded)
+		}
+	}
+	releaseOnRevert(revert)
+	revertData, err := json.Marshal(revert)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode the revert of %s %s/%s: %w", gvk.Kind, namespace, name, err)
+	}
+
+	if patchedBy != owner || live.GetAnnotations()[PatchRevertAnnotation] != string(revertData) {
+		claim, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{
+			PatchedByAnnotation:   owner,
+			PatchRevertAnnotation: string(revertData),
+		}}})
+		if err != nil {
+			return false, err
+		}
+		if _, err := rc.Patch(ctx, gvk, namespace, name, types.MergePatchType, claim); err != nil {
+			return false, fmt.Errorf("error claiming resource %s %s/%s: %w", gvk.String(), namespace, name, err)
+		}
+	} else if patchType != types.JSONPatchType && mergeApplied(body, live.Object) {
+		return true, nil
+	}
+
+	var data []byte
+	if patchType == types.JSONPatchType {
+		// JSON patches may not be idempotent, e.g. when they append to a
+		// list, so they are only applied again when they change.
+		encoded, encodeErr := json.Marshal(operations)
+		if encodeErr != nil {
+			return true, encodeErr
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256(encoded))
+		if live.GetAnnotations()[PatchHashAnnotation] == sum {
+			return true, nil
+		}
+		operations = append(operations, map[string]interface{}{
+			"op":    "add",
+			"path":  "/metadata/annotations/" + strings.ReplaceAll(PatchHashAnnotation, "/", "~1"),
+			"value": sum,
+		})
+		data, err = json.Marshal(operations)
+	} else {
+		data, err = json.Marshal(body)
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to encode the patch of %s %s/%s: %w", gvk.Kind, namespace, name, err)
+	}
+	patched, err := rc.Patch(ctx, gvk, namespace, name, patchType, data)
+	if err != nil {
+		r.errorEventf(target, err, DependentUpdateFailedEvent, "Failed to patch %s %s/%s for %s %s: %v", gvk.Kind, namespace, name, target.GetKind(), target.GetName(), err)
+		return true, fmt.Errorf("error patching resource %s %s/%s: %w", gvk.String(), namespace, name, err)
+	}
+	log.Info("Resource patched", "GVK", gvk, "name", name, "namespace", namespace)
+	recordDependentChange(ctx, "Patched", patched)
+	r.eventf(target, corev1.EventTypeNormal, ObjectPatchedEvent, "Patched %s %s/%s for %s %s", gvk.Kind, namespace, name, target.GetKind(), target.GetName())
+	return true, nil
+}
+
+// releaseOnRevert makes revert remove the annotations of the operator. If
+// it removes all annotations, they are removed already.
+func releaseOnRevert(revert map[string]interface{}) {
+	metadata, ok := revert["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		revert["metadata"] = metadata
+	}
+	if value, set := metadata["annotations"]; set && value == nil {
+		return
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+	for _, key := range []string{PatchedByAnnotation, PatchRevertAnnotation, PatchHashAnnotation} {
+		annotations[key] = nil
+	}
+}
+
+// revertPatch applies the revert stored on a patched object. Objects that
+// are gone or were taken over by another resource are left alone.
+func (r *GenericReconciler) revertPatch(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, owner string, record map[string]interface{}, rc modelv1.ResourceClientInterface) error {
+	gv, err := schema.ParseGroupVersion(getStringValue(record, "apiVersion"))
+	if err != nil {
+		return nil
+	}
+	gvk := gv.WithKind(getStringValue(record, "kind"))
+	namespace, name := getStringValue(record, "namespace"), getStringValue(record, "name")
+
+	live, err := rc.Get(ctx, gvk, namespace, name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting resource %s %s/%s: %w", gvk.String(), namespace, name, err)
+	}
+	if live.GetAnnotations()[PatchedByAnnotation] != owner {
+		log.Info("Not reverting object patched by another resource", "kind", gvk.Kind, "name", name)
+		return nil
+	}
+	revert, ok := live.GetAnnotations()[PatchRevertAnnotation]
+	if !ok {
+		revert = fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, PatchedByAnnotation)
+	}
+	if _, err := rc.Patch(ctx, gvk, namespace, name, types.MergePatchType, []byte(revert)); err != nil && !errors.IsNotFound(err) {
+		r.errorEventf(target, err, PatchRevertFailedEvent, "Failed to revert the patch of %s %s/%s for %s %s: %v", gvk.Kind, namespace, name, target.GetKind(), target.GetName(), err)
+		return fmt.Errorf("error reverting the patch of %s %s/%s: %w", gvk.String(), namespace, name, err)
+	}
+	log.Info("Patch reverted", "GVK", gvk, "name", name, "namespace", namespace)
+	r.eventf(target, corev1.EventTypeNormal, PatchRevertedEvent, "Reverted the patch of %s %s/%s for %s %s", gvk.Kind, namespace, name, target.GetKind(), target.GetName())
+	return nil
+}
+
+// revertPatches reverts every object patched by a target that is being
+// deleted, and releases its deletion.
+func (r *GenericReconciler) revertPatches(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	owner := patchOwner(target)
+	var remaining []map[string]interface{}
+	var revertErr error
+	for _, record := range recordedPatches(target) {
+		if err := r.revertPatch(ctx, log, target, owner, record, rc); err != nil {
+			remaining = append(remaining, record)
+			revertErr = err
+		}
+	}
+	if err := setRecordedPatches(target, remaining); err != nil {
+		return err
+	}
+	if revertErr != nil {
+		return revertErr
+	}
+	return r.setPatchFinalizer(ctx, target, false)
+}
+
+// setPatchFinalizer adds or removes the patchRevertFinalizer of target.
+func (r *GenericReconciler) setPatchFinalizer(ctx context.Context, target *unstructured.Unstructured, present bool) error {
+	if controllerutil.ContainsFinalizer(target, patchRevertFinalizer) == present {
+		return nil
+	}
+	return patchFinalizers(ctx, r.Client, target, func(obj client.Object) {
+		if present {
+			controllerutil.AddFinalizer(obj, patchRevertFinalizer)
+		} else {
+			controllerutil.RemoveFinalizer(obj, patchRevertFinalizer)
+		}
+	})
+}
+
+// sortRecords orders status.patches by object, so that the status does not
+// change with the order of the templates.
+func sortRecords(records []map[string]interface{}) {
+	sort.Slice(records, func(i, j int) bool {
+		return recordKey(records[i]) < recordKey(records[j])
+	})
+}
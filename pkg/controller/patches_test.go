@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+var serviceAccountGVK = schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}
+
+func newTestServiceAccount(name string, annotations map[string]string) *unstructured.Unstructured {
+	sa := &unstructured.Unstructured{}
+	sa.SetGroupVersionKind(serviceAccountGVK)
+	sa.SetName(name)
+	sa.SetNamespace("team-a")
+	sa.SetAnnotations(annotations)
+	return sa
+}
+
+// newTestPatch returns a rendered patch of the ServiceAccount name.
+func newTestPatch(name, patchType, policy string, fields map[string]interface{}) *unstructured.Unstructured {
+	patch := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(fields)}
+	patch.SetGroupVersionKind(serviceAccountGVK)
+	patch.SetName(name)
+	annotations := patch.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[transformer.PatchTypeAnnotation] = patchType
+	annotations[transformer.PatchConflictPolicyAnnotation] = policy
+	patch.SetAnnotations(annotations)
+	return patch
+}
+
+// newPatchReconciler returns a reconciler whose client holds targets, and a
+// ResourceClient that holds objs.
+func newPatchReconciler(t *testing.T, targets []*unstructured.Unstructured, objs ...runtime.Object) (*GenericReconciler, *ResourceClient) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(eventTestGVK, &unstructured.Unstructured{})
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, target := range targets {
+		builder = builder.WithObjects(target)
+	}
+	r := &GenericReconciler{Client: builder.Build(), Gvk: eventTestGVK, Recorder: record.NewFakeRecorder(20)}
+	return r, &ResourceClient{dynClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)}
+}
+
+func getTestTarget(t *testing.T, c client.Client, name string) *unstructured.Unstructured {
+	t.Helper()
+	target := &unstructured.Unstructured{}
+	target.SetGroupVersionKind(eventTestGVK)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "team-a", Name: name}, target))
+	return target
+}
+
+func TestRevertForMerge(t *testing.T) {
+	body := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"a": "2", "b": "new"}},
+		"spec":     map[string]interface{}{"ports": []interface{}{"x"}},
+		"$patch":   "merge",
+	}
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "sa", "annotations": map[string]interface{}{"a": "1"}},
+		"spec":     map[string]interface{}{"ports": []interface{}{"y"}, "other": true},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"a": "1", "b": nil}},
+		"spec":     map[string]interface{}{"ports": []interface{}{"y"}},
+	}, revertForMerge(body, live))
+}
+
+func TestRevertForJSON(t *testing.T) {
+	operations := []interface{}{
+		map[string]interface{}{"op": "add", "path": "/metadata/labels/team~1name", "value": "ml"},
+		map[string]interface{}{"op": "add", "path": "/spec/containers/0/args/-", "value": "--debug"},
+		map[string]interface{}{"op": "move", "from": "/spec/old", "path": "/spec/new"},
+	}
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "llama"}},
+		"spec":     map[string]interface{}{"containers": []interface{}{"c"}, "old": "value"},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"team/name": nil}},
+		"spec":     map[string]interface{}{"containers": []interface{}{"c"}, "old": "value", "new": nil},
+	}, revertForJSON(operations, live))
+}
+
+func TestMergeRevert(t *testing.T) {
+	current := map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{"a": "2", "b": nil}}}
+	recorded := map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{"a": "1"}}}
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"a": "1", "b": nil}},
+	}, mergeRevert(current, recorded), "the values from before the first patch win")
+}
+
+func TestApplyPatches(t *testing.T) {
+	ctx := context.Background()
+	llama := newTestResource("llama", "team-a", eventTestGVK)
+	gemma := newTestResource("gemma", "team-a", eventTestGVK)
+	r, rc := newPatchReconciler(t, []*unstructured.Unstructured{llama, gemma}, newTestServiceAccount("default", map[string]string{"team": "ml"}))
+	patch := func(policy string, value string) *unstructured.Unstructured {
+		return newTestPatch("default", transformer.PatchTypeMerge, policy, map[string]interface{}{
+			"metadata": map[string]interface{}{"annotations": map[string]interface{}{"team": "inference", "iam.gke.io/gcp-service-account": value}},
+		})
+	}
+	getSA := func() *unstructured.Unstructured {
+		sa, err := rc.Get(ctx, serviceAccountGVK, "team-a", "default")
+		require.NoError(t, err)
+		return sa
+	}
+
+	target := getTestTarget(t, r.Client, "llama")
+	require.NoError(t, r.applyPatches(ctx, logr.Discard(), target, []*unstructured.Unstructured{patch(transformer.PatchConflictFail, "llama@")}, rc))
+	annotations := getSA().GetAnnotations()
+	assert.Equal(t, "inference", annotations["team"])
+	assert.Equal(t, "llama@", annotations["iam.gke.io/gcp-service-account"])
+	assert.Equal(t, "TestResource.testing.karo.pkg.com/team-a/llama", annotations[PatchedByAnnotation])
+	assert.NotContains(t, annotations, transformer.PatchTypeAnnotation)
+	assert.Contains(t, getTestTarget(t, r.Client, "llama").GetFinalizers(), patchRevertFinalizer)
+	assert.Equal(t, []map[string]interface{}{{"apiVersion": "v1", "kind": "ServiceAccount", "namespace": "team-a", "name": "default"}}, recordedPatches(target))
+
+	// Applying the same patch again does not change the object.
+	resourceVersion := getSA().GetResourceVersion()
+	require.NoError(t, r.applyPatches(ctx, logr.Discard(), target, []*unstructured.Unstructured{patch(transformer.PatchConflictFail, "llama@")}, rc))
+	assert.Equal(t, resourceVersion, getSA().GetResourceVersion())
+
+	// Another resource conflicts, unless its policy is Force.
+	other := getTestTarget(t, r.Client, "gemma")
+	err := r.applyPatches(ctx, logr.Discard(), other, []*unstructured.Unstructured{patch(transformer.PatchConflictFail, "gemma@")}, rc)
+	var conflictErr *PatchConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, ValidationError, classifyError(err))
+	assert.Empty(t, recordedPatches(other))
+	assert.NotContains(t, getTestTarget(t, r.Client, "gemma").GetFinalizers(), patchRevertFinalizer)
+
+	require.NoError(t, r.applyPatches(ctx, logr.Discard(), other, []*unstructured.Unstructured{patch(transformer.PatchConflictForce, "gemma@")}, rc))
+	assert.Equal(t, "gemma@", getSA().GetAnnotations()["iam.gke.io/gcp-service-account"])
+
+	// The resource that lost the object does not revert it.
+	require.NoError(t, r.applyPatches(ctx, logr.Discard(), target, nil, rc))
+	assert.Equal(t, "gemma@", getSA().GetAnnotations()["iam.gke.io/gcp-service-account"])
+	assert.Empty(t, recordedPatches(target))
+	assert.NotContains(t, getTestTarget(t, r.Client, "llama").GetFinalizers(), patchRevertFinalizer)
+
+	// Deleting the resource that holds the object restores it as it was
+	// before the first patch.
+	require.NoError(t, r.revertPatches(ctx, logr.Discard(), other, rc))
+	assert.Equal(t, map[string]string{"team": "ml"}, getSA().GetAnnotations())
+	assert.Empty(t, recordedPatches(other))
+	assert.NotContains(t, getTestTarget(t, r.Client, "gemma").GetFinalizers(), patchRevertFinalizer)
+}
+
+func TestApplyPatchesMissingObject(t *testing.T) {
+	llama := newTestResource("llama", "team-a", eventTestGVK)
+	r, rc := newPatchReconciler(t, []*unstructured.Unstructured{llama})
+	target := getTestTarget(t, r.Client, "llama")
+
+	err := r.applyPatches(context.Background(), logr.Discard(), target, []*unstructured.Unstructured{
+		newTestPatch("default", transformer.PatchTypeMerge, transformer.PatchConflictFail, map[string]interface{}{}),
+	}, rc)
+	assert.Equal(t, ExternalDependencyNotReady, classifyError(err))
+	assert.Empty(t, recordedPatches(target))
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	ctx := context.Background()
+	llama := newTestResource("llama", "team-a", eventTestGVK)
+	sa := newTestServiceAccount("default", nil)
+	sa.SetLabels(map[string]string{"app": "web"})
+	require.NoError(t, unstructured.SetNestedStringSlice(sa.Object, []string{"pull"}, "imagePullSecrets"))
+	r, rc := newPatchReconciler(t, []*unstructured.Unstructured{llama}, sa)
+	target := getTestTarget(t, r.Client, "llama")
+
+	patch := newTestPatch("default", transformer.PatchTypeJSON, transformer.PatchConflictFail, map[string]interface{}{
+		"patch": []interface{}{
+			map[string]interface{}{"op": "add", "path": "/imagePullSecrets/-", "value": "registry"},
+			map[string]interface{}{"op": "add", "path": "/metadata/labels/model", "value": "llama"},
+		},
+	})
+	for i := 0; i < 2; i++ {
+		require.NoError(t, r.applyPatches(ctx, logr.Discard(), target, []*unstructured.Unstructured{patch}, rc))
+		live, err := rc.Get(ctx, serviceAccountGVK, "team-a", "default")
+		require.NoError(t, err)
+		secrets, _, _ := unstructured.NestedStringSlice(live.Object, "imagePullSecrets")
+		assert.Equal(t, []string{"pull", "registry"}, secrets, "an unchanged JSON patch is applied once")
+		assert.Equal(t, "llama", live.GetLabels()["model"])
+	}
+
+	require.NoError(t, r.revertPatches(ctx, logr.Discard(), target, rc))
+	live, err := rc.Get(ctx, serviceAccountGVK, "team-a", "default")
+	require.NoError(t, err)
+	secrets, _, _ := unstructured.NestedStringSlice(live.Object, "imagePullSecrets")
+	assert.Equal(t, []string{"pull"}, secrets)
+	assert.Equal(t, map[string]string{"app": "web"}, live.GetLabels())
+	assert.Empty(t, live.GetAnnotations())
+}
+
+func TestPatchBody(t *testing.T) {
+	patch := newTestPatch("default", transformer.PatchTypeStrategicMerge, transformer.PatchConflictFail, map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"model": "llama"}},
+	})
+	patch.SetNamespace("team-a")
+	patchType, body, operations := patchBody(patch)
+	assert.Equal(t, "application/strategic-merge-patch+json", string(patchType))
+	assert.Nil(t, operations)
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"metadata":{"labels":{"model":"llama"}}}`, string(data))
+}
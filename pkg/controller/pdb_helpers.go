@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podDisruptionBudgetDiff compares the disruption settings and selectors of
+// two PodDisruptionBudgets. minAvailable and maxUnavailable are int-or-string
+// values, so ints of any Go type compare equal, while percentages are
+// compared as strings.
+func (r *GenericReconciler) podDisruptionBudgetDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	normalizedExisting := normalizePodDisruptionBudgetSpec(existingSpec)
+	normalizedDesired := normalizePodDisruptionBudgetSpec(desiredSpec)
+	// The API server defaults unhealthyPodEvictionPolicy on some versions, so
+	// it only differs if the template sets it.
+	if _, ok := desiredSpec["unhealthyPodEvictionPolicy"]; !ok {
+		delete(normalizedExisting, "unhealthyPodEvictionPolicy")
+	}
+	if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+		log.Info("Found a difference in the PodDisruptionBudget spec", "difference", cmp.Diff(normalizedExisting, normalizedDesired))
+		return true, nil
+	}
+	return false, nil
+}
+
+// normalizePodDisruptionBudgetSpec returns the compared fields of a
+// PodDisruptionBudget spec.
+func normalizePodDisruptionBudgetSpec(spec map[string]interface{}) map[string]interface{} {
+	normalized := map[string]interface{}{
+		"selector": normalizeLabelSelector(spec["selector"]),
+	}
+	for _, field := range []string{"minAvailable", "maxUnavailable"} {
+		if value, ok := spec[field]; ok && value != nil {
+			normalized[field] = normalizeIntOrString(value)
+		}
+	}
+	if policy, ok := spec["unhealthyPodEvictionPolicy"].(string); ok {
+		normalized["unhealthyPodEvictionPolicy"] = policy
+	}
+	return normalized
+}
+
+// normalizeIntOrString converts the numbers of an int-or-string value to
+// int64 and leaves strings, e.g. percentages, unchanged.
+func normalizeIntOrString(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestPodDisruptionBudget(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "PodDisruptionBudget",
+		"metadata":   map[string]interface{}{"name": "vllm", "namespace": "default"},
+		"spec":       spec,
+	}}
+}
+
+func TestPodDisruptionBudgetDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	existing := func() map[string]interface{} {
+		return map[string]interface{}{
+			"maxUnavailable":             int64(1),
+			"unhealthyPodEvictionPolicy": "IfHealthyBudget",
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"app": "vllm"},
+				"matchExpressions": []interface{}{
+					map[string]interface{}{"key": "tier", "operator": "In", "values": []interface{}{"serving", "batch"}},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		desired    map[string]interface{}
+		expectDiff bool
+	}{
+		{
+			name: "equivalent specs",
+			desired: map[string]interface{}{
+				"maxUnavailable": 1,
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"app": "vllm"},
+					"matchExpressions": []interface{}{
+						map[string]interface{}{"key": "tier", "operator": "In", "values": []interface{}{"batch", "serving"}},
+					},
+				},
+			},
+		},
+		{
+			name:       "changed maxUnavailable",
+			desired:    map[string]interface{}{"maxUnavailable": 2, "selector": existing()["selector"]},
+			expectDiff: true,
+		},
+		{
+			name:       "percentage instead of a count",
+			desired:    map[string]interface{}{"maxUnavailable": "25%", "selector": existing()["selector"]},
+			expectDiff: true,
+		},
+		{
+			name:       "minAvailable instead of maxUnavailable",
+			desired:    map[string]interface{}{"minAvailable": 1, "selector": existing()["selector"]},
+			expectDiff: true,
+		},
+		{
+			name:       "changed selector",
+			desired:    map[string]interface{}{"maxUnavailable": 1, "selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "other"}}},
+			expectDiff: true,
+		},
+		{
+			name:       "unhealthy pod eviction policy set by the template",
+			desired:    map[string]interface{}{"maxUnavailable": 1, "selector": existing()["selector"], "unhealthyPodEvictionPolicy": "AlwaysAllow"},
+			expectDiff: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := r.podDisruptionBudgetDiff(newTestPodDisruptionBudget(existing()), newTestPodDisruptionBudget(tc.desired), testLogger())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDiff, diff)
+		})
+	}
+
+	t.Run("missing spec", func(t *testing.T) {
+		_, err := r.podDisruptionBudgetDiff(&unstructured.Unstructured{Object: map[string]interface{}{}}, newTestPodDisruptionBudget(existing()), testLogger())
+		assert.Error(t, err)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 
 	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -184,3 +185,85 @@ func extractSelector(spec map[string]interface{}, log logr.Logger) (map[string]s
 	}
 	return stringMatchLabels, nil
 }
+
+// prometheusMonitorDiff compares the specs of two Prometheus Operator
+// PodMonitors or ServiceMonitors. Selectors and target label lists are
+// compared regardless of their order, endpoints in order, with ports and
+// durations compared as strings.
+func (r *GenericReconciler) prometheusMonitorDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	normalizedExisting := normalizePrometheusMonitorSpec(existingSpec)
+	normalizedDesired := normalizePrometheusMonitorSpec(desiredSpec)
+	if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+		log.Info("Found a difference in the monitor spec", "kind", obj.GetKind(), "difference", cmp.Diff(normalizedExisting, normalizedDesired))
+		return true, nil
+	}
+	return false, nil
+}
+
+// normalizePrometheusMonitorSpec returns a normalized copy of a PodMonitor or
+// ServiceMonitor spec.
+func normalizePrometheusMonitorSpec(spec map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(spec))
+	for key, value := range spec {
+		switch key {
+		case "selector":
+			normalized[key] = normalizeLabelSelector(value)
+		case "namespaceSelector":
+			namespaceSelector := make(map[string]interface{})
+			if selectorData, ok := value.(map[string]interface{}); ok {
+				if anyNamespace, ok := selectorData["any"].(bool); ok && anyNamespace {
+					namespaceSelector["any"] = true
+				}
+				if names := sortedStrings(selectorData["matchNames"]); len(names) > 0 {
+					namespaceSelector["matchNames"] = names
+				}
+			}
+			normalized[key] = namespaceSelector
+		case "targetLabels", "podTargetLabels":
+			normalized[key] = sortedStrings(value)
+		case "endpoints", "podMetricsEndpoints":
+			endpointsList, _ := value.([]interface{})
+			endpoints := make([]interface{}, 0, len(endpointsList))
+			for _, endpointInterface := range endpointsList {
+				endpointData, ok := endpointInterface.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				endpoint := make(map[string]interface{}, len(endpointData))
+				for field, fieldValue := range endpointData {
+					switch field {
+					case "port", "targetPort", "path", "interval", "scrapeTimeout", "scheme":
+						endpoint[field] = fmt.Sprintf("%v", fieldValue)
+					default:
+						endpoint[field] = normalizeNumbersToInt64(copyJSONValue(fieldValue))
+					}
+				}
+				endpoints = append(endpoints, endpoint)
+			}
+			normalized[key] = endpoints
+		default:
+			normalized[key] = normalizeNumbersToInt64(copyJSONValue(value))
+		}
+	}
+	return normalized
+}
+
+// sortedStrings returns the items of a list as sorted strings.
+func sortedStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, fmt.Sprintf("%v", item))
+	}
+	sort.Strings(items)
+	return items
+}
@@ -213,3 +213,94 @@ func TestPodMonitoringDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestPrometheusMonitorDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	newMonitor := func(kind string, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "vllm", "namespace": "default"},
+			"spec":       spec,
+		}}
+	}
+	// The ServiceMonitor as returned by the API server.
+	existingSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"selector":          map[string]interface{}{"matchLabels": map[string]interface{}{"app": "vllm"}},
+			"namespaceSelector": map[string]interface{}{"matchNames": []interface{}{"ml", "default"}},
+			"targetLabels":      []interface{}{"model", "app"},
+			"endpoints": []interface{}{
+				map[string]interface{}{"port": "metrics", "interval": "30s", "path": "/metrics"},
+				map[string]interface{}{"targetPort": int64(9090), "honorLabels": true},
+			},
+			"sampleLimit": int64(1000),
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		mutate     func(spec map[string]interface{})
+		expectDiff bool
+	}{
+		{name: "equivalent specs", mutate: func(spec map[string]interface{}) {
+			spec["namespaceSelector"] = map[string]interface{}{"matchNames": []interface{}{"default", "ml"}}
+			spec["targetLabels"] = []interface{}{"app", "model"}
+			spec["endpoints"].([]interface{})[1].(map[string]interface{})["targetPort"] = 9090
+			spec["sampleLimit"] = 1000
+		}},
+		{name: "changed interval", mutate: func(spec map[string]interface{}) {
+			spec["endpoints"].([]interface{})[0].(map[string]interface{})["interval"] = "15s"
+		}, expectDiff: true},
+		{name: "reordered endpoints", mutate: func(spec map[string]interface{}) {
+			endpoints := spec["endpoints"].([]interface{})
+			endpoints[0], endpoints[1] = endpoints[1], endpoints[0]
+		}, expectDiff: true},
+		{name: "changed selector", mutate: func(spec map[string]interface{}) {
+			spec["selector"] = map[string]interface{}{"matchLabels": map[string]interface{}{"app": "other"}}
+		}, expectDiff: true},
+		{name: "any namespace", mutate: func(spec map[string]interface{}) {
+			spec["namespaceSelector"] = map[string]interface{}{"any": true}
+		}, expectDiff: true},
+		{name: "removed sample limit", mutate: func(spec map[string]interface{}) {
+			delete(spec, "sampleLimit")
+		}, expectDiff: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			desired := existingSpec()
+			tc.mutate(desired)
+			diff, err := r.prometheusMonitorDiff(newMonitor("ServiceMonitor", existingSpec()), newMonitor("ServiceMonitor", desired), testLogger())
+			if err != nil {
+				t.Fatalf("prometheusMonitorDiff() error = %v", err)
+			}
+			if diff != tc.expectDiff {
+				t.Errorf("prometheusMonitorDiff() = %v, want %v", diff, tc.expectDiff)
+			}
+		})
+	}
+
+	t.Run("pod monitor endpoints", func(t *testing.T) {
+		existing := newMonitor("PodMonitor", map[string]interface{}{
+			"selector":            map[string]interface{}{"matchLabels": map[string]interface{}{"app": "vllm"}},
+			"podMetricsEndpoints": []interface{}{map[string]interface{}{"port": "metrics"}},
+			"podTargetLabels":     []interface{}{"model"},
+		})
+		desired := newMonitor("PodMonitor", map[string]interface{}{
+			"selector":            map[string]interface{}{"matchLabels": map[string]interface{}{"app": "vllm"}},
+			"podMetricsEndpoints": []interface{}{map[string]interface{}{"port": "http"}},
+			"podTargetLabels":     []interface{}{"model"},
+		})
+		diff, err := r.prometheusMonitorDiff(existing, desired, testLogger())
+		if err != nil || !diff {
+			t.Errorf("prometheusMonitorDiff() = %v, %v, want a diff", diff, err)
+		}
+	})
+
+	t.Run("missing spec", func(t *testing.T) {
+		if _, err := r.prometheusMonitorDiff(newMonitor("PodMonitor", existingSpec()), &unstructured.Unstructured{Object: map[string]interface{}{}}, testLogger()); err == nil {
+			t.Error("prometheusMonitorDiff() error = nil, want an error")
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package controller
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	PolicyViolationConditionType = "PolicyViolation"
+	PolicyViolatedReason         = "PolicyViolated"
+	PoliciesSatisfiedReason      = "PoliciesSatisfied"
+	PolicyViolationEvent         = modelv1.EventReasonPolicyViolation
+
+	// PolicyScopeObject rules are evaluated against each rendered object,
+	// and PolicyScopePodSpec rules against each pod spec of the workloads.
+	PolicyScopeObject  = "Object"
+	PolicyScopePodSpec = "PodSpec"
+
+	// PolicyActionDeny violations keep the dependents from being applied,
+	// while PolicyActionWarn violations are only recorded as events.
+	PolicyActionDeny = "deny"
+	PolicyActionWarn = "warn"
+)
+
+//go:embed policies/bundled.yaml
+var bundledPolicies []byte
+
+// PolicyViolation is a rendered object that violates a policy rule.
+type PolicyViolation struct {
+	Rule    string
+	Kind    string
+	Name    string
+	Message string
+	// Warn is set for violations that do not keep the dependents from
+	// being applied.
+	Warn bool
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s: %s %s: %s", v.Rule, v.Kind, v.Name, v.Message)
+}
+
+// PolicyEvaluator evaluates the rendered dependents of a target against
+// policies before they are applied. Policies implements it for the rules of
+// policy files; other engines, e.g. for Rego or CEL policies, can be added to
+// PolicyChecker.Evaluators.
+type PolicyEvaluator interface {
+	Evaluate(ctx context.Context, objs []*unstructured.Unstructured) ([]PolicyViolation, error)
+}
+
+// PolicyViolationError is returned when rendered dependents violate policy
+// rules, so that they are not applied.
+type PolicyViolationError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyViolationError) Error() string {
+	violations := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		violations = append(violations, violation.String())
+	}
+	return fmt.Sprintf("%d policy violation(s): %s", len(e.Violations), strings.Join(violations, "; "))
+}
+
+// PolicyRule is a constraint on rendered objects, in the spirit of a
+// Gatekeeper constraint: an object violates it when the JSONPath expression
+// of Deny selects a value other than false or an empty one.
+type PolicyRule struct {
+	Name string `json:"name"`
+	// Message explains the violation, e.g. "containers must not run
+	// privileged". The selected values are appended to it.
+	Message string `json:"message,omitempty"`
+	// Kinds limits the rule to objects of these kinds. Rules apply to all
+	// kinds if it is empty.
+	Kinds []string `json:"kinds,omitempty"`
+	// Scope is Object (the default) or PodSpec.
+	Scope string `json:"scope,omitempty"`
+	// Deny is a JSONPath expression, e.g.
+	// "{.containers[?(@.securityContext.privileged==true)].name}".
+	Deny string `json:"deny"`
+	// EnforcementAction is deny (the default) or warn.
+	EnforcementAction string `json:"enforcementAction,omitempty"`
+
+	deny *jsonpath.JSONPath
+}
+
+// Policies are the rules of policy files.
+type Policies struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+var _ PolicyEvaluator = &Policies{}
+
+// ParsePolicies reads the rules of a YAML or JSON policy file.
+func ParsePolicies(data []byte) (*Policies, error) {
+	policies := &Policies{}
+	if err := yaml.UnmarshalStrict(data, policies); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %w", err)
+	}
+	names := map[string]bool{}
+	for i := range policies.Rules {
+		rule := &policies.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("policy rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate policy rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Scope {
+		case "":
+			rule.Scope = PolicyScopeObject
+		case PolicyScopeObject, PolicyScopePodSpec:
+		default:
+			return nil, fmt.Errorf("policy rule %q: invalid scope %q", rule.Name, rule.Scope)
+		}
+		switch rule.EnforcementAction {
+		case "":
+			rule.EnforcementAction = PolicyActionDeny
+		case PolicyActionDeny, PolicyActionWarn:
+		default:
+			return nil, fmt.Errorf("policy rule %q: invalid enforcement action %q", rule.Name, rule.EnforcementAction)
+		}
+		expression := rule.Deny
+		if !strings.HasPrefix(expression, "{") {
+			expression = "{" + expression + "}"
+		}
+		rule.deny = jsonpath.New(rule.Name).AllowMissingKeys(true)
+		if err := rule.deny.Parse(expression); err != nil {
+			return nil, fmt.Errorf("policy rule %q: invalid JSONPath %q: %w", rule.Name, rule.Deny, err)
+		}
+	}
+	return policies, nil
+}
+
+// BundledPolicies returns the policies bundled with the operator, which
+// reject privileged containers, hostPath volumes and pods in the host's
+// namespaces.
+func BundledPolicies() *Policies {
+	policies, err := ParsePolicies(bundledPolicies)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled policies: %v", err))
+	}
+	return policies
+}
+
+// Evaluate implements PolicyEvaluator.
+func (p *Policies) Evaluate(_ context.Context, objs []*unstructured.Unstructured) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+	for _, obj := range objs {
+		for i := range p.Rules {
+			rule := &p.Rules[i]
+			if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, obj.GetKind()) {
+				continue
+			}
+			scopes := []interface{}{obj.Object}
+			if rule.Scope == PolicyScopePodSpec {
+				scopes = nil
+				for _, path := range transformer.PodSpecPaths(obj.GetKind()) {
+					if podSpec, found, _ := unstructured.NestedMap(obj.Object, path...); found {
+						scopes = append(scopes, podSpec)
+					}
+				}
+			}
+			var denied []string
+			for _, scope := range scopes {
+				values, err := rule.denied(scope)
+				if err != nil {
+					return nil, fmt.Errorf("policy rule %q on %s %s: %w", rule.Name, obj.GetKind(), obj.GetName(), err)
+				}
+				denied = append(denied, values...)
+			}
+			if len(denied) == 0 {
+				continue
+			}
+			message := rule.Message
+			if message == "" {
+				message = "denied"
+			}
+			violations = append(violations, PolicyViolation{
+				Rule:    rule.Name,
+				Kind:    obj.GetKind(),
+				Name:    obj.GetName(),
+				Message: fmt.Sprintf("%s (%s)", message, strings.Join(denied, ", ")),
+				Warn:    rule.EnforcementAction == PolicyActionWarn,
+			})
+		}
+	}
+	return violations, nil
+}
+
+// denied returns the values that the Deny expression of the rule selects in
+// obj, without false and empty ones.
+func (rule *PolicyRule) denied(obj interface{}) ([]string, error) {
+	results, err := rule.deny.FindResults(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate JSONPath %q: %w", rule.Deny, err)
+	}
+	var denied []string
+	for _, result := range results {
+		for _, value := range result {
+			if !value.IsValid() || !value.CanInterface() {
+				continue
+			}
+			switch v := value.Interface().(type) {
+			case nil:
+			case bool:
+				if v {
+					denied = append(denied, "true")
+				}
+			case string:
+				if v != "" {
+					denied = append(denied, v)
+				}
+			case map[string]interface{}:
+				if len(v) > 0 {
+					denied = append(denied, "{...}")
+				}
+			case []interface{}:
+				if len(v) > 0 {
+					denied = append(denied, "[...]")
+				}
+			default:
+				denied = append(denied, fmt.Sprint(v))
+			}
+		}
+	}
+	return denied, nil
+}
+
+// PolicyChecker evaluates the rendered dependents of all targets against
+// policies before they are applied.
+type PolicyChecker struct {
+	// Evaluators are always evaluated, e.g. BundledPolicies.
+	Evaluators []PolicyEvaluator
+
+	mu sync.Mutex
+	// loaded are the policies of the ConfigMap of a PolicyLoader.
+	loaded []PolicyEvaluator
+}
+
+// SetLoadedPolicies replaces the policies that are evaluated in addition to
+// the Evaluators.
+func (c *PolicyChecker) SetLoadedPolicies(policies []PolicyEvaluator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = policies
+}
+
+// evaluators returns the Evaluators and the loaded policies.
+func (c *PolicyChecker) evaluators() []PolicyEvaluator {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append(append([]PolicyEvaluator{}, c.Evaluators...), c.loaded...)
+}
+
+// PolicyRefreshInterval is how often the policy ConfigMap is read again.
+// Resources are checked against a change at their next reconcile.
+const PolicyRefreshInterval = time.Minute
+
+// PolicyLoader keeps the policies of a PolicyChecker in sync with a
+// ConfigMap that cluster admins manage, with a policy file under each key.
+type PolicyLoader struct {
+	// Reader reads the ConfigMap. It should not be the cached client, so that
+	// the operator does not watch every ConfigMap of the cluster.
+	Reader    client.Reader
+	ConfigMap types.NamespacedName
+	Checker   *PolicyChecker
+	// Interval overrides PolicyRefreshInterval, e.g. in tests.
+	Interval time.Duration
+
+	loaded map[string]string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica renders resources.
+func (l *PolicyLoader) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reads the ConfigMap until ctx is done.
+func (l *PolicyLoader) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("configMap", l.ConfigMap.String())
+	interval := l.Interval
+	if interval <= 0 {
+		interval = PolicyRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Sync(ctx); err != nil {
+			// The previous policies stay in effect.
+			logger.Error(err, "Failed to load policies")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reads the ConfigMap and passes its policies to the checker if they
+// changed. A ConfigMap that does not exist has no policies.
+func (l *PolicyLoader) Sync(ctx context.Context) error {
+	configMap := &corev1.ConfigMap{}
+	err := l.Reader.Get(ctx, l.ConfigMap, configMap)
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("failed to get ConfigMap %s: %w", l.ConfigMap, err)
+	}
+	data := configMap.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	if l.loaded != nil && reflect.DeepEqual(data, l.loaded) {
+		return nil
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	policies := make([]PolicyEvaluator, 0, len(keys))
+	rules := 0
+	for _, key := range keys {
+		parsed, err := ParsePolicies([]byte(data[key]))
+		if err != nil {
+			return fmt.Errorf("ConfigMap %s, key %s: %w", l.ConfigMap, key, err)
+		}
+		policies = append(policies, parsed)
+		rules += len(parsed.Rules)
+	}
+	log.FromContext(ctx).Info("Policies changed", "configMap", l.ConfigMap.String(), "rules", rules)
+	l.loaded = data
+	l.Checker.SetLoadedPolicies(policies)
+	return nil
+}
+
+// checkPolicies evaluates the rendered dependents against the policies of
+// r.Policies before anything is applied, so that misconfigured templates,
+// e.g. with privileged pods or hostPath mounts, are caught before admission
+// rejects them or, worse, lets them in. Violations of deny rules are
+// reported in the PolicyViolation condition of the target and returned as a
+// *PolicyViolationError; violations of warn rules are only recorded as
+// events.
+func (r *GenericReconciler) checkPolicies(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured) error {
+	if r.Policies == nil {
+		return nil
+	}
+	var denied, warned []PolicyViolation
+	for _, evaluator := range r.Policies.evaluators() {
+		violations, err := evaluator.Evaluate(ctx, objs)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate policies: %w", err)
+		}
+		for _, violation := range violations {
+			if violation.Warn {
+				warned = append(warned, violation)
+			} else {
+				denied = append(denied, violation)
+			}
+		}
+	}
+
+	existing := meta.FindStatusCondition(targetConditions(target), PolicyViolationConditionType)
+	if len(denied) == 0 && len(warned) == 0 && existing == nil {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               PolicyViolationConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             PoliciesSatisfiedReason,
+		Message:            "All dependents satisfy the policies.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(warned) > 0 {
+		warnings := make([]string, 0, len(warned))
+		for _, violation := range warned {
+			warnings = append(warnings, violation.String())
+		}
+		condition.Message = fmt.Sprintf("All dependents satisfy the enforced policies, with %d warning(s): %s", len(warned), strings.Join(warnings, "; "))
+	}
+	var policyErr *PolicyViolationError
+	if len(denied) > 0 {
+		policyErr = &PolicyViolationError{Violations: denied}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = PolicyViolatedReason
+		condition.Message = fmt.Sprintf("Not applying dependents: %v", policyErr)
+	}
+	if existing == nil || existing.Status != condition.Status || existing.Message != condition.Message {
+		if policyErr != nil {
+			r.errorEventf(target, policyErr, PolicyViolationEvent, "Not applying dependents of %s %s: %v", target.GetKind(), target.GetName(), policyErr)
+		} else if len(warned) > 0 {
+			log.Info("Dependents violate policy rules in warn mode", "violations", len(warned))
+			r.eventf(target, corev1.EventTypeWarning, PolicyViolationEvent, "%s", condition.Message)
+		}
+	}
+	if err := setTargetCondition(target, condition); err != nil {
+		return err
+	}
+	if policyErr != nil {
+		return policyErr
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestPolicyObjects() []*unstructured.Unstructured {
+	return []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "server", "securityContext": map[string]interface{}{"privileged": true}},
+					map[string]interface{}{"name": "sidecar", "securityContext": map[string]interface{}{"privileged": false}},
+				},
+				"volumes": []interface{}{
+					map[string]interface{}{"name": "weights", "hostPath": map[string]interface{}{"path": "/mnt/weights"}},
+					map[string]interface{}{"name": "scratch", "emptyDir": map[string]interface{}{}},
+				},
+			}}},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "batch/v1",
+			"kind":       "Job",
+			"metadata":   map[string]interface{}{"name": "download", "namespace": "default"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"hostNetwork": true,
+				"containers":  []interface{}{map[string]interface{}{"name": "download"}},
+			}}},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec":       map[string]interface{}{"type": "LoadBalancer"},
+		}},
+	}
+}
+
+func TestBundledPolicies(t *testing.T) {
+	violations, err := BundledPolicies().Evaluate(context.Background(), newTestPolicyObjects())
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyViolation{
+		{Rule: "privileged-containers", Kind: "Deployment", Name: "llama", Message: "containers must not run privileged (server)"},
+		{Rule: "host-path-volumes", Kind: "Deployment", Name: "llama", Message: "pods must not mount hostPath volumes (weights)"},
+		{Rule: "host-namespaces", Kind: "Job", Name: "download", Message: "pods must not share the host's network, PID or IPC namespace (true)"},
+	}, violations)
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies([]byte(`
+rules:
+- name: no-load-balancers
+  kinds: [Service]
+  deny: .spec.type
+  enforcementAction: warn
+`))
+	require.NoError(t, err)
+	require.Len(t, policies.Rules, 1)
+	assert.Equal(t, PolicyScopeObject, policies.Rules[0].Scope)
+	violations, err := policies.Evaluate(context.Background(), newTestPolicyObjects())
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyViolation{{Rule: "no-load-balancers", Kind: "Service", Name: "llama", Message: "denied (LoadBalancer)", Warn: true}}, violations)
+
+	for policy, expected := range map[string]string{
+		"rules:\n- deny: .spec": "policy rule 0 has no name",
+		"rules:\n- {name: a, deny: .spec}\n- {name: a, deny: .spec}":  `duplicate policy rule "a"`,
+		"rules:\n- {name: a, deny: .spec, scope: Pod}":                `invalid scope "Pod"`,
+		"rules:\n- {name: a, deny: .spec, enforcementAction: dryrun}": `invalid enforcement action "dryrun"`,
+		"rules:\n- {name: a, deny: '.spec[?('}":                       "invalid JSONPath",
+		"rules:\n- {name: a, deny: .spec, severity: high}":            "unknown field",
+	} {
+		_, err := ParsePolicies([]byte(policy))
+		assert.ErrorContains(t, err, expected, policy)
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder, Policies: &PolicyChecker{Evaluators: []PolicyEvaluator{BundledPolicies()}}}
+	target := newTestResource("llama", "default", eventTestGVK)
+
+	err := r.checkPolicies(context.Background(), logr.Discard(), target, newTestPolicyObjects())
+	var policyErr *PolicyViolationError
+	require.True(t, stderrors.As(err, &policyErr))
+	assert.Len(t, policyErr.Violations, 3)
+	assert.Equal(t, ValidationError, classifyError(err))
+
+	condition := meta.FindStatusCondition(targetConditions(target), PolicyViolationConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, PolicyViolatedReason, condition.Reason)
+	assert.Contains(t, condition.Message, "Not applying dependents: 3 policy violation(s): privileged-containers: Deployment llama: containers must not run privileged (server); ")
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning PolicyViolation")
+
+	// The event is only recorded when the violations change.
+	require.Error(t, r.checkPolicies(context.Background(), logr.Discard(), target, newTestPolicyObjects()))
+	assert.Empty(t, recorder.Events)
+
+	conditions, err := (&GenericReconciler{}).buildConditions(context.Background(), newTestResource("llama", "default", eventTestGVK), true, policyErr)
+	require.NoError(t, err)
+	require.Len(t, conditions, 1)
+	assert.Equal(t, PolicyViolatedReason, conditions[0].(map[string]interface{})["reason"])
+
+	// Warnings do not keep the dependents from being applied.
+	warnings, err := ParsePolicies([]byte("rules:\n- {name: no-load-balancers, kinds: [Service], deny: .spec.type, enforcementAction: warn}"))
+	require.NoError(t, err)
+	r.Policies = &PolicyChecker{Evaluators: []PolicyEvaluator{warnings}}
+	require.NoError(t, r.checkPolicies(context.Background(), logr.Discard(), target, newTestPolicyObjects()))
+	condition = meta.FindStatusCondition(targetConditions(target), PolicyViolationConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, PoliciesSatisfiedReason, condition.Reason)
+	assert.Equal(t, "All dependents satisfy the enforced policies, with 1 warning(s): no-load-balancers: Service llama: denied (LoadBalancer)", condition.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning PolicyViolation")
+
+	// Targets without violations get no condition.
+	other := newTestResource("agent", "default", eventTestGVK)
+	r.Policies = &PolicyChecker{Evaluators: []PolicyEvaluator{BundledPolicies()}}
+	require.NoError(t, r.checkPolicies(context.Background(), logr.Discard(), other, newTestPolicyObjects()[2:]))
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), PolicyViolationConditionType))
+}
+
+func TestPolicyLoader(t *testing.T) {
+	ctx := context.Background()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "karo-system", Name: "karo-policies"},
+		Data:       map[string]string{"services.yaml": "rules:\n- {name: no-load-balancers, kinds: [Service], deny: .spec.type}"},
+	}
+	c := fake.NewClientBuilder().WithObjects(configMap).Build()
+	checker := &PolicyChecker{Evaluators: []PolicyEvaluator{BundledPolicies()}}
+	loader := &PolicyLoader{Reader: c, ConfigMap: types.NamespacedName{Namespace: "karo-system", Name: "karo-policies"}, Checker: checker}
+
+	require.NoError(t, loader.Sync(ctx))
+	require.Len(t, checker.evaluators(), 2)
+	violations, err := checker.evaluators()[1].Evaluate(ctx, newTestPolicyObjects())
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "no-load-balancers", violations[0].Rule)
+
+	// Invalid policies keep the previous ones.
+	configMap.Data = map[string]string{"services.yaml": "rules:\n- {deny: .spec.type}"}
+	require.NoError(t, c.Update(ctx, configMap))
+	assert.ErrorContains(t, loader.Sync(ctx), "ConfigMap karo-system/karo-policies, key services.yaml")
+	assert.Len(t, checker.evaluators(), 2)
+
+	// Deleting the ConfigMap removes its policies.
+	require.NoError(t, c.Delete(ctx, configMap))
+	require.NoError(t, loader.Sync(ctx))
+	assert.Len(t, checker.evaluators(), 1)
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// PreflightMode controls whether rendered dependents are validated with a
+// server-side dry-run before they are applied.
+type PreflightMode string
+
+const (
+	// PreflightOff applies rendered dependents without a dry-run.
+	PreflightOff PreflightMode = "off"
+	// PreflightReport dry-runs every dependent and reports the result in
+	// status.preflight, but applies the dependents regardless.
+	PreflightReport PreflightMode = "report"
+	// PreflightEnforce applies the dependents only if all of them pass the
+	// dry-run.
+	PreflightEnforce PreflightMode = "enforce"
+	// PreflightOnly never applies anything. It lets CI render new template
+	// versions against a live cluster and gate on status.preflight.
+	PreflightOnly PreflightMode = "only"
+
+	PreflightFailedReason = "PreflightFailed"
+	PreflightFailedEvent  = modelv1.EventReasonPreflightFailed
+	// PreflightOnlyReason is the reason of the Unknown Ready condition of
+	// targets whose dependents passed the preflight in PreflightOnly mode.
+	PreflightOnlyReason = "PreflightOnly"
+
+	// maxPreflightMutations caps the mutated paths reported per dependent.
+	maxPreflightMutations = 20
+)
+
+// ParsePreflightMode validates a preflight flag value.
+func ParsePreflightMode(value string) (PreflightMode, error) {
+	switch PreflightMode(value) {
+	case "", PreflightOff:
+		return PreflightOff, nil
+	case PreflightReport, PreflightEnforce, PreflightOnly:
+		return PreflightMode(value), nil
+	}
+	return "", fmt.Errorf("invalid preflight mode %q (must be '%s', '%s', '%s' or '%s')", value, PreflightOff, PreflightReport, PreflightEnforce, PreflightOnly)
+}
+
+// PreflightError is returned when the API server rejects rendered dependents
+// in the dry-run.
+type PreflightError struct {
+	Failed []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("server-side dry-run rejected %d dependent(s): %s", len(e.Failed), strings.Join(e.Failed, "; "))
+}
+
+// preflight applies every rendered dependent with dry-run=server and returns
+// the PreflightReport stored in status.preflight. For each dependent it lists
+// the fields that admission changed from the rendered values, and whether the
+// dependent differs from the live object, so that a new template version can
+// be reviewed before it mutates live workloads.
+func (r *GenericReconciler) preflight(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured) (map[string]interface{}, error) {
+	var results []interface{}
+	var failed []string
+	for _, obj := range objs {
+		result := map[string]interface{}{
+			"kind":      obj.GetKind(),
+			"name":      obj.GetName(),
+			"namespace": obj.GetNamespace(),
+		}
+		response, live, err := r.dryRun(ctx, obj)
+		if err != nil {
+			log.Info("Dependent failed the server-side dry-run", "kind", obj.GetKind(), "name", obj.GetName(), "error", err.Error())
+			result["result"] = "Invalid"
+			result["error"] = err.Error()
+			failed = append(failed, fmt.Sprintf("%s %s: %v", obj.GetKind(), obj.GetName(), err))
+			results = append(results, result)
+			continue
+		}
+		result["result"] = "Valid"
+		mutations := mutatedPaths(obj.Object, response.Object)
+		if len(mutations) > maxPreflightMutations {
+			mutations = append(mutations[:maxPreflightMutations], "...")
+		}
+		if len(mutations) > 0 {
+			result["mutations"] = stringsToInterfaces(mutations)
+		}
+		result["changesLive"] = live == nil || changesLive(live, response)
+		results = append(results, result)
+	}
+
+	report := map[string]interface{}{
+		"observedGeneration": target.GetGeneration(),
+		"passed":             len(failed) == 0,
+		"resources":          results,
+	}
+	if len(failed) > 0 {
+		return report, &PreflightError{Failed: failed}
+	}
+	return report, nil
+}
+
+// dryRun creates or updates a copy of obj with dry-run=server and returns the
+// object the API server would store, along with the live object, if any.
+func (r *GenericReconciler) dryRun(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, *unstructured.Unstructured, error) {
+	normalizeNumbersToInt64(obj.Object)
+	request := obj.DeepCopy()
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	switch {
+	case errors.IsNotFound(err):
+		if err := r.Client.Create(ctx, request, client.DryRunAll); err != nil {
+			return nil, nil, err
+		}
+		return request, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	request.SetResourceVersion(live.GetResourceVersion())
+	request.SetUID(live.GetUID())
+	if err := r.Client.Update(ctx, request, client.DryRunAll); err != nil {
+		return nil, nil, err
+	}
+	return request, live, nil
+}
+
+// mutatedPaths lists the paths of rendered values that the dry-run response
+// does not keep as-is. Fields only added by the server (defaults) are ignored.
+func mutatedPaths(rendered, response interface{}) []string {
+	var paths []string
+	var walk func(path string, rendered, response interface{})
+	walk = func(path string, rendered, response interface{}) {
+		switch want := rendered.(type) {
+		case map[string]interface{}:
+			got, ok := response.(map[string]interface{})
+			if !ok {
+				paths = append(paths, path)
+				return
+			}
+			keys := make([]string, 0, len(want))
+			for key := range want {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				child := key
+				if path != "" {
+					child = path + "." + key
+				}
+				value, found := got[key]
+				if !found {
+					if want[key] != nil {
+						paths = append(paths, child)
+					}
+					continue
+				}
+				walk(child, want[key], value)
+			}
+		case []interface{}:
+			got, ok := response.([]interface{})
+			if !ok || len(got) != len(want) {
+				paths = append(paths, path)
+				return
+			}
+			for i := range want {
+				walk(path+"["+strconv.Itoa(i)+"]", want[i], got[i])
+			}
+		default:
+			if fmt.Sprint(rendered) != fmt.Sprint(response) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	walk("", rendered, response)
+	return paths
+}
+
+// changesLive reports whether applying the dry-run response would change the
+// live object, ignoring metadata managed by the server and the status.
+func changesLive(live, response *unstructured.Unstructured) bool {
+	strip := func(obj *unstructured.Unstructured) map[string]interface{} {
+		content := map[string]interface{}{}
+		for key, value := range obj.Object {
+			if key != "metadata" && key != "status" {
+				content[key] = value
+			}
+		}
+		content["labels"] = obj.GetLabels()
+		content["annotations"] = obj.GetAnnotations()
+		return content
+	}
+	return !reflect.DeepEqual(strip(live), strip(response))
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestParsePreflightMode(t *testing.T) {
+	for value, want := range map[string]PreflightMode{"": PreflightOff, "off": PreflightOff, "report": PreflightReport, "enforce": PreflightEnforce, "only": PreflightOnly} {
+		got, err := ParsePreflightMode(value)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParsePreflightMode("always")
+	assert.Error(t, err)
+}
+
+func TestMutatedPaths(t *testing.T) {
+	rendered := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": 2,
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:latest", "resources": map[string]interface{}{"cpu": "1000m"}},
+			},
+			"removed": "value",
+		},
+	}
+	response := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "app@sha256:abc", "resources": map[string]interface{}{"cpu": "1"}, "imagePullPolicy": "Always"},
+			},
+			"defaulted": true,
+		},
+	}
+	assert.Equal(t, []string{
+		"spec.containers[0].image",
+		"spec.containers[0].resources.cpu",
+		"spec.removed",
+	}, mutatedPaths(rendered, response))
+}
+
+func TestPreflight(t *testing.T) {
+	configMapGVK := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	newConfigMap := func(name string, data map[string]interface{}) *unstructured.Unstructured {
+		obj := newTestResource(name, "default", configMapGVK)
+		obj.Object["data"] = data
+		return obj
+	}
+	live := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	s := runtime.NewScheme()
+	_ = corev1.AddToScheme(s)
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(live).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if obj.GetName() == "invalid" {
+				return errors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "invalid", field.ErrorList{field.Invalid(field.NewPath("data"), "", "bad key")})
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+	r := &GenericReconciler{Client: c, Scheme: s}
+	target := newTestResource("test-resource", "default", schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"})
+	target.SetGeneration(3)
+
+	t.Run("valid dependents", func(t *testing.T) {
+		report, err := r.preflight(context.Background(), testLogger(), target, []*unstructured.Unstructured{
+			newConfigMap("unchanged", map[string]interface{}{"key": "value"}),
+			newConfigMap("new", map[string]interface{}{"key": "value"}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, true, report["passed"])
+		assert.Equal(t, int64(3), report["observedGeneration"])
+		resources := report["resources"].([]interface{})
+		require.Len(t, resources, 2)
+		assert.Equal(t, false, resources[0].(map[string]interface{})["changesLive"])
+		assert.Equal(t, true, resources[1].(map[string]interface{})["changesLive"])
+
+		// The dry-run must not create anything.
+		err = c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "new"}, &corev1.ConfigMap{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("invalid dependent", func(t *testing.T) {
+		report, err := r.preflight(context.Background(), testLogger(), target, []*unstructured.Unstructured{
+			newConfigMap("invalid", map[string]interface{}{"key": "value"}),
+		})
+		var preflightErr *PreflightError
+		require.True(t, stderrors.As(err, &preflightErr))
+		assert.Len(t, preflightErr.Failed, 1)
+		assert.Equal(t, false, report["passed"])
+		result := report["resources"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Invalid", result["result"])
+		assert.Contains(t, result["error"], "bad key")
+
+		conditions, buildErr := r.buildConditions(context.Background(), target, true, err)
+		require.NoError(t, buildErr)
+		assert.Equal(t, PreflightFailedReason, conditions[0].(map[string]interface{})["reason"])
+	})
+
+	t.Run("preflight only", func(t *testing.T) {
+		r := &GenericReconciler{Preflight: PreflightOnly}
+		conditions, err := r.buildConditions(context.Background(), target, false, nil)
+		require.NoError(t, err)
+		ready := conditions[0].(map[string]interface{})
+		assert.Equal(t, string(metav1.ConditionUnknown), ready["status"])
+		assert.Equal(t, PreflightOnlyReason, ready["reason"])
+	})
+}
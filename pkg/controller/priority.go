@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PriorityAnnotation sets the priority class of a custom resource: "high",
+// "normal" (the default) or "low", e.g. high for production inference
+// endpoints and low for experimentation sandboxes.
+const PriorityAnnotation = "karo.gke.io/priority"
+
+// Priority is the priority class of a custom resource.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = 3
+)
+
+// PriorityWorkers is the number of reconciles of a kind that run or wait for
+// their turn at once when priorities are enabled.
+const PriorityWorkers = 3
+
+// priorityBudgetRequeueDelay is how long a resource waits before it is
+// reconciled again when the budget of its priority is spent.
+const priorityBudgetRequeueDelay = 2 * time.Second
+
+// priorityBudgets are the number of reconciles of a kind that may be in
+// flight for a reconcile of each priority to start, so that the reconciles
+// of lower priorities never take all the workers of a kind.
+var priorityBudgets = [numPriorities]int{
+	PriorityLow:    1,
+	PriorityNormal: 2,
+	PriorityHigh:   PriorityWorkers,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// ParsePriority returns the priority class named by value. Unknown values
+// are normal.
+func ParsePriority(value string) Priority {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "high":
+		return PriorityHigh
+	case "low":
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// ReconcilePriorities orders the reconciles of the custom resources of all
+// integrations by the priority class of the resources, so that during event
+// storms high priority resources are reconciled ahead of the others:
+//
+//   - the work queue of each kind hands out the requests of higher
+//     priorities first,
+//   - reconciles of every kind take turns by priority, rather than in the
+//     order they arrive, and
+//   - each kind runs PriorityWorkers reconciles, of which low priority ones
+//     may take one and normal ones two, so that a worker is always free for
+//     high priority resources.
+//
+// It is shared by the reconcilers of all integrations.
+type ReconcilePriorities struct {
+	mu sync.Mutex
+	// priorities are the priorities of the resources, recorded from their
+	// watch events.
+	priorities map[priorityKey]Priority
+	// inFlight are the reconciles of each kind that run or wait for their
+	// turn.
+	inFlight map[schema.GroupVersionKind]int
+	// locked is set while a reconcile has its turn, and waiting are the
+	// reconciles that wait for theirs, by priority.
+	locked  bool
+	waiting [numPriorities][]chan struct{}
+}
+
+type priorityKey struct {
+	gvk schema.GroupVersionKind
+	types.NamespacedName
+}
+
+// Priority returns the priority of a resource of kind gvk.
+func (p *ReconcilePriorities) Priority(gvk schema.GroupVersionKind, name types.NamespacedName) Priority {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if priority, found := p.priorities[priorityKey{gvk, name}]; found {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// observe records the priority of obj.
+func (p *ReconcilePriorities) observe(gvk schema.GroupVersionKind, obj client.Object) {
+	key := priorityKey{gvk, client.ObjectKeyFromObject(obj)}
+	priority := ParsePriority(obj.GetAnnotations()[PriorityAnnotation])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if priority == PriorityNormal {
+		delete(p.priorities, key)
+		return
+	}
+	if p.priorities == nil {
+		p.priorities = map[priorityKey]Priority{}
+	}
+	p.priorities[key] = priority
+}
+
+// forget removes the priority of obj.
+func (p *ReconcilePriorities) forget(gvk schema.GroupVersionKind, obj client.Object) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.priorities, priorityKey{gvk, client.ObjectKeyFromObject(obj)})
+}
+
+// tracker records the priorities of the resources of kind gvk from their
+// watch events. It does not filter events.
+func (p *ReconcilePriorities) tracker(gvk schema.GroupVersionKind) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			p.observe(gvk, e.Object)
+			return true
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			p.observe(gvk, e.ObjectNew)
+			return true
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			p.forget(gvk, e.Object)
+			return true
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			p.observe(gvk, e.Object)
+			return true
+		},
+	}
+}
+
+// queue returns the work queue storage of kind gvk, which hands out the
+// requests of higher priorities first and, if fair, those of the namespaces
+// of each priority in turn.
+func (p *ReconcilePriorities) queue(gvk schema.GroupVersionKind, fair bool) workqueue.Queue[reconcile.Request] {
+	queue := &priorityQueue{
+		priorityOf: func(request reconcile.Request) Priority { return p.Priority(gvk, request.NamespacedName) },
+		queued:     map[reconcile.Request]Priority{},
+	}
+	for i := range queue.bands {
+		queue.bands[i] = &namespaceFairQueue{fifo: !fair}
+	}
+	return queue
+}
+
+// admit registers a reconcile of kind gvk, unless the budget of priority is
+// spent. release must be called when an admitted reconcile is done.
+func (p *ReconcilePriorities) admit(gvk schema.GroupVersionKind, priority Priority) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inFlight[gvk] >= priorityBudgets[priority] {
+		return false
+	}
+	if p.inFlight == nil {
+		p.inFlight = map[schema.GroupVersionKind]int{}
+	}
+	p.inFlight[gvk]++
+	return true
+}
+
+// release unregisters an admitted reconcile of kind gvk.
+func (p *ReconcilePriorities) release(gvk schema.GroupVersionKind) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight[gvk]--
+}
+
+// lock waits until it is the turn of a reconcile of priority: the waiting
+// reconciles take turns by priority, and in the order they arrived within a
+// priority. unlock must be called when the reconcile is done, unless ctx is
+// done first, which is returned.
+func (p *ReconcilePriorities) lock(ctx context.Context, priority Priority) error {
+	p.mu.Lock()
+	if !p.locked {
+		p.locked = true
+		p.mu.Unlock()
+		return nil
+	}
+	turn := make(chan struct{})
+	p.waiting[priority] = append(p.waiting[priority], turn)
+	p.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if i := slices.Index(p.waiting[priority], turn); i >= 0 {
+			p.waiting[priority] = slices.Delete(p.waiting[priority], i, i+1)
+			return ctx.Err()
+		}
+		// The turn was handed over meanwhile, so pass it on.
+		p.handOver()
+		return ctx.Err()
+	}
+}
+
+// unlock ends the turn of a reconcile.
+func (p *ReconcilePriorities) unlock() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handOver()
+}
+
+// handOver gives the turn to the first waiting reconcile of the highest
+// priority. p.mu must be held.
+func (p *ReconcilePriorities) handOver() {
+	for priority := PriorityHigh; priority >= PriorityLow; priority-- {
+		if waiting := p.waiting[priority]; len(waiting) > 0 {
+			p.waiting[priority] = waiting[1:]
+			close(waiting[0])
+			return
+		}
+	}
+	p.locked = false
+}
+
+// priorityQueue holds the requests that are ready to be reconciled in a band
+// per priority, and pops the highest band first. It implements
+// workqueue.Queue, whose callers deduplicate the requests and hold the lock.
+type priorityQueue struct {
+	priorityOf func(reconcile.Request) Priority
+	bands      [numPriorities]*namespaceFairQueue
+	// queued are the bands of the queued requests.
+	queued map[reconcile.Request]Priority
+}
+
+var _ workqueue.Queue[reconcile.Request] = &priorityQueue{}
+
+// Touch implements workqueue.Queue. A request that is added again moves to
+// another band if its priority changed.
+func (q *priorityQueue) Touch(request reconcile.Request) {
+	band, found := q.queued[request]
+	if !found {
+		return
+	}
+	if priority := q.priorityOf(request); priority != band {
+		q.bands[band].remove(request)
+		q.bands[priority].Push(request)
+		q.queued[request] = priority
+	}
+}
+
+// Push implements workqueue.Queue.
+func (q *priorityQueue) Push(request reconcile.Request) {
+	priority := q.priorityOf(request)
+	q.bands[priority].Push(request)
+	q.queued[request] = priority
+}
+
+// Len implements workqueue.Queue.
+func (q *priorityQueue) Len() int {
+	return len(q.queued)
+}
+
+// Pop implements workqueue.Queue.
+func (q *priorityQueue) Pop() reconcile.Request {
+	for priority := PriorityHigh; priority > PriorityLow; priority-- {
+		if q.bands[priority].Len() > 0 {
+			request := q.bands[priority].Pop()
+			delete(q.queued, request)
+			return request
+		}
+	}
+	request := q.bands[PriorityLow].Pop()
+	delete(q.queued, request)
+	return request
+}
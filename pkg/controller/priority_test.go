@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestParsePriority(t *testing.T) {
+	assert.Equal(t, PriorityHigh, ParsePriority("high"))
+	assert.Equal(t, PriorityHigh, ParsePriority(" High "))
+	assert.Equal(t, PriorityLow, ParsePriority("low"))
+	assert.Equal(t, PriorityNormal, ParsePriority("normal"))
+	assert.Equal(t, PriorityNormal, ParsePriority(""))
+	assert.Equal(t, PriorityNormal, ParsePriority("urgent"))
+}
+
+func TestPriorityQueue(t *testing.T) {
+	priorities := &ReconcilePriorities{}
+	tracker := priorities.tracker(eventTestGVK)
+	annotate := func(namespace, name, priority string) {
+		obj := newTestResource(name, namespace, eventTestGVK)
+		if priority != "" {
+			obj.SetAnnotations(map[string]string{PriorityAnnotation: priority})
+		}
+		assert.True(t, tracker.Create(event.CreateEvent{Object: obj}), "the tracker does not filter events")
+	}
+	request := func(namespace, name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+	}
+	annotate("batch", "sandbox-1", "low")
+	annotate("batch", "sandbox-2", "low")
+	annotate("team-a", "endpoint", "high")
+	annotate("team-a", "model", "")
+	annotate("team-b", "model", "normal")
+	assert.Equal(t, PriorityHigh, priorities.Priority(eventTestGVK, types.NamespacedName{Namespace: "team-a", Name: "endpoint"}))
+	assert.Equal(t, PriorityNormal, priorities.Priority(schema.GroupVersionKind{Kind: "Other"}, types.NamespacedName{Namespace: "team-a", Name: "endpoint"}))
+
+	queue := newQueue("", workqueue.DefaultTypedControllerRateLimiter[reconcile.Request](), priorities.queue(eventTestGVK, true))
+	defer queue.ShutDown()
+	queue.Add(request("batch", "sandbox-1"))
+	queue.Add(request("batch", "sandbox-2"))
+	queue.Add(request("team-a", "model"))
+	queue.Add(request("team-a", "model2"))
+	queue.Add(request("team-b", "model"))
+	queue.Add(request("team-a", "endpoint"))
+
+	// The second sandbox becomes high priority while it is queued.
+	annotate("batch", "sandbox-2", "high")
+	queue.Add(request("batch", "sandbox-2"))
+	assert.Equal(t, 6, queue.Len())
+
+	var order []string
+	for queue.Len() > 0 {
+		item, _ := queue.Get()
+		order = append(order, item.Namespace+"/"+item.Name)
+		queue.Done(item)
+	}
+	assert.Equal(t, []string{"team-a/endpoint", "batch/sandbox-2", "team-a/model", "team-b/model", "team-a/model2", "batch/sandbox-1"}, order)
+
+	tracker.Delete(event.DeleteEvent{Object: newTestResource("endpoint", "team-a", eventTestGVK)})
+	assert.Equal(t, PriorityNormal, priorities.Priority(eventTestGVK, types.NamespacedName{Namespace: "team-a", Name: "endpoint"}))
+}
+
+func TestPriorityBudgets(t *testing.T) {
+	priorities := &ReconcilePriorities{}
+	other := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandbox"}
+
+	require.True(t, priorities.admit(eventTestGVK, PriorityLow))
+	assert.False(t, priorities.admit(eventTestGVK, PriorityLow), "low priority resources take one worker")
+	assert.True(t, priorities.admit(other, PriorityLow), "budgets are per kind")
+	require.True(t, priorities.admit(eventTestGVK, PriorityNormal))
+	assert.False(t, priorities.admit(eventTestGVK, PriorityNormal), "normal priority resources take two workers")
+	require.True(t, priorities.admit(eventTestGVK, PriorityHigh), "a worker is left for high priority resources")
+	assert.False(t, priorities.admit(eventTestGVK, PriorityHigh))
+
+	priorities.release(eventTestGVK)
+	priorities.release(eventTestGVK)
+	assert.True(t, priorities.admit(eventTestGVK, PriorityNormal))
+}
+
+func TestPriorityLock(t *testing.T) {
+	priorities := &ReconcilePriorities{}
+	ctx := context.Background()
+	require.NoError(t, priorities.lock(ctx, PriorityNormal))
+
+	waiting := func() int {
+		priorities.mu.Lock()
+		defer priorities.mu.Unlock()
+		count := 0
+		for _, turns := range priorities.waiting {
+			count += len(turns)
+		}
+		return count
+	}
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, waiter := range []struct {
+		name     string
+		priority Priority
+	}{{"sandbox", PriorityLow}, {"model-1", PriorityNormal}, {"endpoint", PriorityHigh}, {"model-2", PriorityNormal}} {
+		expected := waiting() + 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, priorities.lock(ctx, waiter.priority))
+			mu.Lock()
+			order = append(order, waiter.name)
+			mu.Unlock()
+			priorities.unlock()
+		}()
+		require.Eventually(t, func() bool { return waiting() == expected }, time.Second, time.Millisecond)
+	}
+
+	// A reconcile that stops waiting gives up its place.
+	cancelled, cancel := context.WithCancel(ctx)
+	errs := make(chan error)
+	go func() { errs <- priorities.lock(cancelled, PriorityHigh) }()
+	require.Eventually(t, func() bool { return waiting() == 5 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, 4, waiting())
+
+	priorities.unlock()
+	wg.Wait()
+	assert.Equal(t, []string{"endpoint", "model-1", "model-2", "sandbox"}, order)
+	assert.False(t, priorities.locked)
+}
+
+func TestReconcileOverPriorityBudget(t *testing.T) {
+	priorities := &ReconcilePriorities{}
+	require.True(t, priorities.admit(eventTestGVK, PriorityLow))
+
+	registry := &MockRegistry{HasIntegrationFunc: func(schema.GroupVersionKind) bool { return true }}
+	r := &GenericReconciler{
+		Mutex:       &sync.Mutex{},
+		Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface { return registry }},
+		Gvk:         eventTestGVK,
+		Priorities:  priorities,
+	}
+	sandbox := newTestResource("sandbox", "batch", eventTestGVK)
+	sandbox.SetAnnotations(map[string]string{PriorityAnnotation: "low"})
+	priorities.observe(eventTestGVK, sandbox)
+
+	// The reconciler has no client, it must return before reading the target.
+	result, err := r.reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "batch", Name: "sandbox"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: priorityBudgetRequeueDelay}, result)
+	assert.Equal(t, 1, priorities.inFlight[eventTestGVK])
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// ProtectedAnnotation set to "true" on a live dependent, e.g. a
+	// production Service with a reserved IP that is hand-managed during a
+	// migration, keeps karo from updating, replacing or deleting it, even if
+	// its templates change. The differences are reported in the
+	// ProtectedDrift condition of the target instead, and its owner
+	// reference to the target is removed, so that it is not deleted with the
+	// target either.
+	ProtectedAnnotation = "karo.gke.io/protected"
+
+	ProtectedDriftConditionType = "ProtectedDrift"
+	ProtectedDriftReason        = "ProtectedDependentsDrifted"
+	NoProtectedDriftReason      = "NoProtectedDrift"
+	ProtectedDriftEvent         = modelv1.EventReasonProtectedDrift
+)
+
+// isProtected returns true if karo must not change the live object obj, see
+// ProtectedAnnotation.
+func isProtected(obj *unstructured.Unstructured) bool {
+	return obj != nil && obj.GetAnnotations()[ProtectedAnnotation] == "true"
+}
+
+// releaseProtected removes the owner references to target from the protected
+// existingObj, so that the Kubernetes garbage collector does not delete it
+// with target. Only its metadata is patched, and only if it is unchanged
+// since it was read; the rest stays as it is hand-managed.
+func releaseProtected(ctx context.Context, log logr.Logger, rc modelv1.ResourceClientInterface, target, existingObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	refs := existingObj.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.UID != target.GetUID() {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return existingObj, nil
+	}
+	log.Info("Removing owner reference of protected resource, so that it is not deleted with its owner",
+		"kind", existingObj.GetKind(), "namespace", existingObj.GetNamespace(), "name", existingObj.GetName())
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": existingObj.GetResourceVersion()},
+		{"op": "replace", "path": "/metadata/ownerReferences", "value": kept},
+	})
+	if err != nil {
+		return nil, err
+	}
+	released, err := rc.Patch(ctx, existingObj.GroupVersionKind(), existingObj.GetNamespace(), existingObj.GetName(), types.JSONPatchType, patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove the owner reference of protected %s %s: %w", existingObj.GetKind(), existingObj.GetName(), err)
+	}
+	return released, nil
+}
+
+// protectedDrift collects the protected dependents that differ from their
+// rendered state during a reconcile. Dependents are applied in parallel, so
+// it is locked.
+type protectedDrift struct {
+	mu      sync.Mutex
+	drifted []string
+}
+
+type protectedDriftKey struct{}
+
+// withProtectedDrift returns a context that collects the protected
+// dependents that drifted during the reconcile that runs with it.
+func withProtectedDrift(ctx context.Context) (context.Context, *protectedDrift) {
+	drift := &protectedDrift{}
+	return context.WithValue(ctx, protectedDriftKey{}, drift), drift
+}
+
+// recordProtectedDrift records that the protected obj differs from its
+// rendered state, if ctx collects drift.
+func recordProtectedDrift(ctx context.Context, obj *unstructured.Unstructured) {
+	drift, ok := ctx.Value(protectedDriftKey{}).(*protectedDrift)
+	if !ok {
+		return
+	}
+	name := obj.GetName()
+	if obj.GetNamespace() != "" {
+		name = obj.GetNamespace() + "/" + name
+	}
+	drift.mu.Lock()
+	defer drift.mu.Unlock()
+	drift.drifted = append(drift.drifted, fmt.Sprintf("%s %s", obj.GetKind(), name))
+}
+
+// list returns the drifted dependents sorted, as parallel applies record
+// them in any order.
+func (d *protectedDrift) list() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	drifted := append([]string(nil), d.drifted...)
+	sort.Strings(drifted)
+	return drifted
+}
+
+// setProtectedDriftCondition reports the protected dependents that differ
+// from their rendered state in the ProtectedDrift condition of the target.
+// Targets without protected drift get no condition. Drift does not fail the
+// reconcile: it is expected while objects are hand-managed.
+func (r *GenericReconciler) setProtectedDriftCondition(target *unstructured.Unstructured, drifted []string) error {
+	existing := meta.FindStatusCondition(targetConditions(target), ProtectedDriftConditionType)
+	if len(drifted) == 0 && existing == nil {
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:               ProtectedDriftConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             NoProtectedDriftReason,
+		Message:            "No protected dependent differs from its templates.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(drifted) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ProtectedDriftReason
+		condition.Message = fmt.Sprintf("%d protected dependent(s) differ from their templates and are not updated: %s", len(drifted), strings.Join(drifted, "; "))
+		if existing == nil || existing.Status != metav1.ConditionTrue || existing.Message != condition.Message {
+			r.eventf(target, corev1.EventTypeWarning, ProtectedDriftEvent, "Not updating protected dependents of %s %s: %s", target.GetKind(), target.GetName(), strings.Join(drifted, "; "))
+		}
+	}
+	return setTargetCondition(target, condition)
+}
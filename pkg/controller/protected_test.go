@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func protect(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj.SetAnnotations(map[string]string{ProtectedAnnotation: "true"})
+	return obj
+}
+
+func TestReconcileGenericProtected(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	token1 := "my-secret-token-123"
+	token2 := "a-different-token-456"
+	target := newTestResource("llama", "default", eventTestGVK)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	var calls []string
+	rc := &MockResourceClient{
+		DeleteFunc: func(_ context.Context, _ schema.GroupVersionKind, _, name string, _ *metav1.DeletionPropagation) error {
+			calls = append(calls, "delete "+name)
+			return nil
+		},
+		CreateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			calls = append(calls, "create "+obj.GetName())
+			return obj, nil
+		},
+		UpdateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			calls = append(calls, "update "+obj.GetName())
+			return obj, nil
+		},
+	}
+
+	// Neither updated nor replaced, even if immutable.
+	ctx, drift := withProtectedDrift(context.Background())
+	for _, existing := range []*unstructured.Unstructured{
+		protect(newUnstructuredSecret(t, "mutable", &token1)),
+		protect(withImmutable(newUnstructuredSecret(t, "immutable", &token1))),
+		protect(newUnstructuredSecret(t, "unchanged", &token2)),
+	} {
+		desired := newUnstructuredSecret(t, existing.GetName(), &token2)
+		if existing.Object["immutable"] != nil {
+			withImmutable(desired)
+		}
+		live, err := r.reconcileGeneric(ctx, testLogger(), rc, target, "default", existing, desired, existing.GetName(), gvk, r.secretDiff)
+		require.NoError(t, err)
+		assert.Same(t, existing, live)
+	}
+	assert.Empty(t, calls)
+	assert.Equal(t, []string{"Secret default/immutable", "Secret default/mutable"}, drift.list())
+
+	require.NoError(t, r.setProtectedDriftCondition(target, drift.list()))
+	condition := meta.FindStatusCondition(targetConditions(target), ProtectedDriftConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, ProtectedDriftReason, condition.Reason)
+	assert.Equal(t, "2 protected dependent(s) differ from their templates and are not updated: Secret default/immutable; Secret default/mutable", condition.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning ProtectedDrift")
+
+	// The event is only recorded when the drift changes.
+	require.NoError(t, r.setProtectedDriftCondition(target, drift.list()))
+	assert.Empty(t, recorder.Events)
+
+	// Removing the annotation hands the dependent back to karo.
+	_, err := r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", newUnstructuredSecret(t, "mutable", &token1), newUnstructuredSecret(t, "mutable", &token2), "mutable", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update mutable"}, calls)
+	require.NoError(t, r.setProtectedDriftCondition(target, nil))
+	condition = meta.FindStatusCondition(targetConditions(target), ProtectedDriftConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, NoProtectedDriftReason, condition.Reason)
+
+	// Targets without protected drift get no condition.
+	other := newTestResource("agent", "default", eventTestGVK)
+	require.NoError(t, r.setProtectedDriftCondition(other, nil))
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), ProtectedDriftConditionType))
+}
+
+func TestReconcileGenericReleasesProtected(t *testing.T) {
+	r := &GenericReconciler{Recorder: record.NewFakeRecorder(10)}
+	token := "my-secret-token-123"
+	target := newTestResource("llama", "default", eventTestGVK)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	controller := true
+	other := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"}
+
+	existing := protect(newUnstructuredSecret(t, "owned", &token))
+	existing.SetResourceVersion("7")
+	existing.SetOwnerReferences([]metav1.OwnerReference{
+		{APIVersion: target.GetAPIVersion(), Kind: target.GetKind(), Name: target.GetName(), UID: target.GetUID(), Controller: &controller},
+		other,
+	})
+	var patches []string
+	rc := &MockResourceClient{
+		PatchFunc: func(_ context.Context, _ schema.GroupVersionKind, _, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+			assert.Equal(t, types.JSONPatchType, patchType)
+			patches = append(patches, string(data))
+			released := existing.DeepCopy()
+			released.SetOwnerReferences([]metav1.OwnerReference{other})
+			return released, nil
+		},
+	}
+
+	live, err := r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", existing, newUnstructuredSecret(t, "owned", &token), "owned", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Equal(t, []metav1.OwnerReference{other}, live.GetOwnerReferences())
+	require.Len(t, patches, 1)
+	assert.JSONEq(t, `[{"op":"test","path":"/metadata/resourceVersion","value":"7"},{"op":"replace","path":"/metadata/ownerReferences","value":[{"apiVersion":"v1","kind":"ConfigMap","name":"other","uid":"other-uid"}]}]`, patches[0])
+
+	// Released dependents are not patched again.
+	_, err = r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", live, newUnstructuredSecret(t, "owned", &token), "owned", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Len(t, patches, 1)
+}
+
+func TestRemediateProtected(t *testing.T) {
+	rc := &MockResourceClient{
+		DeleteFunc: func(_ context.Context, _ schema.GroupVersionKind, _, name string, _ *metav1.DeletionPropagation) error {
+			t.Errorf("protected Job %s was deleted", name)
+			return nil
+		},
+	}
+	job := protect(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "download", "namespace": "default"},
+	}})
+	r := &GenericReconciler{}
+	spec := &modelv1.IntegrationHealthSpec{Remediation: HealthRemediationRestart}
+	require.NoError(t, r.remediate(context.Background(), testLogger(), newTestResource("llama", "default", eventTestGVK), job, spec, rc))
+}
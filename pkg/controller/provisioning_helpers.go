@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// computeClassDiff compares the specs of two GKE ComputeClass objects. GKE
+// defaults several top-level fields (e.g. whenUnsatisfiable), so only the
+// fields the template sets are compared.
+func (r *GenericReconciler) computeClassDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	for key, desired := range desiredSpec {
+		normalizedExisting := normalizeNumbersToInt64(existingSpec[key])
+		normalizedDesired := normalizeNumbersToInt64(desired)
+		if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+			log.Info("Found a difference in the ComputeClass spec", "field", key, "difference", cmp.Diff(normalizedExisting, normalizedDesired))
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// provisioningRequestDiff compares the specs of two ProvisioningRequest objects.
+// The spec of a ProvisioningRequest is immutable, so a changed spec cannot be
+// applied with an update. Templates that need a new request when the
+// accelerator changes should derive its name from the accelerator instead.
+func (r *GenericReconciler) provisioningRequestDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, _ := existingObj.Object["spec"].(map[string]interface{})
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	normalizedExisting := normalizeNumbersToInt64(existingSpec)
+	normalizedDesired := normalizeNumbersToInt64(desiredSpec)
+	if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+		return false, fmt.Errorf("spec of ProvisioningRequest %s/%s is immutable and differs from the rendered one: %s", obj.GetNamespace(), obj.GetName(), cmp.Diff(normalizedExisting, normalizedDesired))
+	}
+	return false, nil
+}
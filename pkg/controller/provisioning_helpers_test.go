@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var computeClassGVK = schema.GroupVersionKind{Group: "cloud.google.com", Version: "v1", Kind: "ComputeClass"}
+
+func newTestComputeClass(spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(computeClassGVK)
+	obj.SetName("karo-nvidia-l4")
+	return obj
+}
+
+func newTestProvisioningRequest(count interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling.x-k8s.io/v1",
+		"kind":       "ProvisioningRequest",
+		"metadata":   map[string]interface{}{"name": "vllm-nvidia-l4", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"provisioningClassName": "queued-provisioning.gke.io",
+			"podSets": []interface{}{
+				map[string]interface{}{"count": count, "podTemplateRef": map[string]interface{}{"name": "vllm"}},
+			},
+		},
+	}}
+}
+
+func TestComputeClassDiff(t *testing.T) {
+	reconciler := &GenericReconciler{}
+	priorities := func(count interface{}) []interface{} {
+		return []interface{}{map[string]interface{}{"gpu": map[string]interface{}{"type": "nvidia-l4", "count": count}}}
+	}
+	desired := newTestComputeClass(map[string]interface{}{
+		"priorities":           priorities(1),
+		"nodePoolAutoCreation": map[string]interface{}{"enabled": true},
+	})
+
+	// Fields defaulted by GKE do not cause a diff.
+	existing := newTestComputeClass(map[string]interface{}{
+		"priorities":           priorities(int64(1)),
+		"nodePoolAutoCreation": map[string]interface{}{"enabled": true},
+		"whenUnsatisfiable":    "ScaleUpAnyway",
+	})
+	hasDiff, err := reconciler.computeClassDiff(existing, desired, testLogger())
+	require.NoError(t, err)
+	assert.False(t, hasDiff)
+
+	existing = newTestComputeClass(map[string]interface{}{
+		"priorities":           priorities(int64(2)),
+		"nodePoolAutoCreation": map[string]interface{}{"enabled": true},
+	})
+	hasDiff, err = reconciler.computeClassDiff(existing, desired, testLogger())
+	require.NoError(t, err)
+	assert.True(t, hasDiff)
+}
+
+func TestProvisioningRequestDiff(t *testing.T) {
+	reconciler := &GenericReconciler{}
+
+	hasDiff, err := reconciler.provisioningRequestDiff(newTestProvisioningRequest(int64(2)), newTestProvisioningRequest(2), testLogger())
+	require.NoError(t, err)
+	assert.False(t, hasDiff)
+
+	_, err = reconciler.provisioningRequestDiff(newTestProvisioningRequest(int64(2)), newTestProvisioningRequest(4), testLogger())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec of ProvisioningRequest default/vllm-nvidia-l4 is immutable")
+}
+
+func TestReconcileDependentClusterScoped(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(computeClassGVK, meta.RESTScopeRoot)
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	mapper.Add(targetGVK, meta.RESTScopeNamespace)
+
+	target := newTestResource("test-resource", "default", targetGVK)
+	target.SetUID("target-uid")
+	r := &GenericReconciler{
+		Client:   fake.NewClientBuilder().WithRESTMapper(mapper).Build(),
+		Scheme:   runtime.NewScheme(),
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	var created *unstructured.Unstructured
+	rc := &MockResourceClient{CreateFunc: func(_ context.Context, _ schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		assert.Empty(t, namespace)
+		created = obj
+		return obj, nil
+	}}
+	computeClass := newTestComputeClass(map[string]interface{}{"priorities": []interface{}{}})
+	info, err := r.reconcileDependent(context.Background(), testLogger(), target, computeClass, rc)
+	require.NoError(t, err)
+	assert.Equal(t, "Processed", info["status"])
+	require.NotNil(t, created)
+	assert.Nil(t, v1.GetControllerOf(created))
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QuantityForm is the canonical form that the quantities of a resource are
+// compared in, so that e.g. "1Gi" and "1073741824" are not reported as a
+// change of a Deployment.
+type QuantityForm string
+
+const (
+	// QuantityFormMilli compares millivalues, like cpu.
+	QuantityFormMilli QuantityForm = "milli"
+	// QuantityFormBinary compares whole values with binary suffixes, like
+	// memory.
+	QuantityFormBinary QuantityForm = "binary"
+	// QuantityFormDecimal compares whole values with decimal suffixes.
+	QuantityFormDecimal QuantityForm = "decimal"
+)
+
+// QuantityForms maps resource names to their canonical form. A name that ends
+// with * matches every resource with that prefix, e.g. hugepages-*.
+type QuantityForms map[corev1.ResourceName]QuantityForm
+
+var (
+	quantityFormsMu sync.RWMutex
+	// quantityForms are the built-in forms of the standard resources and the
+	// extended resources of the accelerators. Resources without a form keep
+	// the format they were parsed in.
+	quantityForms = QuantityForms{
+		corev1.ResourceCPU:                   QuantityFormMilli,
+		corev1.ResourceMemory:                QuantityFormBinary,
+		corev1.ResourceStorage:               QuantityFormBinary,
+		corev1.ResourceEphemeralStorage:      QuantityFormBinary,
+		corev1.ResourceHugePagesPrefix + "*": QuantityFormBinary,
+		"nvidia.com/gpu":                     QuantityFormBinary,
+		"nvidia.com/mig-*":                   QuantityFormBinary,
+		"amd.com/gpu":                        QuantityFormBinary,
+		"google.com/tpu":                     QuantityFormBinary,
+		"intel.com/gpu":                      QuantityFormBinary,
+	}
+)
+
+// ParseQuantityForms parses a comma-separated list of name=form, e.g.
+// "example.com/fpga=decimal,example.com/vram-*=binary".
+func ParseQuantityForms(value string) (QuantityForms, error) {
+	forms := QuantityForms{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, form, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid quantity form %q, expected <resource>=<form>", entry)
+		}
+		switch QuantityForm(form) {
+		case QuantityFormMilli, QuantityFormBinary, QuantityFormDecimal:
+		default:
+			return nil, fmt.Errorf("invalid quantity form %q of %s (must be '%s', '%s' or '%s')", form, name, QuantityFormMilli, QuantityFormBinary, QuantityFormDecimal)
+		}
+		forms[corev1.ResourceName(name)] = QuantityForm(form)
+	}
+	return forms, nil
+}
+
+// AddQuantityForms adds forms to the built-in ones, replacing those of the
+// same names. It is called at startup, before resources are compared.
+func AddQuantityForms(forms QuantityForms) {
+	quantityFormsMu.Lock()
+	defer quantityFormsMu.Unlock()
+	for name, form := range forms {
+		quantityForms[name] = form
+	}
+}
+
+// quantityFormOf returns the form of resourceName: the form of its name, or
+// else of its longest matching prefix.
+func quantityFormOf(resourceName corev1.ResourceName) (QuantityForm, bool) {
+	quantityFormsMu.RLock()
+	defer quantityFormsMu.RUnlock()
+	if form, ok := quantityForms[resourceName]; ok {
+		return form, true
+	}
+	var form QuantityForm
+	longest := -1
+	for name, candidate := range quantityForms {
+		prefix, ok := strings.CutSuffix(string(name), "*")
+		if ok && len(prefix) > longest && strings.HasPrefix(string(resourceName), prefix) {
+			form, longest = candidate, len(prefix)
+		}
+	}
+	return form, longest >= 0
+}
+
+// canonical returns q in form.
+func (form QuantityForm) canonical(q resource.Quantity) resource.Quantity {
+	switch form {
+	case QuantityFormMilli:
+		return *resource.NewMilliQuantity(q.MilliValue(), resource.DecimalSI)
+	case QuantityFormDecimal:
+		return *resource.NewQuantity(q.Value(), resource.DecimalSI)
+	default:
+		return *resource.NewQuantity(q.Value(), resource.BinarySI)
+	}
+}
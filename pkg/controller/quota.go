@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	QuotaExceededReason = "QuotaExceeded"
+	QuotaExceededEvent  = modelv1.EventReasonQuotaExceeded
+)
+
+// QuotaExceededError is returned when the rendered dependents would request more
+// resources than the integration budget or the namespace ResourceQuota allows.
+type QuotaExceededError struct {
+	// Limit names what was exceeded, e.g. "budget" or "ResourceQuota gpu-quota".
+	Limit     string
+	Resource  corev1.ResourceName
+	Requested resource.Quantity
+	Available resource.Quantity
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("dependents request %s %s, but %s only allows %s", e.Requested.String(), e.Resource, e.Limit, e.Available.String())
+}
+
+// checkResourceGuardrails verifies that the rendered dependents fit into the
+// integration budget and, if quota guardrails are enabled, into the namespace
+// ResourceQuotas. It runs before anything is applied, so a template cannot fan
+// out into pods that will never be scheduled.
+func (r *GenericReconciler) checkResourceGuardrails(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(r.Gvk)
+	budget := integrationSpec.Budget
+	if len(budget) == 0 && !r.QuotaGuardrails {
+		return nil
+	}
+
+	total := corev1.ResourceList{}
+	for _, obj := range objs {
+		addResourceList(total, requestsForObject(obj, log))
+	}
+	if err := checkWithinLimits("budget", total, quotaView(budget)); err != nil {
+		return err
+	}
+	if !r.QuotaGuardrails {
+		return nil
+	}
+
+	// Dependents that already exist are counted in the quota's usage, so they
+	// only add what they request beyond their live objects, e.g. when their
+	// replicas are scaled up.
+	delta := corev1.ResourceList{}
+	for _, obj := range objs {
+		if obj.GetNamespace() != target.GetNamespace() {
+			continue
+		}
+		addResourceList(delta, requestsForObject(obj, log))
+		live, err := rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		if err == nil {
+			subResourceList(delta, requestsForObject(live, log))
+		} else if !errors.IsNotFound(err) {
+			return fmt.Errorf("error getting resource %s %s/%s: %w", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+	pending := corev1.ResourceList{}
+	for name, quantity := range delta {
+		if quantity.Sign() > 0 {
+			pending[name] = quantity
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	quotas := &corev1.ResourceQuotaList{}
+	if err := r.Client.List(ctx, quotas, client.InNamespace(target.GetNamespace())); err != nil {
+		return fmt.Errorf("failed to list ResourceQuotas: %w", err)
+	}
+	for _, quota := range quotas.Items {
+		hard := quota.Status.Hard
+		if hard == nil {
+			hard = quota.Spec.Hard
+		}
+		available := corev1.ResourceList{}
+		for name, limit := range hard {
+			remaining := limit.DeepCopy()
+			if used, ok := quota.Status.Used[name]; ok {
+				remaining.Sub(used)
+			}
+			available[name] = remaining
+		}
+		if err := checkWithinLimits("ResourceQuota "+quota.Name, pending, quotaView(available)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quotaView maps quota keys such as "requests.cpu" or "requests.nvidia.com/gpu"
+// onto the plain resource names used in pod requests. Limits are ignored.
+func quotaView(hard corev1.ResourceList) corev1.ResourceList {
+	view := corev1.ResourceList{}
+	for name, quantity := range hard {
+		key := corev1.ResourceName(strings.TrimPrefix(string(name), "requests."))
+		if strings.HasPrefix(string(name), "limits.") {
+			continue
+		}
+		if existing, ok := view[key]; !ok || quantity.Cmp(existing) < 0 {
+			view[key] = quantity
+		}
+	}
+	return view
+}
+
+// checkWithinLimits returns a QuotaExceededError for the first resource (in
+// name order) whose request is above its limit.
+func checkWithinLimits(limitName string, requested, limits corev1.ResourceList) error {
+	names := make([]string, 0, len(requested))
+	for name := range requested {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit, ok := limits[corev1.ResourceName(name)]
+		if !ok {
+			continue
+		}
+		if request := requested[corev1.ResourceName(name)]; request.Cmp(limit) > 0 {
+			return &QuotaExceededError{
+				Limit:     limitName,
+				Resource:  corev1.ResourceName(name),
+				Requested: request,
+				Available: limit,
+			}
+		}
+	}
+	return nil
+}
+
+func addResourceList(total, add corev1.ResourceList) {
+	for name, quantity := range add {
+		current := total[name]
+		current.Add(quantity)
+		total[name] = current
+	}
+}
+
+func subResourceList(total, sub corev1.ResourceList) {
+	for name, quantity := range sub {
+		current := total[name]
+		current.Sub(quantity)
+		total[name] = current
+	}
+}
+
+// requestsForObject sums the resource requests of all pods a workload object
+// creates, including a "pods" count. Kinds whose pod count cannot be predicted
+// (DaemonSets, CronJobs) and non-workload kinds request nothing.
+func requestsForObject(obj *unstructured.Unstructured, log logr.Logger) corev1.ResourceList {
+	replicas := func(path ...string) int64 {
+		value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		if !found {
+			return 1
+		}
+		return int64(getInt32ValueFromInterface(value, log))
+	}
+	podSpec := func(path ...string) map[string]interface{} {
+		value, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		spec, _ := value.(map[string]interface{})
+		return spec
+	}
+
+	total := corev1.ResourceList{}
+	addPods := func(spec map[string]interface{}, count int64) {
+		if spec == nil || count <= 0 {
+			return
+		}
+		perPod := requestsForPodSpec(spec, log)
+		perPod[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+		for name, quantity := range perPod {
+			quantity.Mul(count)
+			current := total[name]
+			current.Add(quantity)
+			total[name] = current
+		}
+	}
+
+	switch obj.GetKind() {
+	case "Pod":
+		addPods(podSpec("spec"), 1)
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		addPods(podSpec("spec", "template", "spec"), replicas("spec", "replicas"))
+	case "Job":
+		addPods(podSpec("spec", "template", "spec"), replicas("spec", "parallelism"))
+	case "LeaderWorkerSet":
+		groups := replicas("spec", "replicas")
+		size := replicas("spec", "leaderWorkerTemplate", "size")
+		workers := size
+		if leader := podSpec("spec", "leaderWorkerTemplate", "leaderTemplate", "spec"); leader != nil {
+			addPods(leader, groups)
+			workers = size - 1
+		}
+		addPods(podSpec("spec", "leaderWorkerTemplate", "workerTemplate", "spec"), groups*workers)
+	}
+	return total
+}
+
+// requestsForPodSpec returns the effective requests of a pod: the larger of the
+// sum of its containers and its largest init container. Limits stand in for
+// missing requests, as the API server defaults them the same way.
+func requestsForPodSpec(podSpec map[string]interface{}, log logr.Logger) corev1.ResourceList {
+	containerRequests := func(container map[string]interface{}) corev1.ResourceList {
+		requests := corev1.ResourceList{}
+		resources, _ := container["resources"].(map[string]interface{})
+		limits, _ := resources["limits"].(map[string]interface{})
+		explicit, _ := resources["requests"].(map[string]interface{})
+		for _, values := range []map[string]interface{}{limits, explicit} {
+			for name, value := range values {
+				if quantity, ok := quantityFromInterface(value); ok {
+					requests[corev1.ResourceName(name)] = quantity
+				} else {
+					log.Info("Ignoring unparsable resource quantity", "resource", name, "value", value)
+				}
+			}
+		}
+		return requests
+	}
+
+	total := corev1.ResourceList{}
+	containers, _ := podSpec["containers"].([]interface{})
+	for _, rawContainer := range containers {
+		if container, ok := rawContainer.(map[string]interface{}); ok {
+			addResourceList(total, containerRequests(container))
+		}
+	}
+	initContainers, _ := podSpec["initContainers"].([]interface{})
+	for _, rawContainer := range initContainers {
+		container, ok := rawContainer.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, quantity := range containerRequests(container) {
+			if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+				total[name] = quantity
+			}
+		}
+	}
+	return total
+}
+
+func quantityFromInterface(value interface{}) (resource.Quantity, bool) {
+	switch v := value.(type) {
+	case string:
+		quantity, err := resource.ParseQuantity(v)
+		return quantity, err == nil
+	case int:
+		return *resource.NewQuantity(int64(v), resource.DecimalSI), true
+	case int64:
+		return *resource.NewQuantity(v, resource.DecimalSI), true
+	case float64:
+		quantity, err := resource.ParseQuantity(fmt.Sprintf("%g", v))
+		return quantity, err == nil
+	}
+	return resource.Quantity{}, false
+}
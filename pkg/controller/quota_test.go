@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// newGPUDeployment returns a rendered Deployment as the transformer produces
+// it, with plain Go ints for numbers.
+func newGPUDeployment(name string, replicas int, gpus int) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"initContainers": []interface{}{
+					map[string]interface{}{"name": "init", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "4"},
+					}},
+				},
+				"containers": []interface{}{
+					map[string]interface{}{"name": "server", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "2", "memory": "8Gi"},
+						"limits":   map[string]interface{}{"nvidia.com/gpu": gpus},
+					}},
+					map[string]interface{}{"name": "sidecar", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "500m"},
+					}},
+				},
+			}},
+		},
+	}}
+}
+
+func TestRequestsForObject(t *testing.T) {
+	requests := requestsForObject(newGPUDeployment("vllm", 3, 2), logr.Discard())
+
+	// The init container needs more CPU than the regular containers together.
+	assert.Equal(t, "12", ptrQuantity(requests[corev1.ResourceCPU]).String())
+	assert.Equal(t, "24Gi", ptrQuantity(requests[corev1.ResourceMemory]).String())
+	assert.Equal(t, "6", ptrQuantity(requests["nvidia.com/gpu"]).String())
+	assert.Equal(t, "3", ptrQuantity(requests[corev1.ResourcePods]).String())
+
+	lws := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "LeaderWorkerSet",
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"leaderWorkerTemplate": map[string]interface{}{
+				"size": int64(4),
+				"workerTemplate": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "worker", "resources": map[string]interface{}{
+						"limits": map[string]interface{}{"nvidia.com/gpu": int64(8)},
+					}}},
+				}},
+			},
+		},
+	}}
+	requests = requestsForObject(lws, logr.Discard())
+	assert.Equal(t, "64", ptrQuantity(requests["nvidia.com/gpu"]).String())
+	assert.Equal(t, "8", ptrQuantity(requests[corev1.ResourcePods]).String())
+
+	assert.Empty(t, requestsForObject(newTestResource("config", "default", schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}), logr.Discard()))
+}
+
+func TestCheckResourceGuardrails(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", targetGVK)
+	objs := []*unstructured.Unstructured{newGPUDeployment("vllm", 3, 2)}
+
+	newReconciler := func(budget corev1.ResourceList, quotaGuardrails bool, quotas ...*corev1.ResourceQuota) *GenericReconciler {
+		s := runtime.NewScheme()
+		_ = corev1.AddToScheme(s)
+		builder := fake.NewClientBuilder().WithScheme(s)
+		for _, quota := range quotas {
+			builder = builder.WithObjects(quota)
+		}
+		return &GenericReconciler{
+			Client:          builder.Build(),
+			Gvk:             targetGVK,
+			QuotaGuardrails: quotaGuardrails,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{Budget: budget}, true
+				}}
+			}},
+		}
+	}
+	gpuQuota := func(hard, used string) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "gpu-quota", Namespace: "default"},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{"requests.nvidia.com/gpu": resource.MustParse(hard)},
+				Used: corev1.ResourceList{"requests.nvidia.com/gpu": resource.MustParse(used)},
+			},
+		}
+	}
+
+	t.Run("no budget and guardrails disabled", func(t *testing.T) {
+		r := newReconciler(nil, false, gpuQuota("1", "0"))
+		assert.NoError(t, r.checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, &MockResourceClient{}))
+	})
+
+	t.Run("within budget", func(t *testing.T) {
+		r := newReconciler(corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("8")}, false)
+		assert.NoError(t, r.checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, &MockResourceClient{}))
+	})
+
+	t.Run("over budget", func(t *testing.T) {
+		r := newReconciler(corev1.ResourceList{"requests.nvidia.com/gpu": resource.MustParse("4")}, false)
+		err := r.checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, &MockResourceClient{})
+		var quotaErr *QuotaExceededError
+		require.True(t, stderrors.As(err, &quotaErr))
+		assert.Equal(t, "budget", quotaErr.Limit)
+		assert.Equal(t, corev1.ResourceName("nvidia.com/gpu"), quotaErr.Resource)
+		assert.Equal(t, "dependents request 6 nvidia.com/gpu, but budget only allows 4", err.Error())
+	})
+
+	t.Run("namespace quota exhausted", func(t *testing.T) {
+		r := newReconciler(nil, true, gpuQuota("8", "4"))
+		err := r.checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, &MockResourceClient{})
+		var quotaErr *QuotaExceededError
+		require.True(t, stderrors.As(err, &quotaErr))
+		assert.Equal(t, "ResourceQuota gpu-quota", quotaErr.Limit)
+		assert.Equal(t, "4", ptrQuantity(quotaErr.Available).String())
+	})
+
+	t.Run("existing dependents are already counted by the quota", func(t *testing.T) {
+		r := newReconciler(nil, true, gpuQuota("8", "6"))
+		existing := &MockResourceClient{GetFunc: func(_ context.Context, _ schema.GroupVersionKind, _, _ string) (*unstructured.Unstructured, error) {
+			return objs[0], nil
+		}}
+		assert.NoError(t, r.checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, existing))
+	})
+
+	t.Run("existing dependents add what they request beyond their live objects", func(t *testing.T) {
+		live := &MockResourceClient{GetFunc: func(_ context.Context, _ schema.GroupVersionKind, _, _ string) (*unstructured.Unstructured, error) {
+			return newGPUDeployment("vllm", 1, 2), nil
+		}}
+		assert.NoError(t, newReconciler(nil, true, gpuQuota("8", "4")).checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, live))
+
+		err := newReconciler(nil, true, gpuQuota("8", "6")).checkResourceGuardrails(context.Background(), logr.Discard(), target, objs, live)
+		var quotaErr *QuotaExceededError
+		require.True(t, stderrors.As(err, &quotaErr))
+		assert.Equal(t, "4", ptrQuantity(quotaErr.Requested).String())
+	})
+}
+
+func TestBuildConditionsQuotaExceeded(t *testing.T) {
+	target := newTestResource("test-resource", "default", eventTestGVK)
+	err := &QuotaExceededError{Limit: "budget", Resource: corev1.ResourceCPU, Requested: resource.MustParse("4"), Available: resource.MustParse("2")}
+
+	conditions, buildErr := (&GenericReconciler{}).buildConditions(context.Background(), target, true, err)
+	require.NoError(t, buildErr)
+	require.Len(t, conditions, 1)
+	ready := conditions[0].(map[string]interface{})
+	assert.Equal(t, "False", ready["status"])
+	assert.Equal(t, QuotaExceededReason, ready["reason"])
+	assert.Contains(t, ready["message"], "budget only allows 2")
+}
+
+func ptrQuantity(q resource.Quantity) *resource.Quantity {
+	return &q
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// ReconcileExportQueueSize is the number of summaries that wait to be
+	// exported. Summaries are dropped while the queue is full, so that a
+	// slow sink never slows reconciles down.
+	ReconcileExportQueueSize = 1000
+	// ReconcileExportBatchSize is the number of summaries sent at most in one
+	// request.
+	ReconcileExportBatchSize = 100
+	// ReconcileExportInterval is how long summaries wait at most before they
+	// are sent.
+	ReconcileExportInterval = 5 * time.Second
+
+	loggingExportPrefix = "logging:"
+	pubsubExportPrefix  = "pubsub:"
+)
+
+// ReconcileSummary is the summary of a reconcile that is exported.
+type ReconcileSummary struct {
+	Time time.Time `json:"time"`
+	// Cluster is projects/<project>/locations/<location>/clusters/<name>, if
+	// the cluster metadata is known.
+	Cluster           string   `json:"cluster,omitempty"`
+	APIVersion        string   `json:"apiVersion"`
+	Kind              string   `json:"kind"`
+	Namespace         string   `json:"namespace,omitempty"`
+	Name              string   `json:"name"`
+	Generation        int64    `json:"generation"`
+	Outcome           string   `json:"outcome"`
+	Message           string   `json:"message,omitempty"`
+	DurationSeconds   float64  `json:"durationSeconds"`
+	DependentsChanged []string `json:"dependentsChanged,omitempty"`
+}
+
+// ReconcileExporter sends reconcile summaries to a sink outside the cluster.
+type ReconcileExporter interface {
+	Export(ctx context.Context, summaries []*ReconcileSummary) error
+}
+
+// NewReconcileExporter returns the exporter for location, which is either
+// logging:projects/<project>/logs/<log> for Cloud Logging or
+// pubsub:projects/<project>/topics/<topic> for Pub/Sub.
+func NewReconcileExporter(ctx context.Context, location string, opts ...option.ClientOption) (ReconcileExporter, error) {
+	switch {
+	case strings.HasPrefix(location, loggingExportPrefix):
+		logName := strings.TrimPrefix(location, loggingExportPrefix)
+		project, ok := resourceProject(logName, "logs")
+		if !ok {
+			break
+		}
+		service, err := logging.NewService(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloud Logging client for reconcile exports: %w", err)
+		}
+		return &loggingExporter{entries: service.Entries, logName: logName, project: project}, nil
+	case strings.HasPrefix(location, pubsubExportPrefix):
+		topic := strings.TrimPrefix(location, pubsubExportPrefix)
+		if _, ok := resourceProject(topic, "topics"); !ok {
+			break
+		}
+		service, err := pubsub.NewService(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Pub/Sub client for reconcile exports: %w", err)
+		}
+		return &pubsubExporter{topics: service.Projects.Topics, topic: topic}, nil
+	}
+	return nil, fmt.Errorf("invalid reconcile export %q, expected logging:projects/<project>/logs/<log> or pubsub:projects/<project>/topics/<topic>", location)
+}
+
+// resourceProject returns the project of name, projects/<project>/<collection>/<id>.
+func resourceProject(name, collection string) (string, bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[1] == "" || parts[2] != collection || parts[3] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// loggingExporter writes each summary as a structured log entry.
+type loggingExporter struct {
+	entries *logging.EntriesService
+	logName string
+	// project is the project of the log, whose global resource the entries
+	// are written to if the cluster is not known.
+	project string
+}
+
+func (e *loggingExporter) Export(ctx context.Context, summaries []*ReconcileSummary) error {
+	request := &logging.WriteLogEntriesRequest{LogName: e.logName}
+	for _, summary := range summaries {
+		payload, err := json.Marshal(summary)
+		if err != nil {
+			return fmt.Errorf("failed to encode reconcile summary: %w", err)
+		}
+		severity := "INFO"
+		if summary.Outcome == ReconcileFailed {
+			severity = "ERROR"
+		}
+		request.Entries = append(request.Entries, &logging.LogEntry{
+			JsonPayload: googleapi.RawMessage(payload),
+			Resource:    e.resource(summary.Cluster),
+			Severity:    severity,
+			Timestamp:   summary.Time.UTC().Format(time.RFC3339Nano),
+			Labels:      summaryAttributes(summary),
+		})
+	}
+	if _, err := e.entries.Write(request).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("failed to write reconcile summaries to %s: %w", e.logName, err)
+	}
+	return nil
+}
+
+// resource returns the k8s_cluster resource of cluster, or the global
+// resource of the project of the log if the cluster is not known.
+func (e *loggingExporter) resource(cluster string) *logging.MonitoredResource {
+	parts := strings.Split(cluster, "/")
+	if len(parts) == 6 {
+		return &logging.MonitoredResource{Type: "k8s_cluster", Labels: map[string]string{
+			"project_id":   parts[1],
+			"location":     parts[3],
+			"cluster_name": parts[5],
+		}}
+	}
+	return &logging.MonitoredResource{Type: "global", Labels: map[string]string{"project_id": e.project}}
+}
+
+// pubsubExporter publishes each summary as a JSON message.
+type pubsubExporter struct {
+	topics *pubsub.ProjectsTopicsService
+	topic  string
+}
+
+func (e *pubsubExporter) Export(ctx context.Context, summaries []*ReconcileSummary) error {
+	request := &pubsub.PublishRequest{}
+	for _, summary := range summaries {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return fmt.Errorf("failed to encode reconcile summary: %w", err)
+		}
+		request.Messages = append(request.Messages, &pubsub.PubsubMessage{
+			Data:       base64.StdEncoding.EncodeToString(data),
+			Attributes: summaryAttributes(summary),
+		})
+	}
+	if _, err := e.topics.Publish(e.topic, request).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("failed to publish reconcile summaries to %s: %w", e.topic, err)
+	}
+	return nil
+}
+
+// summaryAttributes returns the fields of summary that sinks filter on, as
+// labels of log entries or attributes of messages.
+func summaryAttributes(summary *ReconcileSummary) map[string]string {
+	attributes := map[string]string{"kind": summary.Kind, "outcome": summary.Outcome}
+	if summary.Cluster != "" {
+		attributes["cluster"] = summary.Cluster
+	}
+	return attributes
+}
+
+// ReconcileExportQueue exports the summaries of reconciles in the background,
+// in batches.
+type ReconcileExportQueue struct {
+	Exporter ReconcileExporter
+	// Interval overrides ReconcileExportInterval, e.g. in tests.
+	Interval time.Duration
+
+	once      sync.Once
+	summaries chan *ReconcileSummary
+	mu        sync.Mutex
+	cluster   string
+	dropped   int
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica exports the reconciles it runs.
+func (q *ReconcileExportQueue) NeedLeaderElection() bool {
+	return false
+}
+
+func (q *ReconcileExportQueue) queue() chan *ReconcileSummary {
+	q.once.Do(func() {
+		q.summaries = make(chan *ReconcileSummary, ReconcileExportQueueSize)
+	})
+	return q.summaries
+}
+
+// SetCluster records the cluster of the summaries.
+func (q *ReconcileExportQueue) SetCluster(info *transformer.ClusterInfo) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cluster = ""
+	if info != nil && info.ProjectID != "" && info.Location != "" && info.Name != "" {
+		q.cluster = fmt.Sprintf("projects/%s/locations/%s/clusters/%s", info.ProjectID, info.Location, info.Name)
+	}
+}
+
+// Add queues summary, or drops it if the queue is full.
+func (q *ReconcileExportQueue) Add(summary *ReconcileSummary) {
+	q.mu.Lock()
+	summary.Cluster = q.cluster
+	q.mu.Unlock()
+	select {
+	case q.queue() <- summary:
+	default:
+		q.mu.Lock()
+		q.dropped++
+		q.mu.Unlock()
+	}
+}
+
+// Start sends the queued summaries until ctx is done, and then the ones that
+// are left.
+func (q *ReconcileExportQueue) Start(ctx context.Context) error {
+	interval := q.Interval
+	if interval <= 0 {
+		interval = ReconcileExportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*ReconcileSummary
+	for {
+		select {
+		case summary := <-q.queue():
+			batch = append(batch, summary)
+			if len(batch) < ReconcileExportBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			for {
+				select {
+				case summary := <-q.queue():
+					batch = append(batch, summary)
+				default:
+					// The manager context is done, the last batch gets a
+					// context of its own.
+					flushCtx, cancel := context.WithTimeout(context.Background(), interval)
+					q.flush(flushCtx, batch)
+					cancel()
+					return nil
+				}
+			}
+		}
+		q.flush(ctx, batch)
+		batch = nil
+	}
+}
+
+// flush sends batch in requests of at most ReconcileExportBatchSize
+// summaries. Failures are only logged, as the summaries are analytics.
+func (q *ReconcileExportQueue) flush(ctx context.Context, batch []*ReconcileSummary) {
+	logger := log.FromContext(ctx).WithName("reconcile-export")
+	q.mu.Lock()
+	dropped := q.dropped
+	q.dropped = 0
+	q.mu.Unlock()
+	if dropped > 0 {
+		logger.Info("Dropped reconcile summaries, the export queue was full", "dropped", dropped)
+	}
+	for len(batch) > 0 {
+		n := min(len(batch), ReconcileExportBatchSize)
+		if err := q.Exporter.Export(ctx, batch[:n]); err != nil {
+			logger.Error(err, "Failed to export reconcile summaries", "summaries", n)
+		}
+		batch = batch[n:]
+	}
+}
+
+// exportReconcile queues the summary of the reconcile of target, if
+// reconciles are exported.
+func (r *GenericReconciler) exportReconcile(ctx context.Context, target *unstructured.Unstructured, outcome, message string, changes []string) {
+	if r.ReconcileExports == nil {
+		return
+	}
+	summary := &ReconcileSummary{
+		Time:              time.Now().UTC(),
+		APIVersion:        target.GetAPIVersion(),
+		Kind:              target.GetKind(),
+		Namespace:         target.GetNamespace(),
+		Name:              target.GetName(),
+		Generation:        target.GetGeneration(),
+		Outcome:           outcome,
+		Message:           message,
+		DependentsChanged: append([]string(nil), changes...),
+	}
+	if c, ok := ctx.Value(dependentChangesKey{}).(*dependentChanges); ok && !c.started.IsZero() {
+		summary.DurationSeconds = time.Since(c.started).Seconds()
+	}
+	r.ReconcileExports.Add(summary)
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// fakeReconcileExporter records the exported summaries.
+type fakeReconcileExporter struct {
+	mu        sync.Mutex
+	summaries []*ReconcileSummary
+}
+
+func (e *fakeReconcileExporter) Export(ctx context.Context, summaries []*ReconcileSummary) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.summaries = append(e.summaries, summaries...)
+	return nil
+}
+
+func (e *fakeReconcileExporter) exported() []*ReconcileSummary {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*ReconcileSummary(nil), e.summaries...)
+}
+
+// newExportServer returns the client options of a server that records the
+// path and body of each request.
+func newExportServer(t *testing.T, requests map[string]json.RawMessage) []option.ClientOption {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body json.RawMessage
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		requests[req.URL.Path] = body
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+	return []option.ClientOption{option.WithEndpoint(server.URL), option.WithoutAuthentication()}
+}
+
+func TestNewReconcileExporter(t *testing.T) {
+	ctx := context.Background()
+	for _, location := range []string{"bigquery:projects/p/datasets/d", "logging:projects/p/topics/t", "pubsub:projects//topics/t", "logging:my-log"} {
+		_, err := NewReconcileExporter(ctx, location, option.WithoutAuthentication())
+		assert.ErrorContains(t, err, "invalid reconcile export", location)
+	}
+}
+
+func TestReconcileExporters(t *testing.T) {
+	ctx := context.Background()
+	summary := &ReconcileSummary{
+		Time:              time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+		Cluster:           "projects/my-project/locations/us-central1/clusters/serving",
+		APIVersion:        "model.skippy.io/v1",
+		Kind:              "InferenceDeployment",
+		Namespace:         "team-a",
+		Name:              "llama",
+		Generation:        3,
+		Outcome:           ReconcileFailed,
+		Message:           "quota exceeded",
+		DurationSeconds:   1.5,
+		DependentsChanged: []string{"Updated Deployment team-a/llama"},
+	}
+
+	t.Run("logging", func(t *testing.T) {
+		requests := map[string]json.RawMessage{}
+		exporter, err := NewReconcileExporter(ctx, "logging:projects/fleet/logs/karo-reconciles", newExportServer(t, requests)...)
+		require.NoError(t, err)
+		require.NoError(t, exporter.Export(ctx, []*ReconcileSummary{summary, {Time: summary.Time, Kind: "Agent", Name: "planner", Outcome: ReconcileSucceeded}}))
+
+		var request struct {
+			LogName string
+			Entries []struct {
+				JSONPayload ReconcileSummary `json:"jsonPayload"`
+				Resource    struct {
+					Type   string
+					Labels map[string]string
+				}
+				Severity  string
+				Timestamp string
+				Labels    map[string]string
+			}
+		}
+		require.NoError(t, json.Unmarshal(requests["/v2/entries:write"], &request))
+		assert.Equal(t, "projects/fleet/logs/karo-reconciles", request.LogName)
+		require.Len(t, request.Entries, 2)
+		assert.Equal(t, *summary, request.Entries[0].JSONPayload)
+		assert.Equal(t, "k8s_cluster", request.Entries[0].Resource.Type)
+		assert.Equal(t, map[string]string{"project_id": "my-project", "location": "us-central1", "cluster_name": "serving"}, request.Entries[0].Resource.Labels)
+		assert.Equal(t, "ERROR", request.Entries[0].Severity)
+		assert.Equal(t, "2026-10-17T08:00:00Z", request.Entries[0].Timestamp)
+		assert.Equal(t, map[string]string{"kind": "InferenceDeployment", "outcome": ReconcileFailed, "cluster": summary.Cluster}, request.Entries[0].Labels)
+		// Without the cluster, entries are written to the project of the log.
+		assert.Equal(t, "global", request.Entries[1].Resource.Type)
+		assert.Equal(t, map[string]string{"project_id": "fleet"}, request.Entries[1].Resource.Labels)
+		assert.Equal(t, "INFO", request.Entries[1].Severity)
+	})
+
+	t.Run("pubsub", func(t *testing.T) {
+		requests := map[string]json.RawMessage{}
+		exporter, err := NewReconcileExporter(ctx, "pubsub:projects/fleet/topics/reconciles", newExportServer(t, requests)...)
+		require.NoError(t, err)
+		require.NoError(t, exporter.Export(ctx, []*ReconcileSummary{summary}))
+
+		var request struct {
+			Messages []struct {
+				Data       string
+				Attributes map[string]string
+			}
+		}
+		require.NoError(t, json.Unmarshal(requests["/v1/projects/fleet/topics/reconciles:publish"], &request))
+		require.Len(t, request.Messages, 1)
+		data, err := base64.StdEncoding.DecodeString(request.Messages[0].Data)
+		require.NoError(t, err)
+		var published ReconcileSummary
+		require.NoError(t, json.Unmarshal(data, &published))
+		assert.Equal(t, *summary, published)
+		assert.Equal(t, ReconcileFailed, request.Messages[0].Attributes["outcome"])
+	})
+}
+
+func TestReconcileExportQueue(t *testing.T) {
+	exporter := &fakeReconcileExporter{}
+	queue := &ReconcileExportQueue{Exporter: exporter, Interval: 10 * time.Millisecond}
+	queue.SetCluster(&transformer.ClusterInfo{ProjectID: "my-project", Location: "us-central1", Name: "serving"})
+	queue.Add(&ReconcileSummary{Name: "llama"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- queue.Start(ctx) }()
+	require.Eventually(t, func() bool { return len(exporter.exported()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "projects/my-project/locations/us-central1/clusters/serving", exporter.exported()[0].Cluster)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// The summaries that are queued when the manager stops are still sent.
+	exporter = &fakeReconcileExporter{}
+	queue = &ReconcileExportQueue{Exporter: exporter, Interval: time.Hour}
+	queue.Add(&ReconcileSummary{Name: "gemma"})
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, queue.Start(ctx))
+	require.Len(t, exporter.exported(), 1)
+	assert.Equal(t, "gemma", exporter.exported()[0].Name)
+	assert.Empty(t, exporter.exported()[0].Cluster)
+}
+
+func TestRecordReconcileHistoryExports(t *testing.T) {
+	ctx, _ := withDependentChanges(context.Background())
+	for i := 0; i < maxHistoryChanges+2; i++ {
+		obj := newTestResource("worker", "team-a", eventTestGVK)
+		obj.SetName(string(rune('a' + i)))
+		obj.SetKind("Deployment")
+		recordDependentChange(ctx, "Updated", obj)
+	}
+	queue := &ReconcileExportQueue{}
+	r := &GenericReconciler{ReconcileHistory: 3, ReconcileExports: queue}
+	target := newTestResource("llama", "team-a", eventTestGVK)
+
+	require.NoError(t, r.recordReconcileHistory(ctx, target, false, nil))
+	summary := <-queue.queue()
+	assert.Equal(t, "llama", summary.Name)
+	assert.Equal(t, ReconcileSucceeded, summary.Outcome)
+	assert.Len(t, summary.DependentsChanged, maxHistoryChanges+2, "the summary lists every change, unlike the history")
+	assert.Equal(t, "Updated Deployment team-a/k", summary.DependentsChanged[maxHistoryChanges])
+	assert.Positive(t, summary.DurationSeconds)
+
+	// Reconciles that the history leaves out are not exported either.
+	unchanged, _ := withDependentChanges(context.Background())
+	require.NoError(t, r.recordReconcileHistory(unchanged, target, false, nil))
+	assert.Empty(t, queue.queue())
+
+	// Without a history, every reconcile is exported.
+	r.ReconcileHistory = 0
+	require.NoError(t, r.recordReconcileHistory(unchanged, target, false, nil))
+	assert.Len(t, queue.queue(), 1)
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// DefaultReconcileHistory is the default number of reconcile summaries
+	// kept in status.reconcileHistory.
+	DefaultReconcileHistory = 10
+
+	ReconcileSucceeded = "Succeeded"
+	ReconcileFailed    = "Failed"
+	ReconcileWaiting   = "Waiting"
+
+	// maxHistoryChanges caps the dependent changes listed per summary.
+	maxHistoryChanges = 10
+	// maxHistoryMessageLength caps the error message of a summary.
+	maxHistoryMessageLength = 512
+	// maxReconcileHistoryBytes bounds the encoded history, so that it cannot
+	// push the target towards the etcd object size limit. The oldest
+	// summaries are dropped first.
+	maxReconcileHistoryBytes = 16 << 10
+)
+
+// dependentChanges collects the dependents created or updated during a
+// reconcile. Dependents are applied in parallel, so it is locked.
+type dependentChanges struct {
+	mu      sync.Mutex
+	changes []string
+	// started is when the reconcile started, for the duration of exported
+	// summaries.
+	started time.Time
+}
+
+type dependentChangesKey struct{}
+
+// withDependentChanges returns a context that collects the dependents
+// changed by the reconcile that runs with it.
+func withDependentChanges(ctx context.Context) (context.Context, *dependentChanges) {
+	changes := &dependentChanges{started: time.Now()}
+	return context.WithValue(ctx, dependentChangesKey{}, changes), changes
+}
+
+// recordDependentChange records that obj was created or updated, if ctx
+// collects changes.
+func recordDependentChange(ctx context.Context, action string, obj *unstructured.Unstructured) {
+	changes, ok := ctx.Value(dependentChangesKey{}).(*dependentChanges)
+	if !ok {
+		return
+	}
+	name := obj.GetName()
+	if obj.GetNamespace() != "" {
+		name = obj.GetNamespace() + "/" + name
+	}
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+	changes.changes = append(changes.changes, fmt.Sprintf("%s %s %s", action, obj.GetKind(), name))
+}
+
+// list returns the changes sorted, as parallel applies record them in any
+// order.
+func (c *dependentChanges) list() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changes := append([]string(nil), c.changes...)
+	sort.Strings(changes)
+	return changes
+}
+
+// reconcileOutcome summarizes the result of a reconcile.
+func reconcileOutcome(failed bool, reconciliationErr error) string {
+	switch {
+	case classifyError(reconciliationErr) == ExternalDependencyNotReady:
+		return ReconcileWaiting
+	case failed || reconciliationErr != nil:
+		return ReconcileFailed
+	}
+	return ReconcileSucceeded
+}
+
+// recordReconcileHistory adds a summary of the reconcile to the front of
+// status.reconcileHistory of statusTarget, keeping at most ReconcileHistory
+// summaries, and exports it. A reconcile that changed no dependents and ended
+// like the last recorded one is neither added nor exported, so that the
+// periodic requeue does not write the status, and the history shows when
+// each outcome started. Without a history, every reconcile is exported.
+func (r *GenericReconciler) recordReconcileHistory(ctx context.Context, statusTarget *unstructured.Unstructured, failed bool, reconciliationErr error) error {
+	if r.ReconcileHistory <= 0 && r.ReconcileExports == nil {
+		return nil
+	}
+	var history []interface{}
+	if r.ReconcileHistory > 0 {
+		var err error
+		if history, _, err = unstructured.NestedSlice(statusTarget.Object, "status", "reconcileHistory"); err != nil {
+			// A malformed history is replaced rather than failing the
+			// reconcile.
+			history = nil
+		}
+	}
+
+	outcome := reconcileOutcome(failed, reconciliationErr)
+	message := ""
+	if reconciliationErr != nil {
+		message = truncateMessage(reconciliationErr.Error(), maxHistoryMessageLength)
+	} else if failed {
+		message = "One or more dependent resources failed to reconcile."
+	}
+	var changes []string
+	if c, ok := ctx.Value(dependentChangesKey{}).(*dependentChanges); ok {
+		changes = c.list()
+	}
+
+	if len(changes) == 0 && len(history) > 0 {
+		if last, ok := history[0].(map[string]interface{}); ok &&
+			last["outcome"] == outcome && last["message"] == nonEmpty(message) && last["generation"] == statusTarget.GetGeneration() {
+			return nil
+		}
+	}
+	r.exportReconcile(ctx, statusTarget, outcome, message, changes)
+	if r.ReconcileHistory <= 0 {
+		return nil
+	}
+
+	entry := map[string]interface{}{
+		"time":       time.Now().UTC().Format(time.RFC3339),
+		"generation": statusTarget.GetGeneration(),
+		"outcome":    outcome,
+	}
+	if message != "" {
+		entry["message"] = message
+	}
+	if len(changes) > maxHistoryChanges {
+		changes = append(changes[:maxHistoryChanges], fmt.Sprintf("... and %d more", len(changes)-maxHistoryChanges))
+	}
+	if len(changes) > 0 {
+		changed := make([]interface{}, len(changes))
+		for i, change := range changes {
+			changed[i] = change
+		}
+		entry["dependentsChanged"] = changed
+	}
+
+	history = append([]interface{}{entry}, history...)
+	if len(history) > r.ReconcileHistory {
+		history = history[:r.ReconcileHistory]
+	}
+	for len(history) > 1 {
+		data, err := json.Marshal(history)
+		if err != nil {
+			return fmt.Errorf("failed to encode reconcile history: %w", err)
+		}
+		if len(data) <= maxReconcileHistoryBytes {
+			break
+		}
+		history = history[:len(history)-1]
+	}
+	return unstructured.SetNestedSlice(statusTarget.Object, history, "status", "reconcileHistory")
+}
+
+// nonEmpty returns message, or nil for an empty message, as the entries of
+// the history leave out empty messages.
+func nonEmpty(message string) interface{} {
+	if message == "" {
+		return nil
+	}
+	return message
+}
+
+// truncateMessage shortens message to at most limit bytes.
+func truncateMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+	return message[:limit-3] + "..."
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func reconcileHistory(t *testing.T, target *unstructured.Unstructured) []map[string]interface{} {
+	t.Helper()
+	history, _, err := unstructured.NestedSlice(target.Object, "status", "reconcileHistory")
+	require.NoError(t, err)
+	entries := make([]map[string]interface{}, len(history))
+	for i, entry := range history {
+		entries[i] = entry.(map[string]interface{})
+	}
+	return entries
+}
+
+func TestRecordReconcileHistory(t *testing.T) {
+	newChanges := func(names ...string) context.Context {
+		ctx, _ := withDependentChanges(context.Background())
+		for _, name := range names {
+			obj := newTestResource(name, "team-a", eventTestGVK)
+			obj.SetKind("Deployment")
+			recordDependentChange(ctx, "Updated", obj)
+		}
+		return ctx
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		target := newTestResource("llama", "team-a", eventTestGVK)
+		require.NoError(t, (&GenericReconciler{}).recordReconcileHistory(newChanges("llama"), target, false, nil))
+		assert.Empty(t, reconcileHistory(t, target))
+	})
+
+	t.Run("records changes and new outcomes", func(t *testing.T) {
+		r := &GenericReconciler{ReconcileHistory: 3}
+		target := newTestResource("llama", "team-a", eventTestGVK)
+
+		require.NoError(t, r.recordReconcileHistory(newChanges("worker", "server"), target, false, nil))
+		history := reconcileHistory(t, target)
+		require.Len(t, history, 1)
+		assert.Equal(t, ReconcileSucceeded, history[0]["outcome"])
+		assert.Equal(t, int64(1), history[0]["generation"])
+		assert.NotEmpty(t, history[0]["time"])
+		assert.Equal(t, []interface{}{"Updated Deployment team-a/server", "Updated Deployment team-a/worker"}, history[0]["dependentsChanged"])
+		assert.NotContains(t, history[0], "message")
+
+		// The periodic requeue changes nothing and is not recorded.
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, false, nil))
+		assert.Len(t, reconcileHistory(t, target), 1)
+
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, true, stderrors.New("quota exceeded")))
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, true, stderrors.New("quota exceeded")))
+		history = reconcileHistory(t, target)
+		require.Len(t, history, 2)
+		assert.Equal(t, ReconcileFailed, history[0]["outcome"])
+		assert.Equal(t, "quota exceeded", history[0]["message"])
+
+		waitErr := &RequirementsNotReadyError{Unready: []string{"example.com/v1/NotInstalled is not served"}}
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, true, waitErr))
+		require.NoError(t, r.recordReconcileHistory(newChanges("server"), target, false, nil))
+		history = reconcileHistory(t, target)
+		require.Len(t, history, 3, "the oldest summaries are dropped")
+		assert.Equal(t, []string{ReconcileSucceeded, ReconcileWaiting, ReconcileFailed},
+			[]string{history[0]["outcome"].(string), history[1]["outcome"].(string), history[2]["outcome"].(string)})
+	})
+
+	t.Run("a new generation is recorded", func(t *testing.T) {
+		r := &GenericReconciler{ReconcileHistory: 3}
+		target := newTestResource("llama", "team-a", eventTestGVK)
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, false, nil))
+		target.SetGeneration(2)
+		require.NoError(t, r.recordReconcileHistory(newChanges(), target, false, nil))
+		history := reconcileHistory(t, target)
+		require.Len(t, history, 2)
+		assert.Equal(t, int64(2), history[0]["generation"])
+	})
+
+	t.Run("caps the changes listed", func(t *testing.T) {
+		r := &GenericReconciler{ReconcileHistory: 3}
+		target := newTestResource("llama", "team-a", eventTestGVK)
+		var names []string
+		for i := 0; i < maxHistoryChanges+5; i++ {
+			names = append(names, fmt.Sprintf("worker-%02d", i))
+		}
+		require.NoError(t, r.recordReconcileHistory(newChanges(names...), target, false, nil))
+		changed := reconcileHistory(t, target)[0]["dependentsChanged"].([]interface{})
+		require.Len(t, changed, maxHistoryChanges+1)
+		assert.Equal(t, "... and 5 more", changed[maxHistoryChanges])
+	})
+
+	t.Run("stays under the size limit", func(t *testing.T) {
+		r := &GenericReconciler{ReconcileHistory: 1000}
+		target := newTestResource("llama", "team-a", eventTestGVK)
+		for i := 0; i < 200; i++ {
+			err := fmt.Errorf("attempt %d: %s", i, strings.Repeat("x", 2*maxHistoryMessageLength))
+			require.NoError(t, r.recordReconcileHistory(newChanges(), target, true, err))
+		}
+		history, _, err := unstructured.NestedSlice(target.Object, "status", "reconcileHistory")
+		require.NoError(t, err)
+		data, err := json.Marshal(history)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), maxReconcileHistoryBytes)
+		assert.Greater(t, len(history), 1)
+		newest := history[0].(map[string]interface{})
+		assert.True(t, strings.HasPrefix(newest["message"].(string), "attempt 199: "))
+		assert.Len(t, newest["message"], maxHistoryMessageLength)
+	})
+}
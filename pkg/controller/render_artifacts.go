@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-logr/logr"
+	"google.golang.org/api/iterator"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// RenderArtifactsConfigMap stores render artifacts in ConfigMaps next to
+	// the resources.
+	RenderArtifactsConfigMap = "configmap"
+	// DefaultRenderArtifactRetention is the number of generations of a
+	// resource whose render artifacts are kept.
+	DefaultRenderArtifactRetention = 10
+
+	// RenderArtifactOfLabel holds the UID of the resource that a render
+	// artifact ConfigMap belongs to.
+	RenderArtifactOfLabel = "model.skippy.io/render-artifact-of"
+	// RenderArtifactGenerationAnnotation holds the generation of the resource
+	// that a render artifact was rendered for.
+	RenderArtifactGenerationAnnotation = "model.skippy.io/render-generation"
+	// RenderArtifactHashAnnotation holds the hash of the render inputs of an
+	// artifact, as recorded in status.renderHash.
+	RenderArtifactHashAnnotation = "model.skippy.io/render-hash"
+
+	renderArtifactKey           = "manifests.yaml"
+	compressedRenderArtifactKey = "manifests.yaml.gz"
+	// maxConfigMapArtifactSize leaves room below the 1MiB limit of a
+	// ConfigMap for its metadata. Larger artifacts are compressed.
+	maxConfigMapArtifactSize = 900 * 1024
+)
+
+// RenderArtifactStore keeps the dependents applied for each generation of a
+// resource, so that what was applied for a past generation can be inspected.
+type RenderArtifactStore interface {
+	// Save stores the dependents rendered for the current generation of
+	// target, replacing an earlier artifact of the same generation, and
+	// deletes the artifacts of generations beyond the retention.
+	Save(ctx context.Context, target *unstructured.Unstructured, hash string, objs []*unstructured.Unstructured) error
+}
+
+// NewRenderArtifactStore returns the store for location, which is either
+// RenderArtifactsConfigMap or a gs://bucket/prefix URI. Artifacts of the
+// newest retention generations of each resource are kept.
+func NewRenderArtifactStore(ctx context.Context, location string, c client.Client, retention int) (RenderArtifactStore, error) {
+	if retention < 1 {
+		return nil, fmt.Errorf("render artifact retention must be at least 1, got %d", retention)
+	}
+	if location == RenderArtifactsConfigMap {
+		return &configMapArtifactStore{client: c, retention: retention}, nil
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "gs://"), "/")
+	if !strings.HasPrefix(location, "gs://") || bucket == "" {
+		return nil, fmt.Errorf("invalid render artifact store %q, expected %q or gs://bucket/prefix", location, RenderArtifactsConfigMap)
+	}
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client for render artifacts: %w", err)
+	}
+	return &gcsArtifactStore{bucket: gcs.Bucket(bucket), prefix: strings.Trim(prefix, "/"), retention: retention}, nil
+}
+
+// saveRenderArtifacts stores the applied dependents if their hash differs
+// from the one recorded in the status of the target before this reconcile.
+// Failures are only logged, as the artifacts are a debugging aid.
+func (r *GenericReconciler) saveRenderArtifacts(ctx context.Context, log logr.Logger, originalTarget, target *unstructured.Unstructured, hash string, objs []*unstructured.Unstructured) {
+	if r.RenderArtifacts == nil || hash == "" {
+		return
+	}
+	if previous, _, _ := unstructured.NestedString(originalTarget.Object, "status", "renderHash"); previous == hash {
+		return
+	}
+	if err := r.RenderArtifacts.Save(ctx, target, hash, objs); err != nil {
+		log.Error(err, "failed to save render artifacts", "generation", target.GetGeneration())
+	}
+}
+
+// encodeRenderArtifact encodes objs as a multi-document YAML stream, with
+// Secret data and other credentials redacted.
+func encodeRenderArtifact(objs []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		data, err := yaml.Marshal(transformer.RedactManifest(obj).Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// configMapArtifactStore stores each artifact in a ConfigMap in the namespace
+// of its resource, owned by the resource so that it is deleted with it.
+type configMapArtifactStore struct {
+	client    client.Client
+	retention int
+}
+
+func (s *configMapArtifactStore) Save(ctx context.Context, target *unstructured.Unstructured, hash string, objs []*unstructured.Unstructured) error {
+	if target.GetNamespace() == "" {
+		return fmt.Errorf("render artifacts of cluster-scoped %s %s cannot be stored in a ConfigMap, use a gs:// store", target.GetKind(), target.GetName())
+	}
+	manifests, err := encodeRenderArtifact(objs)
+	if err != nil {
+		return err
+	}
+
+	generation := strconv.FormatInt(target.GetGeneration(), 10)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("karo-render-%s-%s", target.GetUID(), generation),
+			Namespace: target.GetNamespace(),
+			Labels:    map[string]string{RenderArtifactOfLabel: string(target.GetUID())},
+			Annotations: map[string]string{
+				RenderArtifactGenerationAnnotation: generation,
+				RenderArtifactHashAnnotation:       hash,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: target.GetAPIVersion(),
+				Kind:       target.GetKind(),
+				Name:       target.GetName(),
+				UID:        target.GetUID(),
+			}},
+		},
+	}
+	if len(manifests) <= maxConfigMapArtifactSize {
+		configMap.Data = map[string]string{renderArtifactKey: string(manifests)}
+	} else {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(manifests); err != nil {
+			return fmt.Errorf("failed to compress render artifact: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to compress render artifact: %w", err)
+		}
+		configMap.BinaryData = map[string][]byte{compressedRenderArtifactKey: compressed.Bytes()}
+	}
+
+	if err := s.client.Create(ctx, configMap); apierrors.IsAlreadyExists(err) {
+		existing := &corev1.ConfigMap{}
+		if err := s.client.Get(ctx, client.ObjectKeyFromObject(configMap), existing); err != nil {
+			return fmt.Errorf("failed to get render artifact %s/%s: %w", configMap.Namespace, configMap.Name, err)
+		}
+		configMap.ResourceVersion = existing.ResourceVersion
+		if err := s.client.Update(ctx, configMap); err != nil {
+			return fmt.Errorf("failed to update render artifact %s/%s: %w", configMap.Namespace, configMap.Name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to create render artifact %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+
+	artifacts := &corev1.ConfigMapList{}
+	if err := s.client.List(ctx, artifacts, client.InNamespace(target.GetNamespace()), client.MatchingLabels{RenderArtifactOfLabel: string(target.GetUID())}); err != nil {
+		return fmt.Errorf("failed to list render artifacts of %s %s/%s: %w", target.GetKind(), target.GetNamespace(), target.GetName(), err)
+	}
+	generations := make(map[int64]*corev1.ConfigMap, len(artifacts.Items))
+	for i := range artifacts.Items {
+		artifact := &artifacts.Items[i]
+		if generation, err := strconv.ParseInt(artifact.Annotations[RenderArtifactGenerationAnnotation], 10, 64); err == nil {
+			generations[generation] = artifact
+		}
+	}
+	var errs []error
+	for _, generation := range expiredGenerations(generations, s.retention) {
+		if err := s.client.Delete(ctx, generations[generation]); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete render artifact %s/%s: %w", target.GetNamespace(), generations[generation].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// gcsArtifactStore stores each artifact as the object
+// <prefix>/<namespace>/<name>/<uid>/<generation>.yaml.
+type gcsArtifactStore struct {
+	bucket    *storage.BucketHandle
+	prefix    string
+	retention int
+}
+
+func (s *gcsArtifactStore) Save(ctx context.Context, target *unstructured.Unstructured, hash string, objs []*unstructured.Unstructured) error {
+	manifests, err := encodeRenderArtifact(objs)
+	if err != nil {
+		return err
+	}
+	namespace := target.GetNamespace()
+	if namespace == "" {
+		namespace = "_cluster"
+	}
+	dir := path.Join(s.prefix, namespace, target.GetName(), string(target.GetUID())) + "/"
+	objectName := fmt.Sprintf("%s%d.yaml", dir, target.GetGeneration())
+
+	writer := s.bucket.Object(objectName).NewWriter(ctx)
+	writer.ContentType = "application/yaml"
+	writer.Metadata = map[string]string{
+		RenderArtifactGenerationAnnotation: strconv.FormatInt(target.GetGeneration(), 10),
+		RenderArtifactHashAnnotation:       hash,
+	}
+	if _, err := writer.Write(manifests); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write render artifact %s: %w", objectName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write render artifact %s: %w", objectName, err)
+	}
+
+	generations := map[int64]string{}
+	objects := s.bucket.Objects(ctx, &storage.Query{Prefix: dir})
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list render artifacts under %s: %w", dir, err)
+		}
+		if generation, err := strconv.ParseInt(strings.TrimSuffix(path.Base(attrs.Name), ".yaml"), 10, 64); err == nil {
+			generations[generation] = attrs.Name
+		}
+	}
+	var errs []error
+	for _, generation := range expiredGenerations(generations, s.retention) {
+		if err := s.bucket.Object(generations[generation]).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			errs = append(errs, fmt.Errorf("failed to delete render artifact %s: %w", generations[generation], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expiredGenerations returns the generations beyond the newest retention.
+func expiredGenerations[T any](generations map[int64]T, retention int) []int64 {
+	sorted := make([]int64, 0, len(generations))
+	for generation := range generations {
+		sorted = append(sorted, generation)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	if len(sorted) <= retention {
+		return nil
+	}
+	return sorted[retention:]
+}
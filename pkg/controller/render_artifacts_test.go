@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// renderArtifactTarget returns a target of the given generation.
+func renderArtifactTarget(generation int64) *unstructured.Unstructured {
+	target := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "model.skippy.io/v1",
+		"kind":       "ModelServer",
+		"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+	}}
+	target.SetUID(types.UID("1234"))
+	target.SetGeneration(generation)
+	return target
+}
+
+// renderArtifactObjects returns a Deployment and a Secret as rendered.
+func renderArtifactObjects() []*unstructured.Unstructured {
+	return []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec":       map[string]interface{}{"replicas": 2},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "llama-token", "namespace": "default"},
+			"stringData": map[string]interface{}{"token": "hf_secret"},
+		}},
+	}
+}
+
+func TestConfigMapArtifactStore(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	store, err := NewRenderArtifactStore(ctx, RenderArtifactsConfigMap, c, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(ctx, renderArtifactTarget(1), "hash-1", renderArtifactObjects()))
+
+	artifact := &corev1.ConfigMap{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "karo-render-1234-1"}, artifact))
+	assert.Equal(t, "1234", artifact.Labels[RenderArtifactOfLabel])
+	assert.Equal(t, "1", artifact.Annotations[RenderArtifactGenerationAnnotation])
+	assert.Equal(t, "hash-1", artifact.Annotations[RenderArtifactHashAnnotation])
+	require.Len(t, artifact.OwnerReferences, 1)
+	assert.Equal(t, "ModelServer", artifact.OwnerReferences[0].Kind)
+	assert.Equal(t, types.UID("1234"), artifact.OwnerReferences[0].UID)
+	manifests := artifact.Data[renderArtifactKey]
+	assert.Contains(t, manifests, "kind: Deployment")
+	assert.Contains(t, manifests, "---\n")
+	assert.Contains(t, manifests, "token: '[REDACTED]'")
+	assert.NotContains(t, manifests, "hf_secret")
+
+	t.Run("the artifact of a generation is replaced", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, renderArtifactTarget(1), "hash-1b", renderArtifactObjects()[:1]))
+		artifact := &corev1.ConfigMap{}
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "karo-render-1234-1"}, artifact))
+		assert.Equal(t, "hash-1b", artifact.Annotations[RenderArtifactHashAnnotation])
+		assert.NotContains(t, artifact.Data[renderArtifactKey], "Secret")
+	})
+
+	t.Run("artifacts beyond the retention are deleted", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, renderArtifactTarget(2), "hash-2", renderArtifactObjects()))
+		require.NoError(t, store.Save(ctx, renderArtifactTarget(3), "hash-3", renderArtifactObjects()))
+
+		artifacts := &corev1.ConfigMapList{}
+		require.NoError(t, c.List(ctx, artifacts, client.MatchingLabels{RenderArtifactOfLabel: "1234"}))
+		var names []string
+		for _, artifact := range artifacts.Items {
+			names = append(names, artifact.Name)
+		}
+		assert.ElementsMatch(t, []string{"karo-render-1234-2", "karo-render-1234-3"}, names)
+	})
+
+	t.Run("large artifacts are compressed", func(t *testing.T) {
+		objs := renderArtifactObjects()[:1]
+		objs[0].SetAnnotations(map[string]string{"description": strings.Repeat("x", maxConfigMapArtifactSize)})
+		require.NoError(t, store.Save(ctx, renderArtifactTarget(4), "hash-4", objs))
+
+		artifact := &corev1.ConfigMap{}
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "karo-render-1234-4"}, artifact))
+		assert.Empty(t, artifact.Data)
+		reader, err := gzip.NewReader(bytes.NewReader(artifact.BinaryData[compressedRenderArtifactKey]))
+		require.NoError(t, err)
+		manifests, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(manifests), "kind: Deployment")
+	})
+
+	t.Run("cluster-scoped resources are rejected", func(t *testing.T) {
+		target := renderArtifactTarget(1)
+		target.SetNamespace("")
+		assert.ErrorContains(t, store.Save(ctx, target, "hash", nil), "use a gs:// store")
+	})
+}
+
+func TestGCSArtifactStore(t *testing.T) {
+	ctx := context.Background()
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "artifacts", Name: "placeholder"}},
+		},
+		Host: "127.0.0.1",
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.Stop)
+	gcs, err := storage.NewClient(ctx, option.WithHTTPClient(server.HTTPClient()))
+	require.NoError(t, err)
+	store := &gcsArtifactStore{bucket: gcs.Bucket("artifacts"), prefix: "karo", retention: 2}
+
+	for generation := int64(1); generation <= 3; generation++ {
+		require.NoError(t, store.Save(ctx, renderArtifactTarget(generation), "hash", renderArtifactObjects()))
+	}
+
+	var names []string
+	objects := gcs.Bucket("artifacts").Objects(ctx, &storage.Query{Prefix: "karo/"})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, attrs.Name)
+	}
+	assert.ElementsMatch(t, []string{"karo/default/llama/1234/2.yaml", "karo/default/llama/1234/3.yaml"}, names)
+
+	content, err := server.GetObject("artifacts", "karo/default/llama/1234/3.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "3", content.Metadata[RenderArtifactGenerationAnnotation])
+	assert.Contains(t, string(content.Content), "kind: Deployment")
+	assert.NotContains(t, string(content.Content), "hf_secret")
+}
+
+func TestNewRenderArtifactStore(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		location  string
+		retention int
+		err       string
+	}{
+		{location: "s3://bucket/prefix", retention: 1, err: "invalid render artifact store"},
+		{location: "gs://", retention: 1, err: "invalid render artifact store"},
+		{location: "configmaps", retention: 1, err: "invalid render artifact store"},
+		{location: RenderArtifactsConfigMap, retention: 0, err: "at least 1"},
+	} {
+		t.Run(tc.location, func(t *testing.T) {
+			_, err := NewRenderArtifactStore(ctx, tc.location, nil, tc.retention)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestExpiredGenerations(t *testing.T) {
+	generations := map[int64]string{3: "c", 1: "a", 10: "j", 2: "b"}
+	assert.Equal(t, []int64{2, 1}, expiredGenerations(generations, 2))
+	assert.Nil(t, expiredGenerations(generations, 4))
+}
+
+// recordingArtifactStore records the generations it is asked to save.
+type recordingArtifactStore struct {
+	saved []int64
+}
+
+func (s *recordingArtifactStore) Save(ctx context.Context, target *unstructured.Unstructured, hash string, objs []*unstructured.Unstructured) error {
+	s.saved = append(s.saved, target.GetGeneration())
+	return nil
+}
+
+func TestSaveRenderArtifacts(t *testing.T) {
+	ctx := context.Background()
+	store := &recordingArtifactStore{}
+	r := &GenericReconciler{RenderArtifacts: store}
+
+	original := renderArtifactTarget(1)
+	require.NoError(t, unstructured.SetNestedField(original.Object, "hash-1", "status", "renderHash"))
+	r.saveRenderArtifacts(ctx, logr.Discard(), original, renderArtifactTarget(1), "hash-1", nil)
+	assert.Empty(t, store.saved, "unchanged renders are not stored again")
+
+	r.saveRenderArtifacts(ctx, logr.Discard(), original, renderArtifactTarget(2), "hash-2", nil)
+	assert.Equal(t, []int64{2}, store.saved)
+
+	(&GenericReconciler{}).saveRenderArtifacts(ctx, logr.Discard(), original, renderArtifactTarget(3), "hash-3", nil)
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// fullApplyInterval is how long a target whose render inputs are unchanged
+// may go without being rendered and applied. Applying the dependents again
+// repairs drift, e.g. a deleted Service, and picks up changed responses of
+// context requests and retagged images, which the input hash does not cover.
+const fullApplyInterval = 10 * time.Minute
+
+// renderInputHash returns the hash of the render inputs of target, or "" if it
+// cannot be computed, in which case the target is rendered.
+func (r *GenericReconciler) renderInputHash(ctx context.Context, log logr.Logger, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, target *unstructured.Unstructured) string {
+	hash, err := r.Transformer.InputHash(ctx, discoveryClient, dynamicClient, r.Client, target)
+	if err != nil {
+		// The render fails on the same inputs and reports the error.
+		log.Error(err, "failed to hash render inputs")
+		return ""
+	}
+	return hash
+}
+
+// unchangedDependents reports whether rendering and applying the dependents
+// can be skipped, because the target is ready, status.renderHash matches the
+// input hash and status.lastAppliedTime is less than fullApplyInterval ago. It
+// returns the recorded dependents, which stay valid, and objects that identify
+// them for the checks of live dependents. Dependents under a rollout are
+// always applied, as applying them advances the rollout.
+func (r *GenericReconciler) unchangedDependents(ctx context.Context, target *unstructured.Unstructured, hash string) ([]map[string]interface{}, []*unstructured.Unstructured, bool) {
+	if hash == "" || !target.GetDeletionTimestamp().IsZero() || r.rolloutSpec() != nil || !isReadyForGeneration(target) {
+		return nil, nil, false
+	}
+	if appliedHash, _, _ := unstructured.NestedString(target.Object, "status", "renderHash"); appliedHash != hash {
+		return nil, nil, false
+	}
+	appliedTime, _, _ := unstructured.NestedString(target.Object, "status", "lastAppliedTime")
+	applied, err := time.Parse(time.RFC3339, appliedTime)
+	if err != nil || time.Since(applied) >= fullApplyInterval {
+		return nil, nil, false
+	}
+	dependents, err := recordedDependents(ctx, r.Client, target)
+	if err != nil {
+		return nil, nil, false
+	}
+	objs, ok := dependentObjects(dependents)
+	if !ok {
+		return nil, nil, false
+	}
+	return dependents, objs, true
+}
+
+// dependentObjects returns objects with the apiVersion, kind, name and
+// namespace of the recorded dependents. It returns false if a dependent was
+// recorded without its apiVersion.
+func dependentObjects(dependents []map[string]interface{}) ([]*unstructured.Unstructured, bool) {
+	objs := make([]*unstructured.Unstructured, 0, len(dependents))
+	for _, dependent := range dependents {
+		apiVersion, _ := dependent["apiVersion"].(string)
+		kind, _ := dependent["kind"].(string)
+		name, _ := dependent["name"].(string)
+		namespace, _ := dependent["namespace"].(string)
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if apiVersion == "" || err != nil {
+			return nil, false
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gv.WithKind(kind))
+		obj.SetName(name)
+		obj.SetNamespace(namespace)
+		objs = append(objs, obj)
+	}
+	return objs, true
+}
+
+// recordApplied stores the input hash of the dependents that were just
+// applied, and when they were applied, in the status of the target. Targets
+// that are being deleted are not recorded.
+func (r *GenericReconciler) recordApplied(target *unstructured.Unstructured, hash string) {
+	if hash == "" || !target.GetDeletionTimestamp().IsZero() {
+		return
+	}
+	unstructured.SetNestedField(target.Object, hash, "status", "renderHash")
+	unstructured.SetNestedField(target.Object, time.Now().UTC().Format(time.RFC3339), "status", "lastAppliedTime")
+}
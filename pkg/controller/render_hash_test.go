@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestUnchangedDependents(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	dependent := map[string]interface{}{"apiVersion": "v1", "kind": "Service", "name": "vllm", "namespace": "default"}
+	newTarget := func(ready bool, hash string, appliedAt time.Time) *unstructured.Unstructured {
+		target := newTestResource("test-resource", "default", targetGVK)
+		target.SetUID(types.UID("uid-1"))
+		target.SetGeneration(2)
+		status := "False"
+		if ready {
+			status = "True"
+		}
+		_ = unstructured.SetNestedSlice(target.Object, []interface{}{
+			map[string]interface{}{"type": ReadyConditionType, "status": status, "observedGeneration": int64(2)},
+		}, "status", "conditions")
+		_ = unstructured.SetNestedSlice(target.Object, []interface{}{dependent}, "status", "dependentResources")
+		if hash != "" {
+			_ = unstructured.SetNestedField(target.Object, hash, "status", "renderHash")
+			_ = unstructured.SetNestedField(target.Object, appliedAt.UTC().Format(time.RFC3339), "status", "lastAppliedTime")
+		}
+		return target
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		target := newTarget(true, "", time.Time{})
+		r.recordApplied(target, "hash-1")
+		appliedHash, _, _ := unstructured.NestedString(target.Object, "status", "renderHash")
+		assert.Equal(t, "hash-1", appliedHash)
+
+		dependents, objs, ok := r.unchangedDependents(context.Background(), target, "hash-1")
+		require.True(t, ok)
+		assert.Equal(t, []map[string]interface{}{dependent}, dependents)
+		require.Len(t, objs, 1)
+		assert.Equal(t, schema.GroupVersionKind{Version: "v1", Kind: "Service"}, objs[0].GroupVersionKind())
+		assert.Equal(t, "default/vllm", objs[0].GetNamespace()+"/"+objs[0].GetName())
+	})
+
+	t.Run("recorded by another process", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(true, "hash-1", time.Now()), "hash-1")
+		assert.True(t, ok, "the status is trusted after a restart or failover")
+	})
+
+	t.Run("hash changed", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(true, "hash-1", time.Now()), "hash-2")
+		assert.False(t, ok)
+	})
+
+	t.Run("no hash", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(true, "hash-1", time.Now()), "")
+		assert.False(t, ok, "inputs that could not be hashed are rendered")
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(false, "hash-1", time.Now()), "hash-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("being deleted", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		target := newTarget(true, "hash-1", time.Now())
+		target.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+		_, _, ok := r.unchangedDependents(context.Background(), target, "hash-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("full apply interval elapsed", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(true, "hash-1", time.Now().Add(-fullApplyInterval)), "hash-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("dependent without apiVersion", func(t *testing.T) {
+		r := &GenericReconciler{Gvk: targetGVK}
+		target := newTarget(true, "hash-1", time.Now())
+		_ = unstructured.SetNestedSlice(target.Object, []interface{}{
+			map[string]interface{}{"kind": "Service", "name": "vllm", "namespace": "default"},
+		}, "status", "dependentResources")
+		_, _, ok := r.unchangedDependents(context.Background(), target, "hash-1")
+		assert.False(t, ok, "dependents recorded before apiVersion was recorded are applied again")
+	})
+
+	t.Run("rollout configured", func(t *testing.T) {
+		r := &GenericReconciler{
+			Gvk: targetGVK,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{Rollout: &modelv1.IntegrationRolloutSpec{}}, true
+				}}
+			}},
+		}
+		_, _, ok := r.unchangedDependents(context.Background(), newTarget(true, "hash-1", time.Now()), "hash-1")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RequeueAfterAnnotation sets how long to wait before a target is reconciled
+// again after a successful reconciliation, e.g. "30s" or "10m". It can be set
+// on the target itself or on its rendered dependents, where templates can
+// derive it from their context to poll slow external systems less often. The
+// shortest interval wins.
+const RequeueAfterAnnotation = "karo.gke.io/requeue-after"
+
+// DefaultRequeueAfter is how long to wait before a target without a requeue
+// hint is reconciled again.
+const DefaultRequeueAfter = 5 * time.Second
+
+// minRequeueAfter bounds the requeue hints, so that a template cannot make
+// the operator reconcile in a tight loop.
+const minRequeueAfter = time.Second
+
+// requeueAfter returns how long to wait before target is reconciled again,
+// see RequeueAfterAnnotation. Invalid hints are logged and ignored.
+func requeueAfter(log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured) time.Duration {
+	var after time.Duration
+	for _, obj := range append([]*unstructured.Unstructured{target}, objs...) {
+		value, ok := obj.GetAnnotations()[RequeueAfterAnnotation]
+		if !ok {
+			continue
+		}
+		hint, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || hint <= 0 {
+			log.Info("Ignoring invalid requeue hint", "kind", obj.GetKind(), "name", obj.GetName(), "value", value)
+			continue
+		}
+		if after == 0 || hint < after {
+			after = hint
+		}
+	}
+	switch {
+	case after == 0:
+		return DefaultRequeueAfter
+	case after < minRequeueAfter:
+		return minRequeueAfter
+	}
+	return after
+}
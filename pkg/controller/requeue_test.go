@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func requeueHinted(kind, hint string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"kind": kind}}
+	obj.SetName("llama")
+	if hint != "" {
+		obj.SetAnnotations(map[string]string{"karo.gke.io/requeue-after": hint})
+	}
+	return obj
+}
+
+func TestRequeueAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+		deps   []string
+		want   time.Duration
+	}{
+		{name: "no hints", want: DefaultRequeueAfter},
+		{name: "hint on the target", target: "2m", want: 2 * time.Minute},
+		{name: "hint on a dependent", deps: []string{"", "30s"}, want: 30 * time.Second},
+		{name: "shortest hint wins", target: "10m", deps: []string{"1m", "45s"}, want: 45 * time.Second},
+		{name: "invalid hints are ignored", target: "soon", deps: []string{"-5s", "1m"}, want: time.Minute},
+		{name: "only invalid hints", deps: []string{"0s"}, want: DefaultRequeueAfter},
+		{name: "short hints are bounded", deps: []string{" 10ms "}, want: minRequeueAfter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var objs []*unstructured.Unstructured
+			for _, hint := range tc.deps {
+				objs = append(objs, requeueHinted("Job", hint))
+			}
+			assert.Equal(t, tc.want, requeueAfter(logr.Discard(), requeueHinted("ModelData", tc.target), objs))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	WaitingConditionType         = "Waiting"
+	RequirementsNotReadyReason   = "RequirementsNotReady"
+	RequirementsReadyReason      = "RequirementsReady"
+	WaitingForRequirementsReason = "WaitingForRequirements"
+	WaitingForRequirementsEvent  = modelv1.EventReasonWaitingForRequirements
+
+	// RequirementsRecheckInterval is how long to wait before integrations and
+	// resources that wait for required kinds are checked again.
+	RequirementsRecheckInterval = 10 * time.Second
+)
+
+// RequirementsNotReadyError is returned when kinds that an integration
+// requires are not ready, so that its resources are not rendered.
+type RequirementsNotReadyError struct {
+	Unready []string
+}
+
+func (e *RequirementsNotReadyError) Error() string {
+	return fmt.Sprintf("waiting for required kind(s): %s", strings.Join(e.Unready, "; "))
+}
+
+func requirementGVK(requirement modelv1.IntegrationRequirementSpec) schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: requirement.Group, Version: requirement.Version, Kind: requirement.Kind}
+}
+
+// unreadyRequirements describes the required kinds that are not ready: the
+// ones that the API server does not serve, e.g. because the CRD of another
+// operator is not installed yet, and the ones whose integration is declared
+// but not started.
+func unreadyRequirements(mapper meta.RESTMapper, requires []modelv1.IntegrationRequirementSpec, declared, started map[schema.GroupVersionKind]bool) []string {
+	var unready []string
+	for _, requirement := range requires {
+		gvk := requirementGVK(requirement)
+		gvkString := fmt.Sprintf("%s/%s/%s", gvk.Group, gvk.Version, gvk.Kind)
+		if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			unready = append(unready, fmt.Sprintf("%s is not served", gvkString))
+			continue
+		}
+		if declared[gvk] && !started[gvk] {
+			unready = append(unready, fmt.Sprintf("integration %s is not started", gvkString))
+		}
+	}
+	return unready
+}
+
+// checkRequirements checks that the kinds required by the integration of the
+// target are still served before its templates are rendered, e.g. after the
+// CRD of a required kind was deleted. Targets of integrations without
+// requirements get no Waiting condition.
+func (r *GenericReconciler) checkRequirements(target *unstructured.Unstructured) error {
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(target.GroupVersionKind())
+	requires := integrationSpec.Requires
+	if len(requires) == 0 {
+		return nil
+	}
+	unready := unreadyRequirements(r.Client.RESTMapper(), requires, nil, nil)
+	// A wait for an object that the templates wait for keeps its condition,
+	// which records since when the target waits.
+	if existing := meta.FindStatusCondition(targetConditions(target), WaitingConditionType); len(unready) == 0 && existing != nil &&
+		existing.Status == metav1.ConditionTrue && (existing.Reason == DependencyNotReadyReason || existing.Reason == DependencyTimedOutReason) {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               WaitingConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             RequirementsReadyReason,
+		Message:            "All required kinds are ready.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(unready) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = RequirementsNotReadyReason
+		condition.Message = fmt.Sprintf("Waiting for required kind(s): %s", strings.Join(unready, "; "))
+		if !meta.IsStatusConditionTrue(targetConditions(target), WaitingConditionType) {
+			r.eventf(target, corev1.EventTypeNormal, WaitingForRequirementsEvent, "Not rendering %s %s: %s", target.GetKind(), target.GetName(), strings.Join(unready, "; "))
+		}
+	}
+	if err := setTargetCondition(target, condition); err != nil {
+		return err
+	}
+	if len(unready) > 0 {
+		return &RequirementsNotReadyError{Unready: unready}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+var (
+	modelDataRequirement    = modelv1.IntegrationRequirementSpec{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"}
+	notInstalledRequirement = modelv1.IntegrationRequirementSpec{Group: "example.com", Version: "v1", Kind: "NotInstalled"}
+)
+
+func TestUnreadyRequirements(t *testing.T) {
+	mapper := newScopeMapper()
+	requires := []modelv1.IntegrationRequirementSpec{modelDataRequirement, notInstalledRequirement}
+	modelDataGVK := requirementGVK(modelDataRequirement)
+
+	assert.Equal(t, []string{"example.com/v1/NotInstalled is not served"}, unreadyRequirements(mapper, requires, nil, nil))
+
+	declared := map[schema.GroupVersionKind]bool{modelDataGVK: true}
+	assert.Equal(t, []string{
+		"integration model.skippy.io/v1/ModelData is not started",
+		"example.com/v1/NotInstalled is not served",
+	}, unreadyRequirements(mapper, requires, declared, nil))
+
+	started := map[schema.GroupVersionKind]bool{modelDataGVK: true}
+	assert.Empty(t, unreadyRequirements(mapper, requires[:1], declared, started))
+}
+
+func TestCheckRequirements(t *testing.T) {
+	newReconciler := func(requires ...modelv1.IntegrationRequirementSpec) (*GenericReconciler, *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		return &GenericReconciler{
+			Client:   fake.NewClientBuilder().WithRESTMapper(newScopeMapper()).Build(),
+			Recorder: recorder,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{Requires: requires}, true
+				}}
+			}},
+		}, recorder
+	}
+
+	t.Run("no requirements", func(t *testing.T) {
+		r, _ := newReconciler()
+		target := newTestResource("sandbox", "default", eventTestGVK)
+		require.NoError(t, r.checkRequirements(target))
+		assert.Nil(t, meta.FindStatusCondition(targetConditions(target), WaitingConditionType))
+	})
+
+	t.Run("kind not served", func(t *testing.T) {
+		r, recorder := newReconciler(modelDataRequirement, notInstalledRequirement)
+		target := newTestResource("sandbox", "default", eventTestGVK)
+
+		err := r.checkRequirements(target)
+		var waitErr *RequirementsNotReadyError
+		require.True(t, stderrors.As(err, &waitErr))
+		assert.Equal(t, []string{"example.com/v1/NotInstalled is not served"}, waitErr.Unready)
+
+		condition := meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+		require.NotNil(t, condition)
+		assert.Equal(t, "True", string(condition.Status))
+		assert.Equal(t, RequirementsNotReadyReason, condition.Reason)
+		assert.Equal(t, "Waiting for required kind(s): example.com/v1/NotInstalled is not served", condition.Message)
+		require.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, "Normal WaitingForRequirements")
+
+		// The event is only recorded when the condition becomes true.
+		require.Error(t, r.checkRequirements(target))
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("kinds served", func(t *testing.T) {
+		r, _ := newReconciler(modelDataRequirement)
+		target := newTestResource("sandbox", "default", eventTestGVK)
+		require.NoError(t, r.checkRequirements(target))
+		condition := meta.FindStatusCondition(targetConditions(target), WaitingConditionType)
+		require.NotNil(t, condition)
+		assert.Equal(t, "False", string(condition.Status))
+		assert.Equal(t, RequirementsReadyReason, condition.Reason)
+	})
+}
+
+func TestBuildConditionsWaitingForRequirements(t *testing.T) {
+	target := newTestResource("sandbox", "default", eventTestGVK)
+	err := &RequirementsNotReadyError{Unready: []string{"example.com/v1/NotInstalled is not served"}}
+
+	conditions, buildErr := (&GenericReconciler{}).buildConditions(context.Background(), target, true, err)
+	require.NoError(t, buildErr)
+	require.Len(t, conditions, 1)
+	ready := conditions[0].(map[string]interface{})
+	assert.Equal(t, "False", ready["status"])
+	assert.Equal(t, WaitingForRequirementsReason, ready["reason"])
+	assert.Equal(t, "Not reconciled: waiting for required kind(s): example.com/v1/NotInstalled is not served", ready["message"])
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// RetainOnDeleteAnnotation set to "true" on a rendered object, e.g. a
+	// Secret with access tokens that must be kept for audit, makes it outlive
+	// the resource it is rendered for: it gets no owner reference, and is
+	// recorded in the RetainedObjectsConfigMap of its namespace instead.
+	RetainOnDeleteAnnotation = "karo.gke.io/retain-on-delete"
+
+	// RetainedObjectsConfigMap is the inventory of the retained objects of a
+	// namespace. It is owned by nothing, and its entries are removed when the
+	// objects are cleaned up.
+	RetainedObjectsConfigMap = "karo-retained-objects"
+)
+
+// retainedObject is an entry of the RetainedObjectsConfigMap.
+type retainedObject struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Name       string              `json:"name"`
+	Owner      retainedObjectOwner `json:"owner"`
+	RetainedAt string              `json:"retainedAt"`
+}
+
+// retainedObjectOwner is the resource that a retained object was rendered for.
+type retainedObjectOwner struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// isRetainedOnDelete returns true if obj outlives the resource it is rendered
+// for, see RetainOnDeleteAnnotation.
+func isRetainedOnDelete(obj *unstructured.Unstructured) bool {
+	return obj.GetAnnotations()[RetainOnDeleteAnnotation] == "true"
+}
+
+// retainedObjectKey returns the key of obj in the RetainedObjectsConfigMap,
+// e.g. "secret.sandbox-token" or "certificate.cert-manager.io.serving".
+func retainedObjectKey(obj *unstructured.Unstructured) string {
+	gvk := obj.GroupVersionKind()
+	parts := []string{strings.ToLower(gvk.Kind)}
+	if gvk.Group != "" {
+		parts = append(parts, gvk.Group)
+	}
+	return strings.Join(append(parts, obj.GetName()), ".")
+}
+
+// recordRetainedObject adds obj to the RetainedObjectsConfigMap of its
+// namespace, unless it is already recorded for target.
+func (r *GenericReconciler) recordRetainedObject(ctx context.Context, target, obj *unstructured.Unstructured) error {
+	if obj.GetNamespace() == "" {
+		return fmt.Errorf("%s %s cannot be retained on delete, as only namespaced objects are recorded", obj.GetKind(), obj.GetName())
+	}
+	key := retainedObjectKey(obj)
+	entry := retainedObject{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Owner: retainedObjectOwner{
+			APIVersion: target.GetAPIVersion(),
+			Kind:       target.GetKind(),
+			Name:       target.GetName(),
+			UID:        string(target.GetUID()),
+		},
+		RetainedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		inventory := &corev1.ConfigMap{}
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: RetainedObjectsConfigMap}, inventory)
+		if apierrors.IsNotFound(err) {
+			inventory = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: obj.GetNamespace(), Name: RetainedObjectsConfigMap}}
+		} else if err != nil {
+			return fmt.Errorf("failed to get the retained objects of %s: %w", obj.GetNamespace(), err)
+		}
+
+		if data, ok := inventory.Data[key]; ok {
+			var recorded retainedObject
+			if json.Unmarshal([]byte(data), &recorded) == nil && recorded.Owner == entry.Owner {
+				return nil
+			}
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if inventory.Data == nil {
+			inventory.Data = map[string]string{}
+		}
+		inventory.Data[key] = string(data)
+
+		if inventory.ResourceVersion == "" {
+			err = r.Client.Create(ctx, inventory)
+			if apierrors.IsAlreadyExists(err) {
+				// Another reconcile created it, retry with its version.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), RetainedObjectsConfigMap, err)
+			}
+		} else {
+			err = r.Client.Update(ctx, inventory)
+		}
+		return err
+	})
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func newRetainedSecret() *unstructured.Unstructured {
+	secret := newTestResource("sandbox-token", "default", schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	secret.SetAnnotations(map[string]string{RetainOnDeleteAnnotation: "true"})
+	secret.Object["data"] = map[string]interface{}{"token": "dG9rZW4="}
+	return secret
+}
+
+func getRetainedObjects(t *testing.T, c client.Client) map[string]retainedObject {
+	t.Helper()
+	inventory := &corev1.ConfigMap{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: RetainedObjectsConfigMap}, inventory))
+	assert.Empty(t, inventory.OwnerReferences)
+	entries := map[string]retainedObject{}
+	for key, data := range inventory.Data {
+		var entry retainedObject
+		require.NoError(t, json.Unmarshal([]byte(data), &entry))
+		entries[key] = entry
+	}
+	return entries
+}
+
+func TestRetainedObjectKey(t *testing.T) {
+	assert.Equal(t, "secret.sandbox-token", retainedObjectKey(newRetainedSecret()))
+	certificate := newTestResource("serving", "default", schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"})
+	assert.Equal(t, "certificate.cert-manager.io.serving", retainedObjectKey(certificate))
+}
+
+func TestReconcileDependentRetainedOnDelete(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", targetGVK)
+	target.SetUID("target-uid")
+	c := fake.NewClientBuilder().Build()
+	r := &GenericReconciler{
+		Client:   c,
+		Scheme:   runtime.NewScheme(),
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	var applied *unstructured.Unstructured
+	rc := &MockResourceClient{CreateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		applied = obj
+		return obj, nil
+	}}
+	info, err := r.reconcileDependent(context.Background(), testLogger(), target, newRetainedSecret(), rc)
+	require.NoError(t, err)
+	assert.Equal(t, "Processed", info["status"])
+	assert.Equal(t, true, info["retained"])
+	require.NotNil(t, applied)
+	assert.Empty(t, applied.GetOwnerReferences(), "retained dependents are not garbage collected with the target")
+
+	entries := getRetainedObjects(t, c)
+	require.Contains(t, entries, "secret.sandbox-token")
+	entry := entries["secret.sandbox-token"]
+	assert.Equal(t, "Secret", entry.Kind)
+	assert.Equal(t, "sandbox-token", entry.Name)
+	assert.Equal(t, retainedObjectOwner{APIVersion: "testing.karo.pkg.com/v1", Kind: "TestResource", Name: "test-resource", UID: "target-uid"}, entry.Owner)
+	assert.NotEmpty(t, entry.RetainedAt)
+
+	// A dependent that was owned before it was retained loses its owner
+	// reference, even though its data is unchanged.
+	existing := newRetainedSecret()
+	existing.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(target, targetGVK)})
+	applied = nil
+	rc = &MockResourceClient{
+		GetFunc: func(context.Context, schema.GroupVersionKind, string, string) (*unstructured.Unstructured, error) {
+			return existing, nil
+		},
+		UpdateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			applied = obj
+			return obj, nil
+		},
+	}
+	_, err = r.reconcileDependent(context.Background(), testLogger(), target, newRetainedSecret(), rc)
+	require.NoError(t, err)
+	require.NotNil(t, applied, "the owner reference is removed with an update")
+	assert.Empty(t, applied.GetOwnerReferences())
+	assert.Equal(t, entry, getRetainedObjects(t, c)["secret.sandbox-token"], "the entry is only written once per owner")
+}
+
+func TestReconcileDependentNotRetained(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", targetGVK)
+	target.SetUID("target-uid")
+	scheme := runtime.NewScheme()
+	c := fake.NewClientBuilder().Build()
+	r := &GenericReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+	var applied *unstructured.Unstructured
+	rc := &MockResourceClient{CreateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		applied = obj
+		return obj, nil
+	}}
+	secret := newRetainedSecret()
+	secret.SetAnnotations(map[string]string{RetainOnDeleteAnnotation: "false"})
+	_, err := r.reconcileDependent(context.Background(), testLogger(), target, secret, rc)
+	require.NoError(t, err)
+	require.NotNil(t, applied)
+	owned, err := controllerutil.HasOwnerReference(applied.GetOwnerReferences(), target, scheme)
+	require.NoError(t, err)
+	assert.True(t, owned)
+
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: RetainedObjectsConfigMap}, &corev1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err), "no inventory is written")
+}
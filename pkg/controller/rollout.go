@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	RolloutStrategyCanary    = "Canary"
+	RolloutStrategyBlueGreen = "BlueGreen"
+
+	RolloutStartedEvent  = modelv1.EventReasonRolloutStarted
+	RolloutPromotedEvent = modelv1.EventReasonRolloutPromoted
+	RolloutAbortedEvent  = modelv1.EventReasonRolloutAborted
+
+	// Rollout phases reported in status.dependentResources[].rollout.
+	RolloutPhaseProgressing = "Progressing"
+	RolloutPhaseBaking      = "Baking"
+	RolloutPhasePromoting   = "Promoting"
+	RolloutPhaseFailed      = "Failed"
+
+	// rolloutTrackLabel is added to the pods of the new revision, which carry
+	// the labels of the stable pods as well, so the rendered Services send them
+	// a share of the traffic proportional to their replicas.
+	rolloutTrackLabel          = "model.skippy.io/rollout-track"
+	rolloutReadyAtAnnotation   = "model.skippy.io/rollout-ready-at"
+	rolloutAbortedAnnotation   = "model.skippy.io/rollout-aborted"
+	rolloutCanaryNameSuffix    = "-canary"
+	defaultRolloutCanaryPct    = 10
+	defaultRolloutBakeDuration = 5 * time.Minute
+)
+
+// rolloutSpec returns the rollout configuration of the integration, or nil if
+// Deployments are updated in place.
+func (r *GenericReconciler) rolloutSpec() *modelv1.IntegrationRolloutSpec {
+	if r.Transformer == nil {
+		return nil
+	}
+	registry := r.Transformer.Registry()
+	if registry == nil {
+		return nil
+	}
+	integrationSpec, _ := registry.GetIntegrationSpec(r.Gvk)
+	return integrationSpec.Rollout
+}
+
+// progressRollout moves a rollout of the desired Deployment one step forward.
+// It returns the Deployment to apply as the stable one, which keeps the current
+// pod template until the new revision is promoted, and the rollout state to
+// report, which is nil when no rollout is in progress.
+//
+// The new revision runs as a separate "<name>-canary" Deployment. Once it has
+// been available for the bake time without exceeding the restart guardrail,
+// the stable Deployment is updated and the canary is removed after the stable
+// Deployment finished rolling out, so capacity never drops during the update.
+func (r *GenericReconciler) progressRollout(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, desired *unstructured.Unstructured, rc modelv1.ResourceClientInterface, spec *modelv1.IntegrationRolloutSpec) (*unstructured.Unstructured, map[string]interface{}, error) {
+	gvk := desired.GroupVersionKind()
+	namespace := desired.GetNamespace()
+	canaryName := desired.GetName() + rolloutCanaryNameSuffix
+	// Rendered objects may hold plain ints, which DeepCopy does not accept.
+	normalizeNumbersToInt64(desired.Object)
+
+	stable, err := rc.Get(ctx, gvk, namespace, desired.GetName())
+	if errors.IsNotFound(err) {
+		return desired, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error getting resource %s %s/%s: %w", gvk.String(), namespace, desired.GetName(), err)
+	}
+	canary, err := rc.Get(ctx, gvk, namespace, canaryName)
+	if errors.IsNotFound(err) {
+		canary = nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error getting resource %s %s/%s: %w", gvk.String(), namespace, canaryName, err)
+	}
+
+	changed, err := r.deploymentDiff(stable, desired, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !changed {
+		// The stable Deployment already runs the desired revision, either because
+		// nothing changed, the change was reverted, or the rollout was promoted.
+		if canary == nil {
+			return desired, nil, nil
+		}
+		if !deploymentRolledOut(stable) {
+			return desired, rolloutState(RolloutPhasePromoting, "waiting for %s to roll out before removing %s", desired.GetName(), canaryName), nil
+		}
+		if err := r.Client.Delete(ctx, canary, r.deleteOptions(canary.GroupVersionKind().GroupKind(), nil)...); err != nil && !errors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("failed to delete %s %s/%s: %w", gvk.Kind, namespace, canaryName, err)
+		}
+		log.Info("Removed the canary of a completed rollout", "deployment", desired.GetName())
+		return desired, nil, nil
+	}
+
+	// Keep the stable pod template while the new revision is being evaluated.
+	keepStable := desired.DeepCopy()
+	copySourceGeneration(keepStable, stable)
+	if template, found, _ := unstructured.NestedFieldNoCopy(stable.Object, "spec", "template"); found {
+		if err := unstructured.SetNestedField(keepStable.Object, runtime.DeepCopyJSONValue(template), "spec", "template"); err != nil {
+			return nil, nil, fmt.Errorf("failed to keep the stable pod template: %w", err)
+		}
+	}
+
+	desiredCanary, err := newCanaryDeployment(desired, canaryName, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := controllerutil.SetControllerReference(target, desiredCanary, r.Scheme); err != nil {
+		return nil, nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+	canaryChanged := canary == nil
+	if canary != nil {
+		if canaryChanged, err = r.deploymentDiff(canary, desiredCanary, log); err != nil {
+			return nil, nil, err
+		}
+	}
+	if canaryChanged {
+		// A new revision starts a new rollout, including after an aborted one.
+		if canary == nil {
+			_, err = rc.Create(ctx, gvk, namespace, desiredCanary)
+		} else {
+			desiredCanary.SetResourceVersion(canary.GetResourceVersion())
+			_, err = rc.Update(ctx, gvk, namespace, desiredCanary)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to apply %s %s/%s: %w", gvk.Kind, namespace, canaryName, err)
+		}
+		r.eventf(target, corev1.EventTypeNormal, RolloutStartedEvent, "Started %s rollout of %s/%s", spec.Strategy, namespace, desired.GetName())
+		return keepStable, rolloutState(RolloutPhaseProgressing, "waiting for %s to become available", canaryName), nil
+	}
+
+	if reason := canary.GetAnnotations()[rolloutAbortedAnnotation]; reason != "" {
+		return keepStable, rolloutState(RolloutPhaseFailed, "%s", reason), nil
+	}
+
+	restarts, err := r.podRestarts(ctx, namespace, canary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if restarts > int64(spec.MaxRestarts) {
+		reason := fmt.Sprintf("rollout aborted: the new revision restarted %d times, more than the allowed %d", restarts, spec.MaxRestarts)
+		if err := r.updateCanary(ctx, rc, canary, func(obj *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas")
+			setAnnotation(obj, rolloutAbortedAnnotation, reason)
+		}); err != nil {
+			return nil, nil, err
+		}
+		r.eventf(target, corev1.EventTypeWarning, RolloutAbortedEvent, "Aborted rollout of %s/%s: %s", namespace, desired.GetName(), reason)
+		return keepStable, rolloutState(RolloutPhaseFailed, "%s", reason), nil
+	}
+
+	if !deploymentRolledOut(canary) {
+		return keepStable, rolloutState(RolloutPhaseProgressing, "waiting for %s to become available", canaryName), nil
+	}
+	readyAt, err := time.Parse(time.RFC3339, canary.GetAnnotations()[rolloutReadyAtAnnotation])
+	if err != nil {
+		readyAt = time.Now()
+		if err := r.updateCanary(ctx, rc, canary, func(obj *unstructured.Unstructured) {
+			setAnnotation(obj, rolloutReadyAtAnnotation, readyAt.UTC().Format(time.RFC3339))
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	bakeTime := defaultRolloutBakeDuration
+	if spec.BakeTime != nil {
+		bakeTime = spec.BakeTime.Duration
+	}
+	if remaining := bakeTime - time.Since(readyAt); remaining > 0 {
+		return keepStable, rolloutState(RolloutPhaseBaking, "%s is available, promoting in %s", canaryName, remaining.Round(time.Second)), nil
+	}
+
+	r.eventf(target, corev1.EventTypeNormal, RolloutPromotedEvent, "Promoting the new revision of %s/%s after %s", namespace, desired.GetName(), bakeTime)
+	return desired, rolloutState(RolloutPhasePromoting, "promoting the new revision of %s", desired.GetName()), nil
+}
+
+// newCanaryDeployment returns the Deployment that runs the new revision next
+// to the stable one. Its selector and pods carry the rollout track label, so
+// the stable Deployment's pods are not selected by it.
+func newCanaryDeployment(desired *unstructured.Unstructured, name string, spec *modelv1.IntegrationRolloutSpec) (*unstructured.Unstructured, error) {
+	canary := desired.DeepCopy()
+	canary.SetName(name)
+	canary.SetResourceVersion("")
+	canary.SetOwnerReferences(nil)
+
+	replicas := int64(1)
+	if value, found, _ := unstructured.NestedFieldNoCopy(desired.Object, "spec", "replicas"); found {
+		replicas = int64(getInt32ValueFromInterface(value, logr.Discard()))
+	}
+	if spec.Strategy != RolloutStrategyBlueGreen {
+		percent := int64(spec.CanaryPercent)
+		if percent <= 0 {
+			percent = defaultRolloutCanaryPct
+		}
+		replicas = max((replicas*percent+99)/100, 1)
+	}
+	if err := unstructured.SetNestedField(canary.Object, replicas, "spec", "replicas"); err != nil {
+		return nil, fmt.Errorf("failed to set canary replicas: %w", err)
+	}
+
+	for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+		labels, _, _ := unstructured.NestedFieldNoCopy(canary.Object, path...)
+		labelMap, _ := labels.(map[string]interface{})
+		if labelMap == nil {
+			labelMap = map[string]interface{}{}
+		}
+		labelMap[rolloutTrackLabel] = "canary"
+		if err := unstructured.SetNestedField(canary.Object, labelMap, path...); err != nil {
+			return nil, fmt.Errorf("failed to set canary labels: %w", err)
+		}
+	}
+	return canary, nil
+}
+
+// updateCanary applies mutate to a copy of the canary and updates it.
+func (r *GenericReconciler) updateCanary(ctx context.Context, rc modelv1.ResourceClientInterface, canary *unstructured.Unstructured, mutate func(*unstructured.Unstructured)) error {
+	updated := canary.DeepCopy()
+	mutate(updated)
+	if _, err := rc.Update(ctx, updated.GroupVersionKind(), updated.GetNamespace(), updated); err != nil {
+		return fmt.Errorf("failed to update %s %s/%s: %w", updated.GetKind(), updated.GetNamespace(), updated.GetName(), err)
+	}
+	return nil
+}
+
+// podRestarts sums the container restarts of the pods selected by the
+// Deployment.
+func (r *GenericReconciler) podRestarts(ctx context.Context, namespace string, deployment *unstructured.Unstructured) (int64, error) {
+	matchLabels, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "selector", "matchLabels")
+	if len(matchLabels) == 0 {
+		return 0, nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(matchLabels)); err != nil {
+		return 0, fmt.Errorf("failed to list pods of %s: %w", deployment.GetName(), err)
+	}
+	var restarts int64
+	for _, pod := range pods.Items {
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			restarts += int64(status.RestartCount)
+		}
+	}
+	return restarts, nil
+}
+
+// deploymentRolledOut reports whether all replicas of the Deployment run its
+// current pod template and are available.
+func deploymentRolledOut(deployment *unstructured.Unstructured) bool {
+	generation := deployment.GetGeneration()
+	observedGeneration, _, _ := unstructured.NestedInt64(deployment.Object, "status", "observedGeneration")
+	replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(deployment.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(deployment.Object, "status", "availableReplicas")
+	return observedGeneration >= generation && updated >= replicas && available >= replicas
+}
+
+func rolloutState(phase, messageFmt string, args ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"phase":   phase,
+		"message": fmt.Sprintf(messageFmt, args...),
+	}
+}
+
+func setAnnotation(obj *unstructured.Unstructured, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
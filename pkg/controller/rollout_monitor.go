@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	RolloutStuckConditionType = "RolloutStuck"
+	RolloutStuckReason        = "DeploymentRolloutStuck"
+	RolloutsProgressingReason = "RolloutsProgressing"
+	RolloutStuckEvent         = modelv1.EventReasonRolloutStuck
+
+	// progressDeadlineExceededReason is the reason of the Progressing
+	// condition of Deployments that did not progress within their
+	// progressDeadlineSeconds.
+	progressDeadlineExceededReason = "ProgressDeadlineExceeded"
+)
+
+// checkDeploymentRollouts sets the RolloutStuck condition of the target from
+// the conditions that the Deployment controller reports on its Deployments:
+// a rollout is stuck once it exceeded its progressDeadlineSeconds, or when
+// replicas cannot be created, e.g. because of a quota. The condition lists the
+// failures of the pods, so that a template regression such as a wrong image
+// shows up on the target even though applying the Deployment succeeded.
+// Targets without Deployments get no condition.
+func (r *GenericReconciler) checkDeploymentRollouts(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	var deployments int
+	var stuck []string
+	for _, obj := range objs {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		deployments++
+		// The canary of a rollout runs the new revision.
+		for _, name := range []string{obj.GetName(), obj.GetName() + rolloutCanaryNameSuffix} {
+			live, err := rc.Get(ctx, obj.GroupVersionKind(), obj.GetNamespace(), name)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("error getting resource %s %s/%s: %w", obj.GroupVersionKind().String(), obj.GetNamespace(), name, err)
+			}
+			if live.GetAnnotations()[rolloutAbortedAnnotation] != "" {
+				continue
+			}
+			problem := rolloutProblem(live)
+			if problem == "" {
+				continue
+			}
+			reasons, err := r.podFailureReasons(ctx, live)
+			if err != nil {
+				return err
+			}
+			if len(reasons) > 0 {
+				problem += ": " + strings.Join(reasons, "; ")
+			}
+			log.Info("Deployment rollout is stuck", "name", live.GetName(), "problem", problem)
+			stuck = append(stuck, fmt.Sprintf("Deployment %s %s", live.GetName(), problem))
+		}
+	}
+
+	existing := meta.FindStatusCondition(targetConditions(target), RolloutStuckConditionType)
+	if deployments == 0 && existing == nil {
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:               RolloutStuckConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             RolloutsProgressingReason,
+		Message:            "No Deployment rollout is stuck.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	if len(stuck) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = RolloutStuckReason
+		condition.Message = strings.Join(stuck, "\n")
+		if existing == nil || existing.Status != metav1.ConditionTrue || existing.Message != condition.Message {
+			r.eventf(target, corev1.EventTypeWarning, RolloutStuckEvent, "Rollout of %s %s is stuck: %s", target.GetKind(), target.GetName(), strings.Join(stuck, "; "))
+		}
+	}
+	return setTargetCondition(target, condition)
+}
+
+// rolloutProblem returns why the rollout of a live Deployment is stuck, or ""
+// if it is progressing, complete, or its current generation was not observed
+// by the Deployment controller yet.
+func rolloutProblem(deployment *unstructured.Unstructured) string {
+	observed, _, _ := unstructured.NestedInt64(deployment.Object, "status", "observedGeneration")
+	if observed < deployment.GetGeneration() {
+		return ""
+	}
+	var problems []string
+	if status, reason, message := dependentCondition(deployment, "Progressing"); status == "False" && reason == progressDeadlineExceededReason {
+		deadline := "its progress deadline"
+		if seconds, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "progressDeadlineSeconds"); found {
+			deadline = fmt.Sprintf("its progress deadline of %ds", seconds)
+		}
+		problems = append(problems, fmt.Sprintf("exceeded %s (%s)", deadline, message))
+	}
+	if status, reason, message := dependentCondition(deployment, "ReplicaFailure"); status == "True" {
+		problems = append(problems, fmt.Sprintf("cannot create replicas (%s: %s)", reason, message))
+	}
+	return strings.Join(problems, " and ")
+}
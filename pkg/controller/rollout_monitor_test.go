@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func withDeploymentConditions(obj *unstructured.Unstructured, generation int64, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	normalizeNumbersToInt64(obj.Object)
+	obj.SetGeneration(generation)
+	list := make([]interface{}, len(conditions))
+	for i, condition := range conditions {
+		list[i] = condition
+	}
+	_ = unstructured.SetNestedField(obj.Object, map[string]interface{}{"observedGeneration": generation, "conditions": list}, "status")
+	return obj
+}
+
+func TestRolloutProblem(t *testing.T) {
+	deadlineExceeded := map[string]interface{}{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded", "message": `ReplicaSet "vllm-7d9" has timed out progressing.`}
+	replicaFailure := map[string]interface{}{"type": "ReplicaFailure", "status": "True", "reason": "FailedCreate", "message": "exceeded quota: gpu-quota"}
+	progressing := map[string]interface{}{"type": "Progressing", "status": "True", "reason": "ReplicaSetUpdated"}
+
+	assert.Empty(t, rolloutProblem(withDeploymentConditions(newRolloutDeployment("vllm", "vllm:v1", 1), 2, progressing)))
+
+	deployment := withDeploymentConditions(newRolloutDeployment("vllm", "vllm:v1", 1), 2, deadlineExceeded)
+	assert.Equal(t, `exceeded its progress deadline (ReplicaSet "vllm-7d9" has timed out progressing.)`, rolloutProblem(deployment))
+	_ = unstructured.SetNestedField(deployment.Object, int64(600), "spec", "progressDeadlineSeconds")
+	assert.Equal(t, `exceeded its progress deadline of 600s (ReplicaSet "vllm-7d9" has timed out progressing.)`, rolloutProblem(deployment))
+
+	assert.Equal(t, "cannot create replicas (FailedCreate: exceeded quota: gpu-quota)", rolloutProblem(withDeploymentConditions(newRolloutDeployment("vllm", "vllm:v1", 1), 2, progressing, replicaFailure)))
+
+	// The conditions of an older generation no longer apply.
+	stale := withDeploymentConditions(newRolloutDeployment("vllm", "vllm:v1", 1), 2, deadlineExceeded)
+	stale.SetGeneration(3)
+	assert.Empty(t, rolloutProblem(stale))
+}
+
+func TestCheckDeploymentRollouts(t *testing.T) {
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "vllm-7d9-abc", Namespace: "default", Labels: map[string]string{"app": "vllm"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "server",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}}},
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Client: fake.NewClientBuilder().WithScheme(s).WithObjects(pod).Build(), Recorder: recorder}
+	target := newTestResource("llama", "default", eventTestGVK)
+	rendered := []*unstructured.Unstructured{newRolloutDeployment("vllm", "vllm:v2", 1)}
+	live := withDeploymentConditions(newRolloutDeployment("vllm", "vllm:v2", 1), 2,
+		map[string]interface{}{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded", "message": "timed out"})
+	rc := &mapResourceClient{objs: map[string]*unstructured.Unstructured{"vllm": live}}
+
+	require.NoError(t, r.checkDeploymentRollouts(context.Background(), testLogger(), target, rendered, rc))
+	condition := meta.FindStatusCondition(targetConditions(target), RolloutStuckConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, RolloutStuckReason, condition.Reason)
+	assert.Equal(t, "Deployment vllm exceeded its progress deadline (timed out): container server ImagePullBackOff", condition.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning RolloutStuck")
+
+	// The event is only recorded when the problem changes.
+	require.NoError(t, r.checkDeploymentRollouts(context.Background(), testLogger(), target, rendered, rc))
+	assert.Empty(t, recorder.Events)
+
+	// A fixed template starts a new rollout, which is not stuck.
+	withDeploymentConditions(live, 3, map[string]interface{}{"type": "Progressing", "status": "True", "reason": "NewReplicaSetAvailable"})
+	require.NoError(t, r.checkDeploymentRollouts(context.Background(), testLogger(), target, rendered, rc))
+	condition = meta.FindStatusCondition(targetConditions(target), RolloutStuckConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, RolloutsProgressingReason, condition.Reason)
+
+	// Targets without Deployments get no condition.
+	other := newTestResource("other", "default", eventTestGVK)
+	require.NoError(t, r.checkDeploymentRollouts(context.Background(), testLogger(), other, []*unstructured.Unstructured{newUnstructuredSecret(t, "token", nil)}, rc))
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(other), RolloutStuckConditionType))
+}
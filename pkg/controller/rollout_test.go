@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// newRolloutDeployment returns a Deployment as rendered by a template.
+func newRolloutDeployment(name, image string, replicas int) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "vllm"}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "vllm"}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "server", "image": image}},
+				},
+			},
+		},
+	}}
+}
+
+// markRolledOut sets the status of a stored Deployment as if all its replicas
+// were updated and available.
+func markRolledOut(obj *unstructured.Unstructured) {
+	replicas, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas")
+	count := int64(getInt32ValueFromInterface(replicas, testLogger()))
+	_ = unstructured.SetNestedField(obj.Object, map[string]interface{}{
+		"observedGeneration": obj.GetGeneration(),
+		"updatedReplicas":    count,
+		"availableReplicas":  count,
+	}, "status")
+}
+
+// mapResourceClient stores objects by name, like a single-namespace API server.
+type mapResourceClient struct {
+	objs map[string]*unstructured.Unstructured
+}
+
+func (m *mapResourceClient) Get(_ context.Context, gvk schema.GroupVersionKind, _, name string) (*unstructured.Unstructured, error) {
+	if obj, ok := m.objs[name]; ok {
+		return obj.DeepCopy(), nil
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: "deployments"}, name)
+}
+
+func (m *mapResourceClient) Create(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	stored := &unstructured.Unstructured{Object: normalizeNumbersToInt64(obj.DeepCopy().Object).(map[string]interface{})}
+	m.objs[obj.GetName()] = stored
+	return stored.DeepCopy(), nil
+}
+
+func (m *mapResourceClient) Update(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return m.Create(ctx, gvk, namespace, obj)
+}
+
+func (m *mapResourceClient) Delete(_ context.Context, gvk schema.GroupVersionKind, _, name string, _ *metav1.DeletionPropagation) error {
+	if _, ok := m.objs[name]; !ok {
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: "deployments"}, name)
+	}
+	delete(m.objs, name)
+	return nil
+}
+
+// Patch applies merge patches to stored objects.
+func (m *mapResourceClient) Patch(_ context.Context, gvk schema.GroupVersionKind, _, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	obj, ok := m.objs[name]
+	if !ok || patchType != types.MergePatchType {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: "deployments"}, name)
+	}
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	mergeInto(obj.Object, patch)
+	return obj.DeepCopy(), nil
+}
+
+// mergeInto applies a JSON merge patch to obj.
+func mergeInto(obj, patch map[string]interface{}) {
+	for key, value := range patch {
+		nested, isMap := value.(map[string]interface{})
+		existing, hasMap := obj[key].(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(obj, key)
+		case isMap && hasMap:
+			mergeInto(existing, nested)
+		default:
+			obj[key] = value
+		}
+	}
+}
+
+func TestProgressRollout(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	target := newTestResource("test-resource", "default", targetGVK)
+	target.SetUID("target-uid")
+	spec := &modelv1.IntegrationRolloutSpec{Strategy: RolloutStrategyCanary, CanaryPercent: 25, BakeTime: &metav1.Duration{Duration: time.Minute}, MaxRestarts: 1}
+
+	newReconciler := func(pods ...*corev1.Pod) (*GenericReconciler, *record.FakeRecorder) {
+		s := runtime.NewScheme()
+		_ = corev1.AddToScheme(s)
+		builder := fake.NewClientBuilder().WithScheme(s)
+		for _, pod := range pods {
+			builder = builder.WithObjects(pod)
+		}
+		recorder := record.NewFakeRecorder(10)
+		return &GenericReconciler{Client: builder.Build(), Scheme: s, Recorder: recorder}, recorder
+	}
+	canaryPod := func(restarts int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "vllm-canary-abc", Namespace: "default", Labels: map[string]string{"app": "vllm", rolloutTrackLabel: "canary"}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "server", RestartCount: restarts}}},
+		}
+	}
+	newStore := func() *mapResourceClient {
+		stable := newRolloutDeployment("vllm", "vllm:v1", 8)
+		normalizeNumbersToInt64(stable.Object)
+		markRolledOut(stable)
+		return &mapResourceClient{objs: map[string]*unstructured.Unstructured{"vllm": stable}}
+	}
+
+	t.Run("first creation is applied directly", func(t *testing.T) {
+		r, _ := newReconciler()
+		desired := newRolloutDeployment("vllm", "vllm:v1", 8)
+		obj, state, err := r.progressRollout(context.Background(), testLogger(), target, desired, &mapResourceClient{objs: map[string]*unstructured.Unstructured{}}, spec)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+		assert.Equal(t, desired, obj)
+	})
+
+	t.Run("canary is promoted after the bake time", func(t *testing.T) {
+		r, recorder := newReconciler(canaryPod(0))
+		store := newStore()
+		setSourceGeneration(store.objs["vllm"], 1)
+		desired := withSourceGeneration(newRolloutDeployment("vllm", "vllm:v2", 8), 2)
+
+		// A changed image starts a canary with a quarter of the replicas, while
+		// the stable Deployment keeps the old image and generation.
+		obj, state, err := r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhaseProgressing, state["phase"])
+		generation, _ := sourceGeneration(obj)
+		assert.Equal(t, int64(1), generation)
+		hasDiff, err := r.deploymentDiff(store.objs["vllm"], obj, testLogger())
+		require.NoError(t, err)
+		assert.False(t, hasDiff, "the stable pod template must not change yet")
+		canary := store.objs["vllm-canary"]
+		require.NotNil(t, canary)
+		assert.Equal(t, int64(2), canary.Object["spec"].(map[string]interface{})["replicas"])
+		labels, _, _ := unstructured.NestedStringMap(canary.Object, "spec", "template", "metadata", "labels")
+		assert.Equal(t, map[string]string{"app": "vllm", rolloutTrackLabel: "canary"}, labels)
+		assert.Equal(t, "target-uid", string(metav1.GetControllerOf(canary).UID))
+		assert.Contains(t, <-recorder.Events, RolloutStartedEvent)
+
+		// Once the canary is available, it bakes.
+		markRolledOut(store.objs["vllm-canary"])
+		_, state, err = r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhaseBaking, state["phase"])
+		assert.NotEmpty(t, store.objs["vllm-canary"].GetAnnotations()[rolloutReadyAtAnnotation])
+
+		// After the bake time, the stable Deployment gets the new template.
+		setAnnotation(store.objs["vllm-canary"], rolloutReadyAtAnnotation, time.Now().Add(-2*time.Minute).UTC().Format(time.RFC3339))
+		obj, state, err = r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhasePromoting, state["phase"])
+		assert.Equal(t, desired, obj)
+		assert.Contains(t, <-recorder.Events, RolloutPromotedEvent)
+
+		// The canary is kept until the stable Deployment has rolled out.
+		promoted := desired.DeepCopy() // Already normalized by progressRollout.
+		promoted.SetGeneration(2)
+		store.objs["vllm"] = promoted
+		_, state, err = r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhasePromoting, state["phase"])
+
+		markRolledOut(store.objs["vllm"])
+		require.NoError(t, r.Client.Create(context.Background(), store.objs["vllm-canary"]))
+		_, state, err = r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+		err = r.Client.Get(context.Background(), client.ObjectKeyFromObject(store.objs["vllm-canary"]), store.objs["vllm-canary"].DeepCopy())
+		assert.True(t, errors.IsNotFound(err), "the canary must be deleted")
+	})
+
+	t.Run("restarts abort the rollout", func(t *testing.T) {
+		r, recorder := newReconciler(canaryPod(2))
+		store := newStore()
+		desired := newRolloutDeployment("vllm", "vllm:v2", 8)
+
+		_, _, err := r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		<-recorder.Events
+
+		obj, state, err := r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhaseFailed, state["phase"])
+		assert.Contains(t, state["message"], "restarted 2 times")
+		assert.Equal(t, int64(0), store.objs["vllm-canary"].Object["spec"].(map[string]interface{})["replicas"])
+		assert.Contains(t, <-recorder.Events, RolloutAbortedEvent)
+		hasDiff, err := r.deploymentDiff(store.objs["vllm"], obj, testLogger())
+		require.NoError(t, err)
+		assert.False(t, hasDiff)
+
+		// The failed revision is not retried until the template changes again.
+		_, state, err = r.progressRollout(context.Background(), testLogger(), target, desired, store, spec)
+		require.NoError(t, err)
+		assert.Equal(t, RolloutPhaseFailed, state["phase"])
+	})
+
+	t.Run("blue-green runs a full copy", func(t *testing.T) {
+		r, _ := newReconciler()
+		store := newStore()
+		blueGreen := &modelv1.IntegrationRolloutSpec{Strategy: RolloutStrategyBlueGreen}
+		_, _, err := r.progressRollout(context.Background(), testLogger(), target, newRolloutDeployment("vllm", "vllm:v2", 8), store, blueGreen)
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), store.objs["vllm-canary"].Object["spec"].(map[string]interface{})["replicas"])
+	})
+}
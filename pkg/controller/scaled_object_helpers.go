@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// scaledObjectDefaults are the values KEDA uses for unset ScaledObject fields,
+// so that a template that spells out a default does not differ from one that
+// leaves it out.
+var scaledObjectDefaults = map[string]int64{
+	"pollingInterval": 30,
+	"cooldownPeriod":  300,
+	"minReplicaCount": 0,
+}
+
+// scaledObjectDiff compares the specs of two KEDA ScaledObjects. Numbers are
+// compared regardless of their Go type, trigger metadata as strings, and unset
+// fields as their KEDA defaults.
+func (r *GenericReconciler) scaledObjectDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
+	existingSpec, ok := existingObj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("existing object spec is not a map[string]interface{}")
+	}
+	desiredSpec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("desired object spec is not a map[string]interface{}")
+	}
+
+	normalizedExisting := normalizeScaledObjectSpec(existingSpec)
+	normalizedDesired := normalizeScaledObjectSpec(desiredSpec)
+	if !reflect.DeepEqual(normalizedExisting, normalizedDesired) {
+		log.Info("Found a difference in the ScaledObject spec", "difference", cmp.Diff(normalizedExisting, normalizedDesired))
+		return true, nil
+	}
+	return false, nil
+}
+
+// normalizeScaledObjectSpec returns a normalized copy of a ScaledObject spec.
+func normalizeScaledObjectSpec(spec map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(spec))
+	for key, value := range spec {
+		if key == "triggers" {
+			continue
+		}
+		normalized[key] = normalizeNumbersToInt64(copyJSONValue(value))
+	}
+	for key, value := range scaledObjectDefaults {
+		if _, ok := normalized[key]; !ok {
+			normalized[key] = value
+		}
+	}
+
+	triggersList, _ := spec["triggers"].([]interface{})
+	triggers := make([]interface{}, 0, len(triggersList))
+	for _, triggerInterface := range triggersList {
+		triggerData, ok := triggerInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		trigger := make(map[string]interface{}, len(triggerData))
+		for key, value := range triggerData {
+			trigger[key] = normalizeNumbersToInt64(copyJSONValue(value))
+		}
+		// KEDA reads all trigger metadata as strings.
+		if metadata, ok := triggerData["metadata"].(map[string]interface{}); ok {
+			stringMetadata := make(map[string]interface{}, len(metadata))
+			for key, value := range metadata {
+				stringMetadata[key] = fmt.Sprintf("%v", value)
+			}
+			trigger["metadata"] = stringMetadata
+		}
+		if _, ok := trigger["metricType"]; !ok {
+			trigger["metricType"] = "AverageValue"
+		}
+		triggers = append(triggers, trigger)
+	}
+	normalized["triggers"] = triggers
+	return normalized
+}
+
+// copyJSONValue deep-copies maps and slices of a decoded object, which may
+// hold Go ints that runtime.DeepCopyJSONValue rejects.
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			copied[key] = copyJSONValue(val)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, val := range v {
+			copied[i] = copyJSONValue(val)
+		}
+		return copied
+	default:
+		return v
+	}
+}
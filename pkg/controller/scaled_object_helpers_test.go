@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestScaledObject(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "keda.sh/v1alpha1",
+		"kind":       "ScaledObject",
+		"metadata":   map[string]interface{}{"name": "vllm", "namespace": "default"},
+		"spec":       spec,
+	}}
+}
+
+func TestScaledObjectDiff(t *testing.T) {
+	r := &GenericReconciler{}
+	desiredSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"scaleTargetRef":  map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "vllm"},
+			"minReplicaCount": 0,
+			"maxReplicaCount": 4,
+			"triggers": []interface{}{
+				map[string]interface{}{
+					"type":     "prometheus",
+					"metadata": map[string]interface{}{"query": "sum(vllm:num_requests_waiting)", "threshold": 5},
+				},
+			},
+		}
+	}
+	// The existing object as stored by the API server: JSON numbers, string
+	// metadata and no KEDA defaults.
+	existingSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"scaleTargetRef":  map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "vllm"},
+			"maxReplicaCount": int64(4),
+			"triggers": []interface{}{
+				map[string]interface{}{
+					"type":       "prometheus",
+					"metricType": "AverageValue",
+					"metadata":   map[string]interface{}{"query": "sum(vllm:num_requests_waiting)", "threshold": "5"},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		mutate     func(spec map[string]interface{})
+		expectDiff bool
+	}{
+		{name: "equivalent specs", mutate: func(map[string]interface{}) {}},
+		{name: "explicit defaults", mutate: func(spec map[string]interface{}) {
+			spec["pollingInterval"] = 30
+			spec["cooldownPeriod"] = 300
+		}},
+		{name: "changed max replicas", mutate: func(spec map[string]interface{}) { spec["maxReplicaCount"] = 8 }, expectDiff: true},
+		{name: "changed polling interval", mutate: func(spec map[string]interface{}) { spec["pollingInterval"] = 10 }, expectDiff: true},
+		{name: "changed threshold", mutate: func(spec map[string]interface{}) {
+			spec["triggers"].([]interface{})[0].(map[string]interface{})["metadata"].(map[string]interface{})["threshold"] = "10"
+		}, expectDiff: true},
+		{name: "added trigger", mutate: func(spec map[string]interface{}) {
+			spec["triggers"] = append(spec["triggers"].([]interface{}), map[string]interface{}{
+				"type": "cpu", "metricType": "Utilization", "metadata": map[string]interface{}{"value": "80"},
+			})
+		}, expectDiff: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			desired := desiredSpec()
+			tc.mutate(desired)
+			existing := existingSpec()
+			diff, err := r.scaledObjectDiff(newTestScaledObject(existing), newTestScaledObject(desired), testLogger())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDiff, diff)
+			assert.Equal(t, existingSpec(), existing, "the existing object must not be modified")
+		})
+	}
+
+	t.Run("missing spec", func(t *testing.T) {
+		_, err := r.scaledObjectDiff(newTestScaledObject(existingSpec()), &unstructured.Unstructured{Object: map[string]interface{}{}}, testLogger())
+		assert.Error(t, err)
+	})
+}
@@ -1,49 +1,40 @@
 package controller
 
 import (
-	"encoding/base64"
+	"fmt"
 	"reflect"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
 )
 
+// secretDiff compares the content of two Secrets. Rendered Secrets may set
+// stringData, which the API server stores base64 encoded in data, so both
+// are compared decoded.
 func (r *GenericReconciler) secretDiff(existingObj, obj *unstructured.Unstructured, log logr.Logger) (bool, error) {
-
-	existingToken := getSecretToken(existingObj, log)
-	desiredToken := getSecretToken(obj, log)
-	return !reflect.DeepEqual(existingToken, desiredToken), nil
-}
-
-func getSecretToken(obj runtime.Object, log logr.Logger) string {
-	unstructuredObj, ok := obj.(*unstructured.Unstructured)
-	if !ok {
-		log.Info("Failed to convert runtime.Object to unstructured.Unstructured for Secret")
-		return ""
-	}
-
-	data, ok := unstructuredObj.Object["data"].(map[string]interface{})
-	if !ok {
-		log.Info("Secret data not found or not a map")
-		return ""
+	existingData, err := transformer.SecretData(existingObj)
+	if err != nil {
+		return false, fmt.Errorf("error reading existing secret: %w", err)
 	}
-
-	encodedTokenInterface, ok := data["hf_token"]
-	if !ok {
-		log.Info("HF Token not found")
-		return ""
+	desiredData, err := transformer.SecretData(obj)
+	if err != nil {
+		return false, fmt.Errorf("error reading desired secret: %w", err)
 	}
-	encodedToken, ok := encodedTokenInterface.(string)
-	if !ok {
-		return ""
+	if !reflect.DeepEqual(existingData, desiredData) {
+		log.Info("Secret diff: data changed")
+		return true, nil
 	}
-
-	decodedToken, err := base64.StdEncoding.DecodeString(string(encodedToken))
-	if err != nil {
-		log.Error(err, "Failed to decode base64 string")
-		return ""
+	if isImmutable(obj) && !isImmutable(existingObj) {
+		log.Info("Secret diff: immutable set")
+		return true, nil
 	}
+	return false, nil
+}
 
-	return string(decodedToken)
+// isImmutable reports whether obj, a Secret or ConfigMap, is immutable.
+func isImmutable(obj *unstructured.Unstructured) bool {
+	immutable, _, _ := unstructured.NestedBool(obj.Object, "immutable")
+	return immutable
 }
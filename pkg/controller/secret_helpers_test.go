@@ -1,106 +1,18 @@
 package controller
 
 import (
+	"context"
 	"encoding/base64"
+	"reflect"
+	"strings"
 	"testing"
 
-	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 )
 
-func TestGetSecretToken(t *testing.T) {
-	logger := testLogger()
-	validToken := "my-secret-token-123"
-
-	testCases := []struct {
-		name          string
-		inputObj      runtime.Object
-		expectedToken string
-	}{
-		{
-			name:          "valid secret with hf_token",
-			inputObj:      newUnstructuredSecret(t, "test-secret-1", &validToken),
-			expectedToken: validToken,
-		},
-		{
-			name:          "secret with no data field",
-			inputObj:      newUnstructuredSecret(t, "test-secret-2", nil), // Helper creates it with no data field
-			expectedToken: "",
-		},
-		{
-			name: "secret with empty data field",
-			inputObj: &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"kind": "Secret",
-					"data": map[string]interface{}{},
-				},
-			},
-			expectedToken: "",
-		},
-		{
-			name: "secret data field is not a map",
-			inputObj: &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"kind": "Secret",
-					"data": "this-is-not-a-map",
-				},
-			},
-			expectedToken: "",
-		},
-		{
-			name: "hf_token key is missing from data",
-			inputObj: &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"kind": "Secret",
-					"data": map[string]interface{}{
-						"other_key": "other_value",
-					},
-				},
-			},
-			expectedToken: "",
-		},
-		{
-			name: "hf_token value is not a string",
-			inputObj: &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"kind": "Secret",
-					"data": map[string]interface{}{
-						"hf_token": 12345, // Not a string
-					},
-				},
-			},
-			expectedToken: "",
-		},
-		{
-			name: "hf_token is not valid base64",
-			inputObj: &unstructured.Unstructured{
-				Object: map[string]interface{}{
-					"kind": "Secret",
-					"data": map[string]interface{}{
-						"hf_token": "this-is-not-base64-$$$",
-					},
-				},
-			},
-			expectedToken: "",
-		},
-		{
-			name:          "input object is not unstructured.Unstructured",
-			inputObj:      &corev1.Secret{}, // Pass a typed object instead
-			expectedToken: "",
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			gotToken := getSecretToken(tc.inputObj, logger)
-			if gotToken != tc.expectedToken {
-				t.Errorf("getSecretToken() got = '%s', want '%s'", gotToken, tc.expectedToken)
-			}
-		})
-	}
-}
-
 func TestSecretDiff(t *testing.T) {
 	logger := testLogger()
 	r := &GenericReconciler{}
@@ -137,6 +49,36 @@ func TestSecretDiff(t *testing.T) {
 			desiredSec:  newUnstructuredSecret(t, "test-secret", nil),
 			expectDiff:  false,
 		},
+		{
+			name:        "stringData matches the stored data",
+			existingSec: newUnstructuredSecret(t, "test-secret", &token1),
+			desiredSec:  withStringData(newUnstructuredSecret(t, "test-secret", nil), "hf_token", token1),
+			expectDiff:  false,
+		},
+		{
+			name:        "stringData differs from the stored data",
+			existingSec: newUnstructuredSecret(t, "test-secret", &token1),
+			desiredSec:  withStringData(newUnstructuredSecret(t, "test-secret", nil), "hf_token", token2),
+			expectDiff:  true,
+		},
+		{
+			name:        "stringData overrides data",
+			existingSec: newUnstructuredSecret(t, "test-secret", &token2),
+			desiredSec:  withStringData(newUnstructuredSecret(t, "test-secret", &token1), "hf_token", token2),
+			expectDiff:  false,
+		},
+		{
+			name:        "other keys are compared",
+			existingSec: newUnstructuredSecret(t, "test-secret", &token1),
+			desiredSec:  withStringData(newUnstructuredSecret(t, "test-secret", &token1), "api_key", token2),
+			expectDiff:  true,
+		},
+		{
+			name:        "desired secret becomes immutable",
+			existingSec: newUnstructuredSecret(t, "test-secret", &token1),
+			desiredSec:  withImmutable(newUnstructuredSecret(t, "test-secret", &token1)),
+			expectDiff:  true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -152,6 +94,79 @@ func TestSecretDiff(t *testing.T) {
 	}
 }
 
+func TestSecretDiffInvalidData(t *testing.T) {
+	r := &GenericReconciler{}
+	token := "my-secret-token-123"
+	invalid := newUnstructuredSecret(t, "test-secret", nil)
+	invalid.Object["data"] = map[string]interface{}{"hf_token": "this-is-not-base64-$$$"}
+
+	if _, err := r.secretDiff(newUnstructuredSecret(t, "test-secret", &token), invalid, testLogger()); err == nil {
+		t.Errorf("secretDiff() with invalid desired data returned no error")
+	}
+	if _, err := r.secretDiff(invalid, newUnstructuredSecret(t, "test-secret", &token), testLogger()); err == nil {
+		t.Errorf("secretDiff() with invalid existing data returned no error")
+	}
+}
+
+func TestReconcileGenericReplacesImmutableSecret(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	token1 := "my-secret-token-123"
+	token2 := "a-different-token-456"
+	target := newUnstructuredSecret(t, "owner", nil)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	var calls []string
+	rc := &MockResourceClient{
+		DeleteFunc: func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, propagation *metav1.DeletionPropagation) error {
+			calls = append(calls, "delete "+name)
+			return nil
+		},
+		CreateFunc: func(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			calls = append(calls, "create "+obj.GetName())
+			return obj, nil
+		},
+		UpdateFunc: func(ctx context.Context, gvk schema.GroupVersionKind, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			calls = append(calls, "update "+obj.GetName())
+			return obj, nil
+		},
+	}
+
+	existing := withImmutable(newUnstructuredSecret(t, "test-secret", &token1))
+	desired := withImmutable(newUnstructuredSecret(t, "test-secret", &token2))
+	if _, err := r.reconcileGeneric(ctx, testLogger(), rc, target, "default", existing, desired, "test-secret", gvk, r.secretDiff); err != nil {
+		t.Fatalf("reconcileGeneric() returned an unexpected error: %v", err)
+	}
+	if want := []string{"delete test-secret", "create test-secret"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("reconcileGeneric() calls = %v, want %v", calls, want)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, string(DependentReplacedEvent)) {
+		t.Errorf("first event = %q, want %s", event, DependentReplacedEvent)
+	}
+
+	// Mutable Secrets are updated in place.
+	calls = nil
+	existing = newUnstructuredSecret(t, "test-secret", &token1)
+	desired = newUnstructuredSecret(t, "test-secret", &token2)
+	if _, err := r.reconcileGeneric(ctx, testLogger(), rc, target, "default", existing, desired, "test-secret", gvk, r.secretDiff); err != nil {
+		t.Fatalf("reconcileGeneric() returned an unexpected error: %v", err)
+	}
+	if want := []string{"update test-secret"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("reconcileGeneric() calls = %v, want %v", calls, want)
+	}
+}
+
+func withStringData(secret *unstructured.Unstructured, key, value string) *unstructured.Unstructured {
+	unstructured.SetNestedField(secret.Object, value, "stringData", key)
+	return secret
+}
+
+func withImmutable(secret *unstructured.Unstructured) *unstructured.Unstructured {
+	secret.Object["immutable"] = true
+	return secret
+}
+
 // Helper function to create an unstructured Secret for testing
 // It takes a plain token string and handles the base64 encoding for you.
 func newUnstructuredSecret(t *testing.T, name string, token *string) *unstructured.Unstructured {
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ShardFilter selects the resources that this replica reconciles when the
+// operator runs sharded, see sharding.Sharder.
+type ShardFilter interface {
+	// Owns reports whether this replica reconciles the resource.
+	Owns(key types.NamespacedName) bool
+	// Subscribe returns a channel that receives a value whenever the
+	// resources owned by this replica change.
+	Subscribe() <-chan struct{}
+}
+
+// ownsShard reports whether this replica reconciles the resource, which it
+// always does when the operator is not sharded.
+func ownsShard(shards ShardFilter, key types.NamespacedName) bool {
+	return shards == nil || shards.Owns(key)
+}
+
+// shardSource enqueues the resources of the kind that this replica owns
+// whenever the shard group changes, as no watch event announces the
+// resources that it takes over from other replicas.
+func (r *GenericReconciler) shardSource() source.Source {
+	changes := r.Shards.Subscribe()
+	return source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changes:
+				}
+				r.enqueueOwned(ctx, queue)
+			}
+		}()
+		return nil
+	})
+}
+
+// enqueueOwned adds the resources of the kind that this replica owns to
+// queue.
+func (r *GenericReconciler) enqueueOwned(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.Gvk.GroupVersion().WithKind(r.Gvk.Kind + "List"))
+	if err := r.Client.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list resources after the shard changed", "gvk", r.Gvk.String())
+		return
+	}
+	for i := range list.Items {
+		key := client.ObjectKeyFromObject(&list.Items[i])
+		if r.Shards.Owns(key) {
+			queue.Add(reconcile.Request{NamespacedName: key})
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// nameShards owns the resources with the listed names.
+type nameShards map[string]bool
+
+func (s nameShards) Owns(key types.NamespacedName) bool { return s[key.Name] }
+
+func (s nameShards) Subscribe() <-chan struct{} { return make(chan struct{}) }
+
+func TestOwnsShard(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "owned"}
+	assert.True(t, ownsShard(nil, key))
+	assert.True(t, ownsShard(nameShards{"owned": true}, key))
+	assert.False(t, ownsShard(nameShards{}, key))
+}
+
+func TestReconcileSkipsTargetsOfOtherShards(t *testing.T) {
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+			return stderrors.New("unexpected get")
+		},
+	}).Build()
+	r := &GenericReconciler{
+		Client: c,
+		Gvk:    eventTestGVK,
+		Shards: nameShards{},
+		Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+			return &MockRegistry{HasIntegrationFunc: func(schema.GroupVersionKind) bool { return true }}
+		}},
+	}
+
+	result, err := r.reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "other"}})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
+
+func TestEnqueueOwned(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(eventTestGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(eventTestGVK.GroupVersion().WithKind(eventTestGVK.Kind+"List"), &unstructured.UnstructuredList{})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTestResource("owned", "default", eventTestGVK),
+		newTestResource("other", "default", eventTestGVK),
+	).Build()
+	r := &GenericReconciler{Client: c, Gvk: eventTestGVK, Shards: nameShards{"owned": true}}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+	r.enqueueOwned(context.Background(), queue)
+
+	require.Equal(t, 1, queue.Len())
+	item, _ := queue.Get()
+	assert.Equal(t, types.NamespacedName{Namespace: "default", Name: "owned"}, item.NamespacedName)
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultShutdownGracePeriod is how long reconciles that are in flight when
+// the manager stops may take to finish.
+const DefaultShutdownGracePeriod = 20 * time.Second
+
+// ShutdownBarrier lets the reconciles that are in flight when the manager
+// stops finish applying their dependents and updating status, instead of
+// being cancelled halfway, e.g. after creating an object but before recording
+// it. Once the manager stops, no new reconciles start, and the contexts of
+// the ones in flight are cancelled only when GracePeriod expires.
+//
+// The manager's graceful shutdown timeout must be longer than GracePeriod,
+// and the pod's termination grace period longer still.
+type ShutdownBarrier struct {
+	// GracePeriod overrides DefaultShutdownGracePeriod.
+	GracePeriod time.Duration
+
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+	// expired is cancelled when the grace period expires.
+	expired context.Context
+	expire  context.CancelFunc
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica reconciles resources.
+func (b *ShutdownBarrier) NeedLeaderElection() bool {
+	return false
+}
+
+// Enter registers a reconcile that runs with ctx. It returns the context to
+// reconcile with, which is not cancelled with ctx but when the grace period
+// expires, and a function to call when the reconcile is done. ok is false if
+// the manager is stopping, in which case the reconcile must not start.
+func (b *ShutdownBarrier) Enter(ctx context.Context) (context.Context, func(), bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.draining {
+		return nil, nil, false
+	}
+	b.init()
+	b.inFlight.Add(1)
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(b.expired, cancel)
+	return drainCtx, func() {
+		stop()
+		cancel()
+		b.inFlight.Done()
+	}, true
+}
+
+// Start waits for ctx to be done, then for the reconciles in flight, up to
+// the grace period.
+func (b *ShutdownBarrier) Start(ctx context.Context) error {
+	<-ctx.Done()
+	b.mu.Lock()
+	b.draining = true
+	b.init()
+	b.mu.Unlock()
+
+	logger := log.FromContext(ctx)
+	gracePeriod := b.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultShutdownGracePeriod
+	}
+	drained := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(drained)
+	}()
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		logger.Info("Reconciles in flight finished before shutdown")
+	case <-timer.C:
+		logger.Info("Shutdown grace period expired, cancelling the reconciles in flight", "gracePeriod", gracePeriod)
+		b.expire()
+	}
+	return nil
+}
+
+// init creates the expired context. b.mu must be held.
+func (b *ShutdownBarrier) init() {
+	if b.expired == nil {
+		b.expired, b.expire = context.WithCancel(context.Background())
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestShutdownBarrierDrains(t *testing.T) {
+	barrier := &ShutdownBarrier{GracePeriod: time.Minute}
+	managerCtx, stopManager := context.WithCancel(context.Background())
+
+	reconcileCtx, done, ok := barrier.Enter(managerCtx)
+	require.True(t, ok)
+
+	stopped := make(chan struct{})
+	go func() {
+		assert.NoError(t, barrier.Start(managerCtx))
+		close(stopped)
+	}()
+	stopManager()
+
+	// The reconcile in flight keeps its context, new ones do not start.
+	require.Eventually(t, func() bool {
+		_, _, ok := barrier.Enter(context.Background())
+		return !ok
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, reconcileCtx.Err())
+	select {
+	case <-stopped:
+		t.Fatal("Start returned before the reconcile in flight finished")
+	default:
+	}
+
+	done()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after the reconcile in flight finished")
+	}
+	assert.Error(t, reconcileCtx.Err(), "the context is released when the reconcile is done")
+}
+
+func TestShutdownBarrierGracePeriod(t *testing.T) {
+	barrier := &ShutdownBarrier{GracePeriod: 10 * time.Millisecond}
+	managerCtx, stopManager := context.WithCancel(context.Background())
+	reconcileCtx, done, ok := barrier.Enter(managerCtx)
+	require.True(t, ok)
+	defer done()
+
+	stopManager()
+	require.NoError(t, barrier.Start(managerCtx))
+	select {
+	case <-reconcileCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the reconcile in flight was not cancelled after the grace period")
+	}
+}
+
+func TestReconcileDuringShutdown(t *testing.T) {
+	barrier := &ShutdownBarrier{}
+	managerCtx, stopManager := context.WithCancel(context.Background())
+	stopManager()
+	require.NoError(t, barrier.Start(managerCtx))
+
+	registry := &MockRegistry{HasIntegrationFunc: func(schema.GroupVersionKind) bool { return true }}
+	r := &GenericReconciler{
+		Mutex:       &sync.Mutex{},
+		Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface { return registry }},
+		Shutdown:    barrier,
+	}
+	// The reconciler has no client, it must return before reading the target.
+	result, err := r.reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "llama"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SourceGenerationAnnotation is set on every dependent to the generation of
+// the target that it was last applied from. Dependents that still carry an
+// older generation, e.g. the stable Deployment of a rollout in progress or a
+// protected dependent, are reported in status.outdatedDependentCount and by
+// the sourceGeneration of their status.dependentResources entry.
+const SourceGenerationAnnotation = "karo.gke.io/source-generation"
+
+// setSourceGeneration sets the SourceGenerationAnnotation of obj to
+// generation.
+func setSourceGeneration(obj *unstructured.Unstructured, generation int64) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SourceGenerationAnnotation] = strconv.FormatInt(generation, 10)
+	obj.SetAnnotations(annotations)
+}
+
+// copySourceGeneration sets the SourceGenerationAnnotation of obj to the one
+// of from, or removes it if from has none.
+func copySourceGeneration(obj, from *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	value, ok := from.GetAnnotations()[SourceGenerationAnnotation]
+	if !ok {
+		if _, set := annotations[SourceGenerationAnnotation]; set {
+			delete(annotations, SourceGenerationAnnotation)
+			obj.SetAnnotations(annotations)
+		}
+		return
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SourceGenerationAnnotation] = value
+	obj.SetAnnotations(annotations)
+}
+
+// sourceGeneration returns the SourceGenerationAnnotation of obj, and false if
+// it has none or it is not a number.
+func sourceGeneration(obj *unstructured.Unstructured) (int64, bool) {
+	value, ok := obj.GetAnnotations()[SourceGenerationAnnotation]
+	if !ok {
+		return 0, false
+	}
+	generation, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return generation, true
+}
+
+// sourceGenerationChanged reports whether existingObj was applied from another
+// generation of the target than obj. Dependents whose content did not change
+// are updated too, so that the annotation tells which ones lag behind.
+func sourceGenerationChanged(existingObj, obj *unstructured.Unstructured) bool {
+	value, ok := obj.GetAnnotations()[SourceGenerationAnnotation]
+	return ok && existingObj.GetAnnotations()[SourceGenerationAnnotation] != value
+}
+
+// outdatedDependentCount returns the number of dependents whose source
+// generation is known and differs from generation.
+func outdatedDependentCount(dependents []map[string]interface{}, generation int64) int64 {
+	var count int64
+	for _, dependent := range dependents {
+		if source, ok := dependent["sourceGeneration"].(int64); ok && source != generation {
+			count++
+		}
+	}
+	return count
+}
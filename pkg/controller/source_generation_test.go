@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+func withSourceGeneration(obj *unstructured.Unstructured, generation int64) *unstructured.Unstructured {
+	setSourceGeneration(obj, generation)
+	return obj
+}
+
+func TestSourceGeneration(t *testing.T) {
+	token := "my-secret-token-123"
+	obj := withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 3)
+	generation, ok := sourceGeneration(obj)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), generation)
+
+	_, ok = sourceGeneration(newUnstructuredSecret(t, "test-secret", &token))
+	assert.False(t, ok)
+	obj.SetAnnotations(map[string]string{SourceGenerationAnnotation: "latest"})
+	_, ok = sourceGeneration(obj)
+	assert.False(t, ok)
+
+	assert.True(t, sourceGenerationChanged(newUnstructuredSecret(t, "test-secret", &token), withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 1)))
+	assert.True(t, sourceGenerationChanged(withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 1), withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 2)))
+	assert.False(t, sourceGenerationChanged(withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 2), withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 2)))
+	assert.False(t, sourceGenerationChanged(withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 2), newUnstructuredSecret(t, "test-secret", &token)))
+}
+
+func TestCopySourceGeneration(t *testing.T) {
+	token := "my-secret-token-123"
+	obj := withSourceGeneration(newUnstructuredSecret(t, "test-secret", &token), 2)
+	obj.SetAnnotations(map[string]string{SourceGenerationAnnotation: "2", "team": "serving"})
+
+	copySourceGeneration(obj, withSourceGeneration(newUnstructuredSecret(t, "stable", &token), 1))
+	assert.Equal(t, map[string]string{SourceGenerationAnnotation: "1", "team": "serving"}, obj.GetAnnotations())
+
+	// Dependents applied before the annotation existed have no generation.
+	copySourceGeneration(obj, newUnstructuredSecret(t, "stable", &token))
+	assert.Equal(t, map[string]string{"team": "serving"}, obj.GetAnnotations())
+}
+
+func TestOutdatedDependentCount(t *testing.T) {
+	dependents := []map[string]interface{}{
+		{"kind": "Deployment", "name": "llama", "sourceGeneration": int64(3)},
+		{"kind": "Service", "name": "llama", "sourceGeneration": int64(4)},
+		{"kind": "ConfigMap", "name": "llama", "status": "Error: forbidden"},
+	}
+	assert.Equal(t, int64(1), outdatedDependentCount(dependents, 4))
+	assert.Equal(t, int64(2), outdatedDependentCount(dependents, 5))
+	assert.Zero(t, outdatedDependentCount(nil, 1))
+}
+
+func TestReconcileGenericSourceGeneration(t *testing.T) {
+	r := &GenericReconciler{Recorder: record.NewFakeRecorder(10)}
+	token := "my-secret-token-123"
+	target := newTestResource("llama", "default", eventTestGVK)
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	var updated []string
+	rc := &MockResourceClient{
+		UpdateFunc: func(_ context.Context, _ schema.GroupVersionKind, _ string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			updated = append(updated, obj.GetName())
+			return obj, nil
+		},
+	}
+
+	// The secrets are labeled as rendered by karo, so they are not adopted.
+	secret := func() *unstructured.Unstructured {
+		obj := newUnstructuredSecret(t, "test-secret", &token)
+		obj.SetLabels(map[string]string{ManagedByLabel: ManagedByValue})
+		return obj
+	}
+
+	// Unchanged dependents are updated to record the new generation.
+	existing := withSourceGeneration(secret(), 1)
+	live, err := r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", existing, withSourceGeneration(secret(), 2), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-secret"}, updated)
+	generation, _ := sourceGeneration(live)
+	assert.Equal(t, int64(2), generation)
+
+	// Once recorded, they are left alone.
+	updated = nil
+	_, err = r.reconcileGeneric(context.Background(), testLogger(), rc, target, "default", live, withSourceGeneration(secret(), 2), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Empty(t, updated)
+
+	// Protected dependents keep their generation and do not drift because of it.
+	ctx, drift := withProtectedDrift(context.Background())
+	existing = withSourceGeneration(protect(secret()), 1)
+	live, err = r.reconcileGeneric(ctx, testLogger(), rc, target, "default", existing, withSourceGeneration(secret(), 2), "test-secret", gvk, r.secretDiff)
+	require.NoError(t, err)
+	assert.Same(t, existing, live)
+	assert.Empty(t, updated)
+	assert.Empty(t, drift.list())
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	SpecInvalidConditionType    = "SpecInvalid"
+	MissingRequiredFieldsReason = "MissingRequiredFields"
+	RequiredFieldsPresentReason = "RequiredFieldsPresent"
+	SpecInvalidReason           = "SpecInvalid"
+	ImageNotAllowedReason       = "ImageNotAllowed"
+	ImagesAllowedReason         = "ImagesAllowed"
+	SpecInvalidEvent            = modelv1.EventReasonSpecInvalid
+)
+
+// SpecInvalidError is returned when a resource lacks fields that the
+// integration requires, so that its templates are not rendered.
+type SpecInvalidError struct {
+	Missing []string
+}
+
+func (e *SpecInvalidError) Error() string {
+	return fmt.Sprintf("missing required field(s): %s", strings.Join(e.Missing, ", "))
+}
+
+// missingRequiredFields returns the dot-separated paths that are not set on
+// obj. A field that is explicitly null counts as missing.
+func missingRequiredFields(obj *unstructured.Unstructured, paths []string) []string {
+	var missing []string
+	for _, path := range paths {
+		value, found, err := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(path, ".")...)
+		if err != nil || !found || value == nil {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
+
+// validateRequiredFields checks the target against the required fields of
+// its integration before the templates are rendered, so that a resource
+// missing e.g. spec.autoscaling gets a SpecInvalid condition naming the path
+// instead of an opaque template error. Targets of integrations without
+// required fields get no condition.
+func (r *GenericReconciler) validateRequiredFields(target *unstructured.Unstructured) error {
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(target.GroupVersionKind())
+	paths := integrationSpec.RequiredFields
+	if len(paths) == 0 {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               SpecInvalidConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             RequiredFieldsPresentReason,
+		Message:            "All required fields are set.",
+		ObservedGeneration: target.GetGeneration(),
+	}
+	missing := missingRequiredFields(target, paths)
+	if len(missing) == 0 {
+		// The condition is left to the validation that set it, e.g. of the
+		// accelerators, so that it does not flip on every reconcile.
+		existing := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+		if existing != nil && existing.Status == metav1.ConditionTrue && existing.Reason != MissingRequiredFieldsReason {
+			return nil
+		}
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = MissingRequiredFieldsReason
+		condition.Message = fmt.Sprintf("Missing required field(s): %s", strings.Join(missing, ", "))
+		if !meta.IsStatusConditionTrue(targetConditions(target), SpecInvalidConditionType) {
+			r.eventf(target, corev1.EventTypeWarning, SpecInvalidEvent, "Not rendering %s %s: missing required field(s) %s", target.GetKind(), target.GetName(), strings.Join(missing, ", "))
+		}
+	}
+	if err := setTargetCondition(target, condition); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &SpecInvalidError{Missing: missing}
+	}
+	return nil
+}
+
+// setImagePolicyCondition sets the SpecInvalid condition of the target when
+// the security policy rejects a rendered image, e.g. an AgenticSandbox whose
+// class requests an image that is not allowed, so that no pod is created
+// with it. The condition is cleared once the images render again. It returns
+// true if renderErr is such a rejection.
+func (r *GenericReconciler) setImagePolicyCondition(target *unstructured.Unstructured, renderErr error) (bool, error) {
+	var policyErr *transformer.ImagePolicyError
+	if !stderrors.As(renderErr, &policyErr) {
+		existing := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+		if renderErr != nil || existing == nil || existing.Reason != ImageNotAllowedReason {
+			return false, nil
+		}
+		return false, setTargetCondition(target, metav1.Condition{
+			Type:               SpecInvalidConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             ImagesAllowedReason,
+			Message:            "All images are allowed by the security policy.",
+			ObservedGeneration: target.GetGeneration(),
+		})
+	}
+
+	message := fmt.Sprintf("Not rendering %s %s: %v", target.GetKind(), target.GetName(), policyErr)
+	existing := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	if existing == nil || existing.Status != metav1.ConditionTrue || existing.Message != message {
+		r.eventf(target, corev1.EventTypeWarning, SpecInvalidEvent, "%s", message)
+	}
+	return true, setTargetCondition(target, metav1.Condition{
+		Type:               SpecInvalidConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             ImageNotAllowedReason,
+		Message:            message,
+		ObservedGeneration: target.GetGeneration(),
+	})
+}
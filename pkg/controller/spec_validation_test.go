@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+func TestMissingRequiredFields(t *testing.T) {
+	target := newTestResource("llama", "default", eventTestGVK)
+	target.Object["spec"] = map[string]interface{}{
+		"image":       "vllm:latest",
+		"autoscaling": map[string]interface{}{"minReplicas": int64(1), "maxReplicas": nil},
+		"port":        "8080",
+	}
+
+	missing := missingRequiredFields(target, []string{
+		"spec.image",
+		"spec.autoscaling.minReplicas",
+		"spec.autoscaling.maxReplicas",
+		"spec.port.number",
+		"spec.resources",
+	})
+	assert.Equal(t, []string{"spec.autoscaling.maxReplicas", "spec.port.number", "spec.resources"}, missing)
+}
+
+func TestValidateRequiredFields(t *testing.T) {
+	newReconciler := func(paths ...string) (*GenericReconciler, *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		return &GenericReconciler{
+			Recorder: recorder,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{RequiredFields: paths}, true
+				}}
+			}},
+		}, recorder
+	}
+
+	t.Run("no required fields", func(t *testing.T) {
+		r, _ := newReconciler()
+		target := newTestResource("llama", "default", eventTestGVK)
+		require.NoError(t, r.validateRequiredFields(target))
+		assert.Nil(t, meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType))
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		r, recorder := newReconciler("spec.image", "spec.autoscaling.minReplicas")
+		target := newTestResource("llama", "default", eventTestGVK)
+		unstructured.SetNestedField(target.Object, "vllm:latest", "spec", "image")
+
+		err := r.validateRequiredFields(target)
+		var specErr *SpecInvalidError
+		require.True(t, stderrors.As(err, &specErr))
+		assert.Equal(t, []string{"spec.autoscaling.minReplicas"}, specErr.Missing)
+
+		condition := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+		require.NotNil(t, condition)
+		assert.Equal(t, "True", string(condition.Status))
+		assert.Equal(t, MissingRequiredFieldsReason, condition.Reason)
+		assert.Equal(t, "Missing required field(s): spec.autoscaling.minReplicas", condition.Message)
+		require.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, "Warning SpecInvalid")
+
+		// The event is only recorded when the condition becomes true.
+		require.Error(t, r.validateRequiredFields(target))
+		assert.Empty(t, recorder.Events)
+
+		unstructured.SetNestedField(target.Object, int64(1), "spec", "autoscaling", "minReplicas")
+		require.NoError(t, r.validateRequiredFields(target))
+		condition = meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+		require.NotNil(t, condition)
+		assert.Equal(t, "False", string(condition.Status))
+		assert.Equal(t, RequiredFieldsPresentReason, condition.Reason)
+	})
+
+	t.Run("condition of another validation", func(t *testing.T) {
+		r, _ := newReconciler("spec.accelerator")
+		target := newTestCapacityTarget("nvidia-l4", "meta-llama/Llama-3.1-70B-Instruct", nil)
+		require.Error(t, r.validateAcceleratorCapacity(target))
+
+		require.NoError(t, r.validateRequiredFields(target))
+		condition := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+		require.NotNil(t, condition)
+		assert.Equal(t, InsufficientAcceleratorReason, condition.Reason)
+	})
+}
+
+func TestBuildConditionsSpecInvalid(t *testing.T) {
+	target := newTestResource("test-resource", "default", eventTestGVK)
+	err := &SpecInvalidError{Missing: []string{"spec.autoscaling"}}
+
+	conditions, buildErr := (&GenericReconciler{}).buildConditions(context.Background(), target, true, err)
+	require.NoError(t, buildErr)
+	require.Len(t, conditions, 1)
+	ready := conditions[0].(map[string]interface{})
+	assert.Equal(t, "False", ready["status"])
+	assert.Equal(t, SpecInvalidReason, ready["reason"])
+	assert.Equal(t, "Failed to reconcile: missing required field(s): spec.autoscaling", ready["message"])
+}
+
+func TestSetImagePolicyCondition(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	target := newTestResource("sandbox", "default", eventTestGVK)
+	renderErr := fmt.Errorf("wrapped: %w", &transformer.ImagePolicyError{
+		Kind:      "Deployment",
+		Name:      "sandbox",
+		Container: "sandbox-runtime",
+		Image:     "docker.io/attacker/miner:latest",
+		Reason:    "matches none of the allowed images",
+	})
+
+	// Other render errors and successful renders leave the condition alone.
+	rejected, err := r.setImagePolicyCondition(target, stderrors.New("template error"))
+	require.NoError(t, err)
+	assert.False(t, rejected)
+	assert.Nil(t, meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType))
+
+	rejected, err = r.setImagePolicyCondition(target, renderErr)
+	require.NoError(t, err)
+	assert.True(t, rejected)
+	condition := meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "True", string(condition.Status))
+	assert.Equal(t, ImageNotAllowedReason, condition.Reason)
+	assert.Equal(t, `Not rendering TestResource sandbox: image "docker.io/attacker/miner:latest" of container "sandbox-runtime" of Deployment sandbox matches none of the allowed images`, condition.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning SpecInvalid")
+
+	// The event is only recorded when the condition changes.
+	_, err = r.setImagePolicyCondition(target, renderErr)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	conditions, err := r.buildConditions(context.Background(), target, true, renderErr)
+	require.NoError(t, err)
+	for _, c := range conditions {
+		if c.(map[string]interface{})["type"] == ReadyConditionType {
+			assert.Equal(t, SpecInvalidReason, c.(map[string]interface{})["reason"])
+		}
+	}
+
+	rejected, err = r.setImagePolicyCondition(target, nil)
+	require.NoError(t, err)
+	assert.False(t, rejected)
+	condition = meta.FindStatusCondition(targetConditions(target), SpecInvalidConditionType)
+	require.NotNil(t, condition)
+	assert.Equal(t, "False", string(condition.Status))
+	assert.Equal(t, ImagesAllowedReason, condition.Reason)
+}
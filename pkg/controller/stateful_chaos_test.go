@@ -0,0 +1,329 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/GoogleCloudPlatform/karo/pkg/controller"
+	"github.com/GoogleCloudPlatform/karo/pkg/controller/kindtest"
+)
+
+// These tests drive the stateful KindReconcilers through interleaved events
+// with the kindtest harness, which also checks that every reconciliation is
+// idempotent and that no phase regresses.
+
+var (
+	modelDataPhases = kindtest.Phases{
+		Order:    []string{"Pending", "Syncing"},
+		Terminal: []string{"Succeeded", "Failed"},
+		Volatile: []string{"lastSyncTime"},
+	}
+	sandboxPhases = kindtest.Phases{
+		Order: []string{"Pending", "Running", "Terminating"},
+	}
+)
+
+func chaosModelData() *unstructured.Unstructured {
+	modelData := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	modelData.SetAPIVersion("model.skippy.io/v1")
+	modelData.SetKind("ModelData")
+	modelData.SetName("llama")
+	modelData.SetNamespace("default")
+	modelData.SetUID("modeldata-uid")
+	unstructured.SetNestedMap(modelData.Object, map[string]interface{}{
+		"gcsBucket": "gs://models",
+		"prefix":    "llama",
+	}, "spec", "destination")
+	return modelData
+}
+
+// chaosJob returns the sync Job of the ModelData, completed or failed once
+// condition is set.
+func chaosJob(condition batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama", Namespace: "default"},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": "llama"}},
+		},
+	}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+	}
+	return job
+}
+
+// chaosJobPod returns the finished pod of the sync Job, which reports the
+// synced revision in its termination message.
+func chaosJobPod(revision string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama-sync", Namespace: "default", Labels: map[string]string{"job-name": "llama"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "gcloud-upload",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: revision + "\n"}},
+		}}},
+	}
+}
+
+// syncingModelData returns a harness whose ModelData is syncing with a
+// running Job.
+func syncingModelData(t *testing.T) *kindtest.Harness {
+	job := chaosJob("")
+	h := kindtest.New(t, &controller.ModelDataReconciler{}, chaosModelData(), modelDataPhases, job)
+	result, err := h.Reconcile()
+	require.NoError(t, err)
+	assert.True(t, result.Requeue)
+	h.ExpectPhase("Pending")
+
+	h.SetDependents(job)
+	result, err = h.Reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, result.RequeueAfter)
+	h.ExpectPhase("Syncing")
+	return h
+}
+
+func TestModelDataChaos(t *testing.T) {
+	t.Run("lost status updates are recomputed", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.ExpectPhase("Syncing")
+
+		h.Apply(chaosJob(batchv1.JobComplete))
+		h.Apply(chaosJobPod("abc123"))
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.ExpectPhase("Syncing")
+
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Succeeded")
+		revision, _, _ := unstructured.NestedString(h.Target().Object, "status", "resolvedRevision")
+		assert.Equal(t, "abc123", revision)
+	})
+
+	t.Run("job deleted mid-sync", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.Delete(chaosJob(""))
+		result, err := h.Reconcile()
+		require.NoError(t, err)
+		assert.Equal(t, 15*time.Second, result.RequeueAfter)
+		h.ExpectPhase("Syncing")
+
+		// The generic reconciler recreates the Job from the templates.
+		h.Apply(chaosJob(""))
+		h.Reconcile()
+		h.ExpectPhase("Syncing")
+		h.Apply(chaosJob(batchv1.JobComplete))
+		h.Apply(chaosJobPod("abc123"))
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Succeeded")
+	})
+
+	t.Run("spec updated while the job runs", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.UpdateSpec(func(spec map[string]interface{}) {
+			unstructured.SetNestedField(spec, "llama-v2", "destination", "prefix")
+		})
+		h.Reconcile()
+		h.ExpectPhase("Syncing")
+
+		h.Apply(chaosJob(batchv1.JobComplete))
+		h.Apply(chaosJobPod("abc123"))
+		h.ReconcileUntilSettled(3)
+		path, _, _ := unstructured.NestedString(h.Target().Object, "status", "finalGcsPath")
+		assert.Equal(t, "gs://models/llama-v2/abc123", path)
+	})
+
+	t.Run("failed render does not reset the sync", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.SetDependents()
+		h.Reconcile()
+		h.ExpectPhase("Syncing")
+	})
+
+	t.Run("pods cannot be listed after the job completed", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.Apply(chaosJob(batchv1.JobComplete))
+		h.Apply(chaosJobPod("abc123"))
+		h.FailNext("list", apierrors.NewTimeoutError("request timed out", 1))
+		_, err := h.Reconcile()
+		require.Error(t, err)
+		h.ExpectPhase("Syncing")
+
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Succeeded")
+	})
+
+	t.Run("terminal phases are kept", func(t *testing.T) {
+		h := syncingModelData(t)
+		h.Apply(chaosJob(batchv1.JobFailed))
+		h.Reconcile()
+		h.ExpectPhase("Failed")
+
+		h.Apply(chaosJob(batchv1.JobComplete))
+		h.Apply(chaosJobPod("abc123"))
+		h.UpdateSpec(func(spec map[string]interface{}) {
+			unstructured.SetNestedField(spec, "llama-v2", "destination", "prefix")
+		})
+		h.ReconcileUntilSettled(1)
+		h.ExpectPhase("Failed")
+	})
+}
+
+func chaosSandbox() *unstructured.Unstructured {
+	sandbox := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	sandbox.SetAPIVersion("model.skippy.io/v1")
+	sandbox.SetKind("AgenticSandbox")
+	sandbox.SetName("session")
+	sandbox.SetNamespace("default")
+	sandbox.SetUID("sandbox-uid")
+	return sandbox
+}
+
+func chaosDeployment(available bool) *appsv1.Deployment {
+	status := corev1.ConditionFalse
+	if available {
+		status = corev1.ConditionTrue
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "session", Namespace: "default"},
+		Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: status},
+		}},
+	}
+}
+
+func chaosService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "session", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.7",
+			Ports:     []corev1.ServicePort{{Port: 8888}},
+		},
+	}
+}
+
+func TestAgenticSandboxChaos(t *testing.T) {
+	t.Run("rollout with lost status updates and deleted deployment", func(t *testing.T) {
+		h := kindtest.New(t, &controller.AgenticSandboxReconciler{}, chaosSandbox(), sandboxPhases)
+		result, err := h.Reconcile()
+		require.NoError(t, err)
+		assert.Equal(t, ctrl.Result{Requeue: true}, result)
+		h.ExpectPhase("Pending")
+
+		h.Reconcile()
+		h.ExpectPhase("Pending")
+
+		h.Apply(chaosDeployment(false))
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.Delete(chaosDeployment(false))
+		h.Reconcile()
+		h.ExpectPhase("Pending")
+
+		h.Apply(chaosDeployment(true))
+		h.Apply(chaosService())
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.ExpectPhase("Pending")
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Running")
+
+		// A later outage of the Deployment does not hide the sandbox again.
+		h.Apply(chaosDeployment(false))
+		h.ReconcileUntilSettled(1)
+		h.ExpectPhase("Running")
+		ip, _, _ := unstructured.NestedString(h.Target().Object, "status", "sandboxIP")
+		assert.Equal(t, "10.0.0.7", ip)
+	})
+
+	t.Run("failed lookups keep the phase", func(t *testing.T) {
+		h := kindtest.New(t, &controller.AgenticSandboxReconciler{}, chaosSandbox(), sandboxPhases, chaosDeployment(true))
+		h.Reconcile()
+		h.FailNext("get", apierrors.NewTimeoutError("request timed out", 1))
+		_, err := h.Reconcile()
+		require.Error(t, err)
+		h.ExpectPhase("Pending")
+
+		h.Apply(chaosService())
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Running")
+	})
+
+	t.Run("warm pool claims survive lost status updates", func(t *testing.T) {
+		class := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		class.SetAPIVersion("model.skippy.io/v1")
+		class.SetKind("AgenticSandboxClass")
+		class.SetName("python")
+		unstructured.SetNestedField(class.Object, int64(2), "spec", "warmPool", "size")
+		sandbox := chaosSandbox()
+		unstructured.SetNestedField(sandbox.Object, "python", "spec", "className")
+
+		h := kindtest.New(t, &controller.AgenticSandboxReconciler{}, sandbox, sandboxPhases, class, chaosPoolPod("pool-a"), chaosService())
+		h.Reconcile()
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.ExpectPhase("Pending")
+
+		// Another ready pod must not be claimed by the retry.
+		h.Apply(chaosPoolPod("pool-b"))
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Running")
+		podName, _, _ := unstructured.NestedString(h.Target().Object, "status", "podName")
+		assert.Equal(t, "pool-a", podName)
+
+		unclaimed := &corev1.Pod{}
+		require.NoError(t, h.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "pool-b"}, unclaimed))
+		assert.Equal(t, "python", unclaimed.Labels["sandbox.model.skippy.io/pool"])
+	})
+
+	t.Run("deletion waits for the scratch cleanup", func(t *testing.T) {
+		sandbox := chaosSandbox()
+		unstructured.SetNestedField(sandbox.Object, "gs://scratch/session", "spec", "scratch", "artifactsURI")
+		h := kindtest.New(t, &controller.AgenticSandboxReconciler{}, sandbox, sandboxPhases, chaosDeployment(true), chaosService())
+		h.ReconcileUntilSettled(3)
+		h.ExpectPhase("Running")
+		assert.Equal(t, []string{"model.skippy.io/scratch-cleanup"}, h.Target().GetFinalizers())
+
+		h.Delete(h.Target())
+		h.ConflictNextStatusUpdate()
+		h.Reconcile()
+		h.Reconcile()
+		h.ExpectPhase("Terminating")
+
+		jobs := &batchv1.JobList{}
+		require.NoError(t, h.Client.List(context.Background(), jobs))
+		require.Len(t, jobs.Items, 1)
+		job := jobs.Items[0]
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		h.Apply(&job)
+		h.Reconcile()
+		assert.False(t, h.Exists())
+	})
+}
+
+func chaosPoolPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"sandbox.model.skippy.io/pool": "python"},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
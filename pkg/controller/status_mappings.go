@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// reservedStatusFields are written by the reconciler itself and cannot be the
+// target of a status mapping.
+var reservedStatusFields = map[string]bool{
+	"accelerator":            true,
+	"conditions":             true,
+	"createdResourceCount":   true,
+	"dependentInventory":     true,
+	"dependentResources":     true,
+	"estimatedCost":          true,
+	"imageDigests":           true,
+	"inferencePool":          true,
+	"lastAppliedTime":        true,
+	"observedGeneration":     true,
+	"outdatedDependentCount": true,
+	"patches":                true,
+	"preflight":              true,
+	"reconcileHistory":       true,
+	"renderHash":             true,
+	"stickyContext":          true,
+}
+
+// applyStatusMappings copies the values selected by the integration's status
+// mappings from the live dependents into the status of the target, so that
+// consumers find e.g. the endpoint address without following the dependents.
+func (r *GenericReconciler) applyStatusMappings(ctx context.Context, log logr.Logger, target *unstructured.Unstructured, objs []*unstructured.Unstructured, rc modelv1.ResourceClientInterface) error {
+	integrationSpec, _ := r.Transformer.Registry().GetIntegrationSpec(r.Gvk)
+	mappings := integrationSpec.StatusMappings
+	for _, mapping := range mappings {
+		fields := strings.Split(mapping.Field, ".")
+		if mapping.Field == "" || reservedStatusFields[fields[0]] {
+			return fmt.Errorf("status mapping of %s to status.%s: the field is reserved", mapping.Kind, mapping.Field)
+		}
+		path := append([]string{"status"}, fields...)
+
+		dependent := findDependent(objs, mapping)
+		if dependent == nil {
+			unstructured.RemoveNestedField(target.Object, path...)
+			continue
+		}
+		live, err := rc.Get(ctx, dependent.GroupVersionKind(), dependent.GetNamespace(), dependent.GetName())
+		if errors.IsNotFound(err) {
+			unstructured.RemoveNestedField(target.Object, path...)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error getting resource %s %s/%s: %w", dependent.GroupVersionKind().String(), dependent.GetNamespace(), dependent.GetName(), err)
+		}
+
+		value, found, err := evaluateJSONPath(live.Object, mapping.JSONPath)
+		if err != nil {
+			return fmt.Errorf("status mapping of %s %s to status.%s: %w", live.GetKind(), live.GetName(), mapping.Field, err)
+		}
+		if !found {
+			log.V(1).Info("Status mapping has no value yet", "kind", live.GetKind(), "name", live.GetName(), "jsonPath", mapping.JSONPath)
+			unstructured.RemoveNestedField(target.Object, path...)
+			continue
+		}
+		if err := unstructured.SetNestedField(target.Object, value, path...); err != nil {
+			return fmt.Errorf("failed to set status.%s: %w", mapping.Field, err)
+		}
+	}
+	return nil
+}
+
+// findDependent returns the rendered dependent that a status mapping selects.
+func findDependent(objs []*unstructured.Unstructured, mapping modelv1.IntegrationStatusMappingSpec) *unstructured.Unstructured {
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if gvk.Kind != mapping.Kind || gvk.Group != mapping.Group {
+			continue
+		}
+		if mapping.Name == "" || obj.GetName() == mapping.Name {
+			return obj
+		}
+	}
+	return nil
+}
+
+// evaluateJSONPath returns the value that a JSONPath expression selects in
+// obj. Expressions that select several values return them as a list.
+func evaluateJSONPath(obj map[string]interface{}, expression string) (interface{}, bool, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	parser := jsonpath.New("statusMapping").AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, false, fmt.Errorf("invalid JSONPath %q: %w", expression, err)
+	}
+	results, err := parser.FindResults(obj)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to evaluate JSONPath %q: %w", expression, err)
+	}
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			if value.IsValid() && value.CanInterface() {
+				values = append(values, runtime.DeepCopyJSONValue(value.Interface()))
+			}
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return values[0], true, nil
+	}
+	return values, true, nil
+}
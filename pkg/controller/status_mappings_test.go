@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestEvaluateJSONPath(t *testing.T) {
+	obj := map[string]interface{}{
+		"spec": map[string]interface{}{"clusterIP": "10.0.0.1", "ports": []interface{}{
+			map[string]interface{}{"name": "http", "port": int64(80)},
+			map[string]interface{}{"name": "grpc", "port": int64(9000)},
+		}},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+	}
+
+	testCases := []struct {
+		name       string
+		expression string
+		want       interface{}
+		wantFound  bool
+	}{
+		{name: "string without braces", expression: ".spec.clusterIP", want: "10.0.0.1", wantFound: true},
+		{name: "number with braces", expression: "{.spec.ports[0].port}", want: int64(80), wantFound: true},
+		{name: "several values", expression: "{.spec.ports[*].name}", want: []interface{}{"http", "grpc"}, wantFound: true},
+		{name: "object", expression: "{.spec.ports[?(@.name==\"grpc\")]}", want: map[string]interface{}{"name": "grpc", "port": int64(9000)}, wantFound: true},
+		{name: "missing key", expression: "{.status.loadBalancer.ingress[0].ip}"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, found, err := evaluateJSONPath(obj, tc.expression)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantFound, found)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, _, err := evaluateJSONPath(obj, "{.spec[")
+	assert.ErrorContains(t, err, "invalid JSONPath")
+}
+
+func TestApplyStatusMappings(t *testing.T) {
+	targetGVK := schema.GroupVersionKind{Group: "testing.karo.pkg.com", Version: "v1", Kind: "TestResource"}
+	serviceGVK := schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	newReconciler := func(mappings ...modelv1.IntegrationStatusMappingSpec) *GenericReconciler {
+		return &GenericReconciler{
+			Gvk: targetGVK,
+			Transformer: &MockTransformer{RegistryFunc: func() modelv1.RegistryInterface {
+				return &MockRegistry{GetIntegrationSpecFunc: func(schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+					return modelv1.IntegrationSpec{StatusMappings: mappings}, true
+				}}
+			}},
+		}
+	}
+	service := newTestResource("vllm", "default", serviceGVK)
+	_ = unstructured.SetNestedField(service.Object, "10.0.0.1", "spec", "clusterIP")
+	rendered := []*unstructured.Unstructured{
+		newTestResource("other", "default", serviceGVK),
+		newTestResource("vllm", "default", serviceGVK),
+	}
+	store := &mapResourceClient{objs: map[string]*unstructured.Unstructured{"vllm": service}}
+
+	t.Run("copies values and removes stale ones", func(t *testing.T) {
+		r := newReconciler(
+			modelv1.IntegrationStatusMappingSpec{Kind: "Service", Name: "vllm", JSONPath: ".spec.clusterIP", Field: "endpoint.clusterIP"},
+			modelv1.IntegrationStatusMappingSpec{Kind: "Service", Name: "vllm", JSONPath: "{.status.loadBalancer.ingress[0].ip}", Field: "endpoint.externalIP"},
+		)
+		target := newTestResource("test-resource", "default", targetGVK)
+		_ = unstructured.SetNestedField(target.Object, "34.1.2.3", "status", "endpoint", "externalIP")
+
+		require.NoError(t, r.applyStatusMappings(context.Background(), testLogger(), target, rendered, store))
+		endpoint, _, _ := unstructured.NestedStringMap(target.Object, "status", "endpoint")
+		assert.Equal(t, map[string]string{"clusterIP": "10.0.0.1"}, endpoint)
+	})
+
+	t.Run("dependents that do not exist yet remove the field", func(t *testing.T) {
+		r := newReconciler(modelv1.IntegrationStatusMappingSpec{Kind: "Service", Name: "other", JSONPath: ".spec.clusterIP", Field: "address"})
+		target := newTestResource("test-resource", "default", targetGVK)
+		_ = unstructured.SetNestedField(target.Object, "stale", "status", "address")
+
+		require.NoError(t, r.applyStatusMappings(context.Background(), testLogger(), target, rendered, store))
+		_, found, _ := unstructured.NestedFieldNoCopy(target.Object, "status", "address")
+		assert.False(t, found)
+	})
+
+	t.Run("reserved fields are rejected", func(t *testing.T) {
+		for _, field := range []string{"conditions", "reconcileHistory.0", "patches", "stickyContext.recommendation"} {
+			r := newReconciler(modelv1.IntegrationStatusMappingSpec{Kind: "Service", JSONPath: ".spec.clusterIP", Field: field})
+			target := newTestResource("test-resource", "default", targetGVK)
+			assert.ErrorContains(t, r.applyStatusMappings(context.Background(), testLogger(), target, rendered, store), "reserved", field)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// patchStatus writes the status changes karo made between original and
+// desired to the target with a JSON merge patch. Only the fields karo changed
+// are sent, so fields written by other actors are kept. The patch is guarded
+// by the resourceVersion; on a conflict the target is read again and the
+// changes are applied to its latest status.
+func (r *GenericReconciler) patchStatus(ctx context.Context, original, desired *unstructured.Unstructured) error {
+	originalStatus, _, _ := unstructured.NestedMap(original.Object, "status")
+	desiredStatus, _, _ := unstructured.NestedMap(desired.Object, "status")
+	originalConditions, _ := originalStatus["conditions"].([]interface{})
+	desiredConditions, _ := desiredStatus["conditions"].([]interface{})
+	delete(originalStatus, "conditions")
+	delete(desiredStatus, "conditions")
+	changes := statusPatch(originalStatus, desiredStatus)
+	conditionChanges := changedConditions(originalConditions, desiredConditions)
+
+	live := original.DeepCopy()
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			live = &unstructured.Unstructured{}
+			live.SetGroupVersionKind(desired.GroupVersionKind())
+			if err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		patch := make(map[string]interface{}, len(changes)+1)
+		for field, value := range changes {
+			patch[field] = value
+		}
+		if len(conditionChanges) > 0 {
+			liveConditions, _, _ := unstructured.NestedSlice(live.Object, "status", "conditions")
+			patch["conditions"] = applyConditionChanges(liveConditions, conditionChanges, desiredConditions)
+		}
+		body := map[string]interface{}{"status": patch}
+		if resourceVersion := live.GetResourceVersion(); resourceVersion != "" {
+			body["metadata"] = map[string]interface{}{"resourceVersion": resourceVersion}
+		}
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		return r.Client.Status().Patch(ctx, live, client.RawPatch(types.MergePatchType, data))
+	})
+}
+
+// changedConditions returns the conditions that differ between original and
+// desired by type, with nil for the types that were removed.
+func changedConditions(original, desired []interface{}) map[string]interface{} {
+	previous := map[string]interface{}{}
+	for _, condition := range original {
+		previous[conditionTypeOf(condition)] = condition
+	}
+	changes := map[string]interface{}{}
+	for _, condition := range desired {
+		conditionType := conditionTypeOf(condition)
+		if !reflect.DeepEqual(previous[conditionType], condition) {
+			changes[conditionType] = condition
+		}
+		delete(previous, conditionType)
+	}
+	for conditionType := range previous {
+		changes[conditionType] = nil
+	}
+	return changes
+}
+
+// applyConditionChanges applies changes to the live conditions, keeping the
+// conditions of other writers and their order. New conditions are appended in
+// the order of desired.
+func applyConditionChanges(live []interface{}, changes map[string]interface{}, desired []interface{}) []interface{} {
+	conditions := []interface{}{}
+	applied := map[string]bool{}
+	for _, condition := range live {
+		conditionType := conditionTypeOf(condition)
+		change, changed := changes[conditionType]
+		if !changed {
+			conditions = append(conditions, condition)
+			continue
+		}
+		applied[conditionType] = true
+		if change != nil {
+			conditions = append(conditions, change)
+		}
+	}
+	for _, condition := range desired {
+		conditionType := conditionTypeOf(condition)
+		if change := changes[conditionType]; change != nil && !applied[conditionType] {
+			conditions = append(conditions, change)
+		}
+	}
+	return conditions
+}
+
+func conditionTypeOf(condition interface{}) string {
+	if fields, ok := condition.(map[string]interface{}); ok {
+		return getStringValue(fields, "type")
+	}
+	return ""
+}
+
+// statusPatch returns the JSON merge patch that turns original into desired:
+// changed fields are set, removed fields are set to null, and unchanged
+// fields are left out.
+func statusPatch(original, desired map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for field, value := range desired {
+		previous, found := original[field]
+		if found && reflect.DeepEqual(previous, value) {
+			continue
+		}
+		previousMap, previousIsMap := previous.(map[string]interface{})
+		valueMap, valueIsMap := value.(map[string]interface{})
+		if found && previousIsMap && valueIsMap {
+			patch[field] = statusPatch(previousMap, valueMap)
+			continue
+		}
+		patch[field] = value
+	}
+	for field := range original {
+		if _, found := desired[field]; !found {
+			patch[field] = nil
+		}
+	}
+	return patch
+}
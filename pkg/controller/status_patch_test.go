@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestStatusPatch(t *testing.T) {
+	original := map[string]interface{}{
+		"observedGeneration": int64(1),
+		"endpoint":           map[string]interface{}{"address": "10.0.0.1", "port": int64(80)},
+		"renderHash":         "abc",
+		"phase":              "Running",
+	}
+	desired := map[string]interface{}{
+		"observedGeneration": int64(2),
+		"endpoint":           map[string]interface{}{"address": "10.0.0.2", "port": int64(80)},
+		"phase":              "Running",
+		"estimatedCost":      "1.00",
+	}
+	assert.Equal(t, map[string]interface{}{
+		"observedGeneration": int64(2),
+		"endpoint":           map[string]interface{}{"address": "10.0.0.2"},
+		"renderHash":         nil,
+		"estimatedCost":      "1.00",
+	}, statusPatch(original, desired))
+	assert.Empty(t, statusPatch(desired, desired))
+}
+
+func TestApplyConditionChanges(t *testing.T) {
+	condition := func(conditionType, status string) interface{} {
+		return map[string]interface{}{"type": conditionType, "status": status}
+	}
+	original := []interface{}{condition("Ready", "False"), condition("Degraded", "True")}
+	desired := []interface{}{condition("Ready", "True"), condition("CloudResourcesReady", "True")}
+	changes := changedConditions(original, desired)
+	assert.Equal(t, map[string]interface{}{
+		"Ready":               condition("Ready", "True"),
+		"Degraded":            nil,
+		"CloudResourcesReady": condition("CloudResourcesReady", "True"),
+	}, changes)
+
+	// Another writer added its own condition since karo read the target.
+	live := []interface{}{condition("Ready", "False"), condition("Degraded", "True"), condition("Scheduled", "True")}
+	assert.Equal(t, []interface{}{
+		condition("Ready", "True"),
+		condition("Scheduled", "True"),
+		condition("CloudResourcesReady", "True"),
+	}, applyConditionChanges(live, changes, desired))
+}
+
+// newStatusTarget returns a target whose status karo read before another
+// writer changed it in the returned client.
+func newStatusTarget(t *testing.T, funcs interceptor.Funcs) (*unstructured.Unstructured, client.Client) {
+	target := newTestResource("llama", "team-a", eventTestGVK)
+	require.NoError(t, unstructured.SetNestedMap(target.Object, map[string]interface{}{
+		"observedGeneration": int64(1),
+		"renderHash":         "abc",
+	}, "status"))
+	c := fake.NewClientBuilder().WithObjects(target).WithStatusSubresource(target).WithInterceptorFuncs(funcs).Build()
+
+	read := &unstructured.Unstructured{}
+	read.SetGroupVersionKind(eventTestGVK)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(target), read))
+
+	other := read.DeepCopy()
+	require.NoError(t, unstructured.SetNestedField(other.Object, "Scheduled", "status", "phase"))
+	require.NoError(t, unstructured.SetNestedSlice(other.Object, []interface{}{
+		map[string]interface{}{"type": "Scheduled", "status": "True"},
+	}, "status", "conditions"))
+	require.NoError(t, c.Status().Update(context.Background(), other))
+	return read, c
+}
+
+func getStatusTarget(t *testing.T, c client.Client) map[string]interface{} {
+	t.Helper()
+	target := &unstructured.Unstructured{}
+	target.SetGroupVersionKind(eventTestGVK)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "team-a", Name: "llama"}, target))
+	status, _, _ := unstructured.NestedMap(target.Object, "status")
+	return status
+}
+
+func TestUpdateStatusConcurrentWriter(t *testing.T) {
+	patches := 0
+	read, c := newStatusTarget(t, interceptor.Funcs{
+		// The fake client ignores the resourceVersion of patches, so the
+		// precondition is checked here like the API server does.
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			patches++
+			data, err := patch.Data(obj)
+			if err != nil {
+				return err
+			}
+			var body struct {
+				Metadata struct {
+					ResourceVersion string `json:"resourceVersion"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(data, &body); err != nil {
+				return err
+			}
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(eventTestGVK)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+				return err
+			}
+			if body.Metadata.ResourceVersion != live.GetResourceVersion() {
+				return errors.NewConflict(schema.GroupResource{Group: eventTestGVK.Group, Resource: "testresources"}, obj.GetName(), nil)
+			}
+			return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	})
+	r := &GenericReconciler{Client: c}
+
+	target := read.DeepCopy()
+	target.SetGeneration(2)
+	unstructured.RemoveNestedField(target.Object, "status", "renderHash")
+	require.NoError(t, r.updateStatus(context.Background(), logr.Discard(), read, target, nil, false, nil))
+	assert.Equal(t, 2, patches, "the first patch conflicts with the other writer and is retried")
+
+	status := getStatusTarget(t, c)
+	assert.Equal(t, "Scheduled", status["phase"], "fields of other writers are kept")
+	assert.Equal(t, int64(2), status["observedGeneration"])
+	assert.NotContains(t, status, "renderHash", "fields removed by karo are removed")
+	conditions := status["conditions"].([]interface{})
+	require.Len(t, conditions, 2)
+	assert.Equal(t, "Scheduled", conditions[0].(map[string]interface{})["type"], "conditions of other writers are kept")
+	assert.Equal(t, ReadyConditionType, conditions[1].(map[string]interface{})["type"])
+	assert.Equal(t, "True", conditions[1].(map[string]interface{})["status"])
+}
+
+func TestUpdateStatusConflicts(t *testing.T) {
+	patches := 0
+	read, c := newStatusTarget(t, interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			patches++
+			return errors.NewConflict(schema.GroupResource{Group: eventTestGVK.Group, Resource: "testresources"}, obj.GetName(), nil)
+		},
+	})
+	r := &GenericReconciler{Client: c}
+
+	err := r.updateStatus(context.Background(), logr.Discard(), read, read.DeepCopy(), nil, false, nil)
+	require.Error(t, err)
+	assert.True(t, errors.IsConflict(err))
+	assert.Equal(t, 5, patches, "the patch is retried with backoff before the reconcile fails")
+}
+
+func TestUpdateStatusTargetDeleted(t *testing.T) {
+	read, c := newStatusTarget(t, interceptor.Funcs{})
+	require.NoError(t, c.Delete(context.Background(), read))
+	r := &GenericReconciler{Client: c}
+
+	assert.NoError(t, r.updateStatus(context.Background(), logr.Discard(), read, read.DeepCopy(), nil, false, nil))
+}
@@ -0,0 +1,389 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// The paths of the status server.
+	StatusIntegrationsPath = "/integrations"
+	StatusResourcesPath    = "/resources"
+	StatusErrorsPath       = "/errors"
+	StatusInventoryPath    = "/inventory"
+
+	statusServerShutdownTimeout = 5 * time.Second
+	// statusReadTimeout bounds a read of the view, e.g. while the informer of
+	// a kind that cannot be listed never syncs.
+	statusReadTimeout = 10 * time.Second
+)
+
+// IntegrationView is the status server's view of an Integration.
+type IntegrationView struct {
+	Name  string   `json:"name"`
+	Ready bool     `json:"ready"`
+	Kinds []string `json:"kinds"`
+	// MissingPermissions is the number of permissions that the operator
+	// lacks for the integrations, see --check-permissions.
+	MissingPermissions int `json:"missingPermissions,omitempty"`
+}
+
+// ConditionView is a condition in the status server's view of a resource.
+type ConditionView struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// DependentView is a dependent in the status server's view of a resource.
+type DependentView struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Status    string `json:"status,omitempty"`
+}
+
+// ResourceView is the status server's view of a custom resource of an
+// integrated kind, read from its status.
+type ResourceView struct {
+	APIVersion         string          `json:"apiVersion"`
+	Kind               string          `json:"kind"`
+	Namespace          string          `json:"namespace,omitempty"`
+	Name               string          `json:"name"`
+	Generation         int64           `json:"generation"`
+	ObservedGeneration int64           `json:"observedGeneration,omitempty"`
+	Ready              *ConditionView  `json:"ready,omitempty"`
+	Dependents         []DependentView `json:"dependents,omitempty"`
+	// LastError is the message of the Ready condition while it is false.
+	LastError string `json:"lastError,omitempty"`
+	// LastReconcile is the time of the newest entry of the reconcile history.
+	LastReconcile string `json:"lastReconcile,omitempty"`
+}
+
+// InventoryView is the status server's inventory of what an Integration
+// manages, so that dashboards need not list every integrated kind and join
+// the dependents by owner references.
+type InventoryView struct {
+	Integration string                  `json:"integration"`
+	Resources   []InventoryResourceView `json:"resources"`
+	// Dependents counts the dependents of the resources by kind and by the
+	// outcome of their last apply: Processed, Error or DryRun.
+	Dependents map[string]map[string]int `json:"dependents"`
+}
+
+// InventoryResourceView is a resource in the inventory of an Integration.
+type InventoryResourceView struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Ready is the status of the Ready condition, if the resource has one.
+	Ready      string `json:"ready,omitempty"`
+	Dependents int    `json:"dependents"`
+}
+
+// StatusServer serves a read-only JSON view of the operator on its own
+// address: the Integrations, the resources of their kinds with their
+// dependents, the resources whose last reconcile failed, and an inventory per
+// Integration. It reads the
+// informer caches, which every replica runs, so followers answer like the
+// leader, dashboards do not blip during a failover and requests do not reach
+// the API server. It serves no secrets, only what the status of the resources
+// holds, and has no authentication, so it should only be reachable inside the
+// cluster.
+type StatusServer struct {
+	// Addr is the address to listen on, e.g. ":8082".
+	Addr string
+	// Client reads the view. It must be the cache of the manager, not its
+	// client, which reads unstructured objects from the API server.
+	Client client.Reader
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica serves the status.
+func (s *StatusServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the status until ctx is done.
+func (s *StatusServer) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("status-server")
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", s.Addr, err)
+	}
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), statusServerShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error(err, "Failed to shut down the status server")
+		}
+	}()
+	logger.Info("Serving status", "address", listener.Addr().String())
+	if err := server.Serve(listener); err != nil && !stderrors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// Handler returns the handler of the status paths.
+func (s *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatusIntegrationsPath, s.serve(func(req *http.Request) (interface{}, error) {
+		return s.Integrations(req.Context())
+	}))
+	mux.HandleFunc(StatusResourcesPath, s.serve(func(req *http.Request) (interface{}, error) {
+		query := req.URL.Query()
+		return s.Resources(req.Context(), query.Get("kind"), query.Get("namespace"), false)
+	}))
+	mux.HandleFunc(StatusErrorsPath, s.serve(func(req *http.Request) (interface{}, error) {
+		query := req.URL.Query()
+		return s.Resources(req.Context(), query.Get("kind"), query.Get("namespace"), true)
+	}))
+	mux.HandleFunc(StatusInventoryPath, s.serve(func(req *http.Request) (interface{}, error) {
+		query := req.URL.Query()
+		return s.Inventory(req.Context(), query.Get("integration"), query.Get("namespace"))
+	}))
+	return mux
+}
+
+// serve adapts a read of the view to an HTTP handler that answers GET
+// requests with it as JSON.
+func (s *StatusServer) serve(read func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), statusReadTimeout)
+		defer cancel()
+		view, err := read(req.WithContext(ctx))
+		if err != nil {
+			log.FromContext(req.Context()).WithName("status-server").Error(err, "Failed to read status", "path", req.URL.Path)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(view)
+	}
+}
+
+// Integrations returns the Integrations, sorted by name.
+func (s *StatusServer) Integrations(ctx context.Context) ([]IntegrationView, error) {
+	list := &modelv1.IntegrationList{}
+	if err := s.Client.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("unable to list Integrations: %w", err)
+	}
+	views := make([]IntegrationView, 0, len(list.Items))
+	for _, integration := range list.Items {
+		view := IntegrationView{
+			Name:               integration.Name,
+			Ready:              integration.Status.Ready,
+			Kinds:              []string{},
+			MissingPermissions: len(integration.Status.MissingPermissions),
+		}
+		for _, spec := range integration.Spec {
+			view.Kinds = append(view.Kinds, schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}.String())
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views, nil
+}
+
+// Resources returns the resources of the integrated kinds, sorted by kind,
+// namespace and name. A non-empty kind or namespace selects the resources of
+// that kind or in that namespace, and failed only the resources with a
+// LastError. Kinds whose resources cannot be listed, e.g. because their CRD
+// is not installed, are skipped.
+func (s *StatusServer) Resources(ctx context.Context, kind, namespace string, failed bool) ([]ResourceView, error) {
+	integrations := &modelv1.IntegrationList{}
+	if err := s.Client.List(ctx, integrations); err != nil {
+		return nil, fmt.Errorf("unable to list Integrations: %w", err)
+	}
+	seen := map[schema.GroupVersionKind]bool{}
+	views := []ResourceView{}
+	for _, integration := range integrations.Items {
+		for _, spec := range integration.Spec {
+			gvk := schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}
+			if seen[gvk] || (kind != "" && kind != gvk.Kind) {
+				continue
+			}
+			seen[gvk] = true
+			list := s.listKind(ctx, gvk, namespace)
+			for i := range list {
+				view := resourceView(&list[i])
+				if failed && view.LastError == "" {
+					continue
+				}
+				views = append(views, view)
+			}
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Kind != views[j].Kind {
+			return views[i].Kind < views[j].Kind
+		}
+		if views[i].Namespace != views[j].Namespace {
+			return views[i].Namespace < views[j].Namespace
+		}
+		return views[i].Name < views[j].Name
+	})
+	return views, nil
+}
+
+// Inventory returns the inventory of every Integration, sorted by name, or
+// only of the Integration named integration if it is not empty. A non-empty
+// namespace selects the resources in that namespace.
+func (s *StatusServer) Inventory(ctx context.Context, integration, namespace string) ([]InventoryView, error) {
+	integrations := &modelv1.IntegrationList{}
+	if err := s.Client.List(ctx, integrations); err != nil {
+		return nil, fmt.Errorf("unable to list Integrations: %w", err)
+	}
+	views := []InventoryView{}
+	for _, item := range integrations.Items {
+		if integration != "" && integration != item.Name {
+			continue
+		}
+		view := InventoryView{Integration: item.Name, Resources: []InventoryResourceView{}, Dependents: map[string]map[string]int{}}
+		for _, spec := range item.Spec {
+			gvk := schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}
+			list := s.listKind(ctx, gvk, namespace)
+			for i := range list {
+				resource := resourceView(&list[i])
+				// The status of resources with many dependents holds only
+				// some of them.
+				if dependents, err := recordedDependents(ctx, s.Client, &list[i]); err == nil {
+					resource.Dependents = dependentViews(dependents)
+				}
+				inventoryResource := InventoryResourceView{
+					APIVersion: resource.APIVersion,
+					Kind:       resource.Kind,
+					Namespace:  resource.Namespace,
+					Name:       resource.Name,
+					Dependents: len(resource.Dependents),
+				}
+				if resource.Ready != nil {
+					inventoryResource.Ready = resource.Ready.Status
+				}
+				view.Resources = append(view.Resources, inventoryResource)
+				for _, dependent := range resource.Dependents {
+					if view.Dependents[dependent.Kind] == nil {
+						view.Dependents[dependent.Kind] = map[string]int{}
+					}
+					view.Dependents[dependent.Kind][dependentOutcome(dependent.Status)]++
+				}
+			}
+		}
+		sort.Slice(view.Resources, func(i, j int) bool {
+			a, b := view.Resources[i], view.Resources[j]
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		})
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Integration < views[j].Integration })
+	return views, nil
+}
+
+// listKind lists the resources of an integrated kind, in namespace if it is
+// not empty. Kinds whose resources cannot be listed, e.g. because their CRD is
+// not installed, have none.
+func (s *StatusServer) listKind(ctx context.Context, gvk schema.GroupVersionKind, namespace string) []unstructured.Unstructured {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	var opts []client.ListOption
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	if err := s.Client.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).WithName("status-server").V(1).Info("Skipping kind that cannot be listed", "gvk", gvk.String(), "error", err.Error())
+		return nil
+	}
+	return list.Items
+}
+
+// dependentViews returns the views of recorded dependents.
+func dependentViews(dependents []map[string]interface{}) []DependentView {
+	var views []DependentView
+	for _, dependent := range dependents {
+		views = append(views, DependentView{
+			Kind:      getStringValue(dependent, "kind"),
+			Namespace: getStringValue(dependent, "namespace"),
+			Name:      getStringValue(dependent, "name"),
+			Status:    getStringValue(dependent, "status"),
+		})
+	}
+	return views
+}
+
+// dependentOutcome groups the status of a dependent in the status of its
+// target, dropping the message of errors.
+func dependentOutcome(status string) string {
+	switch {
+	case status == "":
+		return "Unknown"
+	case strings.HasPrefix(status, "Error"):
+		return "Error"
+	}
+	return status
+}
+
+// resourceView reads the view of a resource from its status.
+func resourceView(obj *unstructured.Unstructured) ResourceView {
+	view := ResourceView{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Generation: obj.GetGeneration(),
+	}
+	view.ObservedGeneration, _, _ = unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if status, reason, message := dependentCondition(obj, "Ready"); status != "" {
+		view.Ready = &ConditionView{Status: status, Reason: reason, Message: message}
+		if status == "False" {
+			view.LastError = message
+			if view.LastError == "" {
+				view.LastError = reason
+			}
+		}
+	}
+	dependents, _, _ := unstructured.NestedSlice(obj.Object, "status", "dependentResources")
+	view.Dependents = dependentViews(dependentMaps(dependents))
+	history, _, _ := unstructured.NestedSlice(obj.Object, "status", "reconcileHistory")
+	if len(history) > 0 {
+		if last, ok := history[0].(map[string]interface{}); ok {
+			view.LastReconcile = getStringValue(last, "time")
+		}
+	}
+	return view
+}
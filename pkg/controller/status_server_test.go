@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newTestStatusServer(t *testing.T) *StatusServer {
+	scheme := runtime.NewScheme()
+	require.NoError(t, modelv1.AddToScheme(scheme))
+	scheme.AddKnownTypeWithName(eventTestGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(eventTestGVK.GroupVersion().WithKind(eventTestGVK.Kind+"List"), &unstructured.UnstructuredList{})
+
+	ready := newTestResource("llama", "team-a", eventTestGVK)
+	_ = unstructured.SetNestedSlice(ready.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": "True", "reason": "ReconciliationSucceeded"},
+	}, "status", "conditions")
+	_ = unstructured.SetNestedSlice(ready.Object, []interface{}{
+		map[string]interface{}{"kind": "Deployment", "namespace": "team-a", "name": "llama", "status": "Updated"},
+		map[string]interface{}{"kind": "Service", "namespace": "team-a", "name": "llama", "status": "Error: services \"llama\" is forbidden"},
+	}, "status", "dependentResources")
+	_ = unstructured.SetNestedSlice(ready.Object, []interface{}{
+		map[string]interface{}{"time": "2026-10-16T10:00:00Z", "outcome": "Succeeded"},
+	}, "status", "reconcileHistory")
+	failed := newTestResource("gemma", "team-b", eventTestGVK)
+	_ = unstructured.SetNestedSlice(failed.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": "False", "reason": "TemplateError", "message": "failed to execute template deployment.yaml"},
+	}, "status", "conditions")
+
+	integration := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "skippy-integrations"},
+		Spec: []modelv1.IntegrationSpec{
+			{Group: eventTestGVK.Group, Version: eventTestGVK.Version, Kind: eventTestGVK.Kind},
+			// Kinds without a CRD are skipped.
+			{Group: "missing.karo.pkg.com", Version: "v1", Kind: "Missing"},
+		},
+		Status: modelv1.IntegrationStatus{Ready: true},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(integration, ready, failed).Build()
+	return &StatusServer{Client: c}
+}
+
+func TestStatusServerResources(t *testing.T) {
+	s := newTestStatusServer(t)
+
+	integrations, err := s.Integrations(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []IntegrationView{{
+		Name:  "skippy-integrations",
+		Ready: true,
+		Kinds: []string{"testing.karo.pkg.com/v1, Kind=TestResource", "missing.karo.pkg.com/v1, Kind=Missing"},
+	}}, integrations)
+
+	resources, err := s.Resources(context.Background(), "", "", false)
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	assert.Equal(t, "llama", resources[0].Name)
+	assert.Equal(t, &ConditionView{Status: "True", Reason: "ReconciliationSucceeded"}, resources[0].Ready)
+	assert.Equal(t, []DependentView{
+		{Kind: "Deployment", Namespace: "team-a", Name: "llama", Status: "Updated"},
+		{Kind: "Service", Namespace: "team-a", Name: "llama", Status: `Error: services "llama" is forbidden`},
+	}, resources[0].Dependents)
+	assert.Equal(t, "2026-10-16T10:00:00Z", resources[0].LastReconcile)
+	assert.Empty(t, resources[0].LastError)
+	assert.Equal(t, "gemma", resources[1].Name)
+	assert.Equal(t, "failed to execute template deployment.yaml", resources[1].LastError)
+
+	resources, err = s.Resources(context.Background(), "", "team-a", false)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	assert.Equal(t, "llama", resources[0].Name)
+
+	resources, err = s.Resources(context.Background(), "Other", "", false)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+
+	resources, err = s.Resources(context.Background(), "", "", true)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	assert.Equal(t, "gemma", resources[0].Name)
+}
+
+func TestStatusServerInventory(t *testing.T) {
+	s := newTestStatusServer(t)
+
+	inventory, err := s.Inventory(context.Background(), "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []InventoryView{{
+		Integration: "skippy-integrations",
+		Resources: []InventoryResourceView{
+			{APIVersion: "testing.karo.pkg.com/v1", Kind: "TestResource", Namespace: "team-a", Name: "llama", Ready: "True", Dependents: 2},
+			{APIVersion: "testing.karo.pkg.com/v1", Kind: "TestResource", Namespace: "team-b", Name: "gemma", Ready: "False"},
+		},
+		Dependents: map[string]map[string]int{
+			"Deployment": {"Updated": 1},
+			"Service":    {"Error": 1},
+		},
+	}}, inventory)
+
+	inventory, err = s.Inventory(context.Background(), "skippy-integrations", "team-b")
+	require.NoError(t, err)
+	require.Len(t, inventory, 1)
+	require.Len(t, inventory[0].Resources, 1)
+	assert.Equal(t, "gemma", inventory[0].Resources[0].Name)
+	assert.Empty(t, inventory[0].Dependents)
+
+	inventory, err = s.Inventory(context.Background(), "other", "")
+	require.NoError(t, err)
+	assert.Empty(t, inventory)
+}
+
+func TestStatusServerHandler(t *testing.T) {
+	handler := newTestStatusServer(t).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, StatusErrorsPath+"?namespace=team-b", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var resources []ResourceView
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resources))
+	require.Len(t, resources, 1)
+	assert.Equal(t, "TemplateError", resources[0].Ready.Reason)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, StatusResourcesPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestStatusServerStart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	s := newTestStatusServer(t)
+	s.Addr = addr
+	assert.False(t, s.NeedLeaderElection())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + StatusIntegrationsPath)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the status server did not stop")
+	}
+}
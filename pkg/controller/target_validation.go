@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+const (
+	// TargetValidationPath is where the webhook server validates the custom
+	// resources of the integrated kinds.
+	TargetValidationPath = "/validate-karo-targets"
+	// DefaultTargetWebhookName is the ValidatingWebhookConfiguration whose
+	// rules TargetWebhookSync keeps in line with the integrated kinds.
+	DefaultTargetWebhookName = "karo-target-validating-webhook-configuration"
+	// DefaultTargetWebhookSyncInterval is how often the rules are synced.
+	DefaultTargetWebhookSyncInterval = time.Minute
+)
+
+// TargetValidator validates the custom resources of the integrated kinds at
+// admission with the checks that otherwise set their SpecInvalid condition:
+// the required fields of the integration, the accelerator capability matrix
+// and the allowed images of the pod security policy. Users get the error
+// from kubectl instead of a condition after the fact.
+//
+// Integrations are read from the manager cache rather than the registry, as
+// every replica serves the webhook but only the leader runs the controllers.
+type TargetValidator struct {
+	Client client.Reader
+	// SecurityPolicy is the cluster-wide pod security policy, which the
+	// policy of each integration adds to.
+	SecurityPolicy *modelv1.IntegrationSecurityPolicySpec
+}
+
+var _ admission.Handler = &TargetValidator{}
+
+// Handle validates a created or updated custom resource.
+func (v *TargetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(req.Object.Raw, &obj.Object); err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to decode %s: %w", req.Kind.Kind, err))
+	}
+	gvk := obj.GroupVersionKind()
+	spec, found, err := v.integration(ctx, gvk)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !found {
+		return admission.Allowed("no integration of " + gvk.String())
+	}
+	if req.Operation == admissionv1.Update {
+		// Updates that leave the spec as it is, e.g. of the metadata or by
+		// the operator itself, are not held up by a spec that was valid
+		// before the integration changed.
+		old := &unstructured.Unstructured{}
+		if err := json.Unmarshal(req.OldObject.Raw, &old.Object); err == nil && equality.Semantic.DeepEqual(old.Object["spec"], obj.Object["spec"]) {
+			return admission.Allowed("")
+		}
+	}
+	if err := validateTarget(obj, spec, v.SecurityPolicy); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// integration returns the spec of the Integration of gvk.
+func (v *TargetValidator) integration(ctx context.Context, gvk schema.GroupVersionKind) (modelv1.IntegrationSpec, bool, error) {
+	integrations := &modelv1.IntegrationList{}
+	if err := v.Client.List(ctx, integrations); err != nil {
+		return modelv1.IntegrationSpec{}, false, fmt.Errorf("unable to list Integrations: %w", err)
+	}
+	for _, integration := range integrations.Items {
+		for _, spec := range integration.Spec {
+			if spec.Group == gvk.Group && spec.Version == gvk.Version && spec.Kind == gvk.Kind {
+				return spec, true, nil
+			}
+		}
+	}
+	return modelv1.IntegrationSpec{}, false, nil
+}
+
+// validateTarget returns the first SpecInvalid error of obj under the
+// integration spec.
+func validateTarget(obj *unstructured.Unstructured, spec modelv1.IntegrationSpec, clusterPolicy *modelv1.IntegrationSecurityPolicySpec) error {
+	if missing := missingRequiredFields(obj, spec.RequiredFields); len(missing) > 0 {
+		return &SpecInvalidError{Missing: missing}
+	}
+	if err := checkAcceleratorCapacity(obj); err != nil {
+		return err
+	}
+	if _, err := transformer.MergeSecurityPolicies(clusterPolicy, spec.SecurityPolicy); err != nil {
+		return fmt.Errorf("invalid security policy of %s: %w", spec.Kind, err)
+	}
+	return transformer.CheckSpecImages(obj, clusterPolicy, spec.SecurityPolicy)
+}
+
+// TargetWebhookSync points the rules of the target validating webhook, which
+// is installed without any, at the resources of the integrated kinds, as
+// Integrations are added and removed.
+type TargetWebhookSync struct {
+	Client client.Client
+	Mapper meta.RESTMapper
+	// Name overrides DefaultTargetWebhookName.
+	Name string
+	// Interval overrides DefaultTargetWebhookSyncInterval.
+	Interval time.Duration
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that one
+// replica writes the rules.
+func (s *TargetWebhookSync) NeedLeaderElection() bool {
+	return true
+}
+
+// Start syncs the rules until ctx is done.
+func (s *TargetWebhookSync) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("target-webhook")
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultTargetWebhookSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil {
+			logger.Error(err, "Failed to sync the rules of the target validating webhook")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync sets the rules of every webhook of the configuration to the
+// resources of the integrated kinds, if they changed. Kinds that the cluster
+// does not serve yet are left out until it does.
+func (s *TargetWebhookSync) Sync(ctx context.Context) error {
+	integrations := &modelv1.IntegrationList{}
+	if err := s.Client.List(ctx, integrations); err != nil {
+		return fmt.Errorf("unable to list Integrations: %w", err)
+	}
+	resources := map[schema.GroupVersion][]string{}
+	for _, integration := range integrations.Items {
+		for _, spec := range integration.Spec {
+			mapping, err := s.Mapper.RESTMapping(schema.GroupKind{Group: spec.Group, Kind: spec.Kind}, spec.Version)
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to find the resource of %s: %w", spec.Kind, err)
+			}
+			gv := mapping.Resource.GroupVersion()
+			resources[gv] = append(resources[gv], mapping.Resource.Resource)
+		}
+	}
+	rules := targetWebhookRules(resources)
+
+	name := s.Name
+	if name == "" {
+		name = DefaultTargetWebhookName
+	}
+	configuration := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: name}, configuration); err != nil {
+		return fmt.Errorf("unable to get ValidatingWebhookConfiguration %s: %w", name, err)
+	}
+	changed := false
+	for i := range configuration.Webhooks {
+		if !equality.Semantic.DeepEqual(configuration.Webhooks[i].Rules, rules) {
+			configuration.Webhooks[i].Rules = rules
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := s.Client.Update(ctx, configuration); err != nil {
+		return fmt.Errorf("unable to update ValidatingWebhookConfiguration %s: %w", name, err)
+	}
+	log.FromContext(ctx).Info("Updated the rules of the target validating webhook", "name", name, "rules", len(rules))
+	return nil
+}
+
+// targetWebhookRules returns a rule for the creates and updates of the
+// resources of each group version, sorted.
+func targetWebhookRules(resources map[schema.GroupVersion][]string) []admissionregistrationv1.RuleWithOperations {
+	gvs := make([]schema.GroupVersion, 0, len(resources))
+	for gv := range resources {
+		gvs = append(gvs, gv)
+	}
+	sort.Slice(gvs, func(i, j int) bool { return gvs[i].String() < gvs[j].String() })
+
+	rules := []admissionregistrationv1.RuleWithOperations{}
+	scope := admissionregistrationv1.AllScopes
+	for _, gv := range gvs {
+		names := append([]string(nil), resources[gv]...)
+		sort.Strings(names)
+		names = slices.Compact(names)
+		rules = append(rules, admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{gv.Group},
+				APIVersions: []string{gv.Version},
+				Resources:   names,
+				Scope:       &scope,
+			},
+		})
+	}
+	return rules
+}
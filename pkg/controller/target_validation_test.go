@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newTargetValidationClient(t *testing.T, objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	require.NoError(t, modelv1.AddToScheme(s))
+	require.NoError(t, admissionregistrationv1.AddToScheme(s))
+	integration := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "serving"},
+		Spec: []modelv1.IntegrationSpec{{
+			Group: eventTestGVK.Group, Version: eventTestGVK.Version, Kind: eventTestGVK.Kind,
+			RequiredFields: []string{"spec.model.modelName"},
+			SecurityPolicy: &modelv1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^vllm/`}},
+		}},
+	}
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(append(objs, integration)...).Build()
+}
+
+func newTargetAdmissionRequest(t *testing.T, operation admissionv1.Operation, obj, old *unstructured.Unstructured) admission.Request {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: operation}}
+	raw, err := json.Marshal(obj.Object)
+	require.NoError(t, err)
+	req.Object.Raw = raw
+	if old != nil {
+		raw, err = json.Marshal(old.Object)
+		require.NoError(t, err)
+		req.OldObject.Raw = raw
+	}
+	return req
+}
+
+func TestTargetValidator(t *testing.T) {
+	ctx := context.Background()
+	validator := &TargetValidator{Client: newTargetValidationClient(t)}
+	handle := func(operation admissionv1.Operation, obj, old *unstructured.Unstructured) admission.Response {
+		return validator.Handle(ctx, newTargetAdmissionRequest(t, operation, obj, old))
+	}
+
+	valid := newTestCapacityTarget("nvidia-h100-80gb", "Llama-3.1-8B-Instruct", map[string]interface{}{"gpuCount": int64(1)})
+	unstructured.SetNestedField(valid.Object, "vllm/vllm-openai:v0.6.0", "spec", "inferenceServer", "image")
+	assert.True(t, handle(admissionv1.Create, valid, nil).Allowed)
+
+	missing := valid.DeepCopy()
+	unstructured.RemoveNestedField(missing.Object, "spec", "model", "modelName")
+	response := handle(admissionv1.Create, missing, nil)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "missing required field(s): spec.model.modelName", response.Result.Message)
+
+	tooSmall := newTestCapacityTarget("nvidia-l4", "Llama-3.1-70B-Instruct", map[string]interface{}{"gpuCount": int64(1)})
+	response = handle(admissionv1.Create, tooSmall, nil)
+	assert.False(t, response.Allowed)
+	assert.Contains(t, response.Result.Message, "Llama-3.1-70B-Instruct does not fit on 1x nvidia-l4")
+
+	untrusted := valid.DeepCopy()
+	unstructured.SetNestedField(untrusted.Object, "docker.io/attacker/miner:latest", "spec", "inferenceServer", "image")
+	response = handle(admissionv1.Update, untrusted, valid)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, `image "docker.io/attacker/miner:latest" in spec.inferenceServer.image of TestResource llama matches none of the allowed images`, response.Result.Message)
+
+	// Updates that leave the spec as it is are admitted, as are kinds
+	// without an integration.
+	relabeled := untrusted.DeepCopy()
+	relabeled.SetLabels(map[string]string{"team": "a"})
+	assert.True(t, handle(admissionv1.Update, relabeled, untrusted).Allowed)
+	other := untrusted.DeepCopy()
+	other.SetKind("Agent")
+	assert.True(t, handle(admissionv1.Create, other, nil).Allowed)
+}
+
+func TestTargetWebhookSync(t *testing.T) {
+	ctx := context.Background()
+	configuration := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultTargetWebhookName},
+		Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "vtargets.model.skippy.io"}},
+	}
+	c := newTargetValidationClient(t, configuration)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(eventTestGVK, meta.RESTScopeNamespace)
+	sync := &TargetWebhookSync{Client: c, Mapper: mapper}
+
+	require.NoError(t, sync.Sync(ctx))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(configuration), configuration))
+	require.Len(t, configuration.Webhooks[0].Rules, 1)
+	rule := configuration.Webhooks[0].Rules[0]
+	assert.Equal(t, []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}, rule.Operations)
+	assert.Equal(t, []string{eventTestGVK.Group}, rule.APIGroups)
+	assert.Equal(t, []string{eventTestGVK.Version}, rule.APIVersions)
+	assert.Equal(t, []string{"testresources"}, rule.Resources)
+
+	// Unchanged rules are not written again.
+	version := configuration.ResourceVersion
+	require.NoError(t, sync.Sync(ctx))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(configuration), configuration))
+	assert.Equal(t, version, configuration.ResourceVersion)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// templateBundleInfo has a series for every template bundle that the verified
+// integrations render from, whose hash label identifies the content of the
+// bundle. Dashboards can compare the hashes across clusters, and alerts can
+// find clusters that still render an old bundle after a rollout.
+var templateBundleInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "karo_template_bundle_info",
+	Help: "Template bundles of the verified integrations, with the source (embedded, gcs or oci) and sha256 hash of their files. The value is always 1.",
+}, []string{"namespace", "integration", "kind", "path", "source", "hash"})
+
+func init() {
+	metrics.Registry.MustRegister(templateBundleInfo)
+}
+
+// recordTemplateBundles replaces the series of the template bundles of an
+// Integration with those of specs. Bundles that cannot be read are logged
+// and left out.
+func (r *IntegrationReconciler) recordTemplateBundles(ctx context.Context, integration *modelv1.Integration, specs []modelv1.IntegrationSpec, log logr.Logger) {
+	forgetTemplateBundles(client.ObjectKeyFromObject(integration))
+	for _, spec := range specs {
+		hashes, err := r.Transformer.TemplateHashes(ctx, r.Client, spec)
+		if err != nil {
+			log.Error(err, "Failed to hash the template bundles", "kind", spec.Kind, "group", spec.Group)
+			continue
+		}
+		kind := spec.Kind
+		if spec.Group != "" {
+			kind += "." + spec.Group
+		}
+		for path, hash := range hashes {
+			templateBundleInfo.WithLabelValues(integration.Namespace, integration.Name, kind, path, templateSource(path), hash).Set(1)
+		}
+	}
+}
+
+// forgetTemplateBundles removes the series of the template bundles of an
+// Integration.
+func forgetTemplateBundles(name types.NamespacedName) {
+	templateBundleInfo.DeletePartialMatch(prometheus.Labels{"namespace": name.Namespace, "integration": name.Name})
+}
+
+// templateSource returns the scheme of a template path, e.g. "gcs" for
+// gcs:/bucket/path.
+func templateSource(path string) string {
+	if scheme, _, found := strings.Cut(path, ":"); found && scheme != "" {
+		return strings.ToLower(scheme)
+	}
+	return "unknown"
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestRecordTemplateBundles(t *testing.T) {
+	hashes := map[string]map[string]string{
+		"Agent": {"embedded:/v1/agent/template": "aaa", "gcs:/skippy/agent/overlays": "bbb"},
+		"Model": {"gcs:/models/vllm": "ccc"},
+	}
+	r := &IntegrationReconciler{Transformer: &MockTransformer{
+		TemplateHashesFunc: func(_ context.Context, _ client.Client, spec modelv1.IntegrationSpec) (map[string]string, error) {
+			if spec.Kind == "Broken" {
+				return nil, errors.New("bucket not found")
+			}
+			return hashes[spec.Kind], nil
+		},
+	}}
+	integration := &modelv1.Integration{ObjectMeta: metav1.ObjectMeta{Name: "skippy-integrations", Namespace: "karo-system"}}
+	specs := []modelv1.IntegrationSpec{
+		{Group: "model.skippy.io", Version: "v1", Kind: "Agent"},
+		{Group: "model.skippy.io", Version: "v1", Kind: "Broken"},
+		{Group: "model.skippy.io", Version: "v1", Kind: "Model"},
+	}
+	series := func() int { return testutil.CollectAndCount(templateBundleInfo) }
+	before := series()
+
+	r.recordTemplateBundles(context.Background(), integration, specs, logr.Discard())
+	assert.Equal(t, before+3, series())
+	assert.Equal(t, 1.0, testutil.ToFloat64(templateBundleInfo.WithLabelValues("karo-system", "skippy-integrations", "Agent.model.skippy.io", "embedded:/v1/agent/template", "embedded", "aaa")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(templateBundleInfo.WithLabelValues("karo-system", "skippy-integrations", "Model.model.skippy.io", "gcs:/models/vllm", "gcs", "ccc")))
+
+	// A new bundle version replaces the series of the old one.
+	hashes["Model"]["gcs:/models/vllm"] = "ddd"
+	r.recordTemplateBundles(context.Background(), integration, specs, logr.Discard())
+	assert.Equal(t, before+3, series())
+	assert.Equal(t, 1.0, testutil.ToFloat64(templateBundleInfo.WithLabelValues("karo-system", "skippy-integrations", "Model.model.skippy.io", "gcs:/models/vllm", "gcs", "ddd")))
+
+	forgetTemplateBundles(types.NamespacedName{Namespace: "karo-system", Name: "skippy-integrations"})
+	assert.Equal(t, before, series())
+}
+
+func TestTemplateSource(t *testing.T) {
+	assert.Equal(t, "embedded", templateSource("embedded:/v1/agent"))
+	assert.Equal(t, "gcs", templateSource("gcs:/bucket/path"))
+	assert.Equal(t, "oci", templateSource("oci://registry/bundle:1.0"))
+	assert.Equal(t, "unknown", templateSource("/tmp/templates"))
+}
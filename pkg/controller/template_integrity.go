@@ -0,0 +1,370 @@
+package controller
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/iterator"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	TemplatesInSyncConditionType = "TemplatesInSync"
+	TemplatesInSyncReason        = "TemplatesInSync"
+	TemplatesDivergedReason      = "TemplatesDiverged"
+	TemplateCheckFailedReason    = "TemplateCheckFailed"
+
+	// DefaultTemplateIntegrityInterval is how often the embedded templates
+	// are compared with the remote bundles again.
+	DefaultTemplateIntegrityInterval = time.Hour
+
+	// embeddedTemplateRoot is the directory of the embedded bundles.
+	embeddedTemplateRoot = "v1"
+
+	// maxDescribedDivergences is the number of divergent files named in the
+	// message of the TemplatesInSync condition.
+	maxDescribedDivergences = 5
+)
+
+var templateBundleDivergence = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "karo_template_bundle_divergent_files",
+	Help: "Files of a template bundle that differ between the embedded templates and the remote bundles, or exist in only one of them, as of the last integrity check.",
+}, []string{"bundle"})
+
+func init() {
+	metrics.Registry.MustRegister(templateBundleDivergence)
+}
+
+// TemplateIntegrityChecker compares the embedded template bundles with a
+// copy in GCS, e.g. gs://skippy-kustomization-templates/integrations, where
+// embedded:/v1/<bundle> is stored under <prefix>/<bundle>, so that a stale
+// bucket is noticed. Divergent files are counted per bundle in the
+// karo_template_bundle_divergent_files metric, and reported in the
+// TemplatesInSync condition of the Integrations whose templates use the
+// bundles from either place.
+type TemplateIntegrityChecker struct {
+	Client client.Client
+	// Embedded holds the embedded bundles under v1/, e.g. assets.Embedded.
+	Embedded fs.FS
+	// Remote is the gs://bucket/prefix URI of the remote bundles.
+	Remote string
+	// Interval overrides DefaultTemplateIntegrityInterval.
+	Interval time.Duration
+	// listRemote returns the MD5 hashes of the objects under prefix, keyed by
+	// their path relative to it. It lists GCS if nil.
+	listRemote func(ctx context.Context, bucket, prefix string) (map[string]string, error)
+
+	// bundles are the bundles reported in the metric by the last check.
+	bundles map[string]bool
+}
+
+// TemplateDivergence is the difference between the embedded and the remote
+// bundles, as paths relative to the bundle root, e.g.
+// "agent/template/deployment.yaml".
+type TemplateDivergence struct {
+	MissingRemote   []string
+	MissingEmbedded []string
+	Changed         []string
+}
+
+// files returns the divergent paths, sorted.
+func (d *TemplateDivergence) files() []string {
+	files := append(append(append([]string{}, d.MissingRemote...), d.MissingEmbedded...), d.Changed...)
+	sort.Strings(files)
+	return files
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: the leader
+// writes the status of the Integrations.
+func (c *TemplateIntegrityChecker) NeedLeaderElection() bool {
+	return true
+}
+
+// Start checks the templates until ctx is done.
+func (c *TemplateIntegrityChecker) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("remote", c.Remote)
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultTemplateIntegrityInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Check(ctx); err != nil {
+			logger.Error(err, "Failed to check the integrity of the embedded templates")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check compares the embedded and the remote bundles, and reports the
+// result in the metric and the status of the Integrations.
+func (c *TemplateIntegrityChecker) Check(ctx context.Context) error {
+	divergence, compareErr := c.compare(ctx)
+	if compareErr == nil {
+		c.recordMetric(divergence)
+		if files := divergence.files(); len(files) > 0 {
+			log.FromContext(ctx).Info("Embedded templates differ from the remote bundles", "remote", c.Remote, "files", len(files))
+		}
+	}
+
+	integrations := &modelv1.IntegrationList{}
+	if err := c.Client.List(ctx, integrations); err != nil {
+		return fmt.Errorf("failed to list Integrations: %w", err)
+	}
+	for i := range integrations.Items {
+		if err := c.updateCondition(ctx, &integrations.Items[i], divergence, compareErr); err != nil {
+			return err
+		}
+	}
+	return compareErr
+}
+
+// compare lists the files of both sides and compares their MD5 hashes.
+func (c *TemplateIntegrityChecker) compare(ctx context.Context) (*TemplateDivergence, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(c.Remote, "gs://"), "/")
+	if !strings.HasPrefix(c.Remote, "gs://") || bucket == "" {
+		return nil, fmt.Errorf("invalid remote template bundles %q, expected gs://bucket/prefix", c.Remote)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	embedded, err := embeddedMD5s(c.Embedded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the embedded templates: %w", err)
+	}
+	listRemote := c.listRemote
+	if listRemote == nil {
+		listRemote = listGCSMD5s
+	}
+	remote, err := listRemote(ctx, bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the remote templates in %s: %w", c.Remote, err)
+	}
+
+	divergence := &TemplateDivergence{}
+	for name, hash := range embedded {
+		remoteHash, found := remote[name]
+		switch {
+		case !found:
+			divergence.MissingRemote = append(divergence.MissingRemote, name)
+		case remoteHash != hash:
+			divergence.Changed = append(divergence.Changed, name)
+		}
+	}
+	for name := range remote {
+		if _, found := embedded[name]; !found {
+			divergence.MissingEmbedded = append(divergence.MissingEmbedded, name)
+		}
+	}
+	sort.Strings(divergence.MissingRemote)
+	sort.Strings(divergence.MissingEmbedded)
+	sort.Strings(divergence.Changed)
+	return divergence, nil
+}
+
+// recordMetric sets the number of divergent files of every bundle of either
+// side, and removes the bundles that are gone.
+func (c *TemplateIntegrityChecker) recordMetric(divergence *TemplateDivergence) {
+	counts := map[string]int{}
+	for _, name := range divergence.files() {
+		counts[bundleOf(name)]++
+	}
+	embedded, _ := fs.ReadDir(c.Embedded, embeddedTemplateRoot)
+	for _, entry := range embedded {
+		if entry.IsDir() {
+			counts[entry.Name()] += 0
+		}
+	}
+	for bundle := range c.bundles {
+		if _, found := counts[bundle]; !found {
+			templateBundleDivergence.DeleteLabelValues(bundle)
+		}
+	}
+	c.bundles = map[string]bool{}
+	for bundle, count := range counts {
+		templateBundleDivergence.WithLabelValues(bundle).Set(float64(count))
+		c.bundles[bundle] = true
+	}
+}
+
+// updateCondition sets the TemplatesInSync condition of integration, if its
+// templates use bundles of either side.
+func (c *TemplateIntegrityChecker) updateCondition(ctx context.Context, integration *modelv1.Integration, divergence *TemplateDivergence, compareErr error) error {
+	bundles := c.integrationBundles(integration)
+	if len(bundles) == 0 {
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:               TemplatesInSyncConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             TemplatesInSyncReason,
+		Message:            fmt.Sprintf("The embedded templates match %s.", c.Remote),
+		ObservedGeneration: integration.Generation,
+	}
+	if compareErr != nil {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = TemplateCheckFailedReason
+		condition.Message = compareErr.Error()
+	} else if files := divergentFiles(divergence, bundles); len(files) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = TemplatesDivergedReason
+		condition.Message = describeDivergence(c.Remote, files)
+	}
+
+	key := client.ObjectKeyFromObject(integration)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		live := &modelv1.Integration{}
+		if err := c.Client.Get(ctx, key, live); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		status := live.Status.DeepCopy()
+		meta.SetStatusCondition(&status.Conditions, condition)
+		if equality.Semantic.DeepEqual(status, &live.Status) {
+			return nil
+		}
+		live.Status = *status
+		return c.Client.Status().Update(ctx, live)
+	})
+}
+
+// integrationBundles returns the bundles that the templates of integration
+// use, from the embedded templates or the remote bundles.
+func (c *TemplateIntegrityChecker) integrationBundles(integration *modelv1.Integration) map[string]bool {
+	remote := "gcs:/" + strings.Trim(strings.TrimPrefix(c.Remote, "gs://"), "/") + "/"
+	bundles := map[string]bool{}
+	for _, spec := range integration.Spec {
+		for _, template := range spec.Templates {
+			// Paths are normalized to gcs:/bucket/path, unless they were
+			// stored before the defaulting webhook ran.
+			templatePath := strings.Replace(template.Path, "gcs://", "gcs:/", 1)
+			var rest string
+			switch {
+			case strings.HasPrefix(templatePath, "embedded:/"+embeddedTemplateRoot+"/"):
+				rest = strings.TrimPrefix(templatePath, "embedded:/"+embeddedTemplateRoot+"/")
+			case strings.HasPrefix(templatePath, remote):
+				rest = strings.TrimPrefix(templatePath, remote)
+			default:
+				continue
+			}
+			if bundle := bundleOf(rest); bundle != "" {
+				bundles[bundle] = true
+			}
+		}
+	}
+	return bundles
+}
+
+// divergentFiles returns the divergent files of bundles.
+func divergentFiles(divergence *TemplateDivergence, bundles map[string]bool) []string {
+	var files []string
+	for _, name := range divergence.files() {
+		if bundles[bundleOf(name)] {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// describeDivergence returns the message of a TemplatesInSync condition that
+// is False.
+func describeDivergence(remote string, files []string) string {
+	described := files
+	more := ""
+	if len(files) > maxDescribedDivergences {
+		described = files[:maxDescribedDivergences]
+		more = fmt.Sprintf(" and %d more", len(files)-maxDescribedDivergences)
+	}
+	return fmt.Sprintf("%d file(s) of the embedded templates differ from %s or exist in only one of them: %s%s.", len(files), remote, strings.Join(described, ", "), more)
+}
+
+// bundleOf returns the bundle of a path relative to the bundle root.
+func bundleOf(name string) string {
+	bundle, _, _ := strings.Cut(strings.Trim(name, "/"), "/")
+	return bundle
+}
+
+// embeddedMD5s returns the MD5 hashes of the embedded templates, keyed by
+// their path relative to v1/.
+func embeddedMD5s(fsys fs.FS) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := fs.WalkDir(fsys, embeddedTemplateRoot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(content)
+		hashes[strings.TrimPrefix(name, path.Clean(embeddedTemplateRoot)+"/")] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	return hashes, err
+}
+
+// listGCSMD5s returns the MD5 hashes of the objects under prefix in bucket.
+// Objects without one, e.g. composite objects, are downloaded and hashed.
+func listGCSMD5s(ctx context.Context, bucket, prefix string) (map[string]string, error) {
+	gcs, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gcs.Close()
+	handle := gcs.Bucket(bucket)
+
+	hashes := map[string]string{}
+	it := handle.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if attrs.Size == 0 && strings.HasSuffix(attrs.Name, "/") {
+			// Placeholder of an empty folder.
+			continue
+		}
+		hash := attrs.MD5
+		if hash == nil {
+			reader, err := handle.Object(attrs.Name).Generation(attrs.Generation).NewReader(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", attrs.Name, err)
+			}
+			digest := md5.New()
+			_, err = io.Copy(digest, reader)
+			reader.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", attrs.Name, err)
+			}
+			hash = digest.Sum(nil)
+		}
+		hashes[strings.TrimPrefix(attrs.Name, prefix)] = hex.EncodeToString(hash)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func md5Hex(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTemplateIntegrityChecker(t *testing.T) {
+	embedded := fstest.MapFS{
+		"v1/agent/template/deployment.yaml": {Data: []byte("kind: Deployment")},
+		"v1/agent/template/service.yaml":    {Data: []byte("kind: Service")},
+		"v1/sandbox/template/pod.yaml":      {Data: []byte("kind: Pod")},
+	}
+	remote := map[string]string{
+		"agent/template/deployment.yaml": md5Hex("kind: Deployment"),
+		"agent/template/service.yaml":    md5Hex("kind: Service"),
+		"sandbox/template/pod.yaml":      md5Hex("kind: Pod"),
+	}
+	var listErr error
+	agent := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "karo-system", Generation: 2},
+		Spec: []modelv1.IntegrationSpec{{Group: "model.skippy.io", Version: "v1", Kind: "Agent", Templates: []modelv1.IntegrationApiTemplatesSpec{
+			{Path: "embedded:/v1/agent/template"},
+		}}},
+	}
+	sandbox := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "sandbox", Namespace: "karo-system"},
+		Spec: []modelv1.IntegrationSpec{{Group: "model.skippy.io", Version: "v1", Kind: "AgenticSandbox", Templates: []modelv1.IntegrationApiTemplatesSpec{
+			{Path: "gcs:/skippy-kustomization-templates/integrations/sandbox/template"},
+		}}},
+	}
+	other := &modelv1.Integration{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "karo-system"},
+		Spec: []modelv1.IntegrationSpec{{Group: "model.skippy.io", Version: "v1", Kind: "InferenceService", Templates: []modelv1.IntegrationApiTemplatesSpec{
+			{Path: "gcs:/models/vllm"},
+		}}},
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, modelv1.AddToScheme(s))
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(agent, sandbox, other).WithStatusSubresource(agent, sandbox, other).Build()
+	checker := &TemplateIntegrityChecker{
+		Client:   c,
+		Embedded: embedded,
+		Remote:   "gs://skippy-kustomization-templates/integrations",
+		listRemote: func(_ context.Context, bucket, prefix string) (map[string]string, error) {
+			assert.Equal(t, "skippy-kustomization-templates", bucket)
+			assert.Equal(t, "integrations/", prefix)
+			return remote, listErr
+		},
+	}
+	ctx := context.Background()
+	condition := func(integration *modelv1.Integration) *metav1.Condition {
+		stored := &modelv1.Integration{}
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(integration), stored))
+		return meta.FindStatusCondition(stored.Status.Conditions, TemplatesInSyncConditionType)
+	}
+
+	require.NoError(t, checker.Check(ctx))
+	require.NotNil(t, condition(agent))
+	assert.Equal(t, metav1.ConditionTrue, condition(agent).Status)
+	assert.Equal(t, int64(2), condition(agent).ObservedGeneration)
+	assert.Equal(t, metav1.ConditionTrue, condition(sandbox).Status)
+	assert.Nil(t, condition(other), "integrations that use neither side get no condition")
+	assert.Equal(t, 0.0, testutil.ToFloat64(templateBundleDivergence.WithLabelValues("agent")))
+
+	// A stale bucket.
+	remote["agent/template/service.yaml"] = md5Hex("kind: Service\nspec: {}")
+	delete(remote, "agent/template/deployment.yaml")
+	remote["agent/template/old.yaml"] = md5Hex("kind: ConfigMap")
+	require.NoError(t, checker.Check(ctx))
+	assert.Equal(t, metav1.ConditionFalse, condition(agent).Status)
+	assert.Equal(t, TemplatesDivergedReason, condition(agent).Reason)
+	assert.Equal(t, "3 file(s) of the embedded templates differ from gs://skippy-kustomization-templates/integrations or exist in only one of them: agent/template/deployment.yaml, agent/template/old.yaml, agent/template/service.yaml.", condition(agent).Message)
+	assert.Equal(t, metav1.ConditionTrue, condition(sandbox).Status, "other bundles are in sync")
+	assert.Equal(t, 3.0, testutil.ToFloat64(templateBundleDivergence.WithLabelValues("agent")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(templateBundleDivergence.WithLabelValues("sandbox")))
+
+	// Failed checks are reported as unknown.
+	listErr = errors.New("permission denied")
+	assert.ErrorContains(t, checker.Check(ctx), "permission denied")
+	assert.Equal(t, metav1.ConditionUnknown, condition(agent).Status)
+	assert.Equal(t, TemplateCheckFailedReason, condition(agent).Reason)
+}
+
+func TestDescribeDivergence(t *testing.T) {
+	files := []string{"a/1", "a/2", "a/3", "a/4", "a/5", "a/6", "a/7"}
+	assert.Equal(t, "7 file(s) of the embedded templates differ from gs://b/p or exist in only one of them: a/1, a/2, a/3, a/4, a/5 and 2 more.", describeDivergence("gs://b/p", files))
+}
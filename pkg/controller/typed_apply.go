@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// typedApplyKinds are the kinds that are applied with typed server-side apply
+// by resource clients with a typed client.
+var typedApplyKinds = map[schema.GroupVersionKind]bool{
+	{Group: "apps", Version: "v1", Kind: "Deployment"}: true,
+	{Version: "v1", Kind: "Service"}:                   true,
+	{Version: "v1", Kind: "ConfigMap"}:                 true,
+}
+
+// TypedApplyError is returned when a rendered object does not match the
+// schema of its kind, e.g. a string where the API expects a number or a
+// misspelled field, so that it cannot be applied with typed server-side
+// apply.
+type TypedApplyError struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *TypedApplyError) Error() string {
+	return fmt.Sprintf("%s %s does not match the schema of its kind: %v", e.Kind, e.Name, e.Err)
+}
+
+func (e *TypedApplyError) Unwrap() error {
+	return e.Err
+}
+
+// typedApplier is implemented by resource clients that apply the
+// typedApplyKinds with typed server-side apply.
+type typedApplier interface {
+	// appliesTyped returns true if objects of kind gvk are applied with
+	// applyTyped.
+	appliesTyped(gvk schema.GroupVersionKind) bool
+	// applyTyped creates or updates obj with server-side apply. existingObj
+	// is the live object, or nil if it does not exist yet.
+	applyTyped(ctx context.Context, namespace string, obj, existingObj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+}
+
+var _ typedApplier = &ResourceClient{}
+
+func (rc *ResourceClient) appliesTyped(gvk schema.GroupVersionKind) bool {
+	return rc.typedClient != nil && typedApplyKinds[gvk]
+}
+
+func (rc *ResourceClient) applyTyped(ctx context.Context, namespace string, obj, existingObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if existingObj != nil {
+		if err := rc.upgradeManagedFields(ctx, existingObj); err != nil {
+			return nil, err
+		}
+	}
+	// karo owns the fields it renders, as it did when it updated the whole
+	// object.
+	opts := metav1.ApplyOptions{FieldManager: rc.fieldManager, Force: true, DryRun: dryRunOption(rc.dryRun)}
+	if rc.dryRun {
+		logDryRun(ctx, "apply", obj.GetKind(), namespace, obj.GetName())
+	}
+	var applied runtime.Object
+	switch obj.GetKind() {
+	case "Deployment":
+		config := &appsv1ac.DeploymentApplyConfiguration{}
+		if err := decodeApplyConfiguration(obj, config); err != nil {
+			return nil, err
+		}
+		deployment, err := rc.typedClient.AppsV1().Deployments(namespace).Apply(ctx, config, opts)
+		if err != nil {
+			return nil, err
+		}
+		applied = deployment
+	case "Service":
+		config := &corev1ac.ServiceApplyConfiguration{}
+		if err := decodeApplyConfiguration(obj, config); err != nil {
+			return nil, err
+		}
+		service, err := rc.typedClient.CoreV1().Services(namespace).Apply(ctx, config, opts)
+		if err != nil {
+			return nil, err
+		}
+		applied = service
+	case "ConfigMap":
+		config := &corev1ac.ConfigMapApplyConfiguration{}
+		if err := decodeApplyConfiguration(obj, config); err != nil {
+			return nil, err
+		}
+		configMap, err := rc.typedClient.CoreV1().ConfigMaps(namespace).Apply(ctx, config, opts)
+		if err != nil {
+			return nil, err
+		}
+		applied = configMap
+	default:
+		return nil, fmt.Errorf("typed apply is not supported for %s", obj.GroupVersionKind())
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(applied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert applied %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	result := &unstructured.Unstructured{Object: content}
+	// Typed clients return objects without their type meta.
+	result.SetGroupVersionKind(obj.GroupVersionKind())
+	return result, nil
+}
+
+// upgradeManagedFields hands the fields that karo set with updates to its
+// apply field manager, so that fields which are no longer rendered are
+// removed by the next apply instead of being left behind with the update
+// manager.
+func (rc *ResourceClient) upgradeManagedFields(ctx context.Context, existingObj *unstructured.Unstructured) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existingObj, sets.New(rc.fieldManager), rc.fieldManager)
+	if err != nil {
+		return fmt.Errorf("failed to upgrade the managed fields of %s %s: %w", existingObj.GetKind(), existingObj.GetName(), err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if _, err := rc.Patch(ctx, existingObj.GroupVersionKind(), existingObj.GetNamespace(), existingObj.GetName(), types.JSONPatchType, patch); err != nil {
+		return fmt.Errorf("failed to upgrade the managed fields of %s %s: %w", existingObj.GetKind(), existingObj.GetName(), err)
+	}
+	return nil
+}
+
+// decodeApplyConfiguration decodes the rendered obj into the apply
+// configuration of its kind. Fields that the kind does not have and values
+// of the wrong type are a *TypedApplyError, rather than being dropped or
+// converted by the API server.
+func decodeApplyConfiguration(obj *unstructured.Unstructured, config interface{}) error {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return &TypedApplyError{Kind: obj.GetKind(), Name: obj.GetName(), Err: err}
+	}
+	return nil
+}
+
+// applyTypedResource creates or updates obj with typed server-side apply,
+// with the events and log of createOrUpdateResource.
+func (r *GenericReconciler) applyTypedResource(ctx context.Context, log logr.Logger, applier typedApplier, target *unstructured.Unstructured, obj *unstructured.Unstructured, gvk schema.GroupVersionKind, namespace string, resourceName string, existingObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	action, failedEvent := "Created", DependentCreateFailedEvent
+	if existingObj != nil {
+		action, failedEvent = "Updated", DependentUpdateFailedEvent
+		r.verboseEventf(target, corev1.EventTypeNormal, DependentUpdateStartedEvent, "Starting update of %s %s/%s for %s %s", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName())
+	}
+	appliedObj, err := applier.applyTyped(ctx, namespace, obj, existingObj)
+	if err != nil {
+		log.Error(err, "Error during typed Apply call", "GVK", gvk, "Namespace", namespace, "Name", resourceName)
+		r.errorEventf(target, err, failedEvent, "Failed to apply %s %s/%s for %s %s: %v", obj.GetKind(), namespace, resourceName, target.GetKind(), target.GetName(), err)
+		return nil, fmt.Errorf("error applying resource %s %s/%s: %w", gvk.String(), namespace, resourceName, err)
+	}
+	log.Info("Resource applied", "GVK", gvk, "name", appliedObj.GetName(), "namespace", namespace, "action", action)
+	recordDependentChange(ctx, action, appliedObj)
+	if existingObj != nil {
+		r.eventf(target, corev1.EventTypeNormal, DependentUpdatedEvent, "Successfully updated %s %s/%s for %s %s", appliedObj.GetKind(), namespace, appliedObj.GetName(), target.GetKind(), target.GetName())
+	} else {
+		r.eventf(target, corev1.EventTypeNormal, DependentCreatedEvent, "Successfully created %s %s/%s (UID: %s) for %s %s", appliedObj.GetKind(), appliedObj.GetNamespace(), appliedObj.GetName(), appliedObj.GetUID(), target.GetKind(), target.GetName())
+	}
+	return appliedObj, nil
+}
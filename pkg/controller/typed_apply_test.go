@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTypedApplyDeployment(replicas interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "llama", "namespace": "default", "labels": map[string]interface{}{"app": "llama"}},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "llama"}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "llama"}},
+				"spec": map[string]interface{}{"containers": []interface{}{
+					map[string]interface{}{"name": "server", "image": "vllm/vllm-openai:v0.8.0"},
+				}},
+			},
+		},
+	}}
+}
+
+func TestApplyTyped(t *testing.T) {
+	ctx := context.Background()
+	typedClient := fake.NewClientset()
+	rc := &ResourceClient{fieldManager: "karo/model", typedClient: typedClient}
+	assert.True(t, rc.appliesTyped(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+	assert.True(t, rc.appliesTyped(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}))
+	assert.False(t, rc.appliesTyped(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}))
+	assert.False(t, (&ResourceClient{}).appliesTyped(schema.GroupVersionKind{Version: "v1", Kind: "Service"}))
+
+	// Template values are int, not int64.
+	applied, err := rc.applyTyped(ctx, "default", newTypedApplyDeployment(2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "apps/v1", applied.GetAPIVersion())
+	assert.Equal(t, "Deployment", applied.GetKind())
+	replicas, _, _ := unstructured.NestedInt64(applied.Object, "spec", "replicas")
+	assert.Equal(t, int64(2), replicas)
+	live, err := typedClient.AppsV1().Deployments("default").Get(ctx, "llama", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *live.Spec.Replicas)
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "llama-config", "namespace": "default"},
+		"data":       map[string]interface{}{"MODEL": "llama"},
+	}}
+	_, err = rc.applyTyped(ctx, "default", configMap, nil)
+	require.NoError(t, err)
+	liveConfigMap, err := typedClient.CoreV1().ConfigMaps("default").Get(ctx, "llama-config", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"MODEL": "llama"}, liveConfigMap.Data)
+
+	// Objects that do not match the schema of their kind are not applied.
+	_, err = rc.applyTyped(ctx, "default", newTypedApplyDeployment("two"), nil)
+	var typedErr *TypedApplyError
+	require.True(t, stderrors.As(err, &typedErr))
+	assert.ErrorContains(t, err, "Deployment llama does not match the schema of its kind")
+	assert.ErrorContains(t, err, "spec.replicas")
+	assert.Equal(t, ValidationError, classifyError(err))
+
+	misspelled := newTypedApplyDeployment(2)
+	misspelled.Object["spec"].(map[string]interface{})["replica"] = 3
+	_, err = rc.applyTyped(ctx, "default", misspelled, nil)
+	assert.ErrorContains(t, err, `unknown field "replica"`)
+}
+
+func TestCreateOrUpdateResourceAppliesTyped(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Recorder: recorder}
+	target := newTestResource("llama", "default", eventTestGVK)
+	rc := &ResourceClient{fieldManager: "karo/model", typedClient: fake.NewClientset()}
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	created, err := r.createOrUpdateResource(ctx, testLogger(), rc, target, newTypedApplyDeployment(1), gvk, "default", "llama", nil)
+	require.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Normal DependentCreated")
+
+	_, err = r.createOrUpdateResource(ctx, testLogger(), rc, target, newTypedApplyDeployment(3), gvk, "default", "llama", created)
+	require.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Normal DependentUpdated")
+
+	_, err = r.createOrUpdateResource(ctx, testLogger(), rc, target, newTypedApplyDeployment("three"), gvk, "default", "llama", created)
+	assert.ErrorContains(t, err, "error applying resource apps/v1, Kind=Deployment default/llama")
+	assert.Contains(t, <-recorder.Events, "Warning DependentUpdateFailed")
+}
@@ -187,11 +187,16 @@ type MockRegistry struct {
 	ListIntegrationsFunc  func() []schema.GroupVersionKind
 	GetCopyPathsFunc      func(k schema.GroupVersionKind) []string
 	GetTemplatePathsFunc  func(k schema.GroupVersionKind) []string
+	GetOverlayPathsFunc   func(k schema.GroupVersionKind) []string
+	GetPatchTemplatesFunc func(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec
+	GetKustomizeRootsFunc func(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec
+	SetEnvironmentFunc    func(environment string)
 	GetReferencePathsFunc func(k schema.GroupVersionKind) (map[schema.GroupVersionKind]string, map[schema.GroupVersionKind]string)
-	ResolveContextFunc    func(ctx context.Context, resource *unstructured.Unstructured, output map[string]any) error
+	ResolveContextFunc    func(ctx context.Context, resource *unstructured.Unstructured, output map[string]any, reference bool) error
 
 	// This is the new field and method that was missing
-	GetReferenceRulesFunc func(gvk schema.GroupVersionKind) []modelv1.IntegrationApiReferenceSpec
+	GetReferenceRulesFunc  func(gvk schema.GroupVersionKind) []modelv1.IntegrationApiReferenceSpec
+	GetIntegrationSpecFunc func(gvk schema.GroupVersionKind) (modelv1.IntegrationSpec, bool)
 
 	// lock field is no longer needed in the mock as it's an implementation detail
 }
@@ -239,6 +244,19 @@ func (m *MockRegistry) GetTemplatePaths(k schema.GroupVersionKind) []string {
 	return nil
 }
 
+func (m *MockRegistry) GetOverlayPaths(k schema.GroupVersionKind) []string {
+	if m.GetOverlayPathsFunc != nil {
+		return m.GetOverlayPathsFunc(k)
+	}
+	return nil
+}
+
+func (m *MockRegistry) SetEnvironment(environment string) {
+	if m.SetEnvironmentFunc != nil {
+		m.SetEnvironmentFunc(environment)
+	}
+}
+
 func (m *MockRegistry) GetReferencePaths(k schema.GroupVersionKind) (map[schema.GroupVersionKind]string, map[schema.GroupVersionKind]string) {
 	if m.GetReferencePathsFunc != nil {
 		return m.GetReferencePathsFunc(k)
@@ -246,9 +264,9 @@ func (m *MockRegistry) GetReferencePaths(k schema.GroupVersionKind) (map[schema.
 	return nil, nil
 }
 
-func (m *MockRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any) error {
+func (m *MockRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any, reference bool) error {
 	if m.ResolveContextFunc != nil {
-		return m.ResolveContextFunc(ctx, resource, output)
+		return m.ResolveContextFunc(ctx, resource, output, reference)
 	}
 	return nil
 }
@@ -261,10 +279,43 @@ func (m *MockRegistry) GetReferenceRules(gvk schema.GroupVersionKind) []modelv1.
 	return nil
 }
 
+func (m *MockRegistry) GetIntegrationSpec(gvk schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+	if m.GetIntegrationSpecFunc != nil {
+		return m.GetIntegrationSpecFunc(gvk)
+	}
+	return modelv1.IntegrationSpec{}, false
+}
+
+func (m *MockRegistry) GetPatchTemplates(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	if m.GetPatchTemplatesFunc != nil {
+		return m.GetPatchTemplatesFunc(k)
+	}
+	return nil
+}
+
+func (m *MockRegistry) GetKustomizeRoots(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	if m.GetKustomizeRootsFunc != nil {
+		return m.GetKustomizeRootsFunc(k)
+	}
+	return nil
+}
+
 // MockTransformer allows us to control the behavior of the Transformer dependency.
 type MockTransformer struct {
 	RunFunc      func(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, req ctrl.Request, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error)
 	RegistryFunc func() modelv1.RegistryInterface
+	// InputHashFunc returns the hash of the render inputs of obj. Without
+	// it the hash is empty, so that renders are never skipped.
+	InputHashFunc func(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, obj *unstructured.Unstructured) (string, error)
+	// IntegrationKindsFunc returns the kinds that the templates of an
+	// integration render.
+	IntegrationKindsFunc func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]schema.GroupVersionKind, error)
+	// VerifyBundlesFunc returns the status of the packaged template bundles
+	// of an integration.
+	VerifyBundlesFunc func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]modelv1.IntegrationBundleStatus, error)
+	// TemplateHashesFunc returns the content hashes of the template bundles
+	// of an integration.
+	TemplateHashesFunc func(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) (map[string]string, error)
 }
 
 // Run implements the TransformerInterface. It calls the RunFunc field if it's set for a given test.
@@ -285,9 +336,37 @@ func (m *MockTransformer) Run(
 	return nil, nil
 }
 
+func (m *MockTransformer) InputHash(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, obj *unstructured.Unstructured) (string, error) {
+	if m.InputHashFunc != nil {
+		return m.InputHashFunc(ctx, discoveryClient, dynamicClient, rClient, obj)
+	}
+	return "", nil
+}
+
 func (m *MockTransformer) Registry() modelv1.RegistryInterface {
 	if m.RegistryFunc != nil {
 		return m.RegistryFunc()
 	}
 	return nil
 }
+
+func (m *MockTransformer) IntegrationKinds(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]schema.GroupVersionKind, error) {
+	if m.IntegrationKindsFunc != nil {
+		return m.IntegrationKindsFunc(ctx, c, spec)
+	}
+	return nil, nil
+}
+
+func (m *MockTransformer) VerifyBundles(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) ([]modelv1.IntegrationBundleStatus, error) {
+	if m.VerifyBundlesFunc != nil {
+		return m.VerifyBundlesFunc(ctx, c, spec)
+	}
+	return nil, nil
+}
+
+func (m *MockTransformer) TemplateHashes(ctx context.Context, c client.Client, spec modelv1.IntegrationSpec) (map[string]string, error) {
+	if m.TemplateHashesFunc != nil {
+		return m.TemplateHashesFunc(ctx, c, spec)
+	}
+	return nil, nil
+}
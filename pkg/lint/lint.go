@@ -0,0 +1,376 @@
+// Package lint checks the template bundles of integrations before they reach
+// a cluster, e.g. in the pre-merge CI of the team that owns them. Templates
+// are parsed with the functions that the operator renders them with, their
+// reads of the context are checked against the schema of the integrated
+// kind, and, given a sample resource, they are rendered offline to catch
+// output that safetext rejects as YAML injection and objects that two
+// templates both render.
+package lint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+
+	template "github.com/google/safetext/yamltemplate"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+// The checks that findings are reported by.
+const (
+	CheckSyntax            = "syntax"
+	CheckUndefinedFunction = "undefined-function"
+	CheckUnknownField      = "unknown-field"
+	CheckInjection         = "injection"
+	CheckRender            = "render"
+	CheckDuplicateName     = "duplicate-name"
+)
+
+// parseErrorLine matches the line of a parse error, e.g.
+// `template: deployment.yaml:12: function "foo" not defined`.
+var parseErrorLine = regexp.MustCompile(`^template: .*?:(\d+):`)
+
+// Finding is a problem found in a template file.
+type Finding struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", f.Path, f.Line, f.Check, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Path, f.Check, f.Message)
+}
+
+// Options are the inputs of the checks beyond the templates.
+type Options struct {
+	// Sample is a resource of the integrated kind that the templates are
+	// rendered for. Without it, the checks that render the templates are
+	// skipped.
+	Sample *unstructured.Unstructured
+	// Schema is the OpenAPI schema of the integrated kind, e.g. of the
+	// storage version of its CRD, that .resource fields are checked against.
+	// Without it, they are checked against Sample, which should then set
+	// every field that the templates read.
+	Schema *apiextensionsv1.JSONSchemaProps
+}
+
+// Bundle is a directory of templates of an integration.
+type Bundle struct {
+	FS   filesys.FileSystem
+	Root string
+	// Operation is that of the bundle in the integration, "template" if
+	// empty. Copy and kustomize bundles are not templated and are skipped.
+	Operation string
+}
+
+// Integration lints the template bundles of spec, read from their embedded:
+// or gcs: paths.
+func Integration(ctx context.Context, spec v1.IntegrationSpec, opts Options) ([]Finding, error) {
+	var bundles []Bundle
+	for _, templates := range spec.Templates {
+		fSys, root, err := transformer.TemplateFileSystem(ctx, templates.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get file system for path %q: %v", templates.Path, err)
+		}
+		bundles = append(bundles, Bundle{FS: fSys, Root: root, Operation: templates.Operation})
+	}
+	return Bundles(spec, bundles, opts)
+}
+
+// Bundles lints bundles as the template bundles of spec, e.g. a local
+// checkout of bundles that spec reads from GCS.
+func Bundles(spec v1.IntegrationSpec, bundles []Bundle, opts Options) ([]Finding, error) {
+	l := &linter{
+		opts:    opts,
+		fields:  map[string]bool{},
+		renders: map[string]string{},
+	}
+	for _, field := range transformer.ContextFields {
+		l.fields[field] = true
+	}
+	for _, request := range spec.Context {
+		l.fields[request.Name] = true
+	}
+	if opts.Sample != nil {
+		context, err := transformer.OfflineContext(spec, opts.Sample)
+		if err != nil {
+			return nil, err
+		}
+		l.context = context
+	}
+
+	for _, bundle := range bundles {
+		if bundle.Operation == "copy" || bundle.Operation == "kustomize" {
+			continue
+		}
+		err := bundle.FS.Walk(bundle.Root, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			baseName := filepath.Base(path)
+			if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
+				return nil
+			}
+			data, err := bundle.FS.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			l.lintFile(path, string(data), bundle.Operation)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking path %q: %v", bundle.Root, err)
+		}
+	}
+	return l.findings, nil
+}
+
+type linter struct {
+	opts Options
+	// fields are the top-level fields of the context.
+	fields  map[string]bool
+	context map[string]any
+	// renders maps the objects that templates render, as "Kind
+	// namespace/name", to the file that renders them.
+	renders  map[string]string
+	findings []Finding
+}
+
+func (l *linter) report(path string, line int, check, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{Path: path, Line: line, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lintFile(path, text, operation string) {
+	tmpl, err := texttemplate.New(path).Funcs(transformer.TemplateFuncs()).Parse(text)
+	if err != nil {
+		check := CheckSyntax
+		if strings.Contains(err.Error(), "not defined") {
+			check = CheckUndefinedFunction
+		}
+		line := 0
+		if match := parseErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+		l.report(path, line, check, "%v", err)
+		return
+	}
+	if tmpl.Tree != nil {
+		l.checkFields(path, tmpl.Tree, tmpl.Tree.Root, true)
+	}
+
+	if l.context == nil {
+		return
+	}
+	output, err := l.render(path, text)
+	if err != nil {
+		switch {
+		case errors.Is(err, template.ErrYAMLInjection):
+			l.report(path, 0, CheckInjection, "the values it substitutes change the structure of the YAML, which the operator rejects as injection; quote them or render them with toJson")
+		case errors.Is(err, template.ErrInvalidYAMLTemplate):
+			l.report(path, 0, CheckRender, "the template does not render valid YAML")
+		default:
+			l.report(path, 0, CheckRender, "unable to render the sample: %v", err)
+		}
+		return
+	}
+	// Overlays and patches name the objects that they change.
+	if operation == "" || operation == "template" {
+		l.checkDuplicates(path, output)
+	}
+}
+
+// render renders a template for the sample as the operator would.
+func (l *linter) render(path, text string) ([]byte, error) {
+	tmpl, err := template.New(path).Funcs(transformer.OfflineTemplateFuncs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	output := &bytes.Buffer{}
+	if err := tmpl.Execute(output, l.context); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// checkDuplicates reports the objects in output that an earlier template
+// already rendered.
+func (l *linter) checkDuplicates(path string, output []byte) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(output), 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if !errors.Is(err, io.EOF) {
+				l.report(path, 0, CheckRender, "the sample renders invalid YAML: %v", err)
+			}
+			return
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		if u.GetKind() == "" || u.GetName() == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s %s/%s", u.GetKind(), u.GetNamespace(), u.GetName())
+		if u.GetNamespace() == "" {
+			key = fmt.Sprintf("%s %s", u.GetKind(), u.GetName())
+		}
+		if first, found := l.renders[key]; found {
+			l.report(path, 0, CheckDuplicateName, "%s is also rendered by %s", key, first)
+			continue
+		}
+		l.renders[key] = path
+	}
+}
+
+// checkFields reports the reads of the context under node that name a field
+// it does not have. Within range and with, dot is no longer the context, so
+// only reads through $ are checked there.
+func (l *linter) checkFields(path string, tree *parse.Tree, node parse.Node, atRoot bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			l.checkFields(path, tree, child, atRoot)
+		}
+	case *parse.ActionNode:
+		l.checkFields(path, tree, n.Pipe, atRoot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			l.checkFields(path, tree, cmd, atRoot)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			l.checkFields(path, tree, arg, atRoot)
+		}
+	case *parse.ChainNode:
+		l.checkFields(path, tree, n.Node, atRoot)
+	case *parse.FieldNode:
+		if atRoot {
+			l.checkPath(path, tree, n, n.Ident)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			l.checkPath(path, tree, n, n.Ident[1:])
+		}
+	case *parse.IfNode:
+		l.checkFields(path, tree, n.Pipe, atRoot)
+		l.checkFields(path, tree, n.List, atRoot)
+		l.checkFields(path, tree, n.ElseList, atRoot)
+	case *parse.RangeNode:
+		l.checkFields(path, tree, n.Pipe, atRoot)
+		l.checkFields(path, tree, n.List, false)
+		l.checkFields(path, tree, n.ElseList, atRoot)
+	case *parse.WithNode:
+		l.checkFields(path, tree, n.Pipe, atRoot)
+		l.checkFields(path, tree, n.List, false)
+		l.checkFields(path, tree, n.ElseList, atRoot)
+	case *parse.TemplateNode:
+		l.checkFields(path, tree, n.Pipe, atRoot)
+	}
+}
+
+// checkPath reports a read of the context at fields that it does not have.
+func (l *linter) checkPath(path string, tree *parse.Tree, node parse.Node, fields []string) {
+	line := nodeLine(tree, node)
+	if !l.fields[fields[0]] {
+		l.report(path, line, CheckUnknownField, ".%s is not a field of the template context", fields[0])
+		return
+	}
+	if fields[0] != "resource" || len(fields) == 1 {
+		return
+	}
+	if l.opts.Schema != nil {
+		if unknown := unknownSchemaField(l.opts.Schema, fields[1:]); unknown > 0 {
+			l.report(path, line, CheckUnknownField, ".resource.%s is not in the schema of the resource", strings.Join(fields[1:unknown+1], "."))
+		}
+	} else if l.opts.Sample != nil {
+		if unknown := unknownSampleField(l.opts.Sample.Object, fields[1:]); unknown > 0 {
+			l.report(path, line, CheckUnknownField, ".resource.%s is not set in the sample resource", strings.Join(fields[1:unknown+1], "."))
+		}
+	}
+}
+
+// unknownSchemaField returns the number of fields up to the first one that
+// schema does not have, or 0 if it has all of them. Objects without
+// properties, such as metadata, have any field.
+func unknownSchemaField(schema *apiextensionsv1.JSONSchemaProps, fields []string) int {
+	switch fields[0] {
+	case "apiVersion", "kind", "metadata":
+		if len(schema.Properties[fields[0]].Properties) == 0 {
+			return 0
+		}
+	}
+	node := schema
+	for i, field := range fields {
+		if node.XPreserveUnknownFields != nil && *node.XPreserveUnknownFields {
+			return 0
+		}
+		if len(node.Properties) == 0 {
+			if node.AdditionalProperties != nil && node.AdditionalProperties.Schema != nil {
+				node = node.AdditionalProperties.Schema
+				continue
+			}
+			return 0
+		}
+		property, ok := node.Properties[field]
+		if !ok {
+			return i + 1
+		}
+		node = &property
+	}
+	return 0
+}
+
+// unknownSampleField returns the number of fields up to the first one that
+// obj does not set, or 0 if it sets all of them.
+func unknownSampleField(obj map[string]interface{}, fields []string) int {
+	var current interface{} = obj
+	for i, field := range fields {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return 0
+		}
+		value, found := m[field]
+		if !found {
+			return i + 1
+		}
+		current = value
+	}
+	return 0
+}
+
+// nodeLine returns the line of node in its template.
+func nodeLine(tree *parse.Tree, node parse.Node) int {
+	location, _ := tree.ErrorContext(node)
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return 0
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	return line
+}
@@ -0,0 +1,162 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newBundle(t *testing.T, files map[string]string) Bundle {
+	t.Helper()
+	fSys := filesys.MakeFsInMemory()
+	for path, content := range files {
+		require.NoError(t, fSys.WriteFile(path, []byte(content)))
+	}
+	return Bundle{FS: fSys, Root: "/bundle"}
+}
+
+func newSample() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Agent",
+		"metadata":   map[string]interface{}{"name": "agent", "namespace": "default"},
+		"spec":       map[string]interface{}{"image": "agent:1", "replicas": int64(2)},
+	}}
+}
+
+func checks(findings []Finding) []string {
+	var result []string
+	for _, finding := range findings {
+		result = append(result, finding.Check)
+	}
+	return result
+}
+
+func TestBundlesValid(t *testing.T) {
+	bundle := newBundle(t, map[string]string{
+		"/bundle/kustomization.yaml": "resources: [{{ broken",
+		"/bundle/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+spec:
+  replicas: {{ .resource.spec.replicas }}
+{{- range $i, $c := list 1 2 }}
+  # {{ $c }} {{ $.resource.spec.image }}
+{{- end }}
+`,
+		"/bundle/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ truncateName 63 .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+`,
+	})
+
+	findings, err := Bundles(v1.IntegrationSpec{}, []Bundle{bundle}, Options{Sample: newSample()})
+	require.NoError(t, err)
+	assert.Empty(t, findings, "kustomizations are skipped and dot is not the context within range")
+}
+
+func TestBundlesParseErrors(t *testing.T) {
+	bundle := newBundle(t, map[string]string{
+		"/bundle/a.yaml": "name: {{ notAFunction .resource.metadata.name }}\n",
+		"/bundle/b.yaml": "name: x\nimage: {{ .resource.spec.image\n",
+	})
+
+	findings, err := Bundles(v1.IntegrationSpec{}, []Bundle{bundle}, Options{})
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	assert.Equal(t, Finding{Path: "/bundle/a.yaml", Line: 1, Check: CheckUndefinedFunction, Message: findings[0].Message}, findings[0])
+	assert.Contains(t, findings[0].Message, `function "notAFunction" not defined`)
+	assert.Equal(t, CheckSyntax, findings[1].Check)
+	assert.Equal(t, 3, findings[1].Line, "an unclosed action is reported where the file ends")
+}
+
+func TestBundlesUnknownFields(t *testing.T) {
+	bundle := newBundle(t, map[string]string{
+		"/bundle/a.yaml": `name: {{ .resource.metadata.name }}
+image: {{ .resource.spec.imag }}
+model: {{ .model.name }}
+url: {{ .endpoint.url }}
+{{- with .resource.spec }}
+replicas: {{ .replicas }}
+{{- end }}
+`,
+	})
+	spec := v1.IntegrationSpec{Context: []v1.IntegrationApiContextSpec{{Name: "endpoint"}}}
+
+	findings, err := Bundles(spec, []Bundle{bundle}, Options{Sample: newSample()})
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	assert.Equal(t, Finding{Path: "/bundle/a.yaml", Line: 2, Check: CheckUnknownField, Message: ".resource.spec.imag is not set in the sample resource"}, findings[0])
+	assert.Equal(t, Finding{Path: "/bundle/a.yaml", Line: 3, Check: CheckUnknownField, Message: ".model is not a field of the template context"}, findings[1])
+
+	schema := &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"image":    {Type: "string"},
+			"replicas": {Type: "integer"},
+			"env":      {Type: "object", AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}}},
+		}},
+	}}
+	bundle = newBundle(t, map[string]string{
+		"/bundle/a.yaml": `name: {{ .resource.metadata.labels.app }}
+image: {{ .resource.spec.image }}
+env: {{ .resource.spec.env.HOME }}
+tag: {{ .resource.spec.tag }}
+`,
+	})
+	findings, err = Bundles(v1.IntegrationSpec{}, []Bundle{bundle}, Options{Schema: schema})
+	require.NoError(t, err)
+	require.Len(t, findings, 1, "fields are checked against the schema rather than the sample")
+	assert.Equal(t, ".resource.spec.tag is not in the schema of the resource", findings[0].Message)
+}
+
+func TestBundlesInjection(t *testing.T) {
+	sample := newSample()
+	_ = unstructured.SetNestedField(sample.Object, "agent:1\nprivileged: true", "spec", "image")
+	bundle := newBundle(t, map[string]string{
+		"/bundle/a.yaml": "kind: Pod\nimage: {{ .resource.spec.image }}\n",
+	})
+
+	findings, err := Bundles(v1.IntegrationSpec{}, []Bundle{bundle}, Options{Sample: sample})
+	require.NoError(t, err)
+	assert.Equal(t, []string{CheckInjection}, checks(findings))
+}
+
+func TestBundlesDuplicateNames(t *testing.T) {
+	templates := newBundle(t, map[string]string{
+		"/bundle/a.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .resource.metadata.name }}\n  namespace: default\n",
+		"/bundle/b.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .resource.metadata.name }}\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: agent\n  namespace: default\n",
+	})
+	overlays := newBundle(t, map[string]string{
+		"/bundle/overlay.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: agent\n  namespace: default\n",
+	})
+	overlays.Operation = "overlay"
+
+	findings, err := Bundles(v1.IntegrationSpec{}, []Bundle{templates, overlays}, Options{Sample: newSample()})
+	require.NoError(t, err)
+	require.Len(t, findings, 1, "overlays patch the objects of the templates")
+	assert.Equal(t, Finding{Path: "/bundle/b.yaml", Check: CheckDuplicateName, Message: "Service default/agent is also rendered by /bundle/a.yaml"}, findings[0])
+}
+
+func TestBundlesRenderWithoutCluster(t *testing.T) {
+	bundle := newBundle(t, map[string]string{
+		"/bundle/a.yaml": `{{- $accelerator := selectAccelerator .k8sClient (list (dict "acceleratorType" "nvidia-l4" "performanceStats" (dict "outputTokensPerSecond" 100))) }}
+accelerator: {{ $accelerator.acceleratorType }}
+monitoring: {{ .monitoring }}
+values: {{ .values.replicas | default 1 }}
+`,
+	})
+
+	findings, err := Bundles(v1.IntegrationSpec{}, []Bundle{bundle}, Options{Sample: newSample()})
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+}
@@ -0,0 +1,81 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// Check asks the API server, with a SelfSubjectAccessReview per verb, which
+// of the permissions the user of c lacks in each of namespaces. An empty
+// namespace checks cluster-wide permissions. Every authenticated user may
+// create SelfSubjectAccessReviews, so no permission is needed for the check
+// itself. The missing permissions are sorted by namespace, group and
+// resource.
+func Check(ctx context.Context, c client.Client, p Permissions, namespaces []string) ([]modelv1.IntegrationPermission, error) {
+	resources := make([]schema.GroupResource, 0, len(p))
+	for resource := range p {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Resource < resources[j].Resource
+	})
+
+	var missing []modelv1.IntegrationPermission
+	for _, namespace := range sets.List(sets.New(namespaces...)) {
+		for _, resource := range resources {
+			name, subresource, _ := strings.Cut(resource.Resource, "/")
+			var denied []string
+			for _, verb := range sets.List(p[resource]) {
+				review := &authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+						ResourceAttributes: &authorizationv1.ResourceAttributes{
+							Namespace:   namespace,
+							Verb:        verb,
+							Group:       resource.Group,
+							Resource:    name,
+							Subresource: subresource,
+						},
+					},
+				}
+				if err := c.Create(ctx, review); err != nil {
+					return nil, fmt.Errorf("unable to review %s on %s: %w", verb, resource, err)
+				}
+				if !review.Status.Allowed {
+					denied = append(denied, verb)
+				}
+			}
+			if len(denied) > 0 {
+				missing = append(missing, modelv1.IntegrationPermission{
+					Group:     resource.Group,
+					Resource:  resource.Resource,
+					Namespace: namespace,
+					Verbs:     denied,
+				})
+			}
+		}
+	}
+	return missing, nil
+}
+
+// Describe returns a permission as e.g. "create,delete deployments.apps in
+// team-a".
+func Describe(permission modelv1.IntegrationPermission) string {
+	resource := schema.GroupResource{Group: permission.Group, Resource: permission.Resource}.String()
+	scope := "cluster-wide"
+	if permission.Namespace != "" {
+		scope = "in " + permission.Namespace
+	}
+	return fmt.Sprintf("%s %s %s", strings.Join(permission.Verbs, ","), resource, scope)
+}
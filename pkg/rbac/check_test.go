@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// reviewingClient answers SelfSubjectAccessReviews, allowing the attributes
+// formatted as namespace/group/resource/subresource/verb in allowed.
+func reviewingClient(allowed ...string) client.Client {
+	granted := sets.New(allowed...)
+	return fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+			if !ok {
+				return c.Create(ctx, obj, opts...)
+			}
+			attrs := review.Spec.ResourceAttributes
+			review.Status.Allowed = granted.Has(attrs.Namespace + "/" + attrs.Group + "/" + attrs.Resource + "/" + attrs.Subresource + "/" + attrs.Verb)
+			return nil
+		},
+	}).Build()
+}
+
+func TestCheck(t *testing.T) {
+	p := Permissions{}
+	p.Allow(schema.GroupResource{Group: "apps", Resource: "deployments"}, "get", "create")
+	p.Allow(schema.GroupResource{Group: "apps", Resource: "deployments/status"}, "update")
+	p.Allow(schema.GroupResource{Resource: "services"}, "get")
+
+	c := reviewingClient(
+		"team-a/apps/deployments//get",
+		"team-a/apps/deployments/status/update",
+		"team-b/apps/deployments//get",
+		"team-b/apps/deployments//create",
+		"team-b//services//get",
+	)
+	missing, err := Check(context.Background(), c, p, []string{"team-b", "team-a", "team-a"})
+	require.NoError(t, err)
+	assert.Equal(t, []modelv1.IntegrationPermission{
+		{Resource: "services", Namespace: "team-a", Verbs: []string{"get"}},
+		{Group: "apps", Resource: "deployments", Namespace: "team-a", Verbs: []string{"create"}},
+		{Group: "apps", Resource: "deployments/status", Namespace: "team-b", Verbs: []string{"update"}},
+	}, missing)
+}
+
+func TestCheckClusterWide(t *testing.T) {
+	p := Permissions{}
+	p.Allow(schema.GroupResource{Group: "apps", Resource: "deployments"}, "get")
+
+	missing, err := Check(context.Background(), reviewingClient("/apps/deployments//get"), p, []string{""})
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestCheckReviewError(t *testing.T) {
+	p := Permissions{}
+	p.Allow(schema.GroupResource{Group: "apps", Resource: "deployments"}, "get")
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			return errors.New("connection refused")
+		},
+	}).Build()
+
+	_, err := Check(context.Background(), c, p, []string{""})
+	assert.ErrorContains(t, err, "unable to review get on deployments.apps")
+}
+
+func TestDescribe(t *testing.T) {
+	assert.Equal(t, "create,delete deployments.apps in team-a", Describe(modelv1.IntegrationPermission{Group: "apps", Resource: "deployments", Namespace: "team-a", Verbs: []string{"create", "delete"}}))
+	assert.Equal(t, "get agentsandboxclasses.model.skippy.io cluster-wide", Describe(modelv1.IntegrationPermission{Group: "model.skippy.io", Resource: "agentsandboxclasses", Verbs: []string{"get"}}))
+}
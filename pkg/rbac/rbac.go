@@ -0,0 +1,148 @@
+// Package rbac computes the permissions that the operator needs to reconcile
+// the resources of a set of integrations, and renders them as Roles for
+// operators that run namespace-scoped.
+package rbac
+
+import (
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+var (
+	// ReadVerbs are needed on referenced resources.
+	ReadVerbs = []string{"get", "list", "watch"}
+	// ManageVerbs are needed on rendered dependents.
+	ManageVerbs = []string{"create", "delete", "get", "list", "patch", "update", "watch"}
+)
+
+// Permissions holds the verbs needed on each resource.
+type Permissions map[schema.GroupResource]sets.Set[string]
+
+// Allow adds verbs on a resource, e.g. "deployments" or "deployments/status".
+func (p Permissions) Allow(resource schema.GroupResource, verbs ...string) {
+	if p[resource] == nil {
+		p[resource] = sets.New[string]()
+	}
+	p[resource].Insert(verbs...)
+}
+
+// AllowKind adds verbs on the resource of a kind, see ResourceFor.
+func (p Permissions) AllowKind(mapper meta.RESTMapper, gvk schema.GroupVersionKind, verbs ...string) {
+	p.Allow(ResourceFor(mapper, gvk), verbs...)
+}
+
+// ResourceFor returns the resource of a kind, e.g. apps/deployments for
+// apps/v1 Deployment, as mapper maps it. The resource name is guessed from the
+// kind if mapper is nil or the cluster does not serve the kind, e.g. before
+// its CRD is installed.
+func ResourceFor(mapper meta.RESTMapper, gvk schema.GroupVersionKind) schema.GroupResource {
+	if mapper != nil {
+		if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			return mapping.Resource.GroupResource()
+		}
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.GroupResource()
+}
+
+// Rules returns the permissions as policy rules, combining the resources of a
+// group that need the same verbs.
+func (p Permissions) Rules() []rbacv1.PolicyRule {
+	type ruleKey struct {
+		group string
+		verbs string
+	}
+	resources := map[ruleKey][]string{}
+	for resource, verbs := range p {
+		key := ruleKey{group: resource.Group, verbs: strings.Join(sets.List(verbs), ",")}
+		resources[key] = append(resources[key], resource.Resource)
+	}
+
+	rules := make([]rbacv1.PolicyRule, 0, len(resources))
+	for key, names := range resources {
+		sort.Strings(names)
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{key.group},
+			Resources: names,
+			Verbs:     strings.Split(key.verbs, ","),
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].APIGroups[0] != rules[j].APIGroups[0] {
+			return rules[i].APIGroups[0] < rules[j].APIGroups[0]
+		}
+		return rules[i].Resources[0] < rules[j].Resources[0]
+	})
+	return rules
+}
+
+// ForIntegrations returns the permissions that the operator needs to
+// reconcile the resources of specs, whose templates render objects of the
+// dependents kinds: read its Integrations and record events, update the
+// resources and their status, read the referenced and consumed resources and
+// manage the dependents. The resources of the kinds are looked up with mapper,
+// see ResourceFor.
+func ForIntegrations(mapper meta.RESTMapper, specs []modelv1.IntegrationSpec, dependents []schema.GroupVersionKind) Permissions {
+	p := Permissions{}
+	p.Allow(schema.GroupResource{Group: modelv1.GroupVersion.Group, Resource: "integrations"}, ReadVerbs...)
+	p.Allow(schema.GroupResource{Group: modelv1.GroupVersion.Group, Resource: "integrations/status"}, "get", "patch", "update")
+	p.Allow(schema.GroupResource{Group: modelv1.GroupVersion.Group, Resource: "integrations/finalizers"}, "update")
+	p.Allow(schema.GroupResource{Resource: "events"}, "create", "patch")
+	p.Allow(schema.GroupResource{Group: "events.k8s.io", Resource: "events"}, "create", "patch")
+
+	for _, spec := range specs {
+		target := ResourceFor(mapper, schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind})
+		p.Allow(target, "get", "list", "patch", "update", "watch")
+		p.Allow(schema.GroupResource{Group: target.Group, Resource: target.Resource + "/status"}, "get", "patch", "update")
+		p.Allow(schema.GroupResource{Group: target.Group, Resource: target.Resource + "/finalizers"}, "update")
+		for _, ref := range spec.References {
+			p.AllowKind(mapper, schema.GroupVersionKind{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}, ReadVerbs...)
+		}
+		for _, consume := range spec.Consumes {
+			p.AllowKind(mapper, schema.GroupVersionKind{Group: consume.Group, Version: consume.Version, Kind: consume.Kind}, ReadVerbs...)
+			for _, dependent := range consume.Dependents {
+				p.AllowKind(mapper, schema.GroupVersionKind{Group: dependent.Group, Version: dependent.Version, Kind: dependent.Kind}, ReadVerbs...)
+			}
+		}
+	}
+	for _, gvk := range dependents {
+		p.AllowKind(mapper, gvk, ManageVerbs...)
+	}
+	return p
+}
+
+// NamespacedRoles returns a Role named name with rules, and a RoleBinding of
+// the Role to serviceAccount, in each of namespaces.
+func NamespacedRoles(name string, serviceAccount types.NamespacedName, namespaces []string, rules []rbacv1.PolicyRule) []client.Object {
+	var objs []client.Object
+	for _, namespace := range namespaces {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Rules:      rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+				Subjects: []rbacv1.Subject{{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      serviceAccount.Name,
+					Namespace: serviceAccount.Namespace,
+				}},
+			},
+		)
+	}
+	return objs
+}
@@ -0,0 +1,77 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestForIntegrations(t *testing.T) {
+	specs := []modelv1.IntegrationSpec{{
+		Group: "model.skippy.io", Version: "v1", Kind: "Agent",
+		References: []modelv1.IntegrationApiReferenceSpec{{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"}},
+	}}
+	dependents := []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Version: "v1", Kind: "Service"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	}
+
+	rules := ForIntegrations(nil, specs, dependents).Rules()
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: ManageVerbs},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: ManageVerbs},
+		{APIGroups: []string{"events.k8s.io"}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+		{APIGroups: []string{"model.skippy.io"}, Resources: []string{"agents"}, Verbs: []string{"get", "list", "patch", "update", "watch"}},
+		{APIGroups: []string{"model.skippy.io"}, Resources: []string{"agents/finalizers", "integrations/finalizers"}, Verbs: []string{"update"}},
+		{APIGroups: []string{"model.skippy.io"}, Resources: []string{"agents/status", "integrations/status"}, Verbs: []string{"get", "patch", "update"}},
+		{APIGroups: []string{"model.skippy.io"}, Resources: []string{"integrations", "modeldatas"}, Verbs: ReadVerbs},
+	}, rules)
+}
+
+func TestPermissionsMergeVerbs(t *testing.T) {
+	p := Permissions{}
+	p.AllowKind(nil, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, "get")
+	p.AllowKind(nil, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, "list", "get")
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+	}, p.Rules())
+}
+
+func TestResourceFor(t *testing.T) {
+	// The plural of a CRD need not be the guessed one.
+	modelData := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.AddSpecific(modelData, modelData.GroupVersion().WithResource("modeldata"), modelData.GroupVersion().WithResource("modeldatum"), meta.RESTScopeNamespace)
+
+	assert.Equal(t, schema.GroupResource{Group: "model.skippy.io", Resource: "modeldata"}, ResourceFor(mapper, modelData))
+	// Kinds that the cluster does not serve, or all kinds without a mapper,
+	// are guessed.
+	assert.Equal(t, schema.GroupResource{Group: "apps", Resource: "deployments"}, ResourceFor(mapper, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+	assert.Equal(t, schema.GroupResource{Group: "model.skippy.io", Resource: "modeldatas"}, ResourceFor(nil, modelData))
+}
+
+func TestNamespacedRoles(t *testing.T) {
+	rules := []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: ReadVerbs}}
+	objs := NamespacedRoles("karo", types.NamespacedName{Namespace: "karo-system", Name: "manager"}, []string{"team-a", "team-b"}, rules)
+	require.Len(t, objs, 4)
+
+	role, ok := objs[2].(*rbacv1.Role)
+	require.True(t, ok)
+	assert.Equal(t, "team-b", role.Namespace)
+	assert.Equal(t, rules, role.Rules)
+
+	binding, ok := objs[3].(*rbacv1.RoleBinding)
+	require.True(t, ok)
+	assert.Equal(t, "team-b", binding.Namespace)
+	assert.Equal(t, rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "karo"}, binding.RoleRef)
+	assert.Equal(t, []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "manager", Namespace: "karo-system"}}, binding.Subjects)
+}
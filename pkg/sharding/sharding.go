@@ -0,0 +1,301 @@
+// Package sharding spreads the reconciliation of custom resources across
+// operator replicas. Each replica announces itself with a Lease, and owns the
+// resources whose namespace/name hash, modulo the number of live replicas,
+// is its index among them.
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// GroupLabel on a Lease names the shard group that the replica holding it
+// belongs to.
+const GroupLabel = "model.skippy.io/shard-group"
+
+const (
+	// DefaultLeaseDuration is how long a replica that stops renewing its
+	// Lease keeps its shard.
+	DefaultLeaseDuration = 15 * time.Second
+	// DefaultRenewInterval is how often a replica renews its Lease and
+	// refreshes the members of its group.
+	DefaultRenewInterval = 5 * time.Second
+)
+
+var (
+	shardMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "karo_shard_members",
+		Help: "The number of live replicas in the shard group of this replica.",
+	})
+	shardIndex = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "karo_shard_index",
+		Help: "The shard that this replica owns, -1 before it has joined its group.",
+	})
+	shardRebalances = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "karo_shard_rebalances_total",
+		Help: "Changes to the members of the shard group seen by this replica.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(shardMembers, shardIndex, shardRebalances)
+	shardIndex.Set(-1)
+}
+
+// Options configure a Sharder.
+type Options struct {
+	// Namespace holds the Leases of the group.
+	Namespace string
+	// Group names the shard group. The Leases of its replicas are named
+	// <Group>-<Identity>.
+	Group string
+	// Identity is unique to the replica, usually its pod name.
+	Identity string
+	// LeaseDuration defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// RenewInterval defaults to DefaultRenewInterval.
+	RenewInterval time.Duration
+}
+
+// Sharder holds the Lease of a replica and the members of its shard group.
+// It implements manager.Runnable, and runs on every replica.
+type Sharder struct {
+	client  client.Client
+	reader  client.Reader
+	options Options
+	now     func() time.Time
+
+	mu          sync.RWMutex
+	members     []string
+	index       int
+	subscribers []chan struct{}
+	// renewed is when the Lease was last renewed.
+	renewed time.Time
+}
+
+// New returns a Sharder that writes its Lease with c and reads the Leases of
+// its group with reader, usually the uncached API reader of the manager, so
+// that no informer is started for Leases.
+func New(c client.Client, reader client.Reader, options Options) (*Sharder, error) {
+	if options.Namespace == "" || options.Group == "" || options.Identity == "" {
+		return nil, fmt.Errorf("sharding needs a namespace, group and identity, got %q, %q and %q", options.Namespace, options.Group, options.Identity)
+	}
+	if options.LeaseDuration <= 0 {
+		options.LeaseDuration = DefaultLeaseDuration
+	}
+	if options.RenewInterval <= 0 {
+		options.RenewInterval = DefaultRenewInterval
+	}
+	if options.RenewInterval >= options.LeaseDuration {
+		return nil, fmt.Errorf("the renew interval %s must be shorter than the lease duration %s", options.RenewInterval, options.LeaseDuration)
+	}
+	return &Sharder{client: c, reader: reader, options: options, now: time.Now, index: -1}, nil
+}
+
+// Shard returns the shard of a resource among shards.
+func Shard(key types.NamespacedName, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key.Namespace + "/" + key.Name))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// Owns reports whether this replica reconciles the resource. It owns none
+// until it has joined its group.
+func (s *Sharder) Owns(key types.NamespacedName) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index < 0 {
+		return false
+	}
+	return Shard(key, len(s.members)) == s.index
+}
+
+// Members returns the identities of the live replicas of the group, sorted.
+func (s *Sharder) Members() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.members...)
+}
+
+// Subscribe returns a channel that receives a value whenever the members of
+// the group change, so that the subscriber can pick up the resources that
+// this replica now owns. A subscriber that falls behind only receives one
+// value for several changes.
+func (s *Sharder) Subscribe() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica holds a shard.
+func (s *Sharder) NeedLeaderElection() bool {
+	return false
+}
+
+// Start renews the Lease of the replica and refreshes the members of its
+// group until ctx is done, then deletes the Lease so that the other replicas
+// take over its shard without waiting for it to expire.
+func (s *Sharder) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("shardGroup", s.options.Group, "identity", s.options.Identity)
+	ticker := time.NewTicker(s.options.RenewInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx, logger); err != nil {
+			logger.Error(err, "Failed to sync shard membership")
+		}
+		select {
+		case <-ctx.Done():
+			s.release(logger)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync renews the Lease of the replica and refreshes the members of its
+// group. A replica that could not renew its Lease for the lease duration
+// gives up its shard, as the other replicas take it over by then.
+func (s *Sharder) Sync(ctx context.Context, logger logr.Logger) error {
+	if err := s.renew(ctx); err != nil {
+		s.expire(logger)
+		return err
+	}
+	leases := &coordinationv1.LeaseList{}
+	if err := s.reader.List(ctx, leases, client.InNamespace(s.options.Namespace), client.MatchingLabels{GroupLabel: s.options.Group}); err != nil {
+		return fmt.Errorf("unable to list the leases of shard group %q: %w", s.options.Group, err)
+	}
+	now := s.now()
+	var members []string
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if expiry.After(now) || *lease.Spec.HolderIdentity == s.options.Identity {
+			members = append(members, *lease.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+	s.setMembers(logger, members)
+	return nil
+}
+
+// renew creates or updates the Lease of the replica.
+func (s *Sharder) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(s.now())
+	identity := s.options.Identity
+	duration := int32(s.options.LeaseDuration / time.Second)
+	lease := &coordinationv1.Lease{}
+	key := client.ObjectKey{Namespace: s.options.Namespace, Name: s.leaseName()}
+	err := s.reader.Get(ctx, key, lease)
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{GroupLabel: s.options.Group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err := s.client.Create(ctx, lease); err != nil {
+			return fmt.Errorf("unable to create lease %s: %w", key, err)
+		}
+		s.setRenewed(now.Time)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get lease %s: %w", key, err)
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	if err := s.client.Update(ctx, lease); err != nil {
+		return fmt.Errorf("unable to renew lease %s: %w", key, err)
+	}
+	s.setRenewed(now.Time)
+	return nil
+}
+
+func (s *Sharder) setRenewed(renewed time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renewed = renewed
+}
+
+// expire drops the shard of the replica if its Lease expired, until it is
+// renewed again.
+func (s *Sharder) expire(logger logr.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index < 0 || s.now().Sub(s.renewed) < s.options.LeaseDuration {
+		return
+	}
+	s.index = -1
+	logger.Info("Shard lease expired, reconciling no resources until it is renewed", "renewed", s.renewed)
+	shardIndex.Set(-1)
+}
+
+// release deletes the Lease of the replica.
+func (s *Sharder) release(logger logr.Logger) {
+	// The manager's context is done, so a new one bounds the deletion.
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.RenewInterval)
+	defer cancel()
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: s.options.Namespace, Name: s.leaseName()}}
+	if err := s.client.Delete(ctx, lease); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to release shard lease")
+	}
+}
+
+func (s *Sharder) leaseName() string {
+	return s.options.Group + "-" + s.options.Identity
+}
+
+// setMembers stores the members of the group and notifies the subscribers if
+// they changed.
+func (s *Sharder) setMembers(logger logr.Logger, members []string) {
+	index := sort.SearchStrings(members, s.options.Identity)
+
+	s.mu.Lock()
+	changed := !slices.Equal(s.members, members) || s.index != index
+	s.members = members
+	s.index = index
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	logger.Info("Shard group changed", "members", members, "shard", index, "shards", len(members))
+	shardMembers.Set(float64(len(members)))
+	shardIndex.Set(float64(index))
+	shardRebalances.Inc()
+	for _, ch := range subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
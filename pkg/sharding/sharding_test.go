@@ -0,0 +1,157 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newTestSharder(t *testing.T, c client.Client, identity string, now *time.Time) *Sharder {
+	s, err := New(c, c, Options{Namespace: "karo-system", Group: "karo", Identity: identity})
+	require.NoError(t, err)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	_, err := New(nil, nil, Options{Namespace: "karo-system", Group: "karo"})
+	assert.ErrorContains(t, err, "needs a namespace, group and identity")
+
+	_, err = New(nil, nil, Options{Namespace: "karo-system", Group: "karo", Identity: "a", LeaseDuration: time.Second, RenewInterval: 2 * time.Second})
+	assert.ErrorContains(t, err, "must be shorter than the lease duration")
+}
+
+func TestShardIsStable(t *testing.T) {
+	key := types.NamespacedName{Namespace: "team-a", Name: "llama"}
+	assert.Equal(t, Shard(key, 3), Shard(key, 3))
+	assert.Equal(t, 0, Shard(key, 1))
+}
+
+func TestSyncSplitsResourcesAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := fake.NewClientBuilder().Build()
+	a := newTestSharder(t, c, "karo-a", &now)
+	b := newTestSharder(t, c, "karo-b", &now)
+
+	// A replica owns nothing before it has joined its group.
+	key := types.NamespacedName{Namespace: "default", Name: "agent-0"}
+	assert.False(t, a.Owns(key))
+
+	changes := a.Subscribe()
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	assert.Equal(t, []string{"karo-a"}, a.Members())
+	assert.True(t, a.Owns(key))
+	assert.Len(t, changes, 1)
+	<-changes
+
+	require.NoError(t, b.Sync(ctx, logr.Discard()))
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	assert.Equal(t, []string{"karo-a", "karo-b"}, a.Members())
+	assert.Equal(t, []string{"karo-a", "karo-b"}, b.Members())
+	assert.Len(t, changes, 1)
+
+	owned := map[string]int{}
+	for i := 0; i < 100; i++ {
+		key := types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("agent-%d", i)}
+		if a.Owns(key) {
+			owned["karo-a"]++
+		}
+		if b.Owns(key) {
+			owned["karo-b"]++
+		}
+	}
+	assert.Equal(t, 100, owned["karo-a"]+owned["karo-b"], "every resource has exactly one owner")
+	assert.NotZero(t, owned["karo-a"])
+	assert.NotZero(t, owned["karo-b"])
+
+	lease := &coordinationv1.Lease{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "karo-system", Name: "karo-karo-b"}, lease))
+	assert.Equal(t, "karo", lease.Labels[GroupLabel])
+	assert.Equal(t, "karo-b", *lease.Spec.HolderIdentity)
+}
+
+func TestSyncDropsExpiredReplicas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := fake.NewClientBuilder().Build()
+	a := newTestSharder(t, c, "karo-a", &now)
+	b := newTestSharder(t, c, "karo-b", &now)
+	require.NoError(t, b.Sync(ctx, logr.Discard()))
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	assert.Equal(t, []string{"karo-a", "karo-b"}, a.Members())
+
+	// karo-b stops renewing its Lease.
+	now = now.Add(DefaultLeaseDuration + time.Second)
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	assert.Equal(t, []string{"karo-a"}, a.Members())
+	assert.True(t, a.Owns(types.NamespacedName{Namespace: "default", Name: "agent-0"}))
+}
+
+func TestSyncDropsShardWhenLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	failing := false
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if failing {
+				return fmt.Errorf("connection refused")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	a := newTestSharder(t, c, "karo-a", &now)
+	changes := a.Subscribe()
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	<-changes
+	key := types.NamespacedName{Namespace: "default", Name: "agent-0"}
+	require.True(t, a.Owns(key))
+
+	// The API server cannot be reached, but the Lease has not expired yet.
+	failing = true
+	now = now.Add(DefaultRenewInterval)
+	require.Error(t, a.Sync(ctx, logr.Discard()))
+	assert.True(t, a.Owns(key))
+
+	now = now.Add(DefaultLeaseDuration)
+	require.Error(t, a.Sync(ctx, logr.Discard()))
+	assert.False(t, a.Owns(key), "the other replicas took over the shard")
+
+	// The shard is taken back, and subscribers are notified, once the Lease is renewed.
+	failing = false
+	require.NoError(t, a.Sync(ctx, logr.Discard()))
+	assert.True(t, a.Owns(key))
+	select {
+	case <-changes:
+	default:
+		t.Error("subscribers were not notified")
+	}
+}
+
+func TestStartReleasesLease(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := fake.NewClientBuilder().Build()
+	a := newTestSharder(t, c, "karo-a", &now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	changes := a.Subscribe()
+	go func() { done <- a.Start(ctx) }()
+	<-changes
+	cancel()
+	require.NoError(t, <-done)
+
+	err := c.Get(context.Background(), client.ObjectKey{Namespace: "karo-system", Name: "karo-karo-a"}, &coordinationv1.Lease{})
+	assert.True(t, errors.IsNotFound(err), "expected the lease to be deleted, got %v", err)
+}
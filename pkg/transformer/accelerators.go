@@ -0,0 +1,200 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// AcceleratorAnnotation is set by templates on the workload that uses the
+	// accelerator returned by selectAccelerator.
+	AcceleratorAnnotation = "model.skippy.io/accelerator"
+	// AcceleratorRationaleAnnotation explains why the accelerator was chosen.
+	AcceleratorRationaleAnnotation = "model.skippy.io/accelerator-rationale"
+
+	gkeAcceleratorLabel    = "cloud.google.com/gke-accelerator"
+	gkeTPUAcceleratorLabel = "cloud.google.com/gke-tpu-accelerator"
+
+	sourceNodes              = "nodes"
+	sourceAutoProvisioning   = "auto-provisioning"
+	sourceDynamicAllocations = "resource-slices"
+)
+
+var (
+	nodesGVR          = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	computeClassesGVR = schema.GroupVersionResource{Group: "cloud.google.com", Version: "v1", Resource: "computeclasses"}
+	resourceSlicesGVR = schema.GroupVersionResource{Group: "resource.k8s.io", Version: "v1beta1", Resource: "resourceslices"}
+)
+
+// acceleratorInventory returns the accelerator types the cluster can schedule,
+// mapped to where they were found: labels of nodes with allocatable devices,
+// ComputeClasses that let GKE auto-provision node pools, and DRA ResourceSlices.
+func acceleratorInventory(ctx context.Context, dynClient dynamic.Interface) (map[string]string, error) {
+	inventory := map[string]string{}
+
+	nodes, err := dynClient.Resource(nodesGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		labels := node.GetLabels()
+		if accelerator := labels[gkeAcceleratorLabel]; accelerator != "" && hasAllocatable(&node, "nvidia.com/gpu") {
+			inventory[accelerator] = sourceNodes
+		}
+		if accelerator := labels[gkeTPUAcceleratorLabel]; accelerator != "" && hasAllocatable(&node, "google.com/tpu") {
+			inventory[accelerator] = sourceNodes
+		}
+	}
+
+	// The optional APIs below are skipped if the cluster does not serve them.
+	computeClasses, err := dynClient.Resource(computeClassesGVR).List(ctx, metav1.ListOptions{})
+	if err != nil && !isMissingAPI(err) {
+		return nil, fmt.Errorf("failed to list ComputeClasses: %w", err)
+	}
+	if computeClasses != nil {
+		for _, computeClass := range computeClasses.Items {
+			if enabled, _, _ := unstructured.NestedBool(computeClass.Object, "spec", "nodePoolAutoCreation", "enabled"); !enabled {
+				continue
+			}
+			priorities, _, _ := unstructured.NestedSlice(computeClass.Object, "spec", "priorities")
+			for _, rawPriority := range priorities {
+				priority, _ := rawPriority.(map[string]interface{})
+				for _, path := range [][]string{{"gpu", "type"}, {"tpu", "type"}} {
+					if accelerator, _, _ := unstructured.NestedString(priority, path...); accelerator != "" {
+						if _, found := inventory[accelerator]; !found {
+							inventory[accelerator] = sourceAutoProvisioning
+						}
+					}
+				}
+			}
+		}
+	}
+
+	resourceSlices, err := dynClient.Resource(resourceSlicesGVR).List(ctx, metav1.ListOptions{})
+	if err != nil && !isMissingAPI(err) {
+		return nil, fmt.Errorf("failed to list ResourceSlices: %w", err)
+	}
+	if resourceSlices != nil {
+		for _, slice := range resourceSlices.Items {
+			devices, _, _ := unstructured.NestedSlice(slice.Object, "spec", "devices")
+			for _, rawDevice := range devices {
+				device, _ := rawDevice.(map[string]interface{})
+				productName, _, _ := unstructured.NestedString(device, "basic", "attributes", "productName", "string")
+				if productName == "" {
+					continue
+				}
+				accelerator := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(productName)), " ", "-")
+				if _, found := inventory[accelerator]; !found {
+					inventory[accelerator] = sourceDynamicAllocations
+				}
+			}
+		}
+	}
+	return inventory, nil
+}
+
+// isMissingAPI reports whether a list call failed because the API is not
+// served by the cluster.
+func isMissingAPI(err error) bool {
+	return errors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
+
+func hasAllocatable(node *unstructured.Unstructured, resourceName string) bool {
+	value, found, _ := unstructured.NestedString(node.Object, "status", "allocatable", resourceName)
+	return found && value != "" && value != "0"
+}
+
+// findInInventory returns the source of an accelerator type. Device product
+// names from ResourceSlices are often more specific than GKE accelerator names
+// (e.g. "nvidia-h100-80gb-hbm3" for "nvidia-h100-80gb"), so prefixes match too.
+func findInInventory(inventory map[string]string, accelerator string) (string, bool) {
+	if source, ok := inventory[accelerator]; ok {
+		return source, true
+	}
+	for available, source := range inventory {
+		if source == sourceDynamicAllocations && strings.HasPrefix(available, accelerator) {
+			return source, true
+		}
+	}
+	return "", false
+}
+
+// filterSchedulable returns the options whose accelerator type is in the
+// inventory.
+func filterSchedulable(inventory map[string]string, options []interface{}) []interface{} {
+	var result []interface{}
+	for _, option := range options {
+		opt, ok := option.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		accelerator, _ := opt["acceleratorType"].(string)
+		if _, ok := findInInventory(inventory, accelerator); ok {
+			result = append(result, opt)
+		}
+	}
+	return result
+}
+
+// schedulableAccelerators filters recommender options down to the accelerator
+// types the cluster can actually schedule.
+func schedulableAccelerators(ctx context.Context, dynClient dynamic.Interface, options []interface{}) ([]interface{}, error) {
+	inventory, err := acceleratorInventory(ctx, dynClient)
+	if err != nil {
+		return nil, err
+	}
+	return filterSchedulable(inventory, options), nil
+}
+
+// selectAccelerator picks the recommender option with the lowest performance
+// (see minPerformanceAccelerator) among those the cluster can schedule. The
+// returned option is a copy with an added "rationale" key, meant to be written
+// to the AcceleratorRationaleAnnotation so that it is reported in status.
+func selectAccelerator(ctx context.Context, dynClient dynamic.Interface, options []interface{}) (map[string]interface{}, error) {
+	inventory, err := acceleratorInventory(ctx, dynClient)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := filterSchedulable(inventory, options)
+	best := minPerformanceAccelerator(candidates)
+	if best == nil {
+		available := make([]string, 0, len(inventory))
+		for accelerator := range inventory {
+			available = append(available, accelerator)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("none of the %d recommended accelerators can be scheduled in this cluster (available: %s)", len(options), strings.Join(available, ", "))
+	}
+
+	selected := make(map[string]interface{}, len(best)+1)
+	for k, v := range best {
+		selected[k] = v
+	}
+	accelerator, _ := best["acceleratorType"].(string)
+	source, _ := findInInventory(inventory, accelerator)
+	selected["rationale"] = fmt.Sprintf("%s is the lowest-performance match of %d schedulable out of %d recommended accelerators (capacity from %s)", accelerator, len(candidates), len(options), source)
+	return selected, nil
+}
+
+// computeClassPriority returns a GKE ComputeClass priority rule that provisions
+// nodes with count accelerators of the given type, e.g. for the accelerator
+// returned by selectAccelerator. TPU types start with "tpu-".
+func computeClassPriority(accelerator string, count int) map[string]interface{} {
+	family := "gpu"
+	if strings.HasPrefix(accelerator, "tpu-") {
+		family = "tpu"
+	}
+	return map[string]interface{}{
+		family: map[string]interface{}{"type": accelerator, "count": count},
+	}
+}
@@ -0,0 +1,127 @@
+package transformer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newAcceleratorNode(name, label, accelerator, resourceName, allocatable string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{label: accelerator},
+		},
+		"status": map[string]interface{}{
+			"allocatable": map[string]interface{}{resourceName: allocatable},
+		},
+	}}
+}
+
+func newAcceleratorClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		nodesGVR:          "NodeList",
+		computeClassesGVR: "ComputeClassList",
+		resourceSlicesGVR: "ResourceSliceList",
+	}, objs...)
+}
+
+func acceleratorOption(accelerator string, outputTokensPerSecond int) interface{} {
+	return map[string]interface{}{
+		"acceleratorType":  accelerator,
+		"performanceStats": map[string]interface{}{"outputTokensPerSecond": outputTokensPerSecond},
+	}
+}
+
+func TestAcceleratorInventory(t *testing.T) {
+	computeClass := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cloud.google.com/v1",
+		"kind":       "ComputeClass",
+		"metadata":   map[string]interface{}{"name": "gpus"},
+		"spec": map[string]interface{}{
+			"nodePoolAutoCreation": map[string]interface{}{"enabled": true},
+			"priorities": []interface{}{
+				map[string]interface{}{"gpu": map[string]interface{}{"type": "nvidia-h100-80gb", "count": int64(8)}},
+				map[string]interface{}{"tpu": map[string]interface{}{"type": "tpu-v5-lite-podslice"}},
+			},
+		},
+	}}
+	resourceSlice := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "resource.k8s.io/v1beta1",
+		"kind":       "ResourceSlice",
+		"metadata":   map[string]interface{}{"name": "node-a-gpu"},
+		"spec": map[string]interface{}{
+			"devices": []interface{}{
+				map[string]interface{}{"name": "gpu-0", "basic": map[string]interface{}{
+					"attributes": map[string]interface{}{"productName": map[string]interface{}{"string": "NVIDIA A100 80GB PCIe"}},
+				}},
+			},
+		},
+	}}
+	client := newAcceleratorClient(
+		newAcceleratorNode("l4-node", gkeAcceleratorLabel, "nvidia-l4", "nvidia.com/gpu", "1"),
+		newAcceleratorNode("drained-node", gkeAcceleratorLabel, "nvidia-tesla-t4", "nvidia.com/gpu", "0"),
+		computeClass,
+		resourceSlice,
+	)
+
+	inventory, err := acceleratorInventory(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"nvidia-l4":             sourceNodes,
+		"nvidia-h100-80gb":      sourceAutoProvisioning,
+		"tpu-v5-lite-podslice":  sourceAutoProvisioning,
+		"nvidia-a100-80gb-pcie": sourceDynamicAllocations,
+	}, inventory)
+
+	source, ok := findInInventory(inventory, "nvidia-a100-80gb")
+	assert.True(t, ok)
+	assert.Equal(t, sourceDynamicAllocations, source)
+	_, ok = findInInventory(inventory, "nvidia-tesla-t4")
+	assert.False(t, ok)
+}
+
+func TestSelectAccelerator(t *testing.T) {
+	options := []interface{}{
+		acceleratorOption("nvidia-tesla-t4", 10),
+		acceleratorOption("nvidia-l4", 40),
+		acceleratorOption("nvidia-h100-80gb", 400),
+	}
+
+	t.Run("skips accelerators the cluster cannot schedule", func(t *testing.T) {
+		client := newAcceleratorClient(
+			newAcceleratorNode("l4-node", gkeAcceleratorLabel, "nvidia-l4", "nvidia.com/gpu", "1"),
+			newAcceleratorNode("h100-node", gkeAcceleratorLabel, "nvidia-h100-80gb", "nvidia.com/gpu", "8"),
+		)
+		selected, err := selectAccelerator(context.Background(), client, options)
+		require.NoError(t, err)
+		assert.Equal(t, "nvidia-l4", selected["acceleratorType"])
+		assert.Equal(t, "nvidia-l4 is the lowest-performance match of 2 schedulable out of 3 recommended accelerators (capacity from nodes)", selected["rationale"])
+		// The recommender payload is not modified.
+		assert.NotContains(t, options[1], "rationale")
+
+		schedulable, err := schedulableAccelerators(context.Background(), client, options)
+		require.NoError(t, err)
+		assert.Equal(t, options[1:], schedulable)
+	})
+
+	t.Run("fails when nothing can be scheduled", func(t *testing.T) {
+		client := newAcceleratorClient(newAcceleratorNode("tpu-node", gkeTPUAcceleratorLabel, "tpu-v6e-slice", "google.com/tpu", "4"))
+		_, err := selectAccelerator(context.Background(), client, options)
+		require.Error(t, err)
+		assert.Equal(t, "none of the 3 recommended accelerators can be scheduled in this cluster (available: tpu-v6e-slice)", err.Error())
+	})
+}
+
+func TestComputeClassPriority(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{"gpu": map[string]interface{}{"type": "nvidia-l4", "count": 2}}, computeClassPriority("nvidia-l4", 2))
+	assert.Equal(t, map[string]interface{}{"tpu": map[string]interface{}{"type": "tpu-v5-lite-podslice", "count": 4}}, computeClassPriority("tpu-v5-lite-podslice", 4))
+}
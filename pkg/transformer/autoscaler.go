@@ -0,0 +1,160 @@
+package transformer
+
+import (
+	"fmt"
+)
+
+const (
+	// AutoscalerHPA renders autoscaling blocks as autoscaling/v2
+	// HorizontalPodAutoscalers.
+	AutoscalerHPA = "HorizontalPodAutoscaler"
+	// AutoscalerKEDA renders autoscaling blocks as keda.sh/v1alpha1
+	// ScaledObjects.
+	AutoscalerKEDA = "KEDA"
+)
+
+// autoscalerFor converts the autoscaling block of a resource into the
+// autoscaler selected by the integration, so that the same template serves
+// clusters with and without KEDA, e.g.
+//
+//	{{ autoscalerFor (StructuralData .autoscaler) (dict "apiVersion" "apps/v1" "kind" "Deployment" "name" $name "namespace" .resource.metadata.namespace) (StructuralData .resource.spec.autoscaling) | toJson }}
+//
+// target names the scaled object; the autoscaler gets the same name and
+// namespace. The block has minReplicas (default 1), maxReplicas and
+// autoscaling/v2 metrics. Resource metrics become cpu and memory triggers of a
+// ScaledObject; other triggers, e.g. prometheus, are set with triggers, which
+// only KEDA uses, as are pollingInterval and cooldownPeriod. A behavior is
+// used by both.
+//
+// The autoscaler and the block decide the structure of the output, so they are
+// passed with StructuralData, which exempts them from the string mutation of
+// the YAML injection check.
+func autoscalerFor(autoscaler string, target, autoscaling map[string]interface{}) (map[string]interface{}, error) {
+	name, _ := target["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("autoscaler target has no name")
+	}
+	if autoscaling == nil {
+		return nil, fmt.Errorf("autoscaling block for %s is empty", name)
+	}
+	maxReplicas, ok := autoscaling["maxReplicas"]
+	if !ok {
+		return nil, fmt.Errorf("autoscaling block for %s has no maxReplicas", name)
+	}
+	minReplicas, ok := autoscaling["minReplicas"]
+	if !ok {
+		minReplicas = 1
+	}
+	metrics, _ := autoscaling["metrics"].([]interface{})
+
+	metadata := map[string]interface{}{"name": name}
+	if namespace, _ := target["namespace"].(string); namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	scaleTargetRef := map[string]interface{}{"name": name}
+	for _, field := range []string{"apiVersion", "kind"} {
+		if value, _ := target[field].(string); value != "" {
+			scaleTargetRef[field] = value
+		}
+	}
+
+	switch autoscaler {
+	case "", AutoscalerHPA:
+		if fmt.Sprintf("%v", minReplicas) == "0" {
+			return nil, fmt.Errorf("autoscaling block for %s scales to zero, which requires the %s autoscaler", name, AutoscalerKEDA)
+		}
+		if len(metrics) == 0 {
+			return nil, fmt.Errorf("autoscaling block for %s has no metrics", name)
+		}
+		spec := map[string]interface{}{
+			"scaleTargetRef": scaleTargetRef,
+			"minReplicas":    minReplicas,
+			"maxReplicas":    maxReplicas,
+			"metrics":        metrics,
+		}
+		if behavior, ok := autoscaling["behavior"]; ok {
+			spec["behavior"] = behavior
+		}
+		return map[string]interface{}{
+			"apiVersion": "autoscaling/v2",
+			"kind":       "HorizontalPodAutoscaler",
+			"metadata":   metadata,
+			"spec":       spec,
+		}, nil
+
+	case AutoscalerKEDA:
+		triggers := make([]interface{}, 0, len(metrics))
+		for _, metric := range metrics {
+			trigger, err := kedaTrigger(metric)
+			if err != nil {
+				return nil, fmt.Errorf("autoscaling block for %s: %w", name, err)
+			}
+			triggers = append(triggers, trigger)
+		}
+		if extra, ok := autoscaling["triggers"].([]interface{}); ok {
+			triggers = append(triggers, extra...)
+		}
+		if len(triggers) == 0 {
+			return nil, fmt.Errorf("autoscaling block for %s has no metrics or triggers", name)
+		}
+		spec := map[string]interface{}{
+			"scaleTargetRef":  scaleTargetRef,
+			"minReplicaCount": minReplicas,
+			"maxReplicaCount": maxReplicas,
+			"triggers":        triggers,
+		}
+		for _, field := range []string{"pollingInterval", "cooldownPeriod"} {
+			if value, ok := autoscaling[field]; ok {
+				spec[field] = value
+			}
+		}
+		if behavior, ok := autoscaling["behavior"]; ok {
+			spec["advanced"] = map[string]interface{}{
+				"horizontalPodAutoscalerConfig": map[string]interface{}{"behavior": behavior},
+			}
+		}
+		return map[string]interface{}{
+			"apiVersion": "keda.sh/v1alpha1",
+			"kind":       "ScaledObject",
+			"metadata":   metadata,
+			"spec":       spec,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown autoscaler %q", autoscaler)
+}
+
+// kedaTrigger converts an autoscaling/v2 Resource metric into the cpu or
+// memory trigger of a ScaledObject. KEDA has no equivalent for the other
+// metric types without knowing their source, so those must be set as triggers.
+func kedaTrigger(metricInterface interface{}) (map[string]interface{}, error) {
+	metric, _ := metricInterface.(map[string]interface{})
+	metricType, _ := metric["type"].(string)
+	if metricType != "Resource" {
+		return nil, fmt.Errorf("%s metrics cannot be converted to KEDA triggers, set them as triggers instead", metricType)
+	}
+	resourceMetric, _ := metric["resource"].(map[string]interface{})
+	resourceName, _ := resourceMetric["name"].(string)
+	if resourceName != "cpu" && resourceName != "memory" {
+		return nil, fmt.Errorf("resource metric %q cannot be converted to a KEDA trigger", resourceName)
+	}
+	target, _ := resourceMetric["target"].(map[string]interface{})
+	targetType, _ := target["type"].(string)
+	var value interface{}
+	switch targetType {
+	case "Utilization":
+		value = target["averageUtilization"]
+	case "AverageValue":
+		value = target["averageValue"]
+	default:
+		return nil, fmt.Errorf("%s target of resource metric %q cannot be converted to a KEDA trigger", targetType, resourceName)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%s target of resource metric %q has no value", targetType, resourceName)
+	}
+	return map[string]interface{}{
+		"type":       resourceName,
+		"metricType": targetType,
+		// Trigger metadata values are strings.
+		"metadata": map[string]interface{}{"value": fmt.Sprintf("%v", value)},
+	}, nil
+}
@@ -0,0 +1,129 @@
+package transformer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	template "github.com/google/safetext/yamltemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoscalerFor(t *testing.T) {
+	target := map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "vllm", "namespace": "ml"}
+	cpu := map[string]interface{}{
+		"type": "Resource",
+		"resource": map[string]interface{}{
+			"name":   "cpu",
+			"target": map[string]interface{}{"type": "Utilization", "averageUtilization": 80},
+		},
+	}
+	prometheus := map[string]interface{}{
+		"type":     "prometheus",
+		"metadata": map[string]interface{}{"query": "sum(vllm:num_requests_waiting)", "threshold": "5"},
+	}
+	behavior := map[string]interface{}{"scaleDown": map[string]interface{}{"stabilizationWindowSeconds": 600}}
+
+	t.Run("HorizontalPodAutoscaler", func(t *testing.T) {
+		hpa, err := autoscalerFor(AutoscalerHPA, target, map[string]interface{}{
+			"maxReplicas": 4,
+			"metrics":     []interface{}{cpu},
+			"triggers":    []interface{}{prometheus},
+			"behavior":    behavior,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"apiVersion": "autoscaling/v2",
+			"kind":       "HorizontalPodAutoscaler",
+			"metadata":   map[string]interface{}{"name": "vllm", "namespace": "ml"},
+			"spec": map[string]interface{}{
+				"scaleTargetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "vllm"},
+				"minReplicas":    1,
+				"maxReplicas":    4,
+				"metrics":        []interface{}{cpu},
+				"behavior":       behavior,
+			},
+		}, hpa)
+	})
+
+	t.Run("KEDA", func(t *testing.T) {
+		scaledObject, err := autoscalerFor(AutoscalerKEDA, target, map[string]interface{}{
+			"minReplicas":     0,
+			"maxReplicas":     4,
+			"metrics":         []interface{}{cpu},
+			"triggers":        []interface{}{prometheus},
+			"cooldownPeriod":  120,
+			"pollingInterval": 15,
+			"behavior":        behavior,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"apiVersion": "keda.sh/v1alpha1",
+			"kind":       "ScaledObject",
+			"metadata":   map[string]interface{}{"name": "vllm", "namespace": "ml"},
+			"spec": map[string]interface{}{
+				"scaleTargetRef":  map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "vllm"},
+				"minReplicaCount": 0,
+				"maxReplicaCount": 4,
+				"triggers": []interface{}{
+					map[string]interface{}{"type": "cpu", "metricType": "Utilization", "metadata": map[string]interface{}{"value": "80"}},
+					prometheus,
+				},
+				"cooldownPeriod":  120,
+				"pollingInterval": 15,
+				"advanced": map[string]interface{}{
+					"horizontalPodAutoscalerConfig": map[string]interface{}{"behavior": behavior},
+				},
+			},
+		}, scaledObject)
+	})
+
+	errorCases := []struct {
+		name        string
+		autoscaler  string
+		target      map[string]interface{}
+		autoscaling map[string]interface{}
+		expectedErr string
+	}{
+		{"no target name", AutoscalerHPA, map[string]interface{}{}, map[string]interface{}{"maxReplicas": 1}, "autoscaler target has no name"},
+		{"no autoscaling block", AutoscalerHPA, target, nil, "autoscaling block for vllm is empty"},
+		{"no max replicas", AutoscalerHPA, target, map[string]interface{}{"metrics": []interface{}{cpu}}, "has no maxReplicas"},
+		{"scale to zero without KEDA", AutoscalerHPA, target, map[string]interface{}{"minReplicas": 0, "maxReplicas": 4, "metrics": []interface{}{cpu}}, "requires the KEDA autoscaler"},
+		{"HPA without metrics", AutoscalerHPA, target, map[string]interface{}{"maxReplicas": 4, "triggers": []interface{}{prometheus}}, "has no metrics"},
+		{"KEDA without triggers", AutoscalerKEDA, target, map[string]interface{}{"maxReplicas": 4}, "has no metrics or triggers"},
+		{"unconvertible metric", AutoscalerKEDA, target, map[string]interface{}{"maxReplicas": 4, "metrics": []interface{}{
+			map[string]interface{}{"type": "External", "external": map[string]interface{}{}},
+		}}, "External metrics cannot be converted to KEDA triggers"},
+		{"unconvertible resource", AutoscalerKEDA, target, map[string]interface{}{"maxReplicas": 4, "metrics": []interface{}{
+			map[string]interface{}{"type": "Resource", "resource": map[string]interface{}{"name": "nvidia.com/gpu"}},
+		}}, `resource metric "nvidia.com/gpu" cannot be converted`},
+		{"unknown autoscaler", "VPA", target, map[string]interface{}{"maxReplicas": 4}, `unknown autoscaler "VPA"`},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := autoscalerFor(tc.autoscaler, tc.target, tc.autoscaling)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestAutoscalerFor_Template(t *testing.T) {
+	tmpl := template.Must(template.New("autoscaler").Funcs(allTemplateFuncs).Parse(
+		`{{ autoscalerFor (StructuralData .autoscaler) (dict "apiVersion" "apps/v1" "kind" "Deployment" "name" .resource.metadata.name) (StructuralData .resource.spec.autoscaling) | toJson }}`))
+	resource := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "vllm"},
+		"spec": map[string]interface{}{"autoscaling": map[string]interface{}{
+			"minReplicas": 0,
+			"maxReplicas": 2,
+			"triggers":    []interface{}{map[string]interface{}{"type": "prometheus", "metadata": map[string]interface{}{"threshold": "5"}}},
+		}},
+	}
+
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, map[string]interface{}{"autoscaler": AutoscalerKEDA, "resource": resource}))
+	rendered := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &rendered))
+	assert.Equal(t, "ScaledObject", rendered["kind"])
+	assert.Equal(t, "vllm", rendered["metadata"].(map[string]interface{})["name"])
+}
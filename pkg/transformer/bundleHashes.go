@@ -0,0 +1,60 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// TemplateHashes returns the sha256 hash of the files of the bundle at each
+// template path of an integration, keyed by path, so that the bundle versions
+// in use can be compared across clusters. Bundles on GCS are read with the
+// storage settings of spec.
+func (t *Transformer) TemplateHashes(ctx context.Context, c client.Client, spec v1.IntegrationSpec) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, template := range spec.Templates {
+		fSys, root, err := t.fileSystemForStorage(ctx, c, spec.Storage, template.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get file system for path %q: %v", redactString(template.Path), err)
+		}
+		hash, err := bundleContentHash(fSys, root)
+		if err != nil {
+			return nil, err
+		}
+		hashes[template.Path] = hash
+	}
+	return hashes, nil
+}
+
+// bundleContentHash hashes the names and content of the files under root.
+func bundleContentHash(fSys filesys.FileSystem, root string) (string, error) {
+	var files []string
+	err := fSys.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// In-memory file systems walk absolute paths under a relative root.
+		file, err := filepath.Rel(strings.TrimPrefix(root, "/"), strings.TrimPrefix(path, "/"))
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(file))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error walking path %q: %v", root, err)
+	}
+	sort.Strings(files)
+	return renderInputHash(fSys, root, files)
+}
@@ -0,0 +1,51 @@
+package transformer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestTemplateHashes(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("vllm/deployment.yaml", []byte("kind: Deployment\n")))
+	require.NoError(t, fSys.WriteFile("vllm/service/service.yaml", []byte("kind: Service\n")))
+	require.NoError(t, fSys.WriteFile("apply/job.yaml", []byte("kind: Job\n")))
+	transformer := NewTransformer()
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		if path == "embedded:/v1/apply" {
+			return fSys, "apply", nil
+		}
+		return fSys, "vllm", nil
+	}
+	spec := modelv1.IntegrationSpec{
+		Templates: []modelv1.IntegrationApiTemplatesSpec{{Path: "gcs:/models/vllm"}, {Path: "embedded:/v1/apply"}},
+	}
+
+	hashes, err := transformer.TemplateHashes(context.Background(), nil, spec)
+	require.NoError(t, err)
+	require.Len(t, hashes, 2)
+	assert.Len(t, hashes["gcs:/models/vllm"], 64)
+	assert.NotEqual(t, hashes["gcs:/models/vllm"], hashes["embedded:/v1/apply"])
+
+	again, err := transformer.TemplateHashes(context.Background(), nil, spec)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, again, "hashes are stable")
+
+	require.NoError(t, fSys.WriteFile("vllm/service/service.yaml", []byte("kind: Service\nspec: {}\n")))
+	changed, err := transformer.TemplateHashes(context.Background(), nil, spec)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashes["gcs:/models/vllm"], changed["gcs:/models/vllm"])
+	assert.Equal(t, hashes["embedded:/v1/apply"], changed["embedded:/v1/apply"])
+
+	require.NoError(t, fSys.RemoveAll("vllm/service"))
+	require.NoError(t, fSys.WriteFile("vllm/svc/service.yaml", []byte("kind: Service\nspec: {}\n")))
+	moved, err := transformer.TemplateHashes(context.Background(), nil, spec)
+	require.NoError(t, err)
+	assert.NotEqual(t, changed["gcs:/models/vllm"], moved["gcs:/models/vllm"], "file names are part of the hash")
+}
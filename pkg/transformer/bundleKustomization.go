@@ -0,0 +1,264 @@
+package transformer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// kustomizationFileNames are the names kustomize looks for in a directory.
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+func isKustomizationFile(name string) bool {
+	for _, kustomizationFileName := range kustomizationFileNames {
+		if name == kustomizationFileName {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleFileRole is how a file of a template bundle is rendered.
+type bundleFileRole int
+
+const (
+	// bundleResource files are rendered and added to the root kustomization.
+	bundleResource bundleFileRole = iota
+	// bundleSkipped files are not rendered, e.g. kustomizations.
+	bundleSkipped
+	// bundleTemplated files are rendered but are not resources of their own,
+	// e.g. the files of a component.
+	bundleTemplated
+	// bundleCopied files are copied as they are, e.g. the files read by
+	// generators.
+	bundleCopied
+)
+
+// bundleKustomization is the rendered kustomization.yaml at the root of a
+// template bundle, whose components, generators and replacements are added to
+// the root kustomization.
+type bundleKustomization struct {
+	// dir is the directory of the rendered kustomization, relative to the
+	// render root.
+	dir string
+	// kustomizationPath is the source path of the kustomization.
+	kustomizationPath string
+	kustomization     *types.Kustomization
+	// components and sources are the source paths of the component
+	// directories and of the files read by generators and replacements, see
+	// sourceKey.
+	components []string
+	sources    map[string]bool
+}
+
+// renderBundleKustomization renders the kustomization.yaml at rootPath of the
+// bundle to the same path under targetDir, when the integration enables
+// kustomize features. It returns nil if there is none.
+func renderBundleKustomization(ctx context.Context, sourceFS, targetFS filesys.FileSystem, rootPath, targetDir, dir string, spec *modelv1.IntegrationKustomizeSpec, context any, log logr.Logger) (*bundleKustomization, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	var sourcePath string
+	for _, name := range kustomizationFileNames {
+		if candidate := path.Join(rootPath, name); sourceFS.Exists(candidate) {
+			sourcePath = candidate
+			break
+		}
+	}
+	if sourcePath == "" {
+		return nil, nil
+	}
+
+	targetPath := path.Join(targetDir, sourcePath)
+	if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
+		return nil, err
+	}
+	if err := templateFile(ctx, sourceFS, targetFS, sourcePath, targetPath, context, log); err != nil {
+		return nil, err
+	}
+	data, err := targetFS.ReadFile(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", targetPath, err)
+	}
+	kustomization := &types.Kustomization{}
+	if err := yaml.Unmarshal(data, kustomization); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", sourcePath, &RenderError{Path: sourcePath, Err: err})
+	}
+
+	if len(kustomization.Components) > 0 && !spec.Components {
+		return nil, fmt.Errorf("%s lists components, which the integration does not enable", sourcePath)
+	}
+	if (len(kustomization.ConfigMapGenerator) > 0 || len(kustomization.SecretGenerator) > 0) && !spec.Generators {
+		return nil, fmt.Errorf("%s declares generators, which the integration does not enable", sourcePath)
+	}
+	if len(kustomization.Replacements) > 0 && !spec.Replacements {
+		return nil, fmt.Errorf("%s declares replacements, which the integration does not enable", sourcePath)
+	}
+
+	bundle := &bundleKustomization{
+		dir:               path.Join(dir, rootPath),
+		kustomizationPath: sourcePath,
+		kustomization:     kustomization,
+		sources:           map[string]bool{},
+	}
+	for _, component := range kustomization.Components {
+		bundle.components = append(bundle.components, sourceKey(path.Join(rootPath, component)))
+	}
+	for _, args := range generatorArgs(kustomization) {
+		for _, source := range args.FileSources {
+			bundle.sources[sourceKey(path.Join(rootPath, fileSourcePath(source)))] = true
+		}
+		for _, source := range args.EnvSources {
+			bundle.sources[sourceKey(path.Join(rootPath, source))] = true
+		}
+		if args.EnvSource != "" {
+			bundle.sources[sourceKey(path.Join(rootPath, args.EnvSource))] = true
+		}
+	}
+	for _, replacement := range kustomization.Replacements {
+		if replacement.Path != "" {
+			bundle.sources[sourceKey(path.Join(rootPath, replacement.Path))] = true
+		}
+	}
+	return bundle, nil
+}
+
+// role returns how the file at sourcePath of the bundle is rendered. Without
+// a bundle kustomization every file but kustomizations is a resource.
+func (b *bundleKustomization) role(sourcePath string) bundleFileRole {
+	if b == nil {
+		if isKustomizationFile(filepath.Base(sourcePath)) {
+			return bundleSkipped
+		}
+		return bundleResource
+	}
+	sourcePath = sourceKey(sourcePath)
+	if b.sources[sourcePath] {
+		return bundleCopied
+	}
+	for _, component := range b.components {
+		if strings.HasPrefix(sourcePath, component+"/") {
+			return bundleTemplated
+		}
+	}
+	if isKustomizationFile(filepath.Base(sourcePath)) {
+		return bundleSkipped
+	}
+	return bundleResource
+}
+
+// sourceKey cleans sourcePath for lookups, as file systems differ in whether
+// the paths they walk start with a slash.
+func sourceKey(sourcePath string) string {
+	return path.Join("/", sourcePath)
+}
+
+// addBundleKustomizations adds the components, generators and replacements of
+// the bundle kustomizations to the root kustomization, with their paths made
+// relative to it.
+func addBundleKustomizations(fSys filesys.FileSystem, kustomizationPath string, bundles []*bundleKustomization) error {
+	if len(bundles) == 0 {
+		return nil
+	}
+	return editKustomization(fSys, kustomizationPath, func(kustomization *types.Kustomization) {
+		for _, bundle := range bundles {
+			for _, component := range bundle.kustomization.Components {
+				kustomization.Components = append(kustomization.Components, path.Join(bundle.dir, component))
+			}
+			for _, generator := range bundle.kustomization.ConfigMapGenerator {
+				generator.GeneratorArgs = bundle.rebaseGenerator(generator.GeneratorArgs)
+				kustomization.ConfigMapGenerator = append(kustomization.ConfigMapGenerator, generator)
+			}
+			for _, generator := range bundle.kustomization.SecretGenerator {
+				generator.GeneratorArgs = bundle.rebaseGenerator(generator.GeneratorArgs)
+				kustomization.SecretGenerator = append(kustomization.SecretGenerator, generator)
+			}
+			for _, replacement := range bundle.kustomization.Replacements {
+				if replacement.Path != "" {
+					replacement.Path = path.Join(bundle.dir, replacement.Path)
+				}
+				kustomization.Replacements = append(kustomization.Replacements, replacement)
+			}
+		}
+	})
+}
+
+// rebaseGenerator makes the paths of args relative to the root kustomization,
+// and applies the generatorOptions of the bundle kustomization to it.
+func (b *bundleKustomization) rebaseGenerator(args types.GeneratorArgs) types.GeneratorArgs {
+	fileSources := make([]string, len(args.FileSources))
+	for i, source := range args.FileSources {
+		if key, sourcePath, found := strings.Cut(source, "="); found {
+			fileSources[i] = key + "=" + path.Join(b.dir, sourcePath)
+		} else {
+			fileSources[i] = path.Join(b.dir, source)
+		}
+	}
+	args.FileSources = fileSources
+	envSources := make([]string, len(args.EnvSources))
+	for i, source := range args.EnvSources {
+		envSources[i] = path.Join(b.dir, source)
+	}
+	args.EnvSources = envSources
+	if args.EnvSource != "" {
+		args.EnvSource = path.Join(b.dir, args.EnvSource)
+	}
+	args.Options = types.MergeGlobalOptionsIntoLocal(args.Options, b.kustomization.GeneratorOptions)
+	return args
+}
+
+func generatorArgs(kustomization *types.Kustomization) []types.GeneratorArgs {
+	var args []types.GeneratorArgs
+	for _, generator := range kustomization.ConfigMapGenerator {
+		args = append(args, generator.GeneratorArgs)
+	}
+	for _, generator := range kustomization.SecretGenerator {
+		args = append(args, generator.GeneratorArgs)
+	}
+	return args
+}
+
+// fileSourcePath returns the path of a generator file source, which has the
+// form [{key}=]{path}.
+func fileSourcePath(source string) string {
+	if _, sourcePath, found := strings.Cut(source, "="); found {
+		return sourcePath
+	}
+	return source
+}
+
+// generatorKinds returns the kinds of the objects that the generators of the
+// kustomization at the root of the bundle create. The kustomization is not
+// rendered, so only its top-level keys are read.
+func generatorKinds(fSys filesys.FileSystem, root string) []schema.GroupVersionKind {
+	var kinds []schema.GroupVersionKind
+	for _, name := range kustomizationFileNames {
+		data, err := fSys.ReadFile(path.Join(root, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			switch key, _, _ := strings.Cut(scanner.Text(), ":"); key {
+			case "configMapGenerator":
+				kinds = append(kinds, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+			case "secretGenerator":
+				kinds = append(kinds, schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+			}
+		}
+		break
+	}
+	return kinds
+}
@@ -0,0 +1,184 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	a "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestTransformerRun_WithBundleKustomization(t *testing.T) {
+	ctx := context.Background()
+	testNamespace := "kustomize-ns"
+	testName := "kustomize-resource"
+
+	sourceFs := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFs.WriteFile("base/deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: server
+        image: server:1
+      volumes:
+      - name: settings
+        configMap:
+          name: settings
+`)))
+	require.NoError(t, sourceFs.WriteFile("base/kustomization.yaml", []byte(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+components:
+- components/debug
+configMapGenerator:
+- name: settings
+  namespace: {{ .resource.metadata.namespace }}
+  files:
+  - config/settings.properties
+  literals:
+  - owner={{ .resource.metadata.name }}
+replacements:
+- source:
+    kind: ConfigMap
+    name: settings
+    fieldPath: data.owner
+  targets:
+  - select:
+      kind: Deployment
+    fieldPaths:
+    - metadata.annotations.owner
+    options:
+      create: true
+`)))
+	// Files read by generators are not templates.
+	require.NoError(t, sourceFs.WriteFile("base/config/settings.properties", []byte("level={{ debug }}\n")))
+	require.NoError(t, sourceFs.WriteFile("base/components/debug/kustomization.yaml", []byte(`apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+patches:
+- path: patch.yaml
+`)))
+	require.NoError(t, sourceFs.WriteFile("base/components/debug/patch.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+  labels:
+    debug: "true"
+`)))
+	require.NoError(t, sourceFs.WriteFile("v1/apply/apply.yaml", []byte(`
+resources:
+{{- range . }}
+- {{ . }}
+{{- end }}
+`)))
+
+	objGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(objGVK.Group, objGVK.Version, objGVK.Kind, testName)
+	obj.SetNamespace(testNamespace)
+
+	run := func(kustomize *modelv1.IntegrationKustomizeSpec) ([]*unstructured.Unstructured, error) {
+		transformer := NewTransformer()
+		transformer.registry = &mockRegistry{
+			integrations:  []schema.GroupVersionKind{objGVK},
+			templatePaths: map[schema.GroupVersionKind][]string{objGVK: {"embedded:/base"}},
+			specs:         map[schema.GroupVersionKind]modelv1.IntegrationSpec{objGVK: {Kustomize: kustomize}},
+		}
+		transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+			switch path {
+			case "embedded:/base":
+				return sourceFs, "base", nil
+			case "embedded:/v1/apply":
+				return sourceFs, filepath.Join("v1", "apply"), nil
+			default:
+				return nil, "", fmt.Errorf("fsProviderFunc received an unexpected path: %s", path)
+			}
+		}
+		transformer.findConnectedResourcesFunc = func(ctx context.Context, discovery discovery.DiscoveryInterface, dynamic dynamic.Interface, u *unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+			return nil, nil, nil
+		}
+		transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+			return resources, nil
+		}
+
+		dynamicClient := fake.NewSimpleDynamicClient(scheme.Scheme, obj)
+		discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+		testScheme := runtime.NewScheme()
+		_ = scheme.AddToScheme(testScheme)
+		fakeTypedClient := a.NewClientBuilder().WithScheme(testScheme).WithObjects(obj).Build()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: testName}}
+
+		return transformer.Run(ctx, discoveryClient, dynamicClient, &mockRESTMapper{}, fakeTypedClient, req, obj)
+	}
+
+	t.Run("with the features enabled", func(t *testing.T) {
+		result, err := run(&modelv1.IntegrationKustomizeSpec{Components: true, Generators: true, Replacements: true})
+		require.NoError(t, err)
+		require.Len(t, result, 2, "the files of components and generators are not resources")
+
+		var deployment, configMap *unstructured.Unstructured
+		for _, u := range result {
+			switch u.GetKind() {
+			case "Deployment":
+				deployment = u
+			case "ConfigMap":
+				configMap = u
+			}
+		}
+		require.NotNil(t, deployment)
+		require.NotNil(t, configMap)
+
+		assert.True(t, strings.HasPrefix(configMap.GetName(), "settings-"), "generated names get a hash suffix, got %s", configMap.GetName())
+		assert.Equal(t, testNamespace, configMap.GetNamespace())
+		data, _, _ := unstructured.NestedStringMap(configMap.Object, "data")
+		assert.Equal(t, map[string]string{"settings.properties": "level={{ debug }}\n", "owner": testName}, data)
+
+		volumes, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "volumes")
+		require.Len(t, volumes, 1)
+		name, _, _ := unstructured.NestedString(volumes[0].(map[string]interface{}), "configMap", "name")
+		assert.Equal(t, configMap.GetName(), name, "references to generated objects are updated")
+		assert.Equal(t, "true", deployment.GetLabels()["debug"], "the component is applied")
+		assert.Equal(t, testName, deployment.GetAnnotations()["owner"], "the replacement is applied")
+	})
+
+	t.Run("with a feature that is not enabled", func(t *testing.T) {
+		_, err := run(&modelv1.IntegrationKustomizeSpec{Components: true, Replacements: true})
+		assert.ErrorContains(t, err, "base/kustomization.yaml declares generators, which the integration does not enable")
+	})
+}
+
+func TestGeneratorKinds(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("bundle/kustomization.yaml", []byte(`configMapGenerator:
+- name: settings
+  literals:
+  - owner={{ .resource.metadata.name }}
+secretGenerator:
+- name: token
+`)))
+	assert.Equal(t, []schema.GroupVersionKind{
+		{Version: "v1", Kind: "ConfigMap"},
+		{Version: "v1", Kind: "Secret"},
+	}, generatorKinds(fSys, "bundle"))
+	assert.Empty(t, generatorKinds(fSys, "other"))
+}
@@ -0,0 +1,325 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// BundleMetadataFile at the root of a template bundle makes it a packaged
+	// bundle, see BundleMetadata.
+	BundleMetadataFile = "metadata.yaml"
+	// BundleSignatureFile holds the base64 encoded cosign signature of the
+	// BundleMetadataFile, as written by
+	// "cosign sign-blob --key cosign.key metadata.yaml".
+	BundleSignatureFile = "metadata.yaml.sig"
+)
+
+// DevVersion is the Version of builds that do not set one. The karoVersions of
+// packaged bundles are not checked against it.
+const DevVersion = "dev"
+
+// Version is the version of the operator that the karoVersions of packaged
+// bundles are checked against. It is set at build time with
+// -ldflags "-X github.com/GoogleCloudPlatform/karo/pkg/transformer.Version=<version>",
+// see the VERSION of the Makefile.
+var Version = DevVersion
+
+// VersionSet returns whether the operator was built with a Version, so that
+// the karoVersions of packaged bundles are checked.
+func VersionSet() bool {
+	return Version != "" && Version != DevVersion
+}
+
+// BundleMetadata is the metadata.yaml of a packaged template bundle, e.g.
+//
+//	name: vllm-serving
+//	version: 1.4.0
+//	karoVersions: ">= 1.8, < 2"
+//	kinds:
+//	- apiVersion: model.skippy.io/v1
+//	  kind: InferenceService
+//	checksums:
+//	  deployment.yaml: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+type BundleMetadata struct {
+	// Name and Version identify the bundle. Version is a semantic version.
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	// KaroVersions is a semantic version constraint on the versions of the
+	// operator that can render the bundle. Any version can if it is empty.
+	KaroVersions string `yaml:"karoVersions,omitempty"`
+	// Kinds are the kinds of resources whose integrations may render the
+	// bundle.
+	Kinds []BundleKind `yaml:"kinds"`
+	// Checksums hold the sha256 digest of every file of the bundle, other
+	// than the metadata and its signature, by their path relative to the
+	// root of the bundle.
+	Checksums map[string]string `yaml:"checksums"`
+}
+
+// BundleKind is a kind that a packaged bundle is written for.
+type BundleKind struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+// BundleVerificationError is returned when a template bundle does not match
+// its metadata, or lacks metadata or a signature that the integration
+// requires.
+type BundleVerificationError struct {
+	Path string
+	Err  error
+}
+
+func (e *BundleVerificationError) Error() string {
+	return fmt.Sprintf("template bundle %s failed verification: %v", redactString(e.Path), e.Err)
+}
+
+func (e *BundleVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// parseBundleMetadata parses and validates a metadata.yaml. Unknown fields
+// are rejected, so that misspelled checksums are not silently skipped.
+func parseBundleMetadata(data []byte) (*BundleMetadata, error) {
+	metadata := &BundleMetadata{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(metadata); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", BundleMetadataFile, err)
+	}
+	if metadata.Name == "" {
+		return nil, fmt.Errorf("%s has no name", BundleMetadataFile)
+	}
+	if _, err := semver.StrictNewVersion(strings.TrimPrefix(metadata.Version, "v")); err != nil {
+		return nil, fmt.Errorf("%s has an invalid version %q: %v", BundleMetadataFile, metadata.Version, err)
+	}
+	if len(metadata.Kinds) == 0 {
+		return nil, fmt.Errorf("%s lists no kinds", BundleMetadataFile)
+	}
+	for name, checksum := range metadata.Checksums {
+		if !strings.HasPrefix(checksum, "sha256:") {
+			return nil, fmt.Errorf("%s has an invalid checksum %q for %s, checksums have the form sha256:<hex>", BundleMetadataFile, checksum, name)
+		}
+	}
+	return metadata, nil
+}
+
+// compatible returns an error if the bundle cannot be rendered by the
+// operator at version, or by the integration of gvk. The karoVersions are not
+// checked if version is unset or DevVersion.
+func (m *BundleMetadata) compatible(version string, gvk schema.GroupVersionKind) error {
+	if m.KaroVersions != "" && version != "" && version != DevVersion {
+		constraint, err := semver.NewConstraint(m.KaroVersions)
+		if err != nil {
+			return fmt.Errorf("%s has an invalid karoVersions %q: %v", BundleMetadataFile, m.KaroVersions, err)
+		}
+		operatorVersion, err := semver.NewVersion(version)
+		if err != nil {
+			return fmt.Errorf("the operator version %q is not a semantic version: %v", version, err)
+		}
+		if !constraint.Check(operatorVersion) {
+			return fmt.Errorf("bundle %s %s requires karo %s, the operator is %s", m.Name, m.Version, m.KaroVersions, version)
+		}
+	}
+	kinds := make([]string, 0, len(m.Kinds))
+	for _, kind := range m.Kinds {
+		if kind.APIVersion == gvk.GroupVersion().String() && kind.Kind == gvk.Kind {
+			return nil
+		}
+		kinds = append(kinds, kind.APIVersion+" "+kind.Kind)
+	}
+	return fmt.Errorf("bundle %s %s is for %s, not for %s", m.Name, m.Version, strings.Join(kinds, ", "), gvk.GroupVersion().String()+" "+gvk.Kind)
+}
+
+// verifyChecksums checks that the files under root are exactly those listed
+// in the checksums of the metadata, with the same content.
+func (m *BundleMetadata) verifyChecksums(fSys filesys.FileSystem, root string) error {
+	unlisted := []string{}
+	seen := map[string]bool{}
+	err := fSys.Walk(root, func(filePath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// In-memory file systems walk absolute paths under a relative root.
+		name, err := filepath.Rel(strings.TrimPrefix(root, "/"), strings.TrimPrefix(filePath, "/"))
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if name == BundleMetadataFile || name == BundleSignatureFile {
+			return nil
+		}
+		checksum, ok := m.Checksums[name]
+		if !ok {
+			unlisted = append(unlisted, name)
+			return nil
+		}
+		data, err := fSys.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		seen[name] = true
+		if sha256Digest(data) != checksum {
+			return fmt.Errorf("the checksum of %s does not match %s", name, BundleMetadataFile)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(unlisted) > 0 {
+		sort.Strings(unlisted)
+		return fmt.Errorf("%s has no checksum for %s", BundleMetadataFile, strings.Join(unlisted, ", "))
+	}
+	var missing []string
+	for name := range m.Checksums {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("files listed in %s are missing: %s", BundleMetadataFile, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// verifyBundle checks the bundle at root of fSys against its metadata.yaml,
+// and its metadata against the signature keys of packageSpec. It returns the
+// status of the bundle, or nil if it is not packaged and packageSpec does
+// not require it.
+func verifyBundle(fSys filesys.FileSystem, root string, gvk schema.GroupVersionKind, packageSpec *v1.IntegrationPackageSpec) (*v1.IntegrationBundleStatus, error) {
+	if packageSpec == nil {
+		packageSpec = &v1.IntegrationPackageSpec{}
+	}
+	metadataPath := path.Join(root, BundleMetadataFile)
+	if !fSys.Exists(metadataPath) {
+		if packageSpec.Required || len(packageSpec.SignatureKeys) > 0 {
+			return nil, fmt.Errorf("the bundle has no %s", BundleMetadataFile)
+		}
+		return nil, nil
+	}
+	data, err := fSys.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseBundleMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := metadata.compatible(Version, gvk); err != nil {
+		return nil, err
+	}
+	if err := metadata.verifyChecksums(fSys, root); err != nil {
+		return nil, err
+	}
+
+	status := &v1.IntegrationBundleStatus{
+		Group:         gvk.Group,
+		Version:       gvk.Version,
+		Kind:          gvk.Kind,
+		Name:          metadata.Name,
+		BundleVersion: metadata.Version,
+		Digest:        sha256Digest(data),
+	}
+	if len(packageSpec.SignatureKeys) == 0 {
+		return status, nil
+	}
+	keys, err := parseSignatureKeys(packageSpec.SignatureKeys)
+	if err != nil {
+		return nil, err
+	}
+	signaturePath := path.Join(root, BundleSignatureFile)
+	if !fSys.Exists(signaturePath) {
+		return nil, fmt.Errorf("%s is not signed, %s is missing", BundleMetadataFile, BundleSignatureFile)
+	}
+	encoded, err := fSys.ReadFile(signaturePath)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", BundleSignatureFile, err)
+	}
+	if !verifyPayload(keys, data, signature) {
+		return nil, fmt.Errorf("%s is not signed by a trusted key", BundleMetadataFile)
+	}
+	status.Signed = true
+	return status, nil
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isEmbeddedPath returns true for template paths of the bundles embedded in
+// the operator, which are not verified.
+func isEmbeddedPath(templatePath string) bool {
+	return strings.HasPrefix(templatePath, "embedded:")
+}
+
+// verifiedFileSystem returns the file system of a template path of the
+// integration for gvk, after verifying the bundle against its metadata.
+func (t *Transformer) verifiedFileSystem(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, storageSpec *v1.IntegrationStorageSpec, packageSpec *v1.IntegrationPackageSpec, templatePath string) (filesys.FileSystem, string, *v1.IntegrationBundleStatus, error) {
+	fSys, root, err := t.fileSystemForStorage(ctx, c, storageSpec, templatePath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if isEmbeddedPath(templatePath) {
+		return fSys, root, nil, nil
+	}
+	status, err := verifyBundle(fSys, root, gvk, packageSpec)
+	if err != nil {
+		return nil, "", nil, &BundleVerificationError{Path: templatePath, Err: err}
+	}
+	if status != nil {
+		status.Path = templatePath
+	}
+	return fSys, root, status, nil
+}
+
+// VerifyBundles verifies the packaged template bundles of an integration
+// against their metadata.yaml, and returns their status. Bundles on GCS are
+// read with the storage settings of spec. Unpackaged bundles are skipped,
+// unless the integration requires packages.
+func (t *Transformer) VerifyBundles(ctx context.Context, c client.Client, spec v1.IntegrationSpec) ([]v1.IntegrationBundleStatus, error) {
+	gvk := schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}
+	var bundles []v1.IntegrationBundleStatus
+	for _, template := range spec.Templates {
+		_, _, status, err := t.verifiedFileSystem(ctx, c, gvk, spec.Storage, spec.Package, template.Path)
+		if err != nil {
+			var verificationErr *BundleVerificationError
+			if errors.As(err, &verificationErr) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("unable to get file system for path %q: %v", redactString(template.Path), err)
+		}
+		if status != nil {
+			bundles = append(bundles, *status)
+		}
+	}
+	return bundles, nil
+}
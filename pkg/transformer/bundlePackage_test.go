@@ -0,0 +1,220 @@
+package transformer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+var bundleTestGVK = schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceService"}
+
+const (
+	bundleTestDeployment = "apiVersion: apps/v1\nkind: Deployment\n"
+	bundleTestService    = "apiVersion: v1\nkind: Service\n"
+)
+
+// newTestBundle returns a bundle at "bundle" whose metadata.yaml has
+// karoVersions and the checksums of its two files.
+func newTestBundle(t *testing.T, karoVersions string) filesys.FileSystem {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("bundle/deployment.yaml", []byte(bundleTestDeployment)))
+	require.NoError(t, fSys.WriteFile("bundle/services/service.yaml", []byte(bundleTestService)))
+	require.NoError(t, fSys.WriteFile("bundle/metadata.yaml", []byte(fmt.Sprintf(`name: vllm-serving
+version: 1.4.0
+karoVersions: %q
+kinds:
+- apiVersion: model.skippy.io/v1
+  kind: InferenceService
+checksums:
+  deployment.yaml: %s
+  services/service.yaml: %s
+`, karoVersions, sha256Digest([]byte(bundleTestDeployment)), sha256Digest([]byte(bundleTestService))))))
+	return fSys
+}
+
+func signTestBundle(t *testing.T, fSys filesys.FileSystem) string {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	metadata, err := fSys.ReadFile("bundle/metadata.yaml")
+	require.NoError(t, err)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, metadata))
+	require.NoError(t, fSys.WriteFile("bundle/metadata.yaml.sig", []byte(signature+"\n")))
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// setTestVersion sets the Version of the operator for the test.
+func setTestVersion(t *testing.T, version string) {
+	previous := Version
+	Version = version
+	t.Cleanup(func() { Version = previous })
+}
+
+func TestVerifyBundle(t *testing.T) {
+	setTestVersion(t, "1.9.0")
+	fSys := newTestBundle(t, ">= 1.8, < 2")
+	status, err := verifyBundle(fSys, "bundle", bundleTestGVK, nil)
+	require.NoError(t, err)
+	metadata, err := fSys.ReadFile("bundle/metadata.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, &modelv1.IntegrationBundleStatus{
+		Group:         "model.skippy.io",
+		Version:       "v1",
+		Kind:          "InferenceService",
+		Name:          "vllm-serving",
+		BundleVersion: "1.4.0",
+		Digest:        sha256Digest(metadata),
+	}, status)
+
+	for _, test := range []struct {
+		name   string
+		modify func(fSys filesys.FileSystem)
+		gvk    schema.GroupVersionKind
+		err    string
+	}{
+		{
+			name: "changed file",
+			modify: func(fSys filesys.FileSystem) {
+				fSys.WriteFile("bundle/deployment.yaml", []byte(bundleTestDeployment+"spec: {}\n"))
+			},
+			err: "the checksum of deployment.yaml does not match metadata.yaml",
+		},
+		{
+			name:   "added file",
+			modify: func(fSys filesys.FileSystem) { fSys.WriteFile("bundle/job.yaml", []byte("kind: Job\n")) },
+			err:    "metadata.yaml has no checksum for job.yaml",
+		},
+		{
+			name:   "removed file",
+			modify: func(fSys filesys.FileSystem) { fSys.RemoveAll("bundle/services") },
+			err:    "files listed in metadata.yaml are missing: services/service.yaml",
+		},
+		{
+			name: "other kind",
+			gvk:  schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"},
+			err:  "bundle vllm-serving 1.4.0 is for model.skippy.io/v1 InferenceService, not for model.skippy.io/v1 Agent",
+		},
+		{
+			name: "misspelled field",
+			modify: func(fSys filesys.FileSystem) {
+				fSys.WriteFile("bundle/metadata.yaml", []byte("name: vllm-serving\nversion: 1.4.0\nkinds: [{apiVersion: model.skippy.io/v1, kind: InferenceService}]\nchecksum: {}\n"))
+			},
+			err: "field checksum not found",
+		},
+		{
+			name: "invalid version",
+			modify: func(fSys filesys.FileSystem) {
+				fSys.WriteFile("bundle/metadata.yaml", []byte("name: vllm-serving\nversion: latest\nkinds: [{apiVersion: model.skippy.io/v1, kind: InferenceService}]\n"))
+			},
+			err: `metadata.yaml has an invalid version "latest"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fSys := newTestBundle(t, "")
+			if test.modify != nil {
+				test.modify(fSys)
+			}
+			gvk := bundleTestGVK
+			if !test.gvk.Empty() {
+				gvk = test.gvk
+			}
+			_, err := verifyBundle(fSys, "bundle", gvk, nil)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	t.Run("incompatible operator", func(t *testing.T) {
+		_, err := verifyBundle(newTestBundle(t, ">= 2"), "bundle", bundleTestGVK, nil)
+		assert.EqualError(t, err, "bundle vllm-serving 1.4.0 requires karo >= 2, the operator is 1.9.0")
+	})
+
+	t.Run("operator without a version", func(t *testing.T) {
+		setTestVersion(t, DevVersion)
+		_, err := verifyBundle(newTestBundle(t, ">= 2"), "bundle", bundleTestGVK, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unpackaged", func(t *testing.T) {
+		fSys := newTestBundle(t, "")
+		require.NoError(t, fSys.RemoveAll("bundle/metadata.yaml"))
+		status, err := verifyBundle(fSys, "bundle", bundleTestGVK, nil)
+		require.NoError(t, err)
+		assert.Nil(t, status)
+
+		_, err = verifyBundle(fSys, "bundle", bundleTestGVK, &modelv1.IntegrationPackageSpec{Required: true})
+		assert.EqualError(t, err, "the bundle has no metadata.yaml")
+	})
+}
+
+func TestVerifyBundleSignature(t *testing.T) {
+	fSys := newTestBundle(t, "")
+	key := signTestBundle(t, fSys)
+
+	status, err := verifyBundle(fSys, "bundle", bundleTestGVK, &modelv1.IntegrationPackageSpec{SignatureKeys: []string{key}})
+	require.NoError(t, err)
+	assert.True(t, status.Signed)
+
+	// Unchecked signatures are not reported as signed.
+	status, err = verifyBundle(fSys, "bundle", bundleTestGVK, nil)
+	require.NoError(t, err)
+	assert.False(t, status.Signed)
+
+	otherKey := signTestBundle(t, newTestBundle(t, ""))
+	_, err = verifyBundle(fSys, "bundle", bundleTestGVK, &modelv1.IntegrationPackageSpec{SignatureKeys: []string{otherKey}})
+	assert.EqualError(t, err, "metadata.yaml is not signed by a trusted key")
+
+	require.NoError(t, fSys.RemoveAll("bundle/metadata.yaml.sig"))
+	_, err = verifyBundle(fSys, "bundle", bundleTestGVK, &modelv1.IntegrationPackageSpec{SignatureKeys: []string{key}})
+	assert.EqualError(t, err, "metadata.yaml is not signed, metadata.yaml.sig is missing")
+}
+
+func TestVerifyBundles(t *testing.T) {
+	fSys := newTestBundle(t, "")
+	transformer := NewTransformer()
+	transformer.registry = &mockRegistry{
+		specs: map[schema.GroupVersionKind]modelv1.IntegrationSpec{bundleTestGVK: {Package: &modelv1.IntegrationPackageSpec{Required: true}}},
+	}
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		if path == "embedded:/v1/apply" {
+			return filesys.MakeFsInMemory(), "apply", nil
+		}
+		return fSys, "bundle", nil
+	}
+	spec := modelv1.IntegrationSpec{
+		Group: bundleTestGVK.Group, Version: bundleTestGVK.Version, Kind: bundleTestGVK.Kind,
+		Templates: []modelv1.IntegrationApiTemplatesSpec{{Path: "gcs://models/vllm", Operation: "template"}, {Path: "embedded:/v1/apply", Operation: "copy"}},
+		Package:   &modelv1.IntegrationPackageSpec{Required: true},
+	}
+
+	bundles, err := transformer.VerifyBundles(context.Background(), nil, spec)
+	require.NoError(t, err)
+	require.Len(t, bundles, 1, "embedded bundles are not verified")
+	assert.Equal(t, "gcs://models/vllm", bundles[0].Path)
+	assert.Equal(t, "1.4.0", bundles[0].BundleVersion)
+
+	// Renders verify the bundles too, with the settings of the registry.
+	_, _, err = transformer.fileSystemFor(context.Background(), nil, bundleTestGVK, "gcs://models/vllm")
+	require.NoError(t, err)
+	require.NoError(t, fSys.WriteFile("bundle/deployment.yaml", []byte("kind: Pod\n")))
+	_, _, err = transformer.fileSystemFor(context.Background(), nil, bundleTestGVK, "gcs://models/vllm")
+	var verificationErr *BundleVerificationError
+	require.True(t, errors.As(err, &verificationErr))
+	assert.EqualError(t, err, "template bundle gcs://models/vllm failed verification: the checksum of deployment.yaml does not match metadata.yaml")
+
+	_, err = transformer.VerifyBundles(context.Background(), nil, spec)
+	assert.ErrorAs(t, err, &verificationErr)
+}
@@ -0,0 +1,190 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultClusterDefaultsKey is the key of the cluster defaults ConfigMap whose
+// defaults apply to the pods generated for every kind. Other keys name a
+// kind, e.g. "InferenceDeployment.model.skippy.io", whose own defaults take
+// precedence.
+const DefaultClusterDefaultsKey = "default"
+
+// ClusterDefaults is the placement policy that cluster admins set for the pods
+// that karo generates. Each setting only fills in what the templates leave
+// out, so that integration bundles can still place their pods.
+type ClusterDefaults struct {
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+	PriorityClassName string              `json:"priorityClassName,omitempty"`
+	ImagePullSecrets  []string            `json:"imagePullSecrets,omitempty"`
+}
+
+// clusterDefaults holds the cluster defaults by ConfigMap key, see
+// SetClusterDefaults.
+type clusterDefaults struct {
+	m      sync.RWMutex
+	byKind map[string]ClusterDefaults
+}
+
+// ParseClusterDefaults parses the data of a cluster defaults ConfigMap: the
+// defaults for every kind under DefaultClusterDefaultsKey, and the defaults
+// for a kind under its name and group, as YAML.
+func ParseClusterDefaults(data map[string]string) (map[string]ClusterDefaults, error) {
+	byKind := make(map[string]ClusterDefaults, len(data))
+	for key, value := range data {
+		var defaults ClusterDefaults
+		if err := yaml.UnmarshalStrict([]byte(value), &defaults); err != nil {
+			return nil, fmt.Errorf("invalid cluster defaults for %q: %w", key, err)
+		}
+		byKind[key] = defaults
+	}
+	return byKind, nil
+}
+
+// SetClusterDefaults replaces the cluster defaults, as returned by
+// ParseClusterDefaults. Nil removes them. It may be called while resources
+// are rendered; renders that already started keep the previous defaults.
+func (t *Transformer) SetClusterDefaults(byKind map[string]ClusterDefaults) {
+	t.clusterDefaults.m.Lock()
+	defer t.clusterDefaults.m.Unlock()
+	t.clusterDefaults.byKind = byKind
+}
+
+// clusterDefaultsFor returns the cluster defaults for the pods generated for
+// a resource of gvk: its kind's defaults merged over the ones for every kind.
+func (t *Transformer) clusterDefaultsFor(gvk schema.GroupVersionKind) *ClusterDefaults {
+	t.clusterDefaults.m.RLock()
+	defer t.clusterDefaults.m.RUnlock()
+
+	defaults, hasDefault := t.clusterDefaults.byKind[DefaultClusterDefaultsKey]
+	key := gvk.Kind
+	if gvk.Group != "" {
+		key = gvk.Kind + "." + gvk.Group
+	}
+	kindDefaults, hasKind := t.clusterDefaults.byKind[key]
+	if !hasDefault && !hasKind {
+		return nil
+	}
+	merged := ClusterDefaults{
+		NodeSelector:      maps.Clone(defaults.NodeSelector),
+		Tolerations:       slices.Clone(defaults.Tolerations),
+		PriorityClassName: defaults.PriorityClassName,
+		ImagePullSecrets:  slices.Clone(defaults.ImagePullSecrets),
+	}
+	if len(kindDefaults.NodeSelector) > 0 && merged.NodeSelector == nil {
+		merged.NodeSelector = map[string]string{}
+	}
+	maps.Copy(merged.NodeSelector, kindDefaults.NodeSelector)
+	merged.Tolerations = append(merged.Tolerations, kindDefaults.Tolerations...)
+	if kindDefaults.PriorityClassName != "" {
+		merged.PriorityClassName = kindDefaults.PriorityClassName
+	}
+	merged.ImagePullSecrets = append(merged.ImagePullSecrets, kindDefaults.ImagePullSecrets...)
+	return &merged
+}
+
+// clusterDefaultsContext returns defaults as the templates see them, in
+// .clusterDefaults, or an empty map if there are none.
+func clusterDefaultsContext(defaults *ClusterDefaults) (map[string]interface{}, error) {
+	if defaults == nil {
+		return map[string]interface{}{}, nil
+	}
+	data, err := json.Marshal(defaults)
+	if err != nil {
+		return nil, err
+	}
+	value := map[string]interface{}{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// applyClusterDefaults fills in the placement of the pod specs of obj that
+// their templates leave out: node selector labels that are not set, missing
+// tolerations and image pull secrets, and the priority class if there is
+// none.
+func applyClusterDefaults(obj *unstructured.Unstructured, defaults *ClusterDefaults) error {
+	if defaults == nil {
+		return nil
+	}
+	for _, path := range podSpecPaths[obj.GetKind()] {
+		rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		podSpec, ok := rawPodSpec.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if len(defaults.NodeSelector) > 0 {
+			nodeSelector, _ := podSpec["nodeSelector"].(map[string]interface{})
+			if nodeSelector == nil {
+				nodeSelector = map[string]interface{}{}
+			}
+			for key, value := range defaults.NodeSelector {
+				if _, found := nodeSelector[key]; !found {
+					nodeSelector[key] = value
+				}
+			}
+			podSpec["nodeSelector"] = nodeSelector
+		}
+		if len(defaults.Tolerations) > 0 {
+			tolerations, _ := podSpec["tolerations"].([]interface{})
+			for _, toleration := range defaults.Tolerations {
+				value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&toleration)
+				if err != nil {
+					return fmt.Errorf("invalid default toleration %q: %w", toleration.Key, err)
+				}
+				if !hasToleration(tolerations, value) {
+					tolerations = append(tolerations, value)
+				}
+			}
+			podSpec["tolerations"] = tolerations
+		}
+		if defaults.PriorityClassName != "" {
+			if name, _ := podSpec["priorityClassName"].(string); name == "" {
+				podSpec["priorityClassName"] = defaults.PriorityClassName
+			}
+		}
+		if len(defaults.ImagePullSecrets) > 0 {
+			secrets, _ := podSpec["imagePullSecrets"].([]interface{})
+			for _, name := range defaults.ImagePullSecrets {
+				if !hasNamedEntry(secrets, name) {
+					secrets = append(secrets, map[string]interface{}{"name": name})
+				}
+			}
+			podSpec["imagePullSecrets"] = secrets
+		}
+	}
+	return nil
+}
+
+// hasToleration reports whether tolerations has one with the same key,
+// operator, value and effect as toleration.
+func hasToleration(tolerations []interface{}, toleration map[string]interface{}) bool {
+	for _, entry := range tolerations {
+		existing, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		same := true
+		for _, field := range []string{"key", "operator", "value", "effect"} {
+			a, _ := existing[field].(string)
+			b, _ := toleration[field].(string)
+			same = same && a == b
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
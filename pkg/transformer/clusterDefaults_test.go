@@ -0,0 +1,108 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseClusterDefaults(t *testing.T) {
+	defaults, err := ParseClusterDefaults(map[string]string{
+		"default": `
+nodeSelector:
+  cloud.google.com/gke-nodepool: general
+tolerations:
+- key: dedicated
+  operator: Equal
+  value: karo
+  effect: NoSchedule
+imagePullSecrets: [registry]
+`,
+		"InferenceDeployment.model.skippy.io": `
+nodeSelector:
+  cloud.google.com/gke-nodepool: gpu
+priorityClassName: serving
+`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "general", defaults["default"].NodeSelector["cloud.google.com/gke-nodepool"])
+	assert.Equal(t, "serving", defaults["InferenceDeployment.model.skippy.io"].PriorityClassName)
+
+	_, err = ParseClusterDefaults(map[string]string{"default": "nodeSelectors: {}"})
+	assert.ErrorContains(t, err, `invalid cluster defaults for "default"`)
+
+	transformer := NewTransformer()
+	assert.Nil(t, transformer.clusterDefaultsFor(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceDeployment"}))
+	transformer.SetClusterDefaults(defaults)
+
+	merged := transformer.clusterDefaultsFor(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceDeployment"})
+	require.NotNil(t, merged)
+	assert.Equal(t, map[string]string{"cloud.google.com/gke-nodepool": "gpu"}, merged.NodeSelector)
+	assert.Equal(t, "serving", merged.PriorityClassName)
+	assert.Equal(t, []string{"registry"}, merged.ImagePullSecrets)
+	assert.Len(t, merged.Tolerations, 1)
+	assert.Equal(t, "general", defaults["default"].NodeSelector["cloud.google.com/gke-nodepool"], "merging does not change the defaults")
+
+	other := transformer.clusterDefaultsFor(schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"})
+	require.NotNil(t, other)
+	assert.Equal(t, "", other.PriorityClassName)
+
+	context, err := clusterDefaultsContext(merged)
+	require.NoError(t, err)
+	assert.Equal(t, "serving", context["priorityClassName"])
+	assert.Equal(t, map[string]interface{}{"cloud.google.com/gke-nodepool": "gpu"}, context["nodeSelector"])
+}
+
+func TestApplyClusterDefaults(t *testing.T) {
+	defaults, err := ParseClusterDefaults(map[string]string{"default": `
+nodeSelector:
+  cloud.google.com/gke-nodepool: general
+  kubernetes.io/os: linux
+tolerations:
+- key: dedicated
+  operator: Equal
+  value: karo
+  effect: NoSchedule
+priorityClassName: batch
+imagePullSecrets: [registry]
+`})
+	require.NoError(t, err)
+	merged := defaults["default"]
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "llama"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"nodeSelector":      map[string]interface{}{"cloud.google.com/gke-nodepool": "gpu"},
+			"priorityClassName": "serving",
+			"tolerations": []interface{}{
+				map[string]interface{}{"key": "dedicated", "operator": "Equal", "value": "karo", "effect": "NoSchedule"},
+			},
+		}}},
+	}}
+	require.NoError(t, applyClusterDefaults(deployment, &merged))
+	podSpec, _, _ := unstructured.NestedMap(deployment.Object, "spec", "template", "spec")
+	assert.Equal(t, map[string]interface{}{"cloud.google.com/gke-nodepool": "gpu", "kubernetes.io/os": "linux"}, podSpec["nodeSelector"], "templates take precedence")
+	assert.Equal(t, "serving", podSpec["priorityClassName"])
+	assert.Len(t, podSpec["tolerations"], 1)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "registry"}}, podSpec["imagePullSecrets"])
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "sync"},
+		"spec":       map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{}}},
+	}}
+	require.NoError(t, applyClusterDefaults(job, &merged))
+	podSpec, _, _ = unstructured.NestedMap(job.Object, "spec", "template", "spec")
+	assert.Equal(t, "batch", podSpec["priorityClassName"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "dedicated", "operator": "Equal", "value": "karo", "effect": "NoSchedule"}}, podSpec["tolerations"])
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Service", "spec": map[string]interface{}{}}}
+	require.NoError(t, applyClusterDefaults(service, &merged))
+	assert.Equal(t, map[string]interface{}{}, service.Object["spec"])
+}
@@ -0,0 +1,69 @@
+package transformer
+
+import (
+	"strings"
+	"sync"
+)
+
+// ClusterInfo is the metadata of the cluster that templates can read as
+// .cluster, e.g. to compute regional endpoints or Workload Identity
+// annotations without a fork of the templates per cluster. Fields that
+// could not be discovered are empty.
+type ClusterInfo struct {
+	ProjectID string `json:"projectID,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Location is the region of a regional cluster or the zone of a zonal
+	// one, e.g. "us-central1" or "us-central1-a".
+	Location  string `json:"location,omitempty"`
+	Autopilot bool   `json:"autopilot"`
+	// Version is the version of the API server, e.g. "v1.30.5-gke.1014001".
+	Version string `json:"version,omitempty"`
+}
+
+// clusterInfo holds the cluster metadata, see SetClusterInfo.
+type clusterInfo struct {
+	m    sync.RWMutex
+	info *ClusterInfo
+}
+
+// SetClusterInfo replaces the cluster metadata. Nil removes it. It may be
+// called while resources are rendered; renders that already started keep the
+// previous metadata.
+func (t *Transformer) SetClusterInfo(info *ClusterInfo) {
+	t.clusterInfo.m.Lock()
+	defer t.clusterInfo.m.Unlock()
+	t.clusterInfo.info = info
+}
+
+// clusterContext returns the cluster metadata as the templates see it: the
+// fields of ClusterInfo and the region of its location. It is empty while no
+// metadata was set.
+func (t *Transformer) clusterContext() map[string]interface{} {
+	t.clusterInfo.m.RLock()
+	defer t.clusterInfo.m.RUnlock()
+	return clusterInfoContext(t.clusterInfo.info)
+}
+
+func clusterInfoContext(info *ClusterInfo) map[string]interface{} {
+	if info == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"projectID": info.ProjectID,
+		"name":      info.Name,
+		"location":  info.Location,
+		"region":    ClusterRegion(info.Location),
+		"autopilot": info.Autopilot,
+		"version":   info.Version,
+	}
+}
+
+// ClusterRegion returns the region of a GKE location: the location itself if
+// it is a region, e.g. "us-central1", or without its zone suffix if it is a
+// zone, e.g. "us-central1-a".
+func ClusterRegion(location string) string {
+	if strings.Count(location, "-") < 2 {
+		return location
+	}
+	return location[:strings.LastIndex(location, "-")]
+}
@@ -0,0 +1,32 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterRegion(t *testing.T) {
+	assert.Equal(t, "us-central1", ClusterRegion("us-central1"))
+	assert.Equal(t, "us-central1", ClusterRegion("us-central1-a"))
+	assert.Equal(t, "europe-west4", ClusterRegion("europe-west4-b"))
+	assert.Empty(t, ClusterRegion(""))
+}
+
+func TestClusterContext(t *testing.T) {
+	transformer := NewTransformer()
+	assert.Equal(t, map[string]interface{}{}, transformer.clusterContext())
+
+	transformer.SetClusterInfo(&ClusterInfo{ProjectID: "my-project", Name: "serving", Location: "us-central1-a", Version: "v1.30.5-gke.1014001"})
+	assert.Equal(t, map[string]interface{}{
+		"projectID": "my-project",
+		"name":      "serving",
+		"location":  "us-central1-a",
+		"region":    "us-central1",
+		"autopilot": false,
+		"version":   "v1.30.5-gke.1014001",
+	}, transformer.clusterContext())
+
+	transformer.SetClusterInfo(nil)
+	assert.Equal(t, map[string]interface{}{}, transformer.clusterContext())
+}
@@ -0,0 +1,72 @@
+package transformer
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyCommonMetadata adds an integration's common labels and annotations to
+// the object and to the metadata of every pod template it contains. Values set
+// by the templates take precedence. Selectors are left alone because they are
+// immutable on most workloads.
+func applyCommonMetadata(obj *unstructured.Unstructured, labels, annotations map[string]string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+	obj.SetLabels(mergeMissing(obj.GetLabels(), labels))
+	obj.SetAnnotations(mergeMissing(obj.GetAnnotations(), annotations))
+
+	for _, path := range podSpecPaths[obj.GetKind()] {
+		if len(path) < 2 {
+			// The object is the pod itself.
+			continue
+		}
+		templatePath := path[:len(path)-1]
+		template, found, err := unstructured.NestedFieldNoCopy(obj.Object, templatePath...)
+		if err != nil || !found {
+			continue
+		}
+		templateMap, ok := template.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("pod template of %s %s is not an object", obj.GetKind(), obj.GetName())
+		}
+		metadata, _ := templateMap["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+			templateMap["metadata"] = metadata
+		}
+		for field, values := range map[string]map[string]string{"labels": labels, "annotations": annotations} {
+			if len(values) == 0 {
+				continue
+			}
+			existing, _ := metadata[field].(map[string]interface{})
+			if existing == nil {
+				existing = map[string]interface{}{}
+				metadata[field] = existing
+			}
+			for key, value := range values {
+				if _, set := existing[key]; !set {
+					existing[key] = value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mergeMissing returns existing with the keys from common that it lacks.
+func mergeMissing(existing, common map[string]string) map[string]string {
+	if len(common) == 0 {
+		return existing
+	}
+	if existing == nil {
+		existing = make(map[string]string, len(common))
+	}
+	for key, value := range common {
+		if _, set := existing[key]; !set {
+			existing[key] = value
+		}
+	}
+	return existing
+}
@@ -0,0 +1,55 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyCommonMetadata(t *testing.T) {
+	labels := map[string]string{"team": "ml", "managed-by": "karo"}
+	annotations := map[string]string{"cost-center": "1234"}
+
+	t.Run("injects into object and pod template", func(t *testing.T) {
+		obj := newTestDeploymentWithPodSpec(map[string]interface{}{})
+		require.NoError(t, applyCommonMetadata(obj, labels, annotations))
+
+		assert.Equal(t, labels, obj.GetLabels())
+		assert.Equal(t, annotations, obj.GetAnnotations())
+		podLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+		assert.Equal(t, labels, podLabels)
+		podAnnotations, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "annotations")
+		assert.Equal(t, annotations, podAnnotations)
+		_, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "selector")
+		assert.False(t, found, "selectors must not be changed")
+	})
+
+	t.Run("template values take precedence", func(t *testing.T) {
+		obj := newTestDeploymentWithPodSpec(map[string]interface{}{})
+		obj.SetLabels(map[string]string{"team": "serving"})
+		require.NoError(t, unstructured.SetNestedStringMap(obj.Object, map[string]string{"app": "web", "team": "serving"}, "spec", "template", "metadata", "labels"))
+		require.NoError(t, applyCommonMetadata(obj, labels, nil))
+
+		assert.Equal(t, map[string]string{"team": "serving", "managed-by": "karo"}, obj.GetLabels())
+		podLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+		assert.Equal(t, map[string]string{"app": "web", "team": "serving", "managed-by": "karo"}, podLabels)
+		assert.Empty(t, obj.GetAnnotations())
+	})
+
+	t.Run("non-workload objects get object metadata only", func(t *testing.T) {
+		obj := newTestObject("", "v1", "ConfigMap", "config")
+		require.NoError(t, applyCommonMetadata(obj, labels, annotations))
+		assert.Equal(t, labels, obj.GetLabels())
+		assert.Equal(t, annotations, obj.GetAnnotations())
+	})
+
+	t.Run("no-op without common metadata", func(t *testing.T) {
+		obj := newTestDeploymentWithPodSpec(map[string]interface{}{})
+		require.NoError(t, applyCommonMetadata(obj, nil, nil))
+		assert.Nil(t, obj.GetLabels())
+		_, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "template", "metadata")
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,80 @@
+package transformer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ConfigChecksumAnnotation is set on the pod template of rendered Deployments
+// to a checksum of the rendered ConfigMaps and Secrets that its pods use, so
+// that a change of their content rolls out the pods.
+const ConfigChecksumAnnotation = "model.skippy.io/config-checksum"
+
+// SetConfigChecksums sets whether the pod templates of rendered Deployments
+// are annotated with a checksum of the rendered ConfigMaps and Secrets they
+// use, see ConfigChecksumAnnotation.
+func (t *Transformer) SetConfigChecksums(enabled bool) {
+	t.configChecksums = enabled
+}
+
+// injectConfigChecksums annotates the pod templates of the Deployments of
+// objs with a checksum of the ConfigMaps and Secrets of objs that they use.
+// ConfigMaps and Secrets that are not rendered, e.g. credentials created by
+// users, are not part of the checksum.
+func injectConfigChecksums(objs []*unstructured.Unstructured) error {
+	contents := map[string]interface{}{}
+	for _, obj := range objs {
+		if obj.GetAPIVersion() != "v1" {
+			continue
+		}
+		key := obj.GetNamespace() + "/" + obj.GetKind() + "/" + obj.GetName()
+		switch obj.GetKind() {
+		case "ConfigMap":
+			contents[key] = map[string]interface{}{"data": obj.Object["data"], "binaryData": obj.Object["binaryData"]}
+		case "Secret":
+			data, err := SecretData(obj)
+			if err != nil {
+				return err
+			}
+			contents[key] = map[string]interface{}{"data": data, "type": obj.Object["type"]}
+		}
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+	for _, obj := range objs {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "template", "spec")
+		podSpec, ok := rawPodSpec.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		used := map[string]interface{}{}
+		visitConfigReferences(podSpec, func(kind string, ref map[string]interface{}, field string) {
+			name, _ := ref[field].(string)
+			key := obj.GetNamespace() + "/" + kind + "/" + name
+			if content, ok := contents[key]; ok {
+				used[key] = content
+			}
+		})
+		if len(used) == 0 {
+			continue
+		}
+		// Maps are encoded with sorted keys.
+		encoded, err := json.Marshal(used)
+		if err != nil {
+			return fmt.Errorf("unable to encode the configuration of Deployment %s: %w", obj.GetName(), err)
+		}
+		checksum := sha256.Sum256(encoded)
+		if err := unstructured.SetNestedField(obj.Object, hex.EncodeToString(checksum[:]), "spec", "template", "metadata", "annotations", ConfigChecksumAnnotation); err != nil {
+			return fmt.Errorf("unable to annotate the pod template of Deployment %s: %w", obj.GetName(), err)
+		}
+	}
+	return nil
+}
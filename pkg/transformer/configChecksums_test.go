@@ -0,0 +1,69 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInjectConfigChecksums(t *testing.T) {
+	newConfigMap := func(value string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "server-config", "namespace": "default"},
+			"data":       map[string]interface{}{"config.yaml": value},
+		}}
+	}
+	newDeployment := func(configMap string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": "server"}},
+				"volumes": []interface{}{map[string]interface{}{
+					"name":      "config",
+					"configMap": map[string]interface{}{"name": configMap},
+				}},
+			}}},
+		}}
+	}
+	checksum := func(deployment *unstructured.Unstructured) string {
+		value, _, _ := unstructured.NestedString(deployment.Object, "spec", "template", "metadata", "annotations", ConfigChecksumAnnotation)
+		return value
+	}
+
+	deployment := newDeployment("server-config")
+	require.NoError(t, injectConfigChecksums([]*unstructured.Unstructured{newConfigMap("port: 8000"), deployment}))
+	first := checksum(deployment)
+	assert.Len(t, first, 64)
+
+	same := newDeployment("server-config")
+	require.NoError(t, injectConfigChecksums([]*unstructured.Unstructured{newConfigMap("port: 8000"), same}))
+	assert.Equal(t, first, checksum(same))
+
+	changed := newDeployment("server-config")
+	require.NoError(t, injectConfigChecksums([]*unstructured.Unstructured{newConfigMap("port: 9000"), changed}))
+	assert.NotEqual(t, first, checksum(changed))
+
+	// ConfigMaps that are not rendered are not part of the checksum.
+	unrelated := newDeployment("user-config")
+	require.NoError(t, injectConfigChecksums([]*unstructured.Unstructured{newConfigMap("port: 8000"), unrelated}))
+	assert.Empty(t, checksum(unrelated))
+
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "hf-token", "namespace": "default"},
+		"stringData": map[string]interface{}{"hf_token": "token"},
+	}}
+	withSecret := newDeployment("server-config")
+	containers, _, _ := unstructured.NestedSlice(withSecret.Object, "spec", "template", "spec", "containers")
+	containers[0].(map[string]interface{})["envFrom"] = []interface{}{map[string]interface{}{"secretRef": map[string]interface{}{"name": "hf-token"}}}
+	require.NoError(t, unstructured.SetNestedSlice(withSecret.Object, containers, "spec", "template", "spec", "containers"))
+	require.NoError(t, injectConfigChecksums([]*unstructured.Unstructured{newConfigMap("port: 8000"), secret, withSecret}))
+	assert.NotEqual(t, first, checksum(withSecret))
+}
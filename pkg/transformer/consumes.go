@@ -0,0 +1,129 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// findConsumedResources reads the resources that the consume rules of the
+// integration of obj select, and their consumed dependents. A consumed
+// resource that does not exist fails the render, so that templates are not
+// rendered without the output they read. Dependents that do not exist yet are
+// left out.
+func (t *Transformer) findConsumedResources(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	var consumed []*unstructured.Unstructured
+	integrationSpec, _ := t.registry.GetIntegrationSpec(obj.GroupVersionKind())
+	for _, rule := range integrationSpec.Consumes {
+		name := obj.GetName()
+		if rule.NamePath != "" {
+			name, _, _ = unstructured.NestedString(obj.Object, strings.Split(rule.NamePath, ".")...)
+			if name == "" {
+				continue
+			}
+		}
+		gvk := schema.GroupVersionKind{Group: rule.Group, Version: rule.Version, Kind: rule.Kind}
+		gvr, err := resourceFor(discoveryClient, gvk)
+		if err != nil {
+			return nil, err
+		}
+		resource, err := dynamicClient.Resource(gvr).Namespace(obj.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get consumed %s %s/%s: %w", rule.Kind, obj.GetNamespace(), name, err)
+		}
+		consumed = append(consumed, resource)
+
+		dependents, err := t.consumedDependents(ctx, discoveryClient, dynamicClient, resource, rule.Dependents)
+		if err != nil {
+			return nil, err
+		}
+		consumed = append(consumed, dependents...)
+	}
+	return consumed, nil
+}
+
+// DependentInventoryKey is the key of the dependents in the ConfigMap named
+// by status.dependentInventory of a resource, which holds all of them if
+// status.dependentResources holds only some.
+const DependentInventoryKey = "dependentResources.json"
+
+// consumedDependents reads the dependents of resource, as recorded in its
+// status.dependentResources or dependent inventory, whose kinds are listed in
+// kinds.
+func (t *Transformer) consumedDependents(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, resource *unstructured.Unstructured, kinds []modelv1.IntegrationConsumedDependentSpec) ([]*unstructured.Unstructured, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	recorded, _, _ := unstructured.NestedSlice(resource.Object, "status", "dependentResources")
+	if name, found, _ := unstructured.NestedString(resource.Object, "status", "dependentInventory"); found {
+		var err error
+		if recorded, err = readDependentInventory(ctx, dynamicClient, resource.GetNamespace(), name); err != nil {
+			return nil, fmt.Errorf("failed to read the dependents of consumed %s %s: %w", resource.GetKind(), resource.GetName(), err)
+		}
+	}
+	var dependents []*unstructured.Unstructured
+	for _, kind := range kinds {
+		var gvr schema.GroupVersionResource
+		for _, entry := range recorded {
+			info, ok := entry.(map[string]interface{})
+			if !ok || info["kind"] != kind.Kind {
+				continue
+			}
+			name, _ := info["name"].(string)
+			namespace, _ := info["namespace"].(string)
+			if gvr.Empty() {
+				var err error
+				if gvr, err = resourceFor(discoveryClient, schema.GroupVersionKind{Group: kind.Group, Version: kind.Version, Kind: kind.Kind}); err != nil {
+					return nil, err
+				}
+			}
+			dependent, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s %s/%s of consumed %s %s: %w", kind.Kind, namespace, name, resource.GetKind(), resource.GetName(), err)
+			}
+			dependents = append(dependents, dependent)
+		}
+	}
+	return dependents, nil
+}
+
+// readDependentInventory reads the dependents in the dependent inventory
+// ConfigMap name.
+func readDependentInventory(ctx context.Context, dynamicClient dynamic.Interface, namespace, name string) ([]interface{}, error) {
+	configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, _, _ := unstructured.NestedString(configMap.Object, "data", DependentInventoryKey)
+	var recorded []interface{}
+	if err := utiljson.Unmarshal([]byte(data), &recorded); err != nil {
+		return nil, fmt.Errorf("invalid dependent inventory %s: %w", name, err)
+	}
+	return recorded, nil
+}
+
+// resourceFor returns the resource of gvk that the API server serves.
+func resourceFor(discoveryClient discovery.DiscoveryInterface, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	apiResourceList, err := discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("error getting API resources for group version: %w", err)
+	}
+	for _, apiResource := range apiResourceList.APIResources {
+		if apiResource.Kind == gvk.Kind && !strings.Contains(apiResource.Name, "/") {
+			return gvk.GroupVersion().WithResource(apiResource.Name), nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("the API server does not serve %s", gvk)
+}
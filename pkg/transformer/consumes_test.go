@@ -0,0 +1,131 @@
+package transformer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestFindConsumedResources(t *testing.T) {
+	evalRunGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "EvalRun"}
+	deploymentGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceDeployment"}
+
+	deployment := newTestObject(deploymentGVK.Group, deploymentGVK.Version, deploymentGVK.Kind, "llama")
+	deployment.SetNamespace("serving")
+	require.NoError(t, unstructured.SetNestedSlice(deployment.Object, []interface{}{
+		map[string]interface{}{"kind": "Service", "name": "llama-svc", "namespace": "serving", "status": "Processed"},
+		map[string]interface{}{"kind": "Service", "name": "llama-gone", "namespace": "serving", "status": "Processed"},
+		map[string]interface{}{"kind": "Deployment", "name": "llama", "namespace": "serving", "status": "Processed"},
+	}, "status", "dependentResources"))
+	service := newTestObject("", "v1", "Service", "llama-svc")
+	service.SetNamespace("serving")
+	require.NoError(t, unstructured.SetNestedField(service.Object, "10.0.0.7", "spec", "clusterIP"))
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		deploymentGVK.GroupVersion().WithResource("inferencedeployments"): "InferenceDeploymentList",
+		{Version: "v1", Resource: "services"}:                             "ServiceList",
+	}, deployment, service)
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{GroupVersion: "model.skippy.io/v1", APIResources: []metav1.APIResource{
+			{Name: "inferencedeployments", Kind: "InferenceDeployment", Namespaced: true},
+			{Name: "inferencedeployments/status", Kind: "InferenceDeployment", Namespaced: true},
+		}},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "services", Kind: "Service", Namespaced: true}}},
+	}
+
+	rule := modelv1.IntegrationConsumeSpec{
+		Group: deploymentGVK.Group, Version: deploymentGVK.Version, Kind: deploymentGVK.Kind,
+		NamePath:   "spec.target",
+		Dependents: []modelv1.IntegrationConsumedDependentSpec{{Version: "v1", Kind: "Service"}},
+	}
+	transformer := NewTransformer()
+	transformer.registry = &mockRegistry{
+		specs: map[schema.GroupVersionKind]modelv1.IntegrationSpec{evalRunGVK: {Consumes: []modelv1.IntegrationConsumeSpec{rule}}},
+	}
+
+	evalRun := newTestObject(evalRunGVK.Group, evalRunGVK.Version, evalRunGVK.Kind, "llama-eval")
+	evalRun.SetNamespace("serving")
+	require.NoError(t, unstructured.SetNestedField(evalRun.Object, "llama", "spec", "target"))
+
+	consumed, err := transformer.findConsumedResources(context.Background(), discoveryClient, dynamicClient, evalRun)
+	require.NoError(t, err)
+	require.Len(t, consumed, 2, "dependents that do not exist and other kinds are left out")
+	assert.Equal(t, "llama", consumed[0].GetName())
+	assert.Equal(t, "llama-svc", consumed[1].GetName())
+
+	t.Run("unset name", func(t *testing.T) {
+		unset := newTestObject(evalRunGVK.Group, evalRunGVK.Version, evalRunGVK.Kind, "llama-eval")
+		consumed, err := transformer.findConsumedResources(context.Background(), discoveryClient, dynamicClient, unset)
+		require.NoError(t, err)
+		assert.Empty(t, consumed)
+	})
+
+	t.Run("same name", func(t *testing.T) {
+		transformer.registry = &mockRegistry{specs: map[schema.GroupVersionKind]modelv1.IntegrationSpec{
+			evalRunGVK: {Consumes: []modelv1.IntegrationConsumeSpec{{Group: deploymentGVK.Group, Version: deploymentGVK.Version, Kind: deploymentGVK.Kind}}},
+		}}
+		sameName := newTestObject(evalRunGVK.Group, evalRunGVK.Version, evalRunGVK.Kind, "llama")
+		sameName.SetNamespace("serving")
+		consumed, err := transformer.findConsumedResources(context.Background(), discoveryClient, dynamicClient, sameName)
+		require.NoError(t, err)
+		require.Len(t, consumed, 1)
+		assert.Equal(t, "InferenceDeployment", consumed[0].GetKind())
+
+		sameName.SetNamespace("other")
+		_, err = transformer.findConsumedResources(context.Background(), discoveryClient, dynamicClient, sameName)
+		assert.ErrorContains(t, err, "failed to get consumed InferenceDeployment other/llama")
+	})
+
+	t.Run("dependent inventory", func(t *testing.T) {
+		limited := deployment.DeepCopy()
+		limited.SetName("gemma")
+		require.NoError(t, unstructured.SetNestedSlice(limited.Object, []interface{}{}, "status", "dependentResources"))
+		require.NoError(t, unstructured.SetNestedField(limited.Object, "gemma-dependents", "status", "dependentInventory"))
+		inventory := newTestObject("", "v1", "ConfigMap", "gemma-dependents")
+		inventory.SetNamespace("serving")
+		require.NoError(t, unstructured.SetNestedField(inventory.Object, `[{"kind":"Service","name":"llama-svc","namespace":"serving","status":"Processed"}]`, "data", DependentInventoryKey))
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			deploymentGVK.GroupVersion().WithResource("inferencedeployments"): "InferenceDeploymentList",
+			{Version: "v1", Resource: "services"}:                             "ServiceList",
+			{Version: "v1", Resource: "configmaps"}:                           "ConfigMapList",
+		}, limited, service, inventory)
+		transformer.registry = &mockRegistry{specs: map[schema.GroupVersionKind]modelv1.IntegrationSpec{evalRunGVK: {Consumes: []modelv1.IntegrationConsumeSpec{rule}}}}
+		gemmaEval := newTestObject(evalRunGVK.Group, evalRunGVK.Version, evalRunGVK.Kind, "gemma-eval")
+		gemmaEval.SetNamespace("serving")
+		require.NoError(t, unstructured.SetNestedField(gemmaEval.Object, "gemma", "spec", "target"))
+
+		consumed, err := transformer.findConsumedResources(context.Background(), discoveryClient, dynamicClient, gemmaEval)
+		require.NoError(t, err)
+		require.Len(t, consumed, 2)
+		assert.Equal(t, "llama-svc", consumed[1].GetName())
+	})
+}
+
+func TestResolveContextConsumedResources(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "EvalRun"}
+	evalRun := newTestObject(gvk.Group, gvk.Version, gvk.Kind, "llama-eval")
+	service := newTestObject("", "v1", "Service", "llama-svc")
+	transformer := NewTransformer()
+	transformer.registry = &mockRegistry{integrations: []schema.GroupVersionKind{gvk}}
+
+	renderContext, err := transformer.ResolveContext(context.Background(), &modelv1.RenderInputs{
+		Primary:   evalRun,
+		Resources: []*unstructured.Unstructured{evalRun},
+		Consumed:  []*unstructured.Unstructured{service},
+	}, modelv1.ResolveOptions{})
+	require.NoError(t, err)
+	resources := renderContext["resources"].(map[string]interface{})
+	assert.Contains(t, resources, "EvalRun/llama-eval")
+	assert.Contains(t, resources, "Service/llama-svc")
+}
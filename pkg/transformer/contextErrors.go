@@ -0,0 +1,125 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxContextErrorBodyLength is the number of characters of an upstream error
+// body that are kept in errors, which end up in events and conditions.
+const maxContextErrorBodyLength = 256
+
+var (
+	// secretPattern matches credentials passed as key/value pairs, e.g.
+	// "access_token": "..." or api_key=...
+	secretPattern = regexp.MustCompile(`(?i)("?(?:access_token|refresh_token|id_token|token|api[_-]?key|apikey|password|passwd|secret|client_secret|authorization)"?\s*[:=]\s*"?)(?:bearer\s+)?[^\s"',&}]+`)
+	// bearerPattern matches bearer tokens outside of key/value pairs.
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9._~+/=-]+`)
+	// jwtPattern matches JSON web tokens.
+	jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// htmlTagPattern matches the tags of HTML error pages.
+	htmlTagPattern = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]+>`)
+)
+
+// ContextRequestError is returned when a context API answers with a status
+// other than 200. It carries a short, redacted summary of the body; the full
+// body is only logged at debug verbosity.
+type ContextRequestError struct {
+	// Name is the name of the context request.
+	Name       string
+	StatusCode int
+	// RetryAfter is the delay requested with a Retry-After header, or zero.
+	RetryAfter time.Duration
+	// Summary is the truncated and redacted body.
+	Summary string
+}
+
+func (e *ContextRequestError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "context request %q failed with status %d", e.Name, e.StatusCode)
+	if text := http.StatusText(e.StatusCode); text != "" {
+		fmt.Fprintf(&b, " (%s)", text)
+	}
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&b, ", retry after %s", e.RetryAfter)
+	}
+	if e.Summary != "" {
+		fmt.Fprintf(&b, ": %s", e.Summary)
+	}
+	return b.String()
+}
+
+// newContextRequestError summarizes a failed context response.
+func newContextRequestError(name string, res *http.Response, body []byte, now time.Time) *ContextRequestError {
+	return &ContextRequestError{
+		Name:       name,
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), now),
+		Summary:    summarizeErrorBody(res.Header.Get("Content-Type"), body),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now).Round(time.Second)
+	}
+	return 0
+}
+
+// summarizeErrorBody returns the message of a JSON error body, or the text
+// of any other body, with credentials redacted and truncated to
+// maxContextErrorBodyLength characters.
+func summarizeErrorBody(contentType string, body []byte) string {
+	text := string(body)
+	if message := jsonErrorMessage(body); message != "" {
+		text = message
+	} else if strings.Contains(contentType, "html") || strings.HasPrefix(strings.TrimSpace(text), "<") {
+		text = htmlTagPattern.ReplaceAllString(text, " ")
+	}
+	text = redactSecrets(strings.Join(strings.Fields(text), " "))
+	if runes := []rune(text); len(runes) > maxContextErrorBodyLength {
+		text = string(runes[:maxContextErrorBodyLength]) + "... (truncated)"
+	}
+	return text
+}
+
+// jsonErrorMessage extracts the message of common JSON error bodies, e.g.
+// {"error": {"message": "..."}} of Google APIs or {"message": "..."}.
+func jsonErrorMessage(body []byte) string {
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return ""
+	}
+	if errorField, ok := decoded["error"].(map[string]any); ok {
+		if message, ok := errorField["message"].(string); ok {
+			return message
+		}
+	}
+	for _, key := range []string{"error_description", "message", "error"} {
+		if message, ok := decoded[key].(string); ok {
+			return message
+		}
+	}
+	return ""
+}
+
+// redactSecrets replaces credentials in text with [REDACTED].
+func redactSecrets(text string) string {
+	text = secretPattern.ReplaceAllString(text, "${1}[REDACTED]")
+	text = bearerPattern.ReplaceAllString(text, "Bearer [REDACTED]")
+	return jwtPattern.ReplaceAllString(text, "[REDACTED]")
+}
@@ -0,0 +1,94 @@
+package transformer
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// shapeContext turns the decoded response of a context request into the
+// value that templates see: the fields of spec.Redact are redacted, the parts
+// picked by spec.Fields are kept, and the result is validated against
+// spec.Schema.
+func shapeContext(spec modelv1.IntegrationApiContextSpec, body any) (any, error) {
+	for _, path := range spec.Redact {
+		redactField(body, strings.Split(path, "."))
+	}
+
+	if len(spec.Fields) > 0 {
+		projected := map[string]interface{}{}
+		for _, field := range spec.Fields {
+			value, found, err := pickField(body, field)
+			if err != nil {
+				return nil, fmt.Errorf("context %s: field %s: %v", spec.Name, field.Name, err)
+			}
+			if found {
+				projected[field.Name] = value
+			}
+		}
+		body = projected
+	}
+
+	if spec.Schema != nil {
+		if err := validateSchema(body, spec.Schema, spec.Name); err != nil {
+			return nil, fmt.Errorf("context %s does not match its schema: %v", spec.Name, err)
+		}
+	}
+	return body, nil
+}
+
+// redactField replaces the value at path in value with the redacted
+// placeholder, in every element of the lists along the path.
+func redactField(value any, path []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			v[path[0]] = redacted
+			return
+		}
+		redactField(child, path[1:])
+	case []interface{}:
+		for _, item := range v {
+			redactField(item, path)
+		}
+	}
+}
+
+// pickField returns the part of value that field selects: a single match as
+// it is, several as a list.
+func pickField(value any, field modelv1.IntegrationContextFieldSpec) (any, bool, error) {
+	expression := field.JSONPath
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	parser := jsonpath.New(field.Name).AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, false, err
+	}
+	results, err := parser.FindResults(value)
+	if err != nil {
+		return nil, false, err
+	}
+	var matches []interface{}
+	for _, result := range results {
+		for _, match := range result {
+			if match.IsValid() && match.CanInterface() {
+				matches = append(matches, match.Interface())
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return matches[0], true, nil
+	}
+	return matches, true, nil
+}
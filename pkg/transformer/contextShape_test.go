@@ -0,0 +1,112 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func decodeJSON(t *testing.T, data string) any {
+	t.Helper()
+	var value any
+	require.NoError(t, json.Unmarshal([]byte(data), &value))
+	return value
+}
+
+func TestShapeContext(t *testing.T) {
+	response := `{
+		"auth": {"token": "s3cr3t", "expires": "soon"},
+		"recommendations": [
+			{"acceleratorType": "nvidia-l4", "apiKey": "k1"},
+			{"acceleratorType": "nvidia-h100-80gb", "apiKey": "k2"}
+		],
+		"model": {"name": "llama", "weights": "huge"}
+	}`
+
+	body, err := shapeContext(modelv1.IntegrationApiContextSpec{
+		Name:   "recommender",
+		Redact: []string{"auth.token", "recommendations.apiKey", "missing.field"},
+	}, decodeJSON(t, response))
+	require.NoError(t, err)
+	assert.Equal(t, decodeJSON(t, `{
+		"auth": {"token": "[REDACTED]", "expires": "soon"},
+		"recommendations": [
+			{"acceleratorType": "nvidia-l4", "apiKey": "[REDACTED]"},
+			{"acceleratorType": "nvidia-h100-80gb", "apiKey": "[REDACTED]"}
+		],
+		"model": {"name": "llama", "weights": "huge"}
+	}`), body)
+
+	body, err = shapeContext(modelv1.IntegrationApiContextSpec{
+		Name:   "recommender",
+		Redact: []string{"auth"},
+		Fields: []modelv1.IntegrationContextFieldSpec{
+			{Name: "accelerators", JSONPath: "{.recommendations[*].acceleratorType}"},
+			{Name: "model", JSONPath: ".model.name"},
+			{Name: "auth", JSONPath: "{.auth}"},
+			{Name: "absent", JSONPath: "{.nothing.here}"},
+		},
+	}, decodeJSON(t, response))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"accelerators": []interface{}{"nvidia-l4", "nvidia-h100-80gb"},
+		"model":        "llama",
+		"auth":         "[REDACTED]",
+	}, body, "projections see the redacted response and leave out what they do not find")
+
+	_, err = shapeContext(modelv1.IntegrationApiContextSpec{
+		Name:   "recommender",
+		Fields: []modelv1.IntegrationContextFieldSpec{{Name: "broken", JSONPath: "{.recommendations["}},
+	}, decodeJSON(t, response))
+	assert.ErrorContains(t, err, "context recommender: field broken")
+}
+
+func TestShapeContextSchema(t *testing.T) {
+	spec := modelv1.IntegrationApiContextSpec{
+		Name:   "model",
+		Fields: []modelv1.IntegrationContextFieldSpec{{Name: "name", JSONPath: "{.model.name}"}},
+		Schema: &apiextensionsv1.JSONSchemaProps{
+			Type:     "object",
+			Required: []string{"name"},
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"name": {Type: "string"},
+			},
+		},
+	}
+
+	body, err := shapeContext(spec, decodeJSON(t, `{"model": {"name": "llama"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "llama"}, body)
+
+	_, err = shapeContext(spec, decodeJSON(t, `{"model": {"id": "llama"}}`))
+	assert.ErrorContains(t, err, "context model does not match its schema")
+	_, err = shapeContext(spec, decodeJSON(t, `{"model": {"name": 3}}`))
+	assert.ErrorContains(t, err, "context model does not match its schema")
+}
+
+func TestFetchContextMaxBytes(t *testing.T) {
+	newClient := func() *http.Client {
+		return &http.Client{Transport: &MockRoundTripper{
+			Response: &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"name": "llama"}`)),
+			},
+		}}
+	}
+
+	_, err := fetchContext(context.Background(), newClient(), "model", "GET", "https://example.com/models/llama", 10)
+	assert.EqualError(t, err, "context model: the response is larger than 10 bytes")
+
+	body, err := fetchContext(context.Background(), newClient(), "model", "GET", "https://example.com/models/llama", 17)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "llama"}, body)
+}
@@ -0,0 +1,159 @@
+package transformer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// ContextTransportOptions configure how the context requests of the
+// integrations reach their APIs, e.g. through a corporate proxy to internal
+// services with a private CA. They only apply to context requests, so the
+// proxy does not have to exempt the Kubernetes API server.
+type ContextTransportOptions struct {
+	// HTTPProxy and HTTPSProxy are the proxies of http and https requests,
+	// HTTP_PROXY and HTTPS_PROXY by default.
+	HTTPProxy  string
+	HTTPSProxy string
+	// NoProxy lists the hosts, domains and CIDRs that are reached directly,
+	// separated by commas, NO_PROXY by default.
+	NoProxy string
+	// CABundle holds PEM encoded CA certificates that are trusted in
+	// addition to the system roots.
+	CABundle []byte
+}
+
+// NewContextTransport returns the transport of context requests.
+func NewContextTransport(opts ContextTransportOptions) (*http.Transport, error) {
+	proxy := httpproxy.FromEnvironment()
+	if opts.HTTPProxy != "" {
+		proxy.HTTPProxy = opts.HTTPProxy
+	}
+	if opts.HTTPSProxy != "" {
+		proxy.HTTPSProxy = opts.HTTPSProxy
+	}
+	if opts.NoProxy != "" {
+		proxy.NoProxy = opts.NoProxy
+	}
+	for _, proxyURL := range []string{proxy.HTTPProxy, proxy.HTTPSProxy} {
+		if proxyURL == "" {
+			continue
+		}
+		if _, err := url.Parse(proxyURL); err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", proxyURL, err)
+		}
+	}
+	proxyFunc := proxy.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	if len(opts.CABundle) > 0 {
+		roots, err := certPool(nil, opts.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = roots
+	}
+	return transport, nil
+}
+
+// NewContextHTTPClient returns a client that sends context requests with
+// transport and the operator's Google credentials, like the default client
+// of the IntegrationRegistry. Tokens are fetched through transport as well.
+func NewContextHTTPClient(ctx context.Context, transport http.RoundTripper) (*http.Client, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	return google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+}
+
+// SetContextTransport sends the context requests of the integrations with the
+// transport of opts. Without Google credentials, e.g. on-prem, they are sent
+// unauthenticated.
+func (t *Transformer) SetContextTransport(ctx context.Context, opts ContextTransportOptions) error {
+	registry, ok := t.registry.(*IntegrationRegistry)
+	if !ok {
+		return nil
+	}
+	transport, err := NewContextTransport(opts)
+	if err != nil {
+		return err
+	}
+	client, err := NewContextHTTPClient(ctx, transport)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to find Google credentials, sending context requests without them")
+		client = &http.Client{Transport: transport}
+	}
+	registry.SetHTTPClient(client)
+	return nil
+}
+
+// contextTLSClient returns a copy of client whose connections are verified
+// as spec says. client's transport must be an *http.Transport, possibly
+// wrapped in an *oauth2.Transport.
+func contextTLSClient(client *http.Client, spec modelv1.IntegrationContextTLSSpec) (*http.Client, error) {
+	base := client.Transport
+	wrap := func(transport http.RoundTripper) http.RoundTripper { return transport }
+	if authenticated, ok := base.(*oauth2.Transport); ok {
+		base = authenticated.Base
+		wrap = func(transport http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{Source: authenticated.Source, Base: transport}
+		}
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpTransport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("tls options are not supported with a %T transport", base)
+	}
+
+	httpTransport = httpTransport.Clone()
+	if httpTransport.TLSClientConfig == nil {
+		httpTransport.TLSClientConfig = &tls.Config{}
+	}
+	if spec.CABundle != "" {
+		roots, err := certPool(httpTransport.TLSClientConfig.RootCAs, []byte(spec.CABundle))
+		if err != nil {
+			return nil, err
+		}
+		httpTransport.TLSClientConfig.RootCAs = roots
+	}
+	if spec.ServerName != "" {
+		httpTransport.TLSClientConfig.ServerName = spec.ServerName
+	}
+	httpTransport.TLSClientConfig.InsecureSkipVerify = spec.InsecureSkipVerify
+
+	tlsClient := *client
+	tlsClient.Transport = wrap(httpTransport)
+	return &tlsClient, nil
+}
+
+// certPool returns roots, or the system roots if nil, with the certificates
+// of bundle added.
+func certPool(roots *x509.CertPool, bundle []byte) (*x509.CertPool, error) {
+	if roots != nil {
+		roots = roots.Clone()
+	} else if system, err := x509.SystemCertPool(); err == nil {
+		roots = system
+	} else {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("the CA bundle holds no PEM encoded certificates")
+	}
+	return roots, nil
+}
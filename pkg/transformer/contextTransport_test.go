@@ -0,0 +1,106 @@
+package transformer
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestNewContextTransport(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("NO_PROXY", "")
+
+	proxyOf := func(transport *http.Transport, rawURL string) string {
+		requestURL, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		proxy, err := transport.Proxy(&http.Request{URL: requestURL})
+		require.NoError(t, err)
+		if proxy == nil {
+			return ""
+		}
+		return proxy.String()
+	}
+
+	transport, err := NewContextTransport(ContextTransportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "http://env-proxy:3128", proxyOf(transport, "https://recommender.internal/models"))
+	assert.Equal(t, "", proxyOf(transport, "http://recommender.internal/models"))
+	if transport.TLSClientConfig != nil {
+		assert.Nil(t, transport.TLSClientConfig.RootCAs, "the system roots are used")
+	}
+
+	transport, err = NewContextTransport(ContextTransportOptions{HTTPSProxy: "http://proxy.corp:8080", NoProxy: ".svc.cluster.local,10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.corp:8080", proxyOf(transport, "https://recommender.internal/models"))
+	assert.Equal(t, "", proxyOf(transport, "https://recommender.default.svc.cluster.local/models"))
+	assert.Equal(t, "", proxyOf(transport, "https://10.1.2.3/models"))
+
+	_, err = NewContextTransport(ContextTransportOptions{CABundle: []byte("not a certificate")})
+	assert.ErrorContains(t, err, "no PEM encoded certificates")
+}
+
+func TestContextTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"model": "gemma"}`))
+	}))
+	defer server.Close()
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	transport, err := NewContextTransport(ContextTransportOptions{})
+	require.NoError(t, err)
+	reg := newTestRegistry()
+	reg.SetHTTPClient(&http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), Base: transport}})
+
+	resolve := func(tls *modelv1.IntegrationContextTLSSpec) (map[string]any, error) {
+		reg.SetIntegrations([]modelv1.IntegrationSpec{{
+			Group: "model.skippy.io", Version: "v1", Kind: "Model",
+			Context: []modelv1.IntegrationApiContextSpec{{
+				Name:    "recommendation",
+				Request: modelv1.IntegrationApiContextRequestSpec{Method: "GET", Path: server.URL},
+				TLS:     tls,
+			}},
+		}})
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion("model.skippy.io/v1")
+		resource.SetKind("Model")
+		output := map[string]any{}
+		return output, reg.ResolveContext(context.Background(), resource, output, false)
+	}
+
+	_, err = resolve(nil)
+	assert.ErrorContains(t, err, "certificate", "the test server's CA is not trusted by default")
+
+	output, err := resolve(&modelv1.IntegrationContextTLSSpec{CABundle: caBundle, ServerName: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"model": "gemma"}, output["recommendation"])
+
+	output, err = resolve(&modelv1.IntegrationContextTLSSpec{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"model": "gemma"}, output["recommendation"])
+
+	_, err = resolve(&modelv1.IntegrationContextTLSSpec{CABundle: caBundle, ServerName: "example.org"})
+	assert.ErrorContains(t, err, "example.org")
+
+	tlsClient, err := reg.contextClient(reg.httpClient, &modelv1.IntegrationContextTLSSpec{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	_, isAuthenticated := tlsClient.Transport.(*oauth2.Transport)
+	assert.True(t, isAuthenticated, "requests with TLS options keep the credentials")
+	sameClient, err := reg.contextClient(reg.httpClient, &modelv1.IntegrationContextTLSSpec{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.Same(t, tlsClient, sameClient)
+
+	reg.SetHTTPClient(&http.Client{Transport: &MockRoundTripper{}})
+	_, err = resolve(&modelv1.IntegrationContextTLSSpec{InsecureSkipVerify: true})
+	assert.ErrorContains(t, err, "tls options are not supported")
+}
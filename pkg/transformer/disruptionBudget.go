@@ -0,0 +1,67 @@
+package transformer
+
+import (
+	"fmt"
+	"math"
+)
+
+// podDisruptionBudgetFor returns a policy/v1 PodDisruptionBudget for the pods
+// of a workload that runs replicas pods, or at least replicas pods when it
+// autoscales, e.g.
+//
+//	{{ podDisruptionBudgetFor (dict "name" $name "namespace" .resource.metadata.namespace) .resource.spec.replicas (dict "app" $name) | toJson }}
+//
+// Node upgrades may evict a quarter of the replicas at a time, like the
+// default rolling update of a Deployment, and at least one, so that a single
+// replica never blocks a node drain. Pods that are not ready may always be
+// evicted, as they serve no traffic.
+func podDisruptionBudgetFor(target map[string]interface{}, replicas interface{}, matchLabels map[string]interface{}) (map[string]interface{}, error) {
+	name, _ := target["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("disruption budget target has no name")
+	}
+	if len(matchLabels) == 0 {
+		return nil, fmt.Errorf("disruption budget for %s has no labels to select pods", name)
+	}
+	count, err := replicaCount(replicas)
+	if err != nil {
+		return nil, fmt.Errorf("disruption budget for %s: %w", name, err)
+	}
+
+	metadata := map[string]interface{}{"name": name}
+	if namespace, _ := target["namespace"].(string); namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "PodDisruptionBudget",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"maxUnavailable":             max(1, count/4),
+			"selector":                   map[string]interface{}{"matchLabels": matchLabels},
+			"unhealthyPodEvictionPolicy": "AlwaysAllow",
+		},
+	}, nil
+}
+
+// replicaCount converts a replica count from a template, which may be any
+// number type, to an int.
+func replicaCount(replicas interface{}) (int, error) {
+	var count float64
+	switch v := replicas.(type) {
+	case int:
+		count = float64(v)
+	case int32:
+		count = float64(v)
+	case int64:
+		count = float64(v)
+	case float64:
+		count = v
+	default:
+		return 0, fmt.Errorf("replicas must be a number, got %T", replicas)
+	}
+	if count < 0 || count != math.Trunc(count) {
+		return 0, fmt.Errorf("replicas must be a non-negative integer, got %v", replicas)
+	}
+	return int(count), nil
+}
@@ -0,0 +1,46 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodDisruptionBudgetFor(t *testing.T) {
+	target := map[string]interface{}{"name": "vllm", "namespace": "ml"}
+	labels := map[string]interface{}{"app": "vllm"}
+
+	for _, tc := range []struct {
+		replicas               interface{}
+		expectedMaxUnavailable int
+	}{
+		{0, 1},
+		{1, 1},
+		{int64(3), 1},
+		{float64(8), 2},
+		{int32(10), 2},
+	} {
+		pdb, err := podDisruptionBudgetFor(target, tc.replicas, labels)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"apiVersion": "policy/v1",
+			"kind":       "PodDisruptionBudget",
+			"metadata":   map[string]interface{}{"name": "vllm", "namespace": "ml"},
+			"spec": map[string]interface{}{
+				"maxUnavailable":             tc.expectedMaxUnavailable,
+				"selector":                   map[string]interface{}{"matchLabels": labels},
+				"unhealthyPodEvictionPolicy": "AlwaysAllow",
+			},
+		}, pdb, "replicas %v", tc.replicas)
+	}
+
+	_, err := podDisruptionBudgetFor(map[string]interface{}{}, 1, labels)
+	assert.ErrorContains(t, err, "has no name")
+	_, err = podDisruptionBudgetFor(target, 1, nil)
+	assert.ErrorContains(t, err, "has no labels to select pods")
+	_, err = podDisruptionBudgetFor(target, "2", labels)
+	assert.ErrorContains(t, err, "replicas must be a number, got string")
+	_, err = podDisruptionBudgetFor(target, 1.5, labels)
+	assert.ErrorContains(t, err, "non-negative integer")
+}
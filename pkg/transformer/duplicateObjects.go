@@ -0,0 +1,90 @@
+package transformer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DuplicateObjectError is returned when two rendered files hold objects with
+// the same group, kind, namespace and name, e.g. because the templates of two
+// connected resources render the same Service. Kustomize would reject them
+// with an "already registered id" error that names neither file.
+type DuplicateObjectError struct {
+	// Object is the kind, namespace and name of the objects.
+	Object string
+	// First and Second are the rendered files, relative to the render root,
+	// i.e. the namespace and name of the resource that the template was
+	// rendered for and the path of the template.
+	First, Second string
+}
+
+func (e *DuplicateObjectError) Error() string {
+	if e.First == e.Second {
+		return fmt.Sprintf("%s is rendered twice by %s", e.Object, e.First)
+	}
+	return fmt.Sprintf("%s is rendered by both %s and %s", e.Object, e.First, e.Second)
+}
+
+// checkDuplicateObjects returns a RenderError with a DuplicateObjectError if
+// two of the rendered resource files under root hold the same object. The
+// directories of bundles that are built as they are, are not checked.
+func checkDuplicateObjects(root string, resources []string) error {
+	rendered := map[string]string{}
+	for _, file := range resources {
+		fullPath := filepath.Join(root, file)
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return fmt.Errorf("unable to read rendered file %s: %w", file, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			return fmt.Errorf("unable to read rendered file %s: %w", file, err)
+		}
+		objs, err := decodeObjects(data)
+		if err != nil {
+			// Kustomize reports the invalid YAML.
+			return nil
+		}
+		for _, u := range objs {
+			key := u.GroupVersionKind().GroupKind().String() + " " + u.GetName()
+			if u.GetNamespace() != "" {
+				key = u.GroupVersionKind().GroupKind().String() + " " + u.GetNamespace() + "/" + u.GetName()
+			}
+			if first, found := rendered[key]; found {
+				return &RenderError{Path: file, Err: &DuplicateObjectError{Object: key, First: first, Second: file}}
+			}
+			rendered[key] = file
+		}
+	}
+	return nil
+}
+
+// decodeObjects returns the objects with a kind and name in a rendered file.
+func decodeObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, err
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		if u.GetKind() == "" || u.GetName() == "" {
+			continue
+		}
+		objs = append(objs, u)
+	}
+}
@@ -0,0 +1,67 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestCheckDuplicateObjects(t *testing.T) {
+	root := t.TempDir()
+	write := func(file, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(content), 0o644))
+	}
+	write("serving/llama/service.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: llama\n  namespace: serving\n")
+	write("serving/llama/deployment.yaml", "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: llama\n  namespace: serving\n")
+	write("serving/gemma/service.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: gemma\n  namespace: serving\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: llama\n  namespace: serving\n")
+	write("serving/other/service.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: llama\n  namespace: other\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "serving/llama/bundle"), 0o755))
+
+	// Objects of other kinds or in other namespaces do not clash, and the
+	// directories of bundles are left to kustomize.
+	assert.NoError(t, checkDuplicateObjects(root, []string{"serving/llama/service.yaml", "serving/llama/deployment.yaml", "serving/other/service.yaml", "serving/llama/bundle"}))
+
+	err := checkDuplicateObjects(root, []string{"serving/llama/service.yaml", "serving/llama/deployment.yaml", "serving/gemma/service.yaml"})
+	var renderErr *RenderError
+	require.ErrorAs(t, err, &renderErr)
+	assert.Equal(t, "serving/gemma/service.yaml", renderErr.Path)
+	var duplicateErr *DuplicateObjectError
+	require.ErrorAs(t, err, &duplicateErr)
+	assert.Equal(t, &DuplicateObjectError{Object: "Service serving/llama", First: "serving/llama/service.yaml", Second: "serving/gemma/service.yaml"}, duplicateErr)
+	assert.EqualError(t, err, "Service serving/llama is rendered by both serving/llama/service.yaml and serving/gemma/service.yaml")
+}
+
+func TestKustomizeDuplicateObjects(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(gvk.Group, gvk.Version, gvk.Kind, "llama")
+	obj.SetNamespace("serving")
+	service := `apiVersion: v1
+kind: Service
+metadata:
+  name: shared
+  namespace: {{ .resource.metadata.namespace }}
+`
+	pipeline := newTestPipeline(t, gvk, map[string]string{"service.yaml": service, "gateway.yaml": service})
+
+	inputs, err := pipeline.DiscoverInputs(ctx, obj, modelv1.DiscoverOptions{})
+	require.NoError(t, err)
+	renderContext, err := pipeline.ResolveContext(ctx, inputs, modelv1.ResolveOptions{})
+	require.NoError(t, err)
+	files, err := pipeline.Render(ctx, inputs, renderContext, modelv1.RenderOptions{})
+	require.NoError(t, err)
+	defer files.Cleanup()
+
+	_, err = pipeline.Kustomize(ctx, files)
+	assert.EqualError(t, err, "cannot run kustomization: Service serving/shared is rendered by both serving/llama/base/gateway.yaml and serving/llama/base/service.yaml")
+	assert.True(t, errors.As(err, new(*DuplicateObjectError)))
+}
@@ -0,0 +1,158 @@
+package transformer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	StorageCredentialsDefault          = "Default"
+	StorageCredentialsWorkloadIdentity = "WorkloadIdentity"
+	StorageCredentialsSecret           = "Secret"
+	StorageCredentialsAnonymous        = "Anonymous"
+
+	// WorkloadIdentityAnnotation names the Google service account of a
+	// Kubernetes ServiceAccount.
+	WorkloadIdentityAnnotation = "iam.gke.io/gcp-service-account"
+
+	defaultCredentialsSecretKey = "key.json"
+	storageReadOnlyScope        = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+var (
+	impersonationTokenSourcesMu sync.Mutex
+	// impersonationTokenSources are the token sources of the impersonated
+	// principals. Reusing them reuses their tokens until they expire, rather
+	// than asking the IAM credentials API for a token on every render.
+	impersonationTokenSources = map[string]*impersonationTokenSource{}
+)
+
+// impersonationTokenSource is a cached token source and when it was last
+// used. Those unused for gcsClientIdleTimeout are removed, like the storage
+// clients that use them.
+type impersonationTokenSource struct {
+	tokenSource oauth2.TokenSource
+	used        time.Time
+}
+
+// impersonatedTokenSource returns the cached token source of principal, or a
+// new one.
+func impersonatedTokenSource(principal string) (oauth2.TokenSource, error) {
+	impersonationTokenSourcesMu.Lock()
+	defer impersonationTokenSourcesMu.Unlock()
+	now := time.Now()
+	for key, cached := range impersonationTokenSources {
+		if key != principal && now.Sub(cached.used) >= gcsClientIdleTimeout {
+			delete(impersonationTokenSources, key)
+		}
+	}
+	cached, ok := impersonationTokenSources[principal]
+	if !ok {
+		// The token source outlives the reconcile, so it must not use its context.
+		tokenSource, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: principal,
+			Scopes:          []string{storageReadOnlyScope},
+		})
+		if err != nil {
+			return nil, err
+		}
+		cached = &impersonationTokenSource{tokenSource: tokenSource}
+		impersonationTokenSources[principal] = cached
+	}
+	cached.used = now
+	return cached.tokenSource, nil
+}
+
+// gcsSource holds the options of the storage client used for a bucket.
+type gcsSource struct {
+	// key identifies the credentials and endpoint. Clients and trees are
+	// cached per key, so that integrations with different credentials never
+	// share them.
+	key     string
+	options []option.ClientOption
+}
+
+// gcsSourceFor returns the storage client options for reading bucket with the
+// storage settings of an integration. A nil spec uses the ambient credentials.
+func gcsSourceFor(ctx context.Context, c client.Client, spec *modelv1.IntegrationStorageSpec, bucket string) (gcsSource, error) {
+	source := gcsSource{}
+	if spec == nil {
+		return source, nil
+	}
+
+	if credentials := spec.Credentials; credentials != nil {
+		switch credentials.Source {
+		case "", StorageCredentialsDefault:
+		case StorageCredentialsAnonymous:
+			source.key = "anonymous"
+			source.options = append(source.options, option.WithoutAuthentication())
+		case StorageCredentialsSecret:
+			ref := credentials.Secret
+			if ref == nil || ref.Name == "" || ref.Namespace == "" {
+				return source, fmt.Errorf("the %s credentials source requires a secret name and namespace", StorageCredentialsSecret)
+			}
+			key := ref.Key
+			if key == "" {
+				key = defaultCredentialsSecretKey
+			}
+			secret := &corev1.Secret{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+				return source, fmt.Errorf("failed to get GCS credentials secret %s/%s: %w", ref.Namespace, ref.Name, err)
+			}
+			data, ok := secret.Data[key]
+			if !ok || len(data) == 0 {
+				return source, fmt.Errorf("GCS credentials secret %s/%s has no key %q", ref.Namespace, ref.Name, key)
+			}
+			// The digest of the key makes a rotated key use a new client.
+			digest := sha256.Sum256(data)
+			source.key = fmt.Sprintf("secret:%s/%s:%s", ref.Namespace, ref.Name, hex.EncodeToString(digest[:]))
+			source.options = append(source.options, option.WithCredentialsJSON(data))
+		case StorageCredentialsWorkloadIdentity:
+			ref := credentials.ServiceAccount
+			if ref == nil || ref.Name == "" || ref.Namespace == "" {
+				return source, fmt.Errorf("the %s credentials source requires a service account name and namespace", StorageCredentialsWorkloadIdentity)
+			}
+			serviceAccount := &corev1.ServiceAccount{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, serviceAccount); err != nil {
+				return source, fmt.Errorf("failed to get service account %s/%s: %w", ref.Namespace, ref.Name, err)
+			}
+			principal := serviceAccount.Annotations[WorkloadIdentityAnnotation]
+			if principal == "" {
+				return source, fmt.Errorf("service account %s/%s has no %s annotation", ref.Namespace, ref.Name, WorkloadIdentityAnnotation)
+			}
+			tokenSource, err := impersonatedTokenSource(principal)
+			if err != nil {
+				return source, fmt.Errorf("failed to impersonate %s: %w", principal, err)
+			}
+			source.key = "impersonate:" + principal
+			source.options = append(source.options, option.WithTokenSource(tokenSource))
+		default:
+			return source, fmt.Errorf("unknown GCS credentials source %q", credentials.Source)
+		}
+	}
+
+	for _, endpoint := range spec.Endpoints {
+		if endpoint.Bucket == bucket {
+			// Objects are read through the JSON API too, as emulators do not
+			// serve the XML API that is used by default.
+			source.key += "|endpoint:" + endpoint.Endpoint
+			source.options = append(source.options, option.WithEndpoint(endpoint.Endpoint), storage.WithJSONReads())
+			break
+		}
+	}
+	return source, nil
+}
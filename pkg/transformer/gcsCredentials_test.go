@@ -0,0 +1,136 @@
+package transformer
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestGCSSourceFor(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(s))
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gcs-key", Namespace: "ml"},
+			Data:       map[string][]byte{"key.json": []byte(`{"type":"service_account"}`), "other.json": []byte(`{"type":"service_account","x":1}`)},
+		},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "ml"}},
+	).Build()
+
+	credentials := func(source string) *modelv1.IntegrationStorageSpec {
+		return &modelv1.IntegrationStorageSpec{Credentials: &modelv1.IntegrationStorageCredentialsSpec{Source: source}}
+	}
+
+	t.Run("ambient credentials", func(t *testing.T) {
+		for _, spec := range []*modelv1.IntegrationStorageSpec{nil, credentials(StorageCredentialsDefault), {}} {
+			source, err := gcsSourceFor(ctx, c, spec, "bucket")
+			require.NoError(t, err)
+			assert.Empty(t, source.key)
+			assert.Empty(t, source.options)
+		}
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		source, err := gcsSourceFor(ctx, c, credentials(StorageCredentialsAnonymous), "bucket")
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", source.key)
+		assert.Len(t, source.options, 1)
+	})
+
+	t.Run("secret", func(t *testing.T) {
+		spec := credentials(StorageCredentialsSecret)
+		spec.Credentials.Secret = &modelv1.IntegrationSecretKeyReference{Name: "gcs-key", Namespace: "ml"}
+		source, err := gcsSourceFor(ctx, c, spec, "bucket")
+		require.NoError(t, err)
+		assert.Contains(t, source.key, "secret:ml/gcs-key:")
+		assert.Len(t, source.options, 1)
+
+		spec.Credentials.Secret.Key = "other.json"
+		other, err := gcsSourceFor(ctx, c, spec, "bucket")
+		require.NoError(t, err)
+		assert.NotEqual(t, source.key, other.key, "different keys use different clients")
+
+		spec.Credentials.Secret.Key = "missing.json"
+		_, err = gcsSourceFor(ctx, c, spec, "bucket")
+		assert.ErrorContains(t, err, `has no key "missing.json"`)
+
+		spec.Credentials.Secret = &modelv1.IntegrationSecretKeyReference{Name: "absent", Namespace: "ml"}
+		_, err = gcsSourceFor(ctx, c, spec, "bucket")
+		assert.ErrorContains(t, err, "failed to get GCS credentials secret ml/absent")
+
+		spec.Credentials.Secret = nil
+		_, err = gcsSourceFor(ctx, c, spec, "bucket")
+		assert.ErrorContains(t, err, "requires a secret name and namespace")
+	})
+
+	t.Run("workload identity", func(t *testing.T) {
+		spec := credentials(StorageCredentialsWorkloadIdentity)
+		spec.Credentials.ServiceAccount = &modelv1.IntegrationObjectReference{Name: "plain", Namespace: "ml"}
+		_, err := gcsSourceFor(ctx, c, spec, "bucket")
+		assert.ErrorContains(t, err, "has no iam.gke.io/gcp-service-account annotation")
+
+		spec.Credentials.ServiceAccount = &modelv1.IntegrationObjectReference{Name: "absent", Namespace: "ml"}
+		_, err = gcsSourceFor(ctx, c, spec, "bucket")
+		assert.ErrorContains(t, err, "failed to get service account ml/absent")
+	})
+
+	t.Run("unknown source", func(t *testing.T) {
+		_, err := gcsSourceFor(ctx, c, credentials("Magic"), "bucket")
+		assert.ErrorContains(t, err, `unknown GCS credentials source "Magic"`)
+	})
+
+	t.Run("endpoint override", func(t *testing.T) {
+		spec := credentials(StorageCredentialsAnonymous)
+		spec.Endpoints = []modelv1.IntegrationStorageEndpointSpec{{Bucket: "emulated", Endpoint: "http://fake-gcs:4443/storage/v1/"}}
+
+		source, err := gcsSourceFor(ctx, c, spec, "emulated")
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous|endpoint:http://fake-gcs:4443/storage/v1/", source.key)
+		assert.Len(t, source.options, 3)
+
+		source, err = gcsSourceFor(ctx, c, spec, "bucket")
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", source.key, "other buckets use the default endpoint")
+	})
+}
+
+func TestGCSTreeCache_EndpointOverride(t *testing.T) {
+	ctx := context.Background()
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "emulated", Name: "v1/service.yaml"}, Content: []byte("kind: Service")},
+		},
+		Host:   "127.0.0.1",
+		Scheme: "http",
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.Stop)
+
+	spec := &modelv1.IntegrationStorageSpec{
+		Credentials: &modelv1.IntegrationStorageCredentialsSpec{Source: StorageCredentialsAnonymous},
+		Endpoints:   []modelv1.IntegrationStorageEndpointSpec{{Bucket: "emulated", Endpoint: server.URL() + "/storage/v1/"}},
+	}
+	source, err := gcsSourceFor(ctx, nil, spec, "emulated")
+	require.NoError(t, err)
+
+	cache := newGCSTreeCache(func(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error) {
+		return storage.NewClient(ctx, opts...)
+	})
+	fs, err := cache.fileSystem(ctx, source, "emulated", "v1")
+	require.NoError(t, err)
+	content, err := fs.ReadFile("v1/service.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Service", string(content))
+}
@@ -4,12 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"path/filepath"
 	"strings"
 
 	"cloud.google.com/go/storage"
-	"google.golang.org/api/iterator"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
@@ -42,39 +40,27 @@ func newGCSFileSystem(client *storage.Client, bucket, rootPath string) (filesys.
 }
 
 func (f *gcsFileSystem) Initialize(ctx context.Context) error {
-	sourceRootPath := fmt.Sprintf("%s/", strings.Trim(f.rootPath, "/"))
-	bucket := f.client.Bucket(f.bucket)
-
-	// Check if the bucket exists
-	_, err := bucket.Attrs(ctx)
+	tree, _, err := fetchGCSTree(ctx, f.client.Bucket(f.bucket), f.bucket, f.rootPath, nil)
 	if err != nil {
-		if errors.Is(err, storage.ErrBucketNotExist) {
-			return fmt.Errorf("bucket %s not found: %w", f.bucket, err)
-		}
-		return fmt.Errorf("failed to get bucket attributes: %w", err)
+		return err
 	}
+	return f.load(tree)
+}
 
-	it := bucket.Objects(ctx, &storage.Query{
-		Prefix: sourceRootPath,
-	})
+// load copies the objects of tree into the in-memory file system.
+func (f *gcsFileSystem) load(tree *gcsTree) error {
+	sourceRootPath := fmt.Sprintf("%s/", strings.Trim(f.rootPath, "/"))
 
 	// Create the "integrations" directory upfront
 	if err := f.memoryFS.MkdirAll(sourceRootPath); err != nil {
 		return fmt.Errorf("failed to create %q directory: %w", sourceRootPath, err)
 	}
 
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to iterate GCS objects: %w", err)
-		}
-
-		relativePath, err := filepath.Rel(sourceRootPath, attrs.Name)
+	for _, name := range tree.names() {
+		object := tree.objects[name]
+		relativePath, err := filepath.Rel(sourceRootPath, name)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path for %s: %w", attrs.Name, err)
+			return fmt.Errorf("failed to get relative path for %s: %w", name, err)
 		}
 
 		if relativePath == "." { //skip source folder itself.
@@ -87,7 +73,7 @@ func (f *gcsFileSystem) Initialize(ctx context.Context) error {
 			return fmt.Errorf("failed to create directory %s: %w", targetDir, err)
 		}
 
-		if attrs.Size == 0 && strings.HasSuffix(attrs.Name, "/") {
+		if object.folder {
 			// Create empty folder in memoryFS
 			if err := f.memoryFS.MkdirAll(targetPath); err != nil {
 				return fmt.Errorf("failed to create empty directory %s: %w", targetPath, err)
@@ -96,23 +82,9 @@ func (f *gcsFileSystem) Initialize(ctx context.Context) error {
 			continue
 		}
 
-		reader, err := bucket.Object(attrs.Name).NewReader(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to create GCS object reader for %s: %w", attrs.Name, err)
-		}
-		defer reader.Close()
-
-		writer, err := f.memoryFS.Create(targetPath)
-		if err != nil {
-			return fmt.Errorf("failed to create file %s: %w", targetPath, err)
-		}
-		defer writer.Close()
-		bytesCopied, err := io.Copy(writer, reader)
-		if err != nil {
-			return fmt.Errorf("failed to copy GCS object %s to %s: %w", attrs.Name, targetPath, err)
+		if err := f.memoryFS.WriteFile(targetPath, object.content); err != nil {
+			return fmt.Errorf("failed to copy GCS object %s to %s: %w", name, targetPath, err)
 		}
-
-		fmt.Println("[DEBUG] Copied bytes", "bytes", bytesCopied, "path", targetPath) //Add this log
 	}
 	return nil
 }
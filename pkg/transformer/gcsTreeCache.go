@@ -0,0 +1,225 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// gcsCacheRefreshInterval is how long a cached GCS template tree is used
+// without checking the bucket for changes.
+const gcsCacheRefreshInterval = 30 * time.Second
+
+// gcsClientIdleTimeout is how long a cached storage client, along with its
+// trees, is kept without being used, e.g. after its credentials were rotated.
+const gcsClientIdleTimeout = time.Hour
+
+var (
+	templateCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "karo_template_cache_lookups_total",
+		Help: "Lookups of GCS template trees by result: hit (served from the cache), revalidated (the bucket was listed and nothing changed) or refreshed (changed objects were downloaded).",
+	}, []string{"result"})
+	templateCacheDownloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "karo_template_cache_object_downloads_total",
+		Help: "GCS template objects downloaded because they were new or their generation changed.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(templateCacheLookups, templateCacheDownloads)
+}
+
+// gcsObject is a GCS object of a template tree.
+type gcsObject struct {
+	generation     int64
+	metageneration int64
+	// folder is set for the zero-size placeholders of empty folders.
+	folder  bool
+	content []byte
+}
+
+// gcsTree is the content of the objects under a GCS prefix.
+type gcsTree struct {
+	fetched time.Time
+	objects map[string]gcsObject
+}
+
+// names returns the names of the objects of the tree in lexical order.
+func (t *gcsTree) names() []string {
+	names := make([]string, 0, len(t.objects))
+	for name := range t.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fetchGCSTree lists the objects under rootPath and downloads them. Objects
+// whose generation and metageneration match those in previous are taken from
+// it instead of being downloaded again. It reports whether the tree differs
+// from previous.
+func fetchGCSTree(ctx context.Context, bucket *storage.BucketHandle, bucketName, rootPath string, previous *gcsTree) (*gcsTree, bool, error) {
+	// Check if the bucket exists
+	if _, err := bucket.Attrs(ctx); err != nil {
+		if errors.Is(err, storage.ErrBucketNotExist) {
+			return nil, false, fmt.Errorf("bucket %s not found: %w", bucketName, err)
+		}
+		return nil, false, fmt.Errorf("failed to get bucket attributes: %w", err)
+	}
+
+	tree := &gcsTree{objects: map[string]gcsObject{}}
+	changed := previous == nil
+	it := bucket.Objects(ctx, &storage.Query{Prefix: fmt.Sprintf("%s/", strings.Trim(rootPath, "/"))})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to iterate GCS objects: %w", err)
+		}
+
+		if attrs.Size == 0 && strings.HasSuffix(attrs.Name, "/") {
+			tree.objects[attrs.Name] = gcsObject{generation: attrs.Generation, metageneration: attrs.Metageneration, folder: true}
+			continue
+		}
+		if previous != nil {
+			if cached, ok := previous.objects[attrs.Name]; ok && cached.generation == attrs.Generation && cached.metageneration == attrs.Metageneration {
+				tree.objects[attrs.Name] = cached
+				continue
+			}
+		}
+
+		// Read the listed generation, so that the content matches the
+		// generation recorded for it even if the object changes meanwhile.
+		reader, err := bucket.Object(attrs.Name).Generation(attrs.Generation).NewReader(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create GCS object reader for %s: %w", attrs.Name, err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read GCS object %s: %w", attrs.Name, err)
+		}
+		templateCacheDownloads.Inc()
+		tree.objects[attrs.Name] = gcsObject{generation: attrs.Generation, metageneration: attrs.Metageneration, content: content}
+		changed = true
+	}
+	if previous != nil && len(previous.objects) != len(tree.objects) {
+		changed = true
+	}
+	return tree, changed, nil
+}
+
+// gcsTreeCache keeps the GCS template trees used by the transformer, so that
+// a reconcile only lists the bucket, and only downloads the objects that
+// changed, when the cached tree is older than refreshInterval.
+type gcsTreeCache struct {
+	m sync.Mutex
+	// clients are keyed by the key of their gcsSource. Clients that were not
+	// used for idleTimeout are closed and removed with their trees.
+	clients         map[string]*gcsClient
+	newClient       func(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error)
+	refreshInterval time.Duration
+	idleTimeout     time.Duration
+	now             func() time.Time
+}
+
+// gcsClient is a cached storage client and the trees read with it, keyed by
+// bucket and root path.
+type gcsClient struct {
+	client *storage.Client
+	used   time.Time
+	trees  map[string]*gcsTree
+}
+
+func newGCSTreeCache(newClient func(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error)) *gcsTreeCache {
+	return &gcsTreeCache{
+		clients:         map[string]*gcsClient{},
+		newClient:       newClient,
+		refreshInterval: gcsCacheRefreshInterval,
+		idleTimeout:     gcsClientIdleTimeout,
+		now:             time.Now,
+	}
+}
+
+// defaultGCSTreeCache is shared by all transformers of the process.
+var defaultGCSTreeCache = newGCSTreeCache(storage.NewClient)
+
+// fileSystem returns a file system holding the objects under rootPath, read
+// with the credentials and endpoint of source.
+func (c *gcsTreeCache) fileSystem(ctx context.Context, source gcsSource, bucket, rootPath string) (filesys.FileSystem, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := c.now()
+	c.evictIdleClients(now, source.key)
+	cached, ok := c.clients[source.key]
+	if !ok {
+		client, err := c.newClient(ctx, source.options...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create storage client: %v", err)
+		}
+		cached = &gcsClient{client: client, trees: map[string]*gcsTree{}}
+		c.clients[source.key] = cached
+	}
+	cached.used = now
+	client := cached.client
+
+	key := bucket + "/" + strings.Trim(rootPath, "/")
+	tree, ok := cached.trees[key]
+	if ok && now.Sub(tree.fetched) < c.refreshInterval {
+		templateCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		refreshed, changed, err := fetchGCSTree(ctx, client.Bucket(bucket), bucket, rootPath, tree)
+		if err != nil {
+			return nil, err
+		}
+		refreshed.fetched = now
+		tree = refreshed
+		cached.trees[key] = tree
+		if changed {
+			templateCacheLookups.WithLabelValues("refreshed").Inc()
+		} else {
+			templateCacheLookups.WithLabelValues("revalidated").Inc()
+		}
+	}
+
+	fs := &gcsFileSystem{
+		client:       client,
+		bucket:       bucket,
+		rootPath:     rootPath,
+		memoryFS:     filesys.MakeFsInMemory(),
+		emptyFolders: make(map[string]bool),
+	}
+	if err := fs.load(tree); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// evictIdleClients closes and removes the clients, other than the one of
+// keep, that were not used for the idle timeout. c.m must be held.
+func (c *gcsTreeCache) evictIdleClients(now time.Time, keep string) {
+	for key, cached := range c.clients {
+		if key == keep || now.Sub(cached.used) < c.idleTimeout {
+			continue
+		}
+		// The file systems served with the client hold their objects in
+		// memory, so they outlive it.
+		cached.client.Close()
+		delete(c.clients, key)
+	}
+}
@@ -0,0 +1,114 @@
+package transformer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func TestGCSTreeCache(t *testing.T) {
+	ctx := context.Background()
+	bucketName := "templates"
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		InitialObjects: []fakestorage.Object{
+			{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: bucketName, Name: "v1/empty/"}},
+			{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: bucketName, Name: "v1/service.yaml"}, Content: []byte("kind: Service")},
+			{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: bucketName, Name: "v1/deployment.yaml"}, Content: []byte("kind: Deployment")},
+		},
+		Host: "127.0.0.1",
+	})
+	require.NoError(t, err)
+	t.Cleanup(server.Stop)
+
+	clients := 0
+	cache := newGCSTreeCache(func(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error) {
+		clients++
+		return storage.NewClient(ctx, append(opts, option.WithHTTPClient(server.HTTPClient()))...)
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	lookups := func(result string) float64 { return testutil.ToFloat64(templateCacheLookups.WithLabelValues(result)) }
+	hits, revalidated, refreshed := lookups("hit"), lookups("revalidated"), lookups("refreshed")
+	downloads := testutil.ToFloat64(templateCacheDownloads)
+
+	fs, err := cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+	require.NoError(t, err)
+	content, err := fs.ReadFile("v1/service.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Service", string(content))
+	assert.True(t, fs.IsDir("v1/empty"))
+	assert.Equal(t, refreshed+1, lookups("refreshed"))
+	assert.Equal(t, downloads+2, testutil.ToFloat64(templateCacheDownloads))
+
+	t.Run("fresh trees are served from the cache", func(t *testing.T) {
+		server.CreateObject(fakestorage.Object{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: bucketName, Name: "v1/service.yaml"}, Content: []byte("kind: Service\n# v2")})
+		fs, err := cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+		require.NoError(t, err)
+		content, err := fs.ReadFile("v1/service.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "kind: Service", string(content), "changes are picked up after the refresh interval")
+		assert.Equal(t, hits+1, lookups("hit"))
+	})
+
+	t.Run("only changed objects are downloaded", func(t *testing.T) {
+		now = now.Add(gcsCacheRefreshInterval)
+		before := testutil.ToFloat64(templateCacheDownloads)
+		fs, err := cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+		require.NoError(t, err)
+		content, err := fs.ReadFile("v1/service.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "kind: Service\n# v2", string(content))
+		content, err = fs.ReadFile("v1/deployment.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "kind: Deployment", string(content))
+		assert.Equal(t, before+1, testutil.ToFloat64(templateCacheDownloads))
+		assert.Equal(t, refreshed+2, lookups("refreshed"))
+	})
+
+	t.Run("unchanged trees are revalidated", func(t *testing.T) {
+		now = now.Add(gcsCacheRefreshInterval)
+		before := testutil.ToFloat64(templateCacheDownloads)
+		_, err := cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+		require.NoError(t, err)
+		assert.Equal(t, before, testutil.ToFloat64(templateCacheDownloads))
+		assert.Equal(t, revalidated+1, lookups("revalidated"))
+	})
+
+	t.Run("deleted objects are removed", func(t *testing.T) {
+		require.NoError(t, cache.clients[""].client.Bucket(bucketName).Object("v1/deployment.yaml").Delete(ctx))
+		now = now.Add(gcsCacheRefreshInterval)
+		fs, err := cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+		require.NoError(t, err)
+		assert.False(t, fs.Exists("v1/deployment.yaml"))
+	})
+
+	t.Run("missing bucket", func(t *testing.T) {
+		_, err := cache.fileSystem(ctx, gcsSource{}, "missing", "v1")
+		assert.ErrorContains(t, err, "bucket missing not found")
+	})
+
+	assert.Equal(t, 1, clients, "the storage client is reused")
+
+	t.Run("idle clients are evicted", func(t *testing.T) {
+		other := gcsSource{key: "other"}
+		_, err := cache.fileSystem(ctx, other, bucketName, "v1")
+		require.NoError(t, err)
+		now = now.Add(gcsClientIdleTimeout)
+		_, err = cache.fileSystem(ctx, gcsSource{}, bucketName, "v1")
+		require.NoError(t, err)
+		assert.NotContains(t, cache.clients, "other")
+		assert.Contains(t, cache.clients, "")
+
+		_, err = cache.fileSystem(ctx, other, bucketName, "v1")
+		require.NoError(t, err)
+		assert.Equal(t, 3, clients, "an evicted client is created again")
+	})
+}
@@ -0,0 +1,261 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// GCSFuseProfileAnnotation is set by templates on a pod template to tune
+	// its Cloud Storage FUSE volumes with a profile of gcsFuseProfiles.
+	GCSFuseProfileAnnotation = "model.skippy.io/gcsfuse-profile"
+
+	gcsFuseDriver            = "gcsfuse.csi.storage.gke.io"
+	gcsFuseVolumesAnnotation = "gke-gcsfuse/volumes"
+)
+
+// gcsFuseProfile holds the tuned settings of the Cloud Storage FUSE CSI
+// driver for one access pattern: the mount options and other attributes of
+// the volumes, and the annotations that size the sidecar of the driver.
+type gcsFuseProfile struct {
+	mountOptions       []string
+	volumeAttributes   map[string]string
+	sidecarAnnotations map[string]string
+}
+
+// gcsFuseProfiles are the profiles that templates and the mutator apply. A
+// limit of "0" lifts the limit of the sidecar.
+var gcsFuseProfiles = map[string]gcsFuseProfile{
+	// serving reads model weights once per replica, as fast as possible, and
+	// keeps them in the file cache.
+	"serving": {
+		mountOptions: []string{
+			"implicit-dirs",
+			"metadata-cache:ttl-secs:-1",
+			"metadata-cache:stat-cache-max-size-mb:-1",
+			"metadata-cache:type-cache-max-size-mb:-1",
+			"file-cache:max-size-mb:-1",
+			"file-cache:cache-file-for-range-read:true",
+			"file-cache:enable-parallel-downloads:true",
+			"file-cache:parallel-downloads-per-file:100",
+			"file-cache:max-parallel-downloads:-1",
+			"file-cache:download-chunk-size-mb:10",
+		},
+		volumeAttributes: map[string]string{
+			"gcsfuseMetadataPrefetchOnMount": "true",
+		},
+		sidecarAnnotations: map[string]string{
+			"gke-gcsfuse/cpu-limit":               "0",
+			"gke-gcsfuse/memory-limit":            "0",
+			"gke-gcsfuse/ephemeral-storage-limit": "0",
+		},
+	},
+	// checkpointing writes large files, which are streamed to the bucket
+	// instead of being staged on local storage, and lists and renames
+	// directories that other writers change.
+	"checkpointing": {
+		mountOptions: []string{
+			"implicit-dirs",
+			"metadata-cache:ttl-secs:60",
+			"metadata-cache:negative-ttl-secs:0",
+			"file-system:rename-dir-limit:200000",
+			"write:enable-streaming-writes:true",
+		},
+		sidecarAnnotations: map[string]string{
+			"gke-gcsfuse/cpu-request":             "500m",
+			"gke-gcsfuse/memory-request":          "1Gi",
+			"gke-gcsfuse/cpu-limit":               "0",
+			"gke-gcsfuse/memory-limit":            "0",
+			"gke-gcsfuse/ephemeral-storage-limit": "0",
+		},
+	},
+}
+
+// GCSFuseProfiles returns the names of the profiles, sorted.
+func GCSFuseProfiles() []string {
+	names := make([]string, 0, len(gcsFuseProfiles))
+	for name := range gcsFuseProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupGCSFuseProfile(name string) (gcsFuseProfile, error) {
+	profile, ok := gcsFuseProfiles[name]
+	if !ok {
+		return gcsFuseProfile{}, fmt.Errorf("unknown gcsfuse profile %q, valid profiles are %s", name, strings.Join(GCSFuseProfiles(), ", "))
+	}
+	return profile, nil
+}
+
+// gcsFuseMountOptions returns the mountOptions volume attribute of a
+// profile.
+func gcsFuseMountOptions(profile string) (string, error) {
+	p, err := lookupGCSFuseProfile(profile)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(p.mountOptions, ","), nil
+}
+
+// gcsFuseVolumeAttributes returns the volumeAttributes of a CSI volume of
+// bucket with the settings of a profile, e.g.
+//
+//	volumeAttributes:
+//	  {{- range $key, $value := gcsFuseVolumeAttributes "serving" $bucket }}
+//	  {{ $key }}: {{ quote $value }}
+//	  {{- end }}
+func gcsFuseVolumeAttributes(profile, bucket string) (map[string]interface{}, error) {
+	p, err := lookupGCSFuseProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"bucketName":   bucket,
+		"mountOptions": strings.Join(p.mountOptions, ","),
+	}
+	for key, value := range p.volumeAttributes {
+		attributes[key] = value
+	}
+	return attributes, nil
+}
+
+// gcsFuseSidecarAnnotations returns the pod annotations that inject the
+// sidecar of the driver, sized for a profile.
+func gcsFuseSidecarAnnotations(profile string) (map[string]interface{}, error) {
+	p, err := lookupGCSFuseProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	annotations := map[string]interface{}{gcsFuseVolumesAnnotation: "true"}
+	for key, value := range p.sidecarAnnotations {
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// GCSFuseMutator returns a mutator that tunes the Cloud Storage FUSE CSI
+// volumes of generated pods with the profile named by their
+// GCSFuseProfileAnnotation, or defaultProfile if they have none. Pods
+// without either are left as they are. Mount options and volume attributes
+// that the template sets take precedence over the profile, as do sidecar
+// annotations, so templates only need to set what they deviate in.
+func GCSFuseMutator(defaultProfile string) (Mutator, error) {
+	if defaultProfile != "" {
+		if _, err := lookupGCSFuseProfile(defaultProfile); err != nil {
+			return nil, err
+		}
+	}
+	return MutatorFunc(func(_ context.Context, _ *unstructured.Unstructured, obj *unstructured.Unstructured) error {
+		for _, path := range podSpecPaths[obj.GetKind()] {
+			rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+			podSpec, ok := rawPodSpec.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			metadataPath := append(append([]string{}, path[:len(path)-1]...), "metadata")
+			annotations, _, err := unstructured.NestedStringMap(obj.Object, append(metadataPath, "annotations")...)
+			if err != nil {
+				return err
+			}
+			name := annotations[GCSFuseProfileAnnotation]
+			if name == "" {
+				name = defaultProfile
+			}
+			if name == "" {
+				continue
+			}
+			profile, err := lookupGCSFuseProfile(name)
+			if err != nil {
+				return err
+			}
+			if !applyGCSFuseProfile(podSpec, profile) {
+				continue
+			}
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			for key, value := range profile.sidecarAnnotations {
+				if _, found := annotations[key]; !found {
+					annotations[key] = value
+				}
+			}
+			annotations[gcsFuseVolumesAnnotation] = "true"
+			if err := unstructured.SetNestedStringMap(obj.Object, annotations, append(metadataPath, "annotations")...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), nil
+}
+
+// applyGCSFuseProfile sets the settings of profile on the Cloud Storage FUSE
+// CSI volumes of podSpec, and returns false if it has none.
+func applyGCSFuseProfile(podSpec map[string]interface{}, profile gcsFuseProfile) bool {
+	volumes, _ := podSpec["volumes"].([]interface{})
+	applied := false
+	for _, volume := range volumes {
+		volumeMap, _ := volume.(map[string]interface{})
+		csiMap, ok := volumeMap["csi"].(map[string]interface{})
+		if !ok || csiMap["driver"] != gcsFuseDriver {
+			continue
+		}
+		attributes, _ := csiMap["volumeAttributes"].(map[string]interface{})
+		if attributes == nil {
+			attributes = map[string]interface{}{}
+		}
+		existing, _ := attributes["mountOptions"].(string)
+		attributes["mountOptions"] = mergeMountOptions(profile.mountOptions, existing)
+		for key, value := range profile.volumeAttributes {
+			if _, found := attributes[key]; !found {
+				attributes[key] = value
+			}
+		}
+		csiMap["volumeAttributes"] = attributes
+		applied = true
+	}
+	return applied
+}
+
+// mergeMountOptions returns the options of a profile with the comma
+// separated overrides of a template. Options are identified by their name,
+// which precedes their value after the last ":" or the "=".
+func mergeMountOptions(profile []string, overrides string) string {
+	var merged []string
+	index := map[string]int{}
+	add := func(option string) {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return
+		}
+		name := mountOptionName(option)
+		if i, found := index[name]; found {
+			merged[i] = option
+			return
+		}
+		index[name] = len(merged)
+		merged = append(merged, option)
+	}
+	for _, option := range profile {
+		add(option)
+	}
+	for _, option := range strings.Split(overrides, ",") {
+		add(option)
+	}
+	return strings.Join(merged, ",")
+}
+
+func mountOptionName(option string) string {
+	if name, _, found := strings.Cut(option, "="); found {
+		return name
+	}
+	if i := strings.LastIndex(option, ":"); i >= 0 {
+		return option[:i]
+	}
+	return option
+}
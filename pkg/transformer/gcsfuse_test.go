@@ -0,0 +1,143 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	template "github.com/google/safetext/yamltemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestGCSFuseDeployment(annotations map[string]interface{}, attributes map[string]interface{}) *unstructured.Unstructured {
+	podTemplate := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "inference-server", "image": "vllm/vllm-openai:v0.8.0"}},
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "dshm", "emptyDir": map[string]interface{}{"medium": "Memory"}},
+				map[string]interface{}{"name": "model-weights", "csi": map[string]interface{}{
+					"driver":           "gcsfuse.csi.storage.gke.io",
+					"volumeAttributes": attributes,
+				}},
+			},
+		},
+	}
+	if annotations != nil {
+		podTemplate["metadata"] = map[string]interface{}{"annotations": annotations}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "llama"},
+		"spec":       map[string]interface{}{"template": podTemplate},
+	}}
+}
+
+func TestGCSFuseMutator(t *testing.T) {
+	mutator, err := GCSFuseMutator("")
+	require.NoError(t, err)
+
+	deployment := newTestGCSFuseDeployment(
+		map[string]interface{}{GCSFuseProfileAnnotation: "serving", "gke-gcsfuse/memory-limit": "10Gi"},
+		map[string]interface{}{"bucketName": "models", "mountOptions": "implicit-dirs,file-cache:max-size-mb:1024,only-dir=llama"},
+	)
+	require.NoError(t, mutator.Mutate(context.Background(), nil, deployment))
+
+	volumes, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "volumes")
+	attributes := map[string]string{}
+	for key, value := range volumes[1].(map[string]interface{})["csi"].(map[string]interface{})["volumeAttributes"].(map[string]interface{}) {
+		attributes[key] = value.(string)
+	}
+	assert.Equal(t, "models", attributes["bucketName"])
+	assert.Equal(t, "true", attributes["gcsfuseMetadataPrefetchOnMount"])
+	options := strings.Split(attributes["mountOptions"], ",")
+	assert.Contains(t, options, "file-cache:max-size-mb:1024", "the options of the template take precedence")
+	assert.NotContains(t, options, "file-cache:max-size-mb:-1")
+	assert.Contains(t, options, "file-cache:enable-parallel-downloads:true")
+	assert.Contains(t, options, "only-dir=llama")
+	assert.Len(t, options, len(gcsFuseProfiles["serving"].mountOptions)+1)
+
+	annotations, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "annotations")
+	assert.Equal(t, map[string]string{
+		GCSFuseProfileAnnotation:              "serving",
+		"gke-gcsfuse/volumes":                 "true",
+		"gke-gcsfuse/cpu-limit":               "0",
+		"gke-gcsfuse/memory-limit":            "10Gi",
+		"gke-gcsfuse/ephemeral-storage-limit": "0",
+	}, annotations)
+
+	// Mutating again changes nothing.
+	before := deployment.DeepCopy()
+	require.NoError(t, mutator.Mutate(context.Background(), nil, deployment))
+	assert.Equal(t, before, deployment)
+
+	// Pods without a profile are left as they are.
+	untuned := newTestGCSFuseDeployment(nil, map[string]interface{}{"bucketName": "models"})
+	before = untuned.DeepCopy()
+	require.NoError(t, mutator.Mutate(context.Background(), nil, untuned))
+	assert.Equal(t, before, untuned)
+}
+
+func TestGCSFuseMutatorDefaultProfile(t *testing.T) {
+	mutator, err := GCSFuseMutator("checkpointing")
+	require.NoError(t, err)
+
+	deployment := newTestGCSFuseDeployment(nil, nil)
+	require.NoError(t, mutator.Mutate(context.Background(), nil, deployment))
+	volumes, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "volumes")
+	mountOptions := volumes[1].(map[string]interface{})["csi"].(map[string]interface{})["volumeAttributes"].(map[string]interface{})["mountOptions"]
+	assert.Equal(t, strings.Join(gcsFuseProfiles["checkpointing"].mountOptions, ","), mountOptions)
+	annotations, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "annotations")
+	assert.Equal(t, "1Gi", annotations["gke-gcsfuse/memory-request"])
+
+	// Objects without gcsfuse volumes are not annotated.
+	service := newTestObject("", "v1", "Service", "llama")
+	require.NoError(t, mutator.Mutate(context.Background(), nil, service))
+	assert.Nil(t, service.GetAnnotations())
+
+	_, err = GCSFuseMutator("fast")
+	assert.EqualError(t, err, `unknown gcsfuse profile "fast", valid profiles are checkpointing, serving`)
+
+	deployment = newTestGCSFuseDeployment(map[string]interface{}{GCSFuseProfileAnnotation: "fast"}, nil)
+	assert.ErrorContains(t, mutator.Mutate(context.Background(), nil, deployment), `unknown gcsfuse profile "fast"`)
+}
+
+func TestMergeMountOptions(t *testing.T) {
+	assert.Equal(t, "implicit-dirs,metadata-cache:ttl-secs:0,uid=1000", mergeMountOptions([]string{"implicit-dirs", "metadata-cache:ttl-secs:-1"}, " metadata-cache:ttl-secs:0, uid=1000,"))
+	assert.Equal(t, "implicit-dirs", mergeMountOptions([]string{"implicit-dirs"}, ""))
+}
+
+func TestGCSFuseTemplateFunctions(t *testing.T) {
+	tmpl, err := template.New("gcsfuse").Funcs(TemplateFuncs()).Parse(`metadata:
+  annotations:
+    {{- range $key, $value := gcsFuseSidecarAnnotations "serving" }}
+    {{ $key }}: {{ quote $value }}
+    {{- end }}
+volumeAttributes:
+  {{- range $key, $value := gcsFuseVolumeAttributes "serving" "models" }}
+  {{ $key }}: {{ quote $value }}
+  {{- end }}
+`)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, tmpl.Execute(&out, nil))
+	mountOptions, err := gcsFuseMountOptions("serving")
+	require.NoError(t, err)
+	assert.Equal(t, `metadata:
+  annotations:
+    gke-gcsfuse/cpu-limit: "0"
+    gke-gcsfuse/ephemeral-storage-limit: "0"
+    gke-gcsfuse/memory-limit: "0"
+    gke-gcsfuse/volumes: "true"
+volumeAttributes:
+  bucketName: "models"
+  gcsfuseMetadataPrefetchOnMount: "true"
+  mountOptions: "`+mountOptions+`"
+`, out.String())
+
+	_, err = gcsFuseMountOptions("fast")
+	assert.Error(t, err)
+}
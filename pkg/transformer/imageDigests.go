@@ -0,0 +1,367 @@
+package transformer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultImageDigestTTL is how long a resolved digest is reused before the
+	// registry is asked again, which bounds how late a retag is noticed.
+	DefaultImageDigestTTL = 5 * time.Minute
+
+	// imageDigestCacheMaxEntries bounds the digest cache. It is cleared when
+	// full, which only costs one registry request per image.
+	imageDigestCacheMaxEntries = 4096
+
+	dockerHubRegistry    = "docker.io"
+	dockerHubAPIRegistry = "registry-1.docker.io"
+	cloudPlatformScope   = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// manifestMediaTypes are accepted for the manifest of an image, so that the
+// registry returns the digest of the multi-platform index when there is one,
+// as the kubelet would pull it.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// containerListKeys are the fields of a pod spec that hold containers.
+var containerListKeys = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// RegistryCredentialsFunc returns the credentials that the token endpoint of
+// registry accepts, or empty strings to pull anonymously.
+type RegistryCredentialsFunc func(ctx context.Context, registry string) (username, password string, err error)
+
+// GoogleRegistryCredentials returns the access token of the ambient Google
+// credentials for Container Registry and Artifact Registry, and no credentials
+// for other registries.
+func GoogleRegistryCredentials(ctx context.Context, registry string) (string, string, error) {
+	if registry != "gcr.io" && !strings.HasSuffix(registry, ".gcr.io") && !strings.HasSuffix(registry, "-docker.pkg.dev") {
+		return "", "", nil
+	}
+	tokenSource, err := google.DefaultTokenSource(ctx, cloudPlatformScope)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return "", "", err
+	}
+	return "oauth2accesstoken", token.AccessToken, nil
+}
+
+// ImageResolver resolves image tags to digests with HEAD requests to their
+// registries, and caches the digests for a TTL.
+type ImageResolver struct {
+	client      *http.Client
+	ttl         time.Duration
+	credentials RegistryCredentialsFunc
+	now         func() time.Time
+
+	m       sync.Mutex
+	entries map[string]imageDigestEntry
+	// verified holds when the signatures verified by verifySignature
+	// expire, see verifiedKey.
+	verified map[string]time.Time
+}
+
+type imageDigestEntry struct {
+	digest  string
+	expires time.Time
+}
+
+// NewImageResolver returns a resolver that reuses digests for ttl. credentials
+// may be nil to pull anonymously from every registry.
+func NewImageResolver(ttl time.Duration, credentials RegistryCredentialsFunc) *ImageResolver {
+	return &ImageResolver{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		ttl:         ttl,
+		credentials: credentials,
+		now:         time.Now,
+	}
+}
+
+// SetImageResolver pins the images of rendered workloads to the digests that
+// resolver returns for their tags. Pinning is disabled if it is nil.
+func (t *Transformer) SetImageResolver(resolver *ImageResolver) {
+	t.imageResolver = resolver
+}
+
+// imageReference is a parsed image name, e.g. "nginx:1.27" is the "1.27" tag
+// of "library/nginx" on "docker.io".
+type imageReference struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImageReference parses image the way the container runtime does: the
+// first component is a registry if it looks like a host, and the tag defaults
+// to "latest".
+func parseImageReference(image string) (imageReference, error) {
+	ref := imageReference{}
+	name, digest, _ := strings.Cut(image, "@")
+	ref.digest = digest
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return ref, fmt.Errorf("invalid image reference %q", image)
+	}
+
+	if first, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.registry, name = first, rest
+	} else {
+		ref.registry = dockerHubRegistry
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.tag = name[:i], name[i+1:]
+	}
+	if ref.tag == "" {
+		ref.tag = "latest"
+	}
+	if ref.registry == dockerHubRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	if name == "" {
+		return ref, fmt.Errorf("invalid image reference %q", image)
+	}
+	ref.repository = name
+	return ref, nil
+}
+
+// Resolve returns the digest of the tag of image, e.g. "sha256:...".
+func (r *ImageResolver) Resolve(ctx context.Context, image string) (string, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.digest != "" {
+		return ref.digest, nil
+	}
+	key := ref.registry + "/" + ref.repository + ":" + ref.tag
+	if digest, ok := r.cached(key); ok {
+		return digest, nil
+	}
+
+	digest, err := r.headManifest(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.entries == nil || len(r.entries) >= imageDigestCacheMaxEntries {
+		r.entries = map[string]imageDigestEntry{}
+	}
+	r.entries[key] = imageDigestEntry{digest: digest, expires: r.now().Add(r.ttl)}
+	return digest, nil
+}
+
+func (r *ImageResolver) cached(key string) (string, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	entry, ok := r.entries[key]
+	if !ok || !r.now().Before(entry.expires) {
+		return "", false
+	}
+	return entry.digest, true
+}
+
+// headManifest asks the registry for the digest of the manifest of ref.
+func (r *ImageResolver) headManifest(ctx context.Context, ref imageReference) (string, error) {
+	resp, err := r.registryRequest(ctx, http.MethodHead, ref, "manifests/"+ref.tag, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s returned %s for %s:%s", ref.registry, resp.Status, ref.repository, ref.tag)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("registry %s returned no digest for %s:%s", ref.registry, ref.repository, ref.tag)
+	}
+	return digest, nil
+}
+
+// registryRequest sends a request for path in the repository of ref, e.g.
+// "manifests/latest". A registry that requires a token names its token
+// endpoint in the challenge of the first response.
+func (r *ImageResolver) registryRequest(ctx context.Context, method string, ref imageReference, path string, accept []string) (*http.Response, error) {
+	host := ref.registry
+	if host == dockerHubRegistry {
+		host = dockerHubAPIRegistry
+	}
+	url := fmt.Sprintf("https://%s/v2/%s/%s", host, ref.repository, path)
+
+	resp, err := r.request(ctx, method, url, accept, "")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+	token, err := r.token(ctx, ref, resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	return r.request(ctx, method, url, accept, "Bearer "+token)
+}
+
+func (r *ImageResolver) request(ctx context.Context, method, url string, accept []string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return r.client.Do(req)
+}
+
+// token fetches a pull token for ref from the endpoint that challenge names,
+// e.g. `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func (r *ImageResolver) token(ctx context.Context, ref imageReference, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry %s requires unsupported authentication %q", ref.registry, scheme)
+	}
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("registry %s sent a challenge without a realm", ref.registry)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, values["realm"], nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	query.Set("scope", "repository:"+ref.repository+":pull")
+	req.URL.RawQuery = query.Encode()
+	if r.credentials != nil {
+		username, password, err := r.credentials(ctx, ref.registry)
+		if err != nil {
+			return "", fmt.Errorf("failed to get credentials for registry %s: %w", ref.registry, err)
+		}
+		if username != "" || password != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint of registry %s returned %s", ref.registry, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse the token of registry %s: %w", ref.registry, err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// pinImageDigests replaces the tags of the images in the pod specs of objs
+// with "image@digest", keeping the tag for readers. Images in verified, whose
+// signatures checkImagePolicy verified, are pinned to the verified digest even
+// if digests are not pinned otherwise, so that pods run what was verified. An
+// image that cannot be resolved keeps the digest that the owner last recorded
+// in status.imageDigests, so that a registry outage does not roll workloads
+// back to a tag; without one the render fails.
+func (t *Transformer) pinImageDigests(ctx context.Context, owner *unstructured.Unstructured, objs []*unstructured.Unstructured, verified map[string]string) error {
+	if t.imageResolver == nil && len(verified) == 0 {
+		return nil
+	}
+	recorded, _, _ := unstructured.NestedStringMap(owner.Object, "status", "imageDigests")
+	for _, obj := range objs {
+		err := forEachContainer(obj, func(container map[string]interface{}) error {
+			image, _ := container["image"].(string)
+			if image == "" || strings.Contains(image, "@") {
+				return nil
+			}
+			if digest, ok := verified[image]; ok {
+				container["image"] = image + "@" + digest
+				return nil
+			}
+			if t.imageResolver == nil {
+				return nil
+			}
+			digest, err := t.imageResolver.Resolve(ctx, image)
+			if err != nil {
+				if digest = recorded[image]; digest == "" {
+					return fmt.Errorf("unable to resolve the digest of image %q of %s %s: %w", image, obj.GetKind(), obj.GetName(), err)
+				}
+				log.FromContext(ctx).Error(err, "Failed to resolve image digest, keeping the recorded digest", "image", image, "digest", digest)
+			}
+			container["image"] = image + "@" + digest
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImageDigests returns the images of the pod specs of obj that are pinned to
+// a digest, keyed by the image without the digest.
+func ImageDigests(obj *unstructured.Unstructured) map[string]string {
+	digests := map[string]string{}
+	_ = forEachContainer(obj, func(container map[string]interface{}) error {
+		image, _ := container["image"].(string)
+		if name, digest, found := strings.Cut(image, "@"); found && name != "" && digest != "" {
+			digests[name] = digest
+		}
+		return nil
+	})
+	return digests
+}
+
+// forEachContainer calls f with every container of the pod specs of obj, in
+// place.
+func forEachContainer(obj *unstructured.Unstructured, f func(container map[string]interface{}) error) error {
+	for _, path := range podSpecPaths[obj.GetKind()] {
+		rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		podSpec, ok := rawPodSpec.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range containerListKeys {
+			containers, _ := podSpec[key].([]interface{})
+			for _, rawContainer := range containers {
+				if container, ok := rawContainer.(map[string]interface{}); ok {
+					if err := f(container); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
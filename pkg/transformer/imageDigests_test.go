@@ -0,0 +1,143 @@
+package transformer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  imageReference
+	}{
+		{"nginx", imageReference{registry: "docker.io", repository: "library/nginx", tag: "latest"}},
+		{"vllm/vllm-openai:v0.8.0", imageReference{registry: "docker.io", repository: "vllm/vllm-openai", tag: "v0.8.0"}},
+		{"us-docker.pkg.dev/project/repo/server:1.2", imageReference{registry: "us-docker.pkg.dev", repository: "project/repo/server", tag: "1.2"}},
+		{"localhost:5000/server", imageReference{registry: "localhost:5000", repository: "server", tag: "latest"}},
+		{"gcr.io/project/server:1.2@sha256:aaaa", imageReference{registry: "gcr.io", repository: "project/server", tag: "1.2", digest: "sha256:aaaa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := parseImageReference(tt.image)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := parseImageReference("")
+	assert.Error(t, err)
+}
+
+// newTestImageRegistry serves the manifests of digests, keyed by
+// "repository:tag", behind an anonymous token endpoint.
+func newTestImageRegistry(t *testing.T, digests map[string]string) (*httptest.Server, *int) {
+	heads := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:team/server:pull", r.URL.Query().Get("scope"))
+			_, _ = w.Write([]byte(`{"token":"pull-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer pull-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		heads++
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json")
+		repository, tag, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+		digest, ok := digests[repository+":"+tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	t.Cleanup(server.Close)
+	return server, &heads
+}
+
+func TestImageResolver(t *testing.T) {
+	digests := map[string]string{"team/server:1.2": "sha256:aaaa"}
+	server, heads := newTestImageRegistry(t, digests)
+	image := strings.TrimPrefix(server.URL, "https://") + "/team/server:1.2"
+
+	now := time.Now()
+	resolver := NewImageResolver(time.Minute, nil)
+	resolver.client = server.Client()
+	resolver.now = func() time.Time { return now }
+
+	digest, err := resolver.Resolve(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:aaaa", digest)
+
+	digests["team/server:1.2"] = "sha256:bbbb"
+	digest, err = resolver.Resolve(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:aaaa", digest, "digests are cached")
+	assert.Equal(t, 1, *heads)
+
+	now = now.Add(2 * time.Minute)
+	digest, err = resolver.Resolve(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:bbbb", digest, "retags are noticed once the digest expires")
+
+	_, err = resolver.Resolve(context.Background(), strings.TrimPrefix(server.URL, "https://")+"/team/server:missing")
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestPinImageDigests(t *testing.T) {
+	server, _ := newTestImageRegistry(t, map[string]string{"team/server:1.2": "sha256:aaaa"})
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	resolver := NewImageResolver(time.Minute, nil)
+	resolver.client = server.Client()
+	transformer := NewTransformer()
+	transformer.SetImageResolver(resolver)
+
+	newDeployment := func(images ...string) *unstructured.Unstructured {
+		var containers []interface{}
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"name": "c", "image": image})
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "server"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": containers,
+			}}},
+		}}
+	}
+	owner := &unstructured.Unstructured{Object: map[string]interface{}{}}
+
+	deployment := newDeployment(registry+"/team/server:1.2", registry+"/team/server:1.1@sha256:cccc")
+	require.NoError(t, transformer.pinImageDigests(context.Background(), owner, []*unstructured.Unstructured{deployment}, nil))
+	assert.Equal(t, map[string]string{
+		registry + "/team/server:1.2": "sha256:aaaa",
+		registry + "/team/server:1.1": "sha256:cccc",
+	}, ImageDigests(deployment))
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	assert.Equal(t, registry+"/team/server:1.1@sha256:cccc", containers[1].(map[string]interface{})["image"], "pinned images are kept")
+
+	missing := registry + "/team/server:missing"
+	err := transformer.pinImageDigests(context.Background(), owner, []*unstructured.Unstructured{newDeployment(missing)}, nil)
+	assert.ErrorContains(t, err, `unable to resolve the digest of image "`+missing+`" of Deployment server`)
+
+	// The digest that the owner last recorded is kept when the tag cannot be
+	// resolved.
+	require.NoError(t, unstructured.SetNestedStringMap(owner.Object, map[string]string{missing: "sha256:dddd"}, "status", "imageDigests"))
+	deployment = newDeployment(missing)
+	require.NoError(t, transformer.pinImageDigests(context.Background(), owner, []*unstructured.Unstructured{deployment}, nil))
+	assert.Equal(t, map[string]string{missing: "sha256:dddd"}, ImageDigests(deployment))
+}
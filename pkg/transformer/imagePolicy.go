@@ -0,0 +1,184 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ImagePolicyError is returned when a rendered container image is not
+// allowed by the security policy, because it matches none of the allowed
+// images or has no signature by a trusted key.
+type ImagePolicyError struct {
+	Kind      string
+	Name      string
+	Container string
+	// Field is the path of the image in the spec of a resource, instead of
+	// a Container, see CheckSpecImages.
+	Field  string
+	Image  string
+	Reason string
+}
+
+func (e *ImagePolicyError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("image %q in %s of %s %s %s", e.Image, e.Field, e.Kind, e.Name, e.Reason)
+	}
+	return fmt.Sprintf("image %q of container %q of %s %s %s", e.Image, e.Container, e.Kind, e.Name, e.Reason)
+}
+
+// SetImageSignatureVerifier verifies the image signatures that security
+// policies require with resolver. Without one, objects with images that
+// require a signature are not rendered.
+func (t *Transformer) SetImageSignatureVerifier(resolver *ImageResolver) {
+	t.signatureVerifier = resolver
+}
+
+// checkImagePolicy returns an *ImagePolicyError if a container image of the
+// pod specs of obj is not allowed by each of policies, e.g. the cluster-wide
+// policy and that of the integration, so that an integration cannot allow
+// images that the cluster-wide policy does not. Images are checked as
+// rendered, before they are pinned to digests. The digests whose signatures
+// were verified are added to verified, keyed by image, for pinImageDigests to
+// pin the images to.
+func (t *Transformer) checkImagePolicy(ctx context.Context, obj *unstructured.Unstructured, verified map[string]string, policies ...*v1.IntegrationSecurityPolicySpec) error {
+	for _, policy := range policies {
+		if err := t.checkImages(ctx, obj, verified, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkImages returns an *ImagePolicyError if a container image of the pod
+// specs of obj is not allowed by policy.
+func (t *Transformer) checkImages(ctx context.Context, obj *unstructured.Unstructured, verified map[string]string, policy *v1.IntegrationSecurityPolicySpec) error {
+	if policy == nil || (len(policy.AllowedImages) == 0 && len(policy.ImageSignatureKeys) == 0) {
+		return nil
+	}
+	allowed := make([]*regexp.Regexp, 0, len(policy.AllowedImages))
+	for _, pattern := range policy.AllowedImages {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid allowed image %q: %w", pattern, err)
+		}
+		allowed = append(allowed, re)
+	}
+	keys, err := parseSignatureKeys(policy.ImageSignatureKeys)
+	if err != nil {
+		return err
+	}
+
+	return forEachContainer(obj, func(container map[string]interface{}) error {
+		image, _ := container["image"].(string)
+		if image == "" {
+			return nil
+		}
+		policyErr := &ImagePolicyError{Kind: obj.GetKind(), Name: obj.GetName(), Image: image}
+		policyErr.Container, _ = container["name"].(string)
+		if len(allowed) > 0 && !matchesAny(allowed, image) {
+			policyErr.Reason = "matches none of the allowed images"
+			return policyErr
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if t.signatureVerifier == nil {
+			return fmt.Errorf("cannot verify the signature of image %q of %s %s: no image signature verifier is configured", image, obj.GetKind(), obj.GetName())
+		}
+		digest, err := t.signatureVerifier.verifySignature(ctx, image, keys)
+		if err != nil {
+			if errors.Is(err, errNoTrustedSignature) {
+				policyErr.Reason = "has no signature by a trusted key"
+				return policyErr
+			}
+			return fmt.Errorf("unable to verify the signature of image %q of %s %s: %w", image, obj.GetKind(), obj.GetName(), err)
+		}
+		if previous, ok := verified[image]; ok && previous != digest {
+			return fmt.Errorf("the digest of image %q of %s %s changed from %s to %s while its signatures were verified", image, obj.GetKind(), obj.GetName(), previous, digest)
+		}
+		if verified != nil {
+			verified[image] = digest
+		}
+		return nil
+	})
+}
+
+// CheckSpecImages returns an *ImagePolicyError if an image that obj sets in
+// its spec, in any string field named image, matches none of the allowed
+// images of one of policies, so that resources are rejected before their
+// templates render the image. Signatures are only verified on render.
+func CheckSpecImages(obj *unstructured.Unstructured, policies ...*v1.IntegrationSecurityPolicySpec) error {
+	for _, policy := range policies {
+		if err := checkSpecImages(obj, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSpecImages(obj *unstructured.Unstructured, policy *v1.IntegrationSecurityPolicySpec) error {
+	if policy == nil || len(policy.AllowedImages) == 0 {
+		return nil
+	}
+	allowed := make([]*regexp.Regexp, 0, len(policy.AllowedImages))
+	for _, pattern := range policy.AllowedImages {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid allowed image %q: %w", pattern, err)
+		}
+		allowed = append(allowed, re)
+	}
+	spec, _ := obj.Object["spec"].(map[string]interface{})
+	return walkSpecImages(spec, "spec", func(field, image string) error {
+		if matchesAny(allowed, image) {
+			return nil
+		}
+		return &ImagePolicyError{Kind: obj.GetKind(), Name: obj.GetName(), Field: field, Image: image, Reason: "matches none of the allowed images"}
+	})
+}
+
+// walkSpecImages calls f with the path and value of each non-empty string
+// field named image under value, in the order of the keys.
+func walkSpecImages(value interface{}, path string, f func(field, image string) error) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if image, ok := value[key].(string); ok && key == "image" && image != "" {
+				if err := f(path+"."+key, image); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkSpecImages(value[key], path+"."+key, f); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			if err := walkSpecImages(item, fmt.Sprintf("%s[%d]", path, i), f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package transformer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// testSigningRegistry serves the tags of one repository and the cosign
+// signatures of their digests, without authentication.
+type testSigningRegistry struct {
+	t       *testing.T
+	tags    map[string]string
+	objects map[string][]byte
+	sigGets int
+}
+
+func newTestSigningRegistry(t *testing.T) (*testSigningRegistry, *httptest.Server) {
+	registry := &testSigningRegistry{t: t, tags: map[string]string{}, objects: map[string][]byte{}}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/sandboxes/runtime/")
+		if tag, ok := strings.CutPrefix(path, "manifests/"); ok && r.Method == http.MethodHead {
+			digest, found := registry.tags[tag]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			return
+		}
+		if strings.HasSuffix(path, ".sig") {
+			registry.sigGets++
+		}
+		data, found := registry.objects[path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return registry, server
+}
+
+// sign pushes an image with tag, and a cosign signature of it by key for
+// signedDigest, if key is not nil.
+func (r *testSigningRegistry) sign(tag, digest string, key *ecdsa.PrivateKey, signedDigest string) {
+	r.tags[tag] = digest
+	if key == nil {
+		return
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]interface{}{"docker-reference": "sandboxes/runtime"},
+			"image":    map[string]interface{}{"docker-manifest-digest": signedDigest},
+			"type":     "cosign container image signature",
+		},
+	})
+	require.NoError(r.t, err)
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	require.NoError(r.t, err)
+	payloadDigest := sha256.Sum256(payload)
+	blob := "sha256:" + hex.EncodeToString(payloadDigest[:])
+	r.objects["blobs/"+blob] = payload
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []interface{}{map[string]interface{}{
+			"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+			"digest":      blob,
+			"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+		}},
+	})
+	require.NoError(r.t, err)
+	r.objects["manifests/"+strings.Replace(digest, ":", "-", 1)+".sig"] = manifest
+}
+
+func newTestSigningKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func newTestSandboxDeployment(image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "sandbox"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "sandbox-runtime", "image": image}},
+		}}},
+	}}
+}
+
+func TestCheckImagePolicyAllowedImages(t *testing.T) {
+	transformer := NewTransformer()
+	policy := &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^us-docker\.pkg\.dev/team/sandboxes/`, `^python:3\.12`}}
+
+	for _, image := range []string{"us-docker.pkg.dev/team/sandboxes/runtime:1.0", "python:3.12-slim"} {
+		assert.NoError(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(image), nil, policy), image)
+	}
+
+	err := transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("docker.io/attacker/miner:latest"), nil, policy)
+	var policyErr *ImagePolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, ImagePolicyError{
+		Kind:      "Deployment",
+		Name:      "sandbox",
+		Container: "sandbox-runtime",
+		Image:     "docker.io/attacker/miner:latest",
+		Reason:    "matches none of the allowed images",
+	}, *policyErr)
+	assert.EqualError(t, err, `image "docker.io/attacker/miner:latest" of container "sandbox-runtime" of Deployment sandbox matches none of the allowed images`)
+
+	// Objects without pod specs and policies without image settings are not checked.
+	assert.NoError(t, transformer.checkImagePolicy(context.Background(), newTestObject("", "v1", "Service", "sandbox"), nil, policy))
+	assert.NoError(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("docker.io/attacker/miner:latest"), nil, &v1.IntegrationSecurityPolicySpec{RuntimeClassName: "gvisor"}))
+
+	assert.ErrorContains(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("python:3.12"), nil, &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{"("}}), "invalid allowed image")
+
+	// An image must be allowed by the integration and the cluster-wide policy.
+	integration := &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^docker\.io/`}}
+	assert.NoError(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("python:3.12"), nil, policy, nil))
+	assert.ErrorAs(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("docker.io/attacker/miner:latest"), nil, policy, integration), &policyErr)
+	assert.ErrorAs(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment("python:3.12"), nil, policy, integration), &policyErr)
+}
+
+func TestCheckSpecImages(t *testing.T) {
+	policy := &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^vllm/`}}
+	obj := newTestObject("model.skippy.io", "v1", "InferenceDeployment", "llama")
+	obj.Object["spec"] = map[string]interface{}{
+		"inferenceServer": map[string]interface{}{"image": "vllm/vllm-openai:v0.6.0"},
+		"sidecars": []interface{}{
+			map[string]interface{}{"name": "proxy", "image": "vllm/proxy:1"},
+			map[string]interface{}{"name": "miner", "image": "docker.io/attacker/miner:latest"},
+		},
+	}
+
+	err := CheckSpecImages(obj, policy)
+	var policyErr *ImagePolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.EqualError(t, err, `image "docker.io/attacker/miner:latest" in spec.sidecars[1].image of InferenceDeployment llama matches none of the allowed images`)
+
+	obj.Object["spec"].(map[string]interface{})["sidecars"] = nil
+	assert.NoError(t, CheckSpecImages(obj, policy))
+	assert.NoError(t, CheckSpecImages(newTestSandboxDeployment("docker.io/attacker/miner:latest"), nil))
+	assert.ErrorContains(t, CheckSpecImages(obj, &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{"("}}), "invalid allowed image")
+	assert.ErrorAs(t, CheckSpecImages(obj, policy, &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^vllm/proxy`}}), &policyErr)
+}
+
+func TestCheckImagePolicySignatures(t *testing.T) {
+	trusted, trustedPEM := newTestSigningKey(t)
+	untrusted, _ := newTestSigningKey(t)
+	registry, server := newTestSigningRegistry(t)
+	repository := strings.TrimPrefix(server.URL, "https://") + "/sandboxes/runtime"
+	registry.sign("signed", "sha256:aaaa", trusted, "sha256:aaaa")
+	registry.sign("unsigned", "sha256:bbbb", nil, "")
+	registry.sign("untrusted", "sha256:cccc", untrusted, "sha256:cccc")
+	// A valid signature copied from another image.
+	registry.sign("copied", "sha256:dddd", trusted, "sha256:aaaa")
+
+	now := time.Now()
+	resolver := NewImageResolver(time.Minute, nil)
+	resolver.client = server.Client()
+	resolver.now = func() time.Time { return now }
+	transformer := NewTransformer()
+	policy := &v1.IntegrationSecurityPolicySpec{ImageSignatureKeys: []string{trustedPEM}}
+
+	err := transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(repository+":signed"), nil, policy)
+	assert.ErrorContains(t, err, "no image signature verifier is configured")
+
+	transformer.SetImageSignatureVerifier(resolver)
+	verified := map[string]string{}
+	require.NoError(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(repository+":signed"), verified, policy))
+	require.NoError(t, transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(repository+":signed"), nil, policy))
+	assert.Equal(t, 1, registry.sigGets, "verified signatures are cached")
+
+	// Verified images are pinned to the verified digest, even without an
+	// image resolver.
+	assert.Equal(t, map[string]string{repository + ":signed": "sha256:aaaa"}, verified)
+	deployment := newTestSandboxDeployment(repository + ":signed")
+	require.NoError(t, transformer.pinImageDigests(context.Background(), deployment, []*unstructured.Unstructured{deployment}, verified))
+	assert.Equal(t, map[string]string{repository + ":signed": "sha256:aaaa"}, ImageDigests(deployment))
+
+	for _, tag := range []string{"unsigned", "untrusted", "copied"} {
+		err := transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(repository+":"+tag), nil, policy)
+		var policyErr *ImagePolicyError
+		require.True(t, errors.As(err, &policyErr), "%s: %v", tag, err)
+		assert.Equal(t, "has no signature by a trusted key", policyErr.Reason)
+	}
+
+	// Failures to reach the registry are not policy violations.
+	err = transformer.checkImagePolicy(context.Background(), newTestSandboxDeployment(repository+":missing"), nil, policy)
+	require.Error(t, err)
+	var policyErr *ImagePolicyError
+	assert.False(t, errors.As(err, &policyErr))
+
+	_, err = parseSignatureKeys([]string{"not a key"})
+	assert.ErrorContains(t, err, "no PEM encoded public key found")
+}
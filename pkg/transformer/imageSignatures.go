@@ -0,0 +1,220 @@
+package transformer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// cosignSignatureAnnotation holds the signature of the payload of a layer
+	// of a cosign signature manifest.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// maxSignatureManifestSize and maxSignaturePayloadSize bound what is read
+	// from registries for a signature.
+	maxSignatureManifestSize = 1 << 20
+	maxSignaturePayloadSize  = 1 << 20
+)
+
+// signatureManifestMediaTypes are accepted for the manifests that cosign
+// pushes next to images.
+var signatureManifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// errNoTrustedSignature is returned when an image is not signed by any of the
+// trusted keys, as opposed to errors reading its signatures.
+var errNoTrustedSignature = errors.New("no trusted signature")
+
+// parseSignatureKeys parses the PEM encoded public keys of a security policy.
+// Each entry may hold several keys.
+func parseSignatureKeys(entries []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, entry := range entries {
+		rest := []byte(entry)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid signature key: %w", err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 && len(entries) > 0 {
+		return nil, fmt.Errorf("invalid signature keys: no PEM encoded public key found")
+	}
+	return keys, nil
+}
+
+// verifySignature checks that the digest of image has a cosign signature by
+// one of keys, i.e. that the "sha256-<hex>.sig" tag of its repository holds a
+// payload for the digest that one of the keys signed, and returns the
+// digest, which the image must be pinned to so that the tag cannot be moved
+// to another image before it is pulled. Verified signatures are reused for
+// the TTL of the resolver. Transparency logs and keyless signatures are not
+// checked.
+func (r *ImageResolver) verifySignature(ctx context.Context, image string, keys []crypto.PublicKey) (string, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+	digest, err := r.Resolve(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	key, err := verifiedKey(ref, digest, keys)
+	if err != nil {
+		return "", err
+	}
+	if r.isVerified(key) {
+		return digest, nil
+	}
+
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	resp, err := r.registryRequest(ctx, http.MethodGet, ref, "manifests/"+algorithm+"-"+encoded+".sig", signatureManifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s@%s is not signed", errNoTrustedSignature, ref.repository, digest)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s returned %s for the signatures of %s@%s", ref.registry, resp.Status, ref.repository, digest)
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSignatureManifestSize)).Decode(&manifest); err != nil {
+		return "", fmt.Errorf("failed to parse the signatures of %s@%s: %w", ref.repository, digest, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		payload, err := r.blob(ctx, ref, layer.Digest)
+		if err != nil {
+			return "", err
+		}
+		if signedDigest(payload) == digest && verifyPayload(keys, payload, signature) {
+			r.setVerified(key)
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s@%s is not signed by a trusted key", errNoTrustedSignature, ref.repository, digest)
+}
+
+// blob reads the blob of ref with digest, and checks that its content
+// matches the digest.
+func (r *ImageResolver) blob(ctx context.Context, ref imageReference, digest string) ([]byte, error) {
+	resp, err := r.registryRequest(ctx, http.MethodGet, ref, "blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry %s returned %s for blob %s of %s", ref.registry, resp.Status, digest, ref.repository)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSignaturePayloadSize))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s of %s does not match its digest", digest, ref.repository)
+	}
+	return data, nil
+}
+
+// signedDigest returns the image digest that a cosign payload is for.
+func signedDigest(payload []byte) string {
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if json.Unmarshal(payload, &simpleSigning) != nil {
+		return ""
+	}
+	return simpleSigning.Critical.Image.DockerManifestDigest
+}
+
+// verifyPayload returns true if one of keys signed payload.
+func verifyPayload(keys []crypto.PublicKey, payload, signature []byte) bool {
+	hash := sha256.Sum256(payload)
+	for _, key := range keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hash[:], signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifiedKey identifies the digest of ref together with the keys it was
+// verified with.
+func verifiedKey(ref imageReference, digest string, keys []crypto.PublicKey) (string, error) {
+	h := sha256.New()
+	for _, key := range keys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return "", fmt.Errorf("invalid signature key: %w", err)
+		}
+		h.Write(der)
+	}
+	return ref.registry + "/" + ref.repository + "@" + digest + "|" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (r *ImageResolver) isVerified(key string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	expires, ok := r.verified[key]
+	return ok && r.now().Before(expires)
+}
+
+func (r *ImageResolver) setVerified(key string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.verified == nil || len(r.verified) >= imageDigestCacheMaxEntries {
+		r.verified = map[string]time.Time{}
+	}
+	r.verified[key] = r.now().Add(r.ttl)
+}
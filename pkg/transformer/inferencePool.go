@@ -0,0 +1,83 @@
+package transformer
+
+import (
+	"fmt"
+)
+
+// inferenceExtensionAPIVersion is the version of the Gateway API Inference
+// Extension kinds that the helpers below return.
+const inferenceExtensionAPIVersion = "inference.networking.x-k8s.io/v1alpha2"
+
+// inferencePoolFor returns an InferencePool of the Gateway API Inference
+// Extension that load-balances over the model server pods selected by
+// matchLabels, on targetPort, through the endpoint picker Service named
+// endpointPicker, e.g.
+//
+//	{{ inferencePoolFor (dict "name" $name "namespace" .resource.metadata.namespace) (dict "app" $name) 8000 (printf "%s-epp" $name) | toJson }}
+//
+// An HTTPRoute that sends traffic to the pool wires it into a Gateway, whose
+// address is then reported in status.inferencePool of the resource.
+func inferencePoolFor(target map[string]interface{}, matchLabels map[string]interface{}, targetPort interface{}, endpointPicker string) (map[string]interface{}, error) {
+	name, _ := target["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("inference pool target has no name")
+	}
+	if len(matchLabels) == 0 {
+		return nil, fmt.Errorf("inference pool %s has no labels to select pods", name)
+	}
+	port, err := replicaCount(targetPort)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("inference pool %s: target port must be a number between 1 and 65535, got %v", name, targetPort)
+	}
+	if endpointPicker == "" {
+		return nil, fmt.Errorf("inference pool %s has no endpoint picker", name)
+	}
+
+	return map[string]interface{}{
+		"apiVersion": inferenceExtensionAPIVersion,
+		"kind":       "InferencePool",
+		"metadata":   inferenceExtensionMetadata(target, name),
+		"spec": map[string]interface{}{
+			"selector":         matchLabels,
+			"targetPortNumber": port,
+			"extensionRef":     map[string]interface{}{"name": endpointPicker},
+		},
+	}, nil
+}
+
+// inferenceModelFor returns an InferenceModel that serves requests for
+// modelName from the InferencePool named pool, e.g.
+//
+//	{{ inferenceModelFor (dict "name" $name "namespace" .resource.metadata.namespace) .resource.spec.modelName $name | toJson }}
+//
+// Templates can add a criticality or targetModels to its spec with set.
+func inferenceModelFor(target map[string]interface{}, modelName, pool string) (map[string]interface{}, error) {
+	name, _ := target["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("inference model target has no name")
+	}
+	if modelName == "" {
+		return nil, fmt.Errorf("inference model %s has no model name", name)
+	}
+	if pool == "" {
+		return nil, fmt.Errorf("inference model %s has no pool", name)
+	}
+
+	return map[string]interface{}{
+		"apiVersion": inferenceExtensionAPIVersion,
+		"kind":       "InferenceModel",
+		"metadata":   inferenceExtensionMetadata(target, name),
+		"spec": map[string]interface{}{
+			"modelName": modelName,
+			"poolRef":   map[string]interface{}{"name": pool},
+		},
+	}, nil
+}
+
+func inferenceExtensionMetadata(target map[string]interface{}, name string) map[string]interface{} {
+	metadata := map[string]interface{}{"name": name}
+	if namespace, _ := target["namespace"].(string); namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return metadata
+}
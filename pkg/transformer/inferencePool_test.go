@@ -0,0 +1,56 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferencePoolFor(t *testing.T) {
+	target := map[string]interface{}{"name": "llama", "namespace": "ml"}
+	labels := map[string]interface{}{"app": "llama"}
+
+	pool, err := inferencePoolFor(target, labels, float64(8000), "llama-epp")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "inference.networking.x-k8s.io/v1alpha2",
+		"kind":       "InferencePool",
+		"metadata":   map[string]interface{}{"name": "llama", "namespace": "ml"},
+		"spec": map[string]interface{}{
+			"selector":         labels,
+			"targetPortNumber": 8000,
+			"extensionRef":     map[string]interface{}{"name": "llama-epp"},
+		},
+	}, pool)
+
+	_, err = inferencePoolFor(map[string]interface{}{}, labels, 8000, "llama-epp")
+	assert.ErrorContains(t, err, "has no name")
+	_, err = inferencePoolFor(target, nil, 8000, "llama-epp")
+	assert.ErrorContains(t, err, "has no labels to select pods")
+	_, err = inferencePoolFor(target, labels, 70000, "llama-epp")
+	assert.ErrorContains(t, err, "target port must be a number")
+	_, err = inferencePoolFor(target, labels, "8000", "llama-epp")
+	assert.ErrorContains(t, err, "target port must be a number")
+	_, err = inferencePoolFor(target, labels, 8000, "")
+	assert.ErrorContains(t, err, "has no endpoint picker")
+}
+
+func TestInferenceModelFor(t *testing.T) {
+	model, err := inferenceModelFor(map[string]interface{}{"name": "llama"}, "meta-llama/Llama-3.1-8B-Instruct", "llama")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "inference.networking.x-k8s.io/v1alpha2",
+		"kind":       "InferenceModel",
+		"metadata":   map[string]interface{}{"name": "llama"},
+		"spec": map[string]interface{}{
+			"modelName": "meta-llama/Llama-3.1-8B-Instruct",
+			"poolRef":   map[string]interface{}{"name": "llama"},
+		},
+	}, model)
+
+	_, err = inferenceModelFor(map[string]interface{}{"name": "llama"}, "", "llama")
+	assert.ErrorContains(t, err, "has no model name")
+	_, err = inferenceModelFor(map[string]interface{}{"name": "llama"}, "llama", "")
+	assert.ErrorContains(t, err, "has no pool")
+}
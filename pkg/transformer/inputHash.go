@@ -0,0 +1,104 @@
+package transformer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// InputHash returns a hash of the inputs of the render of obj: obj and the
+// resources it is connected to or consumes, the integrations of their kinds,
+// the content of their template bundles and the settings of the transformer.
+// It discovers the resources like Run does, but neither resolves the context
+// nor executes templates, so that a resource whose inputs did not change need
+// not be rendered. The responses of context requests and the cluster state
+// that template functions read are not part of the hash.
+func (t *Transformer) InputHash(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, rClient client.Client, obj *unstructured.Unstructured) (string, error) {
+	inputs, err := t.DiscoverInputs(ctx, obj, v1.DiscoverOptions{DiscoveryClient: discoveryClient, DynamicClient: dynamicClient})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	write := func(value any) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode render input: %w", err)
+		}
+		h.Write(data)
+		h.Write([]byte{'\n'})
+		return nil
+	}
+
+	var kinds []schema.GroupVersionKind
+	for _, resource := range append(slices.Clone(inputs.Resources), inputs.Consumed...) {
+		gvk := resource.GroupVersionKind()
+		integrated := t.registry.HasIntegration(gvk)
+		if err := write(renderInput(resource, integrated)); err != nil {
+			return "", err
+		}
+		if integrated && !slices.Contains(kinds, gvk) {
+			kinds = append(kinds, gvk)
+		}
+	}
+	for _, gvk := range kinds {
+		spec, _ := t.registry.GetIntegrationSpec(gvk)
+		bundles, err := t.TemplateHashes(ctx, rClient, spec)
+		if err != nil {
+			return "", err
+		}
+		// The overlays and patches depend on the environment as well.
+		if err := write([]any{spec, bundles, t.registry.GetOverlayPaths(gvk), t.registry.GetPatchTemplates(gvk)}); err != nil {
+			return "", err
+		}
+	}
+
+	mutators := make([]string, 0, len(t.mutators))
+	for _, mutator := range t.mutators {
+		mutators = append(mutators, mutator.name)
+	}
+	if err := write([]any{t.securityPolicy, t.clusterDefaultsFor(obj.GroupVersionKind()), t.clusterContext(), t.configChecksums, mutators}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// renderInput returns the part of resource that templates may read. The
+// metadata that changes on every write is left out. The status of resources
+// of integrated kinds is written by the operator, so only its sticky context
+// values are kept, and the status of other resources is kept as it is.
+func renderInput(resource *unstructured.Unstructured, integrated bool) map[string]interface{} {
+	input := make(map[string]interface{}, len(resource.Object))
+	for key, value := range resource.Object {
+		if key != "metadata" && key != "status" {
+			input[key] = value
+		}
+	}
+	input["metadata"] = map[string]interface{}{
+		"name":        resource.GetName(),
+		"namespace":   resource.GetNamespace(),
+		"uid":         string(resource.GetUID()),
+		"generation":  resource.GetGeneration(),
+		"labels":      resource.GetLabels(),
+		"annotations": resource.GetAnnotations(),
+	}
+	if !integrated {
+		if status, ok := resource.Object["status"]; ok {
+			input["status"] = status
+		}
+	} else if sticky, found, _ := unstructured.NestedFieldNoCopy(resource.Object, "status", stickyContextField); found {
+		input["status"] = map[string]interface{}{stickyContextField: sticky}
+	}
+	return input
+}
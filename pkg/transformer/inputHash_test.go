@@ -0,0 +1,84 @@
+package transformer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestInputHash(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	pipeline := newTestPipeline(t, gvk, map[string]string{"service.yaml": "kind: Service\n"})
+	registry := pipeline.registry.(*mockRegistry)
+	registry.specs[gvk] = modelv1.IntegrationSpec{Templates: []modelv1.IntegrationApiTemplatesSpec{{Path: "embedded:/base", Operation: "template"}}}
+	obj := newTestObject(gvk.Group, gvk.Version, gvk.Kind, "llama")
+	require.NoError(t, unstructured.SetNestedField(obj.Object, int64(1), "spec", "replicas"))
+
+	hash, err := pipeline.InputHash(ctx, nil, nil, nil, obj)
+	require.NoError(t, err)
+	require.NotEmpty(t, hash)
+
+	unchanged := obj.DeepCopy()
+	unchanged.SetResourceVersion("2")
+	require.NoError(t, unstructured.SetNestedField(unchanged.Object, "hash", "status", "renderHash"))
+	same, err := pipeline.InputHash(ctx, nil, nil, nil, unchanged)
+	require.NoError(t, err)
+	assert.Equal(t, hash, same, "the status written by the operator is not an input")
+
+	changed := obj.DeepCopy()
+	require.NoError(t, unstructured.SetNestedField(changed.Object, int64(2), "spec", "replicas"))
+	other, err := pipeline.InputHash(ctx, nil, nil, nil, changed)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "the spec changed")
+
+	registry.specs[gvk] = modelv1.IntegrationSpec{
+		Templates:    registry.specs[gvk].Templates,
+		CommonLabels: map[string]string{"team": "serving"},
+	}
+	other, err = pipeline.InputHash(ctx, nil, nil, nil, obj)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "the integration changed")
+	hash = other
+
+	sourceFS, root, err := pipeline.fsProviderFunc(ctx, "embedded:/base")
+	require.NoError(t, err)
+	require.NoError(t, sourceFS.WriteFile(filepath.Join(root, "service.yaml"), []byte("kind: ConfigMap\n")))
+	other, err = pipeline.InputHash(ctx, nil, nil, nil, obj)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "the template content changed")
+	hash = other
+
+	pipeline.SetConfigChecksums(true)
+	other, err = pipeline.InputHash(ctx, nil, nil, nil, obj)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "the transformer settings changed")
+
+	_, err = pipeline.InputHash(ctx, nil, nil, nil, newTestObject(gvk.Group, gvk.Version, "Agent", "llama"))
+	assert.EqualError(t, err, "missing integration for model.skippy.io/v1, Kind=Agent")
+}
+
+func TestRenderInput(t *testing.T) {
+	obj := newTestObject("", "v1", "Service", "llama")
+	obj.SetResourceVersion("7")
+	obj.SetLabels(map[string]string{"app": "llama"})
+	require.NoError(t, unstructured.SetNestedField(obj.Object, "10.0.0.1", "spec", "clusterIP"))
+	require.NoError(t, unstructured.SetNestedField(obj.Object, "34.1.2.3", "status", "loadBalancer", "ip"))
+	require.NoError(t, unstructured.SetNestedField(obj.Object, "python", "status", stickyContextField, "runtime"))
+
+	input := renderInput(obj, false)
+	assert.Equal(t, obj.Object["spec"], input["spec"])
+	assert.Equal(t, obj.Object["status"], input["status"], "the status of other resources is an input")
+	assert.NotContains(t, input["metadata"], "resourceVersion")
+	assert.Equal(t, map[string]string{"app": "llama"}, input["metadata"].(map[string]interface{})["labels"])
+
+	input = renderInput(obj, true)
+	assert.Equal(t, map[string]interface{}{stickyContextField: map[string]interface{}{"runtime": "python"}}, input["status"])
+}
@@ -10,6 +10,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	template "github.com/google/safetext/yamltemplate"
 
@@ -23,6 +24,9 @@ import (
 
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 	"github.com/Masterminds/sprig/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/client-go/rest"
 )
 
@@ -33,6 +37,12 @@ type IntegrationRegistry struct {
 	m            sync.RWMutex
 	integrations []modelv1.IntegrationSpec
 	httpClient   *http.Client
+	// tlsClients are the clients of context requests with their own TLS
+	// options, derived from httpClient.
+	tlsClients   map[modelv1.IntegrationContextTLSSpec]*http.Client
+	tlsClientsMu sync.Mutex
+	// environment selects the overlays that are applied, e.g. "prod".
+	environment string
 }
 
 // NewIntegrationRegistry returns a new model.
@@ -55,6 +65,40 @@ func NewIntegrationRegistry() *IntegrationRegistry {
 	}
 }
 
+// SetHTTPClient sets the client that the context requests of the
+// integrations are sent with, an authenticated Google client by default.
+func (m *IntegrationRegistry) SetHTTPClient(client *http.Client) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.httpClient = client
+	m.tlsClientsMu.Lock()
+	defer m.tlsClientsMu.Unlock()
+	m.tlsClients = nil
+}
+
+// contextClient returns the client of a context request with the TLS options
+// of spec, if any. The clients are reused so that they keep their
+// connections.
+func (m *IntegrationRegistry) contextClient(client *http.Client, spec *modelv1.IntegrationContextTLSSpec) (*http.Client, error) {
+	if spec == nil {
+		return client, nil
+	}
+	m.tlsClientsMu.Lock()
+	defer m.tlsClientsMu.Unlock()
+	if tlsClient, found := m.tlsClients[*spec]; found {
+		return tlsClient, nil
+	}
+	tlsClient, err := contextTLSClient(client, *spec)
+	if err != nil {
+		return nil, err
+	}
+	if m.tlsClients == nil {
+		m.tlsClients = map[modelv1.IntegrationContextTLSSpec]*http.Client{}
+	}
+	m.tlsClients[*spec] = tlsClient
+	return tlsClient, nil
+}
+
 // SetIntegrations allows to set the integrations
 func (m *IntegrationRegistry) SetIntegrations(integrations []modelv1.IntegrationSpec) {
 	m.m.Lock()
@@ -62,6 +106,13 @@ func (m *IntegrationRegistry) SetIntegrations(integrations []modelv1.Integration
 	m.integrations = integrations
 }
 
+// SetEnvironment selects the environment whose overlays are applied.
+func (m *IntegrationRegistry) SetEnvironment(environment string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.environment = environment
+}
+
 func (m *IntegrationRegistry) LockIntegrations() func() {
 	m.m.Lock()
 	return m.m.Unlock
@@ -141,8 +192,40 @@ func (m *IntegrationRegistry) GetReferenceRules(gvk schema.GroupVersionKind) []m
 	return integrationSpec.References
 }
 
-// ResolveContext returns the context for the specified resource.
-func (m *IntegrationRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any) error {
+// GetIntegrationSpec returns a copy of the integration for the given GVK, and
+// whether there is one.
+func (m *IntegrationRegistry) GetIntegrationSpec(gvk schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	integrationSpec, ok := m.findIntegration(gvk)
+	if !ok {
+		return modelv1.IntegrationSpec{}, false
+	}
+	return *integrationSpec.DeepCopy(), true
+}
+
+// autoscalerOf returns the autoscaler kind that spec renders autoscaling
+// blocks as, defaulting to "HorizontalPodAutoscaler".
+func autoscalerOf(spec modelv1.IntegrationSpec) string {
+	if spec.Autoscaler == "" {
+		return AutoscalerHPA
+	}
+	return spec.Autoscaler
+}
+
+// monitoringOf returns the monitoring mode of spec, defaulting to "Auto".
+func monitoringOf(spec modelv1.IntegrationSpec) string {
+	if spec.Monitoring == "" {
+		return MonitoringAuto
+	}
+	return spec.Monitoring
+}
+
+// ResolveContext returns the context for the specified resource. The status
+// of a reference is not written by the render, so a reference only reuses the
+// sticky values that its own reconcile stored.
+func (m *IntegrationRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any, reference bool) error {
 	m.m.RLock()
 	defer m.m.RUnlock()
 
@@ -170,47 +253,110 @@ func (m *IntegrationRegistry) ResolveContext(ctx context.Context, resource *unst
 		if method != "GET" {
 			return fmt.Errorf("invalid request. only GET supported")
 		}
+		if ctxConfig.Sticky {
+			if value, ok := stickyContext(resource, ctxConfig.Name); ok {
+				output[ctxConfig.Name] = value
+				continue
+			}
+			if reference {
+				return fmt.Errorf("context %s: referenced %s %s has no sticky value for its generation yet", ctxConfig.Name, resource.GetKind(), resource.GetName())
+			}
+		}
 		temp, err := template.New(path).Funcs(sprig.FuncMap()).Funcs(template.FuncMap{
 			"urlEncodeModelName": urlEncodeModelName,
 		}).Parse(path)
 		if err != nil {
-			return err
+			return &RenderError{Path: path, Err: err}
 		}
 		builder := strings.Builder{}
 		if err := temp.Execute(&builder, output); err != nil {
-			return err
+			return &RenderError{Path: path, Err: err}
 		}
 
 		requestURL := builder.String() // Store the URL
 
-		res, err := client.Get(requestURL)
-		if err != nil {
-			return err
+		var maxBytes int64
+		if ctxConfig.MaxBytes != nil {
+			maxBytes = *ctxConfig.MaxBytes
 		}
-		defer res.Body.Close() // Ensure the body is closed
-
-		if res.StatusCode != http.StatusOK {
-			// Read the response body to get more information about the error
-			errorBody, err := io.ReadAll(res.Body)
-			if err != nil {
-				return fmt.Errorf("invalid return: %d. And could not read body", res.StatusCode)
-			}
-			return fmt.Errorf("invalid return: %d. Body: %s", res.StatusCode, string(errorBody))
+		requestClient, err := m.contextClient(client, ctxConfig.TLS)
+		if err != nil {
+			return fmt.Errorf("context %s: %w", ctxConfig.Name, err)
 		}
-
-		buffer, err := io.ReadAll(res.Body)
+		body, err := fetchContext(ctx, requestClient, ctxConfig.Name, method, requestURL, maxBytes)
 		if err != nil {
 			return err
 		}
-		var body any
-		if err := json.Unmarshal(buffer, &body); err != nil {
+		if body, err = shapeContext(ctxConfig, body); err != nil {
 			return err
 		}
+		if ctxConfig.Sticky {
+			if err := setStickyContext(resource, ctxConfig.Name, body); err != nil {
+				return err
+			}
+		}
 		output[ctxConfig.Name] = body
 	}
 	return nil
 }
 
+// fetchContext performs a single context request inside its own span so that
+// slow external APIs show up in traces.
+func fetchContext(ctx context.Context, client *http.Client, name, method, requestURL string, maxBytes int64) (any, error) {
+	ctx, span := tracer.Start(ctx, "ResolveContext.Request", trace.WithAttributes(
+		attribute.String("karo.context.name", name),
+		attribute.String("http.request.method", method),
+	))
+	defer span.End()
+
+	body, err := doContextRequest(ctx, client, name, method, requestURL, maxBytes)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return body, err
+}
+
+// doContextRequest sends a context request and decodes its JSON response,
+// failing if it is larger than maxBytes, unless that is 0.
+func doContextRequest(ctx context.Context, client *http.Client, name, method, requestURL string, maxBytes int64) (any, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close() // Ensure the body is closed
+
+	if res.StatusCode != http.StatusOK {
+		// The body may be a long HTML page or contain sensitive details, so
+		// the error only carries a summary and the full body is logged for
+		// debugging.
+		errorBody, _ := io.ReadAll(res.Body)
+		log.FromContext(ctx).V(1).Info("Context request failed", "name", name, "status", res.StatusCode, "body", string(errorBody))
+		return nil, newContextRequestError(name, res, errorBody, time.Now())
+	}
+
+	reader := io.Reader(res.Body)
+	if maxBytes > 0 {
+		reader = io.LimitReader(res.Body, maxBytes+1)
+	}
+	buffer, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(len(buffer)) > maxBytes {
+		return nil, fmt.Errorf("context %s: the response is larger than %d bytes", name, maxBytes)
+	}
+	var body any
+	if err := json.Unmarshal(buffer, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
 func urlEncodeModelName(input string) (string, error) {
 	// A simple check for an empty string is still good practice.
 	if strings.TrimSpace(input) == "" {
@@ -244,6 +390,69 @@ func (m *IntegrationRegistry) GetTemplatePaths(k schema.GroupVersionKind) []stri
 	return m.getPaths(k, "template")
 }
 
+// GetOverlayPaths returns the overlay paths of the specified kind for the
+// current environment. No overlays apply when no environment is set.
+func (m *IntegrationRegistry) GetOverlayPaths(k schema.GroupVersionKind) []string {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	paths := []string{}
+	i, ok := m.findIntegration(k)
+	if !ok || m.environment == "" {
+		return paths
+	}
+	for _, template := range i.Templates {
+		if template.Operation == "overlay" && template.Environment == m.environment {
+			paths = append(paths, template.Path)
+		}
+	}
+	return paths
+}
+
+// GetPatchTemplates returns the patch bundles of the specified kind, with
+// the default patch type and conflict policy filled in.
+func (m *IntegrationRegistry) GetPatchTemplates(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	var patches []modelv1.IntegrationApiTemplatesSpec
+	i, ok := m.findIntegration(k)
+	if !ok {
+		return patches
+	}
+	for _, template := range i.Templates {
+		if template.Operation != "patch" {
+			continue
+		}
+		if template.PatchType == "" {
+			template.PatchType = PatchTypeStrategicMerge
+		}
+		if template.ConflictPolicy == "" {
+			template.ConflictPolicy = PatchConflictFail
+		}
+		patches = append(patches, template)
+	}
+	return patches
+}
+
+// GetKustomizeRoots returns the kustomize bundles of the specified kind.
+func (m *IntegrationRegistry) GetKustomizeRoots(k schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	var roots []modelv1.IntegrationApiTemplatesSpec
+	i, ok := m.findIntegration(k)
+	if !ok {
+		return roots
+	}
+	for _, template := range i.Templates {
+		if template.Operation == "kustomize" {
+			roots = append(roots, template)
+		}
+	}
+	return roots
+}
+
 func (m *IntegrationRegistry) getPaths(k schema.GroupVersionKind, operation string) []string {
 	paths := []string{}
 	i, ok := m.findIntegration(k)
@@ -3,14 +3,19 @@ package transformer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -149,6 +154,51 @@ func TestIntegrationRegistry_GetPaths(t *testing.T) {
 		}
 	})
 
+	t.Run("GetOverlayPaths", func(t *testing.T) {
+		withOverlays := NewIntegrationRegistry()
+		withOverlays.SetIntegrations([]modelv1.IntegrationSpec{
+			{Group: "apps", Version: "v1", Kind: "Deployment", Templates: []modelv1.IntegrationApiTemplatesSpec{
+				{Operation: "template", Path: "path/to/template"},
+				{Operation: "overlay", Path: "path/to/overlays/dev", Environment: "dev"},
+				{Operation: "overlay", Path: "path/to/overlays/prod", Environment: "prod"},
+			}},
+		})
+		if got := withOverlays.GetOverlayPaths(gvk); len(got) != 0 {
+			t.Errorf("GetOverlayPaths() without an environment = %v, want none", got)
+		}
+		withOverlays.SetEnvironment("prod")
+		if got, expected := withOverlays.GetOverlayPaths(gvk), []string{"path/to/overlays/prod"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("GetOverlayPaths() = %v, want %v", got, expected)
+		}
+		if got, expected := withOverlays.GetTemplatePaths(gvk), []string{"path/to/template"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("GetTemplatePaths() = %v, want %v", got, expected)
+		}
+	})
+
+	t.Run("GetPatchTemplates", func(t *testing.T) {
+		if got := reg.GetPatchTemplates(gvk); len(got) != 0 {
+			t.Errorf("GetPatchTemplates() = %v, want none", got)
+		}
+		withPatches := NewIntegrationRegistry()
+		withPatches.SetIntegrations([]modelv1.IntegrationSpec{
+			{Group: "apps", Version: "v1", Kind: "Deployment", Templates: []modelv1.IntegrationApiTemplatesSpec{
+				{Operation: "template", Path: "path/to/template"},
+				{Operation: "patch", Path: "path/to/patches"},
+				{Operation: "patch", Path: "path/to/json-patches", PatchType: PatchTypeJSON, ConflictPolicy: PatchConflictForce},
+			}},
+		})
+		expected := []modelv1.IntegrationApiTemplatesSpec{
+			{Operation: "patch", Path: "path/to/patches", PatchType: PatchTypeStrategicMerge, ConflictPolicy: PatchConflictFail},
+			{Operation: "patch", Path: "path/to/json-patches", PatchType: PatchTypeJSON, ConflictPolicy: PatchConflictForce},
+		}
+		if got := withPatches.GetPatchTemplates(gvk); !reflect.DeepEqual(got, expected) {
+			t.Errorf("GetPatchTemplates() = %v, want %v", got, expected)
+		}
+		if got, expected := withPatches.GetTemplatePaths(gvk), []string{"path/to/template"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("GetTemplatePaths() = %v, want %v", got, expected)
+		}
+	})
+
 	t.Run("GetReferencePaths", func(t *testing.T) {
 		refGVK := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"}
 		expectedNames := map[schema.GroupVersionKind]string{refGVK: "spec.serviceName"}
@@ -163,6 +213,49 @@ func TestIntegrationRegistry_GetPaths(t *testing.T) {
 			t.Errorf("GetReferencePaths() namespaces got = %v, want %v", gotNamespaces, expectedNamespaces)
 		}
 	})
+
+	t.Run("GetIntegrationSpec", func(t *testing.T) {
+		if _, ok := reg.GetIntegrationSpec(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}); ok {
+			t.Errorf("GetIntegrationSpec() found an integration of an unknown kind")
+		}
+
+		storage := &modelv1.IntegrationStorageSpec{
+			Credentials: &modelv1.IntegrationStorageCredentialsSpec{Source: StorageCredentialsAnonymous},
+			Endpoints:   []modelv1.IntegrationStorageEndpointSpec{{Bucket: "templates", Endpoint: "http://fake-gcs:4443/storage/v1/"}},
+		}
+		commonLabels := map[string]string{"team": "ml"}
+		withSettings := NewIntegrationRegistry()
+		withSettings.SetIntegrations([]modelv1.IntegrationSpec{
+			{Group: "apps", Version: "v1", Kind: "Deployment", Storage: storage, CommonLabels: commonLabels},
+		})
+		got, ok := withSettings.GetIntegrationSpec(gvk)
+		if !ok {
+			t.Fatalf("GetIntegrationSpec() found no integration")
+		}
+		if !reflect.DeepEqual(got.Storage, storage) || !reflect.DeepEqual(got.CommonLabels, commonLabels) {
+			t.Errorf("GetIntegrationSpec() = %v, want storage %v and labels %v", got, storage, commonLabels)
+		}
+		got.Storage.Endpoints[0].Endpoint = "changed"
+		got.CommonLabels["team"] = "changed"
+		if again, _ := withSettings.GetIntegrationSpec(gvk); again.Storage.Endpoints[0].Endpoint != "http://fake-gcs:4443/storage/v1/" || again.CommonLabels["team"] != "ml" {
+			t.Errorf("GetIntegrationSpec() returned settings shared with the registry")
+		}
+	})
+
+	t.Run("autoscaler and monitoring defaults", func(t *testing.T) {
+		if got := autoscalerOf(modelv1.IntegrationSpec{}); got != AutoscalerHPA {
+			t.Errorf("autoscalerOf() = %q, want %q", got, AutoscalerHPA)
+		}
+		if got := autoscalerOf(modelv1.IntegrationSpec{Autoscaler: AutoscalerKEDA}); got != AutoscalerKEDA {
+			t.Errorf("autoscalerOf() = %q, want %q", got, AutoscalerKEDA)
+		}
+		if got := monitoringOf(modelv1.IntegrationSpec{}); got != MonitoringAuto {
+			t.Errorf("monitoringOf() = %q, want %q", got, MonitoringAuto)
+		}
+		if got := monitoringOf(modelv1.IntegrationSpec{Monitoring: MonitoringPrometheusOperator}); got != MonitoringPrometheusOperator {
+			t.Errorf("monitoringOf() = %q, want %q", got, MonitoringPrometheusOperator)
+		}
+	})
 }
 
 func TestIntegrationRegistry_ResolveContext(t *testing.T) {
@@ -213,7 +306,7 @@ func TestIntegrationRegistry_ResolveContext(t *testing.T) {
 		}
 
 		// ACT
-		err := reg.ResolveContext(ctx, resource, output)
+		err := reg.ResolveContext(ctx, resource, output, false)
 
 		// ASSERT
 		if err != nil {
@@ -247,7 +340,7 @@ func TestIntegrationRegistry_ResolveContext(t *testing.T) {
 		output := map[string]any{"resource": map[string]interface{}{"spec": map[string]interface{}{"serviceName": "any"}}}
 
 		// ACT
-		err := reg.ResolveContext(ctx, resource, output)
+		err := reg.ResolveContext(ctx, resource, output, false)
 
 		// ASSERT
 		if err == nil {
@@ -257,6 +350,58 @@ func TestIntegrationRegistry_ResolveContext(t *testing.T) {
 		}
 	})
 
+	t.Run("upstream error body is summarized", func(t *testing.T) {
+		mockTripper.RoundTripFunc = func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": []string{"10"}},
+				Body:       io.NopCloser(bytes.NewBufferString(`{"error": {"message": "backend unavailable", "debug": "token: s3cr3t"}}`)),
+			}, nil
+		}
+		resource := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ServiceMonitor", "apiVersion": "monitoring.coreos.com/v1"}}
+		output := map[string]any{"resource": map[string]interface{}{"spec": map[string]interface{}{"serviceName": "any"}}}
+
+		err := reg.ResolveContext(ctx, resource, output, false)
+		var requestErr *ContextRequestError
+		if !errors.As(err, &requestErr) {
+			t.Fatalf("ResolveContext() error = %v, want a ContextRequestError", err)
+		}
+		if requestErr.StatusCode != http.StatusServiceUnavailable || requestErr.RetryAfter != 10*time.Second || requestErr.Summary != "backend unavailable" {
+			t.Errorf("ResolveContext() error = %#v", requestErr)
+		}
+		if strings.Contains(err.Error(), "s3cr3t") {
+			t.Errorf("ResolveContext() error %q contains the upstream body", err)
+		}
+	})
+
 	// This is a bit of a trick to allow mocking google.DefaultClient
 	// which is a global variable in its package.
 }
+
+func TestFetchContextRecordsSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	client := &http.Client{Transport: &MockRoundTripper{
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString(`{"ok": true}`)),
+		},
+	}}
+
+	body, err := fetchContext(context.Background(), client, "serviceInfo", "GET", "https://example.com/services/foo", 0)
+	if err != nil {
+		t.Fatalf("fetchContext() error = %v", err)
+	}
+	if !reflect.DeepEqual(body, map[string]any{"ok": true}) {
+		t.Errorf("fetchContext() = %v", body)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "ResolveContext.Request" {
+		t.Fatalf("expected a single ResolveContext.Request span, got %v", spans)
+	}
+}
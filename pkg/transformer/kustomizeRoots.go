@@ -0,0 +1,115 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+const (
+	// valuesFileName is the file written at the path of a kustomize bundle
+	// that holds the values of the resource.
+	valuesFileName = "karo-values.yaml"
+	// valuesConfigMapName is the name of the ConfigMap in valuesFileName.
+	valuesConfigMapName = "karo-values"
+	// localConfigAnnotation marks objects that kustomize reads but does not
+	// output.
+	localConfigAnnotation = "config.kubernetes.io/local-config"
+)
+
+// hasKustomization returns true if there is a kustomization in dir.
+func hasKustomization(fSys filesys.FileSystem, dir string) bool {
+	for _, name := range kustomizationFileNames {
+		if fSys.Exists(path.Join(dir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBundle copies the files under rootPath, kustomizations included, to the
+// same paths under targetDir, and returns their source paths.
+func copyBundle(ctx context.Context, sourceFS, targetFS filesys.FileSystem, rootPath, targetDir string) ([]string, error) {
+	var sourcePaths []string
+	err := sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		sourcePaths = append(sourcePaths, sourcePath)
+		return copyFile(sourceFS, targetFS, sourcePath, path.Join(targetDir, sourcePath), ctx)
+	})
+	return sourcePaths, err
+}
+
+// renderKustomizeBundle copies a kustomize bundle to targetDir with the values
+// file of the resource, and returns the render paths of the files and of the
+// kustomize root, relative to dir.
+func renderKustomizeBundle(ctx context.Context, sourceFS, targetFS filesys.FileSystem, rootPath, targetDir, dir string, bundle modelv1.IntegrationApiTemplatesSpec, context map[string]any) ([]string, string, error) {
+	root := path.Clean(bundle.Root)
+	if path.IsAbs(root) || root == ".." || strings.HasPrefix(root, "../") {
+		return nil, "", fmt.Errorf("kustomize root %q must be a directory of the bundle", bundle.Root)
+	}
+	if !hasKustomization(sourceFS, path.Join(rootPath, root)) {
+		return nil, "", fmt.Errorf("kustomize root %q of %s has no kustomization", bundle.Root, bundle.Path)
+	}
+
+	sourcePaths, err := copyBundle(ctx, sourceFS, targetFS, rootPath, targetDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("error walking path %q: %w", bundle.Path, err)
+	}
+	var files []string
+	for _, sourcePath := range sourcePaths {
+		files = append(files, path.Join(dir, sourcePath))
+	}
+
+	resource, _ := context["resource"].(map[string]interface{})
+	values, err := valuesFile(&unstructured.Unstructured{Object: resource}, bundle.Vars, context)
+	if err != nil {
+		return nil, "", err
+	}
+	valuesPath := path.Join(rootPath, valuesFileName)
+	if err := targetFS.WriteFile(path.Join(targetDir, valuesPath), values); err != nil {
+		return nil, "", fmt.Errorf("failed to write %s: %w", valuesFileName, err)
+	}
+	files = append(files, path.Join(dir, valuesPath))
+
+	return files, path.Join(dir, rootPath, root), nil
+}
+
+// valuesFile returns the ConfigMap with the name and namespace of resource and
+// the rendered vars, which kustomizations of the bundle read with
+// replacements.
+func valuesFile(resource *unstructured.Unstructured, vars map[string]string, context map[string]any) ([]byte, error) {
+	data := map[string]interface{}{
+		"name":      resource.GetName(),
+		"namespace": resource.GetNamespace(),
+	}
+	for name, text := range vars {
+		value, err := renderText("var "+name, text, context)
+		if err != nil {
+			return nil, err
+		}
+		data[name] = value
+	}
+	values := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":        valuesConfigMapName,
+			"annotations": map[string]interface{}{localConfigAnnotation: "true"},
+		},
+		"data": data,
+	}
+	return yaml.Marshal(values)
+}
@@ -0,0 +1,173 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	a "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestTransformerRun_WithKustomizeRoot(t *testing.T) {
+	ctx := context.Background()
+	testNamespace := "kustomize-ns"
+	testName := "kustomize-resource"
+
+	sourceFs := filesys.MakeFsInMemory()
+	// The bundle keeps the layout of its author: a base and an overlay that
+	// reads the values of the resource.
+	require.NoError(t, sourceFs.WriteFile("app/base/kustomization.yaml", []byte("resources:\n- deployment.yaml\n")))
+	require.NoError(t, sourceFs.WriteFile("app/base/deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: server
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: server
+        image: server:latest
+`)))
+	require.NoError(t, sourceFs.WriteFile("app/overlays/prod/kustomization.yaml", []byte(`resources:
+- ../../base
+- ../../karo-values.yaml
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 3
+  target:
+    kind: Deployment
+replacements:
+- source:
+    kind: ConfigMap
+    name: karo-values
+    fieldPath: data.image
+  targets:
+  - select:
+      kind: Deployment
+    fieldPaths:
+    - spec.template.spec.containers.[name=server].image
+- source:
+    kind: ConfigMap
+    name: karo-values
+    fieldPath: data.namespace
+  targets:
+  - select:
+      kind: Deployment
+    fieldPaths:
+    - metadata.namespace
+    options:
+      create: true
+`)))
+	// A copy bundle with a kustomization of its own is built as it is.
+	require.NoError(t, sourceFs.WriteFile("static/kustomization.yaml", []byte("namePrefix: static-\nresources:\n- service.yaml\n")))
+	require.NoError(t, sourceFs.WriteFile("static/service.yaml", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: server
+spec:
+  ports:
+  - port: 80
+`)))
+	require.NoError(t, sourceFs.WriteFile("v1/apply/apply.yaml", []byte(`
+resources:
+{{- range . }}
+- {{ . }}
+{{- end }}
+`)))
+
+	objGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(objGVK.Group, objGVK.Version, objGVK.Kind, testName)
+	obj.SetNamespace(testNamespace)
+	require.NoError(t, unstructured.SetNestedField(obj.Object, "server:1.2", "spec", "image"))
+
+	run := func(roots []modelv1.IntegrationApiTemplatesSpec, copyPaths []string) ([]*unstructured.Unstructured, error) {
+		transformer := NewTransformer()
+		transformer.registry = &mockRegistry{
+			integrations: []schema.GroupVersionKind{objGVK},
+			copyPaths:    map[schema.GroupVersionKind][]string{objGVK: copyPaths},
+			roots:        map[schema.GroupVersionKind][]modelv1.IntegrationApiTemplatesSpec{objGVK: roots},
+		}
+		transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+			switch path {
+			case "embedded:/app":
+				return sourceFs, "app", nil
+			case "embedded:/static":
+				return sourceFs, "static", nil
+			case "embedded:/v1/apply":
+				return sourceFs, filepath.Join("v1", "apply"), nil
+			default:
+				return nil, "", fmt.Errorf("fsProviderFunc received an unexpected path: %s", path)
+			}
+		}
+		transformer.findConnectedResourcesFunc = func(ctx context.Context, discovery discovery.DiscoveryInterface, dynamic dynamic.Interface, u *unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+			return nil, nil, nil
+		}
+		transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+			return resources, nil
+		}
+
+		dynamicClient := fake.NewSimpleDynamicClient(scheme.Scheme, obj)
+		discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+		testScheme := runtime.NewScheme()
+		_ = scheme.AddToScheme(testScheme)
+		fakeTypedClient := a.NewClientBuilder().WithScheme(testScheme).WithObjects(obj).Build()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: testName}}
+
+		return transformer.Run(ctx, discoveryClient, dynamicClient, &mockRESTMapper{}, fakeTypedClient, req, obj)
+	}
+
+	t.Run("builds the kustomize root with the values of the resource", func(t *testing.T) {
+		result, err := run([]modelv1.IntegrationApiTemplatesSpec{{
+			Operation: "kustomize",
+			Path:      "embedded:/app",
+			Root:      "overlays/prod",
+			Vars:      map[string]string{"image": "{{ .resource.spec.image }}"},
+		}}, []string{"embedded:/static"})
+		require.NoError(t, err)
+		require.Len(t, result, 2, "the values ConfigMap is local config")
+
+		deployment, service := result[0], result[1]
+		if deployment.GetKind() != "Deployment" {
+			deployment, service = service, deployment
+		}
+		assert.Equal(t, "server", deployment.GetName())
+		assert.Equal(t, testNamespace, deployment.GetNamespace())
+		replicas, _, _ := unstructured.NestedFieldNoCopy(deployment.Object, "spec", "replicas")
+		assert.EqualValues(t, 3, replicas)
+		containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+		require.Len(t, containers, 1)
+		assert.Equal(t, "server:1.2", containers[0].(map[string]interface{})["image"])
+
+		assert.Equal(t, "Service", service.GetKind())
+		assert.Equal(t, "static-server", service.GetName())
+	})
+
+	t.Run("rejects roots outside the bundle", func(t *testing.T) {
+		_, err := run([]modelv1.IntegrationApiTemplatesSpec{{Operation: "kustomize", Path: "embedded:/app", Root: "../static"}}, nil)
+		assert.ErrorContains(t, err, `kustomize root "../static" must be a directory of the bundle`)
+	})
+
+	t.Run("rejects roots without a kustomization", func(t *testing.T) {
+		_, err := run([]modelv1.IntegrationApiTemplatesSpec{{Operation: "kustomize", Path: "embedded:/app"}}, nil)
+		assert.ErrorContains(t, err, `kustomize root "" of embedded:/app has no kustomization`)
+	})
+}
@@ -0,0 +1,37 @@
+package transformer
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	// MonitoringAuto selects the first monitoring flavor whose CRDs the
+	// cluster serves.
+	MonitoringAuto = "Auto"
+	// MonitoringGoogleManagedPrometheus renders monitoring.googleapis.com
+	// PodMonitorings.
+	MonitoringGoogleManagedPrometheus = "GoogleManagedPrometheus"
+	// MonitoringPrometheusOperator renders monitoring.coreos.com PodMonitors
+	// and ServiceMonitors.
+	MonitoringPrometheusOperator = "PrometheusOperator"
+	// MonitoringNone renders no monitoring objects.
+	MonitoringNone = "None"
+)
+
+// monitoringFlavor resolves the monitoring mode of an integration to the
+// flavor that templates render, which they read as .monitoring, e.g.
+// {{ if eq .monitoring "PrometheusOperator" }}. The Auto mode prefers Google
+// Managed Prometheus, as GKE clusters may serve both families.
+func monitoringFlavor(mapper meta.RESTMapper, mode string) string {
+	if mode != "" && mode != MonitoringAuto {
+		return mode
+	}
+	switch {
+	case apiAvailable(mapper, "monitoring.googleapis.com", "PodMonitoring"):
+		return MonitoringGoogleManagedPrometheus
+	case apiAvailable(mapper, "monitoring.coreos.com", "PodMonitor"):
+		return MonitoringPrometheusOperator
+	default:
+		return MonitoringNone
+	}
+}
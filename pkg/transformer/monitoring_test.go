@@ -0,0 +1,40 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMonitoringFlavor(t *testing.T) {
+	gmp := schema.GroupVersionKind{Group: "monitoring.googleapis.com", Version: "v1", Kind: "PodMonitoring"}
+	operator := schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+	mapperFor := func(gvks ...schema.GroupVersionKind) meta.RESTMapper {
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gmp.GroupVersion(), operator.GroupVersion()})
+		for _, gvk := range gvks {
+			mapper.Add(gvk, meta.RESTScopeNamespace)
+		}
+		return mapper
+	}
+
+	testCases := []struct {
+		name     string
+		mapper   meta.RESTMapper
+		mode     string
+		expected string
+	}{
+		{"both families prefer GMP", mapperFor(gmp, operator), MonitoringAuto, MonitoringGoogleManagedPrometheus},
+		{"prometheus operator only", mapperFor(operator), "", MonitoringPrometheusOperator},
+		{"no monitoring CRDs", mapperFor(), MonitoringAuto, MonitoringNone},
+		{"no mapper", nil, MonitoringAuto, MonitoringNone},
+		{"explicit mode is kept", mapperFor(gmp), MonitoringPrometheusOperator, MonitoringPrometheusOperator},
+		{"explicitly disabled", mapperFor(gmp), MonitoringNone, MonitoringNone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, monitoringFlavor(tc.mapper, tc.mode))
+		})
+	}
+}
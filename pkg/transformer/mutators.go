@@ -0,0 +1,121 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Mutator changes rendered objects before they are handed to the reconciler.
+// Mutators make cross-cutting changes, such as injecting cost labels, proxy
+// sidecars or imagePullSecrets, without editing every template.
+type Mutator interface {
+	// Mutate changes obj in place. owner is the resource the object was
+	// rendered for. Rendered objects may hold plain Go ints, so use the
+	// NoCopy unstructured helpers or type assertions to read them.
+	Mutate(ctx context.Context, owner, obj *unstructured.Unstructured) error
+}
+
+// MutatorFunc adapts a function to the Mutator interface.
+type MutatorFunc func(ctx context.Context, owner, obj *unstructured.Unstructured) error
+
+// Mutate calls f(ctx, owner, obj).
+func (f MutatorFunc) Mutate(ctx context.Context, owner, obj *unstructured.Unstructured) error {
+	return f(ctx, owner, obj)
+}
+
+type namedMutator struct {
+	name    string
+	mutator Mutator
+}
+
+// RegisterMutator adds a mutator that is applied to every rendered object, in
+// registration order. Mutators run before the security policy is enforced, so
+// injected containers are subject to it as well. It is not safe to register
+// mutators while the transformer is running.
+func (t *Transformer) RegisterMutator(name string, mutator Mutator) {
+	t.mutators = append(t.mutators, namedMutator{name: name, mutator: mutator})
+}
+
+// applyMutators runs the registered mutators on a rendered object.
+func (t *Transformer) applyMutators(ctx context.Context, owner, obj *unstructured.Unstructured) error {
+	for _, m := range t.mutators {
+		if err := m.mutator.Mutate(ctx, owner, obj); err != nil {
+			return fmt.Errorf("mutator %q failed on %s %s: %w", m.name, obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// ImagePullSecretsMutator returns a mutator that adds the named Secrets to the
+// imagePullSecrets of every generated pod spec.
+func ImagePullSecretsMutator(names ...string) Mutator {
+	return MutatorFunc(func(_ context.Context, _ *unstructured.Unstructured, obj *unstructured.Unstructured) error {
+		for _, path := range podSpecPaths[obj.GetKind()] {
+			rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+			podSpec, ok := rawPodSpec.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			secrets, _ := podSpec["imagePullSecrets"].([]interface{})
+			for _, name := range names {
+				if !hasNamedEntry(secrets, name) {
+					secrets = append(secrets, map[string]interface{}{"name": name})
+				}
+			}
+			podSpec["imagePullSecrets"] = secrets
+		}
+		return nil
+	})
+}
+
+// TopologySpreadMutator returns a mutator that adds a topology spread
+// constraint over the given topology key (e.g. "topology.kubernetes.io/zone")
+// to generated pod specs that do not define any. The constraint selects the
+// pods by the labels of their template.
+func TopologySpreadMutator(topologyKey string, maxSkew int64, whenUnsatisfiable string) Mutator {
+	return MutatorFunc(func(_ context.Context, _ *unstructured.Unstructured, obj *unstructured.Unstructured) error {
+		if obj.GetKind() == "Pod" {
+			return nil
+		}
+		for _, path := range podSpecPaths[obj.GetKind()] {
+			rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+			podSpec, ok := rawPodSpec.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, found := podSpec["topologySpreadConstraints"]; found {
+				continue
+			}
+			templatePath := path[:len(path)-1]
+			labels, _, _ := unstructured.NestedFieldNoCopy(obj.Object, append(append([]string{}, templatePath...), "metadata", "labels")...)
+			labelMap, _ := labels.(map[string]interface{})
+			if len(labelMap) == 0 {
+				continue
+			}
+			matchLabels := make(map[string]interface{}, len(labelMap))
+			for k, v := range labelMap {
+				matchLabels[k] = v
+			}
+			podSpec["topologySpreadConstraints"] = []interface{}{
+				map[string]interface{}{
+					"maxSkew":           maxSkew,
+					"topologyKey":       topologyKey,
+					"whenUnsatisfiable": whenUnsatisfiable,
+					"labelSelector":     map[string]interface{}{"matchLabels": matchLabels},
+				},
+			}
+		}
+		return nil
+	})
+}
+
+func hasNamedEntry(entries []interface{}, name string) bool {
+	for _, entry := range entries {
+		if m, ok := entry.(map[string]interface{}); ok && m["name"] == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyMutators(t *testing.T) {
+	transformer := NewTransformer()
+	var calls []string
+	for _, name := range []string{"first", "second"} {
+		transformer.RegisterMutator(name, MutatorFunc(func(context.Context, *unstructured.Unstructured, *unstructured.Unstructured) error {
+			calls = append(calls, name)
+			return nil
+		}))
+	}
+	owner := newTestObject("model.skippy.io", "v1", "AgenticSandbox", "sandbox")
+	obj := newTestObject("", "v1", "Service", "web")
+	require.NoError(t, transformer.applyMutators(context.Background(), owner, obj))
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	transformer.RegisterMutator("broken", MutatorFunc(func(context.Context, *unstructured.Unstructured, *unstructured.Unstructured) error {
+		return errors.New("boom")
+	}))
+	err := transformer.applyMutators(context.Background(), owner, obj)
+	assert.EqualError(t, err, `mutator "broken" failed on Service web: boom`)
+}
+
+func TestImagePullSecretsMutator(t *testing.T) {
+	obj := newTestDeploymentWithPodSpec(map[string]interface{}{
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "existing"}},
+		"containers":       []interface{}{map[string]interface{}{"name": "app"}},
+	})
+	require.NoError(t, ImagePullSecretsMutator("existing", "registry").Mutate(context.Background(), nil, obj))
+
+	podSpec := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "existing"},
+		map[string]interface{}{"name": "registry"},
+	}, podSpec["imagePullSecrets"])
+
+	service := newTestObject("", "v1", "Service", "web")
+	require.NoError(t, ImagePullSecretsMutator("registry").Mutate(context.Background(), nil, service))
+	assert.Equal(t, map[string]interface{}{}, service.Object["spec"])
+}
+
+func TestTopologySpreadMutator(t *testing.T) {
+	obj := newTestDeploymentWithPodSpec(map[string]interface{}{
+		"containers": []interface{}{map[string]interface{}{"name": "app"}},
+	})
+	template := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	template["metadata"] = map[string]interface{}{"labels": map[string]interface{}{"app": "web"}}
+	require.NoError(t, TopologySpreadMutator("topology.kubernetes.io/zone", 1, "ScheduleAnyway").Mutate(context.Background(), nil, obj))
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"maxSkew":           int64(1),
+			"topologyKey":       "topology.kubernetes.io/zone",
+			"whenUnsatisfiable": "ScheduleAnyway",
+			"labelSelector":     map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+		},
+	}, template["spec"].(map[string]interface{})["topologySpreadConstraints"])
+
+	// Constraints set by the template are kept.
+	podSpec := template["spec"].(map[string]interface{})
+	podSpec["topologySpreadConstraints"] = []interface{}{}
+	require.NoError(t, TopologySpreadMutator("kubernetes.io/hostname", 1, "DoNotSchedule").Mutate(context.Background(), nil, obj))
+	assert.Equal(t, []interface{}{}, podSpec["topologySpreadConstraints"])
+}
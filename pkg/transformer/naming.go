@@ -0,0 +1,130 @@
+package transformer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	template "github.com/google/safetext/yamltemplate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// maxNameLength is the limit for names that must be DNS subdomains.
+	maxNameLength = 253
+	// truncatedHashLength is the number of hex digits of the hash that
+	// truncateName appends.
+	truncatedHashLength = 8
+)
+
+// maxNameLengths lists the kinds whose names have a stricter limit than a
+// DNS subdomain. Services must be DNS labels, and the Job and CronJob
+// controllers use the name in labels and in the names of the objects they
+// create.
+var maxNameLengths = map[string]int{
+	"Service":     63,
+	"Namespace":   63,
+	"Job":         63,
+	"CronJob":     52,
+	"StatefulSet": 52,
+}
+
+// truncateName shortens name to at most max characters. Truncated names end
+// with a hash of the full name, so that long names that share a prefix stay
+// distinct, e.g. {{ printf "%s-%s" .resource.metadata.name "server" | truncateName 63 }}.
+func truncateName(max int, name string) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:truncatedHashLength]
+	if max <= truncatedHashLength {
+		return hash[:max]
+	}
+	head := strings.TrimRight(name[:max-truncatedHashLength-1], "-.")
+	return head + "-" + hash
+}
+
+// renderNaming renders the prefix and suffix templates of a naming policy with
+// the template context of the primary resource.
+func renderNaming(naming *v1.IntegrationNamingSpec, context map[string]any) (string, string, error) {
+	if naming == nil {
+		return "", "", nil
+	}
+	prefix, err := renderText("naming prefix", naming.Prefix, context)
+	if err != nil {
+		return "", "", err
+	}
+	suffix, err := renderText("naming suffix", naming.Suffix, context)
+	if err != nil {
+		return "", "", err
+	}
+	return prefix, suffix, nil
+}
+
+// renderText renders a template given inline in the integration, such as a
+// naming prefix, with the template context, and trims the result.
+func renderText(name, text string, context map[string]any) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	temp, err := template.New(name).Funcs(allTemplateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s %q: %w", name, text, err)
+	}
+	output := &bytes.Buffer{}
+	if err := temp.Execute(output, context); err != nil {
+		return "", fmt.Errorf("failed to execute %s %q: %w", name, text, err)
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// setNamePrefixAndSuffix adds the prefix and suffix to the root kustomization,
+// so that kustomize renames the generated objects and the references between
+// them.
+func setNamePrefixAndSuffix(fSys filesys.FileSystem, kustomizationPath, prefix, suffix string) error {
+	if prefix == "" && suffix == "" {
+		return nil
+	}
+	return editKustomization(fSys, kustomizationPath, func(kustomization *types.Kustomization) {
+		kustomization.NamePrefix = prefix
+		kustomization.NameSuffix = suffix
+	})
+}
+
+// editKustomization applies edit to the kustomization file at kustomizationPath.
+func editKustomization(fSys filesys.FileSystem, kustomizationPath string, edit func(*types.Kustomization)) error {
+	data, err := fSys.ReadFile(kustomizationPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", kustomizationPath, err)
+	}
+	kustomization := &types.Kustomization{}
+	if err := yaml.Unmarshal(data, kustomization); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", kustomizationPath, err)
+	}
+	edit(kustomization)
+	data, err = yaml.Marshal(kustomization)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", kustomizationPath, err)
+	}
+	return fSys.WriteFile(kustomizationPath, data)
+}
+
+// validateName checks that the name of a generated object fits the limit for
+// its kind.
+func validateName(obj *unstructured.Unstructured) error {
+	limit, ok := maxNameLengths[obj.GetKind()]
+	if !ok {
+		limit = maxNameLength
+	}
+	if name := obj.GetName(); len(name) > limit {
+		return fmt.Errorf("name of %s %q is %d characters long, the limit is %d; shorten it with the truncateName template function", obj.GetKind(), name, len(name), limit)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestTruncateName(t *testing.T) {
+	assert.Equal(t, "short", truncateName(63, "short"))
+
+	long := strings.Repeat("a", 60) + "-server"
+	truncated := truncateName(63, long)
+	assert.Len(t, truncated, 63)
+	assert.True(t, strings.HasPrefix(truncated, strings.Repeat("a", 54)+"-"))
+	assert.Equal(t, truncated, truncateName(63, long), "truncation must be stable")
+	assert.NotEqual(t, truncated, truncateName(63, strings.Repeat("a", 60)+"-worker"), "names sharing a prefix must stay distinct")
+
+	// Separators in front of the hash are trimmed.
+	assert.NotContains(t, truncateName(20, "abcdefghij-.klmnopqrstuvwxyz"), "-.-")
+	assert.Len(t, truncateName(4, long), 4)
+}
+
+func TestRenderNaming(t *testing.T) {
+	context := map[string]any{"resource": map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "llama", "namespace": "team-a"},
+	}}
+
+	prefix, suffix, err := renderNaming(&v1.IntegrationNamingSpec{
+		Prefix: "{{ .resource.metadata.namespace }}-",
+		Suffix: "-{{ .resource.metadata.name | truncateName 63 }}",
+	}, context)
+	require.NoError(t, err)
+	assert.Equal(t, "team-a-", prefix)
+	assert.Equal(t, "-llama", suffix)
+
+	prefix, suffix, err = renderNaming(nil, context)
+	require.NoError(t, err)
+	assert.Empty(t, prefix)
+	assert.Empty(t, suffix)
+
+	_, _, err = renderNaming(&v1.IntegrationNamingSpec{Prefix: "{{ .resource.metadata.name"}, context)
+	assert.ErrorContains(t, err, "naming prefix")
+}
+
+func TestSetNamePrefixAndSuffix(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("/root/kustomization.yaml", []byte("resources:\n- app.yaml\n")))
+	require.NoError(t, fSys.WriteFile("/root/app.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: server
+spec:
+  containers:
+  - name: server
+    image: server:1
+    envFrom:
+    - configMapRef:
+        name: config
+`)))
+
+	require.NoError(t, setNamePrefixAndSuffix(fSys, "/root/kustomization.yaml", "team-a-", "-v1"))
+	resmap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, "/root")
+	require.NoError(t, err)
+
+	var names []string
+	for _, res := range resmap.Resources() {
+		names = append(names, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"team-a-config-v1", "team-a-server-v1"}, names)
+	pod, err := resmap.Resources()[1].AsYAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(pod), "name: team-a-config-v1", "references are renamed too")
+
+	// Without a prefix or suffix the kustomization is left alone.
+	require.NoError(t, fSys.WriteFile("/other/kustomization.yaml", []byte("resources: []\n")))
+	require.NoError(t, setNamePrefixAndSuffix(fSys, "/other/kustomization.yaml", "", ""))
+	data, err := fSys.ReadFile("/other/kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "resources: []\n", string(data))
+}
+
+func TestValidateName(t *testing.T) {
+	service := newTestObject("", "v1", "Service", strings.Repeat("s", 64))
+	assert.ErrorContains(t, validateName(service), "the limit is 63")
+
+	configMap := newTestObject("", "v1", "ConfigMap", strings.Repeat("c", 64))
+	assert.NoError(t, validateName(configMap))
+
+	cronJob := newTestObject("batch", "v1", "CronJob", strings.Repeat("j", 53))
+	assert.ErrorContains(t, validateName(cronJob), "truncateName")
+}
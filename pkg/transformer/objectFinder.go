@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,34 +39,77 @@ func (t *Transformer) findConnectedResources(ctx context.Context, discoveryClien
 			}
 
 			// Check for parents (does instanceObj reference startObject?)
-			namePaths, _ := t.registry.GetReferencePaths(instanceObj.GroupVersionKind())
-			for refGVK, namePath := range namePaths {
-
-				if refGVK.Kind == obj.GetKind() && refGVK.Group == obj.GroupVersionKind().Group {
-					name, found, _ := unstructured.NestedString(instanceObj.Object, strings.Split(namePath, ".")...)
-
-					if found && name == obj.GetName() {
-						referencingSet[instanceKey] = instanceObj
-					}
-				}
+			// References that are not granted are ignored here, the
+			// referencing resource reports them itself.
+			if ok, _ := t.references(instanceObj, obj); ok {
+				referencingSet[instanceKey] = instanceObj
 			}
 
 			// Check for children (does startObject reference instanceObj?)
-			namePaths, _ = t.registry.GetReferencePaths(obj.GroupVersionKind())
-			for refGVK, namePath := range namePaths {
+			ok, err := t.references(obj, instanceObj)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				referencedSet[instanceKey] = instanceObj
+			}
+		}
+	}
 
-				if refGVK.Kind == instanceObj.GetKind() && refGVK.Group == instanceObj.GroupVersionKind().Group {
-					name, found, _ := unstructured.NestedString(obj.Object, strings.Split(namePath, ".")...)
+	return mapsToList(referencedSet), mapsToList(referencingSet), nil
+}
 
-					if found && name == instanceObj.GetName() {
-						referencedSet[instanceKey] = instanceObj
-					}
-				}
+// references reports whether from references to by one of the reference
+// paths of its integration. The referenced namespace is read from the
+// namespace path, and defaults to the namespace of from. References to another
+// namespace return an error unless the integration of from grants them.
+func (t *Transformer) references(from, to *unstructured.Unstructured) (bool, error) {
+	toGVK := to.GroupVersionKind()
+	namePaths, namespacePaths := t.registry.GetReferencePaths(from.GroupVersionKind())
+	for refGVK, namePath := range namePaths {
+		if refGVK.Kind != toGVK.Kind || refGVK.Group != toGVK.Group {
+			continue
+		}
+		name, found, _ := unstructured.NestedString(from.Object, strings.Split(namePath, ".")...)
+		if !found || name != to.GetName() {
+			continue
+		}
+		// Cluster-scoped resources match by name alone.
+		if to.GetNamespace() == "" {
+			return true, nil
+		}
+		namespace := from.GetNamespace()
+		if namespacePath := namespacePaths[refGVK]; namespacePath != "" {
+			if value, found, _ := unstructured.NestedString(from.Object, strings.Split(namespacePath, ".")...); found && value != "" {
+				namespace = value
 			}
 		}
+		if namespace != to.GetNamespace() {
+			continue
+		}
+		if namespace == from.GetNamespace() {
+			return true, nil
+		}
+		if integrationSpec, _ := t.registry.GetIntegrationSpec(from.GroupVersionKind()); referenceGranted(integrationSpec.ReferenceGrants, from.GetNamespace(), namespace, toGVK) {
+			return true, nil
+		}
+		return false, fmt.Errorf("%s %s/%s references %s %s/%s, but no reference grant allows references from namespace %q to namespace %q", from.GetKind(), from.GetNamespace(), from.GetName(), to.GetKind(), namespace, to.GetName(), from.GetNamespace(), namespace)
 	}
+	return false, nil
+}
 
-	return mapsToList(referencedSet), mapsToList(referencingSet), nil
+// referenceGranted reports whether one of the grants allows references from
+// one namespace to resources of the given GVK in another.
+func referenceGranted(grants []modelv1.IntegrationReferenceGrantSpec, fromNamespace, toNamespace string, gvk schema.GroupVersionKind) bool {
+	matches := func(pattern, namespace string) bool {
+		return pattern == "*" || pattern == namespace
+	}
+	for _, grant := range grants {
+		if grant.Kind == gvk.Kind && grant.Group == gvk.Group && matches(grant.FromNamespace, fromNamespace) && matches(grant.ToNamespace, toNamespace) {
+			return true
+		}
+	}
+	return false
 }
 
 // populateInstanceCache fetches known instances from the cluster.
@@ -87,20 +131,37 @@ func (t *Transformer) populateInstanceCache(ctx context.Context, discoveryClient
 
 		// Create a GVR and list the resources
 		gvr := integrationGVK.GroupVersion().WithResource(resourceName)
-		list, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list resources of type %s: %w", gvr, err)
-		}
-
 		instanceMap := map[string]*unstructured.Unstructured{}
-		for _, item := range list.Items {
-			instanceMap[getObjectKey(&item)] = &item
+		for _, namespace := range t.listNamespaces() {
+			list, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list resources of type %s: %w", gvr, err)
+			}
+			for _, item := range list.Items {
+				instanceMap[getObjectKey(&item)] = &item
+			}
 		}
 		instanceCache[integrationGVK] = instanceMap
 	}
 	return instanceCache, nil
 }
 
+// SetNamespaces restricts the resources that are searched for references to
+// the given namespaces, so that the operator does not need to list them
+// cluster-wide. All namespaces are searched if none are given.
+func (t *Transformer) SetNamespaces(namespaces []string) {
+	t.namespaces = namespaces
+}
+
+// listNamespaces returns the namespaces that are listed for references, where
+// "" lists all namespaces.
+func (t *Transformer) listNamespaces() []string {
+	if len(t.namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return t.namespaces
+}
+
 // getObjectKey gets an object key.
 func getObjectKey(obj *unstructured.Unstructured) string {
 	return getKey(obj.GetNamespace(), obj.GetName(), obj.GroupVersionKind())
@@ -4,14 +4,21 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 )
 
 func TestFindConnectedResources(t *testing.T) {
@@ -147,3 +154,117 @@ func objectListToKeys(objs []*unstructured.Unstructured) []string {
 	sort.Strings(keys) // Sort for deterministic comparison
 	return keys
 }
+
+func TestFindConnectedResources_CrossNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	inferenceGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "InferenceDeployment"}
+	modelDataGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "ModelData"}
+
+	newInference := func(namespace, name, modelNamespace string) *unstructured.Unstructured {
+		obj := newTestObject(inferenceGVK.Group, inferenceGVK.Version, inferenceGVK.Kind, name)
+		obj.SetNamespace(namespace)
+		addReference(obj, "llama", "spec.modelData.name")
+		if modelNamespace != "" {
+			addReference(obj, modelNamespace, "spec.modelData.namespace")
+		}
+		return obj
+	}
+	sharedModel := newTestObject(modelDataGVK.Group, modelDataGVK.Version, modelDataGVK.Kind, "llama")
+	sharedModel.SetNamespace("models")
+	localModel := newTestObject(modelDataGVK.Group, modelDataGVK.Version, modelDataGVK.Kind, "llama")
+	localModel.SetNamespace("team-b")
+
+	granted := newInference("team-a", "chat", "models")
+	local := newInference("team-b", "chat", "")
+	denied := newInference("team-c", "chat", "models")
+
+	cache := map[schema.GroupVersionKind]map[string]*unstructured.Unstructured{
+		inferenceGVK: {getObjectKey(granted): granted, getObjectKey(local): local, getObjectKey(denied): denied},
+		modelDataGVK: {getObjectKey(sharedModel): sharedModel, getObjectKey(localModel): localModel},
+	}
+	transformer := &Transformer{
+		registry: &mockRegistry{
+			refPaths: map[schema.GroupVersionKind][]modelv1.IntegrationApiReferenceSpec{
+				inferenceGVK: {{
+					Group: modelDataGVK.Group, Version: modelDataGVK.Version, Kind: modelDataGVK.Kind,
+					Paths: modelv1.IntegrationApiReferencePathSpec{Name: "spec.modelData.name", Namespace: "spec.modelData.namespace"},
+				}},
+			},
+			specs: map[schema.GroupVersionKind]modelv1.IntegrationSpec{
+				inferenceGVK: {ReferenceGrants: []modelv1.IntegrationReferenceGrantSpec{{FromNamespace: "team-a", ToNamespace: "models", Group: modelDataGVK.Group, Kind: modelDataGVK.Kind}}},
+			},
+		},
+		populateInstanceCacheFunc: func(context.Context, discovery.DiscoveryInterface, dynamic.Interface) (map[schema.GroupVersionKind]map[string]*unstructured.Unstructured, error) {
+			return cache, nil
+		},
+	}
+
+	t.Run("granted reference to another namespace", func(t *testing.T) {
+		referenced, _, err := transformer.findConnectedResources(ctx, nil, nil, granted)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(referenced) != 1 || referenced[0].GetNamespace() != "models" {
+			t.Errorf("referenced = %v, want the ModelData in namespace models", referenced)
+		}
+	})
+
+	t.Run("references default to the own namespace", func(t *testing.T) {
+		referenced, _, err := transformer.findConnectedResources(ctx, nil, nil, local)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(referenced) != 1 || referenced[0].GetNamespace() != "team-b" {
+			t.Errorf("referenced = %v, want the ModelData in namespace team-b", referenced)
+		}
+	})
+
+	t.Run("reference without a grant is rejected", func(t *testing.T) {
+		_, _, err := transformer.findConnectedResources(ctx, nil, nil, denied)
+		if err == nil || !strings.Contains(err.Error(), `no reference grant allows references from namespace "team-c" to namespace "models"`) {
+			t.Errorf("error = %v, want a missing grant error", err)
+		}
+	})
+
+	t.Run("only granted resources reference the shared resource", func(t *testing.T) {
+		_, referencing, err := transformer.findConnectedResources(ctx, nil, nil, sharedModel)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(referencing) != 1 || referencing[0].GetNamespace() != "team-a" {
+			t.Errorf("referencing = %v, want only the InferenceDeployment in namespace team-a", referencing)
+		}
+	})
+}
+
+func TestPopulateInstanceCacheNamespaces(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}
+	inNamespace := func(namespace, name string) runtime.Object {
+		obj := newTestObject(gvk.Group, gvk.Version, gvk.Kind, name)
+		obj.SetNamespace(namespace)
+		return obj
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvk.GroupVersion().WithResource("agents"): "AgentList",
+	}, inNamespace("team-a", "planner"), inNamespace("team-b", "coder"), inNamespace("other", "writer"))
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+	discoveryClient.Resources = []*metav1.APIResourceList{{
+		GroupVersion: gvk.GroupVersion().String(),
+		APIResources: []metav1.APIResource{{Name: "agents", Kind: "Agent", Namespaced: true}},
+	}}
+	registry := NewIntegrationRegistry()
+	registry.SetIntegrations([]modelv1.IntegrationSpec{{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}})
+	tr := &Transformer{registry: registry}
+
+	cache, err := tr.populateInstanceCache(context.Background(), discoveryClient, dynamicClient)
+	require.NoError(t, err)
+	assert.Len(t, cache[gvk], 3, "all namespaces are listed by default")
+
+	tr.SetNamespaces([]string{"team-a", "team-b"})
+	cache, err = tr.populateInstanceCache(context.Background(), discoveryClient, dynamicClient)
+	require.NoError(t, err)
+	assert.Len(t, cache[gvk], 2)
+	assert.Contains(t, cache[gvk], getKey("team-a", "planner", gvk))
+	assert.Contains(t, cache[gvk], getKey("team-b", "coder", gvk))
+}
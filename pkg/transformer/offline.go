@@ -0,0 +1,110 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+
+	template "github.com/google/safetext/yamltemplate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// ContextFields are the fields of the context that Transform renders
+// templates with, besides the names of the context requests of the
+// integration.
+var ContextFields = []string{
+	"root", "chain", "resource", "resources", "values", "clusterDefaults", "cluster",
+	"autoscaler", "monitoring", "presets", "k8sClient", "k8sMapper", "k8sTypedClient",
+}
+
+// TemplateFuncs returns a copy of the functions that templates are rendered
+// with.
+func TemplateFuncs() template.FuncMap {
+	funcs := make(template.FuncMap, len(allTemplateFuncs))
+	for name, f := range allTemplateFuncs {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// OfflineTemplateFuncs returns the functions that templates are rendered
+// with, where the ones that read the cluster answer as if it had everything
+// the templates ask for: every recommended accelerator can be scheduled, every
+// ModelData has succeeded and every object that templates wait for is ready.
+// They render templates without a cluster, e.g. to lint them. They take the
+// clients as interface{}, as they are nil in the OfflineContext.
+func OfflineTemplateFuncs() template.FuncMap {
+	funcs := TemplateFuncs()
+	funcs["schedulableAccelerators"] = func(_ interface{}, options []interface{}) ([]interface{}, error) {
+		return options, nil
+	}
+	funcs["selectAccelerator"] = func(_ interface{}, options []interface{}) (map[string]interface{}, error) {
+		best := minPerformanceAccelerator(options)
+		if best == nil {
+			return nil, fmt.Errorf("none of the %d recommended accelerators can be scheduled", len(options))
+		}
+		selected := make(map[string]interface{}, len(best)+1)
+		for k, v := range best {
+			selected[k] = v
+		}
+		selected["rationale"] = "selected offline"
+		return selected, nil
+	}
+	funcs["resolveModelData"] = func(_, _ interface{}, _, modelDataName string) (map[string]string, error) {
+		return map[string]string{
+			"modelArg": "--model=/data/" + modelDataName,
+			"gcsPath":  "gs://offline/" + modelDataName,
+		}, nil
+	}
+	funcs["waitFor"] = func(_, _ interface{}, namespace, kind, name, _, _ string) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"kind":     kind,
+			"metadata": map[string]interface{}{"name": name, "namespace": namespace},
+		}, nil
+	}
+	return funcs
+}
+
+// OfflineContext returns the context that Transform renders the templates of
+// spec with for sample, without a cluster: the cluster clients are nil, the
+// context requests of the integration and the cluster metadata are empty and
+// the Auto monitoring mode resolves to None.
+func OfflineContext(spec v1.IntegrationSpec, sample *unstructured.Unstructured) (map[string]any, error) {
+	values, err := templateValues(spec.Values, spec.ValuesSchema)
+	if err != nil {
+		return nil, err
+	}
+	presets, err := inferenceServerPresets(sample.UnstructuredContent())
+	if err != nil {
+		return nil, err
+	}
+	context := map[string]any{
+		"root":     "",
+		"chain":    (*TemplateChain)(nil),
+		"resource": sample.UnstructuredContent(),
+		"resources": map[string]interface{}{
+			fmt.Sprintf("%s/%s", sample.GetKind(), sample.GetName()): sample.UnstructuredContent(),
+		},
+		"values":          values,
+		"clusterDefaults": map[string]interface{}{},
+		"cluster":         map[string]interface{}{},
+		"autoscaler":      spec.Autoscaler,
+		"monitoring":      monitoringFlavor(nil, spec.Monitoring),
+		"presets":         presets,
+		"k8sClient":       nil,
+		"k8sMapper":       nil,
+		"k8sTypedClient":  nil,
+	}
+	for _, request := range spec.Context {
+		context[request.Name] = map[string]interface{}{}
+	}
+	return context, nil
+}
+
+// TemplateFileSystem returns the file system and root of an embedded: or
+// gcs: template path. GCS paths are read with the default credentials.
+func TemplateFileSystem(ctx context.Context, templatePath string) (filesys.FileSystem, string, error) {
+	return fileSystemForPath(ctx, templatePath)
+}
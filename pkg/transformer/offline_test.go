@@ -0,0 +1,52 @@
+package transformer
+
+import (
+	"bytes"
+	"testing"
+
+	template "github.com/google/safetext/yamltemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestOfflineContext(t *testing.T) {
+	sample := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Agent",
+		"metadata":   map[string]interface{}{"name": "agent", "namespace": "default"},
+	}}
+	spec := v1.IntegrationSpec{
+		Values:     &apiextensionsv1.JSON{Raw: []byte(`{"replicas": 2}`)},
+		Monitoring: MonitoringAuto,
+		Context:    []v1.IntegrationApiContextSpec{{Name: "model"}},
+	}
+
+	context, err := OfflineContext(spec, sample)
+	require.NoError(t, err)
+	for _, field := range ContextFields {
+		assert.Contains(t, context, field)
+	}
+	assert.Equal(t, map[string]interface{}{"replicas": float64(2)}, context["values"])
+	assert.Equal(t, MonitoringNone, context["monitoring"])
+	assert.Equal(t, map[string]interface{}{}, context["model"])
+	assert.Equal(t, sample.Object, context["resources"].(map[string]interface{})["Agent/agent"])
+
+	tmpl, err := template.New("offline").Funcs(OfflineTemplateFuncs()).Parse(`{{- $model := resolveModelData .k8sClient .k8sMapper "default" "llama" -}}
+model: {{ $model.modelArg }}
+accelerators: {{ len (schedulableAccelerators .k8sClient (list (dict "acceleratorType" "nvidia-l4"))) }}
+`)
+	require.NoError(t, err)
+	output := &bytes.Buffer{}
+	require.NoError(t, tmpl.Execute(output, context))
+	assert.Equal(t, "model: --model=/data/llama\naccelerators: 1\n", output.String())
+}
+
+func TestTemplateFuncsIsACopy(t *testing.T) {
+	funcs := TemplateFuncs()
+	delete(funcs, "truncateName")
+	assert.Contains(t, allTemplateFuncs, "truncateName")
+}
@@ -0,0 +1,22 @@
+package transformer
+
+import (
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// addOverlayPatches adds the rendered overlay files to the root kustomization
+// as patches. Each file is a strategic merge patch that names the object it
+// changes, so an overlay only needs the fields that differ from the base, e.g.
+// the resources of a container in prod. Patches are applied before the naming
+// policy, so they refer to objects by the names the templates give them.
+func addOverlayPatches(fSys filesys.FileSystem, kustomizationPath string, patchFiles []string) error {
+	if len(patchFiles) == 0 {
+		return nil
+	}
+	return editKustomization(fSys, kustomizationPath, func(kustomization *types.Kustomization) {
+		for _, patchFile := range patchFiles {
+			kustomization.Patches = append(kustomization.Patches, types.Patch{Path: patchFile})
+		}
+	})
+}
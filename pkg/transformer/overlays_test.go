@@ -0,0 +1,131 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	a "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestTransformerRun_WithOverlay(t *testing.T) {
+	ctx := context.Background()
+	testNamespace := "overlay-ns"
+	testName := "overlay-resource"
+
+	sourceFs := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFs.WriteFile("base/deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: server
+        image: server:1
+        resources:
+          requests:
+            cpu: 100m
+`)))
+	// The overlay only names the object and the fields that differ.
+	require.NoError(t, sourceFs.WriteFile("overlays/prod/deployment.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: server
+        resources:
+          requests:
+            cpu: "4"
+`)))
+	require.NoError(t, sourceFs.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+	require.NoError(t, sourceFs.WriteFile("v1/apply/apply.yaml", []byte(`
+resources:
+{{- range . }}
+- {{ . }}
+{{- end }}
+`)))
+
+	objGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(objGVK.Group, objGVK.Version, objGVK.Kind, testName)
+	obj.SetNamespace(testNamespace)
+
+	run := func(t *testing.T, overlayPaths []string) *unstructured.Unstructured {
+		transformer := NewTransformer()
+		transformer.registry = &mockRegistry{
+			integrations:  []schema.GroupVersionKind{objGVK},
+			templatePaths: map[schema.GroupVersionKind][]string{objGVK: {"embedded:/base"}},
+			overlayPaths:  map[schema.GroupVersionKind][]string{objGVK: overlayPaths},
+		}
+		transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+			switch path {
+			case "embedded:/base":
+				return sourceFs, "base", nil
+			case "embedded:/overlays/prod":
+				return sourceFs, "overlays/prod", nil
+			case "embedded:/v1/apply":
+				return sourceFs, filepath.Join("v1", "apply"), nil
+			default:
+				return nil, "", fmt.Errorf("fsProviderFunc received an unexpected path: %s", path)
+			}
+		}
+		transformer.findConnectedResourcesFunc = func(ctx context.Context, discovery discovery.DiscoveryInterface, dynamic dynamic.Interface, u *unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+			return nil, nil, nil
+		}
+		transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+			return resources, nil
+		}
+
+		dynamicClient := fake.NewSimpleDynamicClient(scheme.Scheme, obj)
+		discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+		testScheme := runtime.NewScheme()
+		_ = scheme.AddToScheme(testScheme)
+		fakeTypedClient := a.NewClientBuilder().WithScheme(testScheme).WithObjects(obj).Build()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: testName}}
+
+		result, err := transformer.Run(ctx, discoveryClient, dynamicClient, &mockRESTMapper{}, fakeTypedClient, req, obj)
+		require.NoError(t, err)
+		require.Len(t, result, 1, "overlay files are patches, not resources")
+		return result[0]
+	}
+
+	t.Run("without an overlay", func(t *testing.T) {
+		deployment := run(t, nil)
+		replicas, _, _ := unstructured.NestedFieldNoCopy(deployment.Object, "spec", "replicas")
+		assert.EqualValues(t, 1, replicas)
+	})
+
+	t.Run("with the prod overlay", func(t *testing.T) {
+		deployment := run(t, []string{"embedded:/overlays/prod"})
+		replicas, _, _ := unstructured.NestedFieldNoCopy(deployment.Object, "spec", "replicas")
+		assert.EqualValues(t, 3, replicas)
+		containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+		require.Len(t, containers, 1)
+		container := containers[0].(map[string]interface{})
+		assert.Equal(t, "server:1", container["image"], "fields missing from the overlay are kept")
+		cpu, _, _ := unstructured.NestedString(container, "resources", "requests", "cpu")
+		assert.Equal(t, "4", cpu)
+	})
+}
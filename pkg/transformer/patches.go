@@ -0,0 +1,86 @@
+package transformer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	PatchTypeStrategicMerge = "StrategicMerge"
+	PatchTypeMerge          = "Merge"
+	PatchTypeJSON           = "JSON"
+
+	PatchConflictFail  = "Fail"
+	PatchConflictForce = "Force"
+
+	// PatchTypeAnnotation marks a rendered object as a patch of the existing
+	// object it names, and says how it is applied. It is removed before the
+	// patch is applied.
+	PatchTypeAnnotation = "model.skippy.io/patch-type"
+	// PatchConflictPolicyAnnotation carries the ConflictPolicy of the patch
+	// bundle of a rendered patch.
+	PatchConflictPolicyAnnotation = "model.skippy.io/patch-conflict-policy"
+)
+
+// renderedPatch is a file rendered from a patch bundle.
+type renderedPatch struct {
+	// path is relative to the render root.
+	path string
+	spec modelv1.IntegrationApiTemplatesSpec
+}
+
+// readPatches parses the rendered patch files under root. Each document must
+// name the object it patches with apiVersion, kind and metadata.name, and
+// JSON patches must list their operations in "patch".
+func readPatches(fSys filesys.FileSystem, root string, files []renderedPatch) ([]*unstructured.Unstructured, error) {
+	var patches []*unstructured.Unstructured
+	for _, file := range files {
+		data, err := fSys.ReadFile(path.Join(root, file.path))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read patch %q: %v", file.path, err)
+		}
+		decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			patch := &unstructured.Unstructured{}
+			if err := decoder.Decode(&patch.Object); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, &RenderError{Path: file.path, Err: fmt.Errorf("invalid patch: %v", err)}
+			}
+			if len(patch.Object) == 0 {
+				continue
+			}
+			if patch.GetAPIVersion() == "" || patch.GetKind() == "" || patch.GetName() == "" {
+				return nil, &RenderError{Path: file.path, Err: fmt.Errorf("a patch must set apiVersion, kind and metadata.name of the object it patches")}
+			}
+			if _, ok := patch.Object["patch"].([]interface{}); file.spec.PatchType == PatchTypeJSON && !ok {
+				return nil, &RenderError{Path: file.path, Err: fmt.Errorf("a JSON patch of %s %s must list its operations in \"patch\"", patch.GetKind(), patch.GetName())}
+			}
+			annotations := patch.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[PatchTypeAnnotation] = file.spec.PatchType
+			annotations[PatchConflictPolicyAnnotation] = file.spec.ConflictPolicy
+			patch.SetAnnotations(annotations)
+			patches = append(patches, patch)
+		}
+	}
+	return patches, nil
+}
+
+// IsPatch reports whether a rendered object is a patch of an existing
+// object rather than a dependent.
+func IsPatch(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetAnnotations()[PatchTypeAnnotation]
+	return ok
+}
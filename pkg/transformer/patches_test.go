@@ -0,0 +1,159 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	a "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestReadPatches(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("/render/patches/sa.yaml", []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: default
+  annotations:
+    iam.gke.io/gcp-service-account: llama@example.iam.gserviceaccount.com
+---
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: shared
+data:
+  model: llama
+`)))
+	require.NoError(t, fSys.WriteFile("/render/patches/json.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: gateway
+patch:
+- op: add
+  path: /spec/template/spec/containers/0/args/-
+  value: --model=llama
+`)))
+	strategic := v1.IntegrationApiTemplatesSpec{Operation: "patch", PatchType: PatchTypeStrategicMerge, ConflictPolicy: PatchConflictFail}
+	json := v1.IntegrationApiTemplatesSpec{Operation: "patch", PatchType: PatchTypeJSON, ConflictPolicy: PatchConflictForce}
+
+	patches, err := readPatches(fSys, "/render", []renderedPatch{
+		{path: "patches/sa.yaml", spec: strategic},
+		{path: "patches/json.yaml", spec: json},
+	})
+	require.NoError(t, err)
+	require.Len(t, patches, 3)
+	assert.Equal(t, "ServiceAccount", patches[0].GetKind())
+	assert.Equal(t, "llama@example.iam.gserviceaccount.com", patches[0].GetAnnotations()["iam.gke.io/gcp-service-account"])
+	assert.Equal(t, PatchTypeStrategicMerge, patches[0].GetAnnotations()[PatchTypeAnnotation])
+	assert.Equal(t, "shared", patches[1].GetNamespace())
+	assert.Equal(t, PatchTypeJSON, patches[2].GetAnnotations()[PatchTypeAnnotation])
+	assert.Equal(t, PatchConflictForce, patches[2].GetAnnotations()[PatchConflictPolicyAnnotation])
+	for _, patch := range patches {
+		assert.True(t, IsPatch(patch))
+	}
+
+	require.NoError(t, fSys.WriteFile("/render/patches/unnamed.yaml", []byte("apiVersion: v1\nkind: ServiceAccount\n")))
+	_, err = readPatches(fSys, "/render", []renderedPatch{{path: "patches/unnamed.yaml", spec: strategic}})
+	var renderErr *RenderError
+	require.True(t, errors.As(err, &renderErr), "got %v", err)
+	assert.Equal(t, "patches/unnamed.yaml", renderErr.Path)
+
+	_, err = readPatches(fSys, "/render", []renderedPatch{{path: "patches/sa.yaml", spec: json}})
+	assert.ErrorContains(t, err, `must list its operations in "patch"`)
+}
+
+func TestTransformerRun_WithPatch(t *testing.T) {
+	ctx := context.Background()
+	testNamespace := "patch-ns"
+	testName := "patch-resource"
+
+	sourceFs := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFs.WriteFile("base/configmap.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+`)))
+	require.NoError(t, sourceFs.WriteFile("patches/serviceaccount.yaml", []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: default
+  annotations:
+    iam.gke.io/gcp-service-account: {{ .resource.metadata.name }}@example.iam.gserviceaccount.com
+`)))
+	require.NoError(t, sourceFs.WriteFile("v1/apply/apply.yaml", []byte(`
+resources:
+{{- range . }}
+- {{ . }}
+{{- end }}
+`)))
+
+	objGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(objGVK.Group, objGVK.Version, objGVK.Kind, testName)
+	obj.SetNamespace(testNamespace)
+
+	transformer := NewTransformer()
+	transformer.registry = &mockRegistry{
+		integrations:  []schema.GroupVersionKind{objGVK},
+		templatePaths: map[schema.GroupVersionKind][]string{objGVK: {"embedded:/base"}},
+		patches: map[schema.GroupVersionKind][]v1.IntegrationApiTemplatesSpec{objGVK: {
+			{Operation: "patch", Path: "embedded:/patches", PatchType: PatchTypeMerge, ConflictPolicy: PatchConflictFail},
+		}},
+	}
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		switch path {
+		case "embedded:/base":
+			return sourceFs, "base", nil
+		case "embedded:/patches":
+			return sourceFs, "patches", nil
+		case "embedded:/v1/apply":
+			return sourceFs, filepath.Join("v1", "apply"), nil
+		default:
+			return nil, "", fmt.Errorf("fsProviderFunc received an unexpected path: %s", path)
+		}
+	}
+	transformer.findConnectedResourcesFunc = func(ctx context.Context, discovery discovery.DiscoveryInterface, dynamic dynamic.Interface, u *unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+		return nil, nil, nil
+	}
+	transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+		return resources, nil
+	}
+
+	dynamicClient := fake.NewSimpleDynamicClient(scheme.Scheme, obj)
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+	testScheme := runtime.NewScheme()
+	_ = scheme.AddToScheme(testScheme)
+	fakeTypedClient := a.NewClientBuilder().WithScheme(testScheme).WithObjects(obj).Build()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: testName}}
+
+	result, err := transformer.Run(ctx, discoveryClient, dynamicClient, &mockRESTMapper{}, fakeTypedClient, req, obj)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, "ConfigMap", result[0].GetKind())
+	assert.False(t, IsPatch(result[0]))
+
+	patch := result[1]
+	assert.True(t, IsPatch(patch), "patches are returned after the dependents")
+	assert.Equal(t, "default", patch.GetName())
+	assert.Empty(t, patch.GetNamespace(), "patches are not given the namespace of the resource by kustomize")
+	assert.Equal(t, PatchTypeMerge, patch.GetAnnotations()[PatchTypeAnnotation])
+	assert.Equal(t, "patch-resource@example.iam.gserviceaccount.com", patch.GetAnnotations()["iam.gke.io/gcp-service-account"])
+}
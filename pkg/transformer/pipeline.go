@@ -0,0 +1,592 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+var _ v1.RenderPipelineInterface = (*Transformer)(nil)
+
+// pipelineLogger returns the logger of the stages that render obj.
+func pipelineLogger(ctx context.Context, obj *unstructured.Unstructured) logr.Logger {
+	return log.FromContext(ctx).WithValues("namespace", obj.GetNamespace(), "name", obj.GetName(), "entity", obj.GroupVersionKind().String())
+}
+
+// DiscoverInputs finds the resources that obj references and that reference
+// it, following the reference rules of its integration, and sorts them so
+// that the templates of referenced resources are rendered first. It also
+// reads the resources that the integration consumes.
+func (t *Transformer) DiscoverInputs(ctx context.Context, obj *unstructured.Unstructured, opts v1.DiscoverOptions) (*v1.RenderInputs, error) {
+	objGVK := obj.GroupVersionKind()
+	if !t.registry.HasIntegration(objGVK) {
+		pipelineLogger(ctx, obj).Error(nil, "missing integration")
+		return nil, fmt.Errorf("missing integration for %s", objGVK.String())
+	}
+
+	findFunc := t.findConnectedResourcesFunc
+	if findFunc == nil {
+		findFunc = t.findConnectedResources
+	}
+	referenced, referencing, err := findFunc(ctx, opts.DiscoveryClient, opts.DynamicClient, obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find connected resources: %v", err)
+	}
+	accumulator := []*unstructured.Unstructured{obj}
+	accumulator = append(accumulator, referenced...)
+	accumulator = append(accumulator, referencing...)
+
+	sortFunc := t.topologicalSortFunc
+	if sortFunc == nil {
+		sortFunc = t.topologicalSort
+	}
+	sortedAccumulator, err := sortFunc(accumulator)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sort resources: %v", err)
+	}
+	consumed, err := t.findConsumedResources(ctx, opts.DiscoveryClient, opts.DynamicClient, obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find consumed resources: %w", err)
+	}
+	return &v1.RenderInputs{Primary: obj, Resources: sortedAccumulator, Consumed: consumed}, nil
+}
+
+// ResolveContext builds the context that the templates of the resources of
+// inputs share: the resources by kind and name, the values of the
+// integration, the cluster defaults for its kind, the cluster metadata, its
+// autoscaler and monitoring flavor, and the cluster clients. Render sets root, chain, resource, presets and the context
+// requests of the integration for each resource.
+func (t *Transformer) ResolveContext(ctx context.Context, inputs *v1.RenderInputs, opts v1.ResolveOptions) (v1.RenderContext, error) {
+	objGVK := inputs.Primary.GroupVersionKind()
+	log := pipelineLogger(ctx, inputs.Primary)
+
+	// Build a map of all discovered resources, keyed for easy access in the template.
+	// Consumed resources come first, so that connected resources of the same
+	// kind and name take precedence.
+	resourceMap := make(map[string]interface{})
+	for _, res := range append(slices.Clone(inputs.Consumed), inputs.Resources...) {
+		// We can key by kind and name for easy lookup.
+		key := fmt.Sprintf("%s/%s", res.GetKind(), res.GetName())
+		log.Info("Adding resource to map", "key", key, "kind", res.GetKind(), "name", res.GetName())
+		resourceMap[key] = res.Object
+	}
+
+	integrationSpec, _ := t.registry.GetIntegrationSpec(objGVK)
+	values, err := templateValues(integrationSpec.Values, integrationSpec.ValuesSchema)
+	if err != nil {
+		return nil, err
+	}
+	clusterDefaults, err := clusterDefaultsContext(t.clusterDefaultsFor(objGVK))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster defaults: %w", err)
+	}
+
+	return v1.RenderContext{
+		"root":            "",
+		"chain":           (*TemplateChain)(nil),
+		"resource":        nil,
+		"resources":       resourceMap,
+		"values":          values,
+		"clusterDefaults": clusterDefaults,
+		"cluster":         t.clusterContext(),
+		"autoscaler":      autoscalerOf(integrationSpec),
+		"monitoring":      monitoringFlavor(opts.Mapper, monitoringOf(integrationSpec)),
+		"presets":         map[string]interface{}{},
+		"k8sClient":       opts.DynamicClient,
+		"k8sMapper":       opts.Mapper,
+		"k8sTypedClient":  opts.Client,
+	}, nil
+}
+
+// Render renders the copies, kustomize bundles, templates, overlays and
+// patches of the resources of inputs into a new render directory, and writes
+// the kustomization that builds them. renderContext is not changed.
+func (t *Transformer) Render(ctx context.Context, inputs *v1.RenderInputs, renderContext v1.RenderContext, opts v1.RenderOptions) (*v1.RenderedFiles, error) {
+	obj := inputs.Primary
+	objGVK := obj.GroupVersionKind()
+	log := pipelineLogger(ctx, obj)
+	rClient := opts.Client
+
+	renderRoot, cleanup, err := t.newRenderDir(log)
+	if err != nil {
+		return nil, err
+	}
+	rendered := false
+	defer func() {
+		if !rendered {
+			cleanup()
+		}
+	}()
+	targetFS := filesys.MakeFsOnDisk()
+
+	var resourceFiles []string // Will collect full relative paths to generated files.
+	var patchFiles []string    // Rendered overlay files, applied as patches.
+	var patchObjectFiles []renderedPatch
+	var bundles []*bundleKustomization // Kustomizations of the template bundles.
+	var kustomizeFiles []string        // Files read by kustomize that are not resources.
+	var kustomizeRoots []string        // Directories of bundles that are built as they are.
+	var chain *TemplateChain           // The resources whose templates were rendered so far.
+
+	context := make(map[string]any, len(renderContext))
+	for key, value := range renderContext {
+		context[key] = value
+	}
+	context["root"] = renderRoot
+	for _, resource := range inputs.Resources {
+		context["chain"] = chain
+		context["resource"] = resource.UnstructuredContent()
+		targetRelativePath := filepath.Join(resource.GetNamespace(), resource.GetName())
+		targetObjectPath := filepath.Join(renderRoot, targetRelativePath)
+
+		presets, err := inferenceServerPresets(resource.UnstructuredContent())
+		if err != nil {
+			return nil, fmt.Errorf("unable to build the inference server presets of %s %s: %w", resource.GetKind(), resource.GetName(), err)
+		}
+		context["presets"] = presets
+
+		if err := t.registry.ResolveContext(ctx, resource, context, resource.GetUID() != obj.GetUID()); err != nil {
+			return nil, fmt.Errorf("unable to resolve context for resource %v: %w", resource.GroupVersionKind().String(), err)
+		}
+
+		shouldExecuteTemplates := false
+		// The patterns that the template paths of a referenced resource must
+		// match to be propagated, if any.
+		var propagatedPaths []string
+
+		// Condition A: Always execute templates for the primary resource that triggered the reconciliation.
+		if resource.GetUID() == obj.GetUID() {
+			shouldExecuteTemplates = true
+		} else {
+			// Condition B: It's a referenced resource. Check if we should propagate its templates.
+			// We look at the integration rules for the PRIMARY object (`obj`).
+			for _, refRule := range t.registry.GetReferenceRules(obj.GroupVersionKind()) {
+				// Find the rule that matches the current resource in the loop
+				if refRule.Group == resource.GroupVersionKind().Group && refRule.Kind == resource.GetKind() {
+					// Check our new flag!
+					if refRule.PropagateTemplates {
+						shouldExecuteTemplates = true
+						propagatedPaths = refRule.PropagateTemplatePaths
+						break
+					}
+				}
+			}
+		}
+
+		if !shouldExecuteTemplates {
+			log.Info("Skipping template execution for read-only reference", "kind", resource.GetKind(), "name", resource.GetName())
+			continue // Skip to the next resource in the accumulator
+		}
+
+		selected, err := TemplateSelector(propagatedPaths)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference rule for %s: %w", resource.GetKind(), err)
+		}
+
+		log.Info("Executing templates for resource", "kind", resource.GetKind(), "name", resource.GetName())
+		firstResourceFile := len(resourceFiles)
+		var chainPath string
+
+		// Handle pure copy operations.
+		for _, copyPath := range t.registry.GetCopyPaths(resource.GroupVersionKind()) {
+			if !selected(copyPath) {
+				continue
+			}
+			sourceFS, rootPath, err := t.fileSystemFor(ctx, rClient, resource.GroupVersionKind(), copyPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get file system for path %q: %v", copyPath, err)
+			}
+
+			// A bundle with a kustomization of its own is built as it is.
+			if hasKustomization(sourceFS, rootPath) {
+				sourcePaths, err := copyBundle(ctx, sourceFS, targetFS, rootPath, targetObjectPath)
+				if err != nil {
+					return nil, fmt.Errorf("error walking path %q: %w", copyPath, err)
+				}
+				for _, sourcePath := range sourcePaths {
+					kustomizeFiles = append(kustomizeFiles, path.Join(targetRelativePath, sourcePath))
+				}
+				kustomizeRoots = append(kustomizeRoots, path.Join(targetRelativePath, rootPath))
+				continue
+			}
+
+			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+
+				targetPath := path.Join(targetObjectPath, sourcePath)
+				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
+					return err
+				}
+
+				// We collect copied files as well, assuming they are valid YAML
+				// manifests. Kustomizations are copied to keep the layout of
+				// the bundle, but are not resources.
+				if isKustomizationFile(filepath.Base(sourcePath)) {
+					kustomizeFiles = append(kustomizeFiles, path.Join(targetRelativePath, sourcePath))
+				} else {
+					resourceFiles = append(resourceFiles, path.Join(targetRelativePath, sourcePath))
+				}
+				return copyFile(sourceFS, targetFS, sourcePath, targetPath, ctx)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error walking path %q: %w", copyPath, err)
+			}
+		}
+
+		// Handle kustomize bundles, whose kustomization root is built with
+		// the values of the resource.
+		for _, bundle := range t.registry.GetKustomizeRoots(resource.GroupVersionKind()) {
+			if !selected(bundle.Path) {
+				continue
+			}
+			sourceFS, rootPath, err := t.fileSystemFor(ctx, rClient, resource.GroupVersionKind(), bundle.Path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get file system for path %q: %v", bundle.Path, err)
+			}
+			files, root, err := renderKustomizeBundle(ctx, sourceFS, targetFS, rootPath, targetObjectPath, targetRelativePath, bundle, context)
+			if err != nil {
+				return nil, err
+			}
+			kustomizeFiles = append(kustomizeFiles, files...)
+			kustomizeRoots = append(kustomizeRoots, root)
+		}
+
+		// Handle template operations.
+		for _, templatePath := range t.registry.GetTemplatePaths(resource.GroupVersionKind()) {
+			if !selected(templatePath) {
+				continue
+			}
+			sourceFS, rootPath, err := t.fileSystemFor(ctx, rClient, resource.GroupVersionKind(), templatePath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get file system for path %q: %v", templatePath, err)
+			}
+
+			// The kustomization of the bundle is rendered first, as it decides
+			// how the other files are rendered.
+			resourceSpec, _ := t.registry.GetIntegrationSpec(resource.GroupVersionKind())
+			bundle, err := renderBundleKustomization(ctx, sourceFS, targetFS, rootPath, targetObjectPath, targetRelativePath, resourceSpec.Kustomize, context, log)
+			if err != nil {
+				return nil, fmt.Errorf("unable to render the kustomization of path %q: %w", templatePath, err)
+			}
+			if bundle != nil {
+				bundles = append(bundles, bundle)
+				kustomizeFiles = append(kustomizeFiles, path.Join(targetRelativePath, bundle.kustomizationPath))
+			}
+
+			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+
+				role := bundle.role(sourcePath)
+				if role == bundleSkipped {
+					return nil
+				}
+
+				targetPath := path.Join(targetObjectPath, sourcePath)
+				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
+					return err
+				}
+
+				// Construct the relative path from the kustomization root (tmp) to the generated file.
+				relativeFilePath := path.Join(targetRelativePath, sourcePath)
+				switch role {
+				case bundleCopied:
+					kustomizeFiles = append(kustomizeFiles, relativeFilePath)
+					return copyFile(sourceFS, targetFS, sourcePath, targetPath, ctx)
+				case bundleTemplated:
+					kustomizeFiles = append(kustomizeFiles, relativeFilePath)
+				default:
+					resourceFiles = append(resourceFiles, relativeFilePath)
+				}
+
+				return templateFile(ctx, sourceFS, targetFS, sourcePath, targetPath, context, log)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error walking path %q: %w", templatePath, err)
+			}
+
+			chainPath = filepath.Join(targetRelativePath, rootPath)
+		}
+
+		// Handle the overlays of the selected environment.
+		for _, overlayPath := range t.registry.GetOverlayPaths(resource.GroupVersionKind()) {
+			if !selected(overlayPath) {
+				continue
+			}
+			sourceFS, rootPath, err := t.fileSystemFor(ctx, rClient, resource.GroupVersionKind(), overlayPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get file system for path %q: %v", overlayPath, err)
+			}
+
+			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+
+				baseName := filepath.Base(sourcePath)
+				if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
+					return nil
+				}
+
+				// Overlays are kept apart from the templates, as they are patches rather than resources.
+				targetPath := path.Join(targetObjectPath, "overlays", sourcePath)
+				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
+					return err
+				}
+				patchFiles = append(patchFiles, path.Join(targetRelativePath, "overlays", sourcePath))
+
+				return templateFile(ctx, sourceFS, targetFS, sourcePath, targetPath, context, log)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error walking path %q: %w", overlayPath, err)
+			}
+		}
+
+		// Handle the patches of existing objects, which are rendered apart
+		// from the kustomization as the objects they name are not created.
+		for _, patch := range t.registry.GetPatchTemplates(resource.GroupVersionKind()) {
+			if !selected(patch.Path) {
+				continue
+			}
+			sourceFS, rootPath, err := t.fileSystemFor(ctx, rClient, resource.GroupVersionKind(), patch.Path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get file system for path %q: %v", patch.Path, err)
+			}
+
+			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+
+				baseName := filepath.Base(sourcePath)
+				if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
+					return nil
+				}
+
+				relativePath := path.Join(targetRelativePath, "patches", sourcePath)
+				targetPath := path.Join(renderRoot, relativePath)
+				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
+					return err
+				}
+				patchObjectFiles = append(patchObjectFiles, renderedPatch{path: relativePath, spec: patch})
+
+				return templateFile(ctx, sourceFS, targetFS, sourcePath, targetPath, context, log)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error walking path %q: %w", patch.Path, err)
+			}
+		}
+
+		if chainPath != "" {
+			files := append([]string{}, resourceFiles[firstResourceFile:]...)
+			chain = chain.add(&ChainLink{
+				Kind:      resource.GetKind(),
+				Namespace: resource.GetNamespace(),
+				Name:      resource.GetName(),
+				Path:      chainPath,
+				Files:     files,
+				Objects:   renderedObjects(renderRoot, files),
+			})
+		}
+	}
+
+	patches, err := readPatches(targetFS, renderRoot, patchObjectFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resourceFiles) == 0 && len(kustomizeRoots) == 0 {
+		return &v1.RenderedFiles{Patches: patches, Cleanup: func() {}}, nil
+	}
+
+	// Create the apply kustomization.
+	fsProvider := t.fsProviderFunc
+	if fsProvider == nil {
+		fsProvider = fileSystemForPath
+	}
+	sourceFS, rootPath, err := fsProvider(ctx, "embedded:/v1/apply")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get apply path: %v", err)
+	}
+
+	// Use the collected *file* paths and the kustomize roots to build the root kustomization.
+	resources := append(append([]string{}, resourceFiles...), kustomizeRoots...)
+	if err := templateFile(ctx, sourceFS, targetFS, path.Join(rootPath, "apply.yaml"), path.Join(renderRoot, "kustomization.yaml"), resources, log); err != nil {
+		return nil, fmt.Errorf("unable to create root kustomization: %v", err)
+	}
+	if err := addOverlayPatches(targetFS, path.Join(renderRoot, "kustomization.yaml"), patchFiles); err != nil {
+		return nil, fmt.Errorf("unable to apply overlays: %v", err)
+	}
+	if err := addBundleKustomizations(targetFS, path.Join(renderRoot, "kustomization.yaml"), bundles); err != nil {
+		return nil, fmt.Errorf("unable to add the kustomizations of the templates: %v", err)
+	}
+	context["resource"] = obj.UnstructuredContent()
+	integrationSpec, _ := t.registry.GetIntegrationSpec(objGVK)
+	prefix, suffix, err := renderNaming(integrationSpec.Naming, context)
+	if err != nil {
+		return nil, err
+	}
+	if err := setNamePrefixAndSuffix(targetFS, path.Join(renderRoot, "kustomization.yaml"), prefix, suffix); err != nil {
+		return nil, fmt.Errorf("unable to apply naming policy: %v", err)
+	}
+
+	files := append([]string{"kustomization.yaml"}, resourceFiles...)
+	rendered = true
+	return &v1.RenderedFiles{
+		Root:      renderRoot,
+		Resources: resources,
+		Files:     append(append(files, patchFiles...), kustomizeFiles...),
+		Patches:   patches,
+		Cleanup:   cleanup,
+	}, nil
+}
+
+// Kustomize builds the kustomization that Render wrote.
+func (t *Transformer) Kustomize(ctx context.Context, files *v1.RenderedFiles) ([]*unstructured.Unstructured, error) {
+	if files.Root == "" {
+		return nil, nil
+	}
+	if err := checkDuplicateObjects(files.Root, files.Resources); err != nil {
+		return nil, fmt.Errorf("cannot run kustomization: %w", err)
+	}
+	opts := &krusty.Options{
+		LoadRestrictions: types.LoadRestrictionsNone,
+		PluginConfig: types.MakePluginConfig(
+			types.PluginRestrictionsBuiltinsOnly, types.BploUseStaticallyLinked),
+	}
+
+	k := krusty.MakeKustomizer(opts)
+	_, kustomizeSpan := tracer.Start(ctx, "kustomize.Run", trace.WithAttributes(attribute.Int("karo.resource_files", len(files.Resources))))
+	resmap, err := k.Run(filesys.MakeFsOnDisk(), files.Root)
+	if err != nil {
+		kustomizeSpan.RecordError(err)
+		kustomizeSpan.SetStatus(codes.Error, err.Error())
+		kustomizeSpan.End()
+		return nil, fmt.Errorf("cannot run kustomization: %w", &RenderError{Path: files.Root, Err: err})
+	}
+	kustomizeSpan.End()
+
+	var objs []*unstructured.Unstructured
+	for _, res := range resmap.Resources() {
+		data, err := res.Map()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get resource data: %v", err)
+		}
+		u := &unstructured.Unstructured{}
+		u.SetUnstructuredContent(data)
+		objs = append(objs, u)
+	}
+	return objs, nil
+}
+
+// Parse turns the objects built by Kustomize into the dependents of the
+// primary resource of inputs, and pins their images to digests.
+func (t *Transformer) Parse(ctx context.Context, inputs *v1.RenderInputs, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	result, verified, err := t.parse(ctx, inputs.Primary, objs)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.pinImageDigests(ctx, inputs.Primary, result, verified); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parse is Parse without pinning images, so that Run caches the objects
+// before their images are pinned. It returns the digests of the images whose
+// signatures were verified, see checkImagePolicy.
+func (t *Transformer) parse(ctx context.Context, obj *unstructured.Unstructured, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, map[string]string, error) {
+	log := pipelineLogger(ctx, obj)
+	integrationSpec, _ := t.registry.GetIntegrationSpec(obj.GroupVersionKind())
+	integrationPolicy := integrationSpec.SecurityPolicy
+	securityPolicy, err := MergeSecurityPolicies(t.securityPolicy, integrationPolicy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid security policy of %s: %w", obj.GetKind(), err)
+	}
+	commonLabels, commonAnnotations := integrationSpec.CommonLabels, integrationSpec.CommonAnnotations
+	clusterDefaults := t.clusterDefaultsFor(obj.GroupVersionKind())
+
+	result := []*unstructured.Unstructured{}
+	verified := map[string]string{}
+	for _, u := range objs {
+		t.logRenderedObject(log, u)
+
+		// So what's happening is that the data key:value pair for Secret was something like this:
+		// data: hf_token:fasdlkfjasljf==
+		// Meaning it wasn't map already, you need to split the string
+		// TODO: find a better way to handle this
+		if u.GetKind() == "Secret" {
+			if dataValue, ok := u.Object["data"].(string); ok {
+				// Manually parse the data string (assuming single key-value pair for now)
+				parts := strings.SplitN(dataValue, ":", 2)
+				if len(parts) == 2 {
+					key := strings.TrimSpace(parts[0])
+					value := strings.TrimSpace(parts[1])
+					u.Object["data"] = map[string]interface{}{
+						key: value,
+					}
+				} else {
+					return nil, nil, fmt.Errorf("failed to parse Secret data stringnname: %v, dataValue: %v", u.GetName(), dataValue)
+				}
+			}
+		}
+		if err := validateName(u); err != nil {
+			return nil, nil, err
+		}
+		if err := applyCommonMetadata(u, commonLabels, commonAnnotations); err != nil {
+			return nil, nil, err
+		}
+		if err := t.applyMutators(ctx, obj, u); err != nil {
+			return nil, nil, err
+		}
+		if err := applyClusterDefaults(u, clusterDefaults); err != nil {
+			return nil, nil, err
+		}
+		if err := applySecurityPolicy(u, securityPolicy); err != nil {
+			return nil, nil, err
+		}
+		if err := t.checkImagePolicy(ctx, u, verified, t.securityPolicy, integrationPolicy); err != nil {
+			return nil, nil, err
+		}
+		result = append(result, u)
+	}
+	if err := rotateSecrets(result); err != nil {
+		return nil, nil, err
+	}
+	if t.configChecksums {
+		if err := injectConfigChecksums(result); err != nil {
+			return nil, nil, err
+		}
+	}
+	return result, verified, nil
+}
@@ -0,0 +1,125 @@
+package transformer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func newTestPipeline(t *testing.T, gvk schema.GroupVersionKind, templates map[string]string) *Transformer {
+	sourceFs := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFs.MkdirAll("base"))
+	for name, content := range templates {
+		require.NoError(t, sourceFs.WriteFile(filepath.Join("base", name), []byte(content)))
+	}
+	require.NoError(t, sourceFs.WriteFile("v1/apply/apply.yaml", []byte(`
+resources:
+{{- range . }}
+- {{ . }}
+{{- end }}
+`)))
+	transformer := NewTransformer()
+	transformer.SetRenderDir(t.TempDir())
+	transformer.registry = &mockRegistry{
+		integrations:  []schema.GroupVersionKind{gvk},
+		templatePaths: map[schema.GroupVersionKind][]string{gvk: {"embedded:/base"}},
+		specs:         map[schema.GroupVersionKind]modelv1.IntegrationSpec{gvk: {CommonLabels: map[string]string{"team": "serving"}}},
+	}
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		if path == "embedded:/v1/apply" {
+			return sourceFs, filepath.Join("v1", "apply"), nil
+		}
+		return sourceFs, "base", nil
+	}
+	transformer.findConnectedResourcesFunc = func(ctx context.Context, discovery discovery.DiscoveryInterface, dynamic dynamic.Interface, u *unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+		return nil, nil, nil
+	}
+	transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+		return resources, nil
+	}
+	return transformer
+}
+
+func TestRenderPipelineStages(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(gvk.Group, gvk.Version, gvk.Kind, "llama")
+	obj.SetNamespace("serving")
+	var pipeline modelv1.RenderPipelineInterface = newTestPipeline(t, gvk, map[string]string{
+		"service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .resource.metadata.name }}
+  namespace: {{ .resource.metadata.namespace }}
+  annotations:
+    replicas: "{{ .values.replicas }}"
+`,
+	})
+
+	inputs, err := pipeline.DiscoverInputs(ctx, obj, modelv1.DiscoverOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []*unstructured.Unstructured{obj}, inputs.Resources)
+
+	renderContext, err := pipeline.ResolveContext(ctx, inputs, modelv1.ResolveOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, renderContext["resources"], "Endpoint/llama")
+
+	// Embedders may change the context before rendering.
+	renderContext["values"] = map[string]interface{}{"replicas": 3}
+	files, err := pipeline.Render(ctx, inputs, renderContext, modelv1.RenderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "", renderContext["root"], "Render does not change the context")
+	assert.Equal(t, []string{"serving/llama/base/service.yaml"}, files.Resources)
+	assert.Equal(t, []string{"kustomization.yaml", "serving/llama/base/service.yaml"}, files.Files)
+	_, err = os.Stat(filepath.Join(files.Root, "kustomization.yaml"))
+	require.NoError(t, err)
+
+	built, err := pipeline.Kustomize(ctx, files)
+	require.NoError(t, err)
+	require.Len(t, built, 1)
+	assert.Empty(t, built[0].GetLabels(), "Kustomize does not apply the integration settings")
+
+	objs, err := pipeline.Parse(ctx, inputs, built)
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	assert.Equal(t, map[string]string{"team": "serving"}, objs[0].GetLabels())
+	assert.Equal(t, "3", objs[0].GetAnnotations()["replicas"])
+
+	files.Cleanup()
+	_, err = os.Stat(files.Root)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRenderPipelineWithoutResources(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	obj := newTestObject(gvk.Group, gvk.Version, gvk.Kind, "llama")
+	pipeline := newTestPipeline(t, gvk, nil)
+
+	inputs, err := pipeline.DiscoverInputs(ctx, obj, modelv1.DiscoverOptions{})
+	require.NoError(t, err)
+	renderContext, err := pipeline.ResolveContext(ctx, inputs, modelv1.ResolveOptions{})
+	require.NoError(t, err)
+	files, err := pipeline.Render(ctx, inputs, renderContext, modelv1.RenderOptions{})
+	require.NoError(t, err)
+	defer files.Cleanup()
+	assert.Empty(t, files.Root)
+	built, err := pipeline.Kustomize(ctx, files)
+	require.NoError(t, err)
+	assert.Empty(t, built)
+
+	other := newTestObject(gvk.Group, gvk.Version, "Agent", "llama")
+	_, err = pipeline.DiscoverInputs(ctx, other, modelv1.DiscoverOptions{})
+	assert.EqualError(t, err, "missing integration for model.skippy.io/v1, Kind=Agent")
+}
@@ -0,0 +1,367 @@
+package transformer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// serverVersion is a major, minor and patch version of an inference server.
+type serverVersion [3]int
+
+var serverVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseServerVersion parses the leading version of a version or image tag,
+// e.g. 0.7.2 of v0.7.2 or 0.4.1 of v0.4.1.post7-cu124.
+func parseServerVersion(s string) (serverVersion, bool) {
+	match := serverVersionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return serverVersion{}, false
+	}
+	var version serverVersion
+	for i, part := range match[1:] {
+		version[i], _ = strconv.Atoi(part)
+	}
+	return version, true
+}
+
+func (v serverVersion) less(other serverVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+func (v serverVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// presetOptions are the settings of spec.inferenceServer that the presets
+// translate to the flags of each server.
+type presetOptions struct {
+	model                string
+	port                 int64
+	tensorParallelSize   int64
+	maxModelLen          int64
+	gpuMemoryUtilization string
+	servedModelName      string
+	trustRemoteCode      bool
+}
+
+// serverPreset generates the command line of one inference server. build is
+// called with known false if the version could not be determined, and then
+// generates the flags of the latest versions.
+type serverPreset struct {
+	name        string
+	defaultPort int64
+	minVersion  serverVersion
+	healthPath  string
+	build       func(version serverVersion, known bool, options presetOptions) (command, args []string, env map[string]string)
+}
+
+// serverPresets are keyed by the normalized spec.inferenceServer.type.
+var serverPresets = map[string]serverPreset{
+	"vllm": {
+		name:        "vLLM",
+		defaultPort: 8000,
+		minVersion:  serverVersion{0, 4, 0},
+		healthPath:  "/health",
+		build:       vllmPreset,
+	},
+	"tgi": {
+		name:        "TGI",
+		defaultPort: 8000,
+		minVersion:  serverVersion{1, 0, 0},
+		healthPath:  "/health",
+		build:       tgiPreset,
+	},
+	"tensorrtllm": {
+		name:        "TensorRT-LLM",
+		defaultPort: 8000,
+		minVersion:  serverVersion{0, 15, 0},
+		healthPath:  "/health",
+		build:       tensorRTLLMPreset,
+	},
+	"sglang": {
+		name:        "SGLang",
+		defaultPort: 30000,
+		minVersion:  serverVersion{0, 2, 0},
+		healthPath:  "/health",
+		build:       sglangPreset,
+	},
+}
+
+// serverTypeAliases are other names of the server types.
+var serverTypeAliases = map[string]string{
+	"textgenerationinference": "tgi",
+	"trtllm":                  "tensorrtllm",
+}
+
+func normalizeServerType(serverType string) string {
+	normalized := strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(serverType))
+	if alias, ok := serverTypeAliases[normalized]; ok {
+		return alias
+	}
+	return normalized
+}
+
+func vllmPreset(version serverVersion, known bool, options presetOptions) ([]string, []string, map[string]string) {
+	var command, args []string
+	// vllm serve replaced the OpenAI server module as the entrypoint in 0.5.
+	if known && version.less(serverVersion{0, 5, 0}) {
+		command = []string{"python3", "-m", "vllm.entrypoints.openai.api_server"}
+		args = []string{"--model=" + options.model}
+	} else {
+		command = []string{"vllm", "serve"}
+		args = []string{options.model}
+	}
+	args = append(args,
+		"--host=0.0.0.0",
+		fmt.Sprintf("--port=%d", options.port),
+		fmt.Sprintf("--tensor-parallel-size=%d", options.tensorParallelSize),
+	)
+	if options.maxModelLen > 0 {
+		args = append(args, fmt.Sprintf("--max-model-len=%d", options.maxModelLen))
+	}
+	if options.gpuMemoryUtilization != "" {
+		args = append(args, "--gpu-memory-utilization="+options.gpuMemoryUtilization)
+	}
+	if options.servedModelName != "" {
+		args = append(args, "--served-model-name="+options.servedModelName)
+	}
+	if options.trustRemoteCode {
+		args = append(args, "--trust-remote-code")
+	}
+	// Requests are not logged by default from 0.10.2, which deprecated
+	// --disable-log-requests for --enable-log-requests.
+	if known && version.less(serverVersion{0, 10, 2}) {
+		args = append(args, "--disable-log-requests")
+	}
+	return command, args, map[string]string{"VLLM_NO_USAGE_STATS": "1"}
+}
+
+func tgiPreset(version serverVersion, known bool, options presetOptions) ([]string, []string, map[string]string) {
+	args := []string{
+		"--model-id=" + options.model,
+		"--hostname=0.0.0.0",
+		fmt.Sprintf("--port=%d", options.port),
+		fmt.Sprintf("--num-shard=%d", options.tensorParallelSize),
+	}
+	if options.maxModelLen > 0 {
+		// TGI limits the prompt separately, and it must leave room for at
+		// least one generated token. 2.0 renamed --max-input-length to
+		// --max-input-tokens.
+		inputFlag := "--max-input-tokens"
+		if known && version.less(serverVersion{2, 0, 0}) {
+			inputFlag = "--max-input-length"
+		}
+		args = append(args,
+			fmt.Sprintf("%s=%d", inputFlag, options.maxModelLen-1),
+			fmt.Sprintf("--max-total-tokens=%d", options.maxModelLen),
+		)
+	}
+	if options.gpuMemoryUtilization != "" {
+		args = append(args, "--cuda-memory-fraction="+options.gpuMemoryUtilization)
+	}
+	if options.trustRemoteCode {
+		args = append(args, "--trust-remote-code")
+	}
+	return []string{"text-generation-launcher"}, args, nil
+}
+
+func tensorRTLLMPreset(_ serverVersion, _ bool, options presetOptions) ([]string, []string, map[string]string) {
+	args := []string{
+		options.model,
+		"--host=0.0.0.0",
+		fmt.Sprintf("--port=%d", options.port),
+		fmt.Sprintf("--tp_size=%d", options.tensorParallelSize),
+	}
+	if options.maxModelLen > 0 {
+		args = append(args, fmt.Sprintf("--max_seq_len=%d", options.maxModelLen))
+	}
+	if options.gpuMemoryUtilization != "" {
+		args = append(args, "--kv_cache_free_gpu_memory_fraction="+options.gpuMemoryUtilization)
+	}
+	if options.trustRemoteCode {
+		args = append(args, "--trust_remote_code")
+	}
+	return []string{"trtllm-serve"}, args, nil
+}
+
+func sglangPreset(_ serverVersion, _ bool, options presetOptions) ([]string, []string, map[string]string) {
+	args := []string{
+		"--model-path=" + options.model,
+		"--host=0.0.0.0",
+		fmt.Sprintf("--port=%d", options.port),
+		fmt.Sprintf("--tp-size=%d", options.tensorParallelSize),
+	}
+	if options.maxModelLen > 0 {
+		args = append(args, fmt.Sprintf("--context-length=%d", options.maxModelLen))
+	}
+	if options.gpuMemoryUtilization != "" {
+		args = append(args, "--mem-fraction-static="+options.gpuMemoryUtilization)
+	}
+	if options.servedModelName != "" {
+		args = append(args, "--served-model-name="+options.servedModelName)
+	}
+	if options.trustRemoteCode {
+		args = append(args, "--trust-remote-code")
+	}
+	return []string{"python3", "-m", "sglang.launch_server"}, args, nil
+}
+
+// inferenceServerPresets returns the presets of the template context for
+// resource: the command, args, env and ports that run the server of
+// spec.inferenceServer.type with the settings of spec.inferenceServer. The
+// version is spec.inferenceServer.version, or else the tag of its image, and
+// the latest flags are generated if neither has one. Resources without an
+// inference server, or with a type that has no preset, get empty presets, so
+// that templates can always test e.g. {{ if .presets.args }}.
+func inferenceServerPresets(resource map[string]interface{}) (map[string]interface{}, error) {
+	server, found, _ := unstructured.NestedMap(resource, "spec", "inferenceServer")
+	if !found {
+		return map[string]interface{}{}, nil
+	}
+	serverType, _, _ := unstructured.NestedString(server, "type")
+	preset, ok := serverPresets[normalizeServerType(serverType)]
+	if !ok {
+		return map[string]interface{}{}, nil
+	}
+
+	version, known, err := presetVersion(server)
+	if err != nil {
+		return nil, err
+	}
+	if known && version.less(preset.minVersion) {
+		return nil, fmt.Errorf("the %s preset supports versions from %s, not %s", preset.name, preset.minVersion, version)
+	}
+	options, err := presetOptionsOf(resource, server, preset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings for the %s preset: %w", preset.name, err)
+	}
+
+	command, args, env := preset.build(version, known, options)
+	versionString := ""
+	if known {
+		versionString = version.String()
+	}
+	return map[string]interface{}{
+		"type":       preset.name,
+		"version":    versionString,
+		"command":    stringsToInterfaces(command),
+		"args":       stringsToInterfaces(args),
+		"env":        envVars(env),
+		"port":       options.port,
+		"ports":      []interface{}{map[string]interface{}{"name": "http", "containerPort": options.port, "protocol": "TCP"}},
+		"healthPath": preset.healthPath,
+	}, nil
+}
+
+// presetVersion returns the version of spec.inferenceServer, and false if it
+// has none. Only explicit versions must parse, as image tags may be e.g.
+// latest.
+func presetVersion(server map[string]interface{}) (serverVersion, bool, error) {
+	if version, _, _ := unstructured.NestedString(server, "version"); version != "" {
+		parsed, ok := parseServerVersion(version)
+		if !ok {
+			return serverVersion{}, false, fmt.Errorf("invalid inference server version %q", version)
+		}
+		return parsed, true, nil
+	}
+	image, _, _ := unstructured.NestedString(server, "image")
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		version, ok := parseServerVersion(image[i+1:])
+		return version, ok, nil
+	}
+	return serverVersion{}, false, nil
+}
+
+func presetOptionsOf(resource, server map[string]interface{}, preset serverPreset) (presetOptions, error) {
+	options := presetOptions{port: preset.defaultPort, tensorParallelSize: 1}
+	options.model, _, _ = unstructured.NestedString(server, "model")
+	if options.model == "" {
+		options.model, _, _ = unstructured.NestedString(resource, "spec", "model", "modelName")
+	}
+	if options.model == "" {
+		return options, fmt.Errorf("spec.inferenceServer.model or spec.model.modelName is required")
+	}
+
+	var err error
+	if options.port, err = presetInt(server, options.port, "port"); err != nil {
+		return options, err
+	}
+	// The tensor parallelism defaults to sharding the model over the GPUs of
+	// the server.
+	if options.tensorParallelSize, err = presetInt(server, options.tensorParallelSize, "resources", "gpuCount"); err != nil {
+		return options, err
+	}
+	if options.tensorParallelSize, err = presetInt(server, options.tensorParallelSize, "tensorParallelSize"); err != nil {
+		return options, err
+	}
+	if options.maxModelLen, err = presetInt(server, 0, "maxModelLen"); err != nil {
+		return options, err
+	}
+	if value, found, _ := unstructured.NestedFieldNoCopy(server, "gpuMemoryUtilization"); found {
+		options.gpuMemoryUtilization = fmt.Sprint(value)
+		if _, err := strconv.ParseFloat(options.gpuMemoryUtilization, 64); err != nil {
+			return options, fmt.Errorf("spec.inferenceServer.gpuMemoryUtilization must be a number, not %q", options.gpuMemoryUtilization)
+		}
+	}
+	options.servedModelName, _, _ = unstructured.NestedString(server, "servedModelName")
+	options.trustRemoteCode, _, _ = unstructured.NestedBool(server, "trustRemoteCode")
+	return options, nil
+}
+
+// presetInt reads a positive integer of spec.inferenceServer, which may also
+// be a string like resources.gpuCount, or returns def if it is not set.
+func presetInt(server map[string]interface{}, def int64, fields ...string) (int64, error) {
+	value, found, _ := unstructured.NestedFieldNoCopy(server, fields...)
+	if !found || value == nil {
+		return def, nil
+	}
+	var parsed int64
+	switch value := value.(type) {
+	case int64:
+		parsed = value
+	case float64:
+		parsed = int64(value)
+		if float64(parsed) != value {
+			parsed = 0
+		}
+	case string:
+		parsed, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("spec.inferenceServer.%s must be a positive integer, not %v", strings.Join(fields, "."), value)
+	}
+	return parsed, nil
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+// envVars returns env as container env vars, sorted by name.
+func envVars(env map[string]string) []interface{} {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]interface{}, 0, len(env))
+	for _, name := range names {
+		result = append(result, map[string]interface{}{"name": name, "value": env[name]})
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+package transformer
+
+import (
+	"bytes"
+	"testing"
+
+	template "github.com/google/safetext/yamltemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInferenceDeployment(server map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "model.skippy.io/v1",
+		"kind":       "InferenceDeployment",
+		"metadata":   map[string]interface{}{"name": "llama", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"inferenceServer": server,
+			"model":           map[string]interface{}{"modelName": "meta-llama/Llama-3.1-8B-Instruct"},
+		},
+	}
+}
+
+func TestInferenceServerPresetsVLLM(t *testing.T) {
+	presets, err := inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{
+		"type":                 "vLLM",
+		"image":                "vllm/vllm-openai:v0.7.2",
+		"resources":            map[string]interface{}{"gpuCount": "2"},
+		"maxModelLen":          int64(4096),
+		"gpuMemoryUtilization": 0.9,
+		"trustRemoteCode":      true,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"type":    "vLLM",
+		"version": "0.7.2",
+		"command": []interface{}{"vllm", "serve"},
+		"args": []interface{}{
+			"meta-llama/Llama-3.1-8B-Instruct",
+			"--host=0.0.0.0",
+			"--port=8000",
+			"--tensor-parallel-size=2",
+			"--max-model-len=4096",
+			"--gpu-memory-utilization=0.9",
+			"--trust-remote-code",
+			"--disable-log-requests",
+		},
+		"env":        []interface{}{map[string]interface{}{"name": "VLLM_NO_USAGE_STATS", "value": "1"}},
+		"port":       int64(8000),
+		"ports":      []interface{}{map[string]interface{}{"name": "http", "containerPort": int64(8000), "protocol": "TCP"}},
+		"healthPath": "/health",
+	}, presets)
+
+	// Before 0.5, the server module is the entrypoint.
+	presets, err = inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{
+		"type":    "vllm",
+		"version": "0.4.3",
+		"model":   "/data/llama",
+		"port":    float64(7080),
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"python3", "-m", "vllm.entrypoints.openai.api_server"}, presets["command"])
+	assert.Equal(t, []interface{}{"--model=/data/llama", "--host=0.0.0.0", "--port=7080", "--tensor-parallel-size=1", "--disable-log-requests"}, presets["args"])
+
+	// From 0.10.2, and for versions that cannot be determined, requests are
+	// not logged by default.
+	for _, image := range []string{"vllm/vllm-openai:v0.10.2", "vllm/vllm-openai:latest", "vllm/vllm-openai@sha256:abcd"} {
+		presets, err = inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{"type": "vLLM", "image": image}))
+		require.NoError(t, err)
+		assert.NotContains(t, presets["args"], "--disable-log-requests", image)
+	}
+}
+
+func TestInferenceServerPresetsTGI(t *testing.T) {
+	server := map[string]interface{}{
+		"type":               "TGI",
+		"image":              "ghcr.io/huggingface/text-generation-inference:2.4.1",
+		"tensorParallelSize": int64(4),
+		"maxModelLen":        int64(8192),
+	}
+	presets, err := inferenceServerPresets(newTestInferenceDeployment(server))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"text-generation-launcher"}, presets["command"])
+	assert.Equal(t, []interface{}{
+		"--model-id=meta-llama/Llama-3.1-8B-Instruct",
+		"--hostname=0.0.0.0",
+		"--port=8000",
+		"--num-shard=4",
+		"--max-input-tokens=8191",
+		"--max-total-tokens=8192",
+	}, presets["args"])
+	assert.Equal(t, []interface{}{}, presets["env"])
+
+	server["image"] = "ghcr.io/huggingface/text-generation-inference:1.4.5"
+	presets, err = inferenceServerPresets(newTestInferenceDeployment(server))
+	require.NoError(t, err)
+	assert.Contains(t, presets["args"], "--max-input-length=8191")
+}
+
+func TestInferenceServerPresetsTensorRTLLMAndSGLang(t *testing.T) {
+	presets, err := inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{
+		"type":        "TensorRT-LLM",
+		"image":       "nvcr.io/nvidia/tensorrt-llm/release:1.0.0rc4",
+		"maxModelLen": int64(4096),
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", presets["version"])
+	assert.Equal(t, []interface{}{"trtllm-serve"}, presets["command"])
+	assert.Equal(t, []interface{}{"meta-llama/Llama-3.1-8B-Instruct", "--host=0.0.0.0", "--port=8000", "--tp_size=1", "--max_seq_len=4096"}, presets["args"])
+
+	presets, err = inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{
+		"type":            "SGLang",
+		"image":           "lmsysorg/sglang:v0.4.1.post7-cu124",
+		"servedModelName": "llama",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "0.4.1", presets["version"])
+	assert.Equal(t, []interface{}{"python3", "-m", "sglang.launch_server"}, presets["command"])
+	assert.Equal(t, []interface{}{"--model-path=meta-llama/Llama-3.1-8B-Instruct", "--host=0.0.0.0", "--port=30000", "--tp-size=1", "--served-model-name=llama"}, presets["args"])
+	assert.Equal(t, int64(30000), presets["port"])
+}
+
+func TestInferenceServerPresetsErrors(t *testing.T) {
+	// Resources without a server, or with servers that have no preset, get
+	// empty presets.
+	for _, resource := range []map[string]interface{}{
+		{"kind": "Agent", "spec": map[string]interface{}{}},
+		newTestInferenceDeployment(map[string]interface{}{"type": "Triton"}),
+	} {
+		presets, err := inferenceServerPresets(resource)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{}, presets)
+	}
+
+	for _, test := range []struct {
+		server map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"type": "vLLM", "version": "nightly"}, `invalid inference server version "nightly"`},
+		{map[string]interface{}{"type": "TensorRT-LLM", "version": "0.9.0"}, "the TensorRT-LLM preset supports versions from 0.15.0, not 0.9.0"},
+		{map[string]interface{}{"type": "vLLM", "port": "http"}, "spec.inferenceServer.port must be a positive integer, not http"},
+		{map[string]interface{}{"type": "vLLM", "tensorParallelSize": 1.5}, "spec.inferenceServer.tensorParallelSize must be a positive integer, not 1.5"},
+		{map[string]interface{}{"type": "vLLM", "gpuMemoryUtilization": "most"}, `spec.inferenceServer.gpuMemoryUtilization must be a number, not "most"`},
+	} {
+		_, err := inferenceServerPresets(newTestInferenceDeployment(test.server))
+		assert.ErrorContains(t, err, test.err)
+	}
+
+	resource := newTestInferenceDeployment(map[string]interface{}{"type": "SGLang"})
+	delete(resource["spec"].(map[string]interface{}), "model")
+	_, err := inferenceServerPresets(resource)
+	assert.EqualError(t, err, "invalid settings for the SGLang preset: spec.inferenceServer.model or spec.model.modelName is required")
+}
+
+func TestInferenceServerPresetsTemplate(t *testing.T) {
+	presets, err := inferenceServerPresets(newTestInferenceDeployment(map[string]interface{}{"type": "SGLang", "version": "0.4.1"}))
+	require.NoError(t, err)
+
+	tmpl, err := template.New("presets").Funcs(TemplateFuncs()).Parse(`command:
+{{- range .presets.command }}
+- {{ . }}
+{{- end }}
+ports:
+{{- range .presets.ports }}
+- containerPort: {{ .containerPort }}
+{{- end }}
+`)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, tmpl.Execute(&out, map[string]interface{}{"presets": presets}))
+	assert.Equal(t, "command:\n- python3\n- -m\n- sglang.launch_server\nports:\n- containerPort: 30000\n", out.String())
+}
@@ -0,0 +1,121 @@
+package transformer
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// renderCacheMaxEntries bounds the render cache. When it is full, the entry
+// of the resource that was rendered least recently is evicted.
+const renderCacheMaxEntries = 1024
+
+// renderCache keeps the objects last rendered for each resource, keyed by the
+// hash of the kustomize input they were built from. Rendering the templates is
+// cheap, running kustomize is not, and when the dependents are applied again
+// to repair drift the input is usually unchanged.
+type renderCache struct {
+	m       sync.Mutex
+	entries map[types.UID]*list.Element
+	// order holds the entries, most recently used first.
+	order list.List
+}
+
+type renderCacheEntry struct {
+	uid  types.UID
+	hash string
+	// objects are stored encoded, so that every hit returns fresh copies.
+	objects [][]byte
+}
+
+// get returns copies of the objects rendered for uid if they were built from
+// the input with the given hash.
+func (c *renderCache) get(uid types.UID, hash string) ([]*unstructured.Unstructured, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	element, ok := c.entries[uid]
+	if uid == "" || !ok {
+		return nil, false
+	}
+	entry := element.Value.(*renderCacheEntry)
+	if entry.hash != hash {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	objs := make([]*unstructured.Unstructured, 0, len(entry.objects))
+	for _, data := range entry.objects {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			return nil, false
+		}
+		objs = append(objs, obj)
+	}
+	return objs, true
+}
+
+// put stores the objects rendered for uid from the input with the given hash.
+func (c *renderCache) put(uid types.UID, hash string, objs []*unstructured.Unstructured) error {
+	if uid == "" {
+		return nil
+	}
+	entry := &renderCacheEntry{uid: uid, hash: hash}
+	for _, obj := range objs {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode %s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		entry.objects = append(entry.objects, data)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.entries == nil {
+		c.entries = map[types.UID]*list.Element{}
+	}
+	if element, ok := c.entries[uid]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+	if len(c.entries) >= renderCacheMaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderCacheEntry).uid)
+	}
+	c.entries[uid] = c.order.PushFront(entry)
+	return nil
+}
+
+// renderInputHash hashes the kustomize input: the files under root, which
+// hold the rendered templates and so reflect the template content, the
+// resolved context and the resource, and the settings applied to the
+// kustomize output.
+func renderInputHash(fSys filesys.FileSystem, root string, files []string, settings ...any) (string, error) {
+	h := sha256.New()
+	for _, file := range files {
+		data, err := fSys.ReadFile(path.Join(root, file))
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		fmt.Fprintf(h, "%s\n%d\n", file, len(data))
+		h.Write(data)
+	}
+	for _, setting := range settings {
+		data, err := json.Marshal(setting)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode render settings: %w", err)
+		}
+		h.Write(data)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,89 @@
+package transformer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestRenderCache(t *testing.T) {
+	cache := &renderCache{}
+	obj := newTestObject("apps", "v1", "Deployment", "server")
+	require.NoError(t, unstructured.SetNestedField(obj.Object, int64(2), "spec", "replicas"))
+
+	_, ok := cache.get("uid-1", "hash-1")
+	assert.False(t, ok, "empty cache")
+
+	require.NoError(t, cache.put("uid-1", "hash-1", []*unstructured.Unstructured{obj}))
+	cached, ok := cache.get("uid-1", "hash-1")
+	require.True(t, ok)
+	require.Len(t, cached, 1)
+	assert.Equal(t, obj.Object, cached[0].Object)
+
+	// Hits return copies, so callers may change them.
+	cached[0].SetName("changed")
+	again, ok := cache.get("uid-1", "hash-1")
+	require.True(t, ok)
+	assert.Equal(t, "server", again[0].GetName())
+
+	_, ok = cache.get("uid-1", "hash-2")
+	assert.False(t, ok, "the input changed")
+	_, ok = cache.get("uid-2", "hash-1")
+	assert.False(t, ok, "another resource")
+
+	require.NoError(t, cache.put("", "hash-1", []*unstructured.Unstructured{obj}))
+	_, ok = cache.get("", "hash-1")
+	assert.False(t, ok, "resources without a UID are not cached")
+}
+
+func TestRenderCache_Bounded(t *testing.T) {
+	cache := &renderCache{}
+	for i := 0; i < renderCacheMaxEntries; i++ {
+		require.NoError(t, cache.put(types.UID(fmt.Sprintf("uid-%d", i)), "hash", nil))
+	}
+	assert.Len(t, cache.entries, renderCacheMaxEntries)
+	_, ok := cache.get("uid-0", "hash")
+	require.True(t, ok, "uid-0 is now the most recently used")
+
+	require.NoError(t, cache.put("last", "hash", nil))
+	assert.Len(t, cache.entries, renderCacheMaxEntries, "a full cache evicts one entry")
+	_, ok = cache.get("uid-1", "hash")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	for _, uid := range []types.UID{"uid-0", "uid-2", "last"} {
+		_, ok = cache.get(uid, "hash")
+		assert.True(t, ok, uid)
+	}
+
+	require.NoError(t, cache.put("last", "hash-2", nil))
+	assert.Len(t, cache.entries, renderCacheMaxEntries, "replacing an entry evicts none")
+}
+
+func TestRenderInputHash(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("/tmp/kustomization.yaml", []byte("resources:\n- ns/app.yaml\n")))
+	require.NoError(t, fSys.WriteFile("/tmp/ns/app.yaml", []byte("kind: ConfigMap\n")))
+	files := []string{"kustomization.yaml", "ns/app.yaml"}
+
+	hash, err := renderInputHash(fSys, "/tmp", files, map[string]string{"team": "ml"})
+	require.NoError(t, err)
+	same, err := renderInputHash(fSys, "/tmp", files, map[string]string{"team": "ml"})
+	require.NoError(t, err)
+	assert.Equal(t, hash, same)
+
+	otherSettings, err := renderInputHash(fSys, "/tmp", files, map[string]string{"team": "infra"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, otherSettings)
+
+	require.NoError(t, fSys.WriteFile("/tmp/ns/app.yaml", []byte("kind: Secret\n")))
+	otherContent, err := renderInputHash(fSys, "/tmp", files, map[string]string{"team": "ml"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, otherContent)
+
+	_, err = renderInputHash(fSys, "/tmp", []string{"missing.yaml"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package transformer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// renderDirPattern names the directory that each render writes its templates
+// and kustomization to, under the render base directory.
+const renderDirPattern = "render-*"
+
+var leakedRenderDirs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "karo_leaked_render_directories_total",
+	Help: "Render directories that were left on disk, by source: cleanup (a render could not remove its directory) or sweep (found at startup, left behind by a crashed render).",
+}, []string{"source"})
+
+func init() {
+	metrics.Registry.MustRegister(leakedRenderDirs)
+}
+
+// renderBaseDir returns the directory under which renders create their
+// directories.
+func (t *Transformer) renderBaseDir() string {
+	if t.renderDir != "" {
+		return t.renderDir
+	}
+	return targetRootPath
+}
+
+// SetRenderDir sets the directory under which renders create their
+// directories, "tmp" in the working directory if empty.
+func (t *Transformer) SetRenderDir(dir string) {
+	t.renderDir = dir
+}
+
+// newRenderDir creates a directory for a single render, so that concurrent
+// renders of different kinds do not share files. The returned function
+// removes it and must be deferred by the caller.
+func (t *Transformer) newRenderDir(log logr.Logger) (string, func(), error) {
+	base := t.renderBaseDir()
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return "", nil, fmt.Errorf("unable to create directory at %q: %v", base, err)
+	}
+	dir, err := os.MkdirTemp(base, renderDirPattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create render directory under %q: %v", base, err)
+	}
+	return dir, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			leakedRenderDirs.WithLabelValues("cleanup").Inc()
+			log.Error(err, "Failed to remove render directory", "dir", dir)
+		}
+	}, nil
+}
+
+// SweepRenderDirs removes everything under the render base directory: the
+// directories of renders that did not clean up because the operator crashed,
+// and files written by versions that rendered into the base directory itself.
+// It must be called before the first render, and returns the number of
+// entries removed.
+func (t *Transformer) SweepRenderDirs(log logr.Logger) (int, error) {
+	base := t.renderBaseDir()
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to read render directory %q: %v", base, err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		path := filepath.Join(base, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("unable to remove stale render output %q: %v", path, err)
+		}
+		log.V(1).Info("Removed stale render output", "path", path)
+		removed++
+	}
+	leakedRenderDirs.WithLabelValues("sweep").Add(float64(removed))
+	return removed, nil
+}
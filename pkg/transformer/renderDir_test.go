@@ -0,0 +1,56 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRenderDir(t *testing.T) {
+	tr := &Transformer{renderDir: filepath.Join(t.TempDir(), "tmp")}
+
+	first, cleanupFirst, err := tr.newRenderDir(logr.Discard())
+	require.NoError(t, err)
+	second, cleanupSecond, err := tr.newRenderDir(logr.Discard())
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "every render gets its own directory")
+	assert.Equal(t, tr.renderDir, filepath.Dir(first))
+
+	require.NoError(t, os.WriteFile(filepath.Join(first, "kustomization.yaml"), []byte("resources: []\n"), 0o644))
+	cleanupFirst()
+	assert.NoDirExists(t, first)
+	assert.DirExists(t, second)
+	cleanupSecond()
+	assert.NoDirExists(t, second)
+}
+
+func TestSweepRenderDirs(t *testing.T) {
+	tr := &Transformer{renderDir: filepath.Join(t.TempDir(), "tmp")}
+
+	removed, err := tr.SweepRenderDirs(logr.Discard())
+	require.NoError(t, err)
+	assert.Zero(t, removed, "a missing base directory is not an error")
+
+	// A render that crashed, and the layout of versions that rendered into
+	// the base directory itself.
+	crashed, _, err := tr.newRenderDir(logr.Discard())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(crashed, "kustomization.yaml"), nil, 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tr.renderDir, "default", "llama"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tr.renderDir, "kustomization.yaml"), nil, 0o644))
+
+	before := testutil.ToFloat64(leakedRenderDirs.WithLabelValues("sweep"))
+	removed, err = tr.SweepRenderDirs(logr.Discard())
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, before+3, testutil.ToFloat64(leakedRenderDirs.WithLabelValues("sweep")))
+
+	entries, err := os.ReadDir(tr.renderDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
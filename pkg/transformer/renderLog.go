@@ -0,0 +1,127 @@
+package transformer
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// sensitiveAnnotationKeys matches annotation keys whose values are
+	// redacted, e.g. the last applied configuration, which repeats Secret data.
+	sensitiveAnnotationKeys = regexp.MustCompile(`(?i)last-applied-configuration|token|password|secret|credential|signature|api-?key`)
+	// signedURLPattern matches URLs with query strings that may carry a
+	// signature or credentials, e.g. GCS and S3 signed URLs.
+	signedURLPattern = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'?]+\?[^\s"']+`)
+	// signedQueryKeys matches query parameters that carry a signature or
+	// credentials.
+	signedQueryKeys = regexp.MustCompile(`(?i)^(x-goog-signature|x-goog-credential|x-amz-signature|x-amz-credential|x-amz-security-token|signature|sig|token|access_token|api[_-]?key|key)$`)
+)
+
+// SetLogRenderedManifests sets whether the rendered objects are logged in
+// full, redacted, at verbosity 1. Otherwise only their kinds and names are.
+func (t *Transformer) SetLogRenderedManifests(enabled bool) {
+	t.logRenderedManifests = enabled
+}
+
+// logRenderedObject logs an object rendered by kustomize.
+func (t *Transformer) logRenderedObject(log logr.Logger, obj *unstructured.Unstructured) {
+	log = log.V(1).WithValues("kind", obj.GetKind(), "namespace", obj.GetNamespace(), "name", obj.GetName())
+	if !t.logRenderedManifests {
+		log.Info("Rendered object")
+		return
+	}
+	manifest, err := yaml.Marshal(RedactManifest(obj).Object)
+	if err != nil {
+		log.Error(err, "Unable to encode the rendered object for logging")
+		return
+	}
+	log.Info("Rendered object", "manifest", string(manifest))
+}
+
+// RedactManifest returns a copy of obj for logging or storage, without the
+// data of Secrets, the values of sensitive annotations, the signatures of
+// signed URLs and credentials that appear in strings.
+func RedactManifest(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	redactedObj := &unstructured.Unstructured{Object: redactValue(obj.Object).(map[string]interface{})}
+	if obj.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			switch data := redactedObj.Object[field].(type) {
+			case nil:
+			case map[string]interface{}:
+				for key := range data {
+					data[key] = redacted
+				}
+			default:
+				redactedObj.Object[field] = redacted
+			}
+		}
+	}
+	if metadata, ok := redactedObj.Object["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			for key := range annotations {
+				if sensitiveAnnotationKeys.MatchString(key) {
+					annotations[key] = redacted
+				}
+			}
+		}
+	}
+	return redactedObj
+}
+
+// redactValue copies a decoded object, redacting every string in it.
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			copied[key] = redactValue(val)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, val := range v {
+			copied[i] = redactValue(val)
+		}
+		return copied
+	case string:
+		return redactString(v)
+	default:
+		return v
+	}
+}
+
+// redactString redacts credentials and the signed query parameters of URLs.
+func redactString(s string) string {
+	s = signedURLPattern.ReplaceAllStringFunc(s, redactSignedURL)
+	return redactSecrets(s)
+}
+
+// redactSignedURL redacts the query parameters of rawURL that carry a
+// signature or credentials.
+func redactSignedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if signedQueryKeys.MatchString(key) {
+			query[key] = []string{redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	// Encode keeps the placeholder readable.
+	u.RawQuery = strings.ReplaceAll(strings.ReplaceAll(query.Encode(), "%5B", "["), "%5D", "]")
+	return u.String()
+}
@@ -0,0 +1,81 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newRenderedSecret() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "hf-token",
+			"namespace": "ml",
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"token":"aGZfc2VjcmV0"}}`,
+				"example.com/api-key":                              "abc123",
+				"example.com/owner":                                "ml-team",
+			},
+		},
+		"data":       map[string]interface{}{"token": "aGZfc2VjcmV0"},
+		"stringData": map[string]interface{}{"plain": "hf_secret"},
+	}}
+}
+
+func TestRedactManifest(t *testing.T) {
+	secret := newRenderedSecret()
+	redactedSecret := RedactManifest(secret)
+	assert.Equal(t, map[string]interface{}{"token": redacted}, redactedSecret.Object["data"])
+	assert.Equal(t, map[string]interface{}{"plain": redacted}, redactedSecret.Object["stringData"])
+	assert.Equal(t, map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": redacted,
+		"example.com/api-key":                              redacted,
+		"example.com/owner":                                "ml-team",
+	}, redactedSecret.GetAnnotations())
+	assert.Equal(t, "aGZfc2VjcmV0", secret.Object["data"].(map[string]interface{})["token"], "the rendered object must not be modified")
+
+	malformed := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Secret", "data": "token: aGZfc2VjcmV0"}}
+	assert.Equal(t, redacted, RedactManifest(malformed).Object["data"])
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Job",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+			map[string]interface{}{
+				"name": "download",
+				"args": []interface{}{
+					"--url=https://storage.googleapis.com/models/llama.bin?X-Goog-Algorithm=GOOG4-RSA-SHA256&X-Goog-Credential=sa%40p.iam&X-Goog-Signature=deadbeef",
+					"--header=Authorization: Bearer ya29.token",
+					"--source=https://example.com/models?revision=main",
+				},
+			},
+		}}}},
+	}}
+	args := RedactManifest(job).Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["args"].([]interface{})
+	assert.Equal(t, "--url=https://storage.googleapis.com/models/llama.bin?X-Goog-Algorithm=GOOG4-RSA-SHA256&X-Goog-Credential=[REDACTED]&X-Goog-Signature=[REDACTED]", args[0])
+	assert.Equal(t, "--header=Authorization: [REDACTED]", args[1])
+	assert.Equal(t, "--source=https://example.com/models?revision=main", args[2])
+}
+
+func TestLogRenderedObject(t *testing.T) {
+	var lines []string
+	log := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{Verbosity: 1})
+
+	tr := NewTransformer()
+	tr.logRenderedObject(log, newRenderedSecret())
+	assert.Len(t, lines, 1)
+	assert.NotContains(t, lines[0], "manifest")
+
+	tr.SetLogRenderedManifests(true)
+	tr.logRenderedObject(log, newRenderedSecret())
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"manifest"`)
+	assert.Contains(t, lines[1], "hf-token")
+	for _, secret := range []string{"aGZfc2VjcmV0", "hf_secret", "abc123"} {
+		assert.False(t, strings.Contains(lines[1], secret), "the log contains %q: %s", secret, lines[1])
+	}
+}
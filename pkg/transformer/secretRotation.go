@@ -0,0 +1,198 @@
+package transformer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// SecretRotationAnnotation is set by templates on a Secret to choose how
+	// changes of its content roll out.
+	SecretRotationAnnotation = "model.skippy.io/secret-rotation"
+	// SecretRotationHashSuffix appends a hash of the content to the name of
+	// the Secret, and renames the references of the rendered pod specs, so
+	// that a change creates a new Secret and rolls out the pods that use it.
+	SecretRotationHashSuffix = "hash-suffix"
+
+	// secretHashLength is the number of hex digits of the hash suffix.
+	secretHashLength = 10
+)
+
+// SecretData returns the decoded content of a Secret: its base64 encoded
+// data, with the plain stringData merged over it, as the API server stores
+// it on write.
+func SecretData(obj *unstructured.Unstructured) (map[string]string, error) {
+	content := map[string]string{}
+	if raw, found := obj.Object["data"]; found && raw != nil {
+		data, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("data of Secret %s is not a map", obj.GetName())
+		}
+		for key, value := range data {
+			encoded, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("data %q of Secret %s is not a string", key, obj.GetName())
+			}
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("data %q of Secret %s is not base64 encoded: %w", key, obj.GetName(), err)
+			}
+			content[key] = string(decoded)
+		}
+	}
+	if raw, found := obj.Object["stringData"]; found && raw != nil {
+		stringData, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("stringData of Secret %s is not a map", obj.GetName())
+		}
+		for key, value := range stringData {
+			plain, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("stringData %q of Secret %s is not a string", key, obj.GetName())
+			}
+			content[key] = plain
+		}
+	}
+	return content, nil
+}
+
+// rotateSecrets renames the Secrets of objs that rotate with a hash suffix,
+// and the references to them in the pod specs of objs.
+func rotateSecrets(objs []*unstructured.Unstructured) error {
+	renamed := map[string]string{}
+	for _, obj := range objs {
+		if obj.GetKind() != "Secret" || obj.GetAPIVersion() != "v1" {
+			continue
+		}
+		strategy, ok := obj.GetAnnotations()[SecretRotationAnnotation]
+		if !ok {
+			continue
+		}
+		if strategy != SecretRotationHashSuffix {
+			return fmt.Errorf("unknown %s %q on Secret %s, the only strategy is %q", SecretRotationAnnotation, strategy, obj.GetName(), SecretRotationHashSuffix)
+		}
+		content, err := SecretData(obj)
+		if err != nil {
+			return err
+		}
+		secretType, _, _ := unstructured.NestedString(obj.Object, "type")
+		name := obj.GetName() + "-" + secretHash(secretType, content)
+		renamed[obj.GetNamespace()+"/"+obj.GetName()] = name
+		obj.SetName(name)
+		if err := validateName(obj); err != nil {
+			return err
+		}
+	}
+	if len(renamed) == 0 {
+		return nil
+	}
+	for _, obj := range objs {
+		rename := func(name string) (string, bool) {
+			newName, ok := renamed[obj.GetNamespace()+"/"+name]
+			return newName, ok
+		}
+		for _, path := range podSpecPaths[obj.GetKind()] {
+			rawPodSpec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+			if podSpec, ok := rawPodSpec.(map[string]interface{}); ok {
+				renameSecretReferences(podSpec, rename)
+			}
+		}
+	}
+	return nil
+}
+
+// secretHash returns the hash suffix of a Secret with the given type and
+// content.
+func secretHash(secretType string, content map[string]string) string {
+	keys := make([]string, 0, len(content))
+	for key := range content {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", secretType)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\n%d\n%s", key, len(content[key]), content[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:secretHashLength]
+}
+
+// renameSecretReferences renames the Secrets that podSpec mounts, reads
+// environment variables from, or pulls images with.
+func renameSecretReferences(podSpec map[string]interface{}, rename func(string) (string, bool)) {
+	visitConfigReferences(podSpec, func(kind string, ref map[string]interface{}, field string) {
+		if kind != "Secret" {
+			return
+		}
+		if name, ok := ref[field].(string); ok {
+			if newName, ok := rename(name); ok {
+				ref[field] = newName
+			}
+		}
+	})
+}
+
+// visitConfigReferences calls visit for every reference of podSpec to a
+// ConfigMap or Secret, with the kind it refers to and the field of ref that
+// holds the name.
+func visitConfigReferences(podSpec map[string]interface{}, visit func(kind string, ref map[string]interface{}, field string)) {
+	for _, secret := range mapsAt(podSpec, "imagePullSecrets") {
+		visit("Secret", secret, "name")
+	}
+	for _, volume := range mapsAt(podSpec, "volumes") {
+		if secret, ok := volume["secret"].(map[string]interface{}); ok {
+			visit("Secret", secret, "secretName")
+		}
+		if configMap, ok := volume["configMap"].(map[string]interface{}); ok {
+			visit("ConfigMap", configMap, "name")
+		}
+		if projected, ok := volume["projected"].(map[string]interface{}); ok {
+			for _, source := range mapsAt(projected, "sources") {
+				if secret, ok := source["secret"].(map[string]interface{}); ok {
+					visit("Secret", secret, "name")
+				}
+				if configMap, ok := source["configMap"].(map[string]interface{}); ok {
+					visit("ConfigMap", configMap, "name")
+				}
+			}
+		}
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		for _, container := range mapsAt(podSpec, field) {
+			for _, envFrom := range mapsAt(container, "envFrom") {
+				if ref, ok := envFrom["secretRef"].(map[string]interface{}); ok {
+					visit("Secret", ref, "name")
+				}
+				if ref, ok := envFrom["configMapRef"].(map[string]interface{}); ok {
+					visit("ConfigMap", ref, "name")
+				}
+			}
+			for _, env := range mapsAt(container, "env") {
+				valueFrom, _ := env["valueFrom"].(map[string]interface{})
+				if ref, ok := valueFrom["secretKeyRef"].(map[string]interface{}); ok {
+					visit("Secret", ref, "name")
+				}
+				if ref, ok := valueFrom["configMapKeyRef"].(map[string]interface{}); ok {
+					visit("ConfigMap", ref, "name")
+				}
+			}
+		}
+	}
+}
+
+// mapsAt returns the maps in the list at m[field].
+func mapsAt(m map[string]interface{}, field string) []map[string]interface{} {
+	list, _ := m[field].([]interface{})
+	maps := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if entryMap, ok := entry.(map[string]interface{}); ok {
+			maps = append(maps, entryMap)
+		}
+	}
+	return maps
+}
@@ -0,0 +1,104 @@
+package transformer
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSecretData(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Secret",
+		"data": map[string]interface{}{
+			"hf_token": base64.StdEncoding.EncodeToString([]byte("old")),
+			"user":     base64.StdEncoding.EncodeToString([]byte("admin")),
+		},
+		"stringData": map[string]interface{}{"hf_token": "new"},
+	}}
+	data, err := SecretData(secret)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"hf_token": "new", "user": "admin"}, data)
+
+	data, err = SecretData(&unstructured.Unstructured{Object: map[string]interface{}{"kind": "Secret"}})
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	for name, object := range map[string]map[string]interface{}{
+		"data is not a map":          {"data": "this-is-not-a-map"},
+		"data is not a string":       {"data": map[string]interface{}{"hf_token": int64(12345)}},
+		"data is not base64":         {"data": map[string]interface{}{"hf_token": "this-is-not-base64-$$$"}},
+		"stringData is not a map":    {"stringData": []interface{}{"token"}},
+		"stringData is not a string": {"stringData": map[string]interface{}{"hf_token": true}},
+	} {
+		_, err := SecretData(&unstructured.Unstructured{Object: object})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	newSecret := func(token string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":        "hf-token",
+				"namespace":   "default",
+				"annotations": map[string]interface{}{SecretRotationAnnotation: SecretRotationHashSuffix},
+			},
+			"stringData": map[string]interface{}{"hf_token": token},
+		}}
+	}
+	newDeployment := func(namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "llama", "namespace": namespace},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name": "server",
+					"env": []interface{}{map[string]interface{}{
+						"name":      "HF_TOKEN",
+						"valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "hf-token", "key": "hf_token"}},
+					}},
+					"envFrom": []interface{}{map[string]interface{}{"secretRef": map[string]interface{}{"name": "other"}}},
+				}},
+				"volumes": []interface{}{map[string]interface{}{
+					"name":   "token",
+					"secret": map[string]interface{}{"secretName": "hf-token"},
+				}},
+			}}},
+		}}
+	}
+
+	secret, deployment, otherNamespace := newSecret("token-1"), newDeployment("default"), newDeployment("other")
+	require.NoError(t, rotateSecrets([]*unstructured.Unstructured{secret, deployment, otherNamespace}))
+	name := secret.GetName()
+	assert.Regexp(t, `^hf-token-[0-9a-f]{10}$`, name)
+
+	podSpec, _, _ := unstructured.NestedMap(deployment.Object, "spec", "template", "spec")
+	container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+	ref, _, _ := unstructured.NestedString(container["env"].([]interface{})[0].(map[string]interface{}), "valueFrom", "secretKeyRef", "name")
+	assert.Equal(t, name, ref)
+	ref, _, _ = unstructured.NestedString(container["envFrom"].([]interface{})[0].(map[string]interface{}), "secretRef", "name")
+	assert.Equal(t, "other", ref, "other Secrets keep their name")
+	ref, _, _ = unstructured.NestedString(podSpec["volumes"].([]interface{})[0].(map[string]interface{}), "secret", "secretName")
+	assert.Equal(t, name, ref)
+	volumes, _, _ := unstructured.NestedSlice(otherNamespace.Object, "spec", "template", "spec", "volumes")
+	ref, _, _ = unstructured.NestedString(volumes[0].(map[string]interface{}), "secret", "secretName")
+	assert.Equal(t, "hf-token", ref, "references in other namespaces keep their name")
+
+	// The same content keeps the name, other content changes it.
+	same := newSecret("token-1")
+	require.NoError(t, rotateSecrets([]*unstructured.Unstructured{same}))
+	assert.Equal(t, name, same.GetName())
+	changed := newSecret("token-2")
+	require.NoError(t, rotateSecrets([]*unstructured.Unstructured{changed}))
+	assert.NotEqual(t, name, changed.GetName())
+
+	unknown := newSecret("token-1")
+	unknown.SetAnnotations(map[string]string{SecretRotationAnnotation: "rolling"})
+	assert.ErrorContains(t, rotateSecrets([]*unstructured.Unstructured{unknown}), `unknown model.skippy.io/secret-rotation "rolling"`)
+}
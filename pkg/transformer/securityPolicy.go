@@ -0,0 +1,216 @@
+package transformer
+
+import (
+	"fmt"
+	"slices"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podSpecPaths lists where the pod specs live for the workload kinds that
+// templates generate.
+var podSpecPaths = map[string][][]string{
+	"Pod":         {{"spec"}},
+	"Deployment":  {{"spec", "template", "spec"}},
+	"StatefulSet": {{"spec", "template", "spec"}},
+	"DaemonSet":   {{"spec", "template", "spec"}},
+	"ReplicaSet":  {{"spec", "template", "spec"}},
+	"Job":         {{"spec", "template", "spec"}},
+	"CronJob":     {{"spec", "jobTemplate", "spec", "template", "spec"}},
+	"LeaderWorkerSet": {
+		{"spec", "leaderWorkerTemplate", "leaderTemplate", "spec"},
+		{"spec", "leaderWorkerTemplate", "workerTemplate", "spec"},
+	},
+}
+
+// PodSpecPaths returns where the pod specs of an object of kind live, or nil
+// for kinds that have none.
+func PodSpecPaths(kind string) [][]string {
+	return podSpecPaths[kind]
+}
+
+// SetSecurityPolicy sets the cluster-wide pod security policy. Integrations may
+// add to it with their own securityPolicy.
+func (t *Transformer) SetSecurityPolicy(policy *v1.IntegrationSecurityPolicySpec) {
+	t.securityPolicy = policy
+}
+
+// MergeSecurityPolicies combines the cluster-wide policy with an integration's
+// own policy. An integration can only tighten the cluster-wide policy: its
+// settings fill in those that the cluster-wide policy leaves unset, dropped
+// capabilities are combined, and an error is returned if it contradicts a
+// setting of the cluster-wide policy, e.g. with another runtime class or by
+// allowing containers to run as root. Allowed images and signature keys are
+// not merged, as an image must be allowed by each policy, see checkImagePolicy.
+func MergeSecurityPolicies(cluster, integration *v1.IntegrationSecurityPolicySpec) (*v1.IntegrationSecurityPolicySpec, error) {
+	if cluster == nil {
+		return integration, nil
+	}
+	if integration == nil {
+		return cluster, nil
+	}
+	merged := cluster.DeepCopy()
+	if integration.RuntimeClassName != "" {
+		if merged.RuntimeClassName != "" && merged.RuntimeClassName != integration.RuntimeClassName {
+			return nil, fmt.Errorf("the runtime class %q of the integration contradicts the cluster-wide %q", integration.RuntimeClassName, merged.RuntimeClassName)
+		}
+		merged.RuntimeClassName = integration.RuntimeClassName
+	}
+	if integration.SeccompProfileType != "" {
+		if merged.SeccompProfileType != "" && merged.SeccompProfileType != integration.SeccompProfileType {
+			return nil, fmt.Errorf("the seccomp profile type %q of the integration contradicts the cluster-wide %q", integration.SeccompProfileType, merged.SeccompProfileType)
+		}
+		merged.SeccompProfileType = integration.SeccompProfileType
+	}
+	if integration.RunAsNonRoot != nil {
+		if merged.RunAsNonRoot != nil && *merged.RunAsNonRoot && !*integration.RunAsNonRoot {
+			return nil, fmt.Errorf("the integration allows containers to run as root, which the cluster-wide policy does not")
+		}
+		if merged.RunAsNonRoot == nil || *integration.RunAsNonRoot {
+			runAsNonRoot := *integration.RunAsNonRoot
+			merged.RunAsNonRoot = &runAsNonRoot
+		}
+	}
+	for _, capability := range integration.DropCapabilities {
+		if !slices.Contains(merged.DropCapabilities, capability) {
+			merged.DropCapabilities = append(merged.DropCapabilities, capability)
+		}
+	}
+	return merged, nil
+}
+
+// applySecurityPolicy injects the policy into every pod spec of the object. It
+// returns an error if the rendered template sets a value that contradicts the
+// policy, rather than silently overriding what the template author asked for.
+//
+// Rendered objects may hold plain Go ints, which the deep-copying unstructured
+// helpers do not accept, so the object is walked and modified in place.
+func applySecurityPolicy(obj *unstructured.Unstructured, policy *v1.IntegrationSecurityPolicySpec) error {
+	if policy == nil {
+		return nil
+	}
+	for _, path := range podSpecPaths[obj.GetKind()] {
+		rawPodSpec, found, err := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		podSpec, ok := rawPodSpec.(map[string]interface{})
+		if err != nil || !found || !ok {
+			continue
+		}
+		if err := applySecurityPolicyToPodSpec(podSpec, policy); err != nil {
+			return fmt.Errorf("%s %s violates the security policy: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func applySecurityPolicyToPodSpec(podSpec map[string]interface{}, policy *v1.IntegrationSecurityPolicySpec) error {
+	if policy.RuntimeClassName != "" {
+		if current, _ := podSpec["runtimeClassName"].(string); current != "" && current != policy.RuntimeClassName {
+			return fmt.Errorf("runtimeClassName is %q, but %q is required", current, policy.RuntimeClassName)
+		}
+		podSpec["runtimeClassName"] = policy.RuntimeClassName
+	}
+
+	podSecurityContext := childMap(podSpec, "securityContext")
+	if err := checkSeccompProfile(podSecurityContext, policy); err != nil {
+		return fmt.Errorf("pod %w", err)
+	}
+	if policy.SeccompProfileType != "" {
+		podSecurityContext["seccompProfile"] = map[string]interface{}{"type": policy.SeccompProfileType}
+	}
+	if policy.RunAsNonRoot != nil && *policy.RunAsNonRoot {
+		if err := checkNonRoot(podSecurityContext); err != nil {
+			return fmt.Errorf("pod %w", err)
+		}
+		podSecurityContext["runAsNonRoot"] = true
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[field].([]interface{})
+		for _, rawContainer := range containers {
+			container, ok := rawContainer.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if err := applySecurityPolicyToContainer(container, policy); err != nil {
+				return fmt.Errorf("container %q %w", container["name"], err)
+			}
+		}
+	}
+	return nil
+}
+
+func applySecurityPolicyToContainer(container map[string]interface{}, policy *v1.IntegrationSecurityPolicySpec) error {
+	securityContext := childMap(container, "securityContext")
+	if err := checkSeccompProfile(securityContext, policy); err != nil {
+		return err
+	}
+	if policy.RunAsNonRoot != nil && *policy.RunAsNonRoot {
+		if err := checkNonRoot(securityContext); err != nil {
+			return err
+		}
+	}
+	if len(policy.DropCapabilities) == 0 {
+		return nil
+	}
+
+	capabilities := childMap(securityContext, "capabilities")
+	added, _ := capabilities["add"].([]interface{})
+	dropped, _ := capabilities["drop"].([]interface{})
+	for _, capability := range policy.DropCapabilities {
+		if slices.Contains(added, interface{}(capability)) {
+			return fmt.Errorf("adds capability %q, which must be dropped", capability)
+		}
+		if !slices.Contains(dropped, interface{}(capability)) {
+			dropped = append(dropped, capability)
+		}
+	}
+	capabilities["drop"] = dropped
+	return nil
+}
+
+// checkSeccompProfile returns an error if the security context selects a
+// different seccomp profile than the policy requires.
+func checkSeccompProfile(securityContext map[string]interface{}, policy *v1.IntegrationSecurityPolicySpec) error {
+	if policy.SeccompProfileType == "" {
+		return nil
+	}
+	profile, _ := securityContext["seccompProfile"].(map[string]interface{})
+	if current, _ := profile["type"].(string); current != "" && current != policy.SeccompProfileType {
+		return fmt.Errorf("sets seccompProfile type %q, but %q is required", current, policy.SeccompProfileType)
+	}
+	return nil
+}
+
+// checkNonRoot returns an error if the security context explicitly allows
+// running as root.
+func checkNonRoot(securityContext map[string]interface{}) error {
+	if runAsNonRoot, ok := securityContext["runAsNonRoot"].(bool); ok && !runAsNonRoot {
+		return fmt.Errorf("sets runAsNonRoot to false, but non-root is required")
+	}
+	switch runAsUser := securityContext["runAsUser"].(type) {
+	case int:
+		if runAsUser == 0 {
+			return fmt.Errorf("runs as user 0, but non-root is required")
+		}
+	case int64:
+		if runAsUser == 0 {
+			return fmt.Errorf("runs as user 0, but non-root is required")
+		}
+	case float64:
+		if runAsUser == 0 {
+			return fmt.Errorf("runs as user 0, but non-root is required")
+		}
+	}
+	return nil
+}
+
+// childMap returns the map stored under key, creating it if it is missing.
+func childMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return child
+}
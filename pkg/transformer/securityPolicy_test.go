@@ -0,0 +1,166 @@
+package transformer
+
+import (
+	"testing"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestDeploymentWithPodSpec(podSpec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": 1, // Rendered objects carry plain ints.
+			"template": map[string]interface{}{"spec": podSpec},
+		},
+	}}
+}
+
+func TestApplySecurityPolicy(t *testing.T) {
+	nonRoot := true
+	policy := &v1.IntegrationSecurityPolicySpec{
+		RuntimeClassName:   "gvisor",
+		SeccompProfileType: "RuntimeDefault",
+		RunAsNonRoot:       &nonRoot,
+		DropCapabilities:   []string{"ALL"},
+	}
+
+	t.Run("injects settings into pod and containers", func(t *testing.T) {
+		obj := newTestDeploymentWithPodSpec(map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:1"},
+			},
+			"initContainers": []interface{}{
+				map[string]interface{}{
+					"name":            "init",
+					"securityContext": map[string]interface{}{"runAsUser": 1000},
+				},
+			},
+		})
+		require.NoError(t, applySecurityPolicy(obj, policy))
+
+		podSpec := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		assert.Equal(t, "gvisor", podSpec["runtimeClassName"])
+		podSecurityContext := podSpec["securityContext"].(map[string]interface{})
+		assert.Equal(t, true, podSecurityContext["runAsNonRoot"])
+		assert.Equal(t, map[string]interface{}{"type": "RuntimeDefault"}, podSecurityContext["seccompProfile"])
+
+		for _, field := range []string{"containers", "initContainers"} {
+			container := podSpec[field].([]interface{})[0].(map[string]interface{})
+			capabilities := container["securityContext"].(map[string]interface{})["capabilities"].(map[string]interface{})
+			assert.Equal(t, []interface{}{"ALL"}, capabilities["drop"], field)
+		}
+	})
+
+	t.Run("templates may repeat the policy", func(t *testing.T) {
+		obj := newTestDeploymentWithPodSpec(map[string]interface{}{
+			"runtimeClassName": "gvisor",
+			"securityContext": map[string]interface{}{
+				"runAsNonRoot":   true,
+				"seccompProfile": map[string]interface{}{"type": "RuntimeDefault"},
+			},
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name": "app",
+					"securityContext": map[string]interface{}{
+						"capabilities": map[string]interface{}{"drop": []interface{}{"ALL"}, "add": []interface{}{"NET_BIND_SERVICE"}},
+					},
+				},
+			},
+		})
+		require.NoError(t, applySecurityPolicy(obj, policy))
+	})
+
+	overrides := map[string]map[string]interface{}{
+		"runtime class": {"runtimeClassName": "runc"},
+		"pod seccomp profile": {
+			"securityContext": map[string]interface{}{"seccompProfile": map[string]interface{}{"type": "Unconfined"}},
+		},
+		"pod root user": {"securityContext": map[string]interface{}{"runAsUser": 0}},
+		"container root": {
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "securityContext": map[string]interface{}{"runAsNonRoot": false}},
+			},
+		},
+		"added capability": {
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "securityContext": map[string]interface{}{
+					"capabilities": map[string]interface{}{"add": []interface{}{"ALL"}},
+				}},
+			},
+		},
+	}
+	for name, podSpec := range overrides {
+		t.Run("rejects overriding "+name, func(t *testing.T) {
+			err := applySecurityPolicy(newTestDeploymentWithPodSpec(podSpec), policy)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "Deployment web violates the security policy")
+		})
+	}
+
+	t.Run("ignores kinds without pod specs", func(t *testing.T) {
+		service := newTestObject("", "v1", "Service", "web")
+		require.NoError(t, applySecurityPolicy(service, policy))
+		assert.Equal(t, map[string]interface{}{}, service.Object["spec"])
+	})
+}
+
+func TestMergeSecurityPolicies(t *testing.T) {
+	merged, err := MergeSecurityPolicies(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, merged)
+
+	cluster := &v1.IntegrationSecurityPolicySpec{RuntimeClassName: "gvisor", DropCapabilities: []string{"ALL"}}
+	merged, err = MergeSecurityPolicies(cluster, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cluster, merged)
+
+	nonRoot, root := true, false
+	merged, err = MergeSecurityPolicies(cluster, &v1.IntegrationSecurityPolicySpec{
+		RuntimeClassName:   "gvisor",
+		SeccompProfileType: "RuntimeDefault",
+		RunAsNonRoot:       &nonRoot,
+		DropCapabilities:   []string{"ALL", "NET_RAW"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "gvisor", merged.RuntimeClassName)
+	assert.Equal(t, "RuntimeDefault", merged.SeccompProfileType)
+	assert.True(t, *merged.RunAsNonRoot)
+	assert.Equal(t, []string{"ALL", "NET_RAW"}, merged.DropCapabilities)
+	// The cluster-wide policy is not modified.
+	assert.Equal(t, []string{"ALL"}, cluster.DropCapabilities)
+
+	t.Run("does not relax the cluster-wide policy", func(t *testing.T) {
+		_, err := MergeSecurityPolicies(cluster, &v1.IntegrationSecurityPolicySpec{RuntimeClassName: "kata"})
+		assert.ErrorContains(t, err, `runtime class "kata"`)
+
+		seccomp := &v1.IntegrationSecurityPolicySpec{SeccompProfileType: "RuntimeDefault"}
+		_, err = MergeSecurityPolicies(seccomp, &v1.IntegrationSecurityPolicySpec{SeccompProfileType: "Unconfined"})
+		assert.ErrorContains(t, err, `seccomp profile type "Unconfined"`)
+
+		nonRootCluster := &v1.IntegrationSecurityPolicySpec{RunAsNonRoot: &nonRoot}
+		_, err = MergeSecurityPolicies(nonRootCluster, &v1.IntegrationSecurityPolicySpec{RunAsNonRoot: &root})
+		assert.ErrorContains(t, err, "run as root")
+	})
+
+	t.Run("tightens the cluster-wide policy", func(t *testing.T) {
+		merged, err := MergeSecurityPolicies(&v1.IntegrationSecurityPolicySpec{RunAsNonRoot: &root}, &v1.IntegrationSecurityPolicySpec{RunAsNonRoot: &nonRoot})
+		require.NoError(t, err)
+		assert.True(t, *merged.RunAsNonRoot)
+
+		merged, err = MergeSecurityPolicies(&v1.IntegrationSecurityPolicySpec{RunAsNonRoot: &nonRoot}, &v1.IntegrationSecurityPolicySpec{RuntimeClassName: "kata"})
+		require.NoError(t, err)
+		assert.Equal(t, "kata", merged.RuntimeClassName)
+		assert.True(t, *merged.RunAsNonRoot)
+	})
+
+	cluster.AllowedImages = []string{`^gcr\.io/`}
+	merged, err = MergeSecurityPolicies(cluster, &v1.IntegrationSecurityPolicySpec{AllowedImages: []string{`^us-docker\.pkg\.dev/team/`}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`^gcr\.io/`}, merged.AllowedImages, "the allowed images of the integration do not replace the cluster-wide ones")
+}
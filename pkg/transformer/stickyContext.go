@@ -0,0 +1,49 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// stickyContextField is the status field of a resource that keeps the values
+// of its sticky context requests, by request name.
+const stickyContextField = "stickyContext"
+
+// stickyContext returns the value of the sticky context request name that was
+// stored in the status of resource for its current generation.
+func stickyContext(resource *unstructured.Unstructured, name string) (any, bool) {
+	stored, found, err := unstructured.NestedMap(resource.Object, "status", stickyContextField, name)
+	if err != nil || !found {
+		return nil, false
+	}
+	generation, ok := stored["generation"].(int64)
+	if !ok || generation != resource.GetGeneration() {
+		return nil, false
+	}
+	encoded, ok := stored["value"].(string)
+	if !ok {
+		return nil, false
+	}
+	var value any
+	if err := json.Unmarshal([]byte(encoded), &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// setStickyContext stores value as the value of the sticky context request
+// name for the current generation of resource. The controller writes it with
+// the rest of the status. The value is stored encoded, so that any JSON value
+// fits regardless of the status schema of the kind.
+func setStickyContext(resource *unstructured.Unstructured, name string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("context %s: cannot store the sticky value: %w", name, err)
+	}
+	return unstructured.SetNestedMap(resource.Object, map[string]interface{}{
+		"generation": resource.GetGeneration(),
+		"value":      string(encoded),
+	}, "status", stickyContextField, name)
+}
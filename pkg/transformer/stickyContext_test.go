@@ -0,0 +1,85 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestStickyContext(t *testing.T) {
+	calls := 0
+	reg := NewIntegrationRegistry()
+	reg.httpClient = &http.Client{Transport: &MockRoundTripper{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"accelerator": "nvidia-l4", "call": %d}`, calls))),
+		}, nil
+	}}}
+	reg.SetIntegrations([]modelv1.IntegrationSpec{{
+		Group: "model.skippy.io", Version: "v1", Kind: "Endpoint",
+		Context: []modelv1.IntegrationApiContextSpec{{
+			Name:    "recommendation",
+			Request: modelv1.IntegrationApiContextRequestSpec{Method: "GET", Path: "https://example.com/recommend"},
+			Sticky:  true,
+		}},
+	}})
+	resource := newTestObject("model.skippy.io", "v1", "Endpoint", "llama")
+	resource.SetGeneration(1)
+
+	resolve := func() any {
+		output := map[string]any{}
+		require.NoError(t, reg.ResolveContext(context.Background(), resource, output, false))
+		return output["recommendation"]
+	}
+
+	first := resolve()
+	assert.Equal(t, map[string]interface{}{"accelerator": "nvidia-l4", "call": float64(1)}, first)
+	stored, found, err := unstructured.NestedMap(resource.Object, "status", "stickyContext", "recommendation")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(1), stored["generation"])
+
+	// The stored value is reused for the same generation.
+	assert.Equal(t, first, resolve())
+	assert.Equal(t, 1, calls)
+
+	// A new generation requests it again.
+	resource.SetGeneration(2)
+	assert.Equal(t, map[string]interface{}{"accelerator": "nvidia-l4", "call": float64(2)}, resolve())
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, map[string]interface{}{"accelerator": "nvidia-l4", "call": float64(2)}, resolve())
+	assert.Equal(t, 2, calls)
+
+	// A reference reuses the stored value, and is not requested for.
+	output := map[string]any{}
+	require.NoError(t, reg.ResolveContext(context.Background(), resource, output, true))
+	assert.Equal(t, map[string]interface{}{"accelerator": "nvidia-l4", "call": float64(2)}, output["recommendation"])
+	resource.SetGeneration(3)
+	assert.ErrorContains(t, reg.ResolveContext(context.Background(), resource, map[string]any{}, true), "no sticky value")
+	assert.Equal(t, 2, calls)
+}
+
+func TestStickyContextIgnoresMalformedValues(t *testing.T) {
+	resource := newTestObject("model.skippy.io", "v1", "Endpoint", "llama")
+	require.NoError(t, unstructured.SetNestedMap(resource.Object, map[string]interface{}{
+		"generation": int64(0),
+		"value":      "{not json",
+	}, "status", "stickyContext", "recommendation"))
+	_, ok := stickyContext(resource, "recommendation")
+	assert.False(t, ok)
+
+	require.NoError(t, setStickyContext(resource, "recommendation", []interface{}{"a"}))
+	value, ok := stickyContext(resource, "recommendation")
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{"a"}, value)
+}
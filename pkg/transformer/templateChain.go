@@ -0,0 +1,116 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// TemplateChain is .chain in the template context: the resources of a
+// render whose template bundles were rendered before the current resource,
+// in order, e.g. the AgenticSandboxClass before the AgenticSandbox that
+// references it. It is nil before the first one, so that {{ if .chain }}
+// is false. Printed, it is the path of the last bundle, which the embedded
+// kustomizations add as a resource.
+type TemplateChain struct {
+	Links []*ChainLink
+}
+
+// ChainLink is a resource in the TemplateChain.
+type ChainLink struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Path is the directory of its last template bundle, relative to the
+	// render root.
+	Path string
+	// Files are the resource files rendered for it, relative to the render
+	// root.
+	Files []string
+	// Objects are the objects in Files, keyed by kind and name, e.g.
+	// "Service/llama", as rendered: before kustomize and the naming policy.
+	Objects map[string]interface{}
+}
+
+func (c *TemplateChain) String() string {
+	if last := c.Last(); last != nil {
+		return last.Path
+	}
+	return ""
+}
+
+// Last returns the resource rendered right before the current one, or nil.
+func (c *TemplateChain) Last() *ChainLink {
+	if c == nil || len(c.Links) == 0 {
+		return nil
+	}
+	return c.Links[len(c.Links)-1]
+}
+
+// Get returns the resource of kind and name in the chain, or nil.
+func (c *TemplateChain) Get(kind, name string) *ChainLink {
+	if c == nil {
+		return nil
+	}
+	for i := len(c.Links) - 1; i >= 0; i-- {
+		if c.Links[i].Kind == kind && c.Links[i].Name == name {
+			return c.Links[i]
+		}
+	}
+	return nil
+}
+
+// Object returns the object of kind and name that the latest resource in the
+// chain rendered, e.g. {{ (.chain.Object "Service" "llama").spec.ports }},
+// or nil.
+func (c *TemplateChain) Object(kind, name string) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	for i := len(c.Links) - 1; i >= 0; i-- {
+		if obj := c.Links[i].Object(kind, name); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+// Object returns the object of kind and name that the resource rendered, or
+// nil.
+func (l *ChainLink) Object(kind, name string) map[string]interface{} {
+	if l == nil {
+		return nil
+	}
+	obj, _ := l.Objects[kind+"/"+name].(map[string]interface{})
+	return obj
+}
+
+// add returns the chain with link appended. Chains are copied rather than
+// changed, as the contexts of earlier resources hold them.
+func (c *TemplateChain) add(link *ChainLink) *TemplateChain {
+	chain := &TemplateChain{}
+	if c != nil {
+		chain.Links = append(chain.Links, c.Links...)
+	}
+	chain.Links = append(chain.Links, link)
+	return chain
+}
+
+// renderedObjects reads the objects of rendered files, keyed by kind and name.
+// The directories of bundles and files that are not valid YAML are skipped.
+func renderedObjects(root string, files []string) map[string]interface{} {
+	objects := map[string]interface{}{}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			continue
+		}
+		objs, err := decodeObjects(data)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objs {
+			objects[obj.GetKind()+"/"+obj.GetName()] = obj.Object
+		}
+	}
+	return objects
+}
@@ -0,0 +1,95 @@
+package transformer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestTemplateChain(t *testing.T) {
+	var chain *TemplateChain
+	assert.Equal(t, "", chain.String())
+	assert.Nil(t, chain.Last())
+	assert.Nil(t, chain.Get("Agent", "planner"))
+	assert.Nil(t, chain.Object("Service", "planner"))
+
+	service := map[string]interface{}{"kind": "Service", "metadata": map[string]interface{}{"name": "planner"}}
+	first := chain.add(&ChainLink{Kind: "Agent", Name: "planner", Path: "serving/planner/agent", Objects: map[string]interface{}{"Service/planner": service}})
+	second := first.add(&ChainLink{Kind: "Endpoint", Name: "llama", Path: "serving/llama/endpoint"})
+	assert.Len(t, first.Links, 1, "adding to a chain leaves it as it is")
+	assert.Equal(t, "serving/llama/endpoint", second.String())
+	assert.Equal(t, "Endpoint", second.Last().Kind)
+	assert.Equal(t, "serving/planner/agent", second.Get("Agent", "planner").Path)
+	assert.Nil(t, second.Get("Agent", "llama"))
+	assert.Equal(t, service, second.Object("Service", "planner"))
+	assert.Nil(t, second.Get("Endpoint", "llama").Object("Service", "planner"))
+}
+
+func TestRenderTemplateChain(t *testing.T) {
+	ctx := context.Background()
+	endpointGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	agentGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}
+	sourceFs := filesys.MakeFsInMemory()
+	for file, content := range map[string]string{
+		"agent/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .resource.metadata.name }}\nspec:\n  ports:\n  - port: 8080\n{{- if .chain }}\n  clusterIP: None\n{{- end }}\n",
+		"endpoint/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .resource.metadata.name }}
+data:
+  chain: {{ .chain }}
+  agent: {{ (.chain.Get "Agent" "planner").Path }}
+  port: "{{ (index (.chain.Object "Service" "planner").spec.ports 0).port }}"
+`,
+		"v1/apply/apply.yaml": "resources:\n{{- range . }}\n- {{ . }}\n{{- end }}\n",
+	} {
+		require.NoError(t, sourceFs.WriteFile(file, []byte(content)))
+	}
+	transformer := NewTransformer()
+	transformer.SetRenderDir(t.TempDir())
+	transformer.registry = &mockRegistry{
+		integrations: []schema.GroupVersionKind{endpointGVK, agentGVK},
+		templatePaths: map[schema.GroupVersionKind][]string{
+			endpointGVK: {"embedded:/endpoint"},
+			agentGVK:    {"embedded:/agent"},
+		},
+		refPaths: map[schema.GroupVersionKind][]modelv1.IntegrationApiReferenceSpec{
+			endpointGVK: {{Group: agentGVK.Group, Version: agentGVK.Version, Kind: agentGVK.Kind, PropagateTemplates: true}},
+		},
+	}
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		return sourceFs, filepath.FromSlash(strings.TrimPrefix(path, "embedded:/")), nil
+	}
+
+	endpoint := newTestObject(endpointGVK.Group, endpointGVK.Version, endpointGVK.Kind, "llama")
+	endpoint.SetNamespace("serving")
+	endpoint.SetUID("endpoint-uid")
+	agent := newTestObject(agentGVK.Group, agentGVK.Version, agentGVK.Kind, "planner")
+	agent.SetNamespace("serving")
+	agent.SetUID("agent-uid")
+	inputs := &modelv1.RenderInputs{Primary: endpoint, Resources: []*unstructured.Unstructured{agent, endpoint}}
+	renderContext, err := transformer.ResolveContext(ctx, inputs, modelv1.ResolveOptions{})
+	require.NoError(t, err)
+	files, err := transformer.Render(ctx, inputs, renderContext, modelv1.RenderOptions{})
+	require.NoError(t, err)
+	defer files.Cleanup()
+
+	// The Agent is rendered first, with an empty chain.
+	service, err := os.ReadFile(filepath.Join(files.Root, "serving/planner/agent/service.yaml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(service), "clusterIP")
+
+	configMap, err := os.ReadFile(filepath.Join(files.Root, "serving/llama/endpoint/configmap.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(configMap), "  chain: serving/planner/agent\n  agent: serving/planner/agent\n  port: \"8080\"\n")
+}
@@ -0,0 +1,138 @@
+package transformer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// TemplateKinds returns the kinds of the objects that the bundle at
+// templatePath renders, read from the top-level apiVersion and kind fields of
+// its files. Fields whose value is templated, and objects that template
+// functions such as autoscalerFor render, are not found.
+func TemplateKinds(ctx context.Context, templatePath string) ([]schema.GroupVersionKind, error) {
+	fSys, root, err := fileSystemForPath(ctx, templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get file system for path %q: %v", templatePath, err)
+	}
+	return templateKinds(fSys, root)
+}
+
+// IntegrationKinds returns the kinds of the objects that the template bundles
+// of spec render, see TemplateKinds. Bundles on GCS are read with the storage
+// settings of spec. Overlays are skipped, as they patch the objects of the
+// other bundles. The ConfigMaps and Secrets of generators are found when the
+// integration enables them.
+func (t *Transformer) IntegrationKinds(ctx context.Context, c client.Client, spec v1.IntegrationSpec) ([]schema.GroupVersionKind, error) {
+	found := map[schema.GroupVersionKind]bool{}
+	var kinds []schema.GroupVersionKind
+	for _, template := range spec.Templates {
+		if template.Operation == "overlay" {
+			continue
+		}
+		fSys, root, err := t.fileSystemForStorage(ctx, c, spec.Storage, template.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get file system for path %q: %v", redactString(template.Path), err)
+		}
+		bundleKinds, err := templateKinds(fSys, root)
+		if err != nil {
+			return nil, err
+		}
+		if template.Operation == "template" && spec.Kustomize != nil && spec.Kustomize.Generators {
+			bundleKinds = append(bundleKinds, generatorKinds(fSys, root)...)
+		}
+		for _, gvk := range bundleKinds {
+			if !found[gvk] {
+				found[gvk] = true
+				kinds = append(kinds, gvk)
+			}
+		}
+	}
+	return kinds, nil
+}
+
+// templateKinds returns the kinds of the objects in the files under root,
+// skipping kustomizations.
+func templateKinds(fSys filesys.FileSystem, root string) ([]schema.GroupVersionKind, error) {
+	found := map[schema.GroupVersionKind]bool{}
+	err := fSys.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		baseName := filepath.Base(path)
+		if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
+			return nil
+		}
+		data, err := fSys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, gvk := range documentKinds(data) {
+			found[gvk] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking path %q: %v", root, err)
+	}
+
+	kinds := make([]schema.GroupVersionKind, 0, len(found))
+	for gvk := range found {
+		kinds = append(kinds, gvk)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].String() < kinds[j].String()
+	})
+	return kinds, nil
+}
+
+// documentKinds returns the kinds of the YAML documents in data that set a
+// literal apiVersion and kind.
+func documentKinds(data []byte) []schema.GroupVersionKind {
+	var kinds []schema.GroupVersionKind
+	var apiVersion, kind string
+	flush := func() {
+		if apiVersion != "" && kind != "" {
+			if gv, err := schema.ParseGroupVersion(apiVersion); err == nil {
+				kinds = append(kinds, gv.WithKind(kind))
+			}
+		}
+		apiVersion, kind = "", ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.Contains(value, "{{") {
+			continue
+		}
+		value, _, _ = strings.Cut(value, " #")
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch key {
+		case "apiVersion":
+			apiVersion = value
+		case "kind":
+			kind = value
+		}
+	}
+	flush()
+	return kinds
+}
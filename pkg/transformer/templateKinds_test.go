@@ -0,0 +1,89 @@
+package transformer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestDocumentKinds(t *testing.T) {
+	kinds := documentKinds([]byte(`# A comment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .resource.metadata.name }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: server
+        kind: ignored
+---
+apiVersion: v1
+kind: "Service" # exposes the server
+---
+apiVersion: {{ .values.apiVersion }}
+kind: Templated
+---
+apiVersion: monitoring.googleapis.com/v1
+kind: PodMonitoring
+`))
+	assert.Equal(t, []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Version: "v1", Kind: "Service"},
+		{Group: "monitoring.googleapis.com", Version: "v1", Kind: "PodMonitoring"},
+	}, kinds)
+}
+
+func TestTemplateKinds(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("bundle/kustomization.yaml", []byte("apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n")))
+	require.NoError(t, fSys.WriteFile("bundle/job.yaml", []byte("apiVersion: batch/v1\nkind: Job\n")))
+	require.NoError(t, fSys.WriteFile("bundle/nested/config.yaml", []byte("apiVersion: v1\nkind: ConfigMap\n---\napiVersion: batch/v1\nkind: Job\n")))
+
+	kinds, err := templateKinds(fSys, "bundle")
+	require.NoError(t, err)
+	assert.Equal(t, []schema.GroupVersionKind{
+		{Version: "v1", Kind: "ConfigMap"},
+		{Group: "batch", Version: "v1", Kind: "Job"},
+	}, kinds)
+
+	kinds, err = TemplateKinds(context.Background(), "embedded:/v1/agent/template")
+	require.NoError(t, err)
+	assert.Equal(t, []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Service"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	}, kinds)
+}
+
+func TestIntegrationKinds(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	require.NoError(t, fSys.WriteFile("base/job.yaml", []byte("apiVersion: batch/v1\nkind: Job\n")))
+	require.NoError(t, fSys.WriteFile("extra/config.yaml", []byte("apiVersion: v1\nkind: ConfigMap\n---\napiVersion: batch/v1\nkind: Job\n")))
+	require.NoError(t, fSys.WriteFile("prod/hpa.yaml", []byte("apiVersion: autoscaling/v2\nkind: HorizontalPodAutoscaler\n")))
+
+	transformer := &Transformer{
+		fsProviderFunc: func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+			return fSys, strings.TrimPrefix(path, "embedded:/"), nil
+		},
+	}
+	kinds, err := transformer.IntegrationKinds(context.Background(), nil, v1.IntegrationSpec{
+		Templates: []v1.IntegrationApiTemplatesSpec{
+			{Operation: "template", Path: "embedded:/base"},
+			{Operation: "template", Path: "embedded:/extra"},
+			{Operation: "overlay", Path: "embedded:/prod", Environment: "prod"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []schema.GroupVersionKind{
+		{Group: "batch", Version: "v1", Kind: "Job"},
+		{Version: "v1", Kind: "ConfigMap"},
+	}, kinds)
+}
@@ -0,0 +1,29 @@
+package transformer
+
+import (
+	"fmt"
+	"path"
+)
+
+// TemplateSelector returns whether a template path of a referenced resource
+// is propagated under the propagateTemplatePaths patterns of its reference
+// rule: it matches one of them, with the syntax of path.Match, or there are
+// none. It fails if a pattern is malformed.
+func TemplateSelector(patterns []string) (func(templatePath string) bool, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid propagateTemplatePaths pattern %q: %w", pattern, err)
+		}
+	}
+	return func(templatePath string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, templatePath); matched {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,86 @@
+package transformer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestTemplateSelector(t *testing.T) {
+	selected, err := TemplateSelector(nil)
+	require.NoError(t, err)
+	assert.True(t, selected("embedded:/v1/agent/deployment"))
+
+	selected, err = TemplateSelector([]string{"embedded:/v1/*/monitoring", "gcs:/bucket/agent/alerts"})
+	require.NoError(t, err)
+	assert.True(t, selected("embedded:/v1/agent/monitoring"))
+	assert.True(t, selected("gcs:/bucket/agent/alerts"))
+	assert.False(t, selected("embedded:/v1/agent/deployment"))
+	assert.False(t, selected("embedded:/v1/agent/monitoring/extra"))
+
+	_, err = TemplateSelector([]string{"embedded:/v1/[monitoring"})
+	assert.EqualError(t, err, `invalid propagateTemplatePaths pattern "embedded:/v1/[monitoring": syntax error in pattern`)
+}
+
+func TestRenderPropagatedTemplatePaths(t *testing.T) {
+	ctx := context.Background()
+	endpointGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Endpoint"}
+	agentGVK := schema.GroupVersionKind{Group: "model.skippy.io", Version: "v1", Kind: "Agent"}
+	sourceFs := filesys.MakeFsInMemory()
+	for file, content := range map[string]string{
+		"endpoint/service.yaml":         "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .resource.metadata.name }}\n",
+		"agent/deployment.yaml":         "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: {{ .resource.metadata.name }}\n",
+		"monitoring/podmonitoring.yaml": "apiVersion: monitoring.googleapis.com/v1\nkind: PodMonitoring\nmetadata:\n  name: {{ .resource.metadata.name }}\n",
+		"v1/apply/apply.yaml":           "resources:\n{{- range . }}\n- {{ . }}\n{{- end }}\n",
+	} {
+		require.NoError(t, sourceFs.WriteFile(file, []byte(content)))
+	}
+	transformer := NewTransformer()
+	transformer.SetRenderDir(t.TempDir())
+	registry := &mockRegistry{
+		integrations: []schema.GroupVersionKind{endpointGVK, agentGVK},
+		templatePaths: map[schema.GroupVersionKind][]string{
+			endpointGVK: {"embedded:/endpoint"},
+			agentGVK:    {"embedded:/agent", "embedded:/monitoring"},
+		},
+		refPaths: map[schema.GroupVersionKind][]modelv1.IntegrationApiReferenceSpec{
+			endpointGVK: {{Group: agentGVK.Group, Version: agentGVK.Version, Kind: agentGVK.Kind, PropagateTemplates: true, PropagateTemplatePaths: []string{"embedded:/monitoring"}}},
+		},
+	}
+	transformer.registry = registry
+	transformer.fsProviderFunc = func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		return sourceFs, filepath.FromSlash(strings.TrimPrefix(path, "embedded:/")), nil
+	}
+
+	endpoint := newTestObject(endpointGVK.Group, endpointGVK.Version, endpointGVK.Kind, "llama")
+	endpoint.SetNamespace("serving")
+	endpoint.SetUID("endpoint-uid")
+	agent := newTestObject(agentGVK.Group, agentGVK.Version, agentGVK.Kind, "planner")
+	agent.SetNamespace("serving")
+	agent.SetUID("agent-uid")
+	inputs := &modelv1.RenderInputs{Primary: endpoint, Resources: []*unstructured.Unstructured{endpoint, agent}}
+	render := func() []string {
+		renderContext, err := transformer.ResolveContext(ctx, inputs, modelv1.ResolveOptions{})
+		require.NoError(t, err)
+		files, err := transformer.Render(ctx, inputs, renderContext, modelv1.RenderOptions{})
+		require.NoError(t, err)
+		defer files.Cleanup()
+		return files.Resources
+	}
+
+	// Only the monitoring templates of the referenced Agent are propagated.
+	assert.Equal(t, []string{"serving/llama/endpoint/service.yaml", "serving/planner/monitoring/podmonitoring.yaml"}, render())
+
+	// Without a selector, all of them are.
+	registry.refPaths[endpointGVK][0].PropagateTemplatePaths = nil
+	assert.Equal(t, []string{"serving/llama/endpoint/service.yaml", "serving/planner/agent/deployment.yaml", "serving/planner/monitoring/podmonitoring.yaml"}, render())
+}
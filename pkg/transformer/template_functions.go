@@ -8,9 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -145,42 +143,24 @@ func extractStringAfterSlash(input string) (string, error) {
 	return input[lastSlashIndex+1:], nil
 }
 
-// resolveModelData now gets the result by reading the status of the ModelData CR.
-// This is the "consumer" side of the final architecture.
+// resolveModelData waits for the ModelData to succeed, and returns the
+// --model argument and the GCS path of its synced model.
 func resolveModelData(
+	ctx context.Context,
 	dynClient dynamic.Interface,
 	mapper meta.RESTMapper,
 	namespace, modelDataName string,
 ) (map[string]string, error) {
-	// 1. Get the ModelData CR object using the dynamic client
-	modelDataGVK := schema.GroupKind{Group: "model.skippy.io", Kind: "ModelData"}
-	gvr, err := mapper.RESTMapping(modelDataGVK)
+	modelDataCR, err := waitFor(ctx, dynClient, mapper, namespace, "ModelData.model.skippy.io", modelDataName, "{.status.phase}", "Succeeded")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get mapping for ModelData GVK: %w", err)
-	}
-	modelDataCR, err := dynClient.Resource(gvr.Resource).Namespace(namespace).Get(context.Background(), modelDataName, metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			// The ModelData CR itself doesn't exist yet.
-			return nil, fmt.Errorf("waiting for ModelData resource %q to be created", modelDataName)
-		}
-		return nil, fmt.Errorf("failed to get referenced ModelData %q: %w", modelDataName, err)
-	}
-
-	// 2. Check the `.status.phase` field.
-	phase, found, _ := unstructured.NestedString(modelDataCR.Object, "status", "phase")
-	if !found || phase != "Succeeded" {
-		// The status is not yet "Succeeded". Return an error to trigger a requeue.
-		return nil, fmt.Errorf("waiting for ModelData %q to have phase 'Succeeded' (current phase: %q)", modelDataName, phase)
+		return nil, err
 	}
 
-	// 3. Success! The status is Succeeded. Read the final path from the status.
-	finalGCSPath, found, _ := unstructured.NestedString(modelDataCR.Object, "status", "finalGcsPath")
+	finalGCSPath, found, _ := unstructured.NestedString(modelDataCR, "status", "finalGcsPath")
 	if !found || finalGCSPath == "" {
 		return nil, fmt.Errorf("ModelData %q succeeded, but status.finalGcsPath is missing", modelDataName)
 	}
 
-	// 4. Build and return the final --model argument.
 	modelDir, _ := getGcsPathFromURI(finalGCSPath) // Use our robust helper
 	finalModelArg := fmt.Sprintf("--model=/data/%s", modelDir)
 
@@ -240,3 +220,14 @@ func findResource(resources map[string]interface{}, kind, name string) (map[stri
 
 	return resourceMap, nil
 }
+
+// apiAvailable reports whether the cluster serves the given group and kind. It
+// lets templates emit optional resources (e.g. CNI specific policies) only when
+// the corresponding CRD is installed.
+func apiAvailable(mapper meta.RESTMapper, group, kind string) bool {
+	if mapper == nil {
+		return false
+	}
+	_, err := mapper.RESTMapping(schema.GroupKind{Group: group, Kind: kind})
+	return err == nil
+}
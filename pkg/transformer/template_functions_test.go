@@ -3,16 +3,19 @@ package transformer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/go-logr/logr"
 	template "github.com/google/safetext/yamltemplate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
 func TestExtractValueAfterEquals(t *testing.T) {
@@ -247,7 +250,7 @@ func TestResolveModelData(t *testing.T) {
 			name:                "Waiting state - Phase is Syncing",
 			initialUnstructured: []*unstructured.Unstructured{makeFakeModelDataWithStatus(modelDataName, "Syncing", "")},
 			expectedResult:      nil, // On error, the result is nil
-			expectErrContains:   "to have phase 'Succeeded' (current phase: \"Syncing\")",
+			expectErrContains:   "waiting for {.status.phase} of ModelData.model.skippy.io default/test-model-data to be \"Succeeded\" (current value: \"Syncing\")",
 		},
 		{
 			name:                "Error state - Succeeded but path is missing",
@@ -272,7 +275,7 @@ func TestResolveModelData(t *testing.T) {
 
 			// ACT - The call now passes the fakeTypedClient, but it's not used in this version.
 			// This call signature matches the more complex version that checks Jobs/Pods.
-			result, err := resolveModelData(fakeDynClient, mockMapper, namespace, modelDataName)
+			result, err := resolveModelData(context.Background(), fakeDynClient, mockMapper, namespace, modelDataName)
 
 			// ASSERT
 			if tc.expectErrContains != "" {
@@ -346,3 +349,112 @@ func TestAcceleratorSelectionTemplateLogic(t *testing.T) {
 
 	t.Logf("Template successfully produced: %s", result)
 }
+
+func TestApiAvailable(t *testing.T) {
+	mapper := &mockRESTMapper{}
+	assert.True(t, apiAvailable(mapper, "model.skippy.io", "ModelData"))
+	assert.False(t, apiAvailable(mapper, "cilium.io", "CiliumNetworkPolicy"))
+	assert.False(t, apiAvailable(nil, "cilium.io", "CiliumNetworkPolicy"))
+}
+
+func TestSandboxNetworkPolicyTemplate(t *testing.T) {
+	ctx := context.Background()
+	sourceFS, err := newEmbeddedFileSystem()
+	require.NoError(t, err)
+
+	render := func(egressPolicy map[string]interface{}) string {
+		spec := map[string]interface{}{"className": "default"}
+		if egressPolicy != nil {
+			spec["egressPolicy"] = egressPolicy
+		}
+		context := map[string]any{
+			"resource": map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "my-sandbox", "namespace": "default"},
+				"spec":     spec,
+			},
+			"k8sMapper": &mockRESTMapper{},
+		}
+		targetFS := filesys.MakeFsInMemory()
+		require.NoError(t, templateFile(ctx, sourceFS, targetFS, "v1/sandbox/template/networkpolicy.yaml", "out.yaml", context, logr.Discard()))
+		out, err := targetFS.ReadFile("out.yaml")
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	// Without a policy, all egress except DNS is denied.
+	out := render(nil)
+	assert.Contains(t, out, "kind: NetworkPolicy")
+	assert.Contains(t, out, "k8s-app: kube-dns")
+	assert.NotContains(t, out, "ipBlock")
+
+	out = render(map[string]interface{}{
+		"allowDNS":       false,
+		"allowedCIDRs":   []interface{}{"10.0.0.0/8"},
+		"allowedPorts":   []interface{}{int64(443)},
+		"allowedDomains": []interface{}{"pypi.org"},
+	})
+	assert.NotContains(t, out, "kube-dns")
+	assert.Contains(t, out, "cidr: 10.0.0.0/8")
+	assert.Contains(t, out, "port: 443")
+	// The mock mapper does not serve Cilium, so no FQDN policy is generated.
+	assert.NotContains(t, out, "CiliumNetworkPolicy")
+}
+
+func TestSandboxWarmPoolTemplates(t *testing.T) {
+	ctx := context.Background()
+	sourceFS, err := newEmbeddedFileSystem()
+	require.NoError(t, err)
+
+	render := func(path string, context map[string]any) string {
+		targetFS := filesys.MakeFsInMemory()
+		require.NoError(t, templateFile(ctx, sourceFS, targetFS, path, "out.yaml", context, logr.Discard()))
+		out, err := targetFS.ReadFile("out.yaml")
+		require.NoError(t, err)
+		return string(out)
+	}
+	class := func(warmPool map[string]interface{}) map[string]interface{} {
+		spec := map[string]interface{}{"image": "sandbox:latest", "serverPort": int64(8888)}
+		if warmPool != nil {
+			spec["warmPool"] = warmPool
+		}
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "python"},
+			"spec":     spec,
+		}
+	}
+	sandboxContext := func(classObj map[string]interface{}) map[string]any {
+		return map[string]any{
+			"resource": map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "my-sandbox", "namespace": "agents"},
+				"spec":     map[string]interface{}{"className": "python"},
+			},
+			"resources": map[string]interface{}{"AgenticSandboxClass/python": classObj},
+		}
+	}
+
+	// Without a warm pool, the class renders nothing and sandboxes get their own Deployment.
+	out := render("v1/sandbox-class/template/warm-pool.yaml", map[string]any{"resource": class(nil)})
+	assert.Empty(t, strings.TrimSpace(out))
+	out = render("v1/sandbox/template/deployment.yaml", sandboxContext(class(nil)))
+	assert.Contains(t, out, "kind: Deployment")
+
+	pooled := class(map[string]interface{}{"size": int64(3), "namespace": "agents"})
+	out = render("v1/sandbox-class/template/warm-pool.yaml", map[string]any{"resource": pooled})
+	assert.Contains(t, out, "name: python-warm-pool")
+	assert.Contains(t, out, "namespace: agents")
+	assert.Contains(t, out, "replicas: 3")
+	assert.Contains(t, out, "sandbox.model.skippy.io/pool: python")
+	// Idle pool pods are denied egress but DNS until they are claimed.
+	assert.Contains(t, out, "kind: NetworkPolicy")
+	assert.Contains(t, out, "name: python-warm-pool-egress")
+	assert.Contains(t, out, "k8s-app: kube-dns")
+
+	// Sandboxes in the pool namespace claim a pool pod instead of creating a Deployment.
+	out = render("v1/sandbox/template/deployment.yaml", sandboxContext(pooled))
+	assert.Empty(t, strings.TrimSpace(out))
+
+	// Sandboxes in other namespaces cannot use the pool and fall back to a Deployment.
+	elsewhere := class(map[string]interface{}{"size": int64(3)})
+	out = render("v1/sandbox/template/deployment.yaml", sandboxContext(elsewhere))
+	assert.Contains(t, out, "kind: Deployment")
+}
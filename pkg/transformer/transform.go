@@ -5,10 +5,8 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"io/fs"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -17,8 +15,11 @@ import (
 
 	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 
-	"cloud.google.com/go/storage"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -27,16 +28,19 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/kustomize/api/krusty"
-	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
 const (
+	// targetRootPath is the default directory under which templates are
+	// rendered, see newRenderDir.
 	targetRootPath = "tmp"
 )
 
 var (
+	// tracer is used to instrument the transform pipeline.
+	tracer = otel.Tracer("github.com/GoogleCloudPlatform/karo/pkg/transformer")
+
 	// This regex is still good for parsing a GCS URI.
 	gcsRegex = regexp.MustCompile(`^\s*gs://(?P<bucket>[^/]+)/(?P<path>[^\s]+)\s*$`)
 )
@@ -58,6 +62,39 @@ type Transformer struct {
 
 	// You already have this one from objectFinder tests
 	populateInstanceCacheFunc func(context.Context, discovery.DiscoveryInterface, dynamic.Interface) (map[schema.GroupVersionKind]map[string]*unstructured.Unstructured, error)
+
+	// securityPolicy is the cluster-wide pod security policy applied to every generated pod spec.
+	securityPolicy *v1.IntegrationSecurityPolicySpec
+
+	// mutators are applied to every rendered object, see RegisterMutator.
+	mutators []namedMutator
+
+	// clusterDefaults fill in the placement of generated pods, see SetClusterDefaults.
+	clusterDefaults clusterDefaults
+	// clusterInfo is the cluster metadata of .cluster, see SetClusterInfo.
+	clusterInfo clusterInfo
+
+	// renderCache skips kustomize when the render input is unchanged.
+	renderCache renderCache
+
+	// configChecksums annotates Deployments with the checksum of their
+	// configuration, see SetConfigChecksums.
+	configChecksums bool
+
+	// logRenderedManifests logs rendered objects in full, see SetLogRenderedManifests.
+	logRenderedManifests bool
+
+	// renderDir overrides targetRootPath, e.g. in tests.
+	renderDir string
+
+	// namespaces restricts the search for references, see SetNamespaces.
+	namespaces []string
+
+	// imageResolver pins images to digests, see SetImageResolver.
+	imageResolver *ImageResolver
+
+	// signatureVerifier verifies image signatures, see SetImageSignatureVerifier.
+	signatureVerifier *ImageResolver
 }
 
 func NewTransformer() *Transformer {
@@ -71,244 +108,90 @@ func (t *Transformer) Registry() v1.RegistryInterface {
 }
 
 func (t *Transformer) Run(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, rClient client.Client, req ctrl.Request, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	ctx, span := tracer.Start(ctx, "Transformer.Run", trace.WithAttributes(
+		attribute.String("k8s.namespace", req.Namespace),
+		attribute.String("k8s.name", req.Name),
+		attribute.String("k8s.gvk", obj.GroupVersionKind().String()),
+	))
+	defer span.End()
+
+	result, err := t.run(ctx, discoveryClient, dynamicClient, mapper, rClient, req, obj)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("karo.rendered_objects", len(result)))
+	return result, err
+}
+
+func (t *Transformer) run(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, rClient client.Client, req ctrl.Request, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
 	objGVK := obj.GetObjectKind().GroupVersionKind()
 	log := log.FromContext(ctx).WithValues("namespace", req.Namespace, "name", req.Name, "entity", objGVK.String())
 
-	if !t.registry.HasIntegration(objGVK) {
-		log.Error(nil, "missing integration")
-		return nil, fmt.Errorf("missing integration for %s", objGVK.String())
-	}
-
-	findFunc := t.findConnectedResourcesFunc
-	if findFunc == nil {
-		findFunc = t.findConnectedResources
-	}
-	referenced, referencing, err := findFunc(ctx, discoveryClient, dynamicClient, obj)
+	inputs, err := t.DiscoverInputs(ctx, obj, v1.DiscoverOptions{DiscoveryClient: discoveryClient, DynamicClient: dynamicClient})
 	if err != nil {
-		return nil, fmt.Errorf("cannot find connected resources: %v", err)
+		return nil, err
 	}
-	accumulator := []*unstructured.Unstructured{obj}
-	accumulator = append(accumulator, referenced...)
-	accumulator = append(accumulator, referencing...)
-
-	sortFunc := t.topologicalSortFunc
-	if sortFunc == nil {
-		sortFunc = t.topologicalSort
+	renderContext, err := t.ResolveContext(ctx, inputs, v1.ResolveOptions{DynamicClient: dynamicClient, Mapper: mapper, Client: rClient})
+	if err != nil {
+		return nil, err
 	}
-	sortedAccumulator, err := sortFunc(accumulator)
+	files, err := t.Render(ctx, inputs, renderContext, v1.RenderOptions{Client: rClient})
 	if err != nil {
-		return nil, fmt.Errorf("cannot sort resources: %v", err)
+		return nil, err
 	}
+	defer files.Cleanup()
 
-	// 1. Build a map of all discovered resources, keyed for easy access in the template.
-	//    (This assumes names are unique across kinds in the accumulator, or use a more complex key).
-	resourceMap := make(map[string]interface{})
-	for _, res := range sortedAccumulator {
-		// We can key by kind and name for easy lookup.
-		key := fmt.Sprintf("%s/%s", res.GetKind(), res.GetName())
-		log.Info("Adding resource to map", "key", key, "kind", res.GetKind(), "name", res.GetName())
-		resourceMap[key] = res.Object
+	if files.Root == "" {
+		log.Info("No resource files were generated, skipping kustomization. Reconciliation complete.")
+		return append([]*unstructured.Unstructured{}, files.Patches...), nil
 	}
 
-	targetFS := filesys.MakeFsOnDisk()
-	if err := targetFS.MkdirAll(targetRootPath); err != nil {
-		return nil, fmt.Errorf("unable to create directory at %q: %v", targetRootPath, err)
+	integrationSpec, _ := t.registry.GetIntegrationSpec(objGVK)
+	integrationPolicy := integrationSpec.SecurityPolicy
+	securityPolicy, err := MergeSecurityPolicies(t.securityPolicy, integrationPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security policy of %s: %w", objGVK.Kind, err)
 	}
+	commonLabels, commonAnnotations := integrationSpec.CommonLabels, integrationSpec.CommonAnnotations
 
-	var resourceFiles []string // Will collect full relative paths to generated files.
-	var lastTemplateChain string
-
-	context := map[string]any{
-		"root":           targetRootPath,
-		"chain":          "",
-		"resource":       nil,
-		"resources":      resourceMap,
-		"k8sClient":      dynamicClient,
-		"k8sMapper":      mapper,
-		"k8sTypedClient": rClient,
+	targetFS := filesys.MakeFsOnDisk()
+	inputHash, err := renderInputHash(targetFS, files.Root, files.Files, securityPolicy, commonLabels, commonAnnotations, t.clusterDefaultsFor(objGVK), t.configChecksums)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash render input: %v", err)
 	}
-	for _, resource := range sortedAccumulator {
-		context["chain"] = lastTemplateChain
-		context["resource"] = resource.UnstructuredContent()
-		targetRelativePath := filepath.Join(resource.GetNamespace(), resource.GetName())
-		targetObjectPath := filepath.Join(targetRootPath, targetRelativePath)
-
-		if err := t.registry.ResolveContext(ctx, resource, context); err != nil {
-			return nil, fmt.Errorf("unable to resolve context for resource %v: %v", resource.GroupVersionKind().String(), err)
-		}
-
-		shouldExecuteTemplates := false
-
-		// Condition A: Always execute templates for the primary resource that triggered the reconciliation.
-		if resource.GetUID() == obj.GetUID() {
-			shouldExecuteTemplates = true
-		} else {
-			// Condition B: It's a referenced resource. Check if we should propagate its templates.
-			// We look at the integration rules for the PRIMARY object (`obj`).
-			for _, refRule := range t.registry.GetReferenceRules(obj.GroupVersionKind()) {
-				// Find the rule that matches the current resource in the loop
-				if refRule.Group == resource.GroupVersionKind().Group && refRule.Kind == resource.GetKind() {
-					// Check our new flag!
-					if refRule.PropagateTemplates {
-						shouldExecuteTemplates = true
-						break
-					}
-				}
+	if cached, ok := t.renderCache.get(obj.GetUID(), inputHash); ok {
+		log.Info("Render input is unchanged, reusing the rendered objects", "hash", inputHash)
+		// Digests are resolved on every render, so that retags are noticed,
+		// and the signatures of retagged images are verified again.
+		verified := map[string]string{}
+		for _, cachedObj := range cached {
+			if err := t.checkImagePolicy(ctx, cachedObj, verified, t.securityPolicy, integrationPolicy); err != nil {
+				return nil, err
 			}
 		}
-
-		if !shouldExecuteTemplates {
-			log.Info("Skipping template execution for read-only reference", "kind", resource.GetKind(), "name", resource.GetName())
-			continue // Skip to the next resource in the accumulator
-		}
-
-		log.Info("Executing templates for resource", "kind", resource.GetKind(), "name", resource.GetName())
-
-		// Handle pure copy operations.
-		for _, copyPath := range t.registry.GetCopyPaths(resource.GroupVersionKind()) {
-			fsProvider := t.fsProviderFunc
-			if fsProvider == nil {
-				fsProvider = fileSystemForPath
-			}
-			sourceFS, rootPath, err := fsProvider(ctx, copyPath)
-			if err != nil {
-				return nil, fmt.Errorf("unable to get file system for path %q: %v", copyPath, err)
-			}
-
-			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if info.IsDir() {
-					return nil
-				}
-
-				baseName := filepath.Base(sourcePath)
-				if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
-					return nil
-				}
-
-				targetPath := path.Join(targetObjectPath, sourcePath)
-				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
-					return err
-				}
-
-				// We collect copied files as well, assuming they are valid YAML manifests.
-				resourceFiles = append(resourceFiles, path.Join(targetRelativePath, sourcePath))
-				return copyFile(sourceFS, targetFS, sourcePath, targetPath, ctx)
-			})
-			if err != nil {
-				return nil, fmt.Errorf("error walking path %q: %v", copyPath, err)
-			}
-		}
-
-		// Handle template operations.
-		for _, templatePath := range t.registry.GetTemplatePaths(resource.GroupVersionKind()) {
-			fsProvider := t.fsProviderFunc
-			if fsProvider == nil {
-				fsProvider = fileSystemForPath
-			}
-			sourceFS, rootPath, err := fsProvider(ctx, templatePath)
-			if err != nil {
-				return nil, fmt.Errorf("unable to get file system for path %q: %v", templatePath, err)
-			}
-
-			err = sourceFS.Walk(rootPath, func(sourcePath string, info fs.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if info.IsDir() {
-					return nil
-				}
-
-				baseName := filepath.Base(sourcePath)
-				if baseName == "kustomization.yaml" || baseName == "kustomization.yml" || baseName == "Kustomization" {
-					return nil
-				}
-
-				targetPath := path.Join(targetObjectPath, sourcePath)
-				if err := targetFS.MkdirAll(path.Dir(targetPath)); err != nil {
-					return err
-				}
-
-				// Construct the relative path from the kustomization root (tmp) to the generated file.
-				relativeFilePath := path.Join(targetRelativePath, sourcePath)
-				resourceFiles = append(resourceFiles, relativeFilePath)
-
-				return templateFile(sourceFS, targetFS, sourcePath, targetPath, context, log)
-			})
-			if err != nil {
-				return nil, fmt.Errorf("error walking path %q: %v", templatePath, err)
-			}
-
-			lastTemplateChain = filepath.Join(targetRelativePath, rootPath)
+		if err := t.pinImageDigests(ctx, obj, cached, verified); err != nil {
+			return nil, err
 		}
+		// Patches are not cached, as their bundle settings are not hashed.
+		return append(cached, files.Patches...), nil
 	}
 
-	if len(resourceFiles) == 0 {
-		log.Info("No resource files were generated, skipping kustomization. Reconciliation complete.")
-		return []*unstructured.Unstructured{}, nil // Return an empty list and no error
-	}
-
-	// Create the apply kustomization.
-	fsProvider := t.fsProviderFunc
-	if fsProvider == nil {
-		fsProvider = fileSystemForPath
-	}
-	sourceFS, rootPath, err := fsProvider(ctx, "embedded:/v1/apply")
+	built, err := t.Kustomize(ctx, files)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get apply path: %v", err)
-	}
-
-	// Use the collected *file* paths to build the root kustomization.
-	if err := templateFile(sourceFS, targetFS, path.Join(rootPath, "apply.yaml"), path.Join(targetRootPath, "kustomization.yaml"), resourceFiles, log); err != nil {
-		return nil, fmt.Errorf("unable to create root kustomization: %v", err)
+		return nil, err
 	}
-
-	opts := &krusty.Options{
-		LoadRestrictions: types.LoadRestrictionsNone,
-		PluginConfig: types.MakePluginConfig(
-			types.PluginRestrictionsBuiltinsOnly, types.BploUseStaticallyLinked),
-	}
-
-	k := krusty.MakeKustomizer(opts)
-	resmap, err := k.Run(targetFS, targetRootPath)
+	result, verified, err := t.parse(ctx, obj, built)
 	if err != nil {
-		return nil, fmt.Errorf("cannot run kustomization: %v", err)
+		return nil, err
 	}
-
-	result := []*unstructured.Unstructured{}
-	for _, res := range resmap.Resources() {
-		fmt.Println(res.MustYaml())
-		data, err := res.Map()
-		if err != nil {
-			return nil, fmt.Errorf("unable to get resource data: %v", err)
-		}
-		u := &unstructured.Unstructured{}
-		u.SetUnstructuredContent(data)
-
-		// So what's happening is that the data key:value pair for Secret was something like this:
-		// data: hf_token:fasdlkfjasljf==
-		// Meaning it wasn't map already, you need to split the string
-		// TODO: find a better way to handle this
-		if u.GetKind() == "Secret" {
-			if dataValue, ok := u.Object["data"].(string); ok {
-				// Manually parse the data string (assuming single key-value pair for now)
-				parts := strings.SplitN(dataValue, ":", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					value := strings.TrimSpace(parts[1])
-					u.Object["data"] = map[string]interface{}{
-						key: value,
-					}
-				} else {
-					return nil, fmt.Errorf("failed to parse Secret data stringnname: %v, dataValue: %v", u.GetName(), dataValue)
-				}
-			}
-		}
-		result = append(result, u)
+	if err := t.renderCache.put(obj.GetUID(), inputHash, result); err != nil {
+		log.Error(err, "Failed to cache rendered objects")
+	}
+	if err := t.pinImageDigests(ctx, obj, result, verified); err != nil {
+		return nil, err
 	}
-	return result, nil
+	return append(result, files.Patches...), nil
 }
 
 func copyFile(sourceFS filesys.FileSystem, targetFS filesys.FileSystem, sourcePath string, targetPath string, ctx context.Context) error {
@@ -345,24 +228,42 @@ func copyFile(sourceFS filesys.FileSystem, targetFS filesys.FileSystem, sourcePa
 	return nil
 }
 
-func templateFile(sourceFS filesys.FileSystem, targetFS filesys.FileSystem, sourcePath string, targetPath string, context any, log logr.Logger) error {
+// RenderError is returned when a template cannot be parsed or executed, or
+// kustomize cannot build the rendered files. Unlike failures to read the
+// templates or to resolve their context, it is only fixed by changing the
+// templates or the resource they are rendered for.
+type RenderError struct {
+	// Path is the template or the kustomization root that failed.
+	Path string
+	Err  error
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+func templateFile(ctx context.Context, sourceFS filesys.FileSystem, targetFS filesys.FileSystem, sourcePath string, targetPath string, context any, log logr.Logger) error {
 	// Read the template and format the output to the target path.
 	buffer, err := sourceFS.ReadFile(sourcePath)
 	if err != nil {
 		log.Error(err, "Failed to read template file", "sourcePath", sourcePath)
 		return fmt.Errorf("failed to read template file %s: %w", sourcePath, err)
 	}
-	temp, err := template.New(targetPath).Funcs(allTemplateFuncs).Parse(string(buffer))
+	temp, err := template.New(targetPath).Funcs(allTemplateFuncs).Funcs(clusterTemplateFuncs(ctx)).Parse(string(buffer))
 
 	if err != nil {
 		log.Error(err, "Failed to parse template", "targetPath", targetPath)
-		return fmt.Errorf("failed to parse template %s: %w", targetPath, err)
+		return fmt.Errorf("failed to parse template %s: %w", targetPath, &RenderError{Path: sourcePath, Err: err})
 	}
 
 	output := &bytes.Buffer{}
 	if err := temp.Execute(output, context); err != nil {
 		log.Error(err, "Failed to execute template", "targetPath", targetPath)
-		return fmt.Errorf("failed to execute template %s: %w", targetPath, err)
+		return fmt.Errorf("failed to execute template %s: %w", targetPath, &RenderError{Path: sourcePath, Err: err})
 	}
 
 	target, err := targetFS.Create(targetPath)
@@ -388,7 +289,7 @@ func fileSystemForPathWithOptions(
 	embeddedFactory newEmbeddedFileSystemFunc,
 ) (filesys.FileSystem, string, error) {
 	u, err := url.Parse(path)
-	fmt.Println("[DEBUG] fileSystemForPath", path) //Add this log
+	log.FromContext(ctx).V(1).Info("Resolving template file system", "path", redactString(path))
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to parse URL %q: %v", path, err)
 	}
@@ -418,19 +319,46 @@ func fileSystemForPathWithOptions(
 	return nil, "", fmt.Errorf("could not find file system for scheme %q", u.Scheme)
 }
 
-// fileSystemForPath is a thin wrapper that provides the REAL dependencies.
-// The core logic has been moved to the testable function above.
-func fileSystemForPath(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+// SetFileSystemProvider makes the transformer read every template path,
+// including the embedded:/v1/apply kustomization, with provider rather than
+// from the embedded bundles and GCS, e.g. to render local bundles in tests.
+func (t *Transformer) SetFileSystemProvider(provider func(ctx context.Context, path string) (filesys.FileSystem, string, error)) {
+	t.fsProviderFunc = provider
+}
 
-	// This function contains the untestable call to storage.NewClient()
-	realGCSFactory := func(ctx context.Context, bucket, objectPath string) (filesys.FileSystem, error) {
-		client, err := storage.NewClient(ctx)
+// fileSystemFor returns the file system of a template path of the integration
+// for gvk, reading gcs: paths with the storage settings of the integration.
+// Bundles read from GCS are verified against their metadata.yaml on every
+// render, as the cached tree is refreshed when the bucket changes.
+func (t *Transformer) fileSystemFor(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, path string) (filesys.FileSystem, string, error) {
+	integrationSpec, _ := t.registry.GetIntegrationSpec(gvk)
+	fSys, root, _, err := t.verifiedFileSystem(ctx, c, gvk, integrationSpec.Storage, integrationSpec.Package, path)
+	return fSys, root, err
+}
+
+// fileSystemForStorage returns the file system of a template path, reading
+// gcs: paths with storageSpec.
+func (t *Transformer) fileSystemForStorage(ctx context.Context, c client.Client, storageSpec *v1.IntegrationStorageSpec, path string) (filesys.FileSystem, string, error) {
+	if t.fsProviderFunc != nil {
+		return t.fsProviderFunc(ctx, path)
+	}
+	gcsFactory := func(ctx context.Context, bucket, objectPath string) (filesys.FileSystem, error) {
+		source, err := gcsSourceFor(ctx, c, storageSpec, bucket)
 		if err != nil {
-			return nil, fmt.Errorf("unable to create storage client: %v", err)
+			return nil, err
 		}
-		return newGCSFileSystem(client, bucket, objectPath)
+		return defaultGCSTreeCache.fileSystem(ctx, source, bucket, objectPath)
 	}
+	return fileSystemForPathWithOptions(ctx, path, gcsFactory, newEmbeddedFileSystem)
+}
 
-	// The original function now just wires up the real dependencies.
-	return fileSystemForPathWithOptions(ctx, path, realGCSFactory, newEmbeddedFileSystem)
+// fileSystemForPath is a thin wrapper that provides the REAL dependencies.
+// The core logic has been moved to the testable function above.
+func fileSystemForPath(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+
+	// GCS template trees are cached across reconciles, see gcsTreeCache.
+	gcsFactory := func(ctx context.Context, bucket, objectPath string) (filesys.FileSystem, error) {
+		return defaultGCSTreeCache.fileSystem(ctx, gcsSource{}, bucket, objectPath)
+	}
+	return fileSystemForPathWithOptions(ctx, path, gcsFactory, newEmbeddedFileSystem)
 }
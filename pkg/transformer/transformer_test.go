@@ -3,11 +3,13 @@ package transformer
 import (
 	"bytes"
 	"context"
+	stderrors "errors"
 	"fmt"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/go-logr/logr"
 	template "github.com/google/safetext/yamltemplate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -117,6 +119,10 @@ resources:
 	transformer.topologicalSortFunc = func(resources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
 		return resources, nil
 	}
+	transformer.RegisterMutator("owner-label", MutatorFunc(func(_ context.Context, owner, obj *unstructured.Unstructured) error {
+		obj.SetLabels(map[string]string{"owner": owner.GetName()})
+		return nil
+	}))
 
 	// 5. Create fake Kubernetes clients
 	dynamicClient := fake.NewSimpleDynamicClient(scheme.Scheme, obj)
@@ -146,6 +152,7 @@ resources:
 	assert.Equal(t, "Deployment", deployment.GetKind())
 	assert.Equal(t, "test-resource-deployment", deployment.GetName())
 	assert.Equal(t, testNamespace, deployment.GetNamespace())
+	assert.Equal(t, map[string]string{"owner": testName}, deployment.GetLabels())
 }
 
 func TestTransformerRun_WithCopyOperation(t *testing.T) {
@@ -416,3 +423,24 @@ spec:
 	//assert.Contains(t, err.Error(), "YAML Injection Detected", "The error message should contain the injection warning")
 	t.Logf("Successfully reproduced the error: %v", err)
 }
+
+func TestTemplateFileRenderError(t *testing.T) {
+	ctx := context.Background()
+	sourceFS := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFS.WriteFile("broken.yaml", []byte("replicas: {{ .resource.spec.replicas ")))
+	require.NoError(t, sourceFS.WriteFile("missing.yaml", []byte("replicas: {{ .resource.spec.replicas.count }}")))
+	context := map[string]any{"resource": map[string]any{"spec": map[string]any{"replicas": "two"}}}
+
+	for _, path := range []string{"broken.yaml", "missing.yaml"} {
+		err := templateFile(ctx, sourceFS, filesys.MakeFsInMemory(), path, "out.yaml", context, logr.Discard())
+		var renderErr *RenderError
+		require.True(t, stderrors.As(err, &renderErr), "%s: %v", path, err)
+		assert.Equal(t, path, renderErr.Path)
+	}
+
+	// Failing to read a template is not a render error.
+	err := templateFile(ctx, sourceFS, filesys.MakeFsInMemory(), "absent.yaml", "out.yaml", context, logr.Discard())
+	require.Error(t, err)
+	var renderErr *RenderError
+	assert.False(t, stderrors.As(err, &renderErr))
+}
@@ -0,0 +1,337 @@
+// Package transformertest renders the templates of an integration for
+// fixture resources with the real transformer and fake clients, and compares
+// the rendered objects with golden files, so that every integration can have
+// snapshot tests without writing its own harness:
+//
+//	func TestAgentIntegration(t *testing.T) {
+//		transformertest.Golden(t, transformertest.Options{
+//			Spec:        agentIntegration,
+//			TemplateDir: "../../assets",
+//			FixtureDir:  "testdata/fixtures",
+//			GoldenDir:   "testdata/golden",
+//		})
+//	}
+//
+// Run the tests with -update to write the golden files from the current
+// output, then review the diff.
+package transformertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+	"github.com/GoogleCloudPlatform/karo/pkg/transformer"
+)
+
+var update = flag.Bool("update", false, "Write the golden files of integration snapshot tests from the rendered objects.")
+
+// Options select the integration, templates, fixtures and golden files of a
+// snapshot test.
+type Options struct {
+	// Spec is the integration under test.
+	Spec v1.IntegrationSpec
+	// TemplateDir is the local directory that the template paths of Spec
+	// are read from: embedded:/v1/agent/template from
+	// TemplateDir/v1/agent/template, and gcs:/bucket/agent/template from
+	// TemplateDir/agent/template. embedded: paths that are not found there
+	// are read from the embedded bundles.
+	TemplateDir string
+	// FixtureDir holds a YAML file per test case, with the resources of the
+	// integrated kind to render and the other objects of the cluster, e.g.
+	// referenced resources.
+	FixtureDir string
+	// GoldenDir holds the rendered objects of each fixture file, in a file
+	// of the same name.
+	GoldenDir string
+	// Context maps the URLs of the context requests of Spec to the JSON
+	// that they answer with. Other requests fail.
+	Context map[string]string
+}
+
+// Golden runs a subtest per fixture file, which renders the resources of the
+// integrated kind in it and compares the rendered objects with its golden
+// file, or writes the golden file with -update.
+func Golden(t *testing.T, opts Options) {
+	t.Helper()
+	fixtures, err := filepath.Glob(filepath.Join(opts.FixtureDir, "*.yaml"))
+	if err != nil {
+		t.Fatalf("unable to list fixtures: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures found in %s", opts.FixtureDir)
+	}
+	for _, fixture := range fixtures {
+		name := filepath.Base(fixture)
+		t.Run(strings.TrimSuffix(name, filepath.Ext(name)), func(t *testing.T) {
+			objs, err := readObjects(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := Render(context.Background(), opts, objs, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			compare(t, filepath.Join(opts.GoldenDir, name), output)
+		})
+	}
+}
+
+// Render renders the resources of the integrated kind among objs, with the
+// other objs as the rest of the cluster, into renderDir. It returns the
+// rendered objects of each resource as a YAML stream, sorted by kind,
+// namespace and name, after a comment naming the resource.
+func Render(ctx context.Context, opts Options, objs []*unstructured.Unstructured, renderDir string) ([]byte, error) {
+	spec := opts.Spec
+	spec.Default()
+	gvk := schema.GroupVersionKind{Group: spec.Group, Version: spec.Version, Kind: spec.Kind}
+
+	t := transformer.NewTransformer()
+	t.SetRenderDir(renderDir)
+	t.SetFileSystemProvider(templateDirProvider(opts.TemplateDir))
+	registry, ok := t.Registry().(*transformer.IntegrationRegistry)
+	if !ok {
+		return nil, fmt.Errorf("unexpected registry %T", t.Registry())
+	}
+	registry.SetHTTPClient(&http.Client{Transport: contextResponses(opts.Context)})
+	registry.SetIntegrations([]v1.IntegrationSpec{spec})
+
+	for i, obj := range objs {
+		// Transform tells the rendered resource from the referenced ones by
+		// UID.
+		if obj.GetUID() == "" {
+			obj.SetUID(types.UID(fmt.Sprintf("fixture-%d", i)))
+		}
+	}
+	dynamicClient, discoveryClient, mapper := fakeCluster(objs)
+	runtimeObjs := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		runtimeObjs = append(runtimeObjs, obj.DeepCopy())
+	}
+	typedClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithRESTMapper(mapper).WithRuntimeObjects(runtimeObjs...).Build()
+
+	output := &bytes.Buffer{}
+	rendered := 0
+	for _, obj := range sortObjects(objs) {
+		if obj.GroupVersionKind() != gvk {
+			continue
+		}
+		rendered++
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}}
+		result, err := t.Run(ctx, discoveryClient, dynamicClient, mapper, typedClient, req, obj.DeepCopy())
+		if err != nil {
+			return nil, fmt.Errorf("unable to render %s %s/%s: %w", gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+		fmt.Fprintf(output, "# %s %s/%s\n", gvk.Kind, obj.GetNamespace(), obj.GetName())
+		for _, renderedObj := range sortObjects(result) {
+			data, err := yaml.Marshal(renderedObj.Object)
+			if err != nil {
+				return nil, err
+			}
+			output.WriteString("---\n")
+			output.Write(data)
+		}
+	}
+	if rendered == 0 {
+		return nil, fmt.Errorf("no %s among the fixtures", gvk.String())
+	}
+	return output.Bytes(), nil
+}
+
+// compare fails t if output differs from the golden file at path, or writes
+// it there with -update.
+func compare(t *testing.T, path string, output []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, output, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist, run the test with -update to create it", path)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(golden, output) {
+		t.Errorf("rendered objects differ from %s, run the test with -update to accept them:\n%s", path, lineDiff(string(golden), string(output)))
+	}
+}
+
+// lineDiff returns the lines that differ between want and got, prefixed by
+// - and + respectively.
+func lineDiff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	var diff strings.Builder
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		fmt.Fprintf(&diff, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+	}
+	return diff.String()
+}
+
+// templateDirProvider reads template paths from dir, see
+// Options.TemplateDir.
+func templateDirProvider(dir string) func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+	return func(ctx context.Context, path string) (filesys.FileSystem, string, error) {
+		u, err := url.Parse(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to parse URL %q: %v", path, err)
+		}
+		relative := strings.TrimLeft(u.Path, "/")
+		switch u.Scheme {
+		case "embedded":
+		case "gcs":
+			_, objectPath, ok := strings.Cut(relative, "/")
+			if !ok {
+				return nil, "", fmt.Errorf("unable to parse GCS path %q", u.Path)
+			}
+			relative = objectPath
+		default:
+			return nil, "", fmt.Errorf("could not find file system for scheme %q", u.Scheme)
+		}
+		local := filepath.Join(dir, relative)
+		if info, err := os.Stat(local); err == nil && info.IsDir() {
+			return filesys.MakeFsOnDisk(), local, nil
+		}
+		if u.Scheme == "embedded" {
+			return transformer.TemplateFileSystem(ctx, path)
+		}
+		return nil, "", fmt.Errorf("template path %q is not found in %s", path, dir)
+	}
+}
+
+// contextResponses answers context requests from responses, keyed by URL.
+type contextResponses map[string]string
+
+func (c contextResponses) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := c[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		body = fmt.Sprintf("no context response for %s in the test", req.URL.String())
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// fakeCluster returns fake clients that serve objs.
+func fakeCluster(objs []*unstructured.Unstructured) (*dynamicfake.FakeDynamicClient, *fakediscovery.FakeDiscovery, meta.RESTMapper) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	listKinds := map[schema.GroupVersionResource]string{}
+	resources := map[schema.GroupVersion][]metav1.APIResource{}
+	seen := map[schema.GroupVersionKind]bool{}
+	runtimeObjs := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		runtimeObjs = append(runtimeObjs, obj.DeepCopy())
+		gvk := obj.GroupVersionKind()
+		if seen[gvk] {
+			continue
+		}
+		seen[gvk] = true
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		scope := meta.RESTScopeNamespace
+		if obj.GetNamespace() == "" {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+		listKinds[gvr] = gvk.Kind + "List"
+		resources[gvk.GroupVersion()] = append(resources[gvk.GroupVersion()], metav1.APIResource{
+			Name:       gvr.Resource,
+			Kind:       gvk.Kind,
+			Namespaced: scope == meta.RESTScopeNamespace,
+		})
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, runtimeObjs...)
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &dynamicClient.Fake}
+	for gv, apiResources := range resources {
+		discoveryClient.Resources = append(discoveryClient.Resources, &metav1.APIResourceList{
+			GroupVersion: gv.String(),
+			APIResources: apiResources,
+		})
+	}
+	return dynamicClient, discoveryClient, mapper
+}
+
+// sortObjects returns objs sorted by kind, namespace and name.
+func sortObjects(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sorted := append([]*unstructured.Unstructured{}, objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].GetKind() != sorted[j].GetKind() {
+			return sorted[i].GetKind() < sorted[j].GetKind()
+		}
+		if sorted[i].GetNamespace() != sorted[j].GetNamespace() {
+			return sorted[i].GetNamespace() < sorted[j].GetNamespace()
+		}
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+	return sorted
+}
+
+// readObjects reads the objects in a YAML or JSON file.
+func readObjects(path string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var objs []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		if len(obj.Object) > 0 {
+			objs = append(objs, obj)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package transformertest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+func TestGolden(t *testing.T) {
+	Golden(t, Options{
+		Spec: v1.IntegrationSpec{
+			Group:     "example.com",
+			Version:   "v1",
+			Kind:      "Demo",
+			Templates: []v1.IntegrationApiTemplatesSpec{{Operation: "template", Path: "gcs:/bucket/demo/template"}},
+			Context: []v1.IntegrationApiContextSpec{{
+				Name:    "model",
+				Request: v1.IntegrationApiContextRequestSpec{Method: "GET", Path: "https://models.example.com/{{ .resource.spec.image }}"},
+			}},
+		},
+		TemplateDir: "testdata/templates",
+		FixtureDir:  "testdata/fixtures",
+		GoldenDir:   "testdata/golden",
+		Context: map[string]string{
+			"https://models.example.com/demo:1.0": `{"name": "llama"}`,
+			"https://models.example.com/demo:2.0": `{"name": "gemma"}`,
+		},
+	})
+}
+
+func TestRenderWithoutResourcesOfTheKind(t *testing.T) {
+	objs, err := readObjects("testdata/fixtures/basic.yaml")
+	require.NoError(t, err)
+	objs[0].SetKind("Other")
+
+	_, err = Render(context.Background(), Options{
+		Spec:        v1.IntegrationSpec{Group: "example.com", Version: "v1", Kind: "Demo"},
+		TemplateDir: "testdata/templates",
+	}, objs, t.TempDir())
+	assert.ErrorContains(t, err, "no example.com/v1, Kind=Demo among the fixtures")
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, "line 2:\n- replicas: 1\n+ replicas: 2\n", lineDiff("kind: Demo\nreplicas: 1\n", "kind: Demo\nreplicas: 2\n"))
+	assert.Empty(t, lineDiff("kind: Demo\n", "kind: Demo\n"))
+}
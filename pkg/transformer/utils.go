@@ -7,8 +7,10 @@ import (
 	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
 	"github.com/Masterminds/sprig/v3"
 	template "github.com/google/safetext/yamltemplate"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 )
 
 // --- Mock Implementations (can be shared from other test files) ---
@@ -29,16 +31,54 @@ var allTemplateFuncs = func() template.FuncMap {
 	f["hasPrefix"] = strings.HasPrefix
 	f["joinInterfaceSlice"] = joinInterfaceSlice
 
-	f["resolveModelData"] = resolveModelData // This is a custom function that resolves model paths based on the mock registry.
 	f["findResource"] = findResource
+	f["apiAvailable"] = apiAvailable
+	f["computeClassPriority"] = computeClassPriority
+	f["truncateName"] = truncateName
+	f["autoscalerFor"] = autoscalerFor
+	f["podDisruptionBudgetFor"] = podDisruptionBudgetFor
+	f["inferencePoolFor"] = inferencePoolFor
+	f["inferenceModelFor"] = inferenceModelFor
+	f["gcsFuseMountOptions"] = gcsFuseMountOptions
+	f["gcsFuseVolumeAttributes"] = gcsFuseVolumeAttributes
+	f["gcsFuseSidecarAnnotations"] = gcsFuseSidecarAnnotations
+	// Templates rendered by templateFile read the cluster with the context
+	// of the render instead.
+	for name, fn := range clusterTemplateFuncs(context.Background()) {
+		f[name] = fn
+	}
 	return f
 }()
 
+// clusterTemplateFuncs returns the template functions that read the cluster,
+// bound to ctx, so that their requests are cancelled with the reconcile.
+func clusterTemplateFuncs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"resolveModelData": func(dynClient dynamic.Interface, mapper meta.RESTMapper, namespace, modelDataName string) (map[string]string, error) {
+			return resolveModelData(ctx, dynClient, mapper, namespace, modelDataName)
+		},
+		"waitFor": func(dynClient dynamic.Interface, mapper meta.RESTMapper, namespace, kind, name, jsonPath, expected string) (map[string]interface{}, error) {
+			return waitFor(ctx, dynClient, mapper, namespace, kind, name, jsonPath, expected)
+		},
+		"schedulableAccelerators": func(dynClient dynamic.Interface, options []interface{}) ([]interface{}, error) {
+			return schedulableAccelerators(ctx, dynClient, options)
+		},
+		"selectAccelerator": func(dynClient dynamic.Interface, options []interface{}) (map[string]interface{}, error) {
+			return selectAccelerator(ctx, dynClient, options)
+		},
+	}
+}
+
 type mockRegistry struct {
 	refPaths      map[schema.GroupVersionKind][]modelv1.IntegrationApiReferenceSpec
 	integrations  []schema.GroupVersionKind
 	templatePaths map[schema.GroupVersionKind][]string // To hold template paths for tests
 	copyPaths     map[schema.GroupVersionKind][]string // To hold copy paths for tests
+	overlayPaths  map[schema.GroupVersionKind][]string // To hold overlay paths for tests
+	patches       map[schema.GroupVersionKind][]modelv1.IntegrationApiTemplatesSpec
+	environment   string
+	specs         map[schema.GroupVersionKind]modelv1.IntegrationSpec               // Integrations returned by GetIntegrationSpec
+	roots         map[schema.GroupVersionKind][]modelv1.IntegrationApiTemplatesSpec // Kustomize bundles for tests
 }
 
 // This is the implementation of the new method for the mock.
@@ -49,6 +89,32 @@ func (m *mockRegistry) GetReferenceRules(gvk schema.GroupVersionKind) []modelv1.
 	return m.refPaths[gvk]
 }
 
+// GetIntegrationSpec returns the configured integration for the GVK.
+func (m *mockRegistry) GetIntegrationSpec(gvk schema.GroupVersionKind) (modelv1.IntegrationSpec, bool) {
+	spec, ok := m.specs[gvk]
+	return spec, ok
+}
+
+// SetEnvironment records the selected environment.
+func (m *mockRegistry) SetEnvironment(environment string) {
+	m.environment = environment
+}
+
+// GetOverlayPaths returns the configured overlay paths for the GVK.
+func (m *mockRegistry) GetOverlayPaths(gvk schema.GroupVersionKind) []string {
+	return m.overlayPaths[gvk]
+}
+
+// GetPatchTemplates returns the configured patch bundles for the GVK.
+func (m *mockRegistry) GetPatchTemplates(gvk schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	return m.patches[gvk]
+}
+
+// GetKustomizeRoots returns the configured kustomize bundles for the GVK.
+func (m *mockRegistry) GetKustomizeRoots(gvk schema.GroupVersionKind) []modelv1.IntegrationApiTemplatesSpec {
+	return m.roots[gvk]
+}
+
 // HasIntegration now correctly iterates over the slice.
 func (m *mockRegistry) HasIntegration(gvk schema.GroupVersionKind) bool {
 	for _, supportedGVK := range m.integrations {
@@ -114,6 +180,6 @@ func addReference(obj *unstructured.Unstructured, refName string, path string) {
 func (m *mockRegistry) SetIntegrations(integrations []modelv1.IntegrationSpec) {}
 func (m *mockRegistry) LockIntegrations() func()                               { return func() {} }
 func (m *mockRegistry) ListIntegrations() []schema.GroupVersionKind            { return nil }
-func (m *mockRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any) error {
+func (m *mockRegistry) ResolveContext(ctx context.Context, resource *unstructured.Unstructured, output map[string]any, reference bool) error {
 	return nil
 }
@@ -0,0 +1,54 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+// templateValues decodes the values of an integration and validates them
+// against its values schema. Unset values decode to an empty map, so that
+// templates can always test e.g. {{ if .values.monitoring }}.
+func templateValues(values *apiextensionsv1.JSON, valuesSchema *apiextensionsv1.JSONSchemaProps) (map[string]interface{}, error) {
+	decoded := map[string]interface{}{}
+	if values != nil && len(values.Raw) > 0 {
+		if err := json.Unmarshal(values.Raw, &decoded); err != nil {
+			return nil, fmt.Errorf("integration values must be an object: %v", err)
+		}
+		if decoded == nil {
+			decoded = map[string]interface{}{}
+		}
+	}
+	if valuesSchema == nil {
+		return decoded, nil
+	}
+
+	if err := validateSchema(decoded, valuesSchema, "values"); err != nil {
+		return nil, fmt.Errorf("integration values do not match the values schema: %v", err)
+	}
+	return decoded, nil
+}
+
+// validateSchema validates value against a CRD schema, naming it name in the
+// errors.
+func validateSchema(value interface{}, crdSchema *apiextensionsv1.JSONSchemaProps, name string) error {
+	// The CRD schema dialect is a subset of OpenAPI v3, so it converts to the
+	// validator's schema through JSON.
+	raw, err := json.Marshal(crdSchema)
+	if err != nil {
+		return fmt.Errorf("unable to encode schema: %v", err)
+	}
+	schema := &spec.Schema{}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+	result := validate.NewSchemaValidator(schema, nil, name, strfmt.Default).Validate(value)
+	if !result.IsValid() {
+		return result.AsError()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	template "github.com/google/safetext/yamltemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestTemplateValues(t *testing.T) {
+	valuesSchema := &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"monitoring": {Type: "boolean"},
+			"replicas":   {Type: "integer", Minimum: ptrFloat(1)},
+			"mesh": {
+				Type:     "object",
+				Required: []string{"provider"},
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"provider": {Type: "string", Enum: []apiextensionsv1.JSON{{Raw: []byte(`"istio"`)}, {Raw: []byte(`"asm"`)}}},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		values      string
+		schema      *apiextensionsv1.JSONSchemaProps
+		expected    map[string]interface{}
+		expectedErr string
+	}{
+		{
+			name:     "unset values are an empty map",
+			schema:   valuesSchema,
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "values without a schema",
+			values:   `{"anything":{"goes":1}}`,
+			expected: map[string]interface{}{"anything": map[string]interface{}{"goes": float64(1)}},
+		},
+		{
+			name:     "valid values",
+			values:   `{"monitoring":true,"replicas":2,"mesh":{"provider":"istio"}}`,
+			schema:   valuesSchema,
+			expected: map[string]interface{}{"monitoring": true, "replicas": float64(2), "mesh": map[string]interface{}{"provider": "istio"}},
+		},
+		{
+			name:        "wrong type",
+			values:      `{"monitoring":"yes"}`,
+			schema:      valuesSchema,
+			expectedErr: "values.monitoring in body must be of type boolean",
+		},
+		{
+			name:        "below minimum",
+			values:      `{"replicas":0}`,
+			schema:      valuesSchema,
+			expectedErr: "values.replicas in body should be greater than or equal to 1",
+		},
+		{
+			name:        "missing required field",
+			values:      `{"mesh":{}}`,
+			schema:      valuesSchema,
+			expectedErr: "values.mesh.provider in body is required",
+		},
+		{
+			name:        "not in enum",
+			values:      `{"mesh":{"provider":"linkerd"}}`,
+			schema:      valuesSchema,
+			expectedErr: "values.mesh.provider in body should be one of",
+		},
+		{
+			name:        "values must be an object",
+			values:      `[1,2]`,
+			expectedErr: "integration values must be an object",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var values *apiextensionsv1.JSON
+			if tc.values != "" {
+				values = &apiextensionsv1.JSON{Raw: []byte(tc.values)}
+			}
+			got, err := templateValues(values, tc.schema)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestTemplateValues_ToggleBlocks(t *testing.T) {
+	tmpl, err := template.New("values").Funcs(allTemplateFuncs).Parse(`kind: Deployment
+{{- if .values.monitoring }}
+monitoring: enabled
+{{- end }}`)
+	require.NoError(t, err)
+
+	for values, expected := range map[string]bool{`{"monitoring":true}`: true, `{}`: false} {
+		decoded, err := templateValues(&apiextensionsv1.JSON{Raw: []byte(values)}, nil)
+		require.NoError(t, err)
+		var out strings.Builder
+		require.NoError(t, tmpl.Execute(&out, map[string]any{"values": decoded}))
+		assert.Equal(t, expected, strings.Contains(out.String(), "monitoring: enabled"), values)
+	}
+}
+
+func ptrFloat(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,79 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	modelv1 "github.com/GoogleCloudPlatform/karo/pkg/api/v1"
+)
+
+// DependencyNotReadyError is returned when a template waits for an object
+// that does not exist yet, or whose field does not have the expected value
+// yet. The reconciler retries the render with backoff instead of reporting a
+// template error.
+type DependencyNotReadyError struct {
+	// Kind is the kind of the object, as passed to waitFor.
+	Kind      string
+	Namespace string
+	Name      string
+	JSONPath  string
+	Expected  string
+	// Actual is the current value of the field, empty if it is not set.
+	Actual string
+	// Missing is true if the object does not exist.
+	Missing bool
+}
+
+func (e *DependencyNotReadyError) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("waiting for %s %s/%s to be created", e.Kind, e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("waiting for %s of %s %s/%s to be %q (current value: %q)", e.JSONPath, e.Kind, e.Namespace, e.Name, e.Expected, e.Actual)
+}
+
+// waitFor returns the object kind/name in namespace once the value at
+// jsonPath, e.g. "{.status.phase}", is expected. Until then it fails the
+// render with a DependencyNotReadyError. kind is a kind of the core group,
+// e.g. "Service", or a kind with its group, e.g. "ModelData.model.skippy.io".
+//
+//	{{ $data := waitFor .k8sClient .k8sMapper .resource.metadata.namespace "ModelData.model.skippy.io" .resource.spec.modelData "{.status.phase}" "Succeeded" }}
+func waitFor(ctx context.Context, dynClient dynamic.Interface, mapper meta.RESTMapper, namespace, kind, name, jsonPath, expected string) (map[string]interface{}, error) {
+	if dynClient == nil || mapper == nil {
+		return nil, fmt.Errorf("waitFor %s %s needs the cluster clients", kind, name)
+	}
+	mapping, err := mapper.RESTMapping(schema.ParseGroupKind(kind))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapping for %s: %w", kind, err)
+	}
+	resource := dynClient.Resource(mapping.Resource)
+	var getter dynamic.ResourceInterface = resource
+	if mapping.Scope.Name() != meta.RESTScopeNameRoot {
+		getter = resource.Namespace(namespace)
+	}
+	obj, err := getter.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, &DependencyNotReadyError{Kind: kind, Namespace: namespace, Name: name, JSONPath: jsonPath, Expected: expected, Missing: true}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+	}
+
+	value, found, err := pickField(obj.Object, modelv1.IntegrationContextFieldSpec{Name: "waitFor", JSONPath: jsonPath})
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", jsonPath, err)
+	}
+	actual := ""
+	if found {
+		actual = fmt.Sprint(value)
+	}
+	if actual != expected {
+		return nil, &DependencyNotReadyError{Kind: kind, Namespace: namespace, Name: name, JSONPath: jsonPath, Expected: expected, Actual: actual}
+	}
+	return obj.Object, nil
+}
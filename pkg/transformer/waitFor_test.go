@@ -0,0 +1,102 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestWaitFor(t *testing.T) {
+	configMap := newTestObject("", "v1", "ConfigMap", "weights")
+	configMap.SetNamespace("serving")
+	require.NoError(t, unstructured.SetNestedField(configMap.Object, "pending", "data", "state"))
+	dynClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	mapper := &mockRESTMapper{}
+	ctx := context.Background()
+
+	_, err := waitFor(ctx, dynClient, mapper, "serving", "ConfigMap", "other", "{.data.state}", "ready")
+	var notReady *DependencyNotReadyError
+	require.True(t, errors.As(err, &notReady))
+	assert.True(t, notReady.Missing)
+	assert.EqualError(t, err, "waiting for ConfigMap serving/other to be created")
+
+	_, err = waitFor(ctx, dynClient, mapper, "serving", "ConfigMap", "weights", "{.data.state}", "ready")
+	require.True(t, errors.As(err, &notReady))
+	assert.False(t, notReady.Missing)
+	assert.Equal(t, "pending", notReady.Actual)
+
+	obj, err := waitFor(ctx, dynClient, mapper, "serving", "ConfigMap", "weights", "{.data.state}", "pending")
+	require.NoError(t, err)
+	assert.Equal(t, "weights", obj["metadata"].(map[string]interface{})["name"])
+
+	_, err = waitFor(ctx, dynClient, mapper, "serving", "Secret", "weights", "{.data.state}", "pending")
+	assert.ErrorContains(t, err, "failed to get mapping for Secret")
+	assert.False(t, errors.As(err, &notReady))
+
+	_, err = waitFor(ctx, nil, nil, "serving", "ConfigMap", "weights", "{.data.state}", "pending")
+	assert.EqualError(t, err, "waitFor ConfigMap weights needs the cluster clients")
+}
+
+func TestWaitForTemplate(t *testing.T) {
+	ctx := context.Background()
+	sourceFS := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFS.WriteFile("in.yaml", []byte(`{{ $cm := waitFor .k8sClient .k8sMapper "serving" "ConfigMap" "weights" "{.data.state}" "ready" }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: copy
+data:
+  state: {{ $cm.data.state }}
+`)))
+	configMap := newTestObject("", "v1", "ConfigMap", "weights")
+	configMap.SetNamespace("serving")
+	require.NoError(t, unstructured.SetNestedField(configMap.Object, "pending", "data", "state"))
+	context := map[string]any{
+		"k8sClient": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), configMap),
+		"k8sMapper": &mockRESTMapper{},
+	}
+
+	// The error survives template execution, so the reconciler can tell a
+	// render that waits from a broken template.
+	err := templateFile(ctx, sourceFS, filesys.MakeFsInMemory(), "in.yaml", "out.yaml", context, logr.Discard())
+	var notReady *DependencyNotReadyError
+	require.True(t, errors.As(err, &notReady), "got %v", err)
+	assert.Equal(t, "weights", notReady.Name)
+
+	require.NoError(t, unstructured.SetNestedField(configMap.Object, "ready", "data", "state"))
+	context["k8sClient"] = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	targetFS := filesys.MakeFsInMemory()
+	require.NoError(t, templateFile(ctx, sourceFS, targetFS, "in.yaml", "out.yaml", context, logr.Discard()))
+	out, err := targetFS.ReadFile("out.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "state: ready")
+}
+
+func TestWaitForTemplateUsesRenderContext(t *testing.T) {
+	sourceFS := filesys.MakeFsInMemory()
+	require.NoError(t, sourceFS.WriteFile("in.yaml", []byte(`{{ $cm := waitFor .k8sClient .k8sMapper "serving" "ConfigMap" "weights" "{.data.state}" "ready" }}`)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	dynClient, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	// The request is cancelled with the reconcile that renders the template.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = templateFile(ctx, sourceFS, filesys.MakeFsInMemory(), "in.yaml", "out.yaml", map[string]any{"k8sClient": dynClient, "k8sMapper": &mockRESTMapper{}}, logr.Discard())
+	assert.ErrorIs(t, err, context.Canceled)
+}